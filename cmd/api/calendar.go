@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/ical"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// calendarFeedTokenTTL is how long a feed token works. Calendar apps poll the
+// feed for as long as the subscription exists, so it is long-lived.
+const calendarFeedTokenTTL = 365 * 24 * time.Hour
+
+var calendarEventStatuses = map[string]string{
+	data.ReservationStatusPending:   ical.StatusTentative,
+	data.ReservationStatusConfirmed: ical.StatusConfirmed,
+	data.ReservationStatusActive:    ical.StatusConfirmed,
+}
+
+// Issue a token for subscribing a calendar app to the user's reservations.
+// Any previous token stops working, so this also rotates a leaked token.
+func (app *application) createCalendarFeedTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.modelsFor(r).Tokens.DeleteAllForUser(data.ScopeCalendarFeed, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.modelsFor(r).Tokens.New(user.ID, calendarFeedTokenTTL, data.ScopeCalendarFeed)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	feedURL := fmt.Sprintf("/v1/feeds/%s/reservations.ics?token=%s", user.ID, token.Plaintext)
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"calendar_feed_token": token, "feed_url": feedURL}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Revoke the user's calendar feed token
+func (app *application) deleteCalendarFeedTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.modelsFor(r).Tokens.DeleteAllForUser(data.ScopeCalendarFeed, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "calendar feed token revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Serve the user's upcoming reservations as an iCalendar feed. Calendar apps
+// can't send an Authorization header, so the feed token in the query string
+// authenticates the request. It only grants access to its own user's feed.
+func (app *application) reservationCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+		app.invalidFeedTokenResponse(w, r)
+		return
+	}
+
+	user, err := app.modelsFor(r).Users.GetForToken(data.ScopeCalendarFeed, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidFeedTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Answer the same way as for an unknown token so the response doesn't
+	// reveal whose token it is
+	if user.ID != id {
+		app.invalidFeedTokenResponse(w, r)
+		return
+	}
+
+	reservations, err := app.modelsFor(r).Reservations.GetUpcomingForCalendar(user.ID, time.Now())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	calendar := ical.Calendar{
+		ProdID: "-//SpotLinkIO//Reservations " + version + "//EN",
+		Name:   "SpotLinkIO reservations",
+	}
+
+	for _, reservation := range reservations {
+		calendar.Events = append(calendar.Events, calendarEvent(reservation))
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="reservations.ics"`)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(calendar.Bytes())
+}
+
+func calendarEvent(reservation *data.CalendarReservation) ical.Event {
+	summary := "Parking at " + reservation.LotName
+	description := fmt.Sprintf("Reservation %s", reservation.ID)
+	if reservation.SpotNumber != nil {
+		summary += ", spot " + *reservation.SpotNumber
+		description += "\nSpot " + *reservation.SpotNumber
+	}
+
+	return ical.Event{
+		UID:         reservation.ID.String() + "@spotlinkio",
+		Start:       reservation.StartTime,
+		End:         reservation.EndTime,
+		Summary:     summary,
+		Location:    reservation.LotAddress,
+		Description: description,
+		Status:      calendarEventStatuses[reservation.Status],
+		Updated:     reservation.UpdatedAt,
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+)
+
+// getCalendarFeed requests the calendar feed of userID with token.
+func getCalendarFeed(app *application, userID uuid.UUID, token string) *httptest.ResponseRecorder {
+	target := "/v1/feeds/" + userID.String() + "/reservations.ics?token=" + url.QueryEscape(token)
+	r := withParams(httptest.NewRequest(http.MethodGet, target, nil), "id", userID.String())
+
+	rr := httptest.NewRecorder()
+	app.reservationCalendarFeedHandler(rr, r)
+	return rr
+}
+
+func TestReservationCalendarFeedRejectsMalformedTokens(t *testing.T) {
+	app := newTestApplication(t)
+
+	for _, token := range []string{"", "short", strings.Repeat("A", 27)} {
+		rr := getCalendarFeed(app, uuid.New(), token)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: status = %d, want %d", token, rr.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestReservationCalendarFeed(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	user := insertTestUser(t, app)
+	other := insertTestUser(t, app)
+	lot, spots := insertTestLot(t, app, user.ID, 2)
+	vehicle := insertTestVehicle(t, app, user.ID)
+
+	now := time.Now()
+	book := func(spot *data.ParkingSpot, start time.Time, status string) *data.Reservation {
+		t.Helper()
+
+		reservation := &data.Reservation{
+			UserID:        user.ID,
+			VehicleID:     vehicle.ID,
+			ParkingLotID:  lot.ID,
+			ParkingSpotID: &spot.ID,
+			StartTime:     start,
+			EndTime:       start.Add(time.Hour),
+			Status:        status,
+		}
+		if err := app.models.Reservations.Insert(reservation); err != nil {
+			t.Fatal(err)
+		}
+		return reservation
+	}
+
+	upcoming := book(spots[0], now.Add(24*time.Hour), data.ReservationStatusConfirmed)
+	cancelled := book(spots[1], now.Add(48*time.Hour), data.ReservationStatusCancelled)
+	past := book(spots[1], now.Add(-72*time.Hour), data.ReservationStatusConfirmed)
+
+	rr := httptest.NewRecorder()
+	app.createCalendarFeedTokenHandler(rr, newAuthenticatedRequest(app, http.MethodPost, "/v1/users/me/calendar-feed-token", "", user))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create token: status = %d: %s", rr.Code, rr.Body)
+	}
+
+	var created struct {
+		FeedURL string `json:"feed_url"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	feedURL, err := url.Parse(created.FeedURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feedURL.Path != "/v1/feeds/"+user.ID.String()+"/reservations.ics" {
+		t.Errorf("feed path = %s", feedURL.Path)
+	}
+	token := feedURL.Query().Get("token")
+
+	rr = getCalendarFeed(app, user.ID, token)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("feed: status = %d: %s", rr.Code, rr.Body)
+	}
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/calendar") {
+		t.Errorf("Content-Type = %q", rr.Header().Get("Content-Type"))
+	}
+
+	feed := strings.ReplaceAll(rr.Body.String(), "\r\n ", "")
+	if strings.Count(feed, "BEGIN:VEVENT") != 1 {
+		t.Errorf("feed has %d events, want 1:\n%s", strings.Count(feed, "BEGIN:VEVENT"), feed)
+	}
+	if !strings.Contains(feed, "UID:"+upcoming.ID.String()+"@spotlinkio") {
+		t.Errorf("upcoming reservation missing from feed:\n%s", feed)
+	}
+	for _, r := range []*data.Reservation{cancelled, past} {
+		if strings.Contains(feed, r.ID.String()) {
+			t.Errorf("reservation %s (%s) is in the feed", r.ID, r.Status)
+		}
+	}
+	if !strings.Contains(feed, "DTSTART:"+upcoming.StartTime.UTC().Format("20060102T150405Z")) {
+		t.Errorf("feed doesn't start the event at %s:\n%s", upcoming.StartTime.UTC(), feed)
+	}
+	if !strings.Contains(feed, "spot "+spots[0].SpotNumber) || !strings.Contains(feed, "STATUS:CONFIRMED") {
+		t.Errorf("event is missing its spot or status:\n%s", feed)
+	}
+
+	// The token only opens its own user's feed
+	rr = getCalendarFeed(app, other.ID, token)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("other user's feed: status = %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+
+	// A bearer token can't be used as a feed token
+	authToken, err := app.models.Tokens.New(user.ID, time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = getCalendarFeed(app, user.ID, authToken.Plaintext)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("authentication token: status = %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+
+	// Rotating the token revokes the old one
+	rr = httptest.NewRecorder()
+	app.createCalendarFeedTokenHandler(rr, newAuthenticatedRequest(app, http.MethodPost, "/v1/users/me/calendar-feed-token", "", user))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("rotate token: status = %d: %s", rr.Code, rr.Body)
+	}
+	rr = getCalendarFeed(app, user.ID, token)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("rotated token: status = %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
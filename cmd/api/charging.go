@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// getOwnedParkingSession loads the parking session named in the URL and its
+// spot, and checks that the authenticated user owns the lot. It writes the
+// error response and returns nils when it can't.
+func (app *application) getOwnedParkingSession(w http.ResponseWriter, r *http.Request) (*data.ParkingSession, *data.ParkingSpot) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, nil
+	}
+
+	session, err := app.modelsFor(r).ParkingSessions.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, nil
+	}
+
+	spot, err := app.modelsFor(r).ParkingSpots.Get(session.ParkingSpotID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, nil
+	}
+
+	if app.getOwnedParkingLot(w, r, spot.ParkingLotID) == nil {
+		return nil, nil
+	}
+
+	return session, spot
+}
+
+// Start charging a vehicle parked at an electric spot, from the charger's
+// meter reading. Without an energy_rate the default rate per kWh applies. Only
+// the owner of the session's lot may do this.
+func (app *application) startChargingHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		StartKWh   float64  `json:"start_kwh"`
+		EnergyRate *float64 `json:"energy_rate"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	session, spot := app.getOwnedParkingSession(w, r)
+	if session == nil {
+		return
+	}
+
+	charging := &data.ChargingSession{
+		ParkingSessionID: session.ID,
+		StartKWh:         input.StartKWh,
+		EnergyRate:       data.DefaultEnergyRate,
+		StartedAt:        time.Now(),
+	}
+	if input.EnergyRate != nil {
+		charging.EnergyRate = *input.EnergyRate
+	}
+
+	v := validator.New()
+	if data.ValidateChargingStart(v, spot, session, charging); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.modelsFor(r).ChargingSessions.Insert(charging)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrChargingInProgress):
+			v.AddError("parking_session", "is already charging")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"charging_session": charging}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Stop the running charging session at the charger's final meter reading. The
+// energy drawn is billed to the driver as a pending payment alongside their
+// parking charges. Only the owner of the session's lot may do this.
+func (app *application) stopChargingHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		EndKWh *float64 `json:"end_kwh"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.EndKWh != nil, "end_kwh", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	session, _ := app.getOwnedParkingSession(w, r)
+	if session == nil {
+		return
+	}
+
+	charging, err := app.modelsFor(r).ChargingSessions.GetActiveBySession(session.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("parking_session", "is not charging")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if data.ValidateChargingStop(v, charging, *input.EndKWh); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	payment, err := app.modelsFor(r).ChargingSessions.Finalize(charging, session, *input.EndKWh, time.Now())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"charging_session": charging, "payment": payment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
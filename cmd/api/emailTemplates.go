@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"net/http"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/mailer"
+)
+
+// List the email templates the mailer can send (admin only)
+func (app *application) listEmailTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"email_templates": mailer.Templates()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Render an email template without sending it (admin only). Values in data
+// override the template's sample data; the body may be omitted entirely.
+func (app *application) previewEmailTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl, ok := mailer.LookupTemplate(app.readStringParam(r, "name"))
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Data map[string]any `json:"data"`
+	}
+
+	if r.ContentLength != 0 {
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	emailData := maps.Clone(tmpl.SampleData)
+	maps.Copy(emailData, input.Data)
+
+	email, err := mailer.Render(tmpl.Name, emailData)
+	if err != nil {
+		switch {
+		case errors.Is(err, mailer.ErrUnknownTemplate):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"template": tmpl.Name, "data": emailData, "email": email}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
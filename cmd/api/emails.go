@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// queueEmail adds an email to the outbox and starts delivering it straight
+// away, so it doesn't wait for the next run of the delivery job. If that first
+// attempt fails the job retries it.
+func (app *application) queueEmail(recipient, template string, emailData map[string]any) error {
+	email := &data.OutboxEmail{
+		Recipient: recipient,
+		Template:  template,
+		Data:      emailData,
+	}
+
+	err := app.models.EmailOutbox.Enqueue(email)
+	if err != nil {
+		return err
+	}
+
+	app.background(func() {
+		err := app.deliverQueuedEmails()
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	return nil
+}
+
+// List queued emails, dead-lettered ones by default (admin only)
+func (app *application) listOutboxEmailsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Status string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Status = app.readString(qs, "status", data.EmailStatusDead)
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"created_at", "next_attempt_at", "attempts", "-created_at", "-next_attempt_at", "-attempts"}
+
+	v.Check(validator.PermittedValue(input.Status, data.EmailStatusPending, data.EmailStatusSent, data.EmailStatusDead), "status", "must be pending, sent or dead")
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	emails, metadata, err := app.modelsFor(r).EmailOutbox.GetAll(input.Status, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"emails": emails, "metadata": app.withPageLinks(r, metadata)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Put a dead-lettered email back in the queue with fresh attempts (admin only)
+func (app *application) retryOutboxEmailHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	email, err := app.modelsFor(r).EmailOutbox.Requeue(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.background(func() {
+		err := app.deliverQueuedEmails()
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"email": email}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -5,21 +5,57 @@ import (
 	"net/http"
 )
 
+// Machine-readable error codes returned in the "code" field of every error
+// response. Clients should branch on these rather than on the message text.
+const (
+	errCodeServerError          = "SERVER_ERROR"
+	errCodeNotFound             = "NOT_FOUND"
+	errCodeMethodNotAllowed     = "METHOD_NOT_ALLOWED"
+	errCodeBadRequest           = "BAD_REQUEST"
+	errCodeValidationFailed     = "VALIDATION_FAILED"
+	errCodeEditConflict         = "EDIT_CONFLICT"
+	errCodeRateLimitExceeded    = "RATE_LIMIT_EXCEEDED"
+	errCodeInvalidCredentials   = "INVALID_CREDENTIALS"
+	errCodeInvalidToken         = "INVALID_TOKEN"
+	errCodeAuthRequired         = "AUTHENTICATION_REQUIRED"
+	errCodeInactiveAccount      = "INACTIVE_ACCOUNT"
+	errCodeNotPermitted         = "NOT_PERMITTED"
+	errCodeVehicleAlreadyParked = "VEHICLE_ALREADY_PARKED"
+	errCodeNoSpotAvailable      = "NO_SPOT_AVAILABLE"
+	errCodeSpotUnavailable      = "SPOT_UNAVAILABLE"
+	errCodeNotEligibleForSpot   = "NOT_ELIGIBLE_FOR_SPOT"
+	errCodeInvalidTransition    = "INVALID_STATUS_TRANSITION"
+	errCodeQRCodeExpired        = "QR_CODE_EXPIRED"
+	errCodeSMSUnavailable       = "SMS_UNAVAILABLE"
+)
+
 type ValidationError struct {
 	Errors map[string]string
 }
 
+type errorBody struct {
+	Code      string            `json:"code"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
 func (app *application) logError(r *http.Request, err error) {
 	app.logger.PrintError(err, map[string]string{
 		"request_method": r.Method,
 		"request_url":    r.URL.String(),
+		"request_id":     app.contextGetRequestID(r),
 	})
 }
 
-func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
-	env := envelope{"error": message}
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	app.writeError(w, r, status, errorBody{Code: code, Message: message})
+}
+
+func (app *application) writeError(w http.ResponseWriter, r *http.Request, status int, body errorBody) {
+	body.RequestID = app.contextGetRequestID(r)
 
-	err := app.writeJSON(w, status, env, nil)
+	err := app.writeJSON(w, status, envelope{"error": body}, nil)
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(500)
@@ -27,28 +63,43 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 }
 
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	// Queries fail once the client disconnects and cancels the request
+	// context. Nobody is waiting for the response, and it isn't a server fault.
+	if r.Context().Err() != nil {
+		app.logger.PrintInfo("request cancelled by client", map[string]string{
+			"request_method": r.Method,
+			"request_url":    r.URL.String(),
+			"request_id":     app.contextGetRequestID(r),
+		})
+		return
+	}
+
 	app.logError(r, err)
 	message := "the server encountered a problem and could not process your request"
 
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+	app.errorResponse(w, r, http.StatusInternalServerError, errCodeServerError, message)
 }
 
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
 	message := "the requested resource could not be found"
-	app.errorResponse(w, r, http.StatusNotFound, message)
+	app.errorResponse(w, r, http.StatusNotFound, errCodeNotFound, message)
 }
 
 func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
 	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
-	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
+	app.errorResponse(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, message)
 }
 
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+	app.errorResponse(w, r, http.StatusBadRequest, errCodeBadRequest, err.Error())
 }
 
 func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
-	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+	app.writeError(w, r, http.StatusUnprocessableEntity, errorBody{
+		Code:    errCodeValidationFailed,
+		Message: "one or more fields failed validation",
+		Fields:  errors,
+	})
 }
 
 func (ve ValidationError) Error() string {
@@ -61,17 +112,17 @@ func (ve ValidationError) Error() string {
 
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
 	message := "unable to update the record due to an edit conflict, please try again"
-	app.errorResponse(w, r, http.StatusConflict, message)
+	app.errorResponse(w, r, http.StatusConflict, errCodeEditConflict, message)
 }
 
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeded"
-	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+	app.errorResponse(w, r, http.StatusTooManyRequests, errCodeRateLimitExceeded, message)
 }
 
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	app.errorResponse(w, r, http.StatusUnauthorized, errCodeInvalidCredentials, message)
 }
 
 func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
@@ -79,20 +130,54 @@ func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter
 	w.Header().Set("WWW-Authenticate", "Bearer")
 
 	message := "invalid or missing authentication token"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	app.errorResponse(w, r, http.StatusUnauthorized, errCodeInvalidToken, message)
+}
+
+func (app *application) invalidFeedTokenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or expired calendar feed token"
+	app.errorResponse(w, r, http.StatusUnauthorized, errCodeInvalidToken, message)
 }
 
 func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
 	message := "you must be authenticated to access this resource"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	app.errorResponse(w, r, http.StatusUnauthorized, errCodeAuthRequired, message)
 }
 
 func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account must be activated before you can access this resource"
-	app.errorResponse(w, r, http.StatusForbidden, message)
+	app.errorResponse(w, r, http.StatusForbidden, errCodeInactiveAccount, message)
 }
 
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account does not have the necessary permissions to access this resource"
-	app.errorResponse(w, r, http.StatusForbidden, message)
+	app.errorResponse(w, r, http.StatusForbidden, errCodeNotPermitted, message)
+}
+
+func (app *application) vehicleAlreadyParkedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this vehicle is already checked in to a parking spot"
+	app.errorResponse(w, r, http.StatusConflict, errCodeVehicleAlreadyParked, message)
+}
+
+func (app *application) noSpotAvailableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "no parking spot is currently available"
+	app.errorResponse(w, r, http.StatusConflict, errCodeNoSpotAvailable, message)
+}
+
+func (app *application) spotUnavailableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this parking spot is occupied, reserved or held by someone else"
+	app.errorResponse(w, r, http.StatusConflict, errCodeSpotUnavailable, message)
+}
+
+func (app *application) notEligibleForSpotResponse(w http.ResponseWriter, r *http.Request) {
+	message := "handicapped spots require a verified disability permit"
+	app.errorResponse(w, r, http.StatusForbidden, errCodeNotEligibleForSpot, message)
+}
+
+func (app *application) qrCodeExpiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this QR code has expired"
+	app.errorResponse(w, r, http.StatusGone, errCodeQRCodeExpired, message)
+}
+
+func (app *application) invalidTransitionResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorResponse(w, r, http.StatusConflict, errCodeInvalidTransition, err.Error())
 }
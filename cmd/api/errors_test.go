@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/jsonlog"
+)
+
+func TestErrorResponses(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name   string
+		write  func(w http.ResponseWriter, r *http.Request)
+		status int
+		code   string
+	}{
+		{"serverError", func(w http.ResponseWriter, r *http.Request) { app.serverErrorResponse(w, r, errors.New("boom")) }, http.StatusInternalServerError, errCodeServerError},
+		{"notFound", app.notFoundResponse, http.StatusNotFound, errCodeNotFound},
+		{"methodNotAllowed", app.methodNotAllowedResponse, http.StatusMethodNotAllowed, errCodeMethodNotAllowed},
+		{"badRequest", func(w http.ResponseWriter, r *http.Request) { app.badRequestResponse(w, r, errors.New("bad")) }, http.StatusBadRequest, errCodeBadRequest},
+		{"failedValidation", func(w http.ResponseWriter, r *http.Request) {
+			app.failedValidationResponse(w, r, map[string]string{"name": "must be provided"})
+		}, http.StatusUnprocessableEntity, errCodeValidationFailed},
+		{"editConflict", app.editConflictResponse, http.StatusConflict, errCodeEditConflict},
+		{"rateLimitExceeded", app.rateLimitExceededResponse, http.StatusTooManyRequests, errCodeRateLimitExceeded},
+		{"invalidCredentials", app.invalidCredentialsResponse, http.StatusUnauthorized, errCodeInvalidCredentials},
+		{"invalidAuthenticationToken", app.invalidAuthenticationTokenResponse, http.StatusUnauthorized, errCodeInvalidToken},
+		{"authenticationRequired", app.authenticationRequiredResponse, http.StatusUnauthorized, errCodeAuthRequired},
+		{"inactiveAccount", app.inactiveAccountResponse, http.StatusForbidden, errCodeInactiveAccount},
+		{"notPermitted", app.notPermittedResponse, http.StatusForbidden, errCodeNotPermitted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/anything", nil)
+
+			tt.write(rr, r)
+
+			if rr.Code != tt.status {
+				t.Errorf("got status %d; want %d", rr.Code, tt.status)
+			}
+
+			body := decodeError(t, rr)
+			if body.Code != tt.code {
+				t.Errorf("got code %q; want %q", body.Code, tt.code)
+			}
+			if body.Message == "" {
+				t.Error("got an empty message")
+			}
+		})
+	}
+}
+
+func TestFailedValidationResponseNestsFields(t *testing.T) {
+	app := newTestApplication(t)
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1/vehicles", nil)
+
+	app.failedValidationResponse(rr, r, map[string]string{"license_plate": "must be provided"})
+
+	body := decodeError(t, rr)
+	if got := body.Fields["license_plate"]; got != "must be provided" {
+		t.Errorf("got license_plate error %q; want %q", got, "must be provided")
+	}
+}
+
+func TestErrorResponseIncludesRequestID(t *testing.T) {
+	app := newTestApplication(t)
+
+	const requestID = "5b0c7c1e-4d0c-4f5f-9c55-2f1f1a7b6f10"
+
+	handler := app.requestID(http.HandlerFunc(app.notFoundResponse))
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/missing", nil)
+	r.Header.Set("X-Request-ID", requestID)
+
+	handler.ServeHTTP(rr, r)
+
+	if got := rr.Header().Get("X-Request-ID"); got != requestID {
+		t.Errorf("got X-Request-ID header %q; want %q", got, requestID)
+	}
+
+	body := decodeError(t, rr)
+	if body.RequestID != requestID {
+		t.Errorf("got request_id %q; want %q", body.RequestID, requestID)
+	}
+}
+
+func TestRequestIDReplacesMalformedIDs(t *testing.T) {
+	app := newTestApplication(t)
+
+	handler := app.requestID(http.HandlerFunc(app.notFoundResponse))
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/missing", nil)
+	r.Header.Set("X-Request-ID", "<script>")
+
+	handler.ServeHTTP(rr, r)
+
+	body := decodeError(t, rr)
+	if body.RequestID == "" || body.RequestID == "<script>" {
+		t.Errorf("got request_id %q; want a freshly generated ID", body.RequestID)
+	}
+}
+
+func TestServerErrorResponseSkipsCancelledRequests(t *testing.T) {
+	var logs bytes.Buffer
+	app := &application{logger: jsonlog.New(&logs, jsonlog.LevelInfo)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/parking-lots", nil).WithContext(ctx)
+
+	app.serverErrorResponse(rr, r, context.Canceled)
+
+	if rr.Body.Len() != 0 {
+		t.Errorf("wrote a response to a cancelled request: %s", rr.Body)
+	}
+	if !strings.Contains(logs.String(), "request cancelled by client") {
+		t.Errorf("cancellation not logged: %s", logs.String())
+	}
+	if strings.Contains(logs.String(), `"level":"ERROR"`) {
+		t.Errorf("cancellation logged as an error: %s", logs.String())
+	}
+}
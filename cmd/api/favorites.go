@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// Save a parking lot to the authenticated user's favorites
+func (app *application) addFavoriteHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.modelsFor(r).ParkingLots.Get(lotID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.modelsFor(r).Favorites.Add(user.ID, lotID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"parking_lot_id": lotID, "is_favorite": true}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Remove a parking lot from the authenticated user's favorites
+func (app *application) removeFavoriteHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.modelsFor(r).Favorites.Remove(user.ID, lotID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"parking_lot_id": lotID, "is_favorite": false}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get all favorite parking lots for the authenticated user
+func (app *application) listFavoritesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-favorited_at")
+	input.Filters.SortSafelist = []string{"name", "hourly_rate", "average_rating", "favorited_at", "-name", "-hourly_rate", "-average_rating", "-favorited_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	favorites, metadata, err := app.modelsFor(r).Favorites.GetForUser(user.ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"favorites": favorites, "metadata": app.withPageLinks(r, metadata)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
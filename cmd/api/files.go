@@ -122,8 +122,9 @@ func (app *application) serveFilesHandler(w http.ResponseWriter, r *http.Request
 
     // Define allowed file types and their directories
     allowedTypes := map[string]string{
-        "avatars": "../../uploads/avatars",
-        "pdfs":    "../../uploads",
+        "avatars":    "../../uploads/avatars",
+        "pdfs":       "../../uploads",
+        "lot-images": lotImagesDir,
         // Add other file types as needed
     }
 
@@ -148,6 +149,8 @@ func (app *application) serveFilesHandler(w http.ResponseWriter, r *http.Request
     switch fileType {
     case "pdfs":
         extensions = []string{".pdf"}
+    case "lot-images":
+        extensions = []string{".jpg", ".png", ".gif"}
     default:
         extensions = []string{".jpg", ".jpeg", ".png", ".gif", ".pdf"}
     }
@@ -187,7 +190,7 @@ func (app *application) serveFilesHandler(w http.ResponseWriter, r *http.Request
     w.Header().Set("Content-Type", contentType)
     
     // Cache static assets but not sensitive documents
-    if fileType == "avatars" {
+    if fileType == "avatars" || fileType == "lot-images" {
         w.Header().Set("Cache-Control", "public, max-age=604800") // Cache for a week
     } else {
         w.Header().Set("Cache-Control", "no-store") // Don't cache
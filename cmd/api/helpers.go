@@ -2,7 +2,9 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,11 +13,14 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
 	"github.com/mayura-andrew/SpotLinkIO-backend/internal/utils"
 	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
 )
@@ -44,14 +49,63 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 		w.Header()[key] = value
 	}
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 
-	// Use http.StatusText to get the status text for the given status code
-	w.Header().Set("Status", http.StatusText(status))
+	_, err = w.Write(js)
+	return err
+}
+
+// writeJSONWithETag works like writeJSON but also sets an ETag computed from a
+// hash of the response body. If the request carries a matching If-None-Match
+// header, a 304 Not Modified is sent instead of the body.
+func (app *application) writeJSONWithETag(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	js = append(js, '\n')
+
+	sum := sha256.Sum256(js)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 
 	_, err = w.Write(js)
 	return err
 }
 
+// etagMatches reports whether an If-None-Match header value matches the given
+// ETag, using weak comparison as required for GET requests.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
 
 	maxBytes := 1_048_576 * 10 // 1MB
@@ -157,7 +211,7 @@ func (app *application) processAndSaveAvatar(inputBase64 string, w http.Response
 	fmt.Println("imgData", imgData)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
-		return "", fmt.Errorf("invalid image file", err)
+		return "", fmt.Errorf("invalid image file: %w", err)
 	}
 
 	if len(imgData) < 8 {
@@ -171,13 +225,13 @@ func (app *application) processAndSaveAvatar(inputBase64 string, w http.Response
 
 	if !isJPEG && !isPNG && !isGIF {
 		app.badRequestResponse(w, r, fmt.Errorf("invalid image file"))
-		return "", fmt.Errorf("unsupported image format", err)
+		return "", errors.New("unsupported image format")
 	}
 
 	const maxImageSize = 5 * 1024 * 1024 // 5MB
 	if len(imgData) > maxImageSize {
 		app.badRequestResponse(w, r, fmt.Errorf("image file size must be less than 5MB"))
-		return "", fmt.Errorf("image too large", err)
+		return "", errors.New("image too large")
 	}
 
 	// save the image to a file
@@ -280,6 +334,102 @@ func (app *application) readCSV(qs url.Values, key string, defaultValue []string
 	return strings.Split(csv, ",")
 }
 
+// selectFields implements sparse fieldsets for list responses. It replaces the
+// slice stored under key in the envelope with a slice of objects that only hold
+// the requested fields. Requested names are checked against the json tags of the
+// slice's element type; unknown names are silently ignored. If no fields are
+// requested the envelope is left untouched.
+func (app *application) selectFields(env envelope, key string, fields []string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	value, ok := env[key]
+	if !ok {
+		return nil
+	}
+
+	known := jsonFieldNames(reflect.TypeOf(value))
+
+	wanted := make(map[string]bool)
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if known[field] {
+			wanted[field] = true
+		}
+	}
+
+	// Nothing usable was requested, so fall back to the full representation
+	if len(wanted) == 0 {
+		return nil
+	}
+
+	js, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	var items []map[string]json.RawMessage
+	err = json.Unmarshal(js, &items)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		for name := range item {
+			if !wanted[name] {
+				delete(item, name)
+			}
+		}
+	}
+
+	env[key] = items
+	return nil
+}
+
+// jsonFieldNames returns the set of json field names for the struct type held
+// by a slice, array or pointer type.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+
+	for t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Pointer) {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		return names
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		// Untagged embedded structs have their fields promoted by encoding/json
+		if field.Anonymous && tag == "" {
+			for name := range jsonFieldNames(field.Type) {
+				names[name] = true
+			}
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+
+		names[name] = true
+	}
+
+	return names
+}
+
 func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
 	s := qs.Get(key)
 
@@ -295,6 +445,38 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+func (app *application) readFloat(qs url.Values, key string, defaultValue float64, v *validator.Validator) float64 {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		v.AddError(key, "must be a number")
+		return defaultValue
+	}
+
+	return f
+}
+
+// readBool returns nil when the key is absent so callers can tell "not given"
+// apart from false.
+func (app *application) readBool(qs url.Values, key string, v *validator.Validator) *bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return nil
+	}
+
+	return &b
+}
+
 func (app *application) background(fn func()) {
 	app.wg.Add(1)
 	go func() {
@@ -313,3 +495,47 @@ func (app *application) readStringParam(r *http.Request, paramName string) strin
 	params := httprouter.ParamsFromContext(r.Context())
 	return params.ByName(paramName)
 }
+
+// truncate shortens s to at most max bytes without splitting a UTF-8 character.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+// withPageLinks adds links to the first, previous, next and last pages to the
+// metadata. They keep the request's other query parameters, so filters and
+// sorting carry over. Empty results get no links.
+func (app *application) withPageLinks(r *http.Request, metadata data.Metadata) data.Metadata {
+	if metadata.TotalRecords == 0 {
+		return metadata
+	}
+
+	links := &data.PageLinks{
+		Self:  pageURL(r.URL, metadata.CurrentPage),
+		First: pageURL(r.URL, metadata.FirstPage),
+		Last:  pageURL(r.URL, metadata.LastPage),
+	}
+
+	if metadata.CurrentPage > metadata.FirstPage {
+		links.Prev = pageURL(r.URL, min(metadata.CurrentPage-1, metadata.LastPage))
+	}
+	if metadata.CurrentPage < metadata.LastPage {
+		links.Next = pageURL(r.URL, metadata.CurrentPage+1)
+	}
+
+	metadata.Links = links
+	return metadata
+}
+
+// pageURL rebuilds u's path and query string with the page parameter set to page.
+func pageURL(u *url.URL, page int) string {
+	qs := u.Query()
+	qs.Set("page", strconv.Itoa(page))
+
+	return u.Path + "?" + qs.Encode()
+}
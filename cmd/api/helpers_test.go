@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+)
+
+func TestWriteJSONWithETag(t *testing.T) {
+	app := newTestApplication(t)
+
+	get := func(body envelope, ifNoneMatch string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodGet, "/v1/parking-lots", nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+
+		rr := httptest.NewRecorder()
+		err := app.writeJSONWithETag(rr, r, http.StatusOK, body, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rr
+	}
+
+	lots := envelope{"parking_lots": []map[string]any{{"id": 1, "version": 1}}}
+
+	first := get(lots, "")
+	if first.Code != http.StatusOK {
+		t.Fatalf("first request: got status %d; want %d", first.Code, http.StatusOK)
+	}
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("first request: no ETag header")
+	}
+	if first.Body.Len() == 0 {
+		t.Fatal("first request: empty body")
+	}
+
+	second := get(lots, etag)
+	if second.Code != http.StatusNotModified {
+		t.Fatalf("repeat request: got status %d; want %d", second.Code, http.StatusNotModified)
+	}
+	if second.Body.Len() != 0 {
+		t.Errorf("repeat request: got body %q; want none", second.Body.String())
+	}
+	if got := second.Header().Get("ETag"); got != etag {
+		t.Errorf("repeat request: got ETag %s; want %s", got, etag)
+	}
+
+	// Any change to a listed record must bust the cache
+	updated := envelope{"parking_lots": []map[string]any{{"id": 1, "version": 2}}}
+
+	third := get(updated, etag)
+	if third.Code != http.StatusOK {
+		t.Fatalf("request after update: got status %d; want %d", third.Code, http.StatusOK)
+	}
+	if got := third.Header().Get("ETag"); got == etag {
+		t.Errorf("request after update: ETag %s did not change", got)
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		etag        string
+		want        bool
+	}{
+		{"empty header", "", `"abc"`, false},
+		{"exact", `"abc"`, `"abc"`, true},
+		{"different", `"abd"`, `"abc"`, false},
+		{"weak", `W/"abc"`, `"abc"`, true},
+		{"list", `"x", "abc"`, `"abc"`, true},
+		{"wildcard", "*", `"abc"`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.ifNoneMatch, tt.etag); got != tt.want {
+				t.Errorf("etagMatches(%q, %q) = %t; want %t", tt.ifNoneMatch, tt.etag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectFields(t *testing.T) {
+	app := newTestApplication(t)
+
+	type Lot struct {
+		ID         int     `json:"id"`
+		Name       string  `json:"name"`
+		HourlyRate float64 `json:"hourly_rate"`
+		Secret     string  `json:"-"`
+	}
+
+	type LotWithDistance struct {
+		Lot
+		Distance float64 `json:"distance_km"`
+	}
+
+	tests := []struct {
+		name   string
+		value  any
+		fields []string
+		want   []string
+	}{
+		{"requested fields only", []*Lot{{ID: 1, Name: "A", HourlyRate: 2}}, []string{"id", "name"}, []string{"id", "name"}},
+		{"unknown fields ignored", []*Lot{{ID: 1, Name: "A"}}, []string{"id", "nope"}, []string{"id"}},
+		{"hidden fields stay hidden", []*Lot{{ID: 1, Secret: "s"}}, []string{"id", "Secret", "-"}, []string{"id"}},
+		{"nothing usable keeps everything", []*Lot{{ID: 1}}, []string{"nope"}, []string{"id", "name", "hourly_rate"}},
+		{"no fields keeps everything", []*Lot{{ID: 1}}, nil, []string{"id", "name", "hourly_rate"}},
+		{"embedded fields", []*LotWithDistance{{Lot: Lot{ID: 1}, Distance: 3}}, []string{"id", "distance_km"}, []string{"id", "distance_km"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := envelope{"parking_lots": tt.value, "metadata": "untouched"}
+
+			err := app.selectFields(env, "parking_lots", tt.fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			js, err := json.Marshal(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got struct {
+				ParkingLots []map[string]any `json:"parking_lots"`
+				Metadata    string           `json:"metadata"`
+			}
+			err = json.Unmarshal(js, &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Metadata != "untouched" {
+				t.Errorf("metadata changed to %q", got.Metadata)
+			}
+			if len(got.ParkingLots) != 1 {
+				t.Fatalf("got %d items; want 1", len(got.ParkingLots))
+			}
+
+			item := got.ParkingLots[0]
+			if len(item) != len(tt.want) {
+				t.Errorf("got fields %v; want %v", keys(item), tt.want)
+			}
+			for _, field := range tt.want {
+				if _, ok := item[field]; !ok {
+					t.Errorf("field %q missing from %v", field, keys(item))
+				}
+			}
+		})
+	}
+}
+
+func keys(m map[string]any) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestWithPageLinks(t *testing.T) {
+	app := newTestApplication(t)
+
+	metadata := func(page int) data.Metadata {
+		return data.Metadata{CurrentPage: page, PageSize: 10, FirstPage: 1, LastPage: 3, TotalRecords: 25}
+	}
+	link := func(page string) string {
+		return "/v1/parking-lots?page=" + page + "&page_size=10&sort=-name"
+	}
+
+	tests := []struct {
+		name string
+		page int
+		want data.PageLinks
+	}{
+		{name: "first page", page: 1, want: data.PageLinks{Self: link("1"), First: link("1"), Next: link("2"), Last: link("3")}},
+		{name: "middle page", page: 2, want: data.PageLinks{Self: link("2"), First: link("1"), Prev: link("1"), Next: link("3"), Last: link("3")}},
+		{name: "last page", page: 3, want: data.PageLinks{Self: link("3"), First: link("1"), Prev: link("2"), Last: link("3")}},
+		{name: "past the last page", page: 5, want: data.PageLinks{Self: link("5"), First: link("1"), Prev: link("3"), Last: link("3")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/parking-lots?sort=-name&page_size=10&page="+strconv.Itoa(tt.page), nil)
+
+			got := app.withPageLinks(r, metadata(tt.page))
+			if got.Links == nil {
+				t.Fatal("no links")
+			}
+			if *got.Links != tt.want {
+				t.Errorf("got %+v; want %+v", *got.Links, tt.want)
+			}
+		})
+	}
+
+	t.Run("no results", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/v1/parking-lots", nil)
+		if got := app.withPageLinks(r, data.Metadata{}); got.Links != nil {
+			t.Errorf("got links %+v for an empty list; want none", *got.Links)
+		}
+	})
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/mailer"
+)
+
+// startJobs launches the periodic background jobs. Each job runs once at
+// startup and then on its own ticker for the lifetime of the process.
+func (app *application) startJobs() {
+	app.runPeriodically("materialize recurring reservations", time.Hour, func() error {
+		return app.materializeRecurringReservations(time.Now().AddDate(0, 0, 1))
+	})
+
+	app.runPeriodically("send reservation reminders", time.Minute, func() error {
+		return app.sendReservationReminders(time.Now())
+	})
+
+	app.runPeriodically("notify spot maintenance", 5*time.Minute, func() error {
+		return app.notifySpotMaintenance(time.Now())
+	})
+
+	app.runPeriodically("deliver queued emails", 30*time.Second, app.deliverQueuedEmails)
+
+	app.runPeriodically("deliver webhooks", 30*time.Second, app.deliverDueWebhooks)
+
+	app.runPeriodically("release expired spot holds", time.Minute, func() error {
+		_, err := app.models.ParkingSpots.ReleaseExpiredHolds(time.Now())
+		return err
+	})
+
+	app.runPeriodically("delete expired tokens", time.Hour, func() error {
+		_, err := app.models.Tokens.DeleteExpired()
+		return err
+	})
+}
+
+func (app *application) runPeriodically(name string, interval time.Duration, job func() error) {
+	go func() {
+		for {
+			func() {
+				defer func() {
+					if err := recover(); err != nil {
+						app.logger.PrintError(fmt.Errorf("%s", err), map[string]string{"job": name})
+					}
+				}()
+
+				err := job()
+				if err != nil {
+					app.logger.PrintError(err, map[string]string{"job": name})
+				}
+			}()
+
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// materializeRecurringReservations turns every recurring rule due on the given
+// date into a concrete reservation. When no spot is free for the slot the day is
+// skipped and the user is notified instead. A rule that fails is logged and left
+// unmaterialized so the next run retries it, without holding up the others.
+func (app *application) materializeRecurringReservations(date time.Time) error {
+	rules, err := app.models.RecurringReservations.GetDueForDate(date)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		err := app.materializeRecurringReservation(rule, date)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{
+				"recurring_reservation_id": rule.ID.String(),
+				"date":                     date.Format("2006-01-02"),
+			})
+		}
+	}
+
+	return nil
+}
+
+// materializeRecurringReservation books a single rule's occurrence on date.
+func (app *application) materializeRecurringReservation(rule *data.RecurringReservation, date time.Time) error {
+	lot, err := app.models.ParkingLots.Get(rule.ParkingLotID)
+	if err != nil {
+		return err
+	}
+
+	start, end, err := rule.Occurrence(date, lot.Location())
+	if err != nil {
+		return err
+	}
+
+	vehicle, err := app.models.Vehicles.Get(rule.VehicleID)
+	if err != nil {
+		return err
+	}
+
+	user, err := app.models.Users.Get(rule.UserID)
+	if err != nil {
+		return err
+	}
+
+	// Occurrences are covered by the rule's monthly amount, so they carry no
+	// charge of their own. A rule without one, e.g. on a lot that has stopped
+	// offering monthly parking, pays for each occurrence at the lot's rates.
+	reservation := &data.Reservation{
+		UserID:       rule.UserID,
+		VehicleID:    rule.VehicleID,
+		ParkingLotID: rule.ParkingLotID,
+		StartTime:    start,
+		EndTime:      end,
+		Status:       data.ReservationStatusConfirmed,
+	}
+	if rule.MonthlyAmount <= 0 {
+		reservation.TotalAmount = lot.PriceFor(start, end)
+	}
+
+	err = app.models.Reservations.InsertWithFreeSpot(reservation, user.EligibleSpotTypes(vehicle.SpotTypePreference()), false)
+	if err == nil {
+		app.publishLotEvent(reservation.ParkingLotID, data.WebhookEventReservationCreated, reservation)
+
+		// The monthly amount is billed with the first occurrence booked in each
+		// month. Billing is idempotent, so a charge that fails here is retried
+		// with the month's next occurrence rather than booking this one twice.
+		_, chargeErr := app.models.RecurringReservations.ChargeMonth(rule, start)
+		if chargeErr != nil {
+			app.logger.PrintError(chargeErr, map[string]string{"recurring_reservation_id": rule.ID.String()})
+		}
+	}
+
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound), errors.Is(err, data.ErrNoSpotAvailable):
+		notification := &data.Notification{
+			UserID:  rule.UserID,
+			Type:    data.NotificationTypeReservationSkipped,
+			Title:   "Recurring reservation skipped",
+			Message: fmt.Sprintf("No spot was available for your recurring reservation on %s, so that day was skipped.", date.Format("Mon 2 Jan")),
+		}
+
+		dedupKey := data.NotificationDedupKey(notification.Type, rule.ID, rule.UserID) + ":" + date.Format("2006-01-02")
+
+		_, err = app.models.Notifications.InsertIfNotExists(notification, dedupKey)
+		if err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	}
+
+	err = app.models.RecurringReservations.MarkMaterialized(rule.ID, date)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// sendReservationReminders notifies users whose reservations start within their
+// chosen reminder lead time of now. Each reservation is reminded at most once.
+func (app *application) sendReservationReminders(now time.Time) error {
+	reservations, err := app.models.Reservations.GetUpcomingForReminders(now)
+	if err != nil {
+		return err
+	}
+
+	for _, reservation := range reservations {
+		minutes := int(reservation.StartTime.Sub(now).Round(time.Minute).Minutes())
+
+		notification := &data.Notification{
+			UserID:  reservation.UserID,
+			Type:    data.NotificationTypeReservationReminder,
+			Title:   "Upcoming reservation",
+			Message: fmt.Sprintf("Your reservation starts in %d minutes, at %s.", minutes, reservation.StartTime.Format("15:04")),
+		}
+
+		created, err := app.models.Notifications.InsertIfNotExists(notification, data.NotificationDedupKey(notification.Type, reservation.ID, reservation.UserID))
+		if err != nil {
+			return err
+		}
+
+		// A failed text shouldn't hold back the other reminders
+		if created {
+			err = app.sendSMS(reservation.UserID, notification.Message)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		}
+
+		err = app.models.Reservations.MarkReminderSent(reservation.ID, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// notifySpotMaintenance tells holders of upcoming reservations that their spot
+// has been put under maintenance. Each reservation is notified at most once.
+func (app *application) notifySpotMaintenance(now time.Time) error {
+	reservations, err := app.models.Reservations.GetAffectedByMaintenance()
+	if err != nil {
+		return err
+	}
+
+	return app.notifyMaintenanceAffected(app.models, reservations, now)
+}
+
+// notifyMaintenanceAffected tells the holders of reservations that their spot
+// is under maintenance and records that they were told. Holders already told
+// about a reservation aren't notified again.
+func (app *application) notifyMaintenanceAffected(models data.Models, reservations []*data.MaintenanceAffectedReservation, now time.Time) error {
+	for _, reservation := range reservations {
+		message := fmt.Sprintf("Spot %s for your reservation on %s is under maintenance.", reservation.SpotNumber, reservation.StartTime.Format("Mon 2 Jan 15:04"))
+		if reservation.MaintenanceReason != nil && *reservation.MaintenanceReason != "" {
+			message += " Reason: " + *reservation.MaintenanceReason
+		}
+
+		notification := &data.Notification{
+			UserID:  reservation.UserID,
+			Type:    data.NotificationTypeSpotMaintenance,
+			Title:   "Parking spot under maintenance",
+			Message: message,
+		}
+
+		_, err := models.Notifications.InsertIfNotExists(notification, data.NotificationDedupKey(notification.Type, reservation.ID, reservation.UserID))
+		if err != nil {
+			return err
+		}
+
+		err = models.Reservations.MarkMaintenanceNotified(reservation.ID, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deliverQueuedEmails sends the emails in the outbox that are due. Failed sends
+// are retried with backoff until they run out of attempts, at which point they
+// are dead-lettered for an admin to look at.
+func (app *application) deliverQueuedEmails() error {
+	// The lease has to outlast a send, including the mailer's own retries
+	emails, err := app.models.EmailOutbox.ClaimDue(20, 5*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	for _, email := range emails {
+		sendErr := app.mailer.Send(email.Recipient, email.Template, email.Data)
+		if sendErr == nil {
+			err = app.models.EmailOutbox.MarkSent(email)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		email.Fail(sendErr, errors.Is(sendErr, mailer.ErrUnknownTemplate), app.config.smtp.maxAttempts, time.Now())
+
+		err = app.models.EmailOutbox.SaveAttempt(email)
+		if err != nil {
+			return err
+		}
+
+		properties := map[string]string{
+			"email_id": email.ID.String(),
+			"template": email.Template,
+			"attempts": fmt.Sprint(email.Attempts),
+		}
+		if email.Status == data.EmailStatusDead {
+			properties["status"] = email.Status
+		}
+		app.logger.PrintError(sendErr, properties)
+	}
+
+	return nil
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/sms"
+)
+
+// nextMonday returns midnight UTC on the first Monday after t.
+func nextMonday(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+	for day.Weekday() != time.Monday {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day
+}
+
+func TestMaterializeRecurringReservationsOverAWeek(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	owner := insertTestUser(t, app)
+	user := insertTestUser(t, app)
+	other := insertTestUser(t, app)
+
+	lot, spots := insertTestLot(t, app, owner.ID, 1)
+	vehicle := insertTestVehicle(t, app, user.ID)
+	otherVehicle := insertTestVehicle(t, app, other.ID)
+
+	monday := nextMonday(time.Now())
+	wednesday := monday.AddDate(0, 0, 2)
+
+	// The lot's only spot is taken on Wednesday, so that day has to be skipped.
+	blocking := &data.Reservation{
+		UserID:        other.ID,
+		VehicleID:     otherVehicle.ID,
+		ParkingLotID:  lot.ID,
+		ParkingSpotID: &spots[0].ID,
+		StartTime:     wednesday.Add(7 * time.Hour),
+		EndTime:       wednesday.Add(19 * time.Hour),
+		Status:        data.ReservationStatusConfirmed,
+	}
+	if err := app.models.Reservations.Insert(blocking); err != nil {
+		t.Fatal(err)
+	}
+
+	rule := &data.RecurringReservation{
+		UserID:       user.ID,
+		VehicleID:    vehicle.ID,
+		ParkingLotID: lot.ID,
+		DaysOfWeek:   []int64{1, 2, 3, 4, 5},
+		StartTime:    "08:00",
+		EndTime:      "18:00",
+		StartsOn:     monday,
+		IsActive:     true,
+	}
+	if err := app.models.RecurringReservations.Insert(rule); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 7; i++ {
+		if err := app.materializeRecurringReservations(monday.AddDate(0, 0, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows, err := app.models.Reservations.DB.Query(`SELECT start_time, end_time FROM reservations WHERE user_id = $1 ORDER BY start_time`, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var got []time.Time
+	for rows.Next() {
+		var start, end time.Time
+		if err := rows.Scan(&start, &end); err != nil {
+			t.Fatal(err)
+		}
+		if end.Sub(start) != 10*time.Hour {
+			t.Errorf("reservation from %s to %s; want 08:00 to 18:00", start, end)
+		}
+		got = append(got, start.UTC())
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []time.Time{
+		monday.Add(8 * time.Hour),
+		monday.AddDate(0, 0, 1).Add(8 * time.Hour),
+		monday.AddDate(0, 0, 3).Add(8 * time.Hour),
+		monday.AddDate(0, 0, 4).Add(8 * time.Hour),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d reservations %v; want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("reservation %d starts %s; want %s", i, got[i], want[i])
+		}
+	}
+
+	var skipped int
+	err = app.models.Notifications.DB.QueryRow(`SELECT count(*) FROM notifications WHERE user_id = $1 AND type = $2`, user.ID, data.NotificationTypeReservationSkipped).Scan(&skipped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 1 {
+		t.Errorf("got %d skipped notifications; want 1", skipped)
+	}
+
+	// Running the job again for a day already processed books nothing more.
+	if err := app.materializeRecurringReservations(monday); err != nil {
+		t.Fatal(err)
+	}
+	var total int
+	err = app.models.Reservations.DB.QueryRow(`SELECT count(*) FROM reservations WHERE user_id = $1`, user.ID).Scan(&total)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != len(want) {
+		t.Errorf("got %d reservations after a rerun; want %d", total, len(want))
+	}
+}
+
+func TestMaterializeRecurringReservationsBillsTheRule(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	colombo, err := time.LoadLocation("Asia/Colombo")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	owner := insertTestUser(t, app)
+	user := insertTestUser(t, app)
+
+	lot, _ := insertTestLot(t, app, owner.ID, 2)
+	_, err = app.models.ParkingLots.DB.Exec(`UPDATE parking_lots SET timezone = 'Asia/Colombo' WHERE id = $1`, lot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lot.Timezone = "Asia/Colombo"
+
+	// Two Mondays in the same month, well inside it
+	monday := nextMonday(time.Now())
+	for monday.Day() > 14 {
+		monday = monday.AddDate(0, 0, 7)
+	}
+
+	newRule := func(monthly data.Money) *data.RecurringReservation {
+		rule := &data.RecurringReservation{
+			UserID:        user.ID,
+			VehicleID:     insertTestVehicle(t, app, user.ID).ID,
+			ParkingLotID:  lot.ID,
+			DaysOfWeek:    []int64{1},
+			StartTime:     "08:00",
+			EndTime:       "10:00",
+			StartsOn:      monday,
+			MonthlyAmount: monthly,
+			IsActive:      true,
+		}
+		if err := app.models.RecurringReservations.Insert(rule); err != nil {
+			t.Fatal(err)
+		}
+		return rule
+	}
+
+	monthly := newRule(data.MoneyFromFloat(5000))
+	perOccurrence := newRule(0)
+
+	for _, date := range []time.Time{monday, monday.AddDate(0, 0, 7)} {
+		if err := app.materializeRecurringReservations(date); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows, err := app.models.Reservations.DB.Query(`SELECT vehicle_id, start_time, total_amount FROM reservations WHERE user_id = $1 ORDER BY start_time`, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var count int
+	for rows.Next() {
+		var vehicleID string
+		var start time.Time
+		var total data.Money
+		if err := rows.Scan(&vehicleID, &start, &total); err != nil {
+			t.Fatal(err)
+		}
+		count++
+
+		// The rule's clock times are the lot's
+		if got := start.In(colombo); got.Hour() != 8 || got.Minute() != 0 {
+			t.Errorf("occurrence starts at %s in Colombo; want 08:00", got.Format("15:04"))
+		}
+
+		want := data.Money(0)
+		if vehicleID == perOccurrence.VehicleID.String() {
+			want = data.MoneyFromFloat(200)
+		}
+		if total != want {
+			t.Errorf("occurrence for vehicle %s costs %s; want %s", vehicleID, total, want)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Fatalf("got %d reservations; want 4", count)
+	}
+
+	var charged int
+	var amount data.Money
+	err = app.models.Payments.DB.QueryRow(`SELECT count(*), COALESCE(SUM(amount), 0) FROM payments WHERE recurring_reservation_id = $1 AND status = $2`, monthly.ID, data.PaymentStatusPending).Scan(&charged, &amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if charged != 1 || amount != monthly.MonthlyAmount {
+		t.Errorf("got %d monthly charges totalling %s; want one of %s", charged, amount, monthly.MonthlyAmount)
+	}
+
+	err = app.models.Payments.DB.QueryRow(`SELECT count(*) FROM payments WHERE recurring_reservation_id = $1`, perOccurrence.ID).Scan(&charged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if charged != 0 {
+		t.Errorf("got %d monthly charges for a rule without a monthly amount; want 0", charged)
+	}
+}
+
+func TestSendReservationRemindersOnce(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	user := insertTestUser(t, app)
+	lot, spots := insertTestLot(t, app, user.ID, 1)
+	vehicle := insertTestVehicle(t, app, user.ID)
+
+	now := time.Now()
+	reservation := &data.Reservation{
+		UserID:        user.ID,
+		VehicleID:     vehicle.ID,
+		ParkingLotID:  lot.ID,
+		ParkingSpotID: &spots[0].ID,
+		StartTime:     now.Add(10 * time.Minute),
+		EndTime:       now.Add(70 * time.Minute),
+		Status:        data.ReservationStatusConfirmed,
+	}
+	if err := app.models.Reservations.Insert(reservation); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.sendReservationReminders(now); err != nil {
+		t.Fatal(err)
+	}
+
+	// A retry that runs before the reminder was marked as sent mustn't
+	// notify the user again.
+	_, err := app.models.Reservations.DB.Exec(`UPDATE reservations SET reminder_sent_at = NULL WHERE id = $1`, reservation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.sendReservationReminders(now); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	err = app.models.Notifications.DB.QueryRow(`SELECT count(*) FROM notifications WHERE user_id = $1 AND type = $2`, user.ID, data.NotificationTypeReservationReminder).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("got %d reminders; want 1", count)
+	}
+}
+
+func TestReservationReminderSendsOneSMS(t *testing.T) {
+	app := newTestDBApplication(t)
+	sender := &sms.Mock{}
+	app.sms = sender
+
+	now := time.Now()
+	number := fmt.Sprintf("+9477%07d", now.UnixNano()%10000000)
+
+	book := func(user *data.User) {
+		t.Helper()
+
+		lot, spots := insertTestLot(t, app, user.ID, 1)
+		reservation := &data.Reservation{
+			UserID:        user.ID,
+			VehicleID:     insertTestVehicle(t, app, user.ID).ID,
+			ParkingLotID:  lot.ID,
+			ParkingSpotID: &spots[0].ID,
+			StartTime:     now.Add(10 * time.Minute),
+			EndTime:       now.Add(70 * time.Minute),
+			Status:        data.ReservationStatusConfirmed,
+		}
+		if err := app.models.Reservations.Insert(reservation); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Both users have the number, but only one has verified it
+	verified := insertTestUser(t, app)
+	unverified := insertTestUser(t, app)
+	_, err := app.models.Users.DB.Exec(`UPDATE users SET mobile_number = $1, sms_notifications = true, mobile_verified = (id = $2) WHERE id IN ($2, $3)`, number, verified.ID, unverified.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	book(verified)
+	book(unverified)
+
+	for range 2 {
+		if err := app.sendReservationReminders(now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var texts []sms.Message
+	for _, message := range sender.Messages() {
+		if message.To == number {
+			texts = append(texts, message)
+		}
+	}
+	if len(texts) != 1 {
+		t.Fatalf("got %d texts; want 1", len(texts))
+	}
+	if want := "Your reservation starts in 10 minutes"; !strings.HasPrefix(texts[0].Body, want) {
+		t.Errorf("text = %q", texts[0].Body)
+	}
+}
+
+func TestNewSMSSender(t *testing.T) {
+	var cfg config
+
+	sender, err := newSMSSender(cfg)
+	if err != nil || sender != nil {
+		t.Errorf("no provider: got %v, %v; want no sender", sender, err)
+	}
+
+	cfg.sms.provider = "mock"
+	if sender, err := newSMSSender(cfg); err != nil {
+		t.Error(err)
+	} else if _, ok := sender.(*sms.Mock); !ok {
+		t.Errorf("mock provider: got %T", sender)
+	}
+
+	cfg.sms.provider = "twilio"
+	if _, err := newSMSSender(cfg); err == nil {
+		t.Error("twilio without credentials: got no error")
+	}
+
+	cfg.sms.accountSID, cfg.sms.authToken, cfg.sms.from = "AC123", "secret", "+15005550006"
+	if _, err := newSMSSender(cfg); err != nil {
+		t.Errorf("twilio: %v", err)
+	}
+
+	cfg.sms.provider = "carrier-pigeon"
+	if _, err := newSMSSender(cfg); err == nil {
+		t.Error("unknown provider: got no error")
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// lotImagesDir is where uploaded parking lot images are stored, named by
+// their image key and extension.
+const lotImagesDir = "../../uploads/lot-images"
+
+// maxLotImageSize is the largest image that can be uploaded for a lot.
+const maxLotImageSize = 5 * 1024 * 1024
+
+// lotImageExtension returns the file extension for a JPEG, PNG or GIF image, or
+// an empty string for anything else.
+func lotImageExtension(imgData []byte) string {
+	switch {
+	case bytes.HasPrefix(imgData, []byte{0xFF, 0xD8, 0xFF}):
+		return ".jpg"
+	case bytes.HasPrefix(imgData, []byte{0x89, 0x50, 0x4E, 0x47}):
+		return ".png"
+	case bytes.HasPrefix(imgData, []byte{0x47, 0x49, 0x46, 0x38}):
+		return ".gif"
+	default:
+		return ""
+	}
+}
+
+// readImageIDParam reads the image_id URL parameter.
+func (app *application) readImageIDParam(r *http.Request) (uuid.UUID, error) {
+	id, err := uuid.Parse(app.readStringParam(r, "image_id"))
+	if err != nil {
+		return uuid.Nil, errors.New("invalid image id parameter")
+	}
+	return id, nil
+}
+
+// getOwnedLotImage loads the image named in the URL and checks that the
+// authenticated user owns its lot. It writes the error response and returns
+// nil when it can't.
+func (app *application) getOwnedLotImage(w http.ResponseWriter, r *http.Request) *data.ParkingLotImage {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	imageID, err := app.readImageIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	if app.getOwnedParkingLot(w, r, lotID) == nil {
+		return nil
+	}
+
+	image, err := app.modelsFor(r).ParkingLotImages.Get(imageID, lotID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	return image
+}
+
+// List a parking lot's images in display order.
+func (app *application) listLotImagesHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.modelsFor(r).ParkingLots.Get(lotID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	images, err := app.modelsFor(r).ParkingLotImages.List(lotID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"images": images}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Upload an image of a parking lot, base64 encoded like avatars. It is added
+// after the lot's existing images; the first image, or one uploaded with
+// is_primary, becomes the primary image. Only the lot owner may do this.
+func (app *application) uploadLotImageHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Image     string `json:"image"`
+		IsPrimary bool   `json:"is_primary"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	lot := app.getOwnedParkingLot(w, r, lotID)
+	if lot == nil {
+		return
+	}
+
+	v := validator.New()
+
+	imgData, err := base64.StdEncoding.DecodeString(input.Image)
+	v.Check(input.Image != "", "image", "must be provided")
+	v.Check(err == nil, "image", "must be base64 encoded")
+	v.Check(len(imgData) <= maxLotImageSize, "image", "must be less than 5MB")
+	v.Check(len(imgData) == 0 || lotImageExtension(imgData) != "", "image", "must be a JPEG, PNG or GIF image")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	image := &data.ParkingLotImage{
+		ParkingLotID: lot.ID,
+		ImageKey:     uuid.New().String(),
+		IsPrimary:    input.IsPrimary,
+	}
+
+	err = os.MkdirAll(lotImagesDir, 0755)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	imagePath := filepath.Join(lotImagesDir, image.ImageKey+lotImageExtension(imgData))
+
+	err = os.WriteFile(imagePath, imgData, 0644)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.modelsFor(r).ParkingLotImages.Add(image)
+	if err != nil {
+		os.Remove(imagePath)
+
+		switch {
+		case errors.Is(err, data.ErrTooManyLotImages):
+			v.AddError("image", fmt.Sprintf("a parking lot can't have more than %d images", data.MaxLotImages))
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"image": image}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Reorder a parking lot's images. image_ids must list every image of the lot
+// once, in the new display order. Only the lot owner may do this.
+func (app *application) reorderLotImagesHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		ImageIDs []uuid.UUID `json:"image_ids"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if app.getOwnedParkingLot(w, r, lotID) == nil {
+		return
+	}
+
+	err = app.modelsFor(r).ParkingLotImages.Reorder(lotID, input.ImageIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidImageOrder):
+			v := validator.New()
+			v.AddError("image_ids", "must list each of the parking lot's images once")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	images, err := app.modelsFor(r).ParkingLotImages.List(lotID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"images": images}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Make an image the parking lot's primary image. Only the lot owner may do
+// this.
+func (app *application) setPrimaryLotImageHandler(w http.ResponseWriter, r *http.Request) {
+	image := app.getOwnedLotImage(w, r)
+	if image == nil {
+		return
+	}
+
+	err := app.modelsFor(r).ParkingLotImages.SetPrimary(image)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"image": image}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Delete an image of a parking lot along with its file. Only the lot owner may
+// do this.
+func (app *application) deleteLotImageHandler(w http.ResponseWriter, r *http.Request) {
+	image := app.getOwnedLotImage(w, r)
+	if image == nil {
+		return
+	}
+
+	err := app.modelsFor(r).ParkingLotImages.Delete(image)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	for _, ext := range []string{".jpg", ".png", ".gif"} {
+		err = os.Remove(filepath.Join(lotImagesDir, image.ImageKey+ext))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			app.logError(r, err)
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "image successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
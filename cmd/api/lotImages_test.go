@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+)
+
+func TestLotImageExtension(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"jpeg", []byte{0xFF, 0xD8, 0xFF, 0xE0}, ".jpg"},
+		{"png", []byte{0x89, 'P', 'N', 'G', '\r', '\n'}, ".png"},
+		{"gif", []byte("GIF89a"), ".gif"},
+		{"text", []byte("hello"), ""},
+		{"empty", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lotImageExtension(tt.data); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLotImageHandlersNeedTheOwner(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	owner := insertTestUser(t, app)
+	other := insertTestUser(t, app)
+	lot, _ := insertTestLot(t, app, owner.ID, 0)
+
+	image := &data.ParkingLotImage{ParkingLotID: lot.ID, ImageKey: "test-image"}
+	if err := app.models.ParkingLotImages.Add(image); err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(user *data.User, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r := newAuthenticatedRequest(app, http.MethodPost, "/v1/parking-lots/"+lot.ID.String()+"/images", body, user)
+		app.uploadLotImageHandler(rr, withParams(r, "id", lot.ID.String()))
+		return rr
+	}
+
+	gif := base64.StdEncoding.EncodeToString([]byte("GIF89a"))
+	if rr := upload(other, `{"image":"`+gif+`"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("upload by another user: status = %d, want %d", rr.Code, http.StatusForbidden)
+	}
+
+	text := base64.StdEncoding.EncodeToString([]byte("not an image"))
+	rr := upload(owner, `{"image":"`+text+`"}`)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("upload of text: status = %d, want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+	if decodeError(t, rr).Fields["image"] == "" {
+		t.Error("image not flagged")
+	}
+
+	reorder := func(user *data.User, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r := newAuthenticatedRequest(app, http.MethodPut, "/v1/parking-lots/"+lot.ID.String()+"/images", body, user)
+		app.reorderLotImagesHandler(rr, withParams(r, "id", lot.ID.String()))
+		return rr
+	}
+
+	if rr := reorder(other, `{"image_ids":["`+image.ID.String()+`"]}`); rr.Code != http.StatusForbidden {
+		t.Errorf("reorder by another user: status = %d, want %d", rr.Code, http.StatusForbidden)
+	}
+	if rr := reorder(owner, `{"image_ids":[]}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reorder missing an image: status = %d, want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+	if rr := reorder(owner, `{"image_ids":["`+image.ID.String()+`"]}`); rr.Code != http.StatusOK {
+		t.Errorf("reorder by the owner: status = %d: %s", rr.Code, rr.Body)
+	}
+
+	rr = httptest.NewRecorder()
+	r := newAuthenticatedRequest(app, http.MethodDelete, "/v1/parking-lots/"+lot.ID.String()+"/images/"+image.ID.String(), "", other)
+	app.deleteLotImageHandler(rr, withParams(r, "id", lot.ID.String(), "image_id", image.ID.String()))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("delete by another user: status = %d, want %d", rr.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// List a parking lot's operators. Only the lot owner may do this.
+func (app *application) listLotOperatorsHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	lot := app.getOwnedParkingLot(w, r, lotID)
+	if lot == nil {
+		return
+	}
+
+	operators, err := app.modelsFor(r).LotOperators.GetAllForLot(lot.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"operators": operators}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Make the user with the given email an operator of a parking lot, so they can
+// check drivers in and out and handle its sessions and violations. Only the lot
+// owner may do this.
+func (app *application) addLotOperatorHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	lot := app.getOwnedParkingLot(w, r, lotID)
+	if lot == nil {
+		return
+	}
+
+	user, err := app.modelsFor(r).Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "no user found with this email address")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v.Check(user.ID != lot.OwnerID, "email", "is the owner of this parking lot")
+	v.Check(user.Activated, "email", "belongs to an account that hasn't been activated")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	operator := &data.LotOperator{
+		ParkingLotID: lot.ID,
+		UserID:       user.ID,
+		UserName:     user.UserName,
+		Email:        user.Email,
+	}
+
+	err = app.modelsFor(r).LotOperators.Add(operator)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrAlreadyOperator):
+			v.AddError("email", "is already an operator of this parking lot")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"operator": operator}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Remove an operator from a parking lot. Only the lot owner may do this.
+func (app *application) removeLotOperatorHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	userID, err := uuid.Parse(app.readStringParam(r, "user_id"))
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	lot := app.getOwnedParkingLot(w, r, lotID)
+	if lot == nil {
+		return
+	}
+
+	err = app.modelsFor(r).LotOperators.Remove(lot.ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "operator successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+)
+
+func TestLotOperatorCanRunButNotDeleteLot(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	owner := insertTestUser(t, app)
+	operator := insertTestUser(t, app)
+	driver := insertTestUser(t, app)
+	lot, spots := insertTestLot(t, app, owner.ID, 1)
+	vehicle := insertTestVehicle(t, app, driver.ID)
+
+	lotPath := "/v1/parking-lots/" + lot.ID.String()
+
+	addOperator := func(by *data.User, email string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r := newAuthenticatedRequest(app, http.MethodPost, lotPath+"/operators", `{"email":"`+email+`"}`, by)
+		app.addLotOperatorHandler(rr, withParams(r, "id", lot.ID.String()))
+		return rr
+	}
+
+	if rr := addOperator(owner, operator.Email); rr.Code != http.StatusCreated {
+		t.Fatalf("add operator: status = %d: %s", rr.Code, rr.Body)
+	}
+	for name, rr := range map[string]*httptest.ResponseRecorder{
+		"twice":    addOperator(owner, operator.Email),
+		"owner":    addOperator(owner, owner.Email),
+		"stranger": addOperator(owner, "nobody-"+lot.ID.String()+"@example.com"),
+	} {
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("adding %s: status = %d, want %d", name, rr.Code, http.StatusUnprocessableEntity)
+		}
+	}
+	// Operators can't appoint more operators
+	if rr := addOperator(operator, driver.Email); rr.Code != http.StatusForbidden {
+		t.Errorf("add by operator: status = %d, want %d", rr.Code, http.StatusForbidden)
+	}
+
+	now := time.Now()
+	reservation := &data.Reservation{
+		UserID:        driver.ID,
+		VehicleID:     vehicle.ID,
+		ParkingLotID:  lot.ID,
+		ParkingSpotID: &spots[0].ID,
+		StartTime:     now,
+		EndTime:       now.Add(time.Hour),
+		Status:        data.ReservationStatusConfirmed,
+	}
+	if err := app.models.Reservations.Insert(reservation); err != nil {
+		t.Fatal(err)
+	}
+
+	reservationPath := "/v1/reservations/" + reservation.ID.String()
+	handle := func(handler http.HandlerFunc, method, target string, id string, user *data.User) int {
+		rr := httptest.NewRecorder()
+		handler(rr, withParams(newAuthenticatedRequest(app, method, target, "", user), "id", id))
+		app.wg.Wait()
+		return rr.Code
+	}
+
+	// A user with no part in the lot can't check the driver in
+	if code := handle(app.checkInReservationHandler, http.MethodPost, reservationPath+"/check-in", reservation.ID.String(), insertTestUser(t, app)); code != http.StatusForbidden {
+		t.Errorf("check in by stranger: status = %d, want %d", code, http.StatusForbidden)
+	}
+
+	if code := handle(app.checkInReservationHandler, http.MethodPost, reservationPath+"/check-in", reservation.ID.String(), operator); code != http.StatusCreated {
+		t.Fatalf("check in by operator: status = %d", code)
+	}
+	if code := handle(app.checkOutReservationHandler, http.MethodPost, reservationPath+"/check-out", reservation.ID.String(), operator); code != http.StatusOK {
+		t.Fatalf("check out by operator: status = %d", code)
+	}
+
+	stored, err := app.models.Reservations.Get(reservation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != data.ReservationStatusCompleted {
+		t.Errorf("reservation status = %s, want %s", stored.Status, data.ReservationStatusCompleted)
+	}
+
+	if code := handle(app.listLotSessionsHandler, http.MethodGet, lotPath+"/sessions", lot.ID.String(), operator); code != http.StatusOK {
+		t.Errorf("list sessions by operator: status = %d", code)
+	}
+
+	// Running the lot doesn't extend to owning it
+	if code := handle(app.deleteParkingLotHandler, http.MethodDelete, lotPath, lot.ID.String(), operator); code != http.StatusForbidden {
+		t.Errorf("delete by operator: status = %d, want %d", code, http.StatusForbidden)
+	}
+	if _, err := app.models.ParkingLots.Get(lot.ID); err != nil {
+		t.Errorf("lot after delete by operator: %v", err)
+	}
+	if code := handle(app.listLotOperatorsHandler, http.MethodGet, lotPath+"/operators", lot.ID.String(), operator); code != http.StatusForbidden {
+		t.Errorf("list operators by operator: status = %d, want %d", code, http.StatusForbidden)
+	}
+
+	// Once removed, the operator loses access
+	rr := httptest.NewRecorder()
+	r := newAuthenticatedRequest(app, http.MethodDelete, lotPath+"/operators/"+operator.ID.String(), "", owner)
+	app.removeLotOperatorHandler(rr, withParams(r, "id", lot.ID.String(), "user_id", operator.ID.String()))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("remove operator: status = %d: %s", rr.Code, rr.Body)
+	}
+	if code := handle(app.listLotSessionsHandler, http.MethodGet, lotPath+"/sessions", lot.ID.String(), operator); code != http.StatusForbidden {
+		t.Errorf("list sessions after removal: status = %d, want %d", code, http.StatusForbidden)
+	}
+}
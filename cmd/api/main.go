@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -13,21 +15,30 @@ import (
 
 	_ "github.com/lib/pq"
 	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/geocode"
 	"github.com/mayura-andrew/SpotLinkIO-backend/internal/jsonlog"
 	"github.com/mayura-andrew/SpotLinkIO-backend/internal/mailer"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/qrcode"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/sms"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/webhook"
+	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/oauth2"
 )
 
 const version = "1.0.0"
 
 type config struct {
-	port int
-	env  string
-	db   struct {
+	port       int
+	env        string
+	bcryptCost int
+	db         struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime  string
+
+		queryTimeout     time.Duration
+		longQueryTimeout time.Duration
 	}
 	limiter struct {
 		rps     float64
@@ -35,11 +46,12 @@ type config struct {
 		enabled bool
 	}
 	smtp struct {
-		host     string
-		port     int
-		username string
-		password string
-		sender   string
+		host        string
+		port        int
+		username    string
+		password    string
+		sender      string
+		maxAttempts int
 	}
 	oauth struct {
 		googleClientID     string
@@ -48,11 +60,66 @@ type config struct {
 	}
 	frontendURL string
 	qr          struct {
-		storageDir string
+		storage      string
+		storageDir   string
+		s3           qrcode.S3Config
+		signingKey   []byte
+		expiryLeeway time.Duration
+		verifyURL    string
 	}
 	cors struct {
 		trustedOrigins []string
 	}
+	reviews struct {
+		reportThreshold int
+		autoHide        bool
+	}
+	search struct {
+		rankWeights data.RankWeights
+	}
+	geocode struct {
+		enabled   bool
+		provider  string
+		url       string
+		userAgent string
+	}
+	sms struct {
+		provider           string
+		twilioURL          string
+		accountSID         string
+		authToken          string
+		from               string
+		defaultCountryCode string
+	}
+	moneyRounding string
+	taxRate       float64
+	serviceFee    float64
+	energyRate    float64
+	violations    struct {
+		autoCharge bool
+	}
+	bookings struct {
+		maxReservationDays int
+		maxAdvanceDays     int
+	}
+	spotHolds struct {
+		duration time.Duration
+	}
+	quotes struct {
+		signingKey []byte
+		ttl        time.Duration
+	}
+	tokens struct {
+		activationTTL     time.Duration
+		passwordResetTTL  time.Duration
+		authenticationTTL time.Duration
+	}
+	webhooks struct {
+		maxAttempts int
+	}
+	payments struct {
+		webhookSecrets map[string]string
+	}
 }
 
 type application struct {
@@ -62,25 +129,182 @@ type application struct {
 	mailer            mailer.Mailer
 	wg                sync.WaitGroup
 	googleOauthConfig *oauth2.Config
+	qrStorage         qrcode.Storage
+	geocoder          geocode.Geocoder
+	sms               sms.Sender
+	webhooks          *webhook.Client
 }
 
 func main() {
+	cfg, err := parseConfig(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+	if logger == nil {
+		panic("Logger is not initialized")
+	}
+
+	moneyRounding, err := data.ParseRoundingMode(cfg.moneyRounding)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	data.MoneyRounding = moneyRounding
+
+	if cfg.taxRate < 0 || cfg.taxRate > 1 {
+		logger.PrintFatal(fmt.Errorf("tax-rate must be between 0 and 1, got %v", cfg.taxRate), nil)
+	}
+	if cfg.serviceFee < 0 {
+		logger.PrintFatal(fmt.Errorf("service-fee must not be negative, got %v", cfg.serviceFee), nil)
+	}
+	data.DefaultTaxRate = cfg.taxRate
+
+	if cfg.smtp.maxAttempts < 1 {
+		logger.PrintFatal(fmt.Errorf("smtp-max-attempts must be at least 1, got %d", cfg.smtp.maxAttempts), nil)
+	}
+	if cfg.webhooks.maxAttempts < 1 {
+		logger.PrintFatal(fmt.Errorf("webhook-max-attempts must be at least 1, got %d", cfg.webhooks.maxAttempts), nil)
+	}
+	if cfg.spotHolds.duration < time.Minute {
+		logger.PrintFatal(fmt.Errorf("spot-hold-duration must be at least 1m, got %s", cfg.spotHolds.duration), nil)
+	}
+	for name, ttl := range map[string]time.Duration{
+		"activation-token-ttl":     cfg.tokens.activationTTL,
+		"password-reset-token-ttl": cfg.tokens.passwordResetTTL,
+		"authentication-token-ttl": cfg.tokens.authenticationTTL,
+	} {
+		if ttl <= 0 {
+			logger.PrintFatal(fmt.Errorf("%s must be positive, got %s", name, ttl), nil)
+		}
+	}
+	if cfg.qr.verifyURL != "" && !strings.HasPrefix(cfg.qr.verifyURL, "http://") && !strings.HasPrefix(cfg.qr.verifyURL, "https://") {
+		logger.PrintFatal(fmt.Errorf("qr-verify-url must start with http:// or https://, got %q", cfg.qr.verifyURL), nil)
+	}
+	if cfg.quotes.ttl <= 0 {
+		logger.PrintFatal(fmt.Errorf("quote-ttl must be positive, got %s", cfg.quotes.ttl), nil)
+	}
+	if cfg.qr.expiryLeeway < 0 {
+		logger.PrintFatal(fmt.Errorf("qr-expiry-leeway must not be negative, got %s", cfg.qr.expiryLeeway), nil)
+	}
+	data.ServiceFee = data.RoundMoney(cfg.serviceFee)
+
+	if cfg.energyRate < 0 {
+		logger.PrintFatal(fmt.Errorf("energy-rate must not be negative, got %v", cfg.energyRate), nil)
+	}
+	data.DefaultEnergyRate = cfg.energyRate
+
+	if cfg.bcryptCost < bcrypt.MinCost || cfg.bcryptCost > bcrypt.MaxCost {
+		logger.PrintFatal(fmt.Errorf("bcrypt-cost must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, cfg.bcryptCost), nil)
+	}
+	data.PasswordCost = cfg.bcryptCost
+
+	if cfg.bookings.maxReservationDays < 1 {
+		logger.PrintFatal(fmt.Errorf("max-reservation-days must be at least 1, got %d", cfg.bookings.maxReservationDays), nil)
+	}
+	if cfg.bookings.maxAdvanceDays < 1 {
+		logger.PrintFatal(fmt.Errorf("max-advance-days must be at least 1, got %d", cfg.bookings.maxAdvanceDays), nil)
+	}
+	data.DefaultMaxReservationDays = cfg.bookings.maxReservationDays
+	data.DefaultMaxAdvanceDays = cfg.bookings.maxAdvanceDays
+
+	if cfg.db.queryTimeout <= 0 {
+		logger.PrintFatal(fmt.Errorf("db-query-timeout must be positive, got %s", cfg.db.queryTimeout), nil)
+	}
+	if cfg.db.longQueryTimeout < cfg.db.queryTimeout {
+		logger.PrintFatal(fmt.Errorf("db-long-query-timeout must not be shorter than db-query-timeout, got %s", cfg.db.longQueryTimeout), nil)
+	}
+	data.QueryTimeout = cfg.db.queryTimeout
+	data.LongQueryTimeout = cfg.db.longQueryTimeout
+
+	data.AllowInsecureWebhooks = cfg.env == "development"
+
+	db, err := openDB(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	defer db.Close()
+
+	logger.PrintInfo("database connection pool established", nil)
+
+	// Without a configured key passes are signed with a throwaway one and stop
+	// verifying when the server restarts.
+	if len(cfg.qr.signingKey) == 0 {
+		cfg.qr.signingKey = make([]byte, 32)
+		_, err := rand.Read(cfg.qr.signingKey)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		logger.PrintInfo("qr-signing-key not set, using a temporary key", nil)
+	}
+
+	// The same goes for quote tokens, which are short-lived anyway
+	if len(cfg.quotes.signingKey) == 0 {
+		cfg.quotes.signingKey = make([]byte, 32)
+		_, err := rand.Read(cfg.quotes.signingKey)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		logger.PrintInfo("quote-signing-key not set, using a temporary key", nil)
+	}
+
+	app := &application{
+		config:   cfg,
+		logger:   logger,
+		models:   data.NewModels(db),
+		mailer:   mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		webhooks: webhook.NewClient(10*time.Second, cfg.env == "development"),
+	}
+
+	app.qrStorage, err = newQRStorage(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	app.geocoder, err = newGeocoder(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	app.sms, err = newSMSSender(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	app.initGoogleOAuth()
+	app.startJobs()
+
+	err = app.serve()
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+}
+
+// parseConfig reads the configuration from command line flags in args, with
+// environment variables as defaults for secrets and connection settings.
+func parseConfig(fs *flag.FlagSet, args []string) (config, error) {
 	var cfg config
 
-	flag.IntVar(&cfg.port, "port", 4000, "API server port")
-	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production|testing)")
+	fs.IntVar(&cfg.port, "port", 4000, "API server port")
+	fs.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production|testing)")
+	fs.IntVar(&cfg.bcryptCost, "bcrypt-cost", 12, "bcrypt cost for password hashes; older hashes are upgraded at login")
 
-	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("DB_DSN"), "PostgreSQL DSN")
+	fs.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("DB_DSN"), "PostgreSQL DSN")
 
-	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
-	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
-	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
+	fs.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
+	fs.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
+	fs.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
+	fs.DurationVar(&cfg.db.queryTimeout, "db-query-timeout", 3*time.Second, "Time limit for each database query")
+	fs.DurationVar(&cfg.db.longQueryTimeout, "db-long-query-timeout", 10*time.Second, "Time limit for report, analytics and bulk database queries")
 
-	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
-	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
-	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
-	flag.StringVar(&cfg.smtp.host, "smtp-host", os.Getenv("SMTPHOST"), "SMTP host")
-	flag.StringVar(&cfg.frontendURL, "frontend-url", os.Getenv("FRONTEND_URL"), "Frontend URL")
+	fs.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
+	fs.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
+	fs.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	fs.StringVar(&cfg.smtp.host, "smtp-host", os.Getenv("SMTPHOST"), "SMTP host")
+	fs.StringVar(&cfg.frontendURL, "frontend-url", os.Getenv("FRONTEND_URL"), "Frontend URL")
 
 	envSMTPPort := os.Getenv("SMTPPORT")
 
@@ -95,54 +319,162 @@ func main() {
 		intSMTPPort = 587
 	}
 
-	flag.IntVar(&cfg.smtp.port, "smtp-port", intSMTPPort, "SMTP port")
-	flag.StringVar(&cfg.smtp.username, "smtp-username", os.Getenv("SMTPUSERNAME"), "SMTP username")
-	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("SMTPPASS"), "SMTP password")
-	flag.StringVar(&cfg.smtp.sender, "smtp-sender", os.Getenv("SMTPSENDER"), "SMTP sender")
-	flag.Parse()
+	fs.IntVar(&cfg.smtp.port, "smtp-port", intSMTPPort, "SMTP port")
+	fs.StringVar(&cfg.smtp.username, "smtp-username", os.Getenv("SMTPUSERNAME"), "SMTP username")
+	fs.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("SMTPPASS"), "SMTP password")
+	fs.StringVar(&cfg.smtp.sender, "smtp-sender", os.Getenv("SMTPSENDER"), "SMTP sender")
+	fs.IntVar(&cfg.smtp.maxAttempts, "smtp-max-attempts", 5, "Attempts at sending a queued email before it is dead-lettered")
 
 	// Add OAuth config
-	flag.StringVar(&cfg.oauth.googleClientID, "oauth-google-client-id", os.Getenv("GOOGLE_CLIENT_ID"), "Google OAuth Client ID")
-	flag.StringVar(&cfg.oauth.googleClientSecret, "oauth-google-client-secret", os.Getenv("GOOGLE_CLIENT_SECRET"), "Google OAuth Client Secret")
-	flag.StringVar(&cfg.oauth.redirectURI, "oauth-redirect-url", os.Getenv("GOOGLE_REDIRECT_URI"), "OAuth Redirect URL")
-
-	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(val string) error {
-		cfg.cors.trustedOrigins = strings.Fields(val)
+	fs.StringVar(&cfg.oauth.googleClientID, "oauth-google-client-id", os.Getenv("GOOGLE_CLIENT_ID"), "Google OAuth Client ID")
+	fs.StringVar(&cfg.oauth.googleClientSecret, "oauth-google-client-secret", os.Getenv("GOOGLE_CLIENT_SECRET"), "Google OAuth Client Secret")
+	fs.StringVar(&cfg.oauth.redirectURI, "oauth-redirect-url", os.Getenv("GOOGLE_REDIRECT_URI"), "OAuth Redirect URL")
+
+	// May be given more than once; each value can also hold several space separated origins.
+	fs.Func("cors-trusted-origins", "Trusted CORS origins (space separated, repeatable, \"*\" allows any origin without credentials)", func(val string) error {
+		for _, origin := range strings.Fields(val) {
+			if origin != "*" && !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+				return fmt.Errorf("invalid origin %q: must start with http:// or https://", origin)
+			}
+			cfg.cors.trustedOrigins = append(cfg.cors.trustedOrigins, strings.TrimSuffix(origin, "/"))
+		}
 		return nil
 	})
 
-	cfg.cors.trustedOrigins = append(cfg.cors.trustedOrigins, "http://localhost:5173", "http://localhost:3000")
+	fs.IntVar(&cfg.reviews.reportThreshold, "review-report-threshold", 3, "Number of user reports that flags a review for moderation (0 disables)")
+	fs.BoolVar(&cfg.reviews.autoHide, "review-auto-hide", false, "Hide reviews automatically once they reach the report threshold")
+
+	fs.Float64Var(&cfg.search.rankWeights.Distance, "search-rank-distance-weight", 0.5, "Weight of closeness in the search rank score")
+	fs.Float64Var(&cfg.search.rankWeights.Availability, "search-rank-availability-weight", 0.3, "Weight of free spot share in the search rank score")
+	fs.Float64Var(&cfg.search.rankWeights.Rating, "search-rank-rating-weight", 0.2, "Weight of average rating in the search rank score")
+
+	var quoteSigningKey string
+	fs.StringVar(&quoteSigningKey, "quote-signing-key", os.Getenv("QUOTE_SIGNING_KEY"), "Secret used to sign price quote tokens")
+	fs.DurationVar(&cfg.quotes.ttl, "quote-ttl", 10*time.Minute, "How long a quoted price is honored when booking with its quote token")
+
+	var qrSigningKey string
+	fs.StringVar(&qrSigningKey, "qr-signing-key", os.Getenv("QR_SIGNING_KEY"), "Secret used to sign reservation QR passes")
+
+	fs.DurationVar(&cfg.qr.expiryLeeway, "qr-expiry-leeway", 0, "How long after expiring a scanned QR code is still accepted, to allow for clock skew")
+	fs.StringVar(&cfg.qr.verifyURL, "qr-verify-url", "", "Page QR codes link to for verification (defaults to the frontend URL's /verify page)")
+	fs.StringVar(&cfg.qr.storage, "qr-storage", "local", "QR image storage backend (local|s3)")
+	fs.StringVar(&cfg.qr.storageDir, "qr-storage-dir", "./qr_images", "Directory for QR images with local storage")
+	fs.StringVar(&cfg.qr.s3.Endpoint, "qr-s3-endpoint", os.Getenv("QR_S3_ENDPOINT"), "S3-compatible endpoint for QR images")
+	fs.StringVar(&cfg.qr.s3.Region, "qr-s3-region", os.Getenv("QR_S3_REGION"), "S3 region for QR images")
+	fs.StringVar(&cfg.qr.s3.Bucket, "qr-s3-bucket", os.Getenv("QR_S3_BUCKET"), "S3 bucket for QR images")
+	fs.StringVar(&cfg.qr.s3.AccessKey, "qr-s3-access-key", os.Getenv("QR_S3_ACCESS_KEY"), "S3 access key")
+	fs.StringVar(&cfg.qr.s3.SecretKey, "qr-s3-secret-key", os.Getenv("QR_S3_SECRET_KEY"), "S3 secret key")
+	fs.StringVar(&cfg.qr.s3.PublicURL, "qr-s3-public-url", os.Getenv("QR_S3_PUBLIC_URL"), "Public base URL of the QR bucket (images are proxied when empty)")
+
+	fs.BoolVar(&cfg.geocode.enabled, "geocode-enabled", false, "Fill in blank parking lot addresses from their coordinates")
+	fs.StringVar(&cfg.geocode.provider, "geocode-provider", "nominatim", "Reverse geocoding provider (nominatim|mock)")
+	fs.StringVar(&cfg.geocode.url, "geocode-url", "https://nominatim.openstreetmap.org", "Nominatim server URL")
+	fs.StringVar(&cfg.geocode.userAgent, "geocode-user-agent", "SpotLinkIO-backend/"+version, "User-Agent sent to the geocoding provider")
+
+	fs.StringVar(&cfg.sms.provider, "sms-provider", os.Getenv("SMS_PROVIDER"), "SMS provider for reminders and mobile verification (twilio|mock); SMS is off when empty")
+	fs.StringVar(&cfg.sms.twilioURL, "sms-twilio-url", "https://api.twilio.com", "Twilio API base URL")
+	fs.StringVar(&cfg.sms.accountSID, "sms-account-sid", os.Getenv("SMS_ACCOUNT_SID"), "SMS provider account SID")
+	fs.StringVar(&cfg.sms.authToken, "sms-auth-token", os.Getenv("SMS_AUTH_TOKEN"), "SMS provider auth token")
+	fs.StringVar(&cfg.sms.from, "sms-from", os.Getenv("SMS_FROM"), "Number or sender ID text messages are sent from")
+	fs.StringVar(&cfg.sms.defaultCountryCode, "sms-default-country-code", "", "Country calling code for mobile numbers entered without one, e.g. 94")
+
+	fs.StringVar(&cfg.moneyRounding, "money-rounding", "half-up", "Rounding for monetary amounts (half-up|half-even)")
+	fs.Float64Var(&cfg.taxRate, "tax-rate", 0, "Tax rate charged on bookings, as a fraction (0.08 is 8%)")
+	fs.Float64Var(&cfg.serviceFee, "service-fee", 0, "Flat service fee added to every paid booking")
+	fs.Float64Var(&cfg.energyRate, "energy-rate", 0, "Price per kWh for EV charging sessions started without their own rate")
+
+	fs.IntVar(&cfg.bookings.maxReservationDays, "max-reservation-days", 30, "Longest booking a lot accepts unless it sets its own limit, in days")
+	fs.IntVar(&cfg.bookings.maxAdvanceDays, "max-advance-days", 90, "How far ahead a lot takes bookings unless it sets its own limit, in days")
+
+	fs.IntVar(&cfg.webhooks.maxAttempts, "webhook-max-attempts", 8, "Attempts at delivering a webhook event before it is marked failed")
+
+	// Repeatable, one provider per value. PAYMENT_WEBHOOK_SECRETS holds the
+	// defaults, space separated; a flag for the same provider overrides it.
+	cfg.payments.webhookSecrets = map[string]string{}
+	addWebhookSecret := func(val string) error {
+		provider, secret, ok := strings.Cut(val, "=")
+		if !ok || provider == "" || secret == "" {
+			return fmt.Errorf("invalid payment webhook secret %q: must be provider=secret", val)
+		}
+		cfg.payments.webhookSecrets[provider] = secret
+		return nil
+	}
+	for _, val := range strings.Fields(os.Getenv("PAYMENT_WEBHOOK_SECRETS")) {
+		if err := addWebhookSecret(val); err != nil {
+			return cfg, fmt.Errorf("PAYMENT_WEBHOOK_SECRETS: %w", err)
+		}
+	}
+	fs.Func("payment-webhook-secret", "Signing secret of a payment gateway's webhooks, as provider=secret (repeatable, defaults from PAYMENT_WEBHOOK_SECRETS)", addWebhookSecret)
 
-	cfg.qr.storageDir = "./qr_images"
-	flag.Parse()
+	fs.DurationVar(&cfg.spotHolds.duration, "spot-hold-duration", 10*time.Minute, "How long a held parking spot stays reserved before it is released")
 
-	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
-	if logger == nil {
-		panic("Logger is not initialized")
-	}
-	db, err := openDB(cfg)
+	fs.DurationVar(&cfg.tokens.activationTTL, "activation-token-ttl", 3*24*time.Hour, "How long account activation links stay valid")
+	fs.DurationVar(&cfg.tokens.passwordResetTTL, "password-reset-token-ttl", 45*time.Minute, "How long password reset links stay valid")
+	fs.DurationVar(&cfg.tokens.authenticationTTL, "authentication-token-ttl", 24*time.Hour, "How long authentication tokens stay valid after login")
+
+	fs.BoolVar(&cfg.violations.autoCharge, "violation-auto-charge", false, "Charge a lot's violation fee when a session is marked as a violation")
+
+	err = fs.Parse(args)
 	if err != nil {
-		logger.PrintFatal(err, nil)
+		return cfg, err
 	}
 
-	defer db.Close()
+	cfg.qr.signingKey = []byte(qrSigningKey)
+	cfg.quotes.signingKey = []byte(quoteSigningKey)
 
-	logger.PrintInfo("database connection pool established", nil)
+	if cfg.qr.verifyURL == "" && cfg.frontendURL != "" {
+		cfg.qr.verifyURL = strings.TrimSuffix(cfg.frontendURL, "/") + "/verify"
+	}
 
-	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+	if len(cfg.cors.trustedOrigins) == 0 {
+		cfg.cors.trustedOrigins = []string{"http://localhost:5173", "http://localhost:3000"}
 	}
 
-	app.initGoogleOAuth()
+	return cfg, nil
+}
 
-	err = app.serve()
-	if err != nil {
-		logger.PrintFatal(err, nil)
+func newQRStorage(cfg config) (qrcode.Storage, error) {
+	switch cfg.qr.storage {
+	case "local":
+		return qrcode.NewLocalStorage(cfg.qr.storageDir)
+	case "s3":
+		return qrcode.NewS3Storage(cfg.qr.s3)
+	default:
+		return nil, fmt.Errorf("unknown qr-storage %q: must be local or s3", cfg.qr.storage)
+	}
+}
+
+// newGeocoder returns nil when address enrichment is turned off.
+func newGeocoder(cfg config) (geocode.Geocoder, error) {
+	if !cfg.geocode.enabled {
+		return nil, nil
 	}
 
+	switch cfg.geocode.provider {
+	case "nominatim":
+		return geocode.NewNominatim(cfg.geocode.url, cfg.geocode.userAgent), nil
+	case "mock":
+		return &geocode.Mock{Address: "Unknown address"}, nil
+	default:
+		return nil, fmt.Errorf("unknown geocode-provider %q: must be nominatim or mock", cfg.geocode.provider)
+	}
+}
+
+// newSMSSender returns nil when no SMS provider is configured.
+func newSMSSender(cfg config) (sms.Sender, error) {
+	switch cfg.sms.provider {
+	case "":
+		return nil, nil
+	case "twilio":
+		if cfg.sms.accountSID == "" || cfg.sms.authToken == "" || cfg.sms.from == "" {
+			return nil, errors.New("sms-provider twilio requires sms-account-sid, sms-auth-token and sms-from")
+		}
+		return sms.NewTwilio(cfg.sms.twilioURL, cfg.sms.accountSID, cfg.sms.authToken, cfg.sms.from), nil
+	case "mock":
+		return &sms.Mock{}, nil
+	default:
+		return nil, fmt.Errorf("unknown sms-provider %q: must be twilio or mock", cfg.sms.provider)
+	}
 }
 
 func openDB(cfg config) (*sql.DB, error) {
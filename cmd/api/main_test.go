@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+// parseTestConfig parses args the way main does, on a flag set of its own.
+func parseTestConfig(t *testing.T, args ...string) (config, error) {
+	t.Helper()
+
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return parseConfig(fs, args)
+}
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := parseTestConfig(t,
+		"-cors-trusted-origins", "https://app.example.com https://admin.example.com/",
+		"-cors-trusted-origins", "http://localhost:8080",
+		"-review-report-threshold", "5",
+		"-qr-storage", "s3",
+		"-tax-rate", "0.08",
+		"-spot-hold-duration", "15m",
+		"-quote-ttl", "2m",
+		"-frontend-url", "https://app.example.com/",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantOrigins := []string{"https://app.example.com", "https://admin.example.com", "http://localhost:8080"}
+	if !slices.Equal(cfg.cors.trustedOrigins, wantOrigins) {
+		t.Errorf("trusted origins = %v; want %v", cfg.cors.trustedOrigins, wantOrigins)
+	}
+	if cfg.reviews.reportThreshold != 5 || cfg.qr.storage != "s3" || cfg.taxRate != 0.08 {
+		t.Errorf("report threshold %d, qr storage %q, tax rate %v; want 5, s3, 0.08", cfg.reviews.reportThreshold, cfg.qr.storage, cfg.taxRate)
+	}
+	if cfg.spotHolds.duration != 15*time.Minute || cfg.quotes.ttl != 2*time.Minute {
+		t.Errorf("spot hold %s, quote ttl %s; want 15m, 2m", cfg.spotHolds.duration, cfg.quotes.ttl)
+	}
+	if cfg.qr.verifyURL != "https://app.example.com/verify" {
+		t.Errorf("qr verify URL = %q; want the frontend's /verify page", cfg.qr.verifyURL)
+	}
+}
+
+func TestParseConfigDefaults(t *testing.T) {
+	cfg, err := parseTestConfig(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(cfg.cors.trustedOrigins, []string{"http://localhost:5173", "http://localhost:3000"}) {
+		t.Errorf("default trusted origins = %v", cfg.cors.trustedOrigins)
+	}
+	if cfg.port != 4000 || cfg.quotes.ttl != 10*time.Minute {
+		t.Errorf("port %d, quote ttl %s; want 4000, 10m", cfg.port, cfg.quotes.ttl)
+	}
+}
+
+func TestParseConfigRejectsBadFlags(t *testing.T) {
+	for name, args := range map[string][]string{
+		"origin without scheme": {"-cors-trusted-origins", "app.example.com"},
+		"unknown flag":          {"-no-such-flag"},
+	} {
+		if _, err := parseTestConfig(t, args...); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
+
+func TestParseConfigPaymentWebhookSecrets(t *testing.T) {
+	t.Setenv("PAYMENT_WEBHOOK_SECRETS", "stripe=whsec_env payhere=ph_env")
+
+	cfg, err := parseTestConfig(t, "-payment-webhook-secret", "payhere=ph_flag", "-payment-webhook-secret", "testpay=tp_flag")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"stripe": "whsec_env", "payhere": "ph_flag", "testpay": "tp_flag"}
+	if !maps.Equal(cfg.payments.webhookSecrets, want) {
+		t.Errorf("webhook secrets = %v; want %v", cfg.payments.webhookSecrets, want)
+	}
+
+	t.Setenv("PAYMENT_WEBHOOK_SECRETS", "stripe")
+	if _, err := parseTestConfig(t); err == nil {
+		t.Error("malformed PAYMENT_WEBHOOK_SECRETS: got no error")
+	}
+	if _, err := parseTestConfig(t, "-payment-webhook-secret", "=secret"); err == nil {
+		t.Error("secret without a provider: got no error")
+	}
+}
+
+func TestParseConfigSMS(t *testing.T) {
+	cfg, err := parseTestConfig(t, "-sms-provider", "mock", "-sms-default-country-code", "94")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err := newSMSSender(cfg)
+	if err != nil || sender == nil {
+		t.Fatalf("-sms-provider mock: sender %v, err %v; want a sender", sender, err)
+	}
+	if cfg.sms.defaultCountryCode != "94" {
+		t.Errorf("default country code = %q; want 94", cfg.sms.defaultCountryCode)
+	}
+
+	// The provider and sender can come from the environment like the credentials
+	t.Setenv("SMS_PROVIDER", "twilio")
+	t.Setenv("SMS_ACCOUNT_SID", "AC123")
+	t.Setenv("SMS_AUTH_TOKEN", "token")
+	t.Setenv("SMS_FROM", "+15005550006")
+
+	cfg, err = parseTestConfig(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err = newSMSSender(cfg)
+	if err != nil || sender == nil {
+		t.Errorf("SMS settings from the environment: sender %v, err %v; want a sender", sender, err)
+	}
+}
+
+func TestParseConfigTokenTTLs(t *testing.T) {
+	cfg, err := parseTestConfig(t,
+		"-activation-token-ttl", "48h",
+		"-password-reset-token-ttl", "15m",
+		"-authentication-token-ttl", "6h",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.tokens.activationTTL != 48*time.Hour || cfg.tokens.passwordResetTTL != 15*time.Minute || cfg.tokens.authenticationTTL != 6*time.Hour {
+		t.Errorf("token TTLs = %s, %s, %s; want 48h, 15m, 6h", cfg.tokens.activationTTL, cfg.tokens.passwordResetTTL, cfg.tokens.authenticationTTL)
+	}
+
+	cfg, err = parseTestConfig(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.tokens.activationTTL != 3*24*time.Hour || cfg.tokens.passwordResetTTL != 45*time.Minute || cfg.tokens.authenticationTTL != 24*time.Hour {
+		t.Errorf("default token TTLs = %s, %s, %s; want 72h, 45m, 24h", cfg.tokens.activationTTL, cfg.tokens.passwordResetTTL, cfg.tokens.authenticationTTL)
+	}
+}
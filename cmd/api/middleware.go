@@ -3,12 +3,15 @@ package main
 import (
 	"errors"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
 	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
 	"golang.org/x/time/rate"
@@ -26,6 +29,23 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
+// requestID tags every request with an ID that is echoed back in the
+// X-Request-ID header and included in error responses and logs. A well-formed
+// ID supplied by an upstream proxy is reused.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if _, err := uuid.Parse(id); err != nil {
+			id = uuid.New().String()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		r = app.contextSetRequestID(r, id)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) rateLimit(next http.Handler) http.Handler {
 	type client struct {
 		limiter  *rate.Limiter
@@ -64,9 +84,13 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 			}
 		}
 
-		clients[ip].lastSeen = time.Now()
+		now := time.Now()
+		clients[ip].lastSeen = now
+
+		allowed := clients[ip].limiter.AllowN(now, 1)
+		setRateLimitHeaders(w, clients[ip].limiter, now, allowed)
 
-		if !clients[ip].limiter.Allow() {
+		if !allowed {
 			mu.Unlock()
 			app.rateLimitExceededResponse(w, r)
 			return
@@ -77,6 +101,25 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 	})
 }
 
+// setRateLimitHeaders tells the client how much of its request budget with
+// limiter is left at now: X-RateLimit-Limit is the burst it may send at once and
+// X-RateLimit-Remaining what is left of it. Refused requests also get
+// Retry-After, the whole seconds until the next request would be allowed.
+func setRateLimitHeaders(w http.ResponseWriter, limiter *rate.Limiter, now time.Time, allowed bool) {
+	tokens := limiter.TokensAt(now)
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limiter.Burst()))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(max(int(math.Floor(tokens)), 0)))
+
+	if !allowed {
+		wait := 1.0
+		if limit := float64(limiter.Limit()); limit > 0 {
+			wait = max(math.Ceil((1-tokens)/limit), 1)
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait)))
+	}
+}
+
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
@@ -104,7 +147,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+		user, err := app.modelsFor(r).Users.GetForToken(data.ScopeAuthentication, token)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -138,7 +181,7 @@ func (app *application) requireActivatedUser(next http.HandlerFunc) http.Handler
 		user := app.contextGetUser(r)
 
 		if !user.Activated {
-			app.errorResponse(w, r, http.StatusForbidden, "user account not activated")
+			app.inactiveAccountResponse(w, r)
 			return
 		}
 		next.ServeHTTP(w, r)
@@ -151,7 +194,7 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
 
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		permissions, err := app.modelsFor(r).Permissions.GetAllForUser(user.ID)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
@@ -169,6 +212,37 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 	return app.requireActivatedUser(fn)
 }
 
+func (app *application) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.Role != "admin" {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireActivatedUser(fn)
+}
+
+// requireOrgAdmin only lets through users who administer their organization.
+func (app *application) requireOrgAdmin(next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.OrgID == nil || !user.IsOrgAdmin(*user.OrgID) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireActivatedUser(fn)
+}
+
 func (app *application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -176,20 +250,40 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 		w.Header().Add("Vary", "Access-Control-Request-Method")
 
 		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
 
 		if origin != "" {
+			allowed, wildcard := false, false
 			for i := range app.config.cors.trustedOrigins {
-				if origin == app.config.cors.trustedOrigins[i] {
+				switch app.config.cors.trustedOrigins[i] {
+				case origin:
+					allowed = true
+				case "*":
+					wildcard = true
+				}
+			}
+
+			switch {
+			case allowed:
+				// Credentials are only ever allowed for an explicitly trusted origin
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			case wildcard:
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			case preflight:
+				app.errorResponse(w, r, http.StatusForbidden, errCodeNotPermitted, "origin not allowed")
+				return
+			}
 
-					w.Header().Set("Access-Control-Allow-Origin", origin)
+			if allowed || wildcard {
+				w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Request-ID, X-RateLimit-Limit, X-RateLimit-Remaining, Retry-After")
 
-					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
-						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
-						w.WriteHeader(http.StatusOK)
-						return
-					}
-					break
+				if preflight {
+					w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST, PUT, PATCH, DELETE")
+					w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-None-Match, X-Request-ID")
+					w.Header().Set("Access-Control-Max-Age", "600")
+					w.WriteHeader(http.StatusNoContent)
+					return
 				}
 			}
 		}
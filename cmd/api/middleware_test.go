@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestEnableCORS(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	tests := []struct {
+		name            string
+		trusted         []string
+		method          string
+		origin          string
+		preflight       bool
+		wantStatus      int
+		wantOrigin      string
+		wantCredentials string
+		wantMethods     bool
+	}{
+		{"allowed origin", []string{"https://app.example.com"}, http.MethodGet, "https://app.example.com", false, http.StatusTeapot, "https://app.example.com", "true", false},
+		{"disallowed origin", []string{"https://app.example.com"}, http.MethodGet, "https://evil.example.com", false, http.StatusTeapot, "", "", false},
+		{"no origin", []string{"https://app.example.com"}, http.MethodGet, "", false, http.StatusTeapot, "", "", false},
+		{"wildcard never allows credentials", []string{"*"}, http.MethodGet, "https://any.example.com", false, http.StatusTeapot, "*", "", false},
+		{"preflight from allowed origin", []string{"https://app.example.com"}, http.MethodOptions, "https://app.example.com", true, http.StatusNoContent, "https://app.example.com", "true", true},
+		{"preflight from disallowed origin", []string{"https://app.example.com"}, http.MethodOptions, "https://evil.example.com", true, http.StatusForbidden, "", "", false},
+		{"plain OPTIONS is not a preflight", []string{"https://app.example.com"}, http.MethodOptions, "https://app.example.com", false, http.StatusTeapot, "https://app.example.com", "true", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.cors.trustedOrigins = tt.trusted
+
+			r := httptest.NewRequest(tt.method, "/v1/parking-lots", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			rr := httptest.NewRecorder()
+
+			app.enableCORS(next).ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("got status %d; want %d", rr.Code, tt.wantStatus)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("got Access-Control-Allow-Origin %q; want %q", got, tt.wantOrigin)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+				t.Errorf("got Access-Control-Allow-Credentials %q; want %q", got, tt.wantCredentials)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Methods") != ""; got != tt.wantMethods {
+				t.Errorf("Access-Control-Allow-Methods set = %t; want %t", got, tt.wantMethods)
+			}
+			if rr.Header().Values("Vary")[0] != "Origin" {
+				t.Errorf("got Vary %v; want it to include Origin", rr.Header().Values("Vary"))
+			}
+		})
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	app := newTestApplication(t)
+	// One request every 10 seconds after the burst, so none refill mid-test
+	app.config.limiter.rps = 0.1
+	app.config.limiter.burst = 3
+
+	handler := app.rateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	send := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/v1/healthcheck", nil)
+		r.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	for _, want := range []string{"2", "1", "0"} {
+		rr := send("192.0.2.1:1234")
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, want %d", rr.Code, http.StatusNoContent)
+		}
+		if got := rr.Header().Get("X-RateLimit-Limit"); got != "3" {
+			t.Errorf("X-RateLimit-Limit = %q, want 3", got)
+		}
+		if got := rr.Header().Get("X-RateLimit-Remaining"); got != want {
+			t.Errorf("X-RateLimit-Remaining = %q, want %s", got, want)
+		}
+		if got := rr.Header().Get("Retry-After"); got != "" {
+			t.Errorf("allowed request has Retry-After %q", got)
+		}
+	}
+
+	rr := send("192.0.2.1:5678")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("over the budget: status = %d, want %d", rr.Code, http.StatusTooManyRequests)
+	}
+	if got := rr.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("X-RateLimit-Remaining = %q, want 0", got)
+	}
+	retryAfter, err := strconv.Atoi(rr.Header().Get("Retry-After"))
+	if err != nil || retryAfter < 1 || retryAfter > 10 {
+		t.Errorf("Retry-After = %q, want 1 to 10 seconds", rr.Header().Get("Retry-After"))
+	}
+
+	// Other clients have their own budget
+	rr = send("192.0.2.2:1234")
+	if rr.Code != http.StatusNoContent || rr.Header().Get("X-RateLimit-Remaining") != "2" {
+		t.Errorf("other client: status %d, remaining %q; want %d, 2", rr.Code, rr.Header().Get("X-RateLimit-Remaining"), http.StatusNoContent)
+	}
+}
+
+func TestSetRateLimitHeadersWithoutRefill(t *testing.T) {
+	limiter := rate.NewLimiter(0, 1)
+	now := time.Now()
+
+	if !limiter.AllowN(now, 1) || limiter.AllowN(now, 1) {
+		t.Fatal("limiter didn't allow exactly its burst")
+	}
+
+	rr := httptest.NewRecorder()
+	setRateLimitHeaders(rr, limiter, now, false)
+
+	// A limiter that never refills still asks the client to wait a second
+	if got := rr.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+	if got := rr.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("X-RateLimit-Remaining = %q, want 0", got)
+	}
+}
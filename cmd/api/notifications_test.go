@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+)
+
+func TestListNotificationsValidation(t *testing.T) {
+	app := newTestApplication(t)
+	user := &data.User{ID: uuid.New(), Activated: true}
+
+	rr := httptest.NewRecorder()
+	app.listNotificationsHandler(rr, newAuthenticatedRequest(app, http.MethodGet, "/v1/notifications?include_archived=maybe", "", user))
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+	if _, ok := decodeError(t, rr).Fields["include_archived"]; !ok {
+		t.Error("include_archived not flagged")
+	}
+}
+
+func TestNotificationHandlersAreScopedToOwner(t *testing.T) {
+	app := newTestDBApplication(t)
+	owner := insertTestUser(t, app)
+	other := insertTestUser(t, app)
+
+	notification := &data.Notification{
+		UserID:  owner.ID,
+		Type:    data.NotificationTypeReservationReminder,
+		Title:   "Upcoming reservation",
+		Message: "Your reservation starts soon.",
+	}
+	if err := app.models.Notifications.Insert(notification); err != nil {
+		t.Fatal(err)
+	}
+
+	id := notification.ID.String()
+	call := func(handler http.HandlerFunc, method, target string, user *data.User) int {
+		rr := httptest.NewRecorder()
+		handler(rr, withParams(newAuthenticatedRequest(app, method, target, "", user), "id", id))
+		return rr.Code
+	}
+
+	if code := call(app.markNotificationReadHandler, http.MethodPut, "/v1/notifications/"+id+"/read", other); code != http.StatusNotFound {
+		t.Errorf("marking another user's notification read: status = %d, want %d", code, http.StatusNotFound)
+	}
+	if code := call(app.deleteNotificationHandler, http.MethodDelete, "/v1/notifications/"+id, other); code != http.StatusNotFound {
+		t.Errorf("deleting another user's notification: status = %d, want %d", code, http.StatusNotFound)
+	}
+
+	stored, err := app.models.Notifications.Get(notification.ID)
+	if err != nil {
+		t.Fatalf("notification gone after another user's delete: %v", err)
+	}
+	if stored.IsRead {
+		t.Error("another user marked the notification read")
+	}
+
+	if code := call(app.markNotificationReadHandler, http.MethodPut, "/v1/notifications/"+id+"/read", owner); code != http.StatusOK {
+		t.Errorf("owner marking read: status = %d, want %d", code, http.StatusOK)
+	}
+	if code := call(app.deleteNotificationHandler, http.MethodDelete, "/v1/notifications/"+id, owner); code != http.StatusOK {
+		t.Errorf("owner deleting: status = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestMarkNotificationsReadValidation(t *testing.T) {
+	user := &data.User{ID: uuid.New(), Activated: true}
+	id := uuid.NewString()
+
+	tooMany := make([]string, data.MaxMarkReadIDs+1)
+	for i := range tooMany {
+		tooMany[i] = `"` + uuid.NewString() + `"`
+	}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"missing", `{}`},
+		{"empty", `{"notification_ids": []}`},
+		{"duplicates", `{"notification_ids": ["` + id + `", "` + id + `"]}`},
+		{"too many", `{"notification_ids": [` + strings.Join(tooMany, ",") + `]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			rr := httptest.NewRecorder()
+
+			app.markNotificationsReadHandler(rr, newAuthenticatedRequest(app, http.MethodPost, "/v1/notifications/mark-read", tt.body, user))
+
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d, want %d", rr.Code, http.StatusUnprocessableEntity)
+			}
+			if _, ok := decodeError(t, rr).Fields["notification_ids"]; !ok {
+				t.Error("notification_ids not flagged")
+			}
+		})
+	}
+}
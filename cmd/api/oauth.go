@@ -85,46 +85,30 @@ func (app *application) googleCallbackHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	existingUser, err := app.models.Users.GetByEmail(googleUser.Email)
-	if err == nil {
-		authToken, err := app.models.Tokens.New(existingUser.ID, 24*time.Hour, data.ScopeAuthentication)
-		if err != nil {
-			app.logger.PrintError(err, map[string]string{"message": "Failed to generate authentication token"})
+	// Find or create user, linking Google to an existing account with the same email
+	user, created, err := app.modelsFor(r).Users.FindOrCreateFromGoogle(googleUser)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGoogleLinkRefused), errors.Is(err, data.ErrMissingGoogleID):
+			app.logger.PrintInfo("Refused to link Google account", map[string]string{"email": googleUser.Email})
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.logger.PrintError(err, map[string]string{"message": "Failed to find or create user"})
 			app.serverErrorResponse(w, r, err)
-			return
 		}
-
-		redirectURL := fmt.Sprintf("%s/auth/callback?token=%s", app.config.frontendURL, authToken.Plaintext)
-		app.logger.PrintInfo("Redirecting existing user to frontend", map[string]string{
-			"email": existingUser.Email,
-			"url":   redirectURL,
-		})
-		http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
-		return
-	} else if !errors.Is(err, data.ErrRecordNotFound) {
-		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	// Find or create user
-	user, err := app.models.Users.FindOrCreateFromGoogle(googleUser)
-	if err != nil {
-		app.logger.PrintError(err, map[string]string{"message": "Failed to find or create user"})
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	err = app.models.Permissions.AddForUser(user.ID, "ideas:write")
-
-	fmt.Println("User ID: ", user.ID)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
+	if created {
+		err = app.modelsFor(r).Permissions.AddForUser(user.ID, "ideas:write")
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
 	}
 
-
 	// Generate authentication token
-	authToken, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	authToken, err := app.modelsFor(r).Tokens.New(user.ID, app.config.tokens.authenticationTTL, data.ScopeAuthentication)
 	if err != nil {
 		app.logger.PrintError(err, map[string]string{"message": "Failed to generate authentication token"})
 		app.serverErrorResponse(w, r, err)
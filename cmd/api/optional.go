@@ -0,0 +1,36 @@
+package main
+
+import "encoding/json"
+
+// optional is a JSON field for PATCH requests that tells an omitted field apart
+// from an explicit null. Set is false when the field is absent; a null leaves
+// Set true and Value nil, which clears the stored value.
+type optional[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (o *optional[T]) UnmarshalJSON(b []byte) error {
+	o.Set = true
+
+	if string(b) == "null" {
+		o.Value = nil
+		return nil
+	}
+
+	var value T
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+	o.Value = &value
+
+	return nil
+}
+
+// applyTo copies the value into dst when the field was sent, including nil for
+// an explicit null.
+func (o optional[T]) applyTo(dst **T) {
+	if o.Set {
+		*dst = o.Value
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOptional(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		set   bool
+		value *string
+	}{
+		{"absent", `{}`, false, nil},
+		{"null", `{"mobile_number": null}`, true, nil},
+		{"value", `{"mobile_number": "+94771234567"}`, true, ptr("+94771234567")},
+		{"empty string", `{"mobile_number": ""}`, true, ptr("")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input struct {
+				MobileNumber optional[string] `json:"mobile_number"`
+			}
+			if err := json.Unmarshal([]byte(tt.body), &input); err != nil {
+				t.Fatal(err)
+			}
+
+			if input.MobileNumber.Set != tt.set {
+				t.Errorf("Set = %t; want %t", input.MobileNumber.Set, tt.set)
+			}
+			if !equalPtr(input.MobileNumber.Value, tt.value) {
+				t.Errorf("Value = %v; want %v", input.MobileNumber.Value, tt.value)
+			}
+
+			stored := ptr("+94770000000")
+			input.MobileNumber.applyTo(&stored)
+
+			want := ptr("+94770000000")
+			if tt.set {
+				want = tt.value
+			}
+			if !equalPtr(stored, want) {
+				t.Errorf("after applyTo got %v; want %v", stored, want)
+			}
+		})
+	}
+
+	var input struct {
+		Count optional[int] `json:"count"`
+	}
+	if err := json.Unmarshal([]byte(`{"count": "three"}`), &input); err == nil {
+		t.Error("wrong type: got no error")
+	}
+}
+
+func TestUpdateUserProfileClearsOnNull(t *testing.T) {
+	app := newTestDBApplication(t)
+	user := insertTestUser(t, app)
+
+	patch := func(body string) {
+		t.Helper()
+
+		rr := httptest.NewRecorder()
+		app.updateUserProfileHandler(rr, newAuthenticatedRequest(app, http.MethodPatch, "/v1/users/profile", body, user))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d; want %d: %s", body, rr.Code, http.StatusOK, rr.Body)
+		}
+	}
+	stored := func() *string {
+		t.Helper()
+
+		got, err := app.models.Users.Get(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got.MobileNumber
+	}
+
+	patch(`{"first_name": "Test", "last_name": "User", "mobile_number": "+94771234567"}`)
+	if got := stored(); got == nil || *got != "+94771234567" {
+		t.Fatalf("got mobile number %v; want +94771234567", got)
+	}
+
+	patch(`{"first_name": "Renamed"}`)
+	if got := stored(); got == nil || *got != "+94771234567" {
+		t.Errorf("leaving mobile_number out: got %v; want it unchanged", got)
+	}
+
+	patch(`{"mobile_number": null}`)
+	if got := stored(); got != nil {
+		t.Errorf("sending null: got %q; want it cleared", *got)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// Create an organization with the authenticated user as its admin
+func (app *application) createOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	org := &data.Organization{
+		Name:      input.Name,
+		CreatedBy: &user.ID,
+	}
+
+	v := validator.New()
+
+	if data.ValidateOrganization(v, org); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.modelsFor(r).Organizations.Insert(org)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrAlreadyInOrganization):
+			v.AddError("organization", "you already belong to an organization")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"organization": org}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get the authenticated user's organization and its members
+func (app *application) showMyOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	if user.OrgID == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	org, err := app.modelsFor(r).Organizations.Get(*user.OrgID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	members, err := app.modelsFor(r).Organizations.GetMembers(org.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"organization": org, "members": members}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Invite a user to the organization by email (org admin only)
+func (app *application) inviteOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	invitee, err := app.modelsFor(r).Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "no user with this email address exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if invitee.OrgID != nil {
+		v.AddError("email", "this user already belongs to an organization")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	invitation := &data.OrganizationInvitation{
+		OrgID:     *user.OrgID,
+		UserID:    invitee.ID,
+		InvitedBy: &user.ID,
+	}
+
+	err = app.modelsFor(r).Organizations.Invite(invitation)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateInvitation):
+			v.AddError("email", "this user already has a pending invitation")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	org, err := app.modelsFor(r).Organizations.Get(invitation.OrgID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	details := fmt.Sprintf(`{"invitation_id":%q}`, invitation.ID)
+	notification := &data.Notification{
+		UserID:  invitee.ID,
+		Type:    data.NotificationTypeOrgInvitation,
+		Title:   "Organization invitation",
+		Message: fmt.Sprintf("You have been invited to join %s.", org.Name),
+		Data:    &details,
+	}
+
+	err = app.modelsFor(r).Notifications.Insert(notification)
+	if err != nil {
+		app.logError(r, err)
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"invitation": invitation}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Accept a pending invitation addressed to the authenticated user
+func (app *application) acceptOrganizationInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	invitation, err := app.modelsFor(r).Organizations.GetPendingInvitation(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if invitation.UserID != user.ID {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.modelsFor(r).Organizations.AcceptInvitation(invitation)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrAlreadyInOrganization):
+			v := validator.New()
+			v.AddError("organization", "you already belong to an organization")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"invitation": invitation}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Remove a member from the organization (org admin only)
+func (app *application) removeOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	memberID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	if memberID == user.ID {
+		v := validator.New()
+		v.AddError("id", "admins cannot remove themselves")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.modelsFor(r).Organizations.RemoveMember(*user.OrgID, memberID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "member successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get the reservations of every organization member (org admin only)
+func (app *application) listOrganizationReservationsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-start_time")
+	input.Filters.SortSafelist = []string{"start_time", "created_at", "total_amount", "-start_time", "-created_at", "-total_amount"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	reservations, metadata, err := app.modelsFor(r).Reservations.GetAllForOrg(*user.OrgID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reservations": reservations, "metadata": app.withPageLinks(r, metadata)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get the payments of every organization member (org admin only)
+func (app *application) listOrganizationPaymentsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-payment_date")
+	input.Filters.SortSafelist = []string{"payment_date", "amount", "created_at", "-payment_date", "-amount", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	payments, metadata, err := app.modelsFor(r).Payments.GetAllForOrg(*user.OrgID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"payments": payments, "metadata": app.withPageLinks(r, metadata)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get the organization's spend per member, net of refunds (org admin only).
+// Defaults to the current calendar month.
+func (app *application) showOrganizationBillingHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	to := from.AddDate(0, 1, 0)
+
+	var err error
+	if value := qs.Get("from"); value != "" {
+		from, err = time.ParseInLocation("2006-01-02", value, time.Local)
+		v.Check(err == nil, "from", "must be a date in YYYY-MM-DD format")
+	}
+	if value := qs.Get("to"); value != "" {
+		to, err = time.ParseInLocation("2006-01-02", value, time.Local)
+		v.Check(err == nil, "to", "must be a date in YYYY-MM-DD format")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if v.Check(to.After(from), "to", "must be after from"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	billing, err := app.modelsFor(r).Payments.GetOrgBilling(*user.OrgID, from, to)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"billing": billing, "from": from, "to": to}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
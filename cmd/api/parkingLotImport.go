@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// lotImportRow is one parking lot of an import, as read from a JSON item or a
+// CSV row.
+type lotImportRow struct {
+	Name         string      `json:"name"`
+	Address      string      `json:"address"`
+	Latitude     float64     `json:"latitude"`
+	Longitude    float64     `json:"longitude"`
+	TotalSpots   int         `json:"total_spots"`
+	HourlyRate   data.Money  `json:"hourly_rate"`
+	DailyRate    *data.Money `json:"daily_rate"`
+	MonthlyRate  *data.Money `json:"monthly_rate"`
+	OpenTime     string      `json:"open_time"`
+	CloseTime    string      `json:"close_time"`
+	IsActive     *bool       `json:"is_active"`
+	IsRefundable bool        `json:"is_refundable"`
+	Timezone     *string     `json:"timezone"`
+	TaxRate      *float64    `json:"tax_rate"`
+	ViolationFee *float64    `json:"violation_fee"`
+
+	// errors holds the CSV cells that could not be parsed.
+	errors map[string]string
+}
+
+// lotImportColumns are the CSV columns an import may have. Only name is
+// required in the header; missing columns are left empty.
+var lotImportColumns = []string{
+	"name", "address", "latitude", "longitude", "total_spots", "hourly_rate", "daily_rate", "monthly_rate",
+	"open_time", "close_time", "is_active", "is_refundable", "timezone", "tax_rate", "violation_fee",
+}
+
+// Import parking lots for an owner being onboarded. The body is either JSON,
+// {"parking_lots": [...]}, or a CSV file with a header row when sent as
+// text/csv. Rows are validated on their own and the valid ones are created in
+// one transaction; the response reports the outcome per row, in order. With
+// generate_spots=true each lot also gets its total_spots regular spots.
+func (app *application) importParkingLotsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	ownerID, err := uuid.Parse(app.readString(qs, "owner_id", ""))
+	if err != nil {
+		v.AddError("owner_id", "must be a valid user ID")
+	}
+	generateSpots := app.readBool(qs, "generate_spots", v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var rows []*lotImportRow
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "text/csv" {
+		r.Body = http.MaxBytesReader(w, r.Body, 1_048_576*10)
+		rows, err = readLotImportCSV(r.Body)
+	} else {
+		var input struct {
+			ParkingLots []lotImportRow `json:"parking_lots"`
+		}
+		err = app.readJSON(w, r, &input)
+		for i := range input.ParkingLots {
+			rows = append(rows, &input.ParkingLots[i])
+		}
+	}
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v.Check(len(rows) > 0, "parking_lots", "must contain at least one parking lot")
+	v.Check(len(rows) <= data.MaxImportLots, "parking_lots", fmt.Sprintf("must not contain more than %d parking lots", data.MaxImportLots))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.modelsFor(r).Users.Get(ownerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("owner_id", "user not found")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	type rowResult struct {
+		Row        int               `json:"row"`    // 1-based, not counting a CSV header
+		Status     string            `json:"status"` // imported or failed
+		ParkingLot *data.ParkingLot  `json:"parking_lot,omitempty"`
+		Errors     map[string]string `json:"errors,omitempty"`
+	}
+
+	results := make([]rowResult, len(rows))
+
+	var lots []*data.ParkingLot
+	var indexes []int
+
+	for i, row := range rows {
+		results[i].Row = i + 1
+
+		rowV := validator.New()
+		for key, message := range row.errors {
+			rowV.AddError(key, message)
+		}
+
+		lot := &data.ParkingLot{
+			Name:         row.Name,
+			Address:      strings.TrimSpace(row.Address),
+			Latitude:     row.Latitude,
+			Longitude:    row.Longitude,
+			TotalSpots:   row.TotalSpots,
+			HourlyRate:   row.HourlyRate,
+			DailyRate:    row.DailyRate,
+			MonthlyRate:  row.MonthlyRate,
+			OpenTime:     row.OpenTime,
+			CloseTime:    row.CloseTime,
+			IsActive:     true,
+			IsRefundable: row.IsRefundable,
+			Timezone:     data.DefaultLotTimezone,
+			TaxRate:      row.TaxRate,
+			ViolationFee: row.ViolationFee,
+			OwnerID:      ownerID,
+		}
+
+		if row.IsActive != nil {
+			lot.IsActive = *row.IsActive
+		}
+		if row.Timezone != nil {
+			lot.Timezone = *row.Timezone
+		}
+
+		app.checkLotCoordinates(r, rowV, lot, false)
+
+		if data.ValidateParkingLot(rowV, lot); !rowV.Valid() {
+			results[i].Status = "failed"
+			results[i].Errors = rowV.Errors
+			continue
+		}
+
+		lots = append(lots, lot)
+		indexes = append(indexes, i)
+	}
+
+	if len(lots) > 0 {
+		err = app.modelsFor(r).ParkingLots.Import(lots, generateSpots != nil && *generateSpots)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	for n, lot := range lots {
+		results[indexes[n]].Status = "imported"
+		results[indexes[n]].ParkingLot = lot
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{
+		"results":  results,
+		"imported": len(lots),
+		"failed":   len(results) - len(lots),
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readLotImportCSV reads the parking lots of a CSV import. A malformed file or
+// header is an error; cells that don't parse are recorded on their row so it
+// fails on its own.
+func readLotImportCSV(body io.Reader) ([]*lotImportRow, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("CSV body must not be empty")
+		}
+		return nil, fmt.Errorf("CSV header is malformed: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !validator.PermittedValue(name, lotImportColumns...) {
+			return nil, fmt.Errorf("CSV has unknown column %q", name)
+		}
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("CSV has duplicate column %q", name)
+		}
+		columns[name] = i
+	}
+
+	if _, ok := columns["name"]; !ok {
+		return nil, errors.New(`CSV must have a "name" column`)
+	}
+
+	var rows []*lotImportRow
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("CSV is malformed: %w", err)
+		}
+
+		if len(rows) == data.MaxImportLots {
+			return nil, fmt.Errorf("CSV must not contain more than %d parking lots", data.MaxImportLots)
+		}
+
+		cell := func(column string) string {
+			if i, ok := columns[column]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row := &lotImportRow{
+			Name:      cell("name"),
+			Address:   cell("address"),
+			OpenTime:  cell("open_time"),
+			CloseTime: cell("close_time"),
+			errors:    map[string]string{},
+		}
+
+		row.Latitude = parseImportFloat(row, "latitude", cell("latitude"))
+		row.Longitude = parseImportFloat(row, "longitude", cell("longitude"))
+		if rate := parseImportOptionalMoney(row, "hourly_rate", cell("hourly_rate")); rate != nil {
+			row.HourlyRate = *rate
+		}
+		row.DailyRate = parseImportOptionalMoney(row, "daily_rate", cell("daily_rate"))
+		row.MonthlyRate = parseImportOptionalMoney(row, "monthly_rate", cell("monthly_rate"))
+		row.TaxRate = parseImportOptionalFloat(row, "tax_rate", cell("tax_rate"))
+		row.ViolationFee = parseImportOptionalFloat(row, "violation_fee", cell("violation_fee"))
+
+		if s := cell("total_spots"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				row.errors["total_spots"] = "must be an integer value"
+			}
+			row.TotalSpots = n
+		}
+
+		if s := cell("is_active"); s != "" {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				row.errors["is_active"] = "must be a boolean value"
+			}
+			row.IsActive = &b
+		}
+
+		if s := cell("is_refundable"); s != "" {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				row.errors["is_refundable"] = "must be a boolean value"
+			}
+			row.IsRefundable = b
+		}
+
+		if s := cell("timezone"); s != "" {
+			row.Timezone = &s
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// parseImportFloat parses a numeric CSV cell, recording an error on the row
+// when it isn't a number. An empty cell is zero, as an omitted JSON field is.
+func parseImportFloat(row *lotImportRow, key, s string) float64 {
+	f := parseImportOptionalFloat(row, key, s)
+	if f == nil {
+		return 0
+	}
+	return *f
+}
+
+// parseImportOptionalFloat parses a numeric CSV cell that may be left empty.
+func parseImportOptionalFloat(row *lotImportRow, key, s string) *float64 {
+	if s == "" {
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		row.errors[key] = "must be a number"
+		return nil
+	}
+	return &f
+}
+
+// parseImportOptionalMoney parses an amount CSV cell that may be left empty.
+func parseImportOptionalMoney(row *lotImportRow, key, s string) *data.Money {
+	if s == "" {
+		return nil
+	}
+
+	amount, err := data.ParseMoney(s)
+	if err != nil {
+		row.errors[key] = "must be an amount with at most two decimal places"
+		return nil
+	}
+	return &amount
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+)
+
+func TestReadLotImportCSV(t *testing.T) {
+	csv := "Name, Address, latitude, total_spots, hourly_rate, is_active\n" +
+		"North,1 Main St,6.9,10,150.50,false\n" +
+		"South,2 Main St,north,ten,1.234,maybe\n"
+
+	rows, err := readLotImportCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows; want 2", len(rows))
+	}
+
+	north := rows[0]
+	if len(north.errors) != 0 {
+		t.Errorf("valid row has errors %v", north.errors)
+	}
+	if north.Name != "North" || north.Latitude != 6.9 || north.TotalSpots != 10 || north.HourlyRate != data.MoneyFromFloat(150.5) {
+		t.Errorf("got %+v", north)
+	}
+	if north.IsActive == nil || *north.IsActive {
+		t.Errorf("is_active = %v; want false", north.IsActive)
+	}
+
+	for _, key := range []string{"latitude", "total_spots", "hourly_rate", "is_active"} {
+		if _, ok := rows[1].errors[key]; !ok {
+			t.Errorf("unparseable %s wasn't recorded: %v", key, rows[1].errors)
+		}
+	}
+
+	for name, body := range map[string]string{
+		"empty":            "",
+		"no name column":   "address\n1 Main St\n",
+		"unknown column":   "name,colour\nNorth,red\n",
+		"duplicate column": "name,Name\nNorth,North\n",
+		"ragged row":       "name,address\nNorth\n",
+	} {
+		if _, err := readLotImportCSV(strings.NewReader(body)); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
+
+func TestImportParkingLotsReportsFailedRows(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	owner := insertTestUser(t, app)
+
+	csv := "name,address,latitude,longitude,total_spots,hourly_rate,open_time,close_time,timezone\n" +
+		"Fort,1 Fort Rd,6.93,79.84,3,100,06:00,22:00,Asia/Colombo\n" +
+		"Nowhere,,6.93,79.84,3,100,06:00,22:00,UTC\n" +
+		"Pettah,2 Main St,north,79.85,3,100,06:00,22:00,UTC\n" +
+		"Kandy,3 Lake Rd,7.29,80.63,2,80,00:00,00:00,\n"
+
+	r := newAuthenticatedRequest(app, http.MethodPost, "/v1/admin/parking-lots/import?generate_spots=true&owner_id="+owner.ID.String(), csv, owner)
+	r.Header.Set("Content-Type", "text/csv")
+
+	rr := httptest.NewRecorder()
+	app.importParkingLotsHandler(rr, r)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rr.Code, rr.Body)
+	}
+
+	var body struct {
+		Imported int `json:"imported"`
+		Failed   int `json:"failed"`
+		Results  []struct {
+			Row        int               `json:"row"`
+			Status     string            `json:"status"`
+			ParkingLot *data.ParkingLot  `json:"parking_lot"`
+			Errors     map[string]string `json:"errors"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if body.Imported != 2 || body.Failed != 2 || len(body.Results) != 4 {
+		t.Fatalf("imported %d, failed %d, %d results; want 2, 2, 4", body.Imported, body.Failed, len(body.Results))
+	}
+
+	wantStatus := []string{"imported", "failed", "failed", "imported"}
+	for i, result := range body.Results {
+		if result.Row != i+1 || result.Status != wantStatus[i] {
+			t.Errorf("result %d: row %d, status %s; want row %d, %s", i, result.Row, result.Status, i+1, wantStatus[i])
+		}
+	}
+	if _, ok := body.Results[1].Errors["address"]; !ok {
+		t.Errorf("row 2 errors = %v; want address", body.Results[1].Errors)
+	}
+	if _, ok := body.Results[2].Errors["latitude"]; !ok {
+		t.Errorf("row 3 errors = %v; want latitude", body.Results[2].Errors)
+	}
+
+	for _, i := range []int{0, 3} {
+		imported := body.Results[i].ParkingLot
+		if imported == nil {
+			t.Fatalf("row %d has no parking lot", i+1)
+		}
+
+		lot, err := app.models.ParkingLots.Get(imported.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lot.OwnerID != owner.ID || lot.Name != imported.Name {
+			t.Errorf("row %d: stored %+v", i+1, lot)
+		}
+
+		spots, _, err := app.models.ParkingSpots.GetAllByLot(lot.ID, data.Filters{Page: 1, PageSize: 20, Sort: "spot_number", SortSafelist: []string{"spot_number"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(spots) != lot.TotalSpots {
+			t.Errorf("row %d: generated %d spots; want %d", i+1, len(spots), lot.TotalSpots)
+		}
+	}
+
+	if lot := body.Results[3].ParkingLot; lot.Timezone != data.DefaultLotTimezone {
+		t.Errorf("timezone = %q; want the default %q", lot.Timezone, data.DefaultLotTimezone)
+	}
+}
@@ -0,0 +1,1096 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// Get all active parking lots. Passing lat and lng searches around that point instead.
+func (app *application) listParkingLotsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	if qs.Has("lat") || qs.Has("lng") {
+		app.searchParkingLotsHandler(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafelist = []string{"id", "name", "hourly_rate", "total_spots", "created_at", "-id", "-name", "-hourly_rate", "-total_spots", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	lots, metadata, err := app.modelsFor(r).ParkingLots.GetAll(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"parking_lots": lots, "metadata": app.withPageLinks(r, metadata)}
+
+	err = app.selectFields(env, "parking_lots", app.readCSV(qs, "fields", nil))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSONWithETag(w, r, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Search for active parking lots around a point. Results are sorted by distance
+// unless sort=rank is given, which blends distance, availability and rating.
+// unit=mi takes the radius and reports distances in miles instead of
+// kilometres; radius_km is still accepted in place of radius.
+func (app *application) searchParkingLotsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Latitude  float64
+		Longitude float64
+		RadiusKm  float64
+		Unit      string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Latitude = app.readFloat(qs, "lat", 0, v)
+	input.Longitude = app.readFloat(qs, "lng", 0, v)
+	input.Unit = app.readString(qs, "unit", data.DistanceUnitKm)
+
+	v.Check(validator.PermittedValue(input.Unit, data.DistanceUnits...), "unit", "must be km or mi")
+
+	radiusKey := "radius_km"
+	if qs.Has("radius") {
+		radiusKey = "radius"
+		input.RadiusKm = data.ToKm(app.readFloat(qs, "radius", 0, v), input.Unit)
+	} else {
+		input.RadiusKm = app.readFloat(qs, "radius_km", 5, v)
+	}
+
+	v.Check(qs.Has("lat") && qs.Has("lng"), "lat", "lat and lng must be provided together")
+	v.Check(input.Latitude >= -90 && input.Latitude <= 90, "lat", "must be between -90 and 90")
+	v.Check(input.Longitude >= -180 && input.Longitude <= 180, "lng", "must be between -180 and 180")
+	v.Check(input.RadiusKm > 0 && input.RadiusKm <= 50, radiusKey, "must be greater than 0 and at most 50 km (31 mi)")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "distance")
+	input.Filters.SortSafelist = []string{"distance", "rank"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	results, err := app.modelsFor(r).ParkingLots.SearchByLocationWithStats(input.Latitude, input.Longitude, input.RadiusKm)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if input.Filters.Sort == "rank" {
+		data.RankSearchResults(results, input.RadiusKm, app.config.search.rankWeights)
+	}
+
+	data.SetDistanceUnit(results, input.Unit)
+
+	results, metadata := data.PaginateSearchResults(results, input.Filters)
+
+	env := envelope{"parking_lots": results, "metadata": app.withPageLinks(r, metadata)}
+
+	err = app.selectFields(env, "parking_lots", app.readCSV(qs, "fields", nil))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSONWithETag(w, r, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get the best rated active parking lots for the discovery screen
+func (app *application) listTopRatedParkingLotsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	limit := app.readInt(r.URL.Query(), "limit", 10, v)
+	v.Check(limit > 0 && limit <= 50, "limit", "must be between 1 and 50")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	lots, err := app.modelsFor(r).ParkingLots.GetTopRated(limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSONWithETag(w, r, http.StatusOK, envelope{"parking_lots": lots}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Suggest active parking lots for a search box as the user types. Lots whose
+// name or address starts with q are returned, name matches first, with only
+// the fields needed to show them.
+func (app *application) autocompleteParkingLotsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	term := strings.TrimSpace(app.readString(qs, "q", ""))
+	limit := app.readInt(qs, "limit", data.MaxAutocompleteResults, v)
+
+	v.Check(term != "", "q", "must be provided")
+	v.Check(len(term) <= 100, "q", "must not be more than 100 bytes long")
+	v.Check(limit > 0 && limit <= data.MaxAutocompleteResults, "limit", fmt.Sprintf("must be between 1 and %d", data.MaxAutocompleteResults))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	suggestions, err := app.modelsFor(r).ParkingLots.Autocomplete(term, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"suggestions": suggestions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get the most used active parking lots for the discovery screen
+func (app *application) listPopularParkingLotsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	limit := app.readInt(r.URL.Query(), "limit", 10, v)
+	v.Check(limit > 0 && limit <= 50, "limit", "must be between 1 and 50")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	lots, err := app.modelsFor(r).ParkingLots.GetMostPopular(limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSONWithETag(w, r, http.StatusOK, envelope{"parking_lots": lots}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get the authenticated user's own parking lots, optionally filtered by
+// active state and a name or address search
+func (app *application) listOwnParkingLotsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Active *bool
+		Search string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Active = app.readBool(qs, "active", v)
+	input.Search = strings.TrimSpace(app.readString(qs, "q", ""))
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafelist = []string{"id", "name", "hourly_rate", "total_spots", "created_at", "-id", "-name", "-hourly_rate", "-total_spots", "-created_at"}
+
+	data.ValidateLotSearch(v, input.Search)
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	lots, metadata, err := app.modelsFor(r).ParkingLots.GetByOwner(user.ID, input.Active, input.Search, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"parking_lots": lots, "metadata": app.withPageLinks(r, metadata)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Create a new parking lot owned by the authenticated user
+func (app *application) createParkingLotHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name                   string                      `json:"name"`
+		Address                string                      `json:"address"`
+		Latitude               float64                     `json:"latitude"`
+		Longitude              float64                     `json:"longitude"`
+		TotalSpots             int                         `json:"total_spots"`
+		HourlyRate             data.Money                  `json:"hourly_rate"`
+		DailyRate              *data.Money                 `json:"daily_rate"`
+		MonthlyRate            *data.Money                 `json:"monthly_rate"`
+		OpenTime               string                      `json:"open_time"`
+		CloseTime              string                      `json:"close_time"`
+		IsActive               *bool                       `json:"is_active"`
+		IsRefundable           bool                        `json:"is_refundable"`
+		Timezone               *string                     `json:"timezone"`
+		TaxRate                *float64                    `json:"tax_rate"`
+		ViolationFee           *float64                    `json:"violation_fee"`
+		MaxReservationDays     *int                        `json:"max_reservation_days"`
+		MaxAdvanceDays         *int                        `json:"max_advance_days"`
+		VehicleTypeMultipliers data.VehicleTypeMultipliers `json:"vehicle_type_multipliers"`
+		MinLeadMinutes         int                         `json:"min_lead_minutes"`
+		OverbookingPercent     int                         `json:"overbooking_percent"`
+
+		AllowZeroCoordinates bool `json:"allow_zero_coordinates"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	lot := &data.ParkingLot{
+		Name:                   input.Name,
+		Address:                input.Address,
+		Latitude:               input.Latitude,
+		Longitude:              input.Longitude,
+		TotalSpots:             input.TotalSpots,
+		HourlyRate:             input.HourlyRate,
+		DailyRate:              input.DailyRate,
+		MonthlyRate:            input.MonthlyRate,
+		OpenTime:               input.OpenTime,
+		CloseTime:              input.CloseTime,
+		IsActive:               true,
+		IsRefundable:           input.IsRefundable,
+		Timezone:               data.DefaultLotTimezone,
+		TaxRate:                input.TaxRate,
+		ViolationFee:           input.ViolationFee,
+		MaxReservationDays:     input.MaxReservationDays,
+		MaxAdvanceDays:         input.MaxAdvanceDays,
+		VehicleTypeMultipliers: input.VehicleTypeMultipliers,
+		MinLeadMinutes:         input.MinLeadMinutes,
+		OverbookingPercent:     input.OverbookingPercent,
+		OwnerID:                user.ID,
+	}
+
+	if input.IsActive != nil {
+		lot.IsActive = *input.IsActive
+	}
+	if input.Timezone != nil {
+		lot.Timezone = *input.Timezone
+	}
+
+	v := validator.New()
+	app.checkLotCoordinates(r, v, lot, input.AllowZeroCoordinates)
+
+	if v.Valid() {
+		app.enrichLotAddress(r, lot)
+	}
+
+	if data.ValidateParkingLot(v, lot); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.modelsFor(r).ParkingLots.Insert(lot)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"parking_lot": lot}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkLotCoordinates rejects (0, 0) unless allowZero is set, and logs a
+// warning for coordinates close to it, which are often a client bug too.
+func (app *application) checkLotCoordinates(r *http.Request, v *validator.Validator, lot *data.ParkingLot, allowZero bool) {
+	if !allowZero {
+		data.ValidateNotNullIsland(v, lot.Latitude, lot.Longitude)
+	}
+
+	if data.NearNullIsland(lot.Latitude, lot.Longitude) {
+		app.logger.PrintInfo("suspicious parking lot coordinates near (0, 0)", map[string]string{
+			"request_id": app.contextGetRequestID(r),
+			"lot_name":   lot.Name,
+			"latitude":   fmt.Sprintf("%f", lot.Latitude),
+			"longitude":  fmt.Sprintf("%f", lot.Longitude),
+		})
+	}
+}
+
+// enrichLotAddress fills in a blank lot address from its coordinates when a
+// geocoder is configured. A provided address is never replaced, and a failed
+// lookup leaves the address blank for validation to report.
+func (app *application) enrichLotAddress(r *http.Request, lot *data.ParkingLot) {
+	lot.Address = strings.TrimSpace(lot.Address)
+	if app.geocoder == nil || lot.Address != "" {
+		return
+	}
+
+	address, err := app.geocoder.ReverseGeocode(lot.Latitude, lot.Longitude)
+	if err != nil {
+		app.logError(r, err)
+		return
+	}
+
+	lot.Address = truncate(address, data.MaxLotAddressLength)
+}
+
+// Get a specific parking lot by ID
+func (app *application) showParkingLotHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	lot, err := app.modelsFor(r).ParkingLots.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	spotCounts, err := app.modelsFor(r).ParkingSpots.CountByType(lot.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	images, err := app.modelsFor(r).ParkingLotImages.List(lot.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"parking_lot": lot, "spot_counts": spotCounts, "images": images}
+
+	// Only authenticated users have favorites
+	user := app.contextGetUser(r)
+	if !user.IsAnonymous() {
+		isFavorite, err := app.modelsFor(r).Favorites.IsFavorite(user.ID, lot.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		env["is_favorite"] = isFavorite
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Update a parking lot. Only the owner may do this.
+func (app *application) updateParkingLotHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	lot, err := app.modelsFor(r).ParkingLots.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if lot.OwnerID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name                   *string                     `json:"name"`
+		Address                *string                     `json:"address"`
+		Latitude               *float64                    `json:"latitude"`
+		Longitude              *float64                    `json:"longitude"`
+		TotalSpots             *int                        `json:"total_spots"`
+		SyncTotalSpots         bool                        `json:"sync_total_spots"`
+		HourlyRate             *data.Money                 `json:"hourly_rate"`
+		DailyRate              *data.Money                 `json:"daily_rate"`
+		MonthlyRate            *data.Money                 `json:"monthly_rate"`
+		OpenTime               *string                     `json:"open_time"`
+		CloseTime              *string                     `json:"close_time"`
+		IsActive               *bool                       `json:"is_active"`
+		IsRefundable           *bool                       `json:"is_refundable"`
+		Timezone               *string                     `json:"timezone"`
+		TaxRate                optional[float64]           `json:"tax_rate"`
+		ViolationFee           optional[float64]           `json:"violation_fee"`
+		MaxReservationDays     optional[int]               `json:"max_reservation_days"`
+		MaxAdvanceDays         optional[int]               `json:"max_advance_days"`
+		VehicleTypeMultipliers data.VehicleTypeMultipliers `json:"vehicle_type_multipliers"`
+		MinLeadMinutes         *int                        `json:"min_lead_minutes"`
+		OverbookingPercent     *int                        `json:"overbooking_percent"`
+
+		AllowZeroCoordinates bool `json:"allow_zero_coordinates"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Update only provided fields
+	if input.Name != nil {
+		lot.Name = *input.Name
+	}
+	if input.Address != nil {
+		lot.Address = *input.Address
+	}
+	if input.Latitude != nil {
+		lot.Latitude = *input.Latitude
+	}
+	if input.Longitude != nil {
+		lot.Longitude = *input.Longitude
+	}
+	if input.TotalSpots != nil {
+		lot.TotalSpots = *input.TotalSpots
+	}
+	if input.HourlyRate != nil {
+		lot.HourlyRate = *input.HourlyRate
+	}
+	if input.DailyRate != nil {
+		lot.DailyRate = input.DailyRate
+	}
+	if input.MonthlyRate != nil {
+		lot.MonthlyRate = input.MonthlyRate
+	}
+	if input.OpenTime != nil {
+		lot.OpenTime = *input.OpenTime
+	}
+	if input.CloseTime != nil {
+		lot.CloseTime = *input.CloseTime
+	}
+	if input.IsActive != nil {
+		lot.IsActive = *input.IsActive
+	}
+	if input.IsRefundable != nil {
+		lot.IsRefundable = *input.IsRefundable
+	}
+	if input.Timezone != nil {
+		lot.Timezone = *input.Timezone
+	}
+	// Null goes back to the default tax rate
+	input.TaxRate.applyTo(&lot.TaxRate)
+	// Null removes the violation fee
+	input.ViolationFee.applyTo(&lot.ViolationFee)
+	// Null goes back to the default booking limits
+	input.MaxReservationDays.applyTo(&lot.MaxReservationDays)
+	input.MaxAdvanceDays.applyTo(&lot.MaxAdvanceDays)
+	// An empty object removes every multiplier
+	if input.VehicleTypeMultipliers != nil {
+		lot.VehicleTypeMultipliers = input.VehicleTypeMultipliers
+	}
+	if input.MinLeadMinutes != nil {
+		lot.MinLeadMinutes = *input.MinLeadMinutes
+	}
+	if input.OverbookingPercent != nil {
+		lot.OverbookingPercent = *input.OverbookingPercent
+	}
+
+	actualSpots, err := app.modelsFor(r).ParkingLots.GetActualSpotCount(lot.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Optionally recompute total_spots from the spots that actually exist
+	if input.SyncTotalSpots && actualSpots > 0 {
+		lot.TotalSpots = actualSpots
+	}
+
+	v := validator.New()
+
+	// Lots already stored at (0, 0) can still be edited without moving them
+	if input.Latitude != nil || input.Longitude != nil {
+		app.checkLotCoordinates(r, v, lot, input.AllowZeroCoordinates)
+	}
+
+	if v.Valid() {
+		app.enrichLotAddress(r, lot)
+	}
+
+	if data.ValidateParkingLot(v, lot); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.modelsFor(r).ParkingLots.Update(lot)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{"parking_lot": lot}
+
+	warnings := map[string]string{}
+	if actualSpots != lot.TotalSpots {
+		warnings["total_spots"] = fmt.Sprintf("total_spots is %d but the lot has %d spots configured", lot.TotalSpots, actualSpots)
+	}
+	if len(warnings) > 0 {
+		env["warnings"] = warnings
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Delete a parking lot. Only the owner may do this.
+func (app *application) deleteParkingLotHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	lot, err := app.modelsFor(r).ParkingLots.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if lot.OwnerID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.modelsFor(r).ParkingLots.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "parking lot successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Create a new lot with the same configuration as one the authenticated user
+// owns, at a different location. With copy_spots the spot layout comes along.
+func (app *application) cloneParkingLotHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name      string  `json:"name"`
+		Address   string  `json:"address"`
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+		CopySpots bool    `json:"copy_spots"`
+
+		AllowZeroCoordinates bool `json:"allow_zero_coordinates"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	source := app.getOwnedParkingLot(w, r, id)
+	if source == nil {
+		return
+	}
+
+	// Validate the clone as it will be stored
+	lot := *source
+	lot.Name = input.Name
+	lot.Address = input.Address
+	lot.Latitude = input.Latitude
+	lot.Longitude = input.Longitude
+
+	v := validator.New()
+	app.checkLotCoordinates(r, v, &lot, input.AllowZeroCoordinates)
+
+	if v.Valid() {
+		app.enrichLotAddress(r, &lot)
+	}
+
+	if data.ValidateParkingLot(v, &lot); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	clone, err := app.modelsFor(r).ParkingLots.Clone(source.ID, lot.Name, lot.Address, lot.Latitude, lot.Longitude, input.CopySpots)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"parking_lot": clone}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// List lots whose total_spots doesn't match the number of spot rows (admin only)
+func (app *application) listSpotCountMismatchesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "name")
+	input.Filters.SortSafelist = []string{"name", "total_spots", "actual_spots", "-name", "-total_spots", "-actual_spots"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	mismatches, metadata, err := app.modelsFor(r).ParkingLots.GetSpotCountMismatches(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"parking_lots": mismatches, "metadata": app.withPageLinks(r, metadata)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// maxTrendDays caps the date range of the check-in trend.
+const maxTrendDays = 366
+
+// Get a lot's daily check-in counts for the owner's trend chart. Defaults to
+// the last 30 days in the lot's time zone.
+func (app *application) showCheckInTrendHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	lot := app.getOwnedParkingLot(w, r, lotID)
+	if lot == nil {
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	to := time.Now().In(lot.Location())
+	from := to.AddDate(0, 0, -29)
+
+	if value := qs.Get("from"); value != "" {
+		from, err = time.Parse("2006-01-02", value)
+		v.Check(err == nil, "from", "must be a date in YYYY-MM-DD format")
+	}
+	if value := qs.Get("to"); value != "" {
+		to, err = time.Parse("2006-01-02", value)
+		v.Check(err == nil, "to", "must be a date in YYYY-MM-DD format")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	days := int(to.Sub(from).Hours()/24) + 1
+	v.Check(days > 0, "to", "must not be before from")
+	v.Check(days <= maxTrendDays, "to", fmt.Sprintf("must be within %d days of from", maxTrendDays))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	counts, err := app.modelsFor(r).ParkingSessions.GetDailyCheckInCounts(lot.ID, from, to)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"timezone": lot.Location().String(), "check_ins": counts}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get how long people stay at a lot, for the owner tuning prices: completed
+// sessions are counted by duration in bucket_minutes wide buckets. Defaults to
+// sessions that ended in the last 30 days, in 30 minute buckets.
+func (app *application) showDurationHistogramHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	lot := app.getOwnedParkingLot(w, r, lotID)
+	if lot == nil {
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	to := time.Now().In(lot.Location())
+	from := to.AddDate(0, 0, -29)
+
+	if value := qs.Get("from"); value != "" {
+		from, err = time.ParseInLocation("2006-01-02", value, lot.Location())
+		v.Check(err == nil, "from", "must be a date in YYYY-MM-DD format")
+	}
+	if value := qs.Get("to"); value != "" {
+		to, err = time.ParseInLocation("2006-01-02", value, lot.Location())
+		v.Check(err == nil, "to", "must be a date in YYYY-MM-DD format")
+	}
+	bucketMinutes := app.readInt(qs, "bucket_minutes", 30, v)
+
+	if data.ValidateDurationBucket(v, bucketMinutes); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, lot.Location())
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, lot.Location())
+
+	v.Check(!to.Before(from), "to", "must not be before from")
+	v.Check(to.Before(from.AddDate(0, 0, maxTrendDays)), "to", fmt.Sprintf("must be within %d days of from", maxTrendDays))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// to is inclusive, so count sessions ending up to the end of that day
+	histogram, err := app.modelsFor(r).ParkingSessions.GetDurationHistogram(lot.ID, from, to.AddDate(0, 0, 1), bucketMinutes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	report := envelope{
+		"from":           from.Format("2006-01-02"),
+		"to":             to.Format("2006-01-02"),
+		"bucket_minutes": bucketMinutes,
+		"durations":      histogram,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, report, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get a lot's revenue from completed payments for the owner. Defaults to the
+// current month in the lot's time zone; with split_tax=true the tax collected
+// and the net revenue are reported separately.
+func (app *application) showLotRevenueHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	lot := app.getOwnedParkingLot(w, r, lotID)
+	if lot == nil {
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	now := time.Now().In(lot.Location())
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, lot.Location())
+	to := from.AddDate(0, 1, -1)
+
+	if value := qs.Get("from"); value != "" {
+		from, err = time.ParseInLocation("2006-01-02", value, lot.Location())
+		v.Check(err == nil, "from", "must be a date in YYYY-MM-DD format")
+	}
+	if value := qs.Get("to"); value != "" {
+		to, err = time.ParseInLocation("2006-01-02", value, lot.Location())
+		v.Check(err == nil, "to", "must be a date in YYYY-MM-DD format")
+	}
+	splitTax := app.readBool(qs, "split_tax", v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	v.Check(!to.Before(from), "to", "must not be before from")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// to is inclusive, so count up to the end of that day
+	end := to.AddDate(0, 0, 1).Add(-time.Second)
+
+	revenue, err := app.modelsFor(r).Payments.GetRevenueByLot(lot.ID, from, end)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	report := envelope{
+		"from":    from.Format("2006-01-02"),
+		"to":      to.Format("2006-01-02"),
+		"revenue": revenue,
+	}
+
+	if splitTax != nil && *splitTax {
+		tax, err := app.modelsFor(r).Payments.GetTaxCollected(lot.ID, from, end)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		report["tax"] = tax
+		report["net"] = data.SumMoney(revenue, -tax)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, report, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get a lot's projected revenue from its confirmed and active reservations
+// starting between from and to, for the owner. Defaults to the next 30 days in
+// the lot's time zone. Unlike the revenue report, this counts bookings rather
+// than payments received.
+func (app *application) showLotRevenueForecastHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	lot := app.getOwnedParkingLot(w, r, lotID)
+	if lot == nil {
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	now := time.Now().In(lot.Location())
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, lot.Location())
+	to := from.AddDate(0, 0, 29)
+
+	if value := qs.Get("from"); value != "" {
+		from, err = time.ParseInLocation("2006-01-02", value, lot.Location())
+		v.Check(err == nil, "from", "must be a date in YYYY-MM-DD format")
+	}
+	if value := qs.Get("to"); value != "" {
+		to, err = time.ParseInLocation("2006-01-02", value, lot.Location())
+		v.Check(err == nil, "to", "must be a date in YYYY-MM-DD format")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	v.Check(!to.Before(from), "to", "must not be before from")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// to is inclusive, so count bookings starting any time that day
+	forecast, err := app.modelsFor(r).Reservations.GetForecast(lot.ID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	report := envelope{
+		"from":     from.Format("2006-01-02"),
+		"to":       to.Format("2006-01-02"),
+		"forecast": forecast,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, report, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// List the lot's completed reservations that haven't been paid in full, for the
+// owner to reconcile.
+func (app *application) listUnpaidReservationsHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	lot := app.getOwnedParkingLot(w, r, lotID)
+	if lot == nil {
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-end_time")
+	input.Filters.SortSafelist = []string{"start_time", "end_time", "total_amount", "-start_time", "-end_time", "-total_amount"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	reservations, metadata, err := app.modelsFor(r).Reservations.GetUnpaidCompleted(lot.ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reservations": reservations, "metadata": app.withPageLinks(r, metadata)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get the figures for a lot's owner dashboard. Revenue and violations cover
+// from to to, today in the lot's time zone by default; the rest are as of now.
+func (app *application) showLotDashboardHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	lot := app.getOwnedParkingLot(w, r, lotID)
+	if lot == nil {
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	now := time.Now().In(lot.Location())
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, lot.Location())
+	to := from
+
+	if value := qs.Get("from"); value != "" {
+		from, err = time.ParseInLocation("2006-01-02", value, lot.Location())
+		v.Check(err == nil, "from", "must be a date in YYYY-MM-DD format")
+	}
+	if value := qs.Get("to"); value != "" {
+		to, err = time.ParseInLocation("2006-01-02", value, lot.Location())
+		v.Check(err == nil, "to", "must be a date in YYYY-MM-DD format")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	v.Check(!to.Before(from), "to", "must not be before from")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// to is inclusive, so cover the whole of that day
+	dashboard, err := app.modelsFor(r).ParkingLots.GetDashboard(lot.ID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	report := envelope{
+		"from":      from.Format("2006-01-02"),
+		"to":        to.Format("2006-01-02"),
+		"dashboard": dashboard,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, report, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/geocode"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/jsonlog"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+func TestListOwnParkingLotsValidation(t *testing.T) {
+	user := &data.User{ID: uuid.New(), Activated: true}
+
+	tests := []struct {
+		name  string
+		query string
+		field string
+	}{
+		{"active not a boolean", "active=maybe", "active"},
+		{"search too long", "q=" + strings.Repeat("a", data.MaxLotSearchLength+1), "q"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			rr := httptest.NewRecorder()
+
+			app.listOwnParkingLotsHandler(rr, newAuthenticatedRequest(app, http.MethodGet, "/v1/users/me/parking-lots?"+tt.query, "", user))
+
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("got status %d; want %d", rr.Code, http.StatusUnprocessableEntity)
+			}
+			if decodeError(t, rr).Fields[tt.field] == "" {
+				t.Errorf("no error for the %s field", tt.field)
+			}
+		})
+	}
+}
+
+func TestCheckLotCoordinates(t *testing.T) {
+	tests := []struct {
+		name      string
+		lat, lng  float64
+		allowZero bool
+		rejected  bool
+		warned    bool
+	}{
+		{"null island", 0, 0, false, true, true},
+		{"null island allowed", 0, 0, true, false, true},
+		{"near null island", 0.4, 0.2, false, false, true},
+		{"real location", 6.9271, 79.8612, false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			app := &application{logger: jsonlog.New(&logs, jsonlog.LevelInfo)}
+
+			v := validator.New()
+			lot := &data.ParkingLot{Name: "Test lot", Latitude: tt.lat, Longitude: tt.lng}
+			app.checkLotCoordinates(httptest.NewRequest(http.MethodPost, "/v1/parking-lots", nil), v, lot, tt.allowZero)
+
+			if _, rejected := v.Errors["latitude"]; rejected != tt.rejected {
+				t.Errorf("rejected = %t; want %t", rejected, tt.rejected)
+			}
+			if warned := strings.Contains(logs.String(), "near (0, 0)"); warned != tt.warned {
+				t.Errorf("warned = %t; want %t", warned, tt.warned)
+			}
+		})
+	}
+}
+
+func TestEnrichLotAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		err     error
+		want    string
+		calls   int
+	}{
+		{"blank address", "", nil, "Galle Road, Colombo", 1},
+		{"whitespace address", "   ", nil, "Galle Road, Colombo", 1},
+		{"provided address", "1 Test Street", nil, "1 Test Street", 0},
+		{"failed lookup", "", geocode.ErrNoAddress, "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			geocoder := &geocode.Mock{Address: "Galle Road, Colombo", Err: tt.err}
+			app := newTestApplication(t)
+			app.geocoder = geocoder
+
+			lot := &data.ParkingLot{Address: tt.address, Latitude: 6.9271, Longitude: 79.8612}
+			app.enrichLotAddress(httptest.NewRequest(http.MethodPost, "/v1/parking-lots", nil), lot)
+
+			if lot.Address != tt.want {
+				t.Errorf("got address %q; want %q", lot.Address, tt.want)
+			}
+			if geocoder.Calls != tt.calls {
+				t.Errorf("got %d lookups; want %d", geocoder.Calls, tt.calls)
+			}
+		})
+	}
+
+	// Without a geocoder, enrichment is off.
+	app := newTestApplication(t)
+	lot := &data.ParkingLot{Latitude: 6.9271, Longitude: 79.8612}
+	app.enrichLotAddress(httptest.NewRequest(http.MethodPost, "/v1/parking-lots", nil), lot)
+	if lot.Address != "" {
+		t.Errorf("got address %q with enrichment off; want none", lot.Address)
+	}
+}
+
+func TestSearchParkingLotsRejectsUnknownUnit(t *testing.T) {
+	app := newTestApplication(t)
+
+	rr := httptest.NewRecorder()
+	app.searchParkingLotsHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/parking-lots/search?lat=6.9&lng=79.8&radius=5&unit=ft", nil))
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+	if _, ok := decodeError(t, rr).Fields["unit"]; !ok {
+		t.Error("unit not flagged")
+	}
+}
+
+func TestSearchParkingLotsInMiles(t *testing.T) {
+	app := newTestDBApplication(t)
+	owner := insertTestUser(t, app)
+
+	// Lots due north of a point in open ocean, so nothing else is nearby
+	const lat, lng = -48.5, -123.5
+	var lotIDs []uuid.UUID
+	for _, offset := range []float64{0.02, 0.06, 0.09} {
+		lot, _ := insertTestLot(t, app, owner.ID, 1)
+		_, err := app.models.ParkingLots.DB.Exec(`UPDATE parking_lots SET latitude = $1, longitude = $2 WHERE id = $3`, lat+offset, lng, lot.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lotIDs = append(lotIDs, lot.ID)
+	}
+
+	type result struct {
+		ID           uuid.UUID `json:"id"`
+		DistanceKm   float64   `json:"distance_km"`
+		Distance     float64   `json:"distance"`
+		DistanceUnit string    `json:"distance_unit"`
+	}
+
+	search := func(query string) []result {
+		t.Helper()
+
+		target := fmt.Sprintf("/v1/parking-lots/search?lat=%v&lng=%v&%s", lat, lng, query)
+		rr := httptest.NewRecorder()
+		app.searchParkingLotsHandler(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", query, rr.Code, rr.Body)
+		}
+
+		var body struct {
+			ParkingLots []result `json:"parking_lots"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return body.ParkingLots
+	}
+
+	// 5 mi is 8.04672 km: the two nearer lots are inside, the third is ~10 km out
+	km := search("radius=8.04672&unit=km")
+	mi := search("radius=5&unit=mi")
+	legacy := search("radius_km=8.04672")
+
+	if len(km) != 2 || len(mi) != 2 || len(legacy) != 2 {
+		t.Fatalf("got %d, %d and %d lots; want 2 each", len(km), len(mi), len(legacy))
+	}
+
+	for i := range km {
+		if km[i].ID != lotIDs[i] || mi[i].ID != lotIDs[i] || legacy[i].ID != lotIDs[i] {
+			t.Errorf("result %d differs between units: %s, %s, %s", i, km[i].ID, mi[i].ID, legacy[i].ID)
+		}
+		if km[i].DistanceUnit != data.DistanceUnitKm || km[i].Distance != km[i].DistanceKm {
+			t.Errorf("km result %d: distance %v %s, distance_km %v", i, km[i].Distance, km[i].DistanceUnit, km[i].DistanceKm)
+		}
+		if mi[i].DistanceUnit != data.DistanceUnitMi || math.Abs(mi[i].Distance*1.609344-km[i].DistanceKm) > 1e-6 {
+			t.Errorf("mi result %d: distance %v %s, want %v km in miles", i, mi[i].Distance, mi[i].DistanceUnit, km[i].DistanceKm)
+		}
+		if mi[i].DistanceKm != km[i].DistanceKm {
+			t.Errorf("mi result %d changed distance_km to %v", i, mi[i].DistanceKm)
+		}
+	}
+}
+
+func TestAutocompleteParkingLotsValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		field string
+	}{
+		{"no term", "q=", "q"},
+		{"blank term", "q=%20%20", "q"},
+		{"term too long", "q=" + strings.Repeat("a", 101), "q"},
+		{"limit too large", fmt.Sprintf("q=fort&limit=%d", data.MaxAutocompleteResults+1), "limit"},
+		{"limit zero", "q=fort&limit=0", "limit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			rr := httptest.NewRecorder()
+
+			app.autocompleteParkingLotsHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/discover/autocomplete?"+tt.query, nil))
+
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("got status %d; want %d", rr.Code, http.StatusUnprocessableEntity)
+			}
+			if decodeError(t, rr).Fields[tt.field] == "" {
+				t.Errorf("no error for the %s field", tt.field)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/webhook"
+)
+
+// paymentSignatureHeader carries the gateway's signature in the same
+// "t=<unix timestamp>,v1=<hex HMAC-SHA256>" form we sign our own webhooks with.
+const paymentSignatureHeader = "X-Payment-Signature"
+
+// paymentSignatureTolerance bounds how old a signed event may be, which stops
+// captured events from being replayed later.
+const paymentSignatureTolerance = 5 * time.Minute
+
+// paymentEventStatuses maps gateway event types to payment statuses.
+var paymentEventStatuses = map[string]string{
+	"payment.completed": data.PaymentStatusCompleted,
+	"payment.failed":    data.PaymentStatusFailed,
+	"payment.refunded":  data.PaymentStatusRefunded,
+}
+
+// Receive a payment status update from a payment gateway. Events must be
+// signed with the provider's configured secret. Redelivered events are
+// acknowledged without changing anything.
+func (app *application) paymentGatewayWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	provider := app.readStringParam(r, "provider")
+
+	secret, ok := app.config.payments.webhookSecrets[provider]
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1_048_576))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = webhook.Verify(secret, r.Header.Get(paymentSignatureHeader), body, paymentSignatureTolerance, time.Now())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			TransactionID string `json:"transaction_id"`
+		} `json:"data"`
+	}
+
+	err = json.Unmarshal(body, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, fmt.Errorf("body contains badly-formed JSON: %w", err))
+		return
+	}
+
+	status, ok := paymentEventStatuses[input.Type]
+	switch {
+	case input.ID == "":
+		app.badRequestResponse(w, r, errors.New("event id must be provided"))
+		return
+	case !ok:
+		app.badRequestResponse(w, r, fmt.Errorf("unsupported event type %q", input.Type))
+		return
+	case input.Data.TransactionID == "":
+		app.badRequestResponse(w, r, errors.New("event transaction_id must be provided"))
+		return
+	}
+
+	payment, changed, err := app.modelsFor(r).Payments.ApplyGatewayEvent(data.GatewayEvent{
+		Provider:      provider,
+		EventID:       input.ID,
+		TransactionID: input.Data.TransactionID,
+		Status:        status,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrInvalidTransition):
+			// Retrying won't make an out-of-order event apply, so it is
+			// acknowledged rather than rejected
+			app.logError(r, err)
+			err = app.writeJSON(w, http.StatusOK, envelope{"message": "event ignored: " + err.Error()}, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if changed {
+		app.notifyPaymentStatus(payment)
+
+		if payment.Status == data.PaymentStatusCompleted {
+			lotID, err := app.modelsFor(r).Payments.GetParkingLotID(payment.ID)
+			if err != nil {
+				app.logError(r, err)
+			} else {
+				app.publishLotEvent(lotID, data.WebhookEventPaymentCompleted, payment)
+			}
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"payment_id": payment.ID, "status": payment.Status, "updated": changed}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// notifyPaymentStatus tells the payer their payment's new status. The dedup key
+// makes sure each status is only announced once per payment.
+func (app *application) notifyPaymentStatus(payment *data.Payment) {
+	notification := &data.Notification{UserID: payment.UserID}
+
+	switch payment.Status {
+	case data.PaymentStatusCompleted:
+		notification.Type = data.NotificationTypePaymentCompleted
+		notification.Title = "Payment received"
+		notification.Message = fmt.Sprintf("Your payment of %s %s was successful.", payment.Amount, payment.Currency)
+	case data.PaymentStatusFailed:
+		notification.Type = data.NotificationTypePaymentFailed
+		notification.Title = "Payment failed"
+		notification.Message = fmt.Sprintf("Your payment of %s %s could not be processed.", payment.Amount, payment.Currency)
+	case data.PaymentStatusRefunded:
+		notification.Type = data.NotificationTypePaymentRefunded
+		notification.Title = "Payment refunded"
+		notification.Message = fmt.Sprintf("Your payment of %s %s has been refunded.", payment.Amount, payment.Currency)
+	default:
+		return
+	}
+
+	_, err := app.models.Notifications.InsertIfNotExists(notification, data.NotificationDedupKey(notification.Type, payment.ID, payment.UserID))
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"payment_id": payment.ID.String()})
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/webhook"
+)
+
+const testGatewaySecret = "whsec_gateway"
+
+// newGatewayEventRequest builds a gateway webhook for provider "testpay",
+// signed with secret unless it is empty.
+func newGatewayEventRequest(secret, eventID, eventType, transactionID string) *http.Request {
+	body := `{"id":"` + eventID + `","type":"` + eventType + `","data":{"transaction_id":"` + transactionID + `"}}`
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/webhooks/payments/testpay", strings.NewReader(body))
+	if secret != "" {
+		r.Header.Set(paymentSignatureHeader, webhook.Sign(secret, time.Now(), []byte(body)))
+	}
+
+	return withParams(r, "provider", "testpay")
+}
+
+func TestPaymentGatewayWebhookRejectsBadSignatures(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.payments.webhookSecrets = map[string]string{"testpay": testGatewaySecret}
+
+	tests := []struct {
+		name       string
+		r          *http.Request
+		wantStatus int
+	}{
+		{"unsigned", newGatewayEventRequest("", "evt_1", "payment.completed", "txn_1"), http.StatusBadRequest},
+		{"wrong secret", newGatewayEventRequest("whsec_other", "evt_1", "payment.completed", "txn_1"), http.StatusBadRequest},
+		{"unknown provider", withParams(httptest.NewRequest(http.MethodPost, "/v1/webhooks/payments/other", strings.NewReader("{}")), "provider", "other"), http.StatusNotFound},
+		{"unsupported event", newGatewayEventRequest(testGatewaySecret, "evt_1", "payment.disputed", "txn_1"), http.StatusBadRequest},
+		{"no event id", newGatewayEventRequest(testGatewaySecret, "", "payment.completed", "txn_1"), http.StatusBadRequest},
+		{"no transaction id", newGatewayEventRequest(testGatewaySecret, "evt_1", "payment.completed", ""), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			app.paymentGatewayWebhookHandler(rr, tt.r)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body)
+			}
+		})
+	}
+}
+
+func TestPaymentGatewayWebhookIsIdempotent(t *testing.T) {
+	app := newTestDBApplication(t)
+	app.config.payments.webhookSecrets = map[string]string{"testpay": testGatewaySecret}
+
+	user := insertTestUser(t, app)
+	lot, spots := insertTestLot(t, app, user.ID, 1)
+	vehicle := insertTestVehicle(t, app, user.ID)
+
+	now := time.Now()
+	reservation := &data.Reservation{
+		UserID:        user.ID,
+		VehicleID:     vehicle.ID,
+		ParkingLotID:  lot.ID,
+		ParkingSpotID: &spots[0].ID,
+		StartTime:     now.Add(time.Hour),
+		EndTime:       now.Add(2 * time.Hour),
+		Status:        data.ReservationStatusConfirmed,
+	}
+	if err := app.models.Reservations.Insert(reservation); err != nil {
+		t.Fatal(err)
+	}
+
+	transactionID := "txn_" + uuid.NewString()
+	payment := &data.Payment{
+		ReservationID: &reservation.ID,
+		UserID:        user.ID,
+		Amount:        data.MoneyFromFloat(100),
+		Currency:      "LKR",
+		PaymentMethod: data.PaymentMethodCard,
+		Status:        data.PaymentStatusPending,
+		TransactionID: &transactionID,
+		PaymentDate:   now,
+	}
+	if err := app.models.Payments.Insert(payment); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(eventID, eventType string) (int, bool) {
+		t.Helper()
+
+		rr := httptest.NewRecorder()
+		app.paymentGatewayWebhookHandler(rr, newGatewayEventRequest(testGatewaySecret, eventID, eventType, transactionID))
+		app.wg.Wait()
+
+		var body struct {
+			Updated bool `json:"updated"`
+		}
+		if rr.Code == http.StatusOK {
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rr.Code, body.Updated
+	}
+
+	eventID := "evt_" + uuid.NewString()
+
+	status, updated := send(eventID, "payment.completed")
+	if status != http.StatusOK || !updated {
+		t.Fatalf("first delivery: status %d, updated %t; want 200, true", status, updated)
+	}
+
+	// The gateway redelivers the same event
+	status, updated = send(eventID, "payment.completed")
+	if status != http.StatusOK || updated {
+		t.Fatalf("duplicate delivery: status %d, updated %t; want 200, false", status, updated)
+	}
+
+	stored, err := app.models.Payments.Get(payment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != data.PaymentStatusCompleted {
+		t.Errorf("payment status = %s, want %s", stored.Status, data.PaymentStatusCompleted)
+	}
+	if stored.Version != payment.Version+1 {
+		t.Errorf("payment version = %d, want %d", stored.Version, payment.Version+1)
+	}
+
+	unread, err := app.models.Notifications.GetUnreadCountForUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unread != 1 {
+		t.Errorf("got %d notifications, want 1", unread)
+	}
+
+	// A late failure for a completed payment is acknowledged but not applied
+	status, updated = send("evt_"+uuid.NewString(), "payment.failed")
+	if status != http.StatusOK || updated {
+		t.Errorf("out of order event: status %d, updated %t; want 200, false", status, updated)
+	}
+
+	// Events for unknown transactions are rejected so the gateway retries
+	rr := httptest.NewRecorder()
+	app.paymentGatewayWebhookHandler(rr, newGatewayEventRequest(testGatewaySecret, "evt_"+uuid.NewString(), "payment.completed", "txn_unknown"))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("unknown transaction: status = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// List payments across every lot, optionally by status and payment date
+// (admin only)
+func (app *application) listPaymentsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Status string
+		From   *time.Time
+		To     *time.Time
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Status = app.readString(qs, "status", "")
+	if input.Status != "" {
+		v.Check(validator.PermittedValue(input.Status, data.PaymentStatusPending, data.PaymentStatusCompleted, data.PaymentStatusFailed, data.PaymentStatusRefunded), "status", "must be pending, completed, failed or refunded")
+	}
+
+	if value := qs.Get("from"); value != "" {
+		from, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		v.Check(err == nil, "from", "must be a date in YYYY-MM-DD format")
+		input.From = &from
+	}
+	if value := qs.Get("to"); value != "" {
+		to, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		v.Check(err == nil, "to", "must be a date in YYYY-MM-DD format")
+		// Include the whole of the last day
+		to = to.AddDate(0, 0, 1)
+		input.To = &to
+	}
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-payment_date")
+	input.Filters.SortSafelist = []string{"payment_date", "amount", "created_at", "-payment_date", "-amount", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.From != nil && input.To != nil {
+		v.Check(input.To.After(*input.From), "to", "must not be before from")
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	payments, metadata, err := app.modelsFor(r).Payments.GetByStatus(input.Status, input.From, input.To, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"payments": payments, "metadata": app.withPageLinks(r, metadata)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListPaymentsValidation(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name  string
+		query string
+		field string
+	}{
+		{"unknown status", "status=settled", "status"},
+		{"bad from date", "from=01/03/2025", "from"},
+		{"bad to date", "to=2025-13-01", "to"},
+		{"to before from", "from=2025-03-10&to=2025-03-01", "to"},
+		{"unknown sort", "sort=user_id", "sort"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			app.listPaymentsHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/payments?"+tt.query, nil))
+
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d, want %d", rr.Code, http.StatusUnprocessableEntity)
+			}
+			if _, ok := decodeError(t, rr).Fields[tt.field]; !ok {
+				t.Errorf("%s not flagged", tt.field)
+			}
+		})
+	}
+}
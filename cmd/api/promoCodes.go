@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// Create a promo code (admin only)
+func (app *application) createPromoCodeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code          string     `json:"code"`
+		DiscountType  string     `json:"discount_type"`
+		DiscountValue float64    `json:"discount_value"`
+		ValidFrom     *time.Time `json:"valid_from"`
+		ValidUntil    *time.Time `json:"valid_until"`
+		MaxUses       *int       `json:"max_uses"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	promo := &data.PromoCode{
+		Code:          data.NormalizePromoCode(input.Code),
+		DiscountType:  input.DiscountType,
+		DiscountValue: input.DiscountValue,
+		ValidFrom:     time.Now(),
+		ValidUntil:    input.ValidUntil,
+		MaxUses:       input.MaxUses,
+		IsActive:      true,
+	}
+
+	if input.ValidFrom != nil {
+		promo.ValidFrom = *input.ValidFrom
+	}
+
+	v := validator.New()
+
+	if data.ValidatePromoCode(v, promo); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.modelsFor(r).PromoCodes.Insert(promo)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicatePromoCode):
+			v.AddError("code", "a promo code with this code already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"promo_code": promo}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get all promo codes (admin only)
+func (app *application) listPromoCodesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"code", "valid_until", "used_count", "created_at", "-code", "-valid_until", "-used_count", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	promos, metadata, err := app.modelsFor(r).PromoCodes.GetAll(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"promo_codes": promos, "metadata": app.withPageLinks(r, metadata)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
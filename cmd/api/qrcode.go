@@ -3,7 +3,6 @@ package main
 import (
     "errors"
     "net/http"
-    "os"
     "path/filepath"
 
     "github.com/google/uuid"
@@ -13,11 +12,18 @@ import (
     "github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
 )
 
+func (app *application) qrService() *qrcode.Service {
+    return qrcode.NewService(app.models, app.qrStorage, app.config.qr.signingKey, app.config.qr.expiryLeeway, app.config.qr.verifyURL)
+}
+
 func (app *application) generateQRCodeHandler(w http.ResponseWriter, r *http.Request) {
     var input struct {
-        VehicleID    string `json:"vehicle_id"`
-        ExpiryHours  *int   `json:"expiry_hours"`
-        Purpose      string `json:"purpose"`
+        VehicleID       string `json:"vehicle_id"`
+        ExpiryHours     *int   `json:"expiry_hours"`
+        Purpose         string `json:"purpose"`
+        Size            *int   `json:"size"`
+        ErrorCorrection string `json:"error_correction"`
+        Format          string `json:"format"`
     }
 
     err := app.readJSON(w, r, &input)
@@ -43,6 +49,29 @@ func (app *application) generateQRCodeHandler(w http.ResponseWriter, r *http.Req
         v.Check(expiryHours > 0 && expiryHours <= 168, "expiry_hours", "must be between 1 and 168 hours (7 days)")
     }
 
+    // Image options default to a 256px PNG with medium error correction
+    opts := qrcode.DefaultImageOptions()
+    if input.Size != nil {
+        opts.Size = *input.Size
+    }
+    if input.ErrorCorrection != "" {
+        opts.ErrorCorrection = input.ErrorCorrection
+    }
+    if input.Format != "" {
+        opts.Format = input.Format
+    }
+
+    // Inline codes come back as a data URL instead of being stored as a file
+    inline := false
+    if value := app.readBool(r.URL.Query(), "inline", v); value != nil {
+        inline = *value
+    }
+    if input.Format == "data_url" {
+        opts.Format = qrcode.FormatPNG
+        inline = true
+    }
+    qrcode.ValidateImageOptions(v, opts)
+
     if !v.Valid() {
         app.failedValidationResponse(w, r, v.Errors)
         return
@@ -52,10 +81,15 @@ func (app *application) generateQRCodeHandler(w http.ResponseWriter, r *http.Req
     user := app.contextGetUser(r)
 
     // Create QR code service
-    qrService := qrcode.NewService(app.models, app.config.qr.storageDir)
+    qrService := app.qrService()
 
     // Generate QR code
-    qrResponse, err := qrService.GenerateQRCode(user.ID, vehicleID, expiryHours, input.Purpose)
+    var qrResponse *qrcode.QRCodeResponse
+    if inline {
+        qrResponse, err = qrService.GenerateDataURL(user.ID, vehicleID, expiryHours, input.Purpose, opts)
+    } else {
+        qrResponse, err = qrService.GenerateQRCode(user.ID, vehicleID, expiryHours, input.Purpose, opts)
+    }
     if err != nil {
         switch {
         case errors.Is(err, data.ErrRecordNotFound):
@@ -66,18 +100,78 @@ func (app *application) generateQRCodeHandler(w http.ResponseWriter, r *http.Req
         return
     }
 
-    err = app.writeJSON(w, http.StatusCreated, envelope{
+    env := envelope{
         "qr_code":    qrResponse.QRCode,
         "qr_data":    qrResponse.QRData,
-        "image_url":  qrResponse.ImageURL,
         "verify_url": qrResponse.VerifyURL,
         "message":    "QR code generated successfully",
-    }, nil)
+    }
+    if qrResponse.DataURL != "" {
+        env["data_url"] = qrResponse.DataURL
+    } else {
+        env["image_url"] = qrResponse.ImageURL
+    }
+
+    err = app.writeJSON(w, http.StatusCreated, env, nil)
     if err != nil {
         app.serverErrorResponse(w, r, err)
     }
 }
 
+// qrScannerRole decides how much a scan of qrData by the request's user may
+// reveal. Admins are always operators. A lot's owner and operators are
+// operators only for codes tied to that lot, through the code's spot or
+// reservation, so codes tied to no lot reveal everything to admins alone.
+func (app *application) qrScannerRole(r *http.Request, qrData *data.QRCodeData) (string, error) {
+    user := app.contextGetUser(r)
+
+    switch {
+    case user.IsAnonymous():
+        return qrcode.ScannerAnonymous, nil
+    case user.Role == "admin":
+        return qrcode.ScannerOperator, nil
+    }
+
+    lotID := qrData.QRInfo.ParkingLotID
+    if lotID == nil && qrData.QRInfo.ReservationID != nil {
+        reservation, err := app.modelsFor(r).Reservations.Get(*qrData.QRInfo.ReservationID)
+        switch {
+        case errors.Is(err, data.ErrRecordNotFound):
+        case err != nil:
+            return "", err
+        default:
+            lotID = &reservation.ParkingLotID
+        }
+    }
+
+    if lotID == nil {
+        return qrcode.ScannerUser, nil
+    }
+
+    lot, err := app.modelsFor(r).ParkingLots.Get(*lotID)
+    if err != nil {
+        switch {
+        case errors.Is(err, data.ErrRecordNotFound):
+            return qrcode.ScannerUser, nil
+        default:
+            return "", err
+        }
+    }
+
+    role, err := app.lotRole(r, lot)
+    if err != nil {
+        return "", err
+    }
+
+    if role != "" {
+        return qrcode.ScannerOperator, nil
+    }
+
+    return qrcode.ScannerUser, nil
+}
+
+// Verify a scanned QR code. Contact details are only revealed to operators;
+// see qrScannerRole and qrcode.ScopeQRData.
 func (app *application) verifyQRCodeHandler(w http.ResponseWriter, r *http.Request) {
     var input struct {
         Code string `json:"code"`
@@ -98,22 +192,37 @@ func (app *application) verifyQRCodeHandler(w http.ResponseWriter, r *http.Reque
     }
 
     // Create QR code service
-    qrService := qrcode.NewService(app.models, app.config.qr.storageDir)
+    qrService := app.qrService()
 
     // Verify QR code
     qrData, err := qrService.VerifyQRCode(input.Code)
     if err != nil {
         switch {
         case errors.Is(err, data.ErrRecordNotFound):
-            app.errorResponse(w, r, http.StatusNotFound, "QR code not found or expired")
+            app.errorResponse(w, r, http.StatusNotFound, errCodeNotFound, "QR code not found or revoked")
+        case errors.Is(err, qrcode.ErrQRExpired):
+            app.qrCodeExpiredResponse(w, r)
+        case errors.Is(err, qrcode.ErrQRTampered):
+            v.AddError("code", "is not a valid QR code")
+            app.failedValidationResponse(w, r, v.Errors)
+        case errors.Is(err, qrcode.ErrCorruptQRData):
+            app.logError(r, err)
+            v.AddError("code", "could not be read, a new one must be issued")
+            app.failedValidationResponse(w, r, v.Errors)
         default:
             app.serverErrorResponse(w, r, err)
         }
         return
     }
 
+    scannerRole, err := app.qrScannerRole(r, qrData)
+    if err != nil {
+        app.serverErrorResponse(w, r, err)
+        return
+    }
+
     err = app.writeJSON(w, http.StatusOK, envelope{
-        "qr_data": qrData,
+        "qr_data": qrcode.ScopeQRData(qrData, scannerRole),
         "message": "QR code verified successfully",
     }, nil)
     if err != nil {
@@ -124,7 +233,7 @@ func (app *application) verifyQRCodeHandler(w http.ResponseWriter, r *http.Reque
 func (app *application) getUserQRCodesHandler(w http.ResponseWriter, r *http.Request) {
     user := app.contextGetUser(r)
 
-    qrCodes, err := app.models.QRCodes.GetActiveForUser(user.ID)
+    qrCodes, err := app.modelsFor(r).QRCodes.GetActiveForUser(user.ID)
     if err != nil {
         app.serverErrorResponse(w, r, err)
         return
@@ -149,16 +258,27 @@ func (app *application) serveQRImageHandler(w http.ResponseWriter, r *http.Reque
         return
     }
 
-    imagePath := filepath.Join(app.config.qr.storageDir, filename)
+    // Backends with directly reachable images get a redirect
+    if redirector, ok := app.qrStorage.(qrcode.Redirector); ok {
+        if url, ok := redirector.RedirectURL(filename); ok {
+            http.Redirect(w, r, url, http.StatusFound)
+            return
+        }
+    }
 
-    // Check if file exists
-    if _, err := os.Stat(imagePath); os.IsNotExist(err) {
-        app.notFoundResponse(w, r)
+    image, err := app.qrStorage.Get(filename)
+    if err != nil {
+        switch {
+        case errors.Is(err, qrcode.ErrImageNotFound):
+            app.notFoundResponse(w, r)
+        default:
+            app.serverErrorResponse(w, r, err)
+        }
         return
     }
 
-    w.Header().Set("Content-Type", "image/png")
+    w.Header().Set("Content-Type", qrcode.ContentType(filename))
     w.Header().Set("Cache-Control", "public, max-age=3600") // Cache for 1 hour
 
-    http.ServeFile(w, r, imagePath)
+    w.Write(image)
 }
\ No newline at end of file
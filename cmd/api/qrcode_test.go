@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/qrcode"
+)
+
+// redirectingStorage is a storage backend whose images are publicly reachable.
+type redirectingStorage struct {
+	qrcode.Storage
+}
+
+func (redirectingStorage) RedirectURL(name string) (string, bool) {
+	return "https://cdn.example.com/qr/" + name, true
+}
+
+func TestServeQRImage(t *testing.T) {
+	local, err := qrcode.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := local.Put("qr_ABC.svg", []byte("<svg/>")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		storage         qrcode.Storage
+		filename        string
+		wantStatus      int
+		wantContentType string
+		wantLocation    string
+	}{
+		{"local backend serves the image", local, "qr_ABC.svg", http.StatusOK, "image/svg+xml", ""},
+		{"local backend missing image", local, "qr_missing.png", http.StatusNotFound, "", ""},
+		{"directory traversal", local, "../qr_ABC.svg", http.StatusNotFound, "", ""},
+		{"public backend redirects", redirectingStorage{local}, "qr_ABC.svg", http.StatusFound, "", "https://cdn.example.com/qr/qr_ABC.svg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.qrStorage = tt.storage
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/qr-images/"+tt.filename, nil)
+			app.serveQRImageHandler(rr, withParams(r, "filename", tt.filename))
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("got status %d; want %d", rr.Code, tt.wantStatus)
+			}
+			if tt.wantContentType != "" {
+				if got := rr.Header().Get("Content-Type"); got != tt.wantContentType {
+					t.Errorf("got Content-Type %q; want %q", got, tt.wantContentType)
+				}
+				if rr.Body.String() != "<svg/>" {
+					t.Errorf("got body %q", rr.Body.String())
+				}
+			}
+			if got := rr.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("got Location %q; want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestVerifyQRCodeHidesContactDetails(t *testing.T) {
+	app := newTestDBApplication(t)
+	app.config.qr.signingKey = []byte("test signing key")
+	storage, err := qrcode.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.qrStorage = storage
+
+	driver := insertTestUser(t, app)
+	vehicle := insertTestVehicle(t, app, driver.ID)
+
+	admin := insertTestUser(t, app)
+	if _, err := app.models.Users.DB.Exec(`UPDATE users SET role = 'admin' WHERE id = $1`, admin.ID); err != nil {
+		t.Fatal(err)
+	}
+	admin.Role = "admin"
+
+	code, err := app.qrService().GenerateQRCode(driver.ID, vehicle.ID, 1, "identification", qrcode.DefaultImageOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func(user *data.User) data.UserProfile {
+		t.Helper()
+
+		rr := httptest.NewRecorder()
+		app.verifyQRCodeHandler(rr, newAuthenticatedRequest(app, http.MethodPost, "/v1/qr-codes/verify", `{"code": "`+code.QRCode.Code+`"}`, user))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("verify: got status %d: %s", rr.Code, rr.Body)
+		}
+
+		var body struct {
+			QRData data.QRCodeData `json:"qr_data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return body.QRData.UserProfile
+	}
+
+	for name, user := range map[string]*data.User{"anonymous": data.AnonymousUser, "signed in": insertTestUser(t, app)} {
+		profile := verify(user)
+		if profile.Email != "" || profile.MobileNumber != nil {
+			t.Errorf("%s scan revealed email %q, mobile %v", name, profile.Email, profile.MobileNumber)
+		}
+		if profile.ID != driver.ID {
+			t.Errorf("%s scan: got driver %s; want %s", name, profile.ID, driver.ID)
+		}
+	}
+
+	if profile := verify(admin); profile.Email != driver.Email {
+		t.Errorf("admin scan: got email %q; want %q", profile.Email, driver.Email)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// Create a recurring (monthly) reservation rule for the authenticated user
+func (app *application) createRecurringReservationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		VehicleID    uuid.UUID `json:"vehicle_id"`
+		ParkingLotID uuid.UUID `json:"parking_lot_id"`
+		DaysOfWeek   []int64   `json:"days_of_week"`
+		StartTime    string    `json:"start_time"`
+		EndTime      string    `json:"end_time"`
+		StartsOn     string    `json:"starts_on"`
+		EndsOn       *string   `json:"ends_on"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	v := validator.New()
+
+	rule := &data.RecurringReservation{
+		UserID:       user.ID,
+		VehicleID:    input.VehicleID,
+		ParkingLotID: input.ParkingLotID,
+		DaysOfWeek:   input.DaysOfWeek,
+		StartTime:    input.StartTime,
+		EndTime:      input.EndTime,
+		IsActive:     true,
+	}
+
+	rule.StartsOn, err = time.ParseInLocation("2006-01-02", input.StartsOn, time.Local)
+	v.Check(err == nil, "starts_on", "must be a date in YYYY-MM-DD format")
+
+	if input.EndsOn != nil {
+		endsOn, err := time.ParseInLocation("2006-01-02", *input.EndsOn, time.Local)
+		v.Check(err == nil, "ends_on", "must be a date in YYYY-MM-DD format")
+		rule.EndsOn = &endsOn
+	}
+
+	vehicle, err := app.modelsFor(r).Vehicles.Get(input.VehicleID)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		v.AddError("vehicle_id", "vehicle not found")
+	case err != nil:
+		app.serverErrorResponse(w, r, err)
+		return
+	case vehicle.UserID != user.ID:
+		v.AddError("vehicle_id", "vehicle not found")
+	}
+
+	lot, err := app.modelsFor(r).ParkingLots.Get(input.ParkingLotID)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		v.AddError("parking_lot_id", "parking lot not found")
+	case err != nil:
+		app.serverErrorResponse(w, r, err)
+		return
+	case !lot.IsActive:
+		v.AddError("parking_lot_id", "parking lot is not active")
+	case lot.MonthlyRate == nil:
+		v.AddError("parking_lot_id", "parking lot does not offer monthly parking")
+	default:
+		rule.MonthlyAmount = *lot.MonthlyRate
+	}
+
+	if data.ValidateRecurringReservation(v, rule); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.modelsFor(r).RecurringReservations.Insert(rule)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"recurring_reservation": rule}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get all recurring reservation rules for the authenticated user
+func (app *application) listRecurringReservationsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"id", "starts_on", "created_at", "-id", "-starts_on", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	rules, metadata, err := app.modelsFor(r).RecurringReservations.GetAllForUser(user.ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"recurring_reservations": rules, "metadata": app.withPageLinks(r, metadata)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Cancel a recurring reservation rule. Reservations already materialized from
+// it are left in place.
+func (app *application) cancelRecurringReservationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	rule, err := app.modelsFor(r).RecurringReservations.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if rule.UserID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.modelsFor(r).RecurringReservations.Cancel(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "recurring reservation successfully cancelled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,805 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/qrcode"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// reservationInput is the request body for booking a single reservation.
+type reservationInput struct {
+	VehicleID    uuid.UUID `json:"vehicle_id"`
+	ParkingLotID uuid.UUID `json:"parking_lot_id"`
+	StartTime    time.Time `json:"start_time"`
+	EndTime      time.Time `json:"end_time"`
+	SpotType     *string   `json:"spot_type"`
+	PromoCode    *string   `json:"promo_code"`
+	RedeemPoints *int      `json:"redeem_points"`
+	// HeldSpotID books a spot the user is holding instead of picking one
+	HeldSpotID *uuid.UUID `json:"held_spot_id"`
+	// QuoteToken locks in the price of a quote for the same booking
+	QuoteToken *string `json:"quote_token"`
+}
+
+// newReservation builds a confirmed, priced reservation for the user from the
+// request input. Problems with the input are recorded in v. It also returns
+// the spot types to try, in order, when assigning a spot.
+func (app *application) newReservation(r *http.Request, user *data.User, input reservationInput, v *validator.Validator) (*data.Reservation, []string, error) {
+	reservation := &data.Reservation{
+		UserID:       user.ID,
+		VehicleID:    input.VehicleID,
+		ParkingLotID: input.ParkingLotID,
+		StartTime:    input.StartTime,
+		EndTime:      input.EndTime,
+		Status:       data.ReservationStatusConfirmed,
+	}
+
+	vehicle, err := app.modelsFor(r).Vehicles.Get(input.VehicleID)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		v.AddError("vehicle_id", "vehicle not found")
+	case err != nil:
+		return nil, nil, err
+	case vehicle.UserID != user.ID:
+		v.AddError("vehicle_id", "vehicle not found")
+	}
+
+	lot, err := app.modelsFor(r).ParkingLots.Get(input.ParkingLotID)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		v.AddError("parking_lot_id", "parking lot not found")
+	case err != nil:
+		return nil, nil, err
+	case !lot.IsActive:
+		v.AddError("parking_lot_id", "parking lot is not active")
+	default:
+		data.ValidateReservationWindow(v, lot, input.StartTime, input.EndTime)
+		data.ValidateReservationLimits(v, lot, input.StartTime, input.EndTime, time.Now())
+		reservation.TotalAmount = lot.PriceFor(input.StartTime, input.EndTime)
+		if vehicle != nil {
+			reservation.ApplyVehicleType(lot, vehicle.VehicleType)
+		}
+	}
+
+	// A quote token still valid for the same booking is honored at its price,
+	// even if the lot's rates or the promo code changed since. Otherwise the
+	// booking is priced afresh.
+	locked := false
+	if input.QuoteToken != nil && lot != nil && vehicle != nil {
+		quote, err := data.VerifyQuote(app.config.quotes.signingKey, *input.QuoteToken, time.Now())
+		if err == nil && quote.Covers(lot.ID, input.StartTime, input.EndTime, vehicle.VehicleType, input.PromoCode) {
+			// Points are spent before tax, which the quote has already added
+			v.Check(input.RedeemPoints == nil, "redeem_points", "cannot be combined with a quote token")
+			reservation.ApplyQuote(quote)
+			locked = true
+		}
+	}
+
+	if input.PromoCode != nil && !locked {
+		promo, err := app.modelsFor(r).PromoCodes.Validate(*input.PromoCode, time.Now())
+		switch {
+		case err == nil:
+			reservation.ApplyPromo(promo)
+		case promoCodeMessage(err) != "":
+			v.AddError("promo_code", promoCodeMessage(err))
+		default:
+			return nil, nil, err
+		}
+	}
+
+	if input.RedeemPoints != nil && !locked {
+		balance, err := app.modelsFor(r).Loyalty.GetBalance(user.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		v.Check(*input.RedeemPoints > 0, "redeem_points", "must be greater than zero")
+		v.Check(*input.RedeemPoints <= balance, "redeem_points", "must not be more than your loyalty points balance")
+
+		// Points go toward what's left after any promo discount
+		reservation.ApplyPoints(*input.RedeemPoints)
+	}
+
+	if lot != nil && !locked {
+		reservation.ApplyCharges(lot)
+	}
+
+	if input.SpotType != nil {
+		v.Check(validator.PermittedValue(*input.SpotType, data.SpotTypes...), "spot_type", "must be a valid spot type")
+		v.Check(user.CanUseSpotType(*input.SpotType), "spot_type", "requires a verified disability permit")
+	}
+
+	if data.ValidateReservation(v, reservation); !v.Valid() {
+		return reservation, nil, nil
+	}
+
+	// Without an explicit spot type the vehicle's preference decides, skipping
+	// spot types the user isn't eligible for
+	spotTypes := user.EligibleSpotTypes(vehicle.SpotTypePreference())
+	if input.SpotType != nil {
+		spotTypes = []string{*input.SpotType}
+	}
+
+	return reservation, spotTypes, nil
+}
+
+// Create a reservation for the authenticated user
+func (app *application) createReservationHandler(w http.ResponseWriter, r *http.Request) {
+	var input reservationInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	v := validator.New()
+
+	reservation, spotTypes, err := app.newReservation(r, user, input, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.HeldSpotID != nil {
+		belongs, err := app.modelsFor(r).ParkingSpots.BelongsToLot(*input.HeldSpotID, reservation.ParkingLotID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		v.Check(belongs, "held_spot_id", "must be a spot at this parking lot")
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		// Holding a spot doesn't stop the owner taking it out of service
+		spot, err := app.modelsFor(r).ParkingSpots.Get(*input.HeldSpotID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		hold, err := app.modelsFor(r).ParkingSpots.GetHold(*input.HeldSpotID)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		v.Check(spot.IsActive, "held_spot_id", "spot is not active")
+		v.Check(hold != nil && hold.UserID == user.ID && hold.Active(time.Now()), "held_spot_id", "must be a spot you currently hold at this parking lot")
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		free, err := app.modelsFor(r).ParkingSpots.IsFreeForWindow(hold.ParkingSpotID, reservation.StartTime, reservation.EndTime)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !free {
+			app.noSpotAvailableResponse(w, r)
+			return
+		}
+
+		reservation.ParkingSpotID = &hold.ParkingSpotID
+	}
+
+	if reservation.ParkingSpotID != nil {
+		err = app.modelsFor(r).Reservations.Insert(reservation)
+	} else {
+		var lot *data.ParkingLot
+		lot, err = app.modelsFor(r).ParkingLots.Get(reservation.ParkingLotID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// The spot is picked as the booking is saved. Overbooked lots take the
+		// booking without a spot when none is free, which is then assigned on
+		// arrival.
+		err = app.modelsFor(r).Reservations.InsertWithFreeSpot(reservation, spotTypes, lot.AllowsOverbooking())
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrPromoCodeExhausted):
+			v.AddError("promo_code", promoCodeMessage(err))
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrInsufficientPoints):
+			v.AddError("redeem_points", "must not be more than your loyalty points balance")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrNoSpotAvailable), errors.Is(err, data.ErrSpotUnavailable):
+			app.noSpotAvailableResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The booking now protects the spot, so the hold's timeout no longer matters.
+	// Failing to clear it only delays the release until the hold lapses.
+	if input.HeldSpotID != nil {
+		err = app.modelsFor(r).ParkingSpots.ReleaseHold(*input.HeldSpotID, user.ID)
+		if err != nil {
+			app.logError(r, err)
+		}
+	}
+
+	app.publishLotEvent(reservation.ParkingLotID, data.WebhookEventReservationCreated, reservation)
+
+	app.background(func() {
+		err := app.sendSMS(reservation.UserID, fmt.Sprintf("Your reservation on %s is confirmed.", reservation.StartTime.Format("Mon 2 Jan 15:04")))
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	env := envelope{"reservation": reservation}
+
+	// The reservation stands even if the pass can't be issued now; the driver
+	// can fetch one later from the pass endpoint.
+	pass, err := app.qrService().GenerateReservationPass(reservation)
+	if err != nil {
+		app.logError(r, err)
+	} else {
+		env["pass"] = pass
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Create several reservations at once. Each item succeeds or fails on its own
+// and the response reports the outcome per item, in request order.
+func (app *application) createReservationBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Reservations []reservationInput `json:"reservations"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.Reservations) > 0, "reservations", "must contain at least one reservation")
+	v.Check(len(input.Reservations) <= data.MaxBatchReservations, "reservations", fmt.Sprintf("must not contain more than %d reservations", data.MaxBatchReservations))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	type itemResult struct {
+		Index       int               `json:"index"`
+		Status      string            `json:"status"` // created or failed
+		Reservation *data.Reservation `json:"reservation,omitempty"`
+		Reason      string            `json:"reason,omitempty"`
+		Errors      map[string]string `json:"errors,omitempty"`
+	}
+
+	user := app.contextGetUser(r)
+	results := make([]itemResult, len(input.Reservations))
+
+	var items []*data.BatchReservation
+	var indexes []int
+
+	for i, itemInput := range input.Reservations {
+		results[i].Index = i
+
+		itemV := validator.New()
+		itemV.Check(itemInput.HeldSpotID == nil, "held_spot_id", "cannot be used in a batch booking")
+		reservation, spotTypes, err := app.newReservation(r, user, itemInput, itemV)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !itemV.Valid() {
+			results[i].Status = "failed"
+			results[i].Reason = "validation failed"
+			results[i].Errors = itemV.Errors
+			continue
+		}
+
+		items = append(items, &data.BatchReservation{Reservation: reservation, SpotTypes: spotTypes})
+		indexes = append(indexes, i)
+	}
+
+	err = app.modelsFor(r).Reservations.BatchInsert(items)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	created := 0
+	for n, item := range items {
+		result := &results[indexes[n]]
+
+		switch {
+		case item.Err == nil:
+			result.Status = "created"
+			result.Reservation = item.Reservation
+			created++
+
+			app.publishLotEvent(item.Reservation.ParkingLotID, data.WebhookEventReservationCreated, item.Reservation)
+
+			_, err := app.qrService().GenerateReservationPass(item.Reservation)
+			if err != nil {
+				app.logError(r, err)
+			}
+		case errors.Is(item.Err, data.ErrNoSpotAvailable):
+			result.Status = "failed"
+			result.Reason = "no parking spot is available for this time"
+		case errors.Is(item.Err, data.ErrPromoCodeExhausted):
+			result.Status = "failed"
+			result.Reason = "the promo code " + promoCodeMessage(item.Err)
+		case errors.Is(item.Err, data.ErrInsufficientPoints):
+			result.Status = "failed"
+			result.Reason = "not enough loyalty points are left for this reservation"
+		default:
+			app.logError(r, item.Err)
+			result.Status = "failed"
+			result.Reason = "the reservation could not be created"
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{
+		"results": results,
+		"created": created,
+		"failed":  len(results) - created,
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// promoCodeMessage describes why a promo code was rejected, or returns an empty
+// string when err isn't a promo code problem.
+func promoCodeMessage(err error) string {
+	switch {
+	case errors.Is(err, data.ErrPromoCodeInvalid):
+		return "is not a valid promo code"
+	case errors.Is(err, data.ErrPromoCodeNotYetValid):
+		return "is not valid yet"
+	case errors.Is(err, data.ErrPromoCodeExpired):
+		return "has expired"
+	case errors.Is(err, data.ErrPromoCodeExhausted):
+		return "has reached its usage limit"
+	default:
+		return ""
+	}
+}
+
+// Get all reservations for the authenticated user
+func (app *application) listReservationsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-start_time")
+	input.Filters.SortSafelist = []string{"start_time", "created_at", "total_amount", "-start_time", "-created_at", "-total_amount"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	reservations, metadata, err := app.modelsFor(r).Reservations.GetAllForUser(user.ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reservations": reservations, "metadata": app.withPageLinks(r, metadata)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get a specific reservation by ID
+func (app *application) showReservationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	reservation, err := app.modelsFor(r).Reservations.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if reservation.UserID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reservation": reservation}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Cancel a pending or confirmed reservation
+func (app *application) cancelReservationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	reservation, err := app.modelsFor(r).Reservations.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if reservation.UserID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.modelsFor(r).Reservations.Cancel(reservation.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrInvalidTransition):
+			app.invalidTransitionResponse(w, r, err)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.modelsFor(r).QRCodes.DeactivateForReservation(reservation.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	reservation.Status = data.ReservationStatusCancelled
+	app.publishLotEvent(reservation.ParkingLotID, data.WebhookEventReservationCancelled, reservation)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "reservation successfully cancelled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Give an upcoming confirmed reservation to another user, identified by email.
+// The recipient needs a vehicle of the same type as the booked one; it is
+// swapped in for the old owner's vehicle. Both users are notified.
+func (app *application) transferReservationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	recipient, err := app.modelsFor(r).Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "no user with this email address exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	v.Check(recipient.ID != user.ID, "email", "must belong to another user")
+	v.Check(recipient.Activated, "email", "must belong to an activated account")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.modelsFor(r).Reservations.Transfer(id, user.ID, recipient.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrReservationNotOwned):
+			app.notPermittedResponse(w, r)
+		case errors.Is(err, data.ErrReservationNotTransferable):
+			v.AddError("status", "only upcoming confirmed reservations can be transferred")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrNoCompatibleVehicle):
+			v.AddError("email", "recipient has no vehicle of the reserved type")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrNotEligibleForSpot):
+			v.AddError("email", "recipient is not eligible for the reserved spot")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	reservation, err := app.modelsFor(r).Reservations.Get(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	details := fmt.Sprintf(`{"reservation_id":%q}`, reservation.ID)
+	start := reservation.StartTime.Format("Mon 2 Jan 15:04")
+
+	notifications := []*data.Notification{
+		{
+			UserID:  user.ID,
+			Type:    data.NotificationTypeReservationTransfer,
+			Title:   "Reservation transferred",
+			Message: fmt.Sprintf("Your reservation for %s was transferred to %s.", start, recipient.Email),
+			Data:    &details,
+		},
+		{
+			UserID:  recipient.ID,
+			Type:    data.NotificationTypeReservationTransfer,
+			Title:   "Reservation received",
+			Message: fmt.Sprintf("%s transferred their reservation for %s to you.", user.Email, start),
+			Data:    &details,
+		},
+	}
+
+	for _, notification := range notifications {
+		err = app.modelsFor(r).Notifications.Insert(notification)
+		if err != nil {
+			app.logError(r, err)
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reservation": reservation}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Show a lot's hourly, daily and monthly rates. An optional promo_code is
+// validated and its discount reflected in the effective rates.
+func (app *application) showParkingLotPricingHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	pricing, err := app.modelsFor(r).ParkingLots.GetPricing(lotID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if code := r.URL.Query().Get("promo_code"); code != "" {
+		v := validator.New()
+
+		promo, err := app.modelsFor(r).PromoCodes.Validate(code, time.Now())
+		switch {
+		case err == nil:
+			pricing.ApplyPromo(promo)
+		case promoCodeMessage(err) != "":
+			v.AddError("promo_code", promoCodeMessage(err))
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"pricing": pricing}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Price a reservation window at a lot without booking it
+func (app *application) quoteParkingLotHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	start, err := time.Parse(time.RFC3339, qs.Get("start_time"))
+	v.Check(err == nil, "start_time", "must be an RFC 3339 timestamp")
+	end, err := time.Parse(time.RFC3339, qs.Get("end_time"))
+	v.Check(err == nil, "end_time", "must be an RFC 3339 timestamp")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	v.Check(end.After(start), "end_time", "must be after start time")
+
+	lot, err := app.modelsFor(r).ParkingLots.Get(lotID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data.ValidateReservationWindow(v, lot, start, end)
+	data.ValidateReservationLimits(v, lot, start, end, time.Now())
+
+	quote := lot.Quote(start, end)
+
+	if vehicleType := qs.Get("vehicle_type"); vehicleType != "" {
+		v.Check(validator.PermittedValue(vehicleType, data.VehicleTypes...), "vehicle_type", "must be a valid vehicle type")
+		quote.ApplyVehicleType(lot, vehicleType)
+	}
+
+	if code := qs.Get("promo_code"); code != "" {
+		promo, err := app.modelsFor(r).PromoCodes.Validate(code, time.Now())
+		switch {
+		case err == nil:
+			quote.ApplyPromo(promo)
+		case promoCodeMessage(err) != "":
+			v.AddError("promo_code", promoCodeMessage(err))
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	quote.ApplyCharges(lot)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	env := envelope{"quote": quote}
+
+	// Bookings are priced for their vehicle's type, so only quotes for a
+	// vehicle type can be locked in
+	if quote.VehicleType != "" {
+		expiresAt := time.Now().Add(app.config.quotes.ttl)
+
+		token, err := data.SignQuote(app.config.quotes.signingKey, quote, expiresAt)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		env["quote_token"] = token
+		env["quote_expires_at"] = expiresAt
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get the QR pass for a confirmed reservation, issuing one if it has none
+func (app *application) showReservationPassHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	reservation, err := app.modelsFor(r).Reservations.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if reservation.UserID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	v.Check(reservation.Status == data.ReservationStatusConfirmed, "status", "passes are only available for confirmed reservations")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	qrCode, err := app.modelsFor(r).QRCodes.GetActiveForReservation(reservation.ID)
+	switch {
+	case err == nil:
+		err = app.writeJSON(w, http.StatusOK, envelope{"pass": envelope{"qr_code": qrCode, "image_url": qrcode.ImageURL(qrCode.Code, qrcode.FormatPNG)}}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	case !errors.Is(err, data.ErrRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	pass, err := app.qrService().GenerateReservationPass(reservation)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"pass": pass}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+)
+
+func TestCreateReservationBatchSize(t *testing.T) {
+	user := &data.User{ID: uuid.New(), Activated: true}
+
+	item := `{"vehicle_id": "` + uuid.NewString() + `", "parking_lot_id": "` + uuid.NewString() + `"}`
+	items := func(n int) string {
+		return `{"reservations": [` + strings.TrimSuffix(strings.Repeat(item+",", n), ",") + `]}`
+	}
+
+	for name, body := range map[string]string{
+		"empty":     items(0),
+		"too large": items(data.MaxBatchReservations + 1),
+	} {
+		t.Run(name, func(t *testing.T) {
+			app := newTestApplication(t)
+			rr := httptest.NewRecorder()
+
+			app.createReservationBatchHandler(rr, newAuthenticatedRequest(app, http.MethodPost, "/v1/reservations/batch", body, user))
+
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("got status %d; want %d", rr.Code, http.StatusUnprocessableEntity)
+			}
+			if decodeError(t, rr).Fields["reservations"] == "" {
+				t.Error("no error for the reservations field")
+			}
+		})
+	}
+}
+
+func TestShowParkingLotPricing(t *testing.T) {
+	app := newTestDBApplication(t)
+	owner := insertTestUser(t, app)
+	lot, _ := insertTestLot(t, app, owner.ID, 1)
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/parking-lots/"+lot.ID.String()+"/pricing", nil)
+	rr := httptest.NewRecorder()
+	app.showParkingLotPricingHandler(rr, withParams(r, "id", lot.ID.String()))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", rr.Code, http.StatusOK)
+	}
+
+	var body struct {
+		Pricing map[string]any `json:"pricing"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, field := range []string{"daily_rate", "monthly_rate"} {
+		value, present := body.Pricing[field]
+		if !present || value != nil {
+			t.Errorf("got %s %v (present %t); want null", field, value, present)
+		}
+		if body.Pricing[field+"_available"] != false {
+			t.Errorf("got %s_available %v; want false", field, body.Pricing[field+"_available"])
+		}
+	}
+	if body.Pricing["effective_hourly_rate"] != 100.0 {
+		t.Errorf("got effective_hourly_rate %v; want 100", body.Pricing["effective_hourly_rate"])
+	}
+
+	missing := uuid.NewString()
+	rr = httptest.NewRecorder()
+	app.showParkingLotPricingHandler(rr, withParams(httptest.NewRequest(http.MethodGet, "/v1/parking-lots/"+missing+"/pricing", nil), "id", missing))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("unknown lot: got status %d; want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestCreateReservationStopsWhenClientCancels(t *testing.T) {
+	app := newTestDBApplication(t)
+	user := insertTestUser(t, app)
+	lot, _ := insertTestLot(t, app, user.ID, 1)
+	vehicle := insertTestVehicle(t, app, user.ID)
+
+	start := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+	body := fmt.Sprintf(`{"vehicle_id":%q,"parking_lot_id":%q,"start_time":%q,"end_time":%q}`,
+		vehicle.ID, lot.ID, start.Format(time.RFC3339), start.Add(time.Hour).Format(time.RFC3339))
+
+	// The client has already gone away when the handler starts querying
+	r := newAuthenticatedRequest(app, http.MethodPost, "/v1/reservations", body, user)
+	ctx, cancel := context.WithCancel(r.Context())
+	cancel()
+	r = r.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+	app.createReservationHandler(rr, r)
+	app.wg.Wait()
+
+	if rr.Body.Len() != 0 {
+		t.Errorf("wrote a response to a cancelled request: %d %s", rr.Code, rr.Body)
+	}
+
+	var count int
+	err := app.models.Reservations.DB.QueryRow(`SELECT count(*) FROM reservations WHERE user_id = $1`, user.ID).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("cancelled request saved %d reservations", count)
+	}
+
+	// The spot lookup for check-ins stops as well
+	_, err = app.firstAvailableSpot(r, lot.ID, user, vehicle.ID)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("firstAvailableSpot: err = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestTransferReservationHandler(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	owner := insertTestUser(t, app)
+	recipient := insertTestUser(t, app)
+	lot, spots := insertTestLot(t, app, owner.ID, 1)
+	vehicle := insertTestVehicle(t, app, owner.ID)
+	insertTestVehicle(t, app, recipient.ID)
+
+	start := time.Now().Add(24 * time.Hour)
+	reservation := &data.Reservation{
+		UserID:        owner.ID,
+		VehicleID:     vehicle.ID,
+		ParkingLotID:  lot.ID,
+		ParkingSpotID: &spots[0].ID,
+		StartTime:     start,
+		EndTime:       start.Add(time.Hour),
+		Status:        data.ReservationStatusConfirmed,
+	}
+	if err := app.models.Reservations.Insert(reservation); err != nil {
+		t.Fatal(err)
+	}
+
+	transfer := func(from *data.User, email string) *httptest.ResponseRecorder {
+		target := "/v1/reservations/" + reservation.ID.String() + "/transfer"
+		r := newAuthenticatedRequest(app, http.MethodPost, target, fmt.Sprintf(`{"email":%q}`, email), from)
+
+		rr := httptest.NewRecorder()
+		app.transferReservationHandler(rr, withParams(r, "id", reservation.ID.String()))
+		return rr
+	}
+
+	// Someone who doesn't own the reservation can't give it away
+	if rr := transfer(recipient, owner.Email); rr.Code != http.StatusForbidden {
+		t.Errorf("non-owner: status = %d, want %d", rr.Code, http.StatusForbidden)
+	}
+	if rr := transfer(owner, owner.Email); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("transfer to self: status = %d, want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+
+	rr := transfer(owner, recipient.Email)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("transfer: status = %d: %s", rr.Code, rr.Body)
+	}
+
+	var body struct {
+		Reservation data.Reservation `json:"reservation"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Reservation.UserID != recipient.ID {
+		t.Errorf("reservation user = %s, want %s", body.Reservation.UserID, recipient.ID)
+	}
+
+	for _, user := range []*data.User{owner, recipient} {
+		unread, err := app.models.Notifications.GetUnreadCountForUser(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if unread != 1 {
+			t.Errorf("%s has %d notifications, want 1", user.Email, unread)
+		}
+	}
+}
+
+func TestCreateReservationRejectsInactiveLotsAndSpots(t *testing.T) {
+	app := newTestDBApplication(t)
+	app.config.spotHolds.duration = 10 * time.Minute
+
+	user := insertTestUser(t, app)
+	vehicle := insertTestVehicle(t, app, user.ID)
+	lot, spots := insertTestLot(t, app, user.ID, 1)
+	_, otherSpots := insertTestLot(t, app, user.ID, 1)
+	closedLot, _ := insertTestLot(t, app, user.ID, 1)
+
+	_, err := app.models.ParkingLots.DB.Exec(`UPDATE parking_lots SET is_active = false WHERE id = $1`, closedLot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, spot := range []*data.ParkingSpot{spots[0], otherSpots[0]} {
+		if _, err := app.models.ParkingSpots.Hold(spot.ID, user.ID, time.Now().Add(10*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+	book := func(lotID uuid.UUID, heldSpotID *uuid.UUID) map[string]string {
+		t.Helper()
+
+		body := fmt.Sprintf(`{"vehicle_id":%q,"parking_lot_id":%q,"start_time":%q,"end_time":%q`,
+			vehicle.ID, lotID, start.Format(time.RFC3339), start.Add(time.Hour).Format(time.RFC3339))
+		if heldSpotID != nil {
+			body += fmt.Sprintf(`,"held_spot_id":%q`, heldSpotID)
+		}
+		body += "}"
+
+		rr := httptest.NewRecorder()
+		app.createReservationHandler(rr, newAuthenticatedRequest(app, http.MethodPost, "/v1/reservations", body, user))
+		app.wg.Wait()
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("status = %d, want %d: %s", rr.Code, http.StatusUnprocessableEntity, rr.Body)
+		}
+		return decodeError(t, rr).Fields
+	}
+
+	if got := book(closedLot.ID, nil)["parking_lot_id"]; got != "parking lot is not active" {
+		t.Errorf("inactive lot: parking_lot_id error %q", got)
+	}
+
+	if got := book(lot.ID, &otherSpots[0].ID)["held_spot_id"]; got != "must be a spot at this parking lot" {
+		t.Errorf("spot from another lot: held_spot_id error %q", got)
+	}
+
+	// The owner takes the held spot out of service
+	if err := app.models.ParkingSpots.SetStatus(spots[0].ID, data.SpotStatusMaintenance); err != nil {
+		t.Fatal(err)
+	}
+	if got := book(lot.ID, &spots[0].ID)["held_spot_id"]; got != "spot is not active" {
+		t.Errorf("spot in maintenance: held_spot_id error %q", got)
+	}
+}
+
+func TestQuoteTokenLocksInPrice(t *testing.T) {
+	app := newTestDBApplication(t)
+	app.config.quotes.signingKey = []byte("test quote key")
+	app.config.quotes.ttl = 10 * time.Minute
+
+	user := insertTestUser(t, app)
+	lot, _ := insertTestLot(t, app, user.ID, 2)
+	vehicle := insertTestVehicle(t, app, user.ID)
+
+	start := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+	end := start.Add(2 * time.Hour)
+
+	getQuote := func() (*data.Quote, string) {
+		t.Helper()
+
+		target := fmt.Sprintf("/v1/parking-lots/%s/quote?start_time=%s&end_time=%s&vehicle_type=%s",
+			lot.ID, start.Format(time.RFC3339), end.Format(time.RFC3339), vehicle.VehicleType)
+		rr := httptest.NewRecorder()
+		app.quoteParkingLotHandler(rr, withParams(httptest.NewRequest(http.MethodGet, target, nil), "id", lot.ID.String()))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("quote: status = %d: %s", rr.Code, rr.Body)
+		}
+
+		var body struct {
+			Quote      *data.Quote `json:"quote"`
+			QuoteToken string      `json:"quote_token"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.QuoteToken == "" {
+			t.Fatal("quote for a vehicle type has no quote_token")
+		}
+		return body.Quote, body.QuoteToken
+	}
+
+	book := func(token string) *data.Reservation {
+		t.Helper()
+
+		body := fmt.Sprintf(`{"vehicle_id":%q,"parking_lot_id":%q,"start_time":%q,"end_time":%q,"quote_token":%q}`,
+			vehicle.ID, lot.ID, start.Format(time.RFC3339), end.Format(time.RFC3339), token)
+
+		rr := httptest.NewRecorder()
+		app.createReservationHandler(rr, newAuthenticatedRequest(app, http.MethodPost, "/v1/reservations", body, user))
+		app.wg.Wait()
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("booking: status = %d: %s", rr.Code, rr.Body)
+		}
+
+		var created struct {
+			Reservation data.Reservation `json:"reservation"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+			t.Fatal(err)
+		}
+		return &created.Reservation
+	}
+
+	quote, token := getQuote()
+
+	// The rate goes up between the quote and the booking
+	_, err := app.models.ParkingLots.DB.Exec(`UPDATE parking_lots SET hourly_rate = hourly_rate * 3 WHERE id = $1`, lot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requote, _ := getQuote()
+	if requote.TotalAmount <= quote.TotalAmount {
+		t.Fatalf("new quote %s isn't above the old %s", requote.TotalAmount, quote.TotalAmount)
+	}
+
+	if reservation := book(token); reservation.TotalAmount != quote.TotalAmount {
+		t.Errorf("with a valid quote token: total %s; want the quoted %s", reservation.TotalAmount, quote.TotalAmount)
+	}
+
+	// An expired token is ignored and the booking priced afresh
+	expired, err := data.SignQuote(app.config.quotes.signingKey, quote, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reservation := book(expired); reservation.TotalAmount != requote.TotalAmount {
+		t.Errorf("with an expired quote token: total %s; want the current %s", reservation.TotalAmount, requote.TotalAmount)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// List the newest visible reviews across all lots for the homepage, with each
+// lot's name and the author's display name.
+func (app *application) listRecentReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	limit := app.readInt(r.URL.Query(), "limit", 10, v)
+	v.Check(limit > 0 && limit <= data.MaxRecentReviews, "limit", fmt.Sprintf("must be between 1 and %d", data.MaxRecentReviews))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	reviews, err := app.modelsFor(r).Reviews.GetRecent(limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reviews": reviews}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get the visible reviews for a parking lot. Authors are shown by display name,
+// never by user ID or email.
+func (app *application) listParkingLotReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"id", "rating", "created_at", "-id", "-rating", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Make sure the lot exists so an unknown ID is a 404 rather than an empty list
+	_, err = app.modelsFor(r).ParkingLots.Get(lotID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	reviews, metadata, err := app.modelsFor(r).Reviews.GetByLotWithAuthors(lotID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSONWithETag(w, r, http.StatusOK, envelope{"reviews": reviews, "metadata": app.withPageLinks(r, metadata)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// List reviews across all lots for moderation, including hidden ones (admin only).
+// Pass flagged=true to see the reviews users have reported.
+func (app *application) listReviewsForModerationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Hidden  *bool
+		Flagged *bool
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Hidden = app.readBool(qs, "hidden", v)
+	input.Flagged = app.readBool(qs, "flagged", v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"rating", "created_at", "-rating", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	reviews, metadata, err := app.modelsFor(r).Reviews.GetForModeration(input.Hidden, input.Flagged, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reviews": reviews, "metadata": app.withPageLinks(r, metadata)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Hide or unhide several reviews at once (admin only)
+func (app *application) moderateReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ReviewIDs []uuid.UUID `json:"review_ids"`
+		Hidden    *bool       `json:"hidden"`
+		Reason    *string     `json:"reason"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.ReviewIDs) > 0, "review_ids", "must contain at least one review ID")
+	v.Check(len(input.ReviewIDs) <= 100, "review_ids", "must not contain more than 100 review IDs")
+	v.Check(validator.Unique(input.ReviewIDs), "review_ids", "must not contain duplicate values")
+	v.Check(input.Hidden != nil, "hidden", "must be provided")
+	if input.Reason != nil {
+		v.Check(len(*input.Reason) <= 255, "reason", "must not be more than 255 characters long")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	updated, err := app.modelsFor(r).Reviews.ModerateBulk(input.ReviewIDs, *input.Hidden, input.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"updated": updated}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Report a review as inappropriate. Once a review collects enough reports it is
+// flagged for admins and, if configured, hidden straight away.
+func (app *application) reportReviewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Reason != "", "reason", "must be provided")
+	v.Check(len(input.Reason) <= 500, "reason", "must not be more than 500 characters long")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	review, err := app.modelsFor(r).Reviews.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if review.UserID == user.ID {
+		v.AddError("review", "you cannot report your own review")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.modelsFor(r).Reviews.Report(review.ID, user.ID, input.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateReport):
+			v.AddError("review", "you have already reported this review")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	count, err := app.modelsFor(r).Reviews.GetReportCount(review.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	threshold := app.config.reviews.reportThreshold
+	if threshold > 0 && count >= threshold && !review.IsHidden {
+		if app.config.reviews.autoHide {
+			reason := fmt.Sprintf("automatically hidden after %d reports", count)
+			err = app.modelsFor(r).Reviews.Moderate(review.ID, true, &reason)
+		} else if !review.IsFlagged {
+			err = app.modelsFor(r).Reviews.Flag(review.ID)
+		}
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"message": "review reported"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
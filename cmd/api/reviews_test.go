@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+)
+
+func TestReportReviewThreshold(t *testing.T) {
+	tests := []struct {
+		name       string
+		autoHide   bool
+		wantFlag   bool
+		wantHidden bool
+	}{
+		{"flags for admins", false, true, false},
+		{"hides when configured", true, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestDBApplication(t)
+			app.config.reviews.reportThreshold = 2
+			app.config.reviews.autoHide = tt.autoHide
+
+			owner := insertTestUser(t, app)
+			author := insertTestUser(t, app)
+			lot, _ := insertTestLot(t, app, owner.ID, 1)
+
+			review := &data.Review{UserID: author.ID, ParkingLotID: lot.ID, Rating: 1}
+			if err := app.models.Reviews.Insert(review); err != nil {
+				t.Fatal(err)
+			}
+
+			report := func(user *data.User) int {
+				t.Helper()
+				rr := httptest.NewRecorder()
+				r := newAuthenticatedRequest(app, http.MethodPost, "/v1/reviews/"+review.ID.String()+"/report", `{"reason": "spam"}`, user)
+				app.reportReviewHandler(rr, withParams(r, "id", review.ID.String()))
+				return rr.Code
+			}
+
+			state := func() *data.Review {
+				t.Helper()
+				got, err := app.models.Reviews.Get(review.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return got
+			}
+
+			if code := report(author); code != http.StatusUnprocessableEntity {
+				t.Errorf("reporting your own review: got status %d; want %d", code, http.StatusUnprocessableEntity)
+			}
+
+			first := insertTestUser(t, app)
+			if code := report(first); code != http.StatusCreated {
+				t.Fatalf("first report: got status %d; want %d", code, http.StatusCreated)
+			}
+			if code := report(first); code != http.StatusUnprocessableEntity {
+				t.Errorf("duplicate report: got status %d; want %d", code, http.StatusUnprocessableEntity)
+			}
+			if got := state(); got.IsFlagged || got.IsHidden {
+				t.Fatalf("review acted on below the threshold: flagged %t, hidden %t", got.IsFlagged, got.IsHidden)
+			}
+
+			if code := report(insertTestUser(t, app)); code != http.StatusCreated {
+				t.Fatalf("second report: got status %d; want %d", code, http.StatusCreated)
+			}
+			got := state()
+			if got.IsFlagged != tt.wantFlag || got.IsHidden != tt.wantHidden {
+				t.Errorf("at the threshold: got flagged %t, hidden %t; want %t, %t", got.IsFlagged, got.IsHidden, tt.wantFlag, tt.wantHidden)
+			}
+		})
+	}
+}
+
+func TestListRecentReviewsValidation(t *testing.T) {
+	for _, limit := range []string{"0", "-1", strconv.Itoa(data.MaxRecentReviews + 1), "many"} {
+		app := newTestApplication(t)
+		rr := httptest.NewRecorder()
+
+		app.listRecentReviewsHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/reviews/recent?limit="+limit, nil))
+
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("limit %s: status = %d, want %d", limit, rr.Code, http.StatusUnprocessableEntity)
+			continue
+		}
+		if _, ok := decodeError(t, rr).Fields["limit"]; !ok {
+			t.Errorf("limit %s: limit not flagged", limit)
+		}
+	}
+}
@@ -30,6 +30,45 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodGet, "/v1/users/profile", app.requireActivatedUser(app.getUserProfileHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/users/complete-profile", app.requireActivatedUser(app.completeProfileHandler))
 	router.HandlerFunc(http.MethodPatch, "/v1/users/profile", app.requireActivatedUser(app.updateUserProfileHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", app.requireAuthenticatedUser(app.deleteUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/deletion-token", app.requireAuthenticatedUser(app.createAccountDeletionTokenHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/export", app.requireAuthenticatedUser(app.exportUserDataHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/favorites", app.requireActivatedUser(app.listFavoritesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/reminder-preference", app.requireActivatedUser(app.showReminderPreferenceHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/reminder-preference", app.requireActivatedUser(app.updateReminderPreferenceHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/review-privacy", app.requireActivatedUser(app.showReviewPrivacyHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/review-privacy", app.requireActivatedUser(app.updateReviewPrivacyHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/sms-preference", app.requireActivatedUser(app.showSMSPreferenceHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/sms-preference", app.requireActivatedUser(app.updateSMSPreferenceHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/verify-phone/request", app.requireActivatedUser(app.requestMobileVerificationHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/verify-phone/confirm", app.requireActivatedUser(app.confirmMobileVerificationHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/disability-permit", app.requireActivatedUser(app.submitDisabilityPermitHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/loyalty", app.requireActivatedUser(app.showLoyaltyHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/parking-lots", app.requireActivatedUser(app.listOwnParkingLotsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/calendar-feed-token", app.requireActivatedUser(app.createCalendarFeedTokenHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/calendar-feed-token", app.requireActivatedUser(app.deleteCalendarFeedTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/webhooks", app.requireActivatedUser(app.createWebhookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/webhooks", app.requireActivatedUser(app.listWebhooksHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/webhooks/:id", app.requireActivatedUser(app.deleteWebhookHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/webhooks/:id/test", app.requireActivatedUser(app.testWebhookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/webhooks/:id/deliveries", app.requireActivatedUser(app.listWebhookDeliveriesHandler))
+
+	// Organization routes
+	router.HandlerFunc(http.MethodPost, "/v1/organizations", app.requireActivatedUser(app.createOrganizationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/organizations/me", app.requireActivatedUser(app.showMyOrganizationHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/organizations/invitations", app.requireOrgAdmin(app.inviteOrganizationMemberHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/organizations/invitations/:id/accept", app.requireActivatedUser(app.acceptOrganizationInvitationHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/organizations/members/:id", app.requireOrgAdmin(app.removeOrganizationMemberHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/organizations/reservations", app.requireOrgAdmin(app.listOrganizationReservationsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/organizations/payments", app.requireOrgAdmin(app.listOrganizationPaymentsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/organizations/billing", app.requireOrgAdmin(app.showOrganizationBillingHandler))
+
+	// Notification routes
+	router.HandlerFunc(http.MethodGet, "/v1/notifications", app.requireActivatedUser(app.listNotificationsHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/notifications/:id/read", app.requireActivatedUser(app.markNotificationReadHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/notifications/mark-read", app.requireActivatedUser(app.markNotificationsReadHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/notifications/:id/archive", app.requireActivatedUser(app.archiveNotificationHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/notifications/:id", app.requireActivatedUser(app.deleteNotificationHandler))
 
 	// Vehicle routes (require authentication)
 	router.HandlerFunc(http.MethodPost, "/v1/vehicles", app.requireActivatedUser(app.createVehicleHandler))
@@ -39,12 +78,110 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodDelete, "/v1/vehicles/:id", app.requireActivatedUser(app.deleteVehicleHandler))
 	router.HandlerFunc(http.MethodPut, "/v1/vehicles/:id/set-default", app.requireActivatedUser(app.setDefaultVehicleHandler))
 
+	// Parking lot routes
+	router.HandlerFunc(http.MethodGet, "/v1/parking-lots", app.listParkingLotsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/parking-lots", app.requireActivatedUser(app.createParkingLotHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/parking-lots/:id", app.showParkingLotHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/parking-lots/:id", app.requireActivatedUser(app.updateParkingLotHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/parking-lots/:id", app.requireActivatedUser(app.deleteParkingLotHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/parking-lots/:id/clone", app.requireActivatedUser(app.cloneParkingLotHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/parking-lots/:id/close", app.requireActivatedUser(app.closeParkingLotHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/parking-lots/:id/reviews", app.listParkingLotReviewsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/parking-lots/:id/operators", app.requireActivatedUser(app.listLotOperatorsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/parking-lots/:id/operators", app.requireActivatedUser(app.addLotOperatorHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/parking-lots/:id/operators/:user_id", app.requireActivatedUser(app.removeLotOperatorHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/parking-lots/:id/images", app.listLotImagesHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/parking-lots/:id/images", app.requireActivatedUser(app.uploadLotImageHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/parking-lots/:id/images", app.requireActivatedUser(app.reorderLotImagesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/parking-lots/:id/images/:image_id/primary", app.requireActivatedUser(app.setPrimaryLotImageHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/parking-lots/:id/images/:image_id", app.requireActivatedUser(app.deleteLotImageHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/parking-lots/:id/favorite", app.requireActivatedUser(app.addFavoriteHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/parking-lots/:id/favorite", app.requireActivatedUser(app.removeFavoriteHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/parking-lots/:id/check-in", app.requireActivatedUser(app.scanCheckInHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/parking-lots/:id/gate-scan", app.requireActivatedUser(app.gateScanHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/parking-lots/:id/quote", app.quoteParkingLotHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/parking-lots/:id/pricing", app.showParkingLotPricingHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/parking-lots/:id/spots", app.listParkingSpotsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/parking-lots/:id/spots", app.requireActivatedUser(app.createParkingSpotHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/parking-lots/:id/spots/maintenance", app.requireActivatedUser(app.listMaintenanceSpotsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/parking-lots/:id/spots/maintenance", app.requireActivatedUser(app.bulkParkingSpotMaintenanceHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/parking-lots/:id/check-in-trend", app.requireActivatedUser(app.showCheckInTrendHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/parking-lots/:id/duration-histogram", app.requireActivatedUser(app.showDurationHistogramHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/parking-lots/:id/dashboard", app.requireActivatedUser(app.showLotDashboardHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/parking-lots/:id/revenue", app.requireActivatedUser(app.showLotRevenueHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/parking-lots/:id/revenue-forecast", app.requireActivatedUser(app.showLotRevenueForecastHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/parking-lots/:id/unpaid-reservations", app.requireActivatedUser(app.listUnpaidReservationsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/parking-lots/:id/sessions", app.requireActivatedUser(app.listLotSessionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/parking-lots/:id/active", app.requireActivatedUser(app.listParkedVehiclesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/parking-lots/:id/violations", app.requireActivatedUser(app.listLotViolationsHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/parking-spots/:id/status", app.requireActivatedUser(app.updateParkingSpotStatusHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/parking-spots/:id/qr", app.requireActivatedUser(app.showParkingSpotQRHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/parking-spots/:id/hold", app.requireActivatedUser(app.holdParkingSpotHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/parking-spots/:id/hold", app.requireActivatedUser(app.releaseParkingSpotHoldHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/parking-sessions", app.requireActivatedUser(app.listParkingSessionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/parking-sessions/:id/top-up", app.requireActivatedUser(app.topUpParkingSessionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/parking-sessions/:id/violation", app.requireActivatedUser(app.markViolationHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/parking-sessions/:id/resolve-violation", app.requireActivatedUser(app.resolveViolationHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/parking-sessions/:id/charging/start", app.requireActivatedUser(app.startChargingHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/parking-sessions/:id/charging/stop", app.requireActivatedUser(app.stopChargingHandler))
+
+	// Reservation routes (require authentication)
+	router.HandlerFunc(http.MethodPost, "/v1/reservations", app.requireActivatedUser(app.createReservationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/reservations", app.requireActivatedUser(app.listReservationsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/reservations/:id", app.requireActivatedUser(app.showReservationHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/reservations/:id", app.requireActivatedUser(app.cancelReservationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/reservations/:id/pass", app.requireActivatedUser(app.showReservationPassHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/reservations/:id/check-in", app.requireActivatedUser(app.checkInReservationHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/reservations/:id/check-out", app.requireActivatedUser(app.checkOutReservationHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/reservations/:id/transfer", app.requireActivatedUser(app.transferReservationHandler))
+
+	// Discovery routes. These can't live under /v1/parking-lots/ because the
+	// router doesn't allow static segments next to the :id wildcard.
+	router.HandlerFunc(http.MethodGet, "/v1/discover/top-rated", app.listTopRatedParkingLotsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/discover/popular", app.listPopularParkingLotsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/discover/autocomplete", app.autocompleteParkingLotsHandler)
+
+	// The calendar feed can't be /v1/users/:id/reservations.ics for the same
+	// reason. It is authenticated by the token in its query string.
+	router.HandlerFunc(http.MethodGet, "/v1/feeds/:id/reservations.ics", app.reservationCalendarFeedHandler)
+
+	// Batch booking sits outside /v1/reservations/ for the same reason
+	router.HandlerFunc(http.MethodPost, "/v1/batch/reservations", app.requireActivatedUser(app.createReservationBatchHandler))
+
+	// Recurring reservation routes (require authentication)
+	router.HandlerFunc(http.MethodPost, "/v1/recurring-reservations", app.requireActivatedUser(app.createRecurringReservationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/recurring-reservations", app.requireActivatedUser(app.listRecurringReservationsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/recurring-reservations/:id", app.requireActivatedUser(app.cancelRecurringReservationHandler))
+
+	// Payment gateway callbacks, authenticated by their signature
+	router.HandlerFunc(http.MethodPost, "/v1/webhooks/payments/:provider", app.paymentGatewayWebhookHandler)
+
+	// Review routes
+	router.HandlerFunc(http.MethodGet, "/v1/reviews/recent", app.listRecentReviewsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/reviews/:id/report", app.requireActivatedUser(app.reportReviewHandler))
+
+	// Admin routes
+	router.HandlerFunc(http.MethodGet, "/v1/admin/parking-lots/spot-mismatches", app.requireAdmin(app.listSpotCountMismatchesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/parking-lots/import", app.requireAdmin(app.importParkingLotsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/reviews", app.requireAdmin(app.listReviewsForModerationHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/reviews/moderate", app.requireAdmin(app.moderateReviewsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/promo-codes", app.requireAdmin(app.createPromoCodeHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/promo-codes", app.requireAdmin(app.listPromoCodesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/email-templates", app.requireAdmin(app.listEmailTemplatesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/email-templates/:name/preview", app.requireAdmin(app.previewEmailTemplateHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/payments", app.requireAdmin(app.listPaymentsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/emails", app.requireAdmin(app.listOutboxEmailsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/emails/:id/retry", app.requireAdmin(app.retryOutboxEmailHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/disability-permit", app.requireAdmin(app.verifyDisabilityPermitHandler))
+
 	//router.HandlerFunc(http.MethodGet, "/v1/profiles/:username", app.requirePermission("ideas:read", app.getProfileByUsernameHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/qr-codes/generate", app.requireActivatedUser(app.generateQRCodeHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/qr-codes/verify", app.verifyQRCodeHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/qr-codes/check-in", app.requireActivatedUser(app.spotCheckInHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/qr-codes", app.requireActivatedUser(app.getUserQRCodesHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/qr-images/:filename", app.serveQRImageHandler)
-	return app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router))))
+	return app.requestID(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router)))))
 
 }
@@ -0,0 +1,1121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/qrcode"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// startParkingSession parks a vehicle in a spot. It refuses to start a second
+// session for a vehicle that is already parked, returning
+// data.ErrVehicleAlreadyParked; the partial unique index on parking_sessions
+// catches the same case if two check-ins race. The spot is claimed before the
+// session is saved, so two vehicles racing for the same spot get
+// data.ErrEditConflict instead of sharing it. Its queries aren't bound to the
+// request, so a client disconnecting can't leave a spot claimed without its
+// session.
+func (app *application) startParkingSession(session *data.ParkingSession) error {
+	_, err := app.models.ParkingSessions.GetActiveByVehicle(session.VehicleID)
+	switch {
+	case err == nil:
+		return data.ErrVehicleAlreadyParked
+	case !errors.Is(err, data.ErrRecordNotFound):
+		return err
+	}
+
+	err = app.models.ParkingSpots.SetOccupied(session.ParkingSpotID, true)
+	if err != nil {
+		return err
+	}
+
+	session.Status = data.SessionStatusActive
+
+	err = app.models.ParkingSessions.Insert(session)
+	if err != nil {
+		// Give the spot back so it isn't left occupied without a session
+		if releaseErr := app.models.ParkingSpots.SetOccupied(session.ParkingSpotID, false); releaseErr != nil {
+			app.logger.PrintError(releaseErr, map[string]string{"parking_spot_id": session.ParkingSpotID.String()})
+		}
+		return err
+	}
+
+	return nil
+}
+
+// errNoSpotAvailable is returned by checkInReservation when the reservation has
+// no spot assigned and the lot is full.
+var errNoSpotAvailable = errors.New("no spot available")
+
+// firstAvailableSpot returns the first free spot in the lot for the user's
+// vehicle, trying its preferred spot type before regular spots. Spot types the
+// user isn't eligible for are skipped.
+func (app *application) firstAvailableSpot(r *http.Request, lotID uuid.UUID, user *data.User, vehicleID uuid.UUID) (*data.ParkingSpot, error) {
+	vehicle, err := app.modelsFor(r).Vehicles.Get(vehicleID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, spotType := range user.EligibleSpotTypes(vehicle.SpotTypePreference()) {
+		spots, err := app.modelsFor(r).ParkingSpots.GetAvailableByLot(lotID, spotType)
+		if err != nil {
+			return nil, err
+		}
+		if len(spots) > 0 {
+			return spots[0], nil
+		}
+	}
+
+	return nil, errNoSpotAvailable
+}
+
+// checkInReservation starts the parking session for a confirmed reservation and
+// marks the reservation active, both in one transaction so a failed transition
+// can't leave the vehicle parked. Like startParkingSession, the writes aren't
+// bound to the request.
+func (app *application) checkInReservation(r *http.Request, reservation *data.Reservation) (*data.ParkingSession, error) {
+	// Reservations made without a specific spot get the first free one on arrival
+	spotID := reservation.ParkingSpotID
+	if spotID == nil {
+		owner, err := app.modelsFor(r).Users.Get(reservation.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		spot, err := app.firstAvailableSpot(r, reservation.ParkingLotID, owner, reservation.VehicleID)
+		if err != nil {
+			return nil, err
+		}
+		spotID = &spot.ID
+	}
+
+	now := time.Now()
+
+	session := &data.ParkingSession{
+		ReservationID: &reservation.ID,
+		UserID:        reservation.UserID,
+		VehicleID:     reservation.VehicleID,
+		ParkingSpotID: *spotID,
+		CheckInTime:   now,
+	}
+
+	err := app.models.ParkingSessions.CheckInReservation(session)
+	if err != nil {
+		return nil, err
+	}
+
+	app.publishLotEvent(reservation.ParkingLotID, data.WebhookEventSessionCheckedIn, envelope{"parking_lot_id": reservation.ParkingLotID, "parking_session": session})
+
+	return session, nil
+}
+
+// Check in to a confirmed reservation, as its driver or on their behalf as the
+// lot's owner or an operator
+func (app *application) checkInReservationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	reservation, err := app.modelsFor(r).Reservations.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Besides the driver, the lot's owner and operators can do this for them
+	user := app.contextGetUser(r)
+	if reservation.UserID != user.ID && app.getManagedParkingLot(w, r, reservation.ParkingLotID) == nil {
+		return
+	}
+
+	v := validator.New()
+	v.Check(reservation.Status == data.ReservationStatusConfirmed, "status", "only confirmed reservations can be checked in")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	session, err := app.checkInReservation(r, reservation)
+	if err != nil {
+		switch {
+		case errors.Is(err, errNoSpotAvailable):
+			app.noSpotAvailableResponse(w, r)
+		case errors.Is(err, data.ErrVehicleAlreadyParked):
+			app.vehicleAlreadyParkedResponse(w, r)
+		case errors.Is(err, data.ErrInvalidTransition):
+			app.invalidTransitionResponse(w, r, err)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"parking_session": session}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Admit a reservation at the gate by scanning its reservation pass. Only the lot
+// owner or an operator may do this. The pass must belong to a confirmed reservation at this lot
+// and the reservation's time window must be open.
+func (app *application) gateScanHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Code != "", "code", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	lot := app.getManagedParkingLot(w, r, lotID)
+	if lot == nil {
+		return
+	}
+
+	reservationID, err := app.qrService().VerifyReservationPass(input.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, r, http.StatusNotFound, errCodeNotFound, "QR code not found or revoked")
+		case errors.Is(err, qrcode.ErrQRExpired):
+			app.qrCodeExpiredResponse(w, r)
+		case errors.Is(err, qrcode.ErrQRTampered):
+			v.AddError("code", "is not a valid QR code")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, qrcode.ErrCorruptQRData):
+			app.logError(r, err)
+			v.AddError("code", "could not be read, a new one must be issued")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, qrcode.ErrInvalidPass):
+			v.AddError("code", "is not a valid reservation pass")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	reservation, err := app.modelsFor(r).Reservations.Get(reservationID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, r, http.StatusNotFound, errCodeNotFound, "QR code not found or expired")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v.Check(reservation.ParkingLotID == lot.ID, "code", "is for a reservation at another parking lot")
+	v.Check(reservation.Status == data.ReservationStatusConfirmed, "code", "reservation is not confirmed")
+	if v.Valid() {
+		v.Check(reservation.AdmitsAt(time.Now()), "code", "reservation is not valid at this time")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	session, err := app.checkInReservation(r, reservation)
+	if err != nil {
+		switch {
+		case errors.Is(err, errNoSpotAvailable):
+			app.noSpotAvailableResponse(w, r)
+		case errors.Is(err, data.ErrVehicleAlreadyParked):
+			app.vehicleAlreadyParkedResponse(w, r)
+		case errors.Is(err, data.ErrInvalidTransition):
+			app.invalidTransitionResponse(w, r, err)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"reservation_id": reservation.ID, "parking_session": session}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Check a driver in to a lot by scanning their QR code. Only the lot owner or an
+// operator may do this.
+func (app *application) scanCheckInHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Code          string     `json:"code"`
+		ParkingSpotID *uuid.UUID `json:"parking_spot_id"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Code != "", "code", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	lot := app.getManagedParkingLot(w, r, lotID)
+	if lot == nil {
+		return
+	}
+
+	qrService := app.qrService()
+
+	qrData, err := qrService.VerifyQRCode(input.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, r, http.StatusNotFound, errCodeNotFound, "QR code not found or revoked")
+		case errors.Is(err, qrcode.ErrQRExpired):
+			app.qrCodeExpiredResponse(w, r)
+		case errors.Is(err, qrcode.ErrQRTampered):
+			v.AddError("code", "is not a valid QR code")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, qrcode.ErrCorruptQRData):
+			app.logError(r, err)
+			v.AddError("code", "could not be read, a new one must be issued")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	driver, err := app.modelsFor(r).Users.Get(qrData.UserProfile.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, r, http.StatusNotFound, errCodeNotFound, "QR code not found or expired")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var spot *data.ParkingSpot
+	if input.ParkingSpotID != nil {
+		spot, err = app.modelsFor(r).ParkingSpots.Get(*input.ParkingSpotID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("parking_spot_id", "must be a spot in this lot")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		v.Check(spot.ParkingLotID == lot.ID, "parking_spot_id", "must be a spot in this lot")
+		v.Check(spot.IsActive && !spot.IsOccupied, "parking_spot_id", "must be an available spot")
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = driver.CheckSpotEligibility(spot.SpotType)
+		if err != nil {
+			app.notEligibleForSpotResponse(w, r)
+			return
+		}
+	} else {
+		spot, err = app.firstAvailableSpot(r, lot.ID, driver, qrData.Vehicle.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, errNoSpotAvailable):
+				app.noSpotAvailableResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	session := &data.ParkingSession{
+		UserID:        qrData.UserProfile.ID,
+		VehicleID:     qrData.Vehicle.ID,
+		ParkingSpotID: spot.ID,
+		CheckInTime:   time.Now(),
+	}
+
+	err = app.startParkingSession(session)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrVehicleAlreadyParked):
+			app.vehicleAlreadyParkedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.publishLotEvent(lot.ID, data.WebhookEventSessionCheckedIn, envelope{"parking_lot_id": lot.ID, "parking_session": session})
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"parking_session": session}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Park in a spot by scanning the QR code on its signage. The driver picks which
+// of their vehicles is parking; the spot must be free and of a type they may
+// use.
+func (app *application) spotCheckInHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code      string    `json:"code"`
+		VehicleID uuid.UUID `json:"vehicle_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Code != "", "code", "must be provided")
+	v.Check(input.VehicleID != uuid.Nil, "vehicle_id", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	vehicle, err := app.modelsFor(r).Vehicles.Get(input.VehicleID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("vehicle_id", "must be one of your vehicles")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v.Check(vehicle.UserID == user.ID, "vehicle_id", "must be one of your vehicles")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	lotID, spotID, err := app.qrService().VerifySpotCode(input.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, r, http.StatusNotFound, errCodeNotFound, "QR code not found or revoked")
+		case errors.Is(err, qrcode.ErrQRExpired):
+			app.qrCodeExpiredResponse(w, r)
+		case errors.Is(err, qrcode.ErrQRTampered):
+			v.AddError("code", "is not a valid QR code")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, qrcode.ErrCorruptQRData):
+			app.logError(r, err)
+			v.AddError("code", "could not be read, a new one must be issued")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, qrcode.ErrInvalidSpotCode):
+			v.AddError("code", "is not a valid spot code")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	spot, err := app.modelsFor(r).ParkingSpots.Get(spotID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, r, http.StatusNotFound, errCodeNotFound, "QR code not found or expired")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v.Check(spot.ParkingLotID == lotID, "code", "is not a valid spot code")
+	v.Check(spot.Status == data.SpotStatusActive && !spot.IsOccupied && !spot.IsReserved, "code", "spot is not available")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = user.CheckSpotEligibility(spot.SpotType)
+	if err != nil {
+		app.notEligibleForSpotResponse(w, r)
+		return
+	}
+
+	session := &data.ParkingSession{
+		UserID:        user.ID,
+		VehicleID:     vehicle.ID,
+		ParkingSpotID: spot.ID,
+		CheckInTime:   time.Now(),
+	}
+
+	err = app.startParkingSession(session)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrVehicleAlreadyParked):
+			app.vehicleAlreadyParkedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.publishLotEvent(spot.ParkingLotID, data.WebhookEventSessionCheckedIn, envelope{"parking_lot_id": spot.ParkingLotID, "parking_session": session})
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"parking_session": session}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Check out of an active reservation, as its driver or on their behalf as the
+// lot's owner or an operator. Leaving early on a refundable lot refunds the
+// unused booked time.
+func (app *application) checkOutReservationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	reservation, err := app.modelsFor(r).Reservations.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Besides the driver, the lot's owner and operators can do this for them
+	user := app.contextGetUser(r)
+	if reservation.UserID != user.ID && app.getManagedParkingLot(w, r, reservation.ParkingLotID) == nil {
+		return
+	}
+
+	v := validator.New()
+	v.Check(reservation.Status == data.ReservationStatusActive, "status", "only checked-in reservations can be checked out")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	lot, err := app.modelsFor(r).ParkingLots.Get(reservation.ParkingLotID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	now := time.Now()
+
+	var refund data.Money
+
+	payment, err := app.modelsFor(r).Payments.GetByReservation(reservation.ID)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		// Nothing was paid up front, so there is nothing to refund
+	case err != nil:
+		app.serverErrorResponse(w, r, err)
+		return
+	case payment.Status == data.PaymentStatusCompleted:
+		refund = lot.EarlyCheckoutRefund(reservation.EndTime, now, payment.Amount-payment.RefundedAmount)
+	}
+
+	// Complete the reservation and refund in one transaction. The transition
+	// only succeeds once, so a concurrent or retried checkout stops here instead
+	// of refunding a second time, and a failed refund leaves the reservation
+	// active to be checked out again. From here on the writes aren't bound to
+	// the request, so a client disconnecting can't stop the checkout halfway.
+	err = app.models.Reservations.CheckOutWithRefund(reservation.ID, now, payment, refund)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidTransition):
+			app.invalidTransitionResponse(w, r, err)
+		case errors.Is(err, data.ErrEditConflict), errors.Is(err, data.ErrInvalidRefund):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var checkedOut *data.ParkingSession
+
+	session, err := app.modelsFor(r).ParkingSessions.GetActiveByVehicle(reservation.VehicleID)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+	case err != nil:
+		app.serverErrorResponse(w, r, err)
+		return
+	case session.ReservationID != nil && *session.ReservationID == reservation.ID:
+		err = app.models.ParkingSessions.CheckOut(session.ID, now, (reservation.TotalAmount - refund).Float64())
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// A spot that was already freed, e.g. by the owner, needs no update
+		err = app.models.ParkingSpots.SetOccupied(session.ParkingSpotID, false)
+		if err != nil && !errors.Is(err, data.ErrEditConflict) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		checkedOut = session
+	}
+
+	reservation.Status = data.ReservationStatusCompleted
+	reservation.ActualEndTime = &now
+
+	if checkedOut != nil {
+		checkedOut.Status = data.SessionStatusCompleted
+		checkedOut.CheckOutTime = &now
+		app.publishLotEvent(reservation.ParkingLotID, data.WebhookEventSessionCheckedOut, envelope{"parking_lot_id": reservation.ParkingLotID, "parking_session": checkedOut})
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reservation": reservation, "refund_amount": refund}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Check out every vehicle still parked in a lot, for when it closes for the
+// day. Sessions are charged their closing fee and their spots freed in one go,
+// and each driver is notified. Only the lot owner may do this.
+func (app *application) closeParkingLotHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	lot := app.getOwnedParkingLot(w, r, lotID)
+	if lot == nil {
+		return
+	}
+
+	sessions, err := app.models.ParkingSessions.CheckOutAllInLot(lot, time.Now())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var total float64
+	for _, session := range sessions {
+		total = data.SumMoney(total, *session.TotalAmount)
+	}
+
+	app.background(func() {
+		for _, session := range sessions {
+			app.notifyLotClosed(lot, session)
+		}
+	})
+
+	for _, session := range sessions {
+		app.publishLotEvent(lot.ID, data.WebhookEventSessionCheckedOut, envelope{"parking_lot_id": lot.ID, "parking_session": session})
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"closed_sessions": len(sessions), "total_amount": total, "parking_sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// notifyLotClosed tells a driver their session ended because the lot closed.
+func (app *application) notifyLotClosed(lot *data.ParkingLot, session *data.ParkingSession) {
+	notification := &data.Notification{
+		UserID:  session.UserID,
+		Type:    data.NotificationTypeLotClosed,
+		Title:   "Parking lot closed",
+		Message: fmt.Sprintf("%s has closed and your parking session was checked out. Amount due: %.2f.", lot.Name, *session.TotalAmount),
+	}
+
+	_, err := app.models.Notifications.InsertIfNotExists(notification, data.NotificationDedupKey(notification.Type, session.ID, session.UserID))
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"parking_session_id": session.ID.String()})
+	}
+}
+
+// Prepay more time in an active walk-in session. The prepaid time sets when the
+// session counts as overtime.
+func (app *application) topUpParkingSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Minutes int `json:"minutes"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	session, err := app.modelsFor(r).ParkingSessions.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if session.UserID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Minutes >= 15, "minutes", "must be at least 15")
+	v.Check(input.Minutes <= 24*60, "minutes", "must not be more than 1440")
+	v.Check(session.Status == data.SessionStatusActive, "status", "only active sessions can be topped up")
+	v.Check(session.ReservationID == nil, "reservation_id", "reserved sessions run until the reservation ends")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	spot, err := app.modelsFor(r).ParkingSpots.Get(session.ParkingSpotID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	lot, err := app.modelsFor(r).ParkingLots.Get(spot.ParkingLotID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	amount := lot.TopUpPrice(input.Minutes)
+
+	err = app.models.ParkingSessions.AddPrepaidMinutes(session.ID, input.Minutes, amount)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	session, err = app.modelsFor(r).ParkingSessions.Get(session.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"parking_session": session, "charged_amount": amount}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get the authenticated user's parking session history, with the lot and spot
+// of each session
+func (app *application) listParkingSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-check_in_time")
+	input.Filters.SortSafelist = []string{"check_in_time", "created_at", "total_amount", "-check_in_time", "-created_at", "-total_amount"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	sessions, metadata, err := app.modelsFor(r).ParkingSessions.GetHistoryForUser(user.ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"parking_sessions": sessions, "metadata": app.withPageLinks(r, metadata)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get a lot's parking sessions for its owner or operators, violations first. Sessions can
+// be filtered by status and by check-in date (from and to, inclusive, in the
+// lot's time zone).
+func (app *application) listLotSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	lot := app.getManagedParkingLot(w, r, lotID)
+	if lot == nil {
+		return
+	}
+
+	var input struct {
+		Status string
+		From   *time.Time
+		To     *time.Time
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Status = app.readString(qs, "status", "")
+	if input.Status != "" {
+		v.Check(validator.PermittedValue(input.Status, data.SessionStatusActive, data.SessionStatusCompleted, data.SessionStatusViolated), "status", "must be active, completed or violated")
+	}
+
+	if value := qs.Get("from"); value != "" {
+		from, err := time.ParseInLocation("2006-01-02", value, lot.Location())
+		v.Check(err == nil, "from", "must be a date in YYYY-MM-DD format")
+		input.From = &from
+	}
+	if value := qs.Get("to"); value != "" {
+		to, err := time.ParseInLocation("2006-01-02", value, lot.Location())
+		v.Check(err == nil, "to", "must be a date in YYYY-MM-DD format")
+		// Include the whole of the last day
+		to = to.AddDate(0, 0, 1)
+		input.To = &to
+	}
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-check_in_time")
+	input.Filters.SortSafelist = []string{"check_in_time", "created_at", "total_amount", "-check_in_time", "-created_at", "-total_amount"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.From != nil && input.To != nil {
+		v.Check(input.To.After(*input.From), "to", "must not be before from")
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	sessions, metadata, err := app.modelsFor(r).ParkingSessions.GetDetailsByLot(lot.ID, input.Status, input.From, input.To, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"parking_sessions": sessions, "metadata": app.withPageLinks(r, metadata)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get the vehicles parked in a lot right now, with their plate, make, color and
+// spot, and how many minutes each has been parked. Only the lot owner or an
+// operator may see this.
+func (app *application) listParkedVehiclesHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	lot := app.getManagedParkingLot(w, r, lotID)
+	if lot == nil {
+		return
+	}
+
+	parked, err := app.modelsFor(r).ParkingSessions.GetActiveByLot(lot.ID, time.Now())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"parked_vehicles": parked}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Mark an active session as a violation. Only the owner or an operator of the
+// session's lot may do this. When auto-charging is enabled and the lot has a violation fee, a
+// pending payment for the fee is created. The driver is notified once.
+func (app *application) markViolationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	session, err := app.modelsFor(r).ParkingSessions.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	spot, err := app.modelsFor(r).ParkingSpots.Get(session.ParkingSpotID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	lot := app.getManagedParkingLot(w, r, spot.ParkingLotID)
+	if lot == nil {
+		return
+	}
+
+	var fee float64
+	if app.config.violations.autoCharge && lot.ViolationFee != nil {
+		fee = *lot.ViolationFee
+	}
+
+	payment, err := app.models.ParkingSessions.MarkAsViolation(session.ID, fee)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidTransition):
+			app.invalidTransitionResponse(w, r, err)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	message := fmt.Sprintf("Your parking session at %s, spot %s, was marked as a violation.", lot.Name, spot.SpotNumber)
+	if payment != nil {
+		message += fmt.Sprintf(" A fee of %s has been charged.", payment.Amount)
+	}
+
+	notification := &data.Notification{
+		UserID:  session.UserID,
+		Type:    data.NotificationTypeViolationAlert,
+		Title:   "Parking violation",
+		Message: message,
+	}
+
+	_, err = app.models.Notifications.InsertIfNotExists(notification, data.NotificationDedupKey(notification.Type, session.ID, session.UserID))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	session.Status = data.SessionStatusViolated
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"parking_session": session, "payment": payment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get a lot's violations for its owner or operators, open ones first. resolved=true or
+// resolved=false narrows the list to resolved or open violations.
+func (app *application) listLotViolationsHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	lot := app.getManagedParkingLot(w, r, lotID)
+	if lot == nil {
+		return
+	}
+
+	var input struct {
+		Resolved *bool
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Resolved = app.readBool(qs, "resolved", v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-check_in_time")
+	input.Filters.SortSafelist = []string{"check_in_time", "updated_at", "-check_in_time", "-updated_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	violations, metadata, err := app.modelsFor(r).ParkingSessions.GetViolationsByLot(lot.ID, input.Resolved, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"violations": violations, "metadata": app.withPageLinks(r, metadata)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Resolve a violated session. Only the owner or an operator of the session's
+// lot may do this.
+// With complete set the session is closed, optionally charging a fee.
+func (app *application) resolveViolationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Note     string  `json:"note"`
+		Complete bool    `json:"complete"`
+		Fee      float64 `json:"fee"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	session, err := app.modelsFor(r).ParkingSessions.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	spot, err := app.modelsFor(r).ParkingSpots.Get(session.ParkingSpotID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	lot := app.getManagedParkingLot(w, r, spot.ParkingLotID)
+	if lot == nil {
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	resolution := &data.ViolationResolution{
+		ResolvedBy: &user.ID,
+		Note:       input.Note,
+		Completed:  input.Complete,
+		Fee:        input.Fee,
+	}
+
+	v := validator.New()
+	v.Check(session.Status == data.SessionStatusViolated, "status", "only violated sessions can be resolved")
+	if data.ValidateViolationResolution(v, resolution); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	stillParked := session.CheckOutTime == nil
+
+	// Not bound to the request, so a resolved session can't be left holding its spot
+
+	err = app.models.ParkingSessions.ResolveViolation(session, resolution)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Closing a session that was never checked out frees its spot
+	if resolution.Completed && stillParked {
+		err = app.models.ParkingSpots.SetOccupied(session.ParkingSpotID, false)
+		if err != nil && !errors.Is(err, data.ErrEditConflict) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.publishLotEvent(lot.ID, data.WebhookEventSessionCheckedOut, envelope{"parking_lot_id": lot.ID, "parking_session": session})
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"parking_session": session, "resolution": resolution}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
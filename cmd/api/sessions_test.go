@@ -0,0 +1,605 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/qrcode"
+)
+
+func TestStartParkingSessionRejectsParkedVehicle(t *testing.T) {
+	app := newTestDBApplication(t)
+	user := insertTestUser(t, app)
+	_, spots := insertTestLot(t, app, user.ID, 2)
+	vehicle := insertTestVehicle(t, app, user.ID)
+
+	first := &data.ParkingSession{
+		UserID:        user.ID,
+		VehicleID:     vehicle.ID,
+		ParkingSpotID: spots[0].ID,
+		CheckInTime:   time.Now(),
+	}
+	if err := app.startParkingSession(first); err != nil {
+		t.Fatal(err)
+	}
+
+	second := &data.ParkingSession{
+		UserID:        user.ID,
+		VehicleID:     vehicle.ID,
+		ParkingSpotID: spots[1].ID,
+		CheckInTime:   time.Now(),
+	}
+	err := app.startParkingSession(second)
+	if !errors.Is(err, data.ErrVehicleAlreadyParked) {
+		t.Fatalf("got %v; want ErrVehicleAlreadyParked", err)
+	}
+
+	spot, err := app.models.ParkingSpots.Get(spots[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spot.IsOccupied {
+		t.Error("the rejected check-in left its spot occupied")
+	}
+
+	// The unique index catches a second active session even without the check.
+	second.Status = data.SessionStatusActive
+	err = app.models.ParkingSessions.Insert(second)
+	if !errors.Is(err, data.ErrVehicleAlreadyParked) {
+		t.Errorf("direct insert: got %v; want ErrVehicleAlreadyParked", err)
+	}
+}
+
+func TestGateScan(t *testing.T) {
+	app := newTestDBApplication(t)
+	app.config.qr.signingKey = []byte("test signing key")
+	storage, err := qrcode.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.qrStorage = storage
+
+	owner := insertTestUser(t, app)
+	driver := insertTestUser(t, app)
+	lot, spots := insertTestLot(t, app, owner.ID, 2)
+	vehicle := insertTestVehicle(t, app, driver.ID)
+
+	book := func(spot *data.ParkingSpot, start time.Time) (*data.Reservation, string) {
+		t.Helper()
+		reservation := &data.Reservation{
+			UserID:        driver.ID,
+			VehicleID:     vehicle.ID,
+			ParkingLotID:  lot.ID,
+			ParkingSpotID: &spot.ID,
+			StartTime:     start,
+			EndTime:       start.Add(2 * time.Hour),
+			Status:        data.ReservationStatusConfirmed,
+		}
+		if err := app.models.Reservations.Insert(reservation); err != nil {
+			t.Fatal(err)
+		}
+		pass, err := app.qrService().GenerateReservationPass(reservation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reservation, pass.QRCode.Code
+	}
+
+	scan := func(code string) *httptest.ResponseRecorder {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		r := newAuthenticatedRequest(app, http.MethodPost, "/v1/parking-lots/"+lot.ID.String()+"/gate-scan", `{"code": "`+code+`"}`, owner)
+		app.gateScanHandler(rr, withParams(r, "id", lot.ID.String()))
+		return rr
+	}
+
+	status := func(id uuid.UUID) string {
+		t.Helper()
+		reservation, err := app.models.Reservations.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reservation.Status
+	}
+
+	later, laterCode := book(spots[0], time.Now().Add(3*time.Hour))
+	rr := scan(laterCode)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("out of window scan: got status %d; want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+	if got := decodeError(t, rr).Fields["code"]; got != "reservation is not valid at this time" {
+		t.Errorf("out of window scan: got error %q", got)
+	}
+	if got := status(later.ID); got != data.ReservationStatusConfirmed {
+		t.Errorf("out of window scan changed the reservation to %q", got)
+	}
+
+	now, nowCode := book(spots[1], time.Now().Add(-10*time.Minute))
+	rr = scan(nowCode)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("valid scan: got status %d; want %d", rr.Code, http.StatusCreated)
+	}
+	if got := status(now.ID); got != data.ReservationStatusActive {
+		t.Errorf("valid scan left the reservation %q; want %q", got, data.ReservationStatusActive)
+	}
+
+	rr = scan(nowCode + "x")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("unknown code: got status %d; want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestFirstAvailableSpotPrefersVehicleSpotType(t *testing.T) {
+	app := newTestDBApplication(t)
+	user := insertTestUser(t, app)
+	lot, spots := insertTestLot(t, app, user.ID, 1)
+	regular := spots[0]
+
+	electric := &data.ParkingSpot{ParkingLotID: lot.ID, SpotNumber: "EV1", SpotType: data.SpotTypeElectric, Status: data.SpotStatusActive}
+	if err := app.models.ParkingSpots.Insert(electric); err != nil {
+		t.Fatal(err)
+	}
+
+	preferred := data.SpotTypeElectric
+	vehicle := insertTestVehicle(t, app, user.ID)
+	vehicle.PreferredSpotType = &preferred
+	if err := app.models.Vehicles.Update(vehicle); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+
+	spot, err := app.firstAvailableSpot(r, lot.ID, user, vehicle.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spot.ID != electric.ID {
+		t.Errorf("got spot %s; want the electric spot while it is free", spot.SpotNumber)
+	}
+
+	if err := app.models.ParkingSpots.SetOccupied(electric.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	spot, err = app.firstAvailableSpot(r, lot.ID, user, vehicle.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spot.ID != regular.ID {
+		t.Errorf("got spot %s; want the regular spot once the electric one is taken", spot.SpotNumber)
+	}
+
+	if err := app.models.ParkingSpots.SetOccupied(regular.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := app.firstAvailableSpot(r, lot.ID, user, vehicle.ID); !errors.Is(err, errNoSpotAvailable) {
+		t.Errorf("full lot: got %v; want errNoSpotAvailable", err)
+	}
+}
+
+func TestListLotSessions(t *testing.T) {
+	app := newTestDBApplication(t)
+	owner := insertTestUser(t, app)
+	driver := insertTestUser(t, app)
+	lot, spots := insertTestLot(t, app, owner.ID, 3)
+
+	now := time.Now()
+	active := insertTestSession(t, app, driver.ID, spots[0], now.Add(-time.Hour))
+	completed := insertTestSession(t, app, driver.ID, spots[1], now.Add(-3*time.Hour))
+	violated := insertTestSession(t, app, driver.ID, spots[2], now.Add(-5*time.Hour))
+
+	if err := app.models.ParkingSessions.CheckOut(completed.ID, now.Add(-2*time.Hour), 100); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.models.ParkingSessions.MarkAsViolation(violated.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(user *data.User, query string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := newAuthenticatedRequest(app, http.MethodGet, "/v1/parking-lots/"+lot.ID.String()+"/sessions"+query, "", user)
+		rr := httptest.NewRecorder()
+		app.listLotSessionsHandler(rr, withParams(r, "id", lot.ID.String()))
+		return rr
+	}
+	ids := func(rr *httptest.ResponseRecorder) []uuid.UUID {
+		t.Helper()
+
+		var body struct {
+			Sessions []*data.SessionDetail `json:"parking_sessions"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []uuid.UUID
+		for _, session := range body.Sessions {
+			ids = append(ids, session.ID)
+		}
+		return ids
+	}
+
+	if rr := list(driver, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("not the owner: got status %d; want %d", rr.Code, http.StatusForbidden)
+	}
+
+	rr := list(owner, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("owner: got status %d; want %d", rr.Code, http.StatusOK)
+	}
+	// Violations come first, then the rest newest first.
+	got := ids(rr)
+	want := []uuid.UUID{violated.ID, active.ID, completed.ID}
+	if len(got) != len(want) {
+		t.Fatalf("got %d sessions; want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("session %d: got %s; want %s", i, got[i], want[i])
+		}
+	}
+
+	rr = list(owner, "?status=completed")
+	if got := ids(rr); len(got) != 1 || got[0] != completed.ID {
+		t.Errorf("status=completed: got %v; want only %s", got, completed.ID)
+	}
+
+	if rr := list(owner, "?status=parked"); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("unknown status: got status %d; want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestMarkViolationChargesFeeOnce(t *testing.T) {
+	app := newTestDBApplication(t)
+	owner := insertTestUser(t, app)
+	driver := insertTestUser(t, app)
+	lot, spots := insertTestLot(t, app, owner.ID, 2)
+
+	_, err := app.models.ParkingLots.DB.Exec(`UPDATE parking_lots SET violation_fee = 15 WHERE id = $1`, lot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mark := func(session *data.ParkingSession) *data.Payment {
+		t.Helper()
+
+		r := newAuthenticatedRequest(app, http.MethodPost, "/v1/parking-sessions/"+session.ID.String()+"/violation", "", owner)
+		rr := httptest.NewRecorder()
+		app.markViolationHandler(rr, withParams(r, "id", session.ID.String()))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("got status %d; want %d: %s", rr.Code, http.StatusOK, rr.Body)
+		}
+
+		var body struct {
+			Payment *data.Payment `json:"payment"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return body.Payment
+	}
+	count := func(query string, id uuid.UUID) int {
+		t.Helper()
+
+		var n int
+		if err := app.models.Payments.DB.QueryRow(query, id).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	app.config.violations.autoCharge = true
+	session := insertTestSession(t, app, driver.ID, spots[0], time.Now().Add(-time.Hour))
+
+	payment := mark(session)
+	if payment == nil || payment.Amount != data.MoneyFromFloat(15) || payment.Status != data.PaymentStatusPending || payment.UserID != driver.ID {
+		t.Fatalf("got payment %+v; want a pending 15 fee for the driver", payment)
+	}
+
+	if again := mark(session); again != nil {
+		t.Errorf("marking again: got payment %+v; want none", again)
+	}
+	if n := count(`SELECT count(*) FROM payments WHERE violation_session_id = $1`, session.ID); n != 1 {
+		t.Errorf("got %d fee payments; want 1", n)
+	}
+	if n := count(`SELECT count(*) FROM notifications WHERE user_id = $1 AND type = 'violation_alert'`, driver.ID); n != 1 {
+		t.Errorf("got %d violation alerts; want 1", n)
+	}
+
+	// Without auto-charging, violations are flagged but not charged.
+	app.config.violations.autoCharge = false
+	uncharged := insertTestSession(t, app, driver.ID, spots[1], time.Now().Add(-time.Hour))
+
+	if payment := mark(uncharged); payment != nil {
+		t.Errorf("auto-charging off: got payment %+v; want none", payment)
+	}
+	if n := count(`SELECT count(*) FROM payments WHERE violation_session_id = $1`, uncharged.ID); n != 0 {
+		t.Errorf("auto-charging off: got %d fee payments; want 0", n)
+	}
+}
+
+func TestCloseParkingLotChecksOutEveryone(t *testing.T) {
+	app := newTestDBApplication(t)
+	owner := insertTestUser(t, app)
+	drivers := []*data.User{insertTestUser(t, app), insertTestUser(t, app), insertTestUser(t, app)}
+	lot, spots := insertTestLot(t, app, owner.ID, 3)
+
+	now := time.Now()
+	sessions := make([]*data.ParkingSession, len(drivers))
+	for i, driver := range drivers {
+		sessions[i] = insertTestSession(t, app, driver.ID, spots[i], now.Add(-time.Duration(i+1)*time.Hour))
+	}
+
+	closeLot := func(user *data.User) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := newAuthenticatedRequest(app, http.MethodPost, "/v1/parking-lots/"+lot.ID.String()+"/close", "", user)
+		rr := httptest.NewRecorder()
+		app.closeParkingLotHandler(rr, withParams(r, "id", lot.ID.String()))
+		app.wg.Wait()
+		return rr
+	}
+
+	if rr := closeLot(drivers[0]); rr.Code != http.StatusForbidden {
+		t.Errorf("not the owner: got status %d; want %d", rr.Code, http.StatusForbidden)
+	}
+
+	rr := closeLot(owner)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("owner: got status %d; want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+
+	var body struct {
+		ClosedSessions int `json:"closed_sessions"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.ClosedSessions != len(sessions) {
+		t.Errorf("closed_sessions = %d; want %d", body.ClosedSessions, len(sessions))
+	}
+
+	for i, session := range sessions {
+		stored, err := app.models.ParkingSessions.Get(session.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Status != data.SessionStatusCompleted || stored.TotalAmount == nil {
+			t.Errorf("session %d: status %s, amount %v; want completed and charged", i, stored.Status, stored.TotalAmount)
+		}
+
+		unread, err := app.models.Notifications.GetUnreadCountForUser(drivers[i].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if unread != 1 {
+			t.Errorf("driver %d has %d notifications; want 1", i, unread)
+		}
+	}
+
+	// A second close has nothing left to check out
+	rr = closeLot(owner)
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.ClosedSessions != 0 {
+		t.Errorf("second close: closed_sessions = %d; want 0", body.ClosedSessions)
+	}
+}
+
+func TestFirstAvailableSpotSkipsHandicappedWithoutPermit(t *testing.T) {
+	app := newTestDBApplication(t)
+	user := insertTestUser(t, app)
+	lot, spots := insertTestLot(t, app, user.ID, 1)
+	regular := spots[0]
+
+	handicapped := &data.ParkingSpot{ParkingLotID: lot.ID, SpotNumber: "H1", SpotType: data.SpotTypeHandicapped, Status: data.SpotStatusActive}
+	if err := app.models.ParkingSpots.Insert(handicapped); err != nil {
+		t.Fatal(err)
+	}
+
+	preferred := data.SpotTypeHandicapped
+	vehicle := insertTestVehicle(t, app, user.ID)
+	vehicle.PreferredSpotType = &preferred
+	if err := app.models.Vehicles.Update(vehicle); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+
+	spot, err := app.firstAvailableSpot(r, lot.ID, user, vehicle.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spot.ID != regular.ID {
+		t.Errorf("got spot %s; want the regular spot without a verified permit", spot.SpotNumber)
+	}
+
+	if err := app.models.ParkingSpots.SetOccupied(regular.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.firstAvailableSpot(r, lot.ID, user, vehicle.ID); !errors.Is(err, errNoSpotAvailable) {
+		t.Errorf("only a handicapped spot free: got %v; want errNoSpotAvailable", err)
+	}
+
+	user.HasDisabilityPermit = true
+	spot, err = app.firstAvailableSpot(r, lot.ID, user, vehicle.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spot.ID != handicapped.ID {
+		t.Errorf("got spot %s; want the handicapped spot with a verified permit", spot.SpotNumber)
+	}
+}
+
+func TestSpotQRCheckIn(t *testing.T) {
+	app := newTestDBApplication(t)
+	app.config.qr.signingKey = []byte("test signing key")
+	storage, err := qrcode.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.qrStorage = storage
+
+	owner := insertTestUser(t, app)
+	driver := insertTestUser(t, app)
+	lot, spots := insertTestLot(t, app, owner.ID, 2)
+	vehicle := insertTestVehicle(t, app, driver.ID)
+	spot := spots[1]
+
+	spotQR := func(user *data.User) *httptest.ResponseRecorder {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		r := newAuthenticatedRequest(app, http.MethodGet, "/v1/parking-spots/"+spot.ID.String()+"/qr", "", user)
+		app.showParkingSpotQRHandler(rr, withParams(r, "id", spot.ID.String()))
+		return rr
+	}
+
+	issue := func() string {
+		t.Helper()
+		rr := spotQR(owner)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("spot QR: got status %d: %s", rr.Code, rr.Body)
+		}
+
+		var body struct {
+			QRCode data.QRCode     `json:"qr_code"`
+			QRData data.QRCodeData `json:"qr_data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		info := body.QRData.QRInfo
+		if info.Purpose != data.QRPurposeSpot || info.ParkingLotID == nil || *info.ParkingLotID != lot.ID || info.ParkingSpotID == nil || *info.ParkingSpotID != spot.ID {
+			t.Errorf("spot QR data = %+v; want the spot's lot and ID", info)
+		}
+		if body.QRCode.UserID != nil || body.QRCode.ExpiresAt.Before(time.Now().Add(365*24*time.Hour)) {
+			t.Errorf("spot QR = %+v; want no user and a long validity", body.QRCode)
+		}
+		return body.QRCode.Code
+	}
+
+	code := issue()
+	if again := issue(); again != code {
+		t.Errorf("second request issued %s; want the printed code %s again", again, code)
+	}
+
+	if rr := spotQR(driver); rr.Code != http.StatusForbidden {
+		t.Errorf("spot QR for a non-owner: got status %d; want %d", rr.Code, http.StatusForbidden)
+	}
+
+	scan := func(code string) *httptest.ResponseRecorder {
+		t.Helper()
+		body := `{"code": "` + code + `", "vehicle_id": "` + vehicle.ID.String() + `"}`
+		rr := httptest.NewRecorder()
+		app.spotCheckInHandler(rr, newAuthenticatedRequest(app, http.MethodPost, "/v1/qr-codes/check-in", body, driver))
+		app.wg.Wait()
+		return rr
+	}
+
+	rr := scan(code)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("spot scan: got status %d: %s", rr.Code, rr.Body)
+	}
+
+	var created struct {
+		Session data.ParkingSession `json:"parking_session"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Session.ParkingSpotID != spot.ID || created.Session.VehicleID != vehicle.ID || created.Session.UserID != driver.ID {
+		t.Errorf("session = %+v; want the driver's vehicle in spot %s", created.Session, spot.SpotNumber)
+	}
+
+	stored, err := app.models.ParkingSpots.Get(spot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.IsOccupied {
+		t.Error("scanned spot isn't occupied")
+	}
+
+	// The spot is taken now
+	rr = scan(code)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("scanning an occupied spot: got status %d; want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+
+	// A driver's own QR code doesn't park them anywhere
+	own, err := app.qrService().GenerateQRCode(driver.ID, vehicle.ID, 24, "parking", qrcode.DefaultImageOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = scan(own.QRCode.Code)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("scanning a vehicle code: got status %d; want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestListParkedVehicles(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	owner := insertTestUser(t, app)
+	driver := insertTestUser(t, app)
+	lot, spots := insertTestLot(t, app, owner.ID, 2)
+
+	session := insertTestSession(t, app, driver.ID, spots[1], time.Now().Add(-45*time.Minute))
+	vehicle, err := app.models.Vehicles.Get(session.VehicleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(user *data.User) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r := newAuthenticatedRequest(app, http.MethodGet, "/v1/parking-lots/"+lot.ID.String()+"/active", "", user)
+		app.listParkedVehiclesHandler(rr, withParams(r, "id", lot.ID.String()))
+		return rr
+	}
+
+	if rr := list(driver); rr.Code != http.StatusForbidden {
+		t.Errorf("driver: status = %d, want %d", rr.Code, http.StatusForbidden)
+	}
+
+	rr := list(owner)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("owner: status = %d: %s", rr.Code, rr.Body)
+	}
+
+	var body struct {
+		ParkedVehicles []struct {
+			ID             uuid.UUID `json:"id"`
+			LicensePlate   string    `json:"license_plate"`
+			VehicleMake    string    `json:"vehicle_make"`
+			VehicleColor   string    `json:"vehicle_color"`
+			SpotNumber     string    `json:"spot_number"`
+			ElapsedMinutes int       `json:"elapsed_minutes"`
+		} `json:"parked_vehicles"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.ParkedVehicles) != 1 {
+		t.Fatalf("got %d parked vehicles; want 1", len(body.ParkedVehicles))
+	}
+
+	got := body.ParkedVehicles[0]
+	if got.ID != session.ID || got.LicensePlate != vehicle.LicensePlate || got.VehicleMake != vehicle.Make || got.VehicleColor != vehicle.Color {
+		t.Errorf("got %+v; want session %s with %s %s %s", got, session.ID, vehicle.LicensePlate, vehicle.Make, vehicle.Color)
+	}
+	if got.SpotNumber != spots[1].SpotNumber {
+		t.Errorf("spot number = %q; want %q", got.SpotNumber, spots[1].SpotNumber)
+	}
+	if got.ElapsedMinutes < 45 || got.ElapsedMinutes > 46 {
+		t.Errorf("elapsed minutes = %d; want 45", got.ElapsedMinutes)
+	}
+}
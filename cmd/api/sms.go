@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/sms"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// mobileCodeTTL is how long a mobile verification code can be used.
+const mobileCodeTTL = 10 * time.Minute
+
+// maxActiveMobileCodes caps how many unexpired verification codes a user may
+// have, which limits how many texts they can trigger per mobileCodeTTL.
+const maxActiveMobileCodes = 3
+
+// sendSMS texts body to the user if SMS is configured and they have opted in
+// with a verified number. Otherwise it does nothing.
+func (app *application) sendSMS(userID uuid.UUID, body string) error {
+	if app.sms == nil {
+		return nil
+	}
+
+	preference, err := app.models.Users.GetSMSPreference(userID)
+	if err != nil {
+		return err
+	}
+
+	if !preference.CanReceive() {
+		return nil
+	}
+
+	return app.sms.Send(*preference.MobileNumber, body)
+}
+
+// Get whether the authenticated user receives reservation texts
+func (app *application) showSMSPreferenceHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	preference, err := app.modelsFor(r).Users.GetSMSPreference(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"sms_preference": preference}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Turn reservation texts on or off for the authenticated user. Turning them on
+// needs a verified mobile number.
+func (app *application) updateSMSPreferenceHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Enabled *bool `json:"enabled"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	preference, err := app.modelsFor(r).Users.GetSMSPreference(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Enabled != nil, "enabled", "must be provided")
+	if v.Valid() {
+		v.Check(!*input.Enabled || preference.MobileVerified, "enabled", "requires a verified mobile number")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.modelsFor(r).Users.SetSMSEnabled(user.ID, *input.Enabled)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	preference.Enabled = *input.Enabled
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"sms_preference": preference}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readNormalizedMobileNumber returns the authenticated user's mobile number as
+// stored and in E.164 form. It writes the error response and returns empty
+// strings when the user has no usable number.
+func (app *application) readNormalizedMobileNumber(w http.ResponseWriter, r *http.Request) (string, string) {
+	user := app.contextGetUser(r)
+
+	preference, err := app.modelsFor(r).Users.GetSMSPreference(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return "", ""
+	}
+
+	v := validator.New()
+
+	if preference.MobileNumber == nil || *preference.MobileNumber == "" {
+		v.AddError("mobile_number", "must be set on your profile first")
+		app.failedValidationResponse(w, r, v.Errors)
+		return "", ""
+	}
+
+	normalized, err := sms.NormalizeE164(*preference.MobileNumber, app.config.sms.defaultCountryCode)
+	if err != nil {
+		v.AddError("mobile_number", "must be a valid international phone number, such as +94771234567")
+		app.failedValidationResponse(w, r, v.Errors)
+		return "", ""
+	}
+
+	return *preference.MobileNumber, normalized
+}
+
+// Text a verification code to the authenticated user's mobile number. Any of
+// the user's unexpired codes can confirm it; once maxActiveMobileCodes are out,
+// further requests are refused until the oldest expires.
+func (app *application) requestMobileVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	if app.sms == nil {
+		app.errorResponse(w, r, http.StatusServiceUnavailable, errCodeSMSUnavailable, "text messages are not available")
+		return
+	}
+
+	_, normalized := app.readNormalizedMobileNumber(w, r)
+	if normalized == "" {
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	active, err := app.modelsFor(r).Tokens.CountActive(data.ScopeMobileVerification, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if active >= maxActiveMobileCodes {
+		app.rateLimitExceededResponse(w, r)
+		return
+	}
+
+	code, err := app.modelsFor(r).Tokens.NewCode(user.ID, mobileCodeTTL, data.ScopeMobileVerification, normalized)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.sms.Send(normalized, fmt.Sprintf("Your SpotLinkIO verification code is %s. It expires in %d minutes.", code, int(mobileCodeTTL.Minutes())))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": "a verification code has been sent to " + normalized}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Confirm the authenticated user's mobile number with the code texted to it.
+// The number is saved in E.164 form once verified.
+func (app *application) confirmMobileVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Code != "", "code", "must be provided")
+	v.Check(len(input.Code) == 6, "code", "must be 6 digits long")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	number, normalized := app.readNormalizedMobileNumber(w, r)
+	if normalized == "" {
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	valid, err := app.modelsFor(r).Tokens.CheckCode(user.ID, data.ScopeMobileVerification, normalized, input.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTooManyCodeAttempts):
+			v.AddError("code", "too many incorrect attempts, request a new verification code")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !valid {
+		v.AddError("code", "invalid or expired verification code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.modelsFor(r).Users.VerifyMobileNumber(user.ID, number, normalized)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.modelsFor(r).Tokens.DeleteAllForUser(data.ScopeMobileVerification, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	preference, err := app.modelsFor(r).Users.GetSMSPreference(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"sms_preference": preference}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
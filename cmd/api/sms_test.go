@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/sms"
+)
+
+func TestRequestMobileVerificationWithoutSMS(t *testing.T) {
+	app := newTestApplication(t)
+	user := &data.User{Activated: true}
+
+	rr := httptest.NewRecorder()
+	app.requestMobileVerificationHandler(rr, newAuthenticatedRequest(app, http.MethodPost, "/v1/users/verify-phone/request", "", user))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+	if code := decodeError(t, rr).Code; code != errCodeSMSUnavailable {
+		t.Errorf("error code = %q, want %q", code, errCodeSMSUnavailable)
+	}
+}
+
+func TestMobileVerification(t *testing.T) {
+	app := newTestDBApplication(t)
+	sender := &sms.Mock{}
+	app.sms = sender
+	app.config.sms.defaultCountryCode = "94"
+
+	user := insertTestUser(t, app)
+	_, err := app.models.Users.DB.Exec(`UPDATE users SET mobile_number = '077 123 4567' WHERE id = $1`, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		app.requestMobileVerificationHandler(rr, newAuthenticatedRequest(app, http.MethodPost, "/v1/users/verify-phone/request", "", user))
+		return rr
+	}
+	confirm := func(code string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		app.confirmMobileVerificationHandler(rr, newAuthenticatedRequest(app, http.MethodPost, "/v1/users/verify-phone/confirm", `{"code":"`+code+`"}`, user))
+		return rr
+	}
+
+	if rr := request(); rr.Code != http.StatusAccepted {
+		t.Fatalf("request: status = %d: %s", rr.Code, rr.Body)
+	}
+
+	messages := sender.Messages()
+	if len(messages) != 1 || messages[0].To != "+94771234567" {
+		t.Fatalf("got texts %+v; want one to +94771234567", messages)
+	}
+	match := regexp.MustCompile(`code is (\d{6})`).FindStringSubmatch(messages[0].Body)
+	if match == nil {
+		t.Fatalf("no code in %q", messages[0].Body)
+	}
+	code := match[1]
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	rr := confirm(wrong)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("wrong code: status = %d, want %d", rr.Code, http.StatusUnprocessableEntity)
+	} else if decodeError(t, rr).Fields["code"] == "" {
+		t.Error("wrong code: code not flagged")
+	}
+
+	// Codes outstanding are capped
+	for range maxActiveMobileCodes - 1 {
+		if rr := request(); rr.Code != http.StatusAccepted {
+			t.Fatalf("request: status = %d: %s", rr.Code, rr.Body)
+		}
+	}
+	if rr := request(); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("request past the cap: status = %d, want %d", rr.Code, http.StatusTooManyRequests)
+	}
+
+	rr = confirm(code)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("correct code: status = %d: %s", rr.Code, rr.Body)
+	}
+
+	var body struct {
+		SMSPreference data.SMSPreference `json:"sms_preference"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	preference := body.SMSPreference
+	if !preference.MobileVerified || preference.MobileNumber == nil || *preference.MobileNumber != "+94771234567" {
+		t.Errorf("got %+v; want +94771234567 verified", preference)
+	}
+
+	// The code is used up
+	if rr := confirm(code); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reused code: status = %d, want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+)
+
+// Hold a spot for the authenticated user while they finish booking. The spot
+// stays reserved for the configured hold duration; booking it with
+// held_spot_id clears the hold, otherwise it is released when it lapses.
+// Holding a spot again extends the hold. Handicapped spots can only be held by
+// users with a verified disability permit.
+func (app *application) holdParkingSpotHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	spot, err := app.modelsFor(r).ParkingSpots.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	err = user.CheckSpotEligibility(spot.SpotType)
+	if err != nil {
+		app.notEligibleForSpotResponse(w, r)
+		return
+	}
+
+	hold, err := app.modelsFor(r).ParkingSpots.Hold(id, user.ID, time.Now().Add(app.config.spotHolds.duration))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrSpotUnavailable):
+			app.spotUnavailableResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"hold": hold}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Give up a hold before it lapses.
+func (app *application) releaseParkingSpotHoldHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.modelsFor(r).ParkingSpots.ReleaseHold(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "spot hold successfully released"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+)
+
+func TestBookingHeldSpotClearsHold(t *testing.T) {
+	app := newTestDBApplication(t)
+	app.config.spotHolds.duration = 10 * time.Minute
+
+	user := insertTestUser(t, app)
+	other := insertTestUser(t, app)
+	lot, spots := insertTestLot(t, app, user.ID, 2)
+	vehicle := insertTestVehicle(t, app, user.ID)
+	otherVehicle := insertTestVehicle(t, app, other.ID)
+
+	// Hold the second spot so the booking can't have landed on it by chance
+	spot := spots[1]
+
+	rr := httptest.NewRecorder()
+	r := newAuthenticatedRequest(app, http.MethodPost, "/v1/parking-spots/"+spot.ID.String()+"/hold", "", user)
+	app.holdParkingSpotHandler(rr, withParams(r, "id", spot.ID.String()))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("hold: status = %d: %s", rr.Code, rr.Body)
+	}
+
+	// Someone else can't hold it or book it as their held spot
+	rr = httptest.NewRecorder()
+	r = newAuthenticatedRequest(app, http.MethodPost, "/v1/parking-spots/"+spot.ID.String()+"/hold", "", other)
+	app.holdParkingSpotHandler(rr, withParams(r, "id", spot.ID.String()))
+	if rr.Code != http.StatusConflict {
+		t.Errorf("holding a held spot: status = %d, want %d", rr.Code, http.StatusConflict)
+	}
+
+	start := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+	book := func(booker *data.User, vehicleID string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"vehicle_id":%q,"parking_lot_id":%q,"start_time":%q,"end_time":%q,"held_spot_id":%q}`,
+			vehicleID, lot.ID, start.Format(time.RFC3339), start.Add(time.Hour).Format(time.RFC3339), spot.ID)
+
+		rr := httptest.NewRecorder()
+		app.createReservationHandler(rr, newAuthenticatedRequest(app, http.MethodPost, "/v1/reservations", body, booker))
+		app.wg.Wait()
+		return rr
+	}
+
+	rr = book(other, otherVehicle.ID.String())
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("booking someone else's hold: status = %d, want %d", rr.Code, http.StatusUnprocessableEntity)
+	} else if _, ok := decodeError(t, rr).Fields["held_spot_id"]; !ok {
+		t.Errorf("booking someone else's hold didn't flag held_spot_id")
+	}
+
+	rr = book(user, vehicle.ID.String())
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("booking the held spot: status = %d: %s", rr.Code, rr.Body)
+	}
+
+	var created struct {
+		Reservation data.Reservation `json:"reservation"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Reservation.ParkingSpotID == nil || *created.Reservation.ParkingSpotID != spot.ID {
+		t.Errorf("reservation spot = %v, want the held spot %s", created.Reservation.ParkingSpotID, spot.ID)
+	}
+
+	// The booking replaces the hold, so its timeout is gone
+	_, err := app.models.ParkingSpots.GetHold(spot.ID)
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		t.Errorf("GetHold after booking: err = %v, want %v", err, data.ErrRecordNotFound)
+	}
+	stored, err := app.models.ParkingSpots.Get(spot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.IsReserved {
+		t.Error("spot is still marked reserved by the hold")
+	}
+}
+
+func TestHoldingHandicappedSpotNeedsPermit(t *testing.T) {
+	app := newTestDBApplication(t)
+	app.config.spotHolds.duration = 10 * time.Minute
+
+	user := insertTestUser(t, app)
+	lot, _ := insertTestLot(t, app, user.ID, 0)
+
+	spot := &data.ParkingSpot{ParkingLotID: lot.ID, SpotNumber: "H1", SpotType: data.SpotTypeHandicapped, Status: data.SpotStatusActive}
+	if err := app.models.ParkingSpots.Insert(spot); err != nil {
+		t.Fatal(err)
+	}
+
+	hold := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r := newAuthenticatedRequest(app, http.MethodPost, "/v1/parking-spots/"+spot.ID.String()+"/hold", "", user)
+		app.holdParkingSpotHandler(rr, withParams(r, "id", spot.ID.String()))
+		return rr
+	}
+
+	rr := hold()
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("without a permit: status = %d, want %d", rr.Code, http.StatusForbidden)
+	}
+	if code := decodeError(t, rr).Code; code != errCodeNotEligibleForSpot {
+		t.Errorf("error code = %q, want %q", code, errCodeNotEligibleForSpot)
+	}
+
+	user.HasDisabilityPermit = true
+	if rr := hold(); rr.Code != http.StatusCreated {
+		t.Errorf("with a verified permit: status = %d: %s", rr.Code, rr.Body)
+	}
+}
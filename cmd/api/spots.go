@@ -0,0 +1,436 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/qrcode"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// getOwnedParkingLot loads a lot and checks the authenticated user owns it. It
+// writes the error response itself and returns nil when the caller should stop.
+func (app *application) getOwnedParkingLot(w http.ResponseWriter, r *http.Request, lotID uuid.UUID) *data.ParkingLot {
+	lot, err := app.modelsFor(r).ParkingLots.Get(lotID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	user := app.contextGetUser(r)
+	if lot.OwnerID != user.ID {
+		app.notPermittedResponse(w, r)
+		return nil
+	}
+
+	return lot
+}
+
+// lotRole returns the authenticated user's role in the lot, or an empty string
+// if they have none.
+func (app *application) lotRole(r *http.Request, lot *data.ParkingLot) (string, error) {
+	user := app.contextGetUser(r)
+	if lot.OwnerID == user.ID {
+		return data.LotRoleOwner, nil
+	}
+
+	isOperator, err := app.modelsFor(r).LotOperators.IsOperator(lot.ID, user.ID)
+	if err != nil {
+		return "", err
+	}
+	if isOperator {
+		return data.LotRoleOperator, nil
+	}
+
+	return "", nil
+}
+
+// getManagedParkingLot is getOwnedParkingLot for the day to day running of a
+// lot, which its operators may do as well as its owner.
+func (app *application) getManagedParkingLot(w http.ResponseWriter, r *http.Request, lotID uuid.UUID) *data.ParkingLot {
+	lot, err := app.modelsFor(r).ParkingLots.Get(lotID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	role, err := app.lotRole(r, lot)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil
+	}
+	if role == "" {
+		app.notPermittedResponse(w, r)
+		return nil
+	}
+
+	return lot
+}
+
+// Add a spot to a parking lot. Only the lot owner may do this.
+func (app *application) createParkingSpotHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		SpotNumber string `json:"spot_number"`
+		SpotType   string `json:"spot_type"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	lot := app.getOwnedParkingLot(w, r, lotID)
+	if lot == nil {
+		return
+	}
+
+	spot := &data.ParkingSpot{
+		ParkingLotID: lot.ID,
+		SpotNumber:   input.SpotNumber,
+		SpotType:     input.SpotType,
+		Status:       data.SpotStatusActive,
+	}
+
+	if spot.SpotType == "" {
+		spot.SpotType = "regular"
+	}
+
+	v := validator.New()
+	if data.ValidateParkingSpot(v, spot); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.modelsFor(r).ParkingSpots.Insert(spot)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateSpotNumber):
+			v.AddError("spot_number", "a spot with this number already exists in the lot")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"parking_spot": spot}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get all spots in a parking lot
+func (app *application) listParkingSpotsHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "spot_number")
+	input.Filters.SortSafelist = []string{"spot_number", "spot_type", "status", "-spot_number", "-spot_type", "-status"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.modelsFor(r).ParkingLots.Get(lotID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	spots, metadata, err := app.modelsFor(r).ParkingSpots.GetAllByLot(lotID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"parking_spots": spots, "metadata": app.withPageLinks(r, metadata)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get the spots under maintenance in a parking lot. Only the lot owner may do this.
+func (app *application) listMaintenanceSpotsHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	lot := app.getOwnedParkingLot(w, r, lotID)
+	if lot == nil {
+		return
+	}
+
+	spots, err := app.modelsFor(r).ParkingSpots.GetMaintenanceSpots(lot.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"parking_spots": spots}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Put many spots of a parking lot under maintenance at once, e.g. when a
+// section is closed for repaving. Spots are named by ID or as a numeric range
+// of spot numbers; see data.SpotSelection. Holders of upcoming reservations on them are notified straight away
+// and listed in the response so they can be rebooked. Only the lot owner may do
+// this.
+func (app *application) bulkParkingSpotMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	lotID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		SpotIDs        []uuid.UUID `json:"spot_ids"`
+		FromSpotNumber string      `json:"from_spot_number"`
+		ToSpotNumber   string      `json:"to_spot_number"`
+		Reason         string      `json:"reason"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	byRange := input.FromSpotNumber != "" || input.ToSpotNumber != ""
+	from, fromOK := data.NumericSpotNumber(input.FromSpotNumber)
+	to, toOK := data.NumericSpotNumber(input.ToSpotNumber)
+
+	v := validator.New()
+	v.Check(len(input.SpotIDs) > 0 || byRange, "spot_ids", "must be provided unless giving a spot number range")
+	v.Check(len(input.SpotIDs) == 0 || !byRange, "spot_ids", "must not be combined with a spot number range")
+	v.Check(len(input.SpotIDs) <= data.MaxMaintenanceBatch, "spot_ids", fmt.Sprintf("must not contain more than %d spots", data.MaxMaintenanceBatch))
+	if byRange {
+		v.Check(input.FromSpotNumber != "", "from_spot_number", "must be provided")
+		v.Check(input.ToSpotNumber != "", "to_spot_number", "must be provided")
+		v.Check(input.FromSpotNumber == "" || fromOK, "from_spot_number", "must be a whole number; pick other spots by ID")
+		v.Check(input.ToSpotNumber == "" || toOK, "to_spot_number", "must be a whole number; pick other spots by ID")
+		v.Check(!fromOK || !toOK || from <= to, "to_spot_number", "must not be less than from_spot_number")
+	}
+	v.Check(input.Reason != "", "reason", "must be provided")
+	v.Check(len(input.Reason) <= 255, "reason", "must not be more than 255 characters long")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	lot := app.getOwnedParkingLot(w, r, lotID)
+	if lot == nil {
+		return
+	}
+
+	selection := data.SpotSelection{
+		SpotIDs:    input.SpotIDs,
+		FromNumber: from,
+		ToNumber:   to,
+	}
+
+	updated, affected, err := app.modelsFor(r).ParkingSpots.SetMaintenanceBulk(lot.ID, selection, input.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound) && byRange:
+			v.AddError("from_spot_number", "no spots in this parking lot fall in this range")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("spot_ids", "must all be spots of this parking lot")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The spots are already under maintenance, and the background job tells
+	// anyone missed here
+	err = app.notifyMaintenanceAffected(app.modelsFor(r), affected, time.Now())
+	if err != nil {
+		app.logError(r, err)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"updated": updated, "affected_reservations": affected}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Change a spot's status: put it under maintenance, return it to service or
+// decommission it. Only the lot owner may do this.
+func (app *application) updateParkingSpotStatusHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(validator.PermittedValue(input.Status,
+		data.SpotStatusActive,
+		data.SpotStatusMaintenance,
+		data.SpotStatusDecommissioned), "status", "must be a valid status")
+	if input.Status == data.SpotStatusMaintenance {
+		v.Check(input.Reason != "", "reason", "must be provided")
+	}
+	v.Check(len(input.Reason) <= 255, "reason", "must not be more than 255 characters long")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	spot, err := app.modelsFor(r).ParkingSpots.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if app.getOwnedParkingLot(w, r, spot.ParkingLotID) == nil {
+		return
+	}
+
+	switch input.Status {
+	case data.SpotStatusMaintenance:
+		err = app.modelsFor(r).ParkingSpots.SetMaintenance(spot.ID, input.Reason)
+	default:
+		err = app.modelsFor(r).ParkingSpots.SetStatus(spot.ID, input.Status)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	spot, err = app.modelsFor(r).ParkingSpots.Get(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"parking_spot": spot}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get the QR code to print on a spot's signage. Drivers scan it to park in that
+// spot. The first request issues the code and later ones return the same one,
+// so signs already printed keep working. Only the lot owner may do this.
+func (app *application) showParkingSpotQRHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	opts := qrcode.DefaultImageOptions()
+	opts.Size = app.readInt(qs, "size", opts.Size, v)
+	opts.ErrorCorrection = app.readString(qs, "error_correction", opts.ErrorCorrection)
+	opts.Format = app.readString(qs, "format", opts.Format)
+
+	if qrcode.ValidateImageOptions(v, opts); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	spot, err := app.modelsFor(r).ParkingSpots.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if app.getOwnedParkingLot(w, r, spot.ParkingLotID) == nil {
+		return
+	}
+
+	qrResponse, err := app.qrService().SpotCode(spot, opts)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"qr_code":    qrResponse.QRCode,
+		"qr_data":    qrResponse.QRData,
+		"image_url":  qrResponse.ImageURL,
+		"verify_url": qrResponse.VerifyURL,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+)
+
+func TestBulkSpotMaintenanceValidation(t *testing.T) {
+	app := newTestApplication(t)
+	user := &data.User{ID: uuid.New(), Activated: true}
+	lotID := uuid.NewString()
+
+	tests := []struct {
+		name      string
+		body      string
+		wantField string
+	}{
+		{"nothing picked", `{"reason":"repaving"}`, "spot_ids"},
+		{"ids and range", `{"spot_ids":["` + uuid.NewString() + `"],"from_spot_number":"1","to_spot_number":"5","reason":"repaving"}`, "spot_ids"},
+		{"open range", `{"from_spot_number":"1","reason":"repaving"}`, "to_spot_number"},
+		{"lettered range", `{"from_spot_number":"A1","to_spot_number":"A9","reason":"repaving"}`, "from_spot_number"},
+		{"backwards range", `{"from_spot_number":"10","to_spot_number":"9","reason":"repaving"}`, "to_spot_number"},
+		{"no reason", `{"from_spot_number":"1","to_spot_number":"5"}`, "reason"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := newAuthenticatedRequest(app, http.MethodPost, "/v1/parking-lots/"+lotID+"/spots/maintenance", tt.body, user)
+			app.bulkParkingSpotMaintenanceHandler(rr, withParams(r, "id", lotID))
+
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, http.StatusUnprocessableEntity, rr.Body)
+			}
+			if _, ok := decodeError(t, rr).Fields[tt.wantField]; !ok {
+				t.Errorf("no error for %s: %s", tt.wantField, rr.Body)
+			}
+		})
+	}
+}
+
+func TestBulkSpotMaintenanceNotifiesHolders(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	owner := insertTestUser(t, app)
+	driver := insertTestUser(t, app)
+	lot, spots := insertTestLot(t, app, owner.ID, 3)
+	vehicle := insertTestVehicle(t, app, driver.ID)
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	reservation := &data.Reservation{
+		UserID:        driver.ID,
+		VehicleID:     vehicle.ID,
+		ParkingLotID:  lot.ID,
+		ParkingSpotID: &spots[1].ID,
+		StartTime:     start,
+		EndTime:       start.Add(time.Hour),
+		Status:        data.ReservationStatusConfirmed,
+	}
+	if err := app.models.Reservations.Insert(reservation); err != nil {
+		t.Fatal(err)
+	}
+
+	closeSpots := func(user *data.User) *httptest.ResponseRecorder {
+		body := `{"from_spot_number":"1","to_spot_number":"2","reason":"repaving"}`
+		rr := httptest.NewRecorder()
+		r := newAuthenticatedRequest(app, http.MethodPost, "/v1/parking-lots/"+lot.ID.String()+"/spots/maintenance", body, user)
+		app.bulkParkingSpotMaintenanceHandler(rr, withParams(r, "id", lot.ID.String()))
+		return rr
+	}
+
+	// Only the owner may close spots
+	if rr := closeSpots(driver); rr.Code == http.StatusOK {
+		t.Fatal("a driver closed spots of someone else's lot")
+	}
+
+	rr := closeSpots(owner)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rr.Code, rr.Body)
+	}
+
+	var resp struct {
+		Updated  int `json:"updated"`
+		Affected []struct {
+			ID         uuid.UUID `json:"id"`
+			UserID     uuid.UUID `json:"user_id"`
+			SpotNumber string    `json:"spot_number"`
+		} `json:"affected_reservations"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Updated != 2 {
+		t.Errorf("updated %d spots; want 2", resp.Updated)
+	}
+	if len(resp.Affected) != 1 || resp.Affected[0].ID != reservation.ID || resp.Affected[0].UserID != driver.ID || resp.Affected[0].SpotNumber != spots[1].SpotNumber {
+		t.Errorf("affected reservations = %+v; want only %s on spot %s", resp.Affected, reservation.ID, spots[1].SpotNumber)
+	}
+
+	// Closing the spots again doesn't notify the driver twice
+	if rr := closeSpots(owner); rr.Code != http.StatusOK {
+		t.Fatalf("second close: status = %d: %s", rr.Code, rr.Body)
+	}
+
+	unread, err := app.models.Notifications.GetUnreadCountForUser(driver.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unread != 1 {
+		t.Errorf("driver has %d notifications; want 1", unread)
+	}
+
+	stored, err := app.models.ParkingSpots.Get(spots[2].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != data.SpotStatusActive {
+		t.Errorf("spot 3 is %s; want %s", stored.Status, data.SpotStatusActive)
+	}
+}
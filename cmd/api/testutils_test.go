@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/jsonlog"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestApplication returns an application that logs nowhere and has no
+// database, for exercising handlers and helpers up to the point they would
+// query the models.
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	return &application{
+		logger: jsonlog.New(io.Discard, jsonlog.LevelOff),
+	}
+}
+
+// newTestDBApplication is newTestApplication backed by the database named by
+// TEST_DB_DSN, which must already have the current schema. Tests that need it
+// are skipped when it isn't set.
+func newTestDBApplication(t *testing.T) *application {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	data.PasswordCost = bcrypt.MinCost
+
+	app := newTestApplication(t)
+	app.models = data.NewModels(db)
+
+	// Registered first so it runs last, after the fixtures are deleted.
+	t.Cleanup(func() {
+		app.wg.Wait()
+		db.Close()
+	})
+
+	return app
+}
+
+// decodeError reads the error body of a response written by errorResponse.
+func decodeError(t *testing.T, rr *httptest.ResponseRecorder) errorBody {
+	t.Helper()
+
+	var body struct {
+		Error errorBody `json:"error"`
+	}
+
+	err := json.NewDecoder(rr.Body).Decode(&body)
+	if err != nil {
+		t.Fatalf("decoding error response: %v", err)
+	}
+
+	return body.Error
+}
+
+// newAuthenticatedRequest builds a request with a JSON body, made by user as if
+// it had passed through the authenticate middleware.
+func newAuthenticatedRequest(app *application, method, target, body string, user *data.User) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	return app.contextSetUser(r, user)
+}
+
+// withParams adds the route parameters httprouter would have matched, given as
+// name and value pairs.
+func withParams(r *http.Request, pairs ...string) *http.Request {
+	var params httprouter.Params
+	for i := 0; i+1 < len(pairs); i += 2 {
+		params = append(params, httprouter.Param{Key: pairs[i], Value: pairs[i+1]})
+	}
+	return r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, params))
+}
+
+// insertTestUser creates an activated user with the password "pa55word". The
+// user, and everything that belongs to them, is removed when the test ends.
+func insertTestUser(t *testing.T, app *application) *data.User {
+	t.Helper()
+
+	user := &data.User{
+		UserName:  "test user",
+		Email:     "test-" + uuid.NewString() + "@example.com",
+		Role:      "normal",
+		AuthType:  data.AuthTypeNormal,
+		Activated: true,
+	}
+	if err := user.Password.Set("pa55word"); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.models.Users.Insert(user); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		app.models.Users.DB.Exec(`DELETE FROM users WHERE id = $1`, user.ID)
+	})
+
+	return user
+}
+
+// insertTestLot creates an always open UTC lot with the given number of regular
+// spots, numbered from 1, owned by ownerID.
+func insertTestLot(t *testing.T, app *application, ownerID uuid.UUID, spots int) (*data.ParkingLot, []*data.ParkingSpot) {
+	t.Helper()
+
+	lot := &data.ParkingLot{
+		Name:       "Test lot " + uuid.NewString()[:8],
+		Address:    "1 Test Street",
+		Latitude:   6.9271,
+		Longitude:  79.8612,
+		TotalSpots: spots,
+		HourlyRate: data.MoneyFromFloat(100),
+		OpenTime:   "00:00",
+		CloseTime:  "00:00",
+		IsActive:   true,
+		Timezone:   "UTC",
+		OwnerID:    ownerID,
+	}
+	if err := app.models.ParkingLots.Insert(lot); err != nil {
+		t.Fatal(err)
+	}
+
+	created := make([]*data.ParkingSpot, spots)
+	for i := range created {
+		created[i] = &data.ParkingSpot{
+			ParkingLotID: lot.ID,
+			SpotNumber:   strconv.Itoa(i + 1),
+			SpotType:     data.SpotTypeRegular,
+			Status:       data.SpotStatusActive,
+		}
+		if err := app.models.ParkingSpots.Insert(created[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return lot, created
+}
+
+func insertTestVehicle(t *testing.T, app *application, userID uuid.UUID) *data.Vehicle {
+	t.Helper()
+
+	vehicle := &data.Vehicle{
+		UserID:       userID,
+		LicensePlate: "T" + strings.ToUpper(uuid.NewString()[:7]),
+		Make:         "Toyota",
+		Model:        "Corolla",
+		Color:        "white",
+		VehicleType:  "car",
+		IsDefault:    true,
+	}
+	if err := app.models.Vehicles.Insert(vehicle); err != nil {
+		t.Fatal(err)
+	}
+
+	return vehicle
+}
+
+// insertTestSession starts a walk-in session on spot for a new vehicle of the
+// user's that checked in at checkIn.
+func insertTestSession(t *testing.T, app *application, userID uuid.UUID, spot *data.ParkingSpot, checkIn time.Time) *data.ParkingSession {
+	t.Helper()
+
+	session := &data.ParkingSession{
+		UserID:        userID,
+		VehicleID:     insertTestVehicle(t, app, userID).ID,
+		ParkingSpotID: spot.ID,
+		CheckInTime:   checkIn,
+		Status:        data.SessionStatusActive,
+	}
+	if err := app.models.ParkingSessions.Insert(session); err != nil {
+		t.Fatal(err)
+	}
+
+	return session
+}
@@ -2,8 +2,8 @@ package main
 
 import (
 	"errors"
-	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
@@ -30,7 +30,7 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	user, err := app.models.Users.GetByEmail(input.Email)
+	user, err := app.modelsFor(r).Users.GetByEmail(input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -52,13 +52,41 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	// Upgrade hashes made with an older, cheaper cost while we have the
+	// plaintext. Login still succeeds if that fails.
+	if user.Password.NeedsRehash() {
+		err = app.modelsFor(r).Users.RehashPassword(user, input.Password)
+		if err != nil {
+			app.logError(r, err)
+		}
+	}
+
+	token, err := app.modelsFor(r).Tokens.New(user.ID, app.config.tokens.authenticationTTL, data.ScopeAuthentication)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	permissions, err := app.modelsFor(r).Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Enough for the client to route the user without fetching their profile
+	// first, e.g. to onboarding or to activate their account.
+	env := envelope{
+		"authentication_token": token,
+		"user": envelope{
+			"id":                       user.ID,
+			"role":                     user.Role,
+			"permissions":              permissions,
+			"has_completed_onboarding": user.HasCompletedOnboarding,
+			"activated":                user.Activated,
+		},
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -83,7 +111,7 @@ func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r
 		return
 	}
 
-	user, err := app.models.Users.GetByEmail(input.Email)
+	user, err := app.modelsFor(r).Users.GetByEmail(input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -101,23 +129,22 @@ func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+	token, err := app.modelsFor(r).Tokens.New(user.ID, app.config.tokens.passwordResetTTL, data.ScopePasswordReset)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	app.background(func() {
-		emailData := map[string]any{
-			"passwordResetToken": token.Plaintext,
-			"frontendURL":        app.config.frontendURL,
-		}
-		fmt.Println(emailData)
-		err = app.mailer.Send(user.Email, "password_reset", emailData)
-		if err != nil {
-			app.logger.PrintError(err, nil)
-		}
-	})
+	emailData := map[string]any{
+		"passwordResetToken": token.Plaintext,
+		"frontendURL":        app.config.frontendURL,
+		"expiresIn":          describeTTL(app.config.tokens.passwordResetTTL),
+	}
+	err = app.queueEmail(user.Email, "password_reset", emailData)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
 	env := envelope{"message": "an email will be sent to you containing password reset instructions"}
 
@@ -126,3 +153,28 @@ func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// describeTTL spells out a token lifetime for emails, e.g. "3 days" or "45
+// minutes", in the largest unit that divides it evenly.
+func describeTTL(ttl time.Duration) string {
+	units := []struct {
+		size time.Duration
+		name string
+	}{
+		{24 * time.Hour, "day"},
+		{time.Hour, "hour"},
+		{time.Minute, "minute"},
+	}
+
+	for _, unit := range units {
+		if ttl%unit.size == 0 {
+			n := int64(ttl / unit.size)
+			if n == 1 {
+				return "1 " + unit.name
+			}
+			return strconv.FormatInt(n, 10) + " " + unit.name + "s"
+		}
+	}
+
+	return ttl.String()
+}
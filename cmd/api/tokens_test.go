@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLoginUpgradesPasswordCost(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	// Made at bcrypt.MinCost, before the cost was raised
+	user := insertTestUser(t, app)
+
+	oldCost := data.PasswordCost
+	t.Cleanup(func() { data.PasswordCost = oldCost })
+	data.PasswordCost = bcrypt.MinCost + 1
+
+	login := func(password string) int {
+		t.Helper()
+
+		body := `{"email":"` + user.Email + `","password":"` + password + `"}`
+		rr := httptest.NewRecorder()
+		app.createAuthenticationTokenHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/tokens/authentication", strings.NewReader(body)))
+		return rr.Code
+	}
+
+	storedCost := func() int {
+		t.Helper()
+
+		var hash []byte
+		if err := app.models.Users.DB.QueryRow(`SELECT password_hash FROM users WHERE id = $1`, user.ID).Scan(&hash); err != nil {
+			t.Fatal(err)
+		}
+		cost, err := bcrypt.Cost(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cost
+	}
+
+	// A failed login leaves the hash alone
+	if code := login("wrong-password"); code != http.StatusUnauthorized {
+		t.Errorf("wrong password: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if cost := storedCost(); cost != bcrypt.MinCost {
+		t.Errorf("cost after a failed login = %d; want %d", cost, bcrypt.MinCost)
+	}
+
+	if code := login("pa55word"); code != http.StatusCreated {
+		t.Fatalf("login: status = %d, want %d", code, http.StatusCreated)
+	}
+	if cost := storedCost(); cost != data.PasswordCost {
+		t.Errorf("cost after login = %d; want %d", cost, data.PasswordCost)
+	}
+
+	// The upgraded hash still authenticates
+	if code := login("pa55word"); code != http.StatusCreated {
+		t.Errorf("login after upgrade: status = %d, want %d", code, http.StatusCreated)
+	}
+}
+
+func TestDescribeTTL(t *testing.T) {
+	tests := []struct {
+		ttl  time.Duration
+		want string
+	}{
+		{3 * 24 * time.Hour, "3 days"},
+		{24 * time.Hour, "1 day"},
+		{36 * time.Hour, "36 hours"},
+		{time.Hour, "1 hour"},
+		{45 * time.Minute, "45 minutes"},
+		{90 * time.Second, "1m30s"},
+	}
+
+	for _, tt := range tests {
+		if got := describeTTL(tt.ttl); got != tt.want {
+			t.Errorf("describeTTL(%s) = %q; want %q", tt.ttl, got, tt.want)
+		}
+	}
+}
+
+func TestLoginUsesConfiguredTokenTTL(t *testing.T) {
+	app := newTestDBApplication(t)
+	app.config.tokens.authenticationTTL = 90 * time.Minute
+
+	user := insertTestUser(t, app)
+
+	before := time.Now()
+	body := `{"email":"` + user.Email + `","password":"pa55word"}`
+	rr := httptest.NewRecorder()
+	app.createAuthenticationTokenHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/tokens/authentication", strings.NewReader(body)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("login: status = %d: %s", rr.Code, rr.Body)
+	}
+
+	var created struct {
+		Token data.Token `json:"authentication_token"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	want := before.Add(app.config.tokens.authenticationTTL)
+	if d := created.Token.Expiry.Sub(want); d < -time.Second || d > 5*time.Second {
+		t.Errorf("token expires at %s; want about %s", created.Token.Expiry, want)
+	}
+
+	var stored time.Time
+	err := app.models.Tokens.DB.QueryRow(`SELECT MAX(expiry) FROM tokens WHERE user_id = $1 AND scope = $2`, user.ID, data.ScopeAuthentication).Scan(&stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := stored.Sub(created.Token.Expiry); d < -time.Millisecond || d > time.Millisecond {
+		t.Errorf("stored expiry %s; want %s", stored, created.Token.Expiry)
+	}
+}
+
+func TestLoginResponseIncludesPermissionsAndOnboarding(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	user := insertTestUser(t, app)
+	newcomer := insertTestUser(t, app)
+
+	if err := app.models.Permissions.AddForUser(user.ID, "ideas:read"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := app.models.Users.DB.Exec(`UPDATE users SET has_completed_onboarding = true WHERE id = $1`, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type loginResponse struct {
+		Token struct {
+			Token string `json:"token"`
+		} `json:"authentication_token"`
+		User struct {
+			ID                     string          `json:"id"`
+			Role                   string          `json:"role"`
+			Permissions            json.RawMessage `json:"permissions"`
+			HasCompletedOnboarding bool            `json:"has_completed_onboarding"`
+			Activated              bool            `json:"activated"`
+		} `json:"user"`
+	}
+
+	login := func(user *data.User) loginResponse {
+		t.Helper()
+
+		body := `{"email":"` + user.Email + `","password":"pa55word"}`
+		rr := httptest.NewRecorder()
+		app.createAuthenticationTokenHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/tokens/authentication", strings.NewReader(body)))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("login: status = %d: %s", rr.Code, rr.Body)
+		}
+
+		var resp loginResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := login(user)
+	if resp.Token.Token == "" {
+		t.Error("no token at the top level")
+	}
+	if resp.User.ID != user.ID.String() || resp.User.Role != user.Role || !resp.User.Activated || !resp.User.HasCompletedOnboarding {
+		t.Errorf("user = %+v; want %s, role %s, activated and onboarded", resp.User, user.ID, user.Role)
+	}
+	if string(resp.User.Permissions) != `["ideas:read"]` {
+		t.Errorf("permissions = %s; want [\"ideas:read\"]", resp.User.Permissions)
+	}
+
+	// A user without permissions gets an empty list, not null
+	resp = login(newcomer)
+	if resp.User.HasCompletedOnboarding {
+		t.Error("newcomer has completed onboarding")
+	}
+	if string(resp.User.Permissions) != `[]` {
+		t.Errorf("permissions = %s; want []", resp.User.Permissions)
+	}
+}
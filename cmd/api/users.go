@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 	"time"
@@ -22,7 +23,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	_, err = app.models.Users.GetByEmail(input.Email)
+	_, err = app.modelsFor(r).Users.GetByEmail(input.Email)
 	if err == nil {
 		app.failedValidationResponse(w, r, map[string]string{"email": "a user with this email address already exists"})
 		return
@@ -35,7 +36,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		UserName:               input.UserName,
 		Email:                  input.Email,
 		Role:                   "normal",
-		AuthType:               "normal",
+		AuthType:               data.AuthTypeNormal,
 		Activated:              false,
 		HasCompletedOnboarding: false,
 	}
@@ -53,7 +54,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Users.Insert(user)
+	err = app.modelsFor(r).Users.Insert(user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
@@ -65,30 +66,29 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Permissions.AddForUser(user.ID, "ideas:read")
+	err = app.modelsFor(r).Permissions.AddForUser(user.ID, "ideas:read")
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	token, err := app.modelsFor(r).Tokens.New(user.ID, app.config.tokens.activationTTL, data.ScopeActivation)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	app.background(func() {
-
-		emailData := map[string]any{
-			"activationToken": token.Plaintext,
-			"userName":        user.UserName,
-			"frontendURL":     app.config.frontendURL,
-		}
-		err = app.mailer.Send(user.Email, "user_welcome", emailData)
-		if err != nil {
-			app.logger.PrintError(err, nil)
-		}
-	})
+	emailData := map[string]any{
+		"activationToken": token.Plaintext,
+		"userName":        user.UserName,
+		"frontendURL":     app.config.frontendURL,
+		"expiresIn":       describeTTL(app.config.tokens.activationTTL),
+	}
+	err = app.queueEmail(user.Email, "user_welcome", emailData)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
 	err = app.writeJSON(w, http.StatusAccepted, envelope{"user": user}, nil)
 	if err != nil {
@@ -116,7 +116,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	user, err := app.models.Users.GetForToken(data.ScopeActivation, input.TokenPlainText)
+	user, err := app.modelsFor(r).Users.GetForToken(data.ScopeActivation, input.TokenPlainText)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -130,7 +130,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 
 	user.Activated = true
 
-	err = app.models.Users.Update(user)
+	err = app.modelsFor(r).Users.Update(user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -141,14 +141,14 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Permissions.AddForUser(user.ID, "ideas:write")
+	err = app.modelsFor(r).Permissions.AddForUser(user.ID, "ideas:write")
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	err = app.modelsFor(r).Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -182,7 +182,7 @@ func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	user, err := app.models.Users.GetForToken(data.ScopePasswordReset, input.TokenPlaintext)
+	user, err := app.modelsFor(r).Users.GetForToken(data.ScopePasswordReset, input.TokenPlaintext)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -199,7 +199,7 @@ func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	err = app.models.Users.Update(user)
+	err = app.modelsFor(r).Users.Update(user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -210,7 +210,7 @@ func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	err = app.models.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+	err = app.modelsFor(r).Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -243,13 +243,13 @@ func (app *application) completeProfileHandler(w http.ResponseWriter, r *http.Re
 
     // Check if user is activated
     if !user.Activated {
-        app.errorResponse(w, r, http.StatusForbidden, "user account must be activated first")
+        app.inactiveAccountResponse(w, r)
         return
     }
 
     // Check if profile is already completed
     if user.HasCompletedOnboarding {
-        app.errorResponse(w, r, http.StatusBadRequest, "profile has already been completed")
+        app.errorResponse(w, r, http.StatusBadRequest, errCodeBadRequest, "profile has already been completed")
         return
     }
 
@@ -268,7 +268,7 @@ func (app *application) completeProfileHandler(w http.ResponseWriter, r *http.Re
     }
 
     // Update the user in the database
-    err = app.models.Users.UpdateProfile(user)
+    err = app.modelsFor(r).Users.UpdateProfile(user)
     if err != nil {
         switch {
         case errors.Is(err, data.ErrEditConflict):
@@ -300,10 +300,10 @@ func (app *application) getUserProfileHandler(w http.ResponseWriter, r *http.Req
 
 func (app *application) updateUserProfileHandler(w http.ResponseWriter, r *http.Request) {
     var input struct {
-        FirstName    *string `json:"first_name"`
-        LastName     *string `json:"last_name"`
-        MobileNumber *string `json:"mobile_number"`
-        AvatarURL    *string `json:"avatar_url"`
+        FirstName    optional[string] `json:"first_name"`
+        LastName     optional[string] `json:"last_name"`
+        MobileNumber optional[string] `json:"mobile_number"`
+        AvatarURL    optional[string] `json:"avatar_url"`
     }
 
     err := app.readJSON(w, r, &input)
@@ -314,19 +314,11 @@ func (app *application) updateUserProfileHandler(w http.ResponseWriter, r *http.
 
     user := app.contextGetUser(r)
 
-    // Update only provided fields
-    if input.FirstName != nil {
-        user.FirstName = input.FirstName
-    }
-    if input.LastName != nil {
-        user.LastName = input.LastName
-    }
-    if input.MobileNumber != nil {
-        user.MobileNumber = input.MobileNumber
-    }
-    if input.AvatarURL != nil {
-        user.AvatarURL = input.AvatarURL
-    }
+    // Update only provided fields; an explicit null clears the field
+    input.FirstName.applyTo(&user.FirstName)
+    input.LastName.applyTo(&user.LastName)
+    input.MobileNumber.applyTo(&user.MobileNumber)
+    input.AvatarURL.applyTo(&user.AvatarURL)
 
     // Validate the profile data
     v := validator.New()
@@ -336,7 +328,7 @@ func (app *application) updateUserProfileHandler(w http.ResponseWriter, r *http.
     }
 
     // Update the user in the database
-    err = app.models.Users.UpdateProfile(user)
+    err = app.modelsFor(r).Users.UpdateProfile(user)
     if err != nil {
         switch {
         case errors.Is(err, data.ErrEditConflict):
@@ -351,4 +343,363 @@ func (app *application) updateUserProfileHandler(w http.ResponseWriter, r *http.
     if err != nil {
         app.serverErrorResponse(w, r, err)
     }
-}
\ No newline at end of file
+}
+
+// accountDeletionTTL is how long an emailed account deletion token stays valid.
+const accountDeletionTTL = 30 * time.Minute
+
+// Email a deletion token to users who sign in with Google only and so have no
+// password to confirm the deletion with
+func (app *application) createAccountDeletionTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	if user.AuthType != data.AuthTypeGoogle {
+		app.badRequestResponse(w, r, errors.New("confirm the deletion with your password instead"))
+		return
+	}
+
+	token, err := app.modelsFor(r).Tokens.New(user.ID, accountDeletionTTL, data.ScopeAccountDeletion)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	emailData := map[string]any{
+		"accountDeletionToken": token.Plaintext,
+		"frontendURL":          app.config.frontendURL,
+		"expiresIn":            describeTTL(accountDeletionTTL),
+	}
+	err = app.queueEmail(user.Email, "account_deletion", emailData)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"message": "an email will be sent to you containing a link to confirm the deletion"}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	// Require the password again so a stolen token alone can't delete the account.
+	// Google-only accounts have no password, so they confirm with an emailed token
+	v := validator.New()
+	if user.AuthType == data.AuthTypeGoogle {
+		if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		owner, err := app.modelsFor(r).Users.GetForToken(data.ScopeAccountDeletion, input.TokenPlaintext)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidCredentialsResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if owner.ID != user.ID {
+			app.invalidCredentialsResponse(w, r)
+			return
+		}
+	} else {
+		if v.Check(input.Password != "", "password", "must be provided"); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		match, err := user.Password.Matches(input.Password)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !match {
+			app.invalidCredentialsResponse(w, r)
+			return
+		}
+	}
+
+	err = app.modelsFor(r).Users.SoftDelete(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your account has been deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) exportUserDataHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	export, err := app.modelsFor(r).ExportUserData(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="spotlinkio-export.json"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	// Stream the document straight to the client rather than buffering it
+	err = json.NewEncoder(w).Encode(envelope{"export": export})
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// Get the authenticated user's reservation reminder lead time
+func (app *application) showReminderPreferenceHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	minutes, err := app.modelsFor(r).Users.GetReminderLeadMinutes(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reminder_preference": envelope{"lead_minutes": minutes}}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Set how far ahead of a reservation the authenticated user is reminded
+func (app *application) updateReminderPreferenceHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		LeadMinutes int `json:"lead_minutes"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateReminderLeadMinutes(v, input.LeadMinutes); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.modelsFor(r).Users.SetReminderLeadMinutes(user.ID, input.LeadMinutes)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reminder_preference": envelope{"lead_minutes": input.LeadMinutes}}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Get whether the authenticated user's reviews show their full name
+func (app *application) showReviewPrivacyHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	show, err := app.modelsFor(r).Users.GetShowFullName(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"review_privacy": envelope{"show_full_name": show}}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Choose whether the authenticated user's reviews show their full name instead
+// of their first name and last initial
+func (app *application) updateReviewPrivacyHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ShowFullName *bool `json:"show_full_name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.ShowFullName != nil, "show_full_name", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.modelsFor(r).Users.SetShowFullName(user.ID, *input.ShowFullName)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"review_privacy": envelope{"show_full_name": *input.ShowFullName}}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Submit the authenticated user's disability permit for verification.
+// Handicapped spots open up once an admin has verified it.
+func (app *application) submitDisabilityPermitHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		PermitNumber string `json:"permit_number"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	permitNumber := data.NormalizePermitNumber(input.PermitNumber)
+
+	v := validator.New()
+	if data.ValidateDisabilityPermitNumber(v, permitNumber); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.modelsFor(r).Users.SubmitDisabilityPermit(user.ID, permitNumber)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"disability_permit": envelope{"permit_number": permitNumber, "verified": false}}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Verify or reject a user's disability permit. The admin sends back the permit
+// number they checked so a permit replaced in the meantime isn't verified.
+func (app *application) verifyDisabilityPermitHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		PermitNumber string `json:"permit_number"`
+		Verified     *bool  `json:"verified"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	permitNumber := data.NormalizePermitNumber(input.PermitNumber)
+
+	v := validator.New()
+	data.ValidateDisabilityPermitNumber(v, permitNumber)
+	v.Check(input.Verified != nil, "verified", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.modelsFor(r).Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v.Check(user.DisabilityPermitNumber != nil, "permit_number", "user has not submitted a disability permit")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.modelsFor(r).Users.SetDisabilityPermitVerified(user.ID, permitNumber, *input.Verified)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"disability_permit": envelope{"user_id": user.ID, "permit_number": permitNumber, "verified": *input.Verified}}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestDeleteUserConfirmation(t *testing.T) {
+	data.PasswordCost = bcrypt.MinCost
+
+	normal := &data.User{ID: uuid.New(), AuthType: data.AuthTypeNormal, Activated: true}
+	if err := normal.Password.Set("pa55word"); err != nil {
+		t.Fatal(err)
+	}
+	google := &data.User{ID: uuid.New(), AuthType: data.AuthTypeGoogle, Activated: true}
+
+	tests := []struct {
+		name     string
+		user     *data.User
+		body     string
+		wantCode int
+		wantErr  string
+	}{
+		{"password missing", normal, `{}`, http.StatusUnprocessableEntity, errCodeValidationFailed},
+		{"wrong password", normal, `{"password": "wrong-password"}`, http.StatusUnauthorized, errCodeInvalidCredentials},
+		{"token missing for google account", google, `{"password": "pa55word"}`, http.StatusUnprocessableEntity, errCodeValidationFailed},
+		{"malformed token for google account", google, `{"token": "short"}`, http.StatusUnprocessableEntity, errCodeValidationFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			rr := httptest.NewRecorder()
+			r := newAuthenticatedRequest(app, http.MethodDelete, "/v1/users/me", tt.body, tt.user)
+
+			app.deleteUserHandler(rr, r)
+
+			if rr.Code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", rr.Code, tt.wantCode)
+			}
+			if got := decodeError(t, rr).Code; got != tt.wantErr {
+				t.Errorf("got code %q; want %q", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAccountDeletionTokenIsOnlyForGoogleAccounts(t *testing.T) {
+	app := newTestApplication(t)
+	user := &data.User{ID: uuid.New(), AuthType: data.AuthTypeBoth, Activated: true}
+
+	rr := httptest.NewRecorder()
+	r := newAuthenticatedRequest(app, http.MethodPost, "/v1/users/me/deletion-token", "", user)
+
+	app.createAccountDeletionTokenHandler(rr, r)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("got status %d; want %d", rr.Code, http.StatusBadRequest)
+	}
+}
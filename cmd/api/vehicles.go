@@ -11,12 +11,13 @@ import (
 // Create a new vehicle for the authenticated user
 func (app *application) createVehicleHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		LicensePlate string `json:"license_plate"`
-		Make         string `json:"make"`
-		Model        string `json:"model"`
-		Color        string `json:"color"`
-		VehicleType  string `json:"vehicle_type"`
-		IsDefault    *bool  `json:"is_default"`
+		LicensePlate      string  `json:"license_plate"`
+		Make              string  `json:"make"`
+		Model             string  `json:"model"`
+		Color             string  `json:"color"`
+		VehicleType       string  `json:"vehicle_type"`
+		PreferredSpotType *string `json:"preferred_spot_type"`
+		IsDefault         *bool   `json:"is_default"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -39,6 +40,10 @@ func (app *application) createVehicleHandler(w http.ResponseWriter, r *http.Requ
 		IsDefault:    false, // Default to false
 	}
 
+	if input.PreferredSpotType != nil && *input.PreferredSpotType != "" {
+		vehicle.PreferredSpotType = input.PreferredSpotType
+	}
+
 	// Set as default if specified
 	if input.IsDefault != nil {
 		vehicle.IsDefault = *input.IsDefault
@@ -52,7 +57,7 @@ func (app *application) createVehicleHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Insert the vehicle
-	err = app.models.Vehicles.Insert(vehicle)
+	err = app.modelsFor(r).Vehicles.Insert(vehicle)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateLicensePlate):
@@ -94,13 +99,21 @@ func (app *application) listVehiclesHandler(w http.ResponseWriter, r *http.Reque
 	user := app.contextGetUser(r)
 
 	// Get vehicles for this user
-	vehicles, metadata, err := app.models.Vehicles.GetAllForUser(user.ID, input.Filters)
+	vehicles, metadata, err := app.modelsFor(r).Vehicles.GetAllForUser(user.ID, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"vehicles": vehicles, "metadata": metadata}, nil)
+	env := envelope{"vehicles": vehicles, "metadata": app.withPageLinks(r, metadata)}
+
+	err = app.selectFields(env, "vehicles", app.readCSV(qs, "fields", nil))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -115,7 +128,7 @@ func (app *application) showVehicleHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Get the vehicle
-	vehicle, err := app.models.Vehicles.Get(id)
+	vehicle, err := app.modelsFor(r).Vehicles.Get(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -148,7 +161,7 @@ func (app *application) updateVehicleHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Get the existing vehicle
-	vehicle, err := app.models.Vehicles.Get(id)
+	vehicle, err := app.modelsFor(r).Vehicles.Get(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -167,12 +180,13 @@ func (app *application) updateVehicleHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	var input struct {
-		LicensePlate *string `json:"license_plate"`
-		Make         *string `json:"make"`
-		Model        *string `json:"model"`
-		Color        *string `json:"color"`
-		VehicleType  *string `json:"vehicle_type"`
-		IsDefault    *bool   `json:"is_default"`
+		LicensePlate      *string          `json:"license_plate"`
+		Make              *string          `json:"make"`
+		Model             *string          `json:"model"`
+		Color             *string          `json:"color"`
+		VehicleType       *string          `json:"vehicle_type"`
+		PreferredSpotType optional[string] `json:"preferred_spot_type"`
+		IsDefault         *bool            `json:"is_default"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -197,6 +211,11 @@ func (app *application) updateVehicleHandler(w http.ResponseWriter, r *http.Requ
 	if input.VehicleType != nil {
 		vehicle.VehicleType = *input.VehicleType
 	}
+	// Null or an empty string clears the preference
+	input.PreferredSpotType.applyTo(&vehicle.PreferredSpotType)
+	if vehicle.PreferredSpotType != nil && *vehicle.PreferredSpotType == "" {
+		vehicle.PreferredSpotType = nil
+	}
 	if input.IsDefault != nil {
 		vehicle.IsDefault = *input.IsDefault
 	}
@@ -209,7 +228,7 @@ func (app *application) updateVehicleHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Update the vehicle
-	err = app.models.Vehicles.Update(vehicle)
+	err = app.modelsFor(r).Vehicles.Update(vehicle)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateLicensePlate):
@@ -238,7 +257,7 @@ func (app *application) deleteVehicleHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Get the vehicle to check ownership
-	vehicle, err := app.models.Vehicles.Get(id)
+	vehicle, err := app.modelsFor(r).Vehicles.Get(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -257,7 +276,7 @@ func (app *application) deleteVehicleHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Delete the vehicle
-	err = app.models.Vehicles.Delete(id)
+	err = app.modelsFor(r).Vehicles.Delete(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -283,7 +302,7 @@ func (app *application) setDefaultVehicleHandler(w http.ResponseWriter, r *http.
 	}
 
 	// Get the vehicle to check ownership
-	vehicle, err := app.models.Vehicles.Get(id)
+	vehicle, err := app.modelsFor(r).Vehicles.Get(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -302,7 +321,7 @@ func (app *application) setDefaultVehicleHandler(w http.ResponseWriter, r *http.
 	}
 
 	// Set as default
-	err = app.models.Vehicles.SetAsDefault(user.ID, id)
+	err = app.modelsFor(r).Vehicles.SetAsDefault(user.ID, id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -314,7 +333,7 @@ func (app *application) setDefaultVehicleHandler(w http.ResponseWriter, r *http.
 	}
 
 	// Get the updated vehicle
-	vehicle, err = app.models.Vehicles.Get(id)
+	vehicle, err = app.modelsFor(r).Vehicles.Get(id)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
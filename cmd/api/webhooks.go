@@ -0,0 +1,285 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/webhook"
+)
+
+// publishLotEvent fans an event at a lot out to the webhooks its owner has
+// subscribed to it. It runs in the background so a slow or failing subscriber
+// never holds up the request that caused the event.
+func (app *application) publishLotEvent(lotID uuid.UUID, event string, payload any) {
+	app.background(func() {
+		err := app.queueWebhookEvent(lotID, event, payload, time.Now())
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"event": event, "parking_lot_id": lotID.String()})
+		}
+	})
+}
+
+// queueWebhookEvent records a delivery per subscribed webhook and attempts
+// them straight away. Failed deliveries are retried by the delivery job.
+func (app *application) queueWebhookEvent(lotID uuid.UUID, event string, payload any, now time.Time) error {
+	webhooks, err := app.models.Webhooks.GetSubscribed(lotID, event)
+	if err != nil {
+		return err
+	}
+
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	for _, wh := range webhooks {
+		delivery, err := data.NewWebhookDelivery(wh, event, payload, now)
+		if err != nil {
+			return err
+		}
+
+		err = app.models.Webhooks.InsertDelivery(delivery)
+		if err != nil {
+			return err
+		}
+	}
+
+	return app.deliverDueWebhooks()
+}
+
+// deliverDueWebhooks sends the webhook deliveries that are due.
+func (app *application) deliverDueWebhooks() error {
+	deliveries, err := app.models.Webhooks.ClaimDueDeliveries(20, 2*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		err = app.attemptWebhookDelivery(delivery, app.config.webhooks.maxAttempts)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// attemptWebhookDelivery sends a delivery once and saves the outcome.
+func (app *application) attemptWebhookDelivery(delivery *data.WebhookDelivery, maxAttempts int) error {
+	status, sendErr := app.webhooks.Deliver(delivery.URL, delivery.Secret, delivery.EventType, delivery.ID.String(), delivery.Payload)
+	if sendErr == nil {
+		delivery.Succeed(status, time.Now())
+	} else {
+		delivery.Fail(sendErr, status, maxAttempts, time.Now())
+	}
+
+	return app.models.Webhooks.SaveDeliveryAttempt(delivery)
+}
+
+// getOwnWebhook reads the webhook in the URL and checks it belongs to the
+// authenticated user. It writes the error response and returns nil otherwise.
+func (app *application) getOwnWebhook(w http.ResponseWriter, r *http.Request) *data.Webhook {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	wh, err := app.modelsFor(r).Webhooks.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	user := app.contextGetUser(r)
+	if wh.OwnerID != user.ID {
+		app.notPermittedResponse(w, r)
+		return nil
+	}
+
+	return wh
+}
+
+// Register a webhook for events at the user's lots. The signing secret is only
+// ever returned here.
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		URL          string     `json:"url"`
+		ParkingLotID *uuid.UUID `json:"parking_lot_id"`
+		EventTypes   []string   `json:"event_types"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	wh := &data.Webhook{
+		OwnerID:      user.ID,
+		ParkingLotID: input.ParkingLotID,
+		URL:          input.URL,
+		EventTypes:   input.EventTypes,
+	}
+
+	v := validator.New()
+
+	if input.ParkingLotID != nil {
+		lot, err := app.modelsFor(r).ParkingLots.Get(*input.ParkingLotID)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("parking_lot_id", "must be one of your parking lots")
+		case err != nil:
+			app.serverErrorResponse(w, r, err)
+			return
+		default:
+			v.Check(lot.OwnerID == user.ID, "parking_lot_id", "must be one of your parking lots")
+		}
+	}
+
+	if data.ValidateWebhook(v, wh); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	wh.Secret, err = webhook.NewSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.modelsFor(r).Webhooks.Insert(wh)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"webhook": wh, "secret": wh.Secret}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// List the user's webhooks
+func (app *application) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	webhooks, err := app.modelsFor(r).Webhooks.GetAllForOwner(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"webhooks": webhooks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Remove a webhook along with its delivery log
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	wh := app.getOwnWebhook(w, r)
+	if wh == nil {
+		return
+	}
+
+	err := app.modelsFor(r).Webhooks.Delete(wh.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "webhook successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Send a test event to a webhook and report how the endpoint answered. Test
+// deliveries are attempted once and not retried.
+func (app *application) testWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	wh := app.getOwnWebhook(w, r)
+	if wh == nil {
+		return
+	}
+
+	delivery, err := data.NewWebhookDelivery(wh, data.WebhookEventTest, map[string]any{"webhook_id": wh.ID}, time.Now())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.modelsFor(r).Webhooks.InsertDelivery(delivery)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.attemptWebhookDelivery(delivery, 1)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"delivery": delivery}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// List a webhook's delivery log, newest first
+func (app *application) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	wh := app.getOwnWebhook(w, r)
+	if wh == nil {
+		return
+	}
+
+	var input struct {
+		Status string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Status = app.readString(qs, "status", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"created_at", "attempts", "-created_at", "-attempts"}
+
+	if input.Status != "" {
+		v.Check(validator.PermittedValue(input.Status, data.WebhookDeliveryPending, data.WebhookDeliveryDelivered, data.WebhookDeliveryFailed), "status", "must be pending, delivered or failed")
+	}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	deliveries, metadata, err := app.modelsFor(r).Webhooks.GetDeliveries(wh.ID, input.Status, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"deliveries": deliveries, "metadata": app.withPageLinks(r, metadata)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/webhook"
+)
+
+func TestQueueWebhookEventSignsDelivery(t *testing.T) {
+	app := newTestDBApplication(t)
+	app.webhooks = webhook.NewClient(5*time.Second, true)
+	app.config.webhooks.maxAttempts = 3
+
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	var mu sync.Mutex
+	var requests []received
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, received{r.Header, body})
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	owner := insertTestUser(t, app)
+	lot, _ := insertTestLot(t, app, owner.ID, 1)
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wh := &data.Webhook{
+		OwnerID:      owner.ID,
+		ParkingLotID: &lot.ID,
+		URL:          srv.URL,
+		Secret:       secret,
+		EventTypes:   []string{data.WebhookEventReservationCreated},
+	}
+	err = app.models.Webhooks.Insert(wh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An event the webhook isn't subscribed to goes nowhere
+	err = app.queueWebhookEvent(lot.ID, data.WebhookEventReservationCancelled, envelope{"id": uuid.New()}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 0 {
+		t.Fatalf("unsubscribed event sent %d requests", len(requests))
+	}
+
+	reservationID := uuid.New()
+	err = app.queueWebhookEvent(lot.ID, data.WebhookEventReservationCreated, envelope{"id": reservationID}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(requests))
+	}
+	req := requests[0]
+
+	err = webhook.Verify(secret, req.header.Get(webhook.SignatureHeader), req.body, 5*time.Minute, time.Now())
+	if err != nil {
+		t.Errorf("signature doesn't verify: %v", err)
+	}
+	if req.header.Get(webhook.EventHeader) != data.WebhookEventReservationCreated {
+		t.Errorf("event header = %q", req.header.Get(webhook.EventHeader))
+	}
+
+	var payload struct {
+		ID    uuid.UUID `json:"id"`
+		Event string    `json:"event"`
+		Data  struct {
+			ID uuid.UUID `json:"id"`
+		} `json:"data"`
+	}
+	err = json.Unmarshal(req.body, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != data.WebhookEventReservationCreated || payload.Data.ID != reservationID {
+		t.Errorf("payload = %s", req.body)
+	}
+	if req.header.Get(webhook.DeliveryHeader) != payload.ID.String() {
+		t.Errorf("delivery header = %q, want %s", req.header.Get(webhook.DeliveryHeader), payload.ID)
+	}
+
+	deliveries, _, err := app.models.Webhooks.GetDeliveries(wh.ID, "", data.Filters{
+		Page:         1,
+		PageSize:     20,
+		Sort:         "-created_at",
+		SortSafelist: []string{"-created_at"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(deliveries))
+	}
+	if deliveries[0].Status != data.WebhookDeliveryDelivered || deliveries[0].Attempts != 1 {
+		t.Errorf("delivery status = %s after %d attempts, want delivered after 1", deliveries[0].Status, deliveries[0].Attempts)
+	}
+}
@@ -0,0 +1,306 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+var (
+	ErrChargingInProgress = errors.New("vehicle is already charging")
+)
+
+// DefaultEnergyRate is the price per kWh for charging sessions started without
+// their own rate. It is set once at startup.
+var DefaultEnergyRate float64
+
+// ChargingSession tracks the energy drawn by a vehicle parked at an electric
+// spot, from the charger's meter readings. Energy is billed at EnergyRate per
+// kWh once the session is finalized.
+type ChargingSession struct {
+	ID               uuid.UUID  `json:"id" db:"id"`
+	ParkingSessionID uuid.UUID  `json:"parking_session_id" db:"parking_session_id"`
+	StartKWh         float64    `json:"start_kwh" db:"start_kwh"`
+	EndKWh           *float64   `json:"end_kwh" db:"end_kwh"`
+	EnergyRate       float64    `json:"energy_rate" db:"energy_rate"` // per kWh
+	EnergyAmount     *float64   `json:"energy_amount" db:"energy_amount"`
+	PaymentID        *uuid.UUID `json:"payment_id" db:"payment_id"`
+	StartedAt        time.Time  `json:"started_at" db:"started_at"`
+	EndedAt          *time.Time `json:"ended_at" db:"ended_at"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at" db:"updated_at"`
+	Version          int        `json:"version" db:"version"`
+}
+
+// CanCharge reports whether vehicles parked in the spot can charge there. Only
+// electric spots have chargers.
+func (spot *ParkingSpot) CanCharge() bool {
+	return spot.SpotType == SpotTypeElectric
+}
+
+// ValidateChargingStart checks a charging session about to start for a vehicle
+// parked in spot under session.
+func ValidateChargingStart(v *validator.Validator, spot *ParkingSpot, session *ParkingSession, charging *ChargingSession) {
+	v.Check(spot.CanCharge(), "parking_session", "charging is only available at electric spots")
+	v.Check(session.Status == SessionStatusActive, "parking_session", "must be an active parking session")
+	v.Check(charging.StartKWh >= 0, "start_kwh", "must not be negative")
+	v.Check(charging.EnergyRate >= 0, "energy_rate", "must not be negative")
+	v.Check(charging.EnergyRate <= 100, "energy_rate", "must not be more than 100 per kWh")
+}
+
+// ValidateChargingStop checks the closing meter reading of a charging session.
+func ValidateChargingStop(v *validator.Validator, charging *ChargingSession, endKWh float64) {
+	v.Check(charging.EndedAt == nil, "charging_session", "has already been stopped")
+	v.Check(endKWh >= charging.StartKWh, "end_kwh", "must not be less than start_kwh")
+}
+
+// EnergyUsed is the energy drawn between the two meter readings, in kWh.
+func (c *ChargingSession) EnergyUsed(endKWh float64) float64 {
+	return endKWh - c.StartKWh
+}
+
+// EnergyCost is the charge for drawing energy up to the endKWh reading.
+func (c *ChargingSession) EnergyCost(endKWh float64) float64 {
+	return RoundMoney(c.EnergyUsed(endKWh) * c.EnergyRate)
+}
+
+type ChargingSessionModel struct {
+	DB *sql.DB
+	queryScope
+}
+
+// Insert starts a charging session. A parking session can only charge once at a
+// time; starting another while one is running returns ErrChargingInProgress.
+func (m ChargingSessionModel) Insert(charging *ChargingSession) error {
+	query := `
+		INSERT INTO charging_sessions (parking_session_id, start_kwh, energy_rate, started_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at, version`
+
+	args := []any{charging.ParkingSessionID, charging.StartKWh, charging.EnergyRate, charging.StartedAt}
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&charging.ID, &charging.CreatedAt, &charging.UpdatedAt, &charging.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "charging_sessions_active_idx"`:
+			return ErrChargingInProgress
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+const chargingSessionColumns = `
+		SELECT id, parking_session_id, start_kwh, end_kwh, energy_rate, energy_amount, payment_id, started_at, ended_at, created_at, updated_at, version
+		FROM charging_sessions`
+
+type chargingScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanChargingSession(row chargingScanner) (*ChargingSession, error) {
+	var charging ChargingSession
+
+	err := row.Scan(
+		&charging.ID,
+		&charging.ParkingSessionID,
+		&charging.StartKWh,
+		&charging.EndKWh,
+		&charging.EnergyRate,
+		&charging.EnergyAmount,
+		&charging.PaymentID,
+		&charging.StartedAt,
+		&charging.EndedAt,
+		&charging.CreatedAt,
+		&charging.UpdatedAt,
+		&charging.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &charging, nil
+}
+
+func (m ChargingSessionModel) Get(id uuid.UUID) (*ChargingSession, error) {
+	query := chargingSessionColumns + `
+		WHERE id = $1`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	charging, err := scanChargingSession(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return charging, nil
+}
+
+// GetActiveBySession returns the parking session's running charging session.
+func (m ChargingSessionModel) GetActiveBySession(parkingSessionID uuid.UUID) (*ChargingSession, error) {
+	query := chargingSessionColumns + `
+		WHERE parking_session_id = $1 AND ended_at IS NULL`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	charging, err := scanChargingSession(m.DB.QueryRowContext(ctx, query, parkingSessionID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return charging, nil
+}
+
+// GetAllForSession returns every charging session of a parking session, oldest
+// first.
+func (m ChargingSessionModel) GetAllForSession(parkingSessionID uuid.UUID) ([]*ChargingSession, error) {
+	query := chargingSessionColumns + `
+		WHERE parking_session_id = $1
+		ORDER BY started_at ASC, id ASC`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, parkingSessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chargingSessions := []*ChargingSession{}
+
+	for rows.Next() {
+		charging, err := scanChargingSession(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		chargingSessions = append(chargingSessions, charging)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return chargingSessions, nil
+}
+
+// Finalize stops the charging session at the endKWh reading and bills the
+// energy. A pending payment for the energy is added to the parking session's
+// charges, against its reservation if it has one, in the same transaction.
+// Sessions that drew nothing billable get no payment. Stopping a session that
+// was stopped or changed in the meantime returns ErrEditConflict.
+func (m ChargingSessionModel) Finalize(charging *ChargingSession, session *ParkingSession, endKWh float64, endedAt time.Time) (*Payment, error) {
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	amount := charging.EnergyCost(endKWh)
+
+	var payment *Payment
+	if amount > 0 {
+		payment = &Payment{
+			ReservationID: session.ReservationID,
+			UserID:        session.UserID,
+			Amount:        MoneyFromFloat(amount),
+			Currency:      "USD",
+			PaymentMethod: PaymentMethodCard,
+			Status:        PaymentStatusPending,
+		}
+
+		query := `
+			INSERT INTO payments (reservation_id, user_id, amount, currency, payment_method, status)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id, payment_date, created_at, updated_at, version`
+
+		args := []any{payment.ReservationID, payment.UserID, payment.Amount, payment.Currency, payment.PaymentMethod, payment.Status}
+
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&payment.ID, &payment.PaymentDate, &payment.CreatedAt, &payment.UpdatedAt, &payment.Version)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var paymentID *uuid.UUID
+	if payment != nil {
+		paymentID = &payment.ID
+	}
+
+	query := `
+		UPDATE charging_sessions
+		SET end_kwh = $1, ended_at = $2, energy_amount = $3, payment_id = $4, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $5 AND version = $6 AND ended_at IS NULL
+		RETURNING updated_at, version`
+
+	args := []any{endKWh, endedAt, amount, paymentID, charging.ID, charging.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&charging.UpdatedAt, &charging.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrEditConflict
+		default:
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	charging.EndKWh = &endKWh
+	charging.EndedAt = &endedAt
+	charging.EnergyAmount = &amount
+	charging.PaymentID = paymentID
+
+	return payment, nil
+}
+
+func (m ChargingSessionModel) Delete(id uuid.UUID) error {
+	query := `DELETE FROM charging_sessions WHERE id = $1`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+func TestEnergyCost(t *testing.T) {
+	tests := []struct {
+		name     string
+		startKWh float64
+		endKWh   float64
+		rate     float64
+		want     float64
+	}{
+		{"nothing drawn", 120, 120, 0.35, 0},
+		{"whole kWh", 100, 110, 0.5, 5},
+		{"rounded to cents", 10.5, 23.25, 0.333, 4.25},
+		{"free charging", 0, 40, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			charging := &ChargingSession{StartKWh: tt.startKWh, EnergyRate: tt.rate}
+			if got := charging.EnergyCost(tt.endKWh); got != tt.want {
+				t.Errorf("EnergyCost(%v) = %v, want %v", tt.endKWh, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateChargingStart(t *testing.T) {
+	active := &ParkingSession{Status: SessionStatusActive}
+	charging := &ChargingSession{StartKWh: 10, EnergyRate: 0.4}
+
+	tests := []struct {
+		name      string
+		spot      *ParkingSpot
+		session   *ParkingSession
+		charging  *ChargingSession
+		wantField string
+	}{
+		{"electric spot", &ParkingSpot{SpotType: SpotTypeElectric}, active, charging, ""},
+		{"regular spot", &ParkingSpot{SpotType: SpotTypeRegular}, active, charging, "parking_session"},
+		{"handicapped spot", &ParkingSpot{SpotType: SpotTypeHandicapped}, active, charging, "parking_session"},
+		{"finished session", &ParkingSpot{SpotType: SpotTypeElectric}, &ParkingSession{Status: SessionStatusCompleted}, charging, "parking_session"},
+		{"negative reading", &ParkingSpot{SpotType: SpotTypeElectric}, active, &ChargingSession{StartKWh: -1}, "start_kwh"},
+		{"rate too high", &ParkingSpot{SpotType: SpotTypeElectric}, active, &ChargingSession{EnergyRate: 101}, "energy_rate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateChargingStart(v, tt.spot, tt.session, tt.charging)
+
+			if tt.wantField == "" && !v.Valid() {
+				t.Errorf("unexpected errors: %v", v.Errors)
+			}
+			if _, ok := v.Errors[tt.wantField]; tt.wantField != "" && !ok {
+				t.Errorf("no error for %s: %v", tt.wantField, v.Errors)
+			}
+		})
+	}
+}
+
+func TestValidateChargingStop(t *testing.T) {
+	ended := time.Now()
+
+	v := validator.New()
+	ValidateChargingStop(v, &ChargingSession{StartKWh: 10}, 9.5)
+	if _, ok := v.Errors["end_kwh"]; !ok {
+		t.Errorf("reading below the start accepted: %v", v.Errors)
+	}
+
+	v = validator.New()
+	ValidateChargingStop(v, &ChargingSession{StartKWh: 10, EndedAt: &ended}, 20)
+	if _, ok := v.Errors["charging_session"]; !ok {
+		t.Errorf("stopping a stopped session accepted: %v", v.Errors)
+	}
+}
+
+func TestFinalizeChargingBillsEnergy(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+	lot, _ := insertTestLot(t, m, user.ID, 0)
+	spot := &ParkingSpot{ParkingLotID: lot.ID, SpotNumber: "EV1", SpotType: SpotTypeElectric, Status: SpotStatusActive}
+	if err := m.ParkingSpots.Insert(spot); err != nil {
+		t.Fatal(err)
+	}
+	session := insertTestSession(t, m, user.ID, spot, time.Now().Add(-time.Hour))
+
+	charging := &ChargingSession{ParkingSessionID: session.ID, StartKWh: 100, EnergyRate: 0.5, StartedAt: time.Now()}
+	if err := m.ChargingSessions.Insert(charging); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only one charge at a time per parking session
+	err := m.ChargingSessions.Insert(&ChargingSession{ParkingSessionID: session.ID, StartedAt: time.Now()})
+	if !errors.Is(err, ErrChargingInProgress) {
+		t.Errorf("second charge: err = %v, want %v", err, ErrChargingInProgress)
+	}
+
+	payment, err := m.ChargingSessions.Finalize(charging, session, 112.5, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment == nil || payment.Amount != MoneyFromFloat(6.25) || payment.Status != PaymentStatusPending || payment.UserID != user.ID {
+		t.Fatalf("payment = %+v, want a pending 6.25 for the driver", payment)
+	}
+
+	stored, err := m.ChargingSessions.Get(charging.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.EnergyAmount == nil || *stored.EnergyAmount != 6.25 || stored.PaymentID == nil || *stored.PaymentID != payment.ID {
+		t.Errorf("stored charging session = %+v", stored)
+	}
+	if _, err := m.ChargingSessions.GetActiveBySession(session.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("GetActiveBySession after stop: err = %v, want %v", err, ErrRecordNotFound)
+	}
+
+	if _, err := m.ChargingSessions.Finalize(stored, session, 120, time.Now()); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("stopping twice: err = %v, want %v", err, ErrEditConflict)
+	}
+
+	// A charge that drew nothing isn't billed
+	idle := &ChargingSession{ParkingSessionID: session.ID, StartKWh: 112.5, EnergyRate: 0.5, StartedAt: time.Now()}
+	if err := m.ChargingSessions.Insert(idle); err != nil {
+		t.Fatal(err)
+	}
+	payment, err = m.ChargingSessions.Finalize(idle, session, 112.5, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment != nil || idle.PaymentID != nil {
+		t.Errorf("idle charge billed: %+v", payment)
+	}
+}
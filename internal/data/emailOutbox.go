@@ -0,0 +1,308 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	EmailStatusPending = "pending"
+	EmailStatusSent    = "sent"
+	EmailStatusDead    = "dead"
+)
+
+const (
+	// retryBase is the wait after the first failed attempt. It doubles with
+	// every further attempt up to retryMax.
+	retryBase = time.Minute
+	retryMax  = time.Hour
+)
+
+// OutboxEmail is an email waiting to be sent, sent, or given up on. Data holds
+// the template data, which can include tokens, so it is never serialized.
+type OutboxEmail struct {
+	ID            uuid.UUID      `json:"id" db:"id"`
+	Recipient     string         `json:"recipient" db:"recipient"`
+	Template      string         `json:"template" db:"template"`
+	Data          map[string]any `json:"-" db:"data"`
+	Status        string         `json:"status" db:"status"`
+	Attempts      int            `json:"attempts" db:"attempts"`
+	LastError     *string        `json:"last_error" db:"last_error"`
+	NextAttemptAt time.Time      `json:"next_attempt_at" db:"next_attempt_at"`
+	SentAt        *time.Time     `json:"sent_at" db:"sent_at"`
+	CreatedAt     time.Time      `json:"created_at" db:"created_at"`
+	Version       int            `json:"version" db:"version"`
+}
+
+// RetryBackoff is how long to wait before retrying an email or webhook
+// delivery that has failed the given number of attempts.
+func RetryBackoff(attempts int) time.Duration {
+	backoff := retryBase
+	for i := 1; i < attempts && backoff < retryMax; i++ {
+		backoff *= 2
+	}
+	return min(backoff, retryMax)
+}
+
+// Fail records a failed attempt at now. Once maxAttempts attempts have failed,
+// or when permanent is set, the email is dead-lettered instead of retried.
+func (e *OutboxEmail) Fail(err error, permanent bool, maxAttempts int, now time.Time) {
+	e.Attempts++
+
+	message := err.Error()
+	e.LastError = &message
+
+	if permanent || e.Attempts >= maxAttempts {
+		e.Status = EmailStatusDead
+		return
+	}
+
+	e.Status = EmailStatusPending
+	e.NextAttemptAt = now.Add(RetryBackoff(e.Attempts))
+}
+
+type EmailOutboxModel struct {
+	DB *sql.DB
+	queryScope
+}
+
+func (m EmailOutboxModel) Enqueue(email *OutboxEmail) error {
+	data, err := json.Marshal(email.Data)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO email_outbox (recipient, template, data)
+		VALUES ($1, $2, $3)
+		RETURNING id, status, attempts, next_attempt_at, created_at, version`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, email.Recipient, email.Template, data).Scan(
+		&email.ID,
+		&email.Status,
+		&email.Attempts,
+		&email.NextAttemptAt,
+		&email.CreatedAt,
+		&email.Version,
+	)
+}
+
+// ClaimDue picks up to limit pending emails whose next attempt is due and
+// pushes their next attempt lease into the future, so concurrent workers don't
+// send the same email twice. An email whose worker dies mid-send is retried
+// once the lease expires.
+func (m EmailOutboxModel) ClaimDue(limit int, lease time.Duration) ([]*OutboxEmail, error) {
+	query := `
+		UPDATE email_outbox
+		SET next_attempt_at = NOW() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, recipient, template, data, status, attempts, last_error, next_attempt_at, sent_at, created_at, version`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails := []*OutboxEmail{}
+
+	for rows.Next() {
+		email, err := scanOutboxEmail(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		emails = append(emails, email)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return emails, nil
+}
+
+func (m EmailOutboxModel) MarkSent(email *OutboxEmail) error {
+	query := `
+		UPDATE email_outbox
+		SET status = 'sent', attempts = attempts + 1, last_error = NULL, sent_at = NOW(), version = version + 1
+		WHERE id = $1
+		RETURNING status, attempts, sent_at, version`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, email.ID).Scan(&email.Status, &email.Attempts, &email.SentAt, &email.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SaveAttempt stores the outcome of a failed attempt recorded with Fail.
+func (m EmailOutboxModel) SaveAttempt(email *OutboxEmail) error {
+	query := `
+		UPDATE email_outbox
+		SET status = $1, attempts = $2, last_error = $3, next_attempt_at = $4, version = version + 1
+		WHERE id = $5 AND version = $6
+		RETURNING version`
+
+	args := []any{email.Status, email.Attempts, email.LastError, email.NextAttemptAt, email.ID, email.Version}
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&email.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Requeue gives a dead-lettered email a fresh set of attempts. Emails that
+// aren't dead-lettered are reported as ErrRecordNotFound.
+func (m EmailOutboxModel) Requeue(id uuid.UUID) (*OutboxEmail, error) {
+	query := `
+		UPDATE email_outbox
+		SET status = 'pending', attempts = 0, next_attempt_at = NOW(), version = version + 1
+		WHERE id = $1 AND status = 'dead'
+		RETURNING id, recipient, template, data, status, attempts, last_error, next_attempt_at, sent_at, created_at, version`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	email, err := scanOutboxEmail(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return email, nil
+}
+
+func (m EmailOutboxModel) GetAll(status string, filters Filters) ([]*OutboxEmail, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, recipient, template, data, status, attempts, last_error, next_attempt_at, sent_at, created_at, version
+		FROM email_outbox
+		WHERE (status = $1 OR $1 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $2 OFFSET $3`
+
+	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	emails := []*OutboxEmail{}
+
+	for rows.Next() {
+		var email OutboxEmail
+		var data []byte
+
+		err := rows.Scan(
+			&totalRecords,
+			&email.ID,
+			&email.Recipient,
+			&email.Template,
+			&data,
+			&email.Status,
+			&email.Attempts,
+			&email.LastError,
+			&email.NextAttemptAt,
+			&email.SentAt,
+			&email.CreatedAt,
+			&email.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		err = json.Unmarshal(data, &email.Data)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		emails = append(emails, &email)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return emails, metadata, nil
+}
+
+type outboxScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanOutboxEmail(row outboxScanner) (*OutboxEmail, error) {
+	var email OutboxEmail
+	var data []byte
+
+	err := row.Scan(
+		&email.ID,
+		&email.Recipient,
+		&email.Template,
+		&data,
+		&email.Status,
+		&email.Attempts,
+		&email.LastError,
+		&email.NextAttemptAt,
+		&email.SentAt,
+		&email.CreatedAt,
+		&email.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &email.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &email, nil
+}
@@ -0,0 +1,176 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{7, time.Hour},
+		{20, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := RetryBackoff(tt.attempts); got != tt.want {
+			t.Errorf("RetryBackoff(%d) = %v; want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestOutboxEmailFail(t *testing.T) {
+	now := time.Now()
+	transient := errors.New("421 service not available")
+
+	email := &OutboxEmail{Status: EmailStatusPending}
+	email.Fail(transient, false, 3, now)
+	if email.Status != EmailStatusPending || email.Attempts != 1 || !email.NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("first transient failure: got %s after %d attempts, next at %v; want a retry in a minute", email.Status, email.Attempts, email.NextAttemptAt)
+	}
+	if email.LastError == nil || *email.LastError != transient.Error() {
+		t.Errorf("got last error %v; want %q", email.LastError, transient)
+	}
+
+	email.Fail(transient, false, 3, now)
+	if email.Status != EmailStatusPending || !email.NextAttemptAt.Equal(now.Add(2*time.Minute)) {
+		t.Errorf("second transient failure: got %s, next at %v; want a retry in two minutes", email.Status, email.NextAttemptAt)
+	}
+
+	email.Fail(transient, false, 3, now)
+	if email.Status != EmailStatusDead || email.Attempts != 3 {
+		t.Errorf("last allowed attempt: got %s after %d attempts; want dead after 3", email.Status, email.Attempts)
+	}
+
+	permanent := &OutboxEmail{Status: EmailStatusPending}
+	permanent.Fail(errors.New("unknown email template"), true, 3, now)
+	if permanent.Status != EmailStatusDead || permanent.Attempts != 1 {
+		t.Errorf("permanent failure: got %s after %d attempts; want dead after 1", permanent.Status, permanent.Attempts)
+	}
+}
+
+func TestEmailOutboxRetryAndDeadLetter(t *testing.T) {
+	m := newTestModels(t)
+
+	// next_attempt_at is stored to the second, which can round a fresh
+	// email's first attempt just into the future.
+	due := func(id uuid.UUID) {
+		t.Helper()
+		if _, err := m.EmailOutbox.DB.Exec(`UPDATE email_outbox SET next_attempt_at = NOW() - INTERVAL '1 second' WHERE id = $1`, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	enqueue := func() *OutboxEmail {
+		t.Helper()
+
+		email := &OutboxEmail{
+			Recipient: "test-" + uuid.NewString() + "@example.com",
+			Template:  "user_welcome",
+			Data:      map[string]any{"userName": "Test"},
+		}
+		if err := m.EmailOutbox.Enqueue(email); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			m.EmailOutbox.DB.Exec(`DELETE FROM email_outbox WHERE id = $1`, email.ID)
+		})
+		due(email.ID)
+		return email
+	}
+	claim := func(id uuid.UUID) *OutboxEmail {
+		t.Helper()
+
+		emails, err := m.EmailOutbox.ClaimDue(1000, 5*time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, email := range emails {
+			if email.ID == id {
+				return email
+			}
+		}
+		return nil
+	}
+
+	// A transient failure is retried once its backoff has passed.
+	retried := enqueue()
+	email := claim(retried.ID)
+	if email == nil {
+		t.Fatal("new email not claimed")
+	}
+	if email.Data["userName"] != "Test" {
+		t.Errorf("got data %v; want the template data back", email.Data)
+	}
+	if claim(retried.ID) != nil {
+		t.Error("claimed email was claimed again within its lease")
+	}
+
+	email.Fail(errors.New("connection reset"), false, 3, time.Now())
+	if err := m.EmailOutbox.SaveAttempt(email); err != nil {
+		t.Fatal(err)
+	}
+	if claim(retried.ID) != nil {
+		t.Error("email claimed before its backoff passed")
+	}
+
+	due(retried.ID)
+	email = claim(retried.ID)
+	if email == nil || email.Attempts != 1 {
+		t.Fatalf("retry: got %+v; want the email back after 1 attempt", email)
+	}
+	if err := m.EmailOutbox.MarkSent(email); err != nil {
+		t.Fatal(err)
+	}
+	if email.Status != EmailStatusSent || email.Attempts != 2 || email.SentAt == nil {
+		t.Errorf("got %s after %d attempts; want sent after 2", email.Status, email.Attempts)
+	}
+
+	// A permanent failure is dead-lettered and never retried until requeued.
+	deadLettered := enqueue()
+	email = claim(deadLettered.ID)
+	email.Fail(errors.New("unknown email template"), true, 3, time.Now())
+	if err := m.EmailOutbox.SaveAttempt(email); err != nil {
+		t.Fatal(err)
+	}
+
+	due(deadLettered.ID)
+	if claim(deadLettered.ID) != nil {
+		t.Error("dead-lettered email was claimed")
+	}
+
+	dead, _, err := m.EmailOutbox.GetAll(EmailStatusDead, Filters{
+		Page:         1,
+		PageSize:     100,
+		Sort:         "-created_at",
+		SortSafelist: []string{"-created_at"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, email := range dead {
+		found = found || email.ID == deadLettered.ID
+	}
+	if !found {
+		t.Error("dead-lettered email isn't listed as dead")
+	}
+
+	requeued, err := m.EmailOutbox.Requeue(deadLettered.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requeued.Status != EmailStatusPending || requeued.Attempts != 0 {
+		t.Errorf("requeued: got %s after %d attempts; want pending with none", requeued.Status, requeued.Attempts)
+	}
+	if _, err := m.EmailOutbox.Requeue(retried.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("requeueing a sent email: got %v; want ErrRecordNotFound", err)
+	}
+}
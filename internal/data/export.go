@@ -0,0 +1,367 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserExport is the full set of records held about a single user, as returned
+// for a data access request.
+type UserExport struct {
+	GeneratedAt     time.Time         `json:"generated_at"`
+	Profile         *User             `json:"profile"`
+	Vehicles        []*Vehicle        `json:"vehicles"`
+	Reservations    []*Reservation    `json:"reservations"`
+	ParkingSessions []*ParkingSession `json:"parking_sessions"`
+	Payments        []*Payment        `json:"payments"`
+	Reviews         []*Review         `json:"reviews"`
+	Notifications   []*Notification   `json:"notifications"`
+}
+
+// ExportUserData gathers everything stored about a user across the models. All
+// queries run inside one read-only transaction so the export is a consistent
+// snapshot and shares a single timeout.
+func (m Models) ExportUserData(userID uuid.UUID) (UserExport, error) {
+	ctx, cancel := m.Users.longQueryContext()
+	defer cancel()
+
+	export := UserExport{GeneratedAt: time.Now()}
+
+	tx, err := m.Users.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return export, err
+	}
+	defer tx.Rollback()
+
+	export.Profile, err = exportProfile(ctx, tx, userID)
+	if err != nil {
+		return export, err
+	}
+
+	export.Vehicles, err = exportVehicles(ctx, tx, userID)
+	if err != nil {
+		return export, err
+	}
+
+	export.Reservations, err = exportReservations(ctx, tx, userID)
+	if err != nil {
+		return export, err
+	}
+
+	export.ParkingSessions, err = exportParkingSessions(ctx, tx, userID)
+	if err != nil {
+		return export, err
+	}
+
+	export.Payments, err = exportPayments(ctx, tx, userID)
+	if err != nil {
+		return export, err
+	}
+
+	export.Reviews, err = exportReviews(ctx, tx, userID)
+	if err != nil {
+		return export, err
+	}
+
+	export.Notifications, err = exportNotifications(ctx, tx, userID)
+	if err != nil {
+		return export, err
+	}
+
+	return export, tx.Commit()
+}
+
+func exportProfile(ctx context.Context, tx *sql.Tx, userID uuid.UUID) (*User, error) {
+	query := `
+		SELECT id, created_at, updated_at, user_name, email, first_name, last_name, mobile_number, avatar_url, user_role, authtype, activated, has_completed_onboarding, has_disability_permit, disability_permit_number, version
+		FROM users
+		WHERE id = $1 AND deleted_at IS NULL`
+
+	var user User
+
+	err := tx.QueryRowContext(ctx, query, userID).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.UserName,
+		&user.Email,
+		&user.FirstName,
+		&user.LastName,
+		&user.MobileNumber,
+		&user.AvatarURL,
+		&user.Role,
+		&user.AuthType,
+		&user.Activated,
+		&user.HasCompletedOnboarding,
+		&user.HasDisabilityPermit,
+		&user.DisabilityPermitNumber,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func exportVehicles(ctx context.Context, tx *sql.Tx, userID uuid.UUID) ([]*Vehicle, error) {
+	query := `
+		SELECT id, user_id, license_plate, make, model, color, vehicle_type, preferred_spot_type, is_default, created_at, updated_at, version
+		FROM vehicles
+		WHERE user_id = $1
+		ORDER BY created_at ASC`
+
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vehicles := []*Vehicle{}
+
+	for rows.Next() {
+		var vehicle Vehicle
+
+		err := rows.Scan(
+			&vehicle.ID,
+			&vehicle.UserID,
+			&vehicle.LicensePlate,
+			&vehicle.Make,
+			&vehicle.Model,
+			&vehicle.Color,
+			&vehicle.VehicleType,
+			&vehicle.PreferredSpotType,
+			&vehicle.IsDefault,
+			&vehicle.CreatedAt,
+			&vehicle.UpdatedAt,
+			&vehicle.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		vehicles = append(vehicles, &vehicle)
+	}
+
+	return vehicles, rows.Err()
+}
+
+func exportReservations(ctx context.Context, tx *sql.Tx, userID uuid.UUID) ([]*Reservation, error) {
+	query := `
+		SELECT id, user_id, vehicle_id, parking_lot_id, parking_spot_id, start_time, end_time, actual_start_time, actual_end_time, status, total_amount, created_at, updated_at, version
+		FROM reservations
+		WHERE user_id = $1
+		ORDER BY start_time ASC`
+
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reservations := []*Reservation{}
+
+	for rows.Next() {
+		var reservation Reservation
+
+		err := rows.Scan(
+			&reservation.ID,
+			&reservation.UserID,
+			&reservation.VehicleID,
+			&reservation.ParkingLotID,
+			&reservation.ParkingSpotID,
+			&reservation.StartTime,
+			&reservation.EndTime,
+			&reservation.ActualStartTime,
+			&reservation.ActualEndTime,
+			&reservation.Status,
+			&reservation.TotalAmount,
+			&reservation.CreatedAt,
+			&reservation.UpdatedAt,
+			&reservation.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		reservations = append(reservations, &reservation)
+	}
+
+	return reservations, rows.Err()
+}
+
+func exportParkingSessions(ctx context.Context, tx *sql.Tx, userID uuid.UUID) ([]*ParkingSession, error) {
+	query := `
+		SELECT id, reservation_id, user_id, vehicle_id, parking_spot_id, check_in_time, check_out_time, status, total_duration, total_amount, expected_end, prepaid_amount, created_at, updated_at, version
+		FROM parking_sessions
+		WHERE user_id = $1
+		ORDER BY check_in_time ASC`
+
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*ParkingSession{}
+
+	for rows.Next() {
+		var session ParkingSession
+
+		err := rows.Scan(
+			&session.ID,
+			&session.ReservationID,
+			&session.UserID,
+			&session.VehicleID,
+			&session.ParkingSpotID,
+			&session.CheckInTime,
+			&session.CheckOutTime,
+			&session.Status,
+			&session.TotalDuration,
+			&session.TotalAmount,
+			&session.ExpectedEnd,
+			&session.PrepaidAmount,
+			&session.CreatedAt,
+			&session.UpdatedAt,
+			&session.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, &session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func exportPayments(ctx context.Context, tx *sql.Tx, userID uuid.UUID) ([]*Payment, error) {
+	query := `
+		SELECT id, reservation_id, user_id, amount, currency, payment_method, status, transaction_id, payment_date, refunded_amount, created_at, updated_at, version
+		FROM payments
+		WHERE user_id = $1
+		ORDER BY payment_date ASC`
+
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := []*Payment{}
+
+	for rows.Next() {
+		var payment Payment
+
+		err := rows.Scan(
+			&payment.ID,
+			&payment.ReservationID,
+			&payment.UserID,
+			&payment.Amount,
+			&payment.Currency,
+			&payment.PaymentMethod,
+			&payment.Status,
+			&payment.TransactionID,
+			&payment.PaymentDate,
+			&payment.RefundedAmount,
+			&payment.CreatedAt,
+			&payment.UpdatedAt,
+			&payment.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		payments = append(payments, &payment)
+	}
+
+	return payments, rows.Err()
+}
+
+func exportReviews(ctx context.Context, tx *sql.Tx, userID uuid.UUID) ([]*Review, error) {
+	query := `
+		SELECT id, user_id, parking_lot_id, rating, comment, created_at, updated_at, version
+		FROM reviews
+		WHERE user_id = $1
+		ORDER BY created_at ASC`
+
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []*Review{}
+
+	for rows.Next() {
+		var review Review
+
+		err := rows.Scan(
+			&review.ID,
+			&review.UserID,
+			&review.ParkingLotID,
+			&review.Rating,
+			&review.Comment,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&review.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		reviews = append(reviews, &review)
+	}
+
+	return reviews, rows.Err()
+}
+
+func exportNotifications(ctx context.Context, tx *sql.Tx, userID uuid.UUID) ([]*Notification, error) {
+	query := `
+		SELECT id, user_id, type, title, message, is_read, archived, data, created_at, updated_at, version
+		FROM notifications
+		WHERE user_id = $1
+		ORDER BY created_at ASC`
+
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []*Notification{}
+
+	for rows.Next() {
+		var notification Notification
+
+		err := rows.Scan(
+			&notification.ID,
+			&notification.UserID,
+			&notification.Type,
+			&notification.Title,
+			&notification.Message,
+			&notification.IsRead,
+			&notification.Archived,
+			&notification.Data,
+			&notification.CreatedAt,
+			&notification.UpdatedAt,
+			&notification.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		notifications = append(notifications, &notification)
+	}
+
+	return notifications, rows.Err()
+}
@@ -0,0 +1,49 @@
+package data
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportUserData(t *testing.T) {
+	m := newTestModels(t)
+
+	user := insertTestUser(t, m)
+	other := insertTestUser(t, m)
+
+	lot, spots := insertTestLot(t, m, other.ID, 2)
+	vehicle := insertTestVehicle(t, m, user.ID)
+	otherVehicle := insertTestVehicle(t, m, other.ID)
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	reservation := insertTestReservation(t, m, vehicle, lot.ID, spots[0], start, 2*time.Hour)
+	insertTestReservation(t, m, otherVehicle, lot.ID, spots[1], start, 2*time.Hour)
+
+	export, err := m.ExportUserData(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if export.Profile == nil || export.Profile.ID != user.ID {
+		t.Fatalf("profile: got %+v; want user %s", export.Profile, user.ID)
+	}
+	if len(export.Vehicles) != 1 || export.Vehicles[0].ID != vehicle.ID {
+		t.Errorf("vehicles: got %d; want only the user's own vehicle", len(export.Vehicles))
+	}
+	if len(export.Reservations) != 1 || export.Reservations[0].ID != reservation.ID {
+		t.Errorf("reservations: got %d; want only the user's own reservation", len(export.Reservations))
+	}
+
+	js, err := json.Marshal(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(js), "password") {
+		t.Error("export contains the password hash")
+	}
+	if strings.Contains(string(js), other.Email) || strings.Contains(string(js), otherVehicle.LicensePlate) {
+		t.Error("export contains another user's data")
+	}
+}
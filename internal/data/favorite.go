@@ -0,0 +1,153 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FavoriteLot is a parking lot the user has saved, along with some summary
+// stats so the list can be rendered without a request per lot.
+type FavoriteLot struct {
+	ParkingLot
+	FavoritedAt   time.Time `json:"favorited_at"`
+	AverageRating float64   `json:"average_rating"`
+	TotalReviews  int       `json:"total_reviews"`
+}
+
+type FavoriteModel struct {
+	DB *sql.DB
+	queryScope
+}
+
+// Add saves a lot as a favorite. Adding a lot that is already a favorite is a no-op.
+func (m FavoriteModel) Add(userID, lotID uuid.UUID) error {
+	query := `
+		INSERT INTO favorites (user_id, parking_lot_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, parking_lot_id) DO NOTHING`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, lotID)
+	return err
+}
+
+// Remove deletes a favorite. Removing a lot that isn't a favorite is a no-op.
+func (m FavoriteModel) Remove(userID, lotID uuid.UUID) error {
+	query := `
+		DELETE FROM favorites
+		WHERE user_id = $1 AND parking_lot_id = $2`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, lotID)
+	return err
+}
+
+func (m FavoriteModel) IsFavorite(userID, lotID uuid.UUID) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM favorites
+			WHERE user_id = $1 AND parking_lot_id = $2
+		)`
+
+	var exists bool
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, lotID).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (m FavoriteModel) GetForUser(userID uuid.UUID, filters Filters) ([]*FavoriteLot, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), pl.id, pl.name, pl.address, pl.latitude, pl.longitude, pl.total_spots, pl.hourly_rate, pl.daily_rate, pl.monthly_rate,
+		       pl.open_time, pl.close_time, pl.is_active, pl.is_refundable, pl.timezone, pl.tax_rate, pl.violation_fee, pl.max_reservation_days, pl.max_advance_days, pl.vehicle_type_multipliers, pl.min_lead_minutes, pl.overbooking_percent, pl.owner_id, pl.created_at, pl.updated_at, pl.version,
+		       f.created_at AS favorited_at,
+		       COALESCE(r.average_rating, 0) AS average_rating,
+		       COALESCE(r.total_reviews, 0) AS total_reviews
+		FROM favorites f
+		INNER JOIN parking_lots pl ON pl.id = f.parking_lot_id
+		LEFT JOIN (
+			SELECT parking_lot_id, AVG(rating)::float AS average_rating, COUNT(*) AS total_reviews
+			FROM reviews
+			WHERE is_hidden = false
+			GROUP BY parking_lot_id
+		) r ON r.parking_lot_id = pl.id
+		WHERE f.user_id = $1
+		ORDER BY %s %s, pl.id ASC
+		LIMIT $2 OFFSET $3`
+
+	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	favorites := []*FavoriteLot{}
+
+	for rows.Next() {
+		var favorite FavoriteLot
+
+		err := rows.Scan(
+			&totalRecords,
+			&favorite.ID,
+			&favorite.Name,
+			&favorite.Address,
+			&favorite.Latitude,
+			&favorite.Longitude,
+			&favorite.TotalSpots,
+			&favorite.HourlyRate,
+			&favorite.DailyRate,
+			&favorite.MonthlyRate,
+			&favorite.OpenTime,
+			&favorite.CloseTime,
+			&favorite.IsActive,
+			&favorite.IsRefundable,
+			&favorite.Timezone,
+			&favorite.TaxRate,
+			&favorite.ViolationFee,
+			&favorite.MaxReservationDays,
+			&favorite.MaxAdvanceDays,
+			&favorite.VehicleTypeMultipliers,
+			&favorite.MinLeadMinutes,
+			&favorite.OverbookingPercent,
+			&favorite.OwnerID,
+			&favorite.CreatedAt,
+			&favorite.UpdatedAt,
+			&favorite.Version,
+			&favorite.FavoritedAt,
+			&favorite.AverageRating,
+			&favorite.TotalReviews,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		favorites = append(favorites, &favorite)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return favorites, metadata, nil
+}
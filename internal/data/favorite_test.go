@@ -0,0 +1,85 @@
+package data
+
+import "testing"
+
+func TestFavoritesAddRemoveIdempotent(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+	owner := insertTestUser(t, m)
+	lot, _ := insertTestLot(t, m, owner.ID, 1)
+
+	isFavorite := func() bool {
+		t.Helper()
+		ok, err := m.Favorites.IsFavorite(user.ID, lot.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := m.Favorites.Add(user.ID, lot.ID); err != nil {
+			t.Fatalf("add %d: %v", i+1, err)
+		}
+	}
+	if !isFavorite() {
+		t.Error("lot is not a favorite after adding it")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := m.Favorites.Remove(user.ID, lot.ID); err != nil {
+			t.Fatalf("remove %d: %v", i+1, err)
+		}
+	}
+	if isFavorite() {
+		t.Error("lot is still a favorite after removing it")
+	}
+}
+
+func TestFavoritesListing(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+	other := insertTestUser(t, m)
+	owner := insertTestUser(t, m)
+
+	first, _ := insertTestLot(t, m, owner.ID, 1)
+	second, _ := insertTestLot(t, m, owner.ID, 1)
+	notFavorited, _ := insertTestLot(t, m, owner.ID, 1)
+
+	for _, lot := range []*ParkingLot{first, second, first} {
+		if err := m.Favorites.Add(user.ID, lot.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Favorites.Add(other.ID, notFavorited.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	favorites, metadata, err := m.Favorites.GetForUser(user.ID, Filters{
+		Page:         1,
+		PageSize:     20,
+		Sort:         "name",
+		SortSafelist: []string{"name"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if metadata.TotalRecords != 2 || len(favorites) != 2 {
+		t.Fatalf("got %d favorites (%d total); want 2", len(favorites), metadata.TotalRecords)
+	}
+
+	got := map[string]bool{}
+	for _, favorite := range favorites {
+		got[favorite.ID.String()] = true
+		if favorite.FavoritedAt.IsZero() {
+			t.Errorf("favorite %s has no favorited_at", favorite.ID)
+		}
+	}
+	if !got[first.ID.String()] || !got[second.ID.String()] {
+		t.Errorf("listing %v is missing a favorited lot", got)
+	}
+	if got[notFavorited.ID.String()] {
+		t.Error("listing includes another user's favorite")
+	}
+}
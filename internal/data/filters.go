@@ -16,11 +16,22 @@ type Filters struct {
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int        `json:"current_page,omitempty"`
+	PageSize     int        `json:"page_size,omitempty"`
+	FirstPage    int        `json:"first_page,omitempty"`
+	LastPage     int        `json:"last_page,omitempty"`
+	TotalRecords int        `json:"total_records,omitempty"`
+	Links        *PageLinks `json:"links,omitempty"`
+}
+
+// PageLinks are URLs to neighbouring pages of a list. Next and Prev are empty
+// on the last and first page.
+type PageLinks struct {
+	Self  string `json:"self"`
+	First string `json:"first"`
+	Prev  string `json:"prev,omitempty"`
+	Next  string `json:"next,omitempty"`
+	Last  string `json:"last"`
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
@@ -71,3 +82,21 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 		TotalRecords: totalRecords,
 	}
 }
+
+// paginate applies the filters' page and page size to a result set that has
+// already been fetched and ordered in memory.
+func paginate[T any](items []T, filters Filters) ([]T, Metadata) {
+	metadata := calculateMetadata(len(items), filters.Page, filters.PageSize)
+
+	start := filters.offset()
+	if start >= len(items) {
+		return []T{}, metadata
+	}
+
+	end := start + filters.limit()
+	if end > len(items) {
+		end = len(items)
+	}
+
+	return items[start:end], metadata
+}
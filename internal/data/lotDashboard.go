@@ -0,0 +1,92 @@
+package data
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LotDashboard gathers the figures an owner's dashboard shows for a lot.
+// Occupancy, active sessions and upcoming reservations are as of now; revenue
+// and violations cover the dashboard's period.
+type LotDashboard struct {
+	ActiveSpots          int     `json:"active_spots"`
+	OccupiedSpots        int     `json:"occupied_spots"`
+	Occupancy            float64 `json:"occupancy"` // fraction of active spots occupied
+	Revenue              float64 `json:"revenue"`
+	ActiveSessions       int     `json:"active_sessions"`
+	UpcomingReservations int     `json:"upcoming_reservations"`
+	AverageRating        float64 `json:"average_rating"`
+	TotalReviews         int     `json:"total_reviews"`
+	Violations           int     `json:"violations"`
+}
+
+// GetDashboard returns the lot's dashboard figures in one query. Revenue counts
+// completed payments made in [start, end), and violations the sessions checked
+// in during it that were marked as violations.
+func (m ParkingLotModel) GetDashboard(lotID uuid.UUID, start, end time.Time) (LotDashboard, error) {
+	query := `
+		SELECT spots.active, spots.occupied,
+		       (SELECT COALESCE(SUM(p.amount), 0)
+		        FROM payments p
+		        INNER JOIN reservations r ON r.id = p.reservation_id
+		        WHERE r.parking_lot_id = $1 AND p.status = $2 AND p.payment_date >= $3 AND p.payment_date < $4),
+		       sessions.active, sessions.violations,
+		       (SELECT COUNT(*)
+		        FROM reservations
+		        WHERE parking_lot_id = $1 AND status = $5 AND start_time > NOW()),
+		       reviews.average_rating, reviews.total_reviews
+		FROM (
+			SELECT COUNT(*) FILTER (WHERE status = $6) AS active,
+			       COUNT(*) FILTER (WHERE status = $6 AND is_occupied) AS occupied
+			FROM parking_spots
+			WHERE parking_lot_id = $1
+		) spots, (
+			SELECT COUNT(*) FILTER (WHERE s.status = $7) AS active,
+			       COUNT(*) FILTER (WHERE s.status = $8 AND s.check_in_time >= $3 AND s.check_in_time < $4) AS violations
+			FROM parking_sessions s
+			INNER JOIN parking_spots ps ON ps.id = s.parking_spot_id
+			WHERE ps.parking_lot_id = $1
+		) sessions, (
+			SELECT COALESCE(AVG(rating), 0)::float AS average_rating, COUNT(*) AS total_reviews
+			FROM reviews
+			WHERE parking_lot_id = $1 AND is_hidden = false
+		) reviews`
+
+	args := []any{
+		lotID,
+		PaymentStatusCompleted,
+		start,
+		end,
+		ReservationStatusConfirmed,
+		SpotStatusActive,
+		SessionStatusActive,
+		SessionStatusViolated,
+	}
+
+	var dashboard LotDashboard
+
+	ctx, cancel := m.longQueryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&dashboard.ActiveSpots,
+		&dashboard.OccupiedSpots,
+		&dashboard.Revenue,
+		&dashboard.ActiveSessions,
+		&dashboard.Violations,
+		&dashboard.UpcomingReservations,
+		&dashboard.AverageRating,
+		&dashboard.TotalReviews,
+	)
+	if err != nil {
+		return LotDashboard{}, err
+	}
+
+	dashboard.Revenue = RoundMoney(dashboard.Revenue)
+	if dashboard.ActiveSpots > 0 {
+		dashboard.Occupancy = float64(dashboard.OccupiedSpots) / float64(dashboard.ActiveSpots)
+	}
+
+	return dashboard, nil
+}
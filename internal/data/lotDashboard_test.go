@@ -0,0 +1,75 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetDashboard(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	lot, spots := insertTestLot(t, m, owner.ID, 4)
+	other, otherSpots := insertTestLot(t, m, owner.ID, 1)
+	vehicle := insertTestVehicle(t, m, owner.ID)
+
+	now := time.Now()
+	start, end := now.Add(-time.Hour), now.Add(time.Hour)
+
+	exec := func(query string, args ...any) {
+		t.Helper()
+		if _, err := m.ParkingLots.DB.Exec(query, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Three active spots, one of them occupied
+	exec(`UPDATE parking_spots SET status = $1 WHERE id = $2`, SpotStatusMaintenance, spots[3].ID)
+	if err := m.ParkingSpots.SetOccupied(spots[0].ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// One active session, and violations in and before the period
+	insertTestSession(t, m, owner.ID, spots[0], now.Add(-30*time.Minute))
+	violated := insertTestSession(t, m, owner.ID, spots[1], now.Add(-30*time.Minute))
+	earlier := insertTestSession(t, m, owner.ID, spots[2], now.Add(-3*time.Hour))
+	exec(`UPDATE parking_sessions SET status = $1 WHERE id IN ($2, $3)`, SessionStatusViolated, violated.ID, earlier.ID)
+
+	// Revenue counts completed payments made in the period
+	past := insertTestReservation(t, m, vehicle, lot.ID, spots[1], now.Add(-3*time.Hour), time.Hour)
+	insertTestPayment(t, m, past, 50, PaymentStatusCompleted)
+	insertTestPayment(t, m, past, 25.5, PaymentStatusCompleted)
+	insertTestPayment(t, m, past, 100, PaymentStatusPending)
+	old := insertTestPayment(t, m, past, 100, PaymentStatusCompleted)
+	exec(`UPDATE payments SET payment_date = $1 WHERE id = $2`, now.Add(-48*time.Hour), old.ID)
+
+	otherReservation := insertTestReservation(t, m, vehicle, other.ID, otherSpots[0], now.Add(-3*time.Hour), time.Hour)
+	insertTestPayment(t, m, otherReservation, 100, PaymentStatusCompleted)
+
+	// Two upcoming confirmed reservations
+	insertTestReservation(t, m, vehicle, lot.ID, spots[1], now.Add(24*time.Hour), time.Hour)
+	insertTestReservation(t, m, vehicle, lot.ID, spots[2], now.Add(24*time.Hour), time.Hour)
+	cancelled := insertTestReservation(t, m, vehicle, lot.ID, spots[1], now.Add(48*time.Hour), time.Hour)
+	exec(`UPDATE reservations SET status = $1 WHERE id = $2`, ReservationStatusCancelled, cancelled.ID)
+
+	insertTestReviews(t, m, lot.ID, 4, 5)
+
+	dashboard, err := m.ParkingLots.GetDashboard(lot.ID, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := LotDashboard{
+		ActiveSpots:          3,
+		OccupiedSpots:        1,
+		Occupancy:            1.0 / 3,
+		Revenue:              75.5,
+		ActiveSessions:       1,
+		UpcomingReservations: 2,
+		AverageRating:        4.5,
+		TotalReviews:         2,
+		Violations:           1,
+	}
+	if dashboard != want {
+		t.Errorf("dashboard = %+v\nwant %+v", dashboard, want)
+	}
+}
@@ -0,0 +1,147 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAlreadyOperator = errors.New("user is already an operator of this lot")
+)
+
+// Lot roles. The owner can do anything with a lot; operators are staff who run
+// it day to day, checking drivers in and out and handling sessions and
+// violations, but can't change or delete the lot, its spots or its pricing.
+const (
+	LotRoleOwner    = "owner"
+	LotRoleOperator = "operator"
+)
+
+// LotOperator is a user who operates a lot on its owner's behalf.
+type LotOperator struct {
+	ParkingLotID uuid.UUID `json:"parking_lot_id"`
+	UserID       uuid.UUID `json:"user_id"`
+	UserName     string    `json:"username"`
+	Email        string    `json:"email"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type LotOperatorModel struct {
+	DB *sql.DB
+	queryScope
+}
+
+// Add makes the user an operator of the lot. Adding an existing operator
+// returns ErrAlreadyOperator.
+func (m LotOperatorModel) Add(operator *LotOperator) error {
+	query := `
+		INSERT INTO lot_operators (parking_lot_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (parking_lot_id, user_id) DO NOTHING
+		RETURNING created_at`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, operator.ParkingLotID, operator.UserID).Scan(&operator.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrAlreadyOperator
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m LotOperatorModel) Remove(lotID, userID uuid.UUID) error {
+	query := `DELETE FROM lot_operators WHERE parking_lot_id = $1 AND user_id = $2`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, lotID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// IsOperator reports whether the user operates the lot.
+func (m LotOperatorModel) IsOperator(lotID, userID uuid.UUID) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM lot_operators WHERE parking_lot_id = $1 AND user_id = $2)`
+
+	var isOperator bool
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, lotID, userID).Scan(&isOperator)
+	return isOperator, err
+}
+
+// OperatesAny reports whether the user operates at least one lot.
+func (m LotOperatorModel) OperatesAny(userID uuid.UUID) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM lot_operators WHERE user_id = $1)`
+
+	var operates bool
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&operates)
+	return operates, err
+}
+
+// GetAllForLot returns the lot's operators, longest serving first.
+func (m LotOperatorModel) GetAllForLot(lotID uuid.UUID) ([]*LotOperator, error) {
+	query := `
+		SELECT lo.parking_lot_id, lo.user_id, u.user_name, u.email, lo.created_at
+		FROM lot_operators lo
+		INNER JOIN users u ON u.id = lo.user_id
+		WHERE lo.parking_lot_id = $1 AND u.deleted_at IS NULL
+		ORDER BY lo.created_at ASC, lo.user_id ASC`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, lotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	operators := []*LotOperator{}
+
+	for rows.Next() {
+		var operator LotOperator
+
+		err := rows.Scan(&operator.ParkingLotID, &operator.UserID, &operator.UserName, &operator.Email, &operator.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		operators = append(operators, &operator)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return operators, nil
+}
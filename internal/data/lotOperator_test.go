@@ -0,0 +1,55 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLotOperators(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	operator := insertTestUser(t, m)
+	lot, _ := insertTestLot(t, m, owner.ID, 0)
+	otherLot, _ := insertTestLot(t, m, owner.ID, 0)
+
+	added := &LotOperator{ParkingLotID: lot.ID, UserID: operator.ID}
+	if err := m.LotOperators.Add(added); err != nil {
+		t.Fatal(err)
+	}
+	if added.CreatedAt.IsZero() {
+		t.Error("created_at not set")
+	}
+	err := m.LotOperators.Add(&LotOperator{ParkingLotID: lot.ID, UserID: operator.ID})
+	if !errors.Is(err, ErrAlreadyOperator) {
+		t.Errorf("adding twice: got %v; want %v", err, ErrAlreadyOperator)
+	}
+
+	// Operating one lot gives nothing at another of the owner's
+	if ok, err := m.LotOperators.IsOperator(lot.ID, operator.ID); err != nil || !ok {
+		t.Errorf("IsOperator = %t, %v; want true", ok, err)
+	}
+	if ok, err := m.LotOperators.IsOperator(otherLot.ID, operator.ID); err != nil || ok {
+		t.Errorf("IsOperator at another lot = %t, %v; want false", ok, err)
+	}
+	if ok, err := m.LotOperators.OperatesAny(operator.ID); err != nil || !ok {
+		t.Errorf("OperatesAny = %t, %v; want true", ok, err)
+	}
+
+	operators, err := m.LotOperators.GetAllForLot(lot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(operators) != 1 || operators[0].UserID != operator.ID || operators[0].Email != operator.Email {
+		t.Errorf("got operators %+v; want only %s", operators, operator.Email)
+	}
+
+	if err := m.LotOperators.Remove(lot.ID, operator.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.LotOperators.Remove(lot.ID, operator.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("removing twice: got %v; want %v", err, ErrRecordNotFound)
+	}
+	if ok, err := m.LotOperators.OperatesAny(operator.ID); err != nil || ok {
+		t.Errorf("OperatesAny after removal = %t, %v; want false", ok, err)
+	}
+}
@@ -0,0 +1,203 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	LoyaltyKindAccrual    = "accrual"
+	LoyaltyKindRedemption = "redemption"
+)
+
+const (
+	// LoyaltyPointsPerUnit is how many points each whole currency unit paid earns.
+	LoyaltyPointsPerUnit = 1
+	// LoyaltyPointValue is the discount one point is worth when redeemed.
+	LoyaltyPointValue = 0.01
+)
+
+var ErrInsufficientPoints = errors.New("insufficient loyalty points")
+
+// LoyaltyTransaction is one entry of a user's points ledger. Accruals are
+// positive and redemptions negative.
+type LoyaltyTransaction struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	UserID        uuid.UUID  `json:"user_id" db:"user_id"`
+	Kind          string     `json:"kind" db:"kind"`
+	Points        int        `json:"points" db:"points"`
+	PaymentID     *uuid.UUID `json:"payment_id" db:"payment_id"`
+	ReservationID *uuid.UUID `json:"reservation_id" db:"reservation_id"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+}
+
+// PointsRedemption is the loyalty points spent on a reservation at booking time.
+type PointsRedemption struct {
+	Points   int     `json:"points"`
+	Discount float64 `json:"discount"`
+}
+
+// PointsEarned is how many points a payment of amount earns.
+func PointsEarned(amount float64) int {
+	return int(math.Floor(amount)) * LoyaltyPointsPerUnit
+}
+
+// RedeemablePoints caps points so their discount doesn't exceed amount.
+func RedeemablePoints(points int, amount float64) int {
+	max := int(math.Floor(amount / LoyaltyPointValue))
+	if points > max {
+		return max
+	}
+	return points
+}
+
+// PointsDiscount is the discount the given number of points buys.
+func PointsDiscount(points int) float64 {
+	return RoundMoney(float64(points) * LoyaltyPointValue)
+}
+
+type LoyaltyModel struct {
+	DB *sql.DB
+	queryScope
+}
+
+func (m LoyaltyModel) GetBalance(userID uuid.UUID) (int, error) {
+	query := `SELECT loyalty_points FROM users WHERE id = $1`
+
+	var balance int
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&balance)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return balance, nil
+}
+
+func (m LoyaltyModel) GetAllForUser(userID uuid.UUID, filters Filters) ([]*LoyaltyTransaction, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, user_id, kind, points, payment_id, reservation_id, created_at
+		FROM loyalty_transactions
+		WHERE user_id = $1
+		ORDER BY %s %s, id ASC
+		LIMIT $2 OFFSET $3`
+
+	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	args := []any{userID, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	transactions := []*LoyaltyTransaction{}
+
+	for rows.Next() {
+		var transaction LoyaltyTransaction
+
+		err := rows.Scan(
+			&totalRecords,
+			&transaction.ID,
+			&transaction.UserID,
+			&transaction.Kind,
+			&transaction.Points,
+			&transaction.PaymentID,
+			&transaction.ReservationID,
+			&transaction.CreatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		transactions = append(transactions, &transaction)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return transactions, metadata, nil
+}
+
+// Accrue credits the points a completed payment earns, inside tx. A payment
+// only ever earns points once, however many times it is marked completed.
+func (m LoyaltyModel) Accrue(ctx context.Context, tx *sql.Tx, paymentID, userID uuid.UUID, amount float64) error {
+	points := PointsEarned(amount)
+	if points <= 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO loyalty_transactions (user_id, kind, points, payment_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (payment_id) WHERE kind = 'accrual' DO NOTHING`
+
+	result, err := tx.ExecContext(ctx, query, userID, LoyaltyKindAccrual, points, paymentID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE users SET loyalty_points = loyalty_points + $1 WHERE id = $2`, points, userID)
+	return err
+}
+
+// Redeem spends points on a reservation inside tx. It returns
+// ErrInsufficientPoints when the balance doesn't cover them.
+func (m LoyaltyModel) Redeem(ctx context.Context, tx *sql.Tx, redemption *PointsRedemption, reservation *Reservation) error {
+	query := `
+		UPDATE users
+		SET loyalty_points = loyalty_points - $1
+		WHERE id = $2 AND loyalty_points >= $1`
+
+	result, err := tx.ExecContext(ctx, query, redemption.Points, reservation.UserID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrInsufficientPoints
+	}
+
+	query = `
+		INSERT INTO loyalty_transactions (user_id, kind, points, reservation_id)
+		VALUES ($1, $2, $3, $4)`
+
+	_, err = tx.ExecContext(ctx, query, reservation.UserID, LoyaltyKindRedemption, -redemption.Points, reservation.ID)
+	return err
+}
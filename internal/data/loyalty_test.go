@@ -0,0 +1,134 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPointsArithmetic(t *testing.T) {
+	if got := PointsEarned(149.99); got != 149 {
+		t.Errorf("PointsEarned(149.99) = %d; want 149", got)
+	}
+	if got := PointsEarned(0.5); got != 0 {
+		t.Errorf("PointsEarned(0.5) = %d; want 0", got)
+	}
+	if got := RedeemablePoints(5000, 20); got != 2000 {
+		t.Errorf("RedeemablePoints(5000, 20) = %d; want 2000", got)
+	}
+	if got := RedeemablePoints(300, 20); got != 300 {
+		t.Errorf("RedeemablePoints(300, 20) = %d; want 300", got)
+	}
+	if got := PointsDiscount(250); got != 2.5 {
+		t.Errorf("PointsDiscount(250) = %v; want 2.5", got)
+	}
+}
+
+func TestReservationApplyPoints(t *testing.T) {
+	r := &Reservation{TotalAmount: MoneyFromFloat(10)}
+	r.ApplyPoints(250)
+	if r.Points == nil || r.Points.Points != 250 || r.TotalAmount != MoneyFromFloat(7.5) {
+		t.Errorf("got points %+v, total %v; want 250 points taking 2.50 off", r.Points, r.TotalAmount)
+	}
+
+	// Points never take the amount below zero.
+	r = &Reservation{TotalAmount: MoneyFromFloat(10)}
+	r.ApplyPoints(5000)
+	if r.Points == nil || r.Points.Points != 1000 || r.TotalAmount != 0 {
+		t.Errorf("got points %+v, total %v; want 1000 points covering the whole amount", r.Points, r.TotalAmount)
+	}
+
+	r = &Reservation{TotalAmount: MoneyFromFloat(10)}
+	r.ApplyPoints(0)
+	if r.Points != nil || r.TotalAmount != MoneyFromFloat(10) {
+		t.Errorf("got points %+v, total %v; want nothing applied", r.Points, r.TotalAmount)
+	}
+}
+
+func TestLoyaltyAccrualAndRedemption(t *testing.T) {
+	m := newTestModels(t)
+
+	user := insertTestUser(t, m)
+	vehicle := insertTestVehicle(t, m, user.ID)
+	lot, spots := insertTestLot(t, m, user.ID, 2)
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+
+	balance := func() int {
+		t.Helper()
+		points, err := m.Loyalty.GetBalance(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return points
+	}
+
+	reservation := insertTestReservation(t, m, vehicle, lot.ID, spots[0], start, time.Hour)
+
+	// Pending payments earn nothing until they complete, and completing the
+	// same payment twice only earns once.
+	payment := insertTestPayment(t, m, reservation, 350.75, PaymentStatusPending)
+	if got := balance(); got != 0 {
+		t.Errorf("got %d points for a pending payment; want 0", got)
+	}
+	for i := 0; i < 2; i++ {
+		if err := m.Payments.UpdateStatus(payment.ID, PaymentStatusCompleted, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := balance(); got != 350 {
+		t.Errorf("got %d points after completion; want 350", got)
+	}
+
+	booking := &Reservation{
+		UserID:        user.ID,
+		VehicleID:     vehicle.ID,
+		ParkingLotID:  lot.ID,
+		ParkingSpotID: &spots[1].ID,
+		StartTime:     start,
+		EndTime:       start.Add(time.Hour),
+		Status:        ReservationStatusConfirmed,
+		TotalAmount:   MoneyFromFloat(100),
+	}
+	booking.ApplyPoints(200)
+	if err := m.Reservations.Insert(booking); err != nil {
+		t.Fatal(err)
+	}
+	if booking.TotalAmount != MoneyFromFloat(98) {
+		t.Errorf("got total %v; want 98 after 200 points", booking.TotalAmount)
+	}
+	if got := balance(); got != 150 {
+		t.Errorf("got %d points after redeeming 200; want 150", got)
+	}
+
+	// The balance can't be overspent, and the booking isn't kept when it is.
+	over := *booking
+	over.ParkingSpotID = &spots[0].ID
+	over.StartTime, over.EndTime = start.Add(2*time.Hour), start.Add(3*time.Hour)
+	over.Points = &PointsRedemption{Points: 151, Discount: PointsDiscount(151)}
+	if err := m.Reservations.Insert(&over); !errors.Is(err, ErrInsufficientPoints) {
+		t.Errorf("overspending points: got %v; want ErrInsufficientPoints", err)
+	}
+	if got := balance(); got != 150 {
+		t.Errorf("got %d points after a refused redemption; want 150", got)
+	}
+
+	transactions, _, err := m.Loyalty.GetAllForUser(user.ID, Filters{
+		Page:         1,
+		PageSize:     20,
+		Sort:         "created_at",
+		SortSafelist: []string{"created_at"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sum int
+	kinds := map[string]int{}
+	for _, tx := range transactions {
+		sum += tx.Points
+		kinds[tx.Kind]++
+	}
+	if sum != 150 || kinds[LoyaltyKindAccrual] != 1 || kinds[LoyaltyKindRedemption] != 1 {
+		t.Errorf("got ledger %v summing to %d; want one accrual and one redemption summing to 150", kinds, sum)
+	}
+}
@@ -1,8 +1,10 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"time"
 )
 
 var (
@@ -10,34 +12,115 @@ var (
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
+// QueryTimeout bounds each model query. LongQueryTimeout is the budget for
+// reports, analytics and bulk writes that touch many rows. Both are set once
+// at startup.
+var (
+	QueryTimeout     = 3 * time.Second
+	LongQueryTimeout = 10 * time.Second
+)
+
+// queryScope is embedded in every model and holds the context its queries
+// derive from. Models bound to a request with Models.WithContext stop querying
+// once the client goes away; unbound models use context.Background.
+type queryScope struct {
+	ctx context.Context
+}
+
+func (s queryScope) parent() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// queryContext returns the context for a query, cancelled after QueryTimeout.
+func (s queryScope) queryContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(s.parent(), QueryTimeout)
+}
+
+// longQueryContext returns the context for a slow query, cancelled after
+// LongQueryTimeout.
+func (s queryScope) longQueryContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(s.parent(), LongQueryTimeout)
+}
+
 type Models struct {
-	Permissions     PermissionModel
-	Users           UserModal
-	Tokens          TokenModel
-	Vehicles        VehicleModel
-	QRCodes         QRCodeModel
-	ParkingLots     ParkingLotModel
-	ParkingSpots    ParkingSpotModel
-	Reservations    ReservationModel
-	Payments        PaymentModel
-	ParkingSessions ParkingSessionModel
-	Notifications   NotificationModel
-	Reviews         ReviewModel
+	Permissions           PermissionModel
+	Users                 UserModal
+	Tokens                TokenModel
+	Vehicles              VehicleModel
+	QRCodes               QRCodeModel
+	ParkingLots           ParkingLotModel
+	ParkingSpots          ParkingSpotModel
+	Reservations          ReservationModel
+	Payments              PaymentModel
+	ParkingSessions       ParkingSessionModel
+	Notifications         NotificationModel
+	Reviews               ReviewModel
+	RecurringReservations RecurringReservationModel
+	Favorites             FavoriteModel
+	Organizations         OrganizationModel
+	PromoCodes            PromoCodeModel
+	Loyalty               LoyaltyModel
+	EmailOutbox           EmailOutboxModel
+	Webhooks              WebhookModel
+	ChargingSessions      ChargingSessionModel
+	ParkingLotImages      ParkingLotImageModel
+	LotOperators          LotOperatorModel
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Permissions: PermissionModel{DB: db},
-		Users:       UserModal{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Vehicles:    VehicleModel{DB: db},
-		QRCodes:     QRCodeModel{DB: db},
-		ParkingLots:     ParkingLotModel{DB: db},
-		ParkingSpots:    ParkingSpotModel{DB: db},
-		Reservations:    ReservationModel{DB: db},
-		Payments:        PaymentModel{DB: db},
-		ParkingSessions: ParkingSessionModel{DB: db},
-		Notifications:   NotificationModel{DB: db},
-		Reviews:         ReviewModel{DB: db},
+		Permissions:           PermissionModel{DB: db},
+		Users:                 UserModal{DB: db},
+		Tokens:                TokenModel{DB: db},
+		Vehicles:              VehicleModel{DB: db},
+		QRCodes:               QRCodeModel{DB: db},
+		ParkingLots:           ParkingLotModel{DB: db},
+		ParkingSpots:          ParkingSpotModel{DB: db},
+		Reservations:          ReservationModel{DB: db},
+		Payments:              PaymentModel{DB: db},
+		ParkingSessions:       ParkingSessionModel{DB: db},
+		Notifications:         NotificationModel{DB: db},
+		Reviews:               ReviewModel{DB: db},
+		RecurringReservations: RecurringReservationModel{DB: db},
+		Favorites:             FavoriteModel{DB: db},
+		Organizations:         OrganizationModel{DB: db},
+		PromoCodes:            PromoCodeModel{DB: db},
+		Loyalty:               LoyaltyModel{DB: db},
+		EmailOutbox:           EmailOutboxModel{DB: db},
+		Webhooks:              WebhookModel{DB: db},
+		ChargingSessions:      ChargingSessionModel{DB: db},
+		ParkingLotImages:      ParkingLotImageModel{DB: db},
+		LotOperators:          LotOperatorModel{DB: db},
 	}
 }
+
+// WithContext returns a copy of the models whose queries are cancelled along
+// with ctx as well as by their timeouts.
+func (m Models) WithContext(ctx context.Context) Models {
+	m.Permissions.ctx = ctx
+	m.Users.ctx = ctx
+	m.Tokens.ctx = ctx
+	m.Vehicles.ctx = ctx
+	m.QRCodes.ctx = ctx
+	m.ParkingLots.ctx = ctx
+	m.ParkingSpots.ctx = ctx
+	m.Reservations.ctx = ctx
+	m.Payments.ctx = ctx
+	m.ParkingSessions.ctx = ctx
+	m.Notifications.ctx = ctx
+	m.Reviews.ctx = ctx
+	m.RecurringReservations.ctx = ctx
+	m.Favorites.ctx = ctx
+	m.Organizations.ctx = ctx
+	m.PromoCodes.ctx = ctx
+	m.Loyalty.ctx = ctx
+	m.EmailOutbox.ctx = ctx
+	m.Webhooks.ctx = ctx
+	m.ChargingSessions.ctx = ctx
+	m.ParkingLotImages.ctx = ctx
+	m.LotOperators.ctx = ctx
+	return m
+}
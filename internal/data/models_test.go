@@ -0,0 +1,95 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQueryScopeTimeouts(t *testing.T) {
+	timeout, longTimeout := QueryTimeout, LongQueryTimeout
+	t.Cleanup(func() {
+		QueryTimeout, LongQueryTimeout = timeout, longTimeout
+	})
+	QueryTimeout, LongQueryTimeout = time.Minute, time.Hour
+
+	var scope queryScope
+
+	ctx, cancel := scope.queryContext()
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > time.Minute || time.Until(deadline) < 59*time.Second {
+		t.Errorf("query deadline in %s, want about %s", time.Until(deadline), QueryTimeout)
+	}
+
+	ctx, cancel = scope.longQueryContext()
+	defer cancel()
+	deadline, ok = ctx.Deadline()
+	if !ok || time.Until(deadline) > time.Hour || time.Until(deadline) < 59*time.Minute {
+		t.Errorf("long query deadline in %s, want about %s", time.Until(deadline), LongQueryTimeout)
+	}
+
+	// A bound scope is cancelled along with its parent
+	parent, cancelParent := context.WithCancel(context.Background())
+	scope = queryScope{ctx: parent}
+	ctx, cancel = scope.queryContext()
+	defer cancel()
+
+	cancelParent()
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		t.Errorf("query context err = %v after the parent was cancelled, want %v", ctx.Err(), context.Canceled)
+	}
+}
+
+func TestWithContextBindsEveryModel(t *testing.T) {
+	models := NewModels(nil).WithContext(context.Background())
+
+	v := reflect.ValueOf(models)
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+
+		scope := v.Field(i).FieldByName("queryScope")
+		if !scope.IsValid() {
+			t.Errorf("%s doesn't embed queryScope", name)
+			continue
+		}
+		if scope.FieldByName("ctx").IsNil() {
+			t.Errorf("%s isn't bound to the context", name)
+		}
+	}
+}
+
+func TestCancelledContextAbortsQuery(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	lot, _ := insertTestLot(t, m, owner.ID, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := m.WithContext(ctx).ParkingLots.Get(lot.ID)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("query with a cancelled context: err = %v, want %v", err, context.Canceled)
+	}
+
+	// The unbound models carry on regardless
+	if _, err := m.ParkingLots.Get(lot.ID); err != nil {
+		t.Errorf("unbound query: %v", err)
+	}
+
+	// As does a query whose context is still live
+	if _, err := m.WithContext(context.Background()).ParkingLots.Get(lot.ID); err != nil {
+		t.Errorf("query with a live context: %v", err)
+	}
+
+	timeout := QueryTimeout
+	t.Cleanup(func() { QueryTimeout = timeout })
+	QueryTimeout = time.Nanosecond
+
+	_, err = m.ParkingLots.Get(lot.ID)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("query past QueryTimeout: err = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
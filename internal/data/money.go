@@ -0,0 +1,273 @@
+package data
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// RoundingMode decides what happens to amounts exactly halfway between two
+// minor units.
+type RoundingMode int
+
+const (
+	// RoundHalfUp rounds halves away from zero: 10.005 becomes 10.01.
+	RoundHalfUp RoundingMode = iota
+	// RoundHalfEven rounds halves to the even neighbour (banker's rounding):
+	// 10.005 becomes 10.00 and 10.015 becomes 10.02.
+	RoundHalfEven
+)
+
+// ParseRoundingMode accepts "half-up" or "half-even".
+func ParseRoundingMode(s string) (RoundingMode, error) {
+	switch s {
+	case "half-up":
+		return RoundHalfUp, nil
+	case "half-even":
+		return RoundHalfEven, nil
+	default:
+		return 0, fmt.Errorf("unknown rounding mode %q: must be half-up or half-even", s)
+	}
+}
+
+// MoneyRounding is the rounding mode used for every monetary amount. It is set
+// once at startup.
+var MoneyRounding = RoundHalfUp
+
+// defaultMinorUnits is the number of decimals for currencies not listed in
+// currencyMinorUnits.
+const defaultMinorUnits = 2
+
+// currencyMinorUnits lists currencies without a hundredth minor unit. Amounts
+// are stored with two decimals, so currencies with finer minor units aren't
+// supported.
+var currencyMinorUnits = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"VND": 0,
+}
+
+// MinorUnits returns how many decimals the currency uses.
+func MinorUnits(currency string) int {
+	if units, ok := currencyMinorUnits[strings.ToUpper(currency)]; ok {
+		return units
+	}
+	return defaultMinorUnits
+}
+
+// RoundMoney rounds amount to two decimals with MoneyRounding.
+func RoundMoney(amount float64) float64 {
+	return roundTo(amount, defaultMinorUnits)
+}
+
+// RoundMoneyIn rounds amount to the currency's minor units with MoneyRounding.
+func RoundMoneyIn(currency string, amount float64) float64 {
+	return roundTo(amount, MinorUnits(currency))
+}
+
+// roundTo rounds using the shortest decimal form of amount, so a value written
+// as 10.005 rounds as 10.005 rather than as the binary 10.00499999... it is
+// stored as.
+func roundTo(amount float64, decimals int) float64 {
+	if math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return amount
+	}
+
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(amount, 'f', -1, 64))
+	if !ok {
+		return amount
+	}
+
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	r.Mul(r, new(big.Rat).SetInt(scale))
+
+	units := roundRat(r)
+
+	result, _ := new(big.Rat).SetFrac(units, scale).Float64()
+	return result
+}
+
+// roundRat rounds r to an integer with MoneyRounding.
+func roundRat(r *big.Rat) *big.Int {
+	negative := r.Sign() < 0
+	abs := new(big.Rat).Abs(r)
+
+	quo, rem := new(big.Int).QuoRem(abs.Num(), abs.Denom(), new(big.Int))
+
+	// Compare twice the remainder with the denominator to find halves
+	cmp := new(big.Int).Mul(rem, big.NewInt(2)).Cmp(abs.Denom())
+	if cmp > 0 || (cmp == 0 && (MoneyRounding == RoundHalfUp || quo.Bit(0) == 1)) {
+		quo.Add(quo, big.NewInt(1))
+	}
+
+	if negative {
+		quo.Neg(quo)
+	}
+	return quo
+}
+
+// SumMoney adds amounts after rounding each one, so the total always equals
+// the sum of the rounded amounts: 0.1 + 0.2 is 0.3, not 0.30000000000000004.
+func SumMoney(amounts ...float64) float64 {
+	var cents int64
+	for _, amount := range amounts {
+		cents += toMinorUnits(amount)
+	}
+	return float64(cents) / 100
+}
+
+func toMinorUnits(amount float64) int64 {
+	return int64(math.Round(RoundMoney(amount) * 100))
+}
+
+// IsRoundedMoney reports whether amount has no more decimals than the
+// currency's minor units. An empty currency means two decimals.
+func IsRoundedMoney(currency string, amount float64) bool {
+	return RoundMoneyIn(currency, amount) == amount
+}
+
+// ValidateMoney checks that an amount is already rounded to the currency's
+// minor units.
+func ValidateMoney(v *validator.Validator, key, currency string, amount float64) {
+	v.Check(IsRoundedMoney(currency, amount), key, fmt.Sprintf("must not have more than %d decimal places", MinorUnits(currency)))
+}
+
+// Money is an amount in cents, the precision amounts are stored with. Money
+// adds and subtracts exactly; multiplying goes through Mul, which rounds with
+// MoneyRounding.
+//
+// Money doesn't carry a currency. On its own it is written to JSON as a number
+// with two decimals, e.g. 10.00, whether the amount is whole or not. Types that
+// do know their currency, such as Payment, write their amounts with
+// StringIn instead, so a zero-decimal currency like JPY shows 1500, not 1500.00.
+type Money int64
+
+// MoneyFromFloat converts amount to Money, rounding to cents with
+// MoneyRounding.
+func MoneyFromFloat(amount float64) Money {
+	return Money(toMinorUnits(amount))
+}
+
+// ParseMoney reads a decimal amount such as "10", "10.5" or "10.50". Amounts
+// with more than two decimals are rejected rather than rounded.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.ContainsAny(s, "/eE") {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	r.Mul(r, big.NewRat(100, 1))
+	if !r.IsInt() {
+		return 0, fmt.Errorf("amount %s has more than two decimal places", s)
+	}
+	if !r.Num().IsInt64() {
+		return 0, fmt.Errorf("amount %s is too large", s)
+	}
+
+	return Money(r.Num().Int64()), nil
+}
+
+// Float64 returns the amount in whole units, e.g. 1050 cents is 10.5.
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+// Mul multiplies the amount by factor, rounding to cents with MoneyRounding.
+func (m Money) Mul(factor float64) Money {
+	return MoneyFromFloat(m.Float64() * factor)
+}
+
+// String formats the amount with two decimals, e.g. "10.00" or "-0.50".
+func (m Money) String() string {
+	cents := int64(m)
+
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// StringIn formats the amount with the currency's minor units, e.g. "10.00" in
+// USD and "1500" in JPY. Amounts are kept rounded to the currency's minor units,
+// so nothing is lost by dropping decimals.
+func (m Money) StringIn(currency string) string {
+	if MinorUnits(currency) == defaultMinorUnits {
+		return m.String()
+	}
+
+	return strconv.FormatFloat(RoundMoneyIn(currency, m.Float64()), 'f', MinorUnits(currency), 64)
+}
+
+// MarshalJSON writes the amount as a number with two decimals.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON reads a number, or a string holding one, with at most two
+// decimals.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+
+	parsed, err := ParseMoney(strings.Trim(s, `"`))
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
+
+// Value stores the amount as a decimal.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan reads a decimal column. Values with more than two decimals are rounded
+// with MoneyRounding.
+func (m *Money) Scan(src any) error {
+	switch src := src.(type) {
+	case []byte:
+		return m.scanDecimal(string(src))
+	case string:
+		return m.scanDecimal(src)
+	case float64:
+		*m = MoneyFromFloat(src)
+	case int64:
+		*m = Money(src * 100)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
+
+func (m *Money) scanDecimal(s string) error {
+	parsed, err := ParseMoney(s)
+	if err == nil {
+		*m = parsed
+		return nil
+	}
+
+	amount, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("cannot scan %q into Money: %w", s, err)
+	}
+
+	*m = MoneyFromFloat(amount)
+	return nil
+}
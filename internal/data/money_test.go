@@ -0,0 +1,313 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// withRounding switches MoneyRounding for the rest of the test.
+func withRounding(t *testing.T, mode RoundingMode) {
+	t.Helper()
+
+	previous := MoneyRounding
+	MoneyRounding = mode
+	t.Cleanup(func() { MoneyRounding = previous })
+}
+
+func TestRoundMoney(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		halfUp   float64
+		halfEven float64
+	}{
+		{10.005, 10.01, 10},
+		{10.015, 10.02, 10.02},
+		{10.025, 10.03, 10.02},
+		{-10.005, -10.01, -10},
+		{1.004, 1, 1},
+		{1.006, 1.01, 1.01},
+		{0.30000000000000004, 0.3, 0.3},
+	}
+
+	for _, tt := range tests {
+		withRounding(t, RoundHalfUp)
+		if got := RoundMoney(tt.amount); got != tt.halfUp {
+			t.Errorf("half-up RoundMoney(%v) = %v; want %v", tt.amount, got, tt.halfUp)
+		}
+
+		withRounding(t, RoundHalfEven)
+		if got := RoundMoney(tt.amount); got != tt.halfEven {
+			t.Errorf("half-even RoundMoney(%v) = %v; want %v", tt.amount, got, tt.halfEven)
+		}
+	}
+}
+
+func TestRoundMoneyIn(t *testing.T) {
+	withRounding(t, RoundHalfUp)
+
+	if got := RoundMoneyIn("JPY", 1500.5); got != 1501 {
+		t.Errorf("RoundMoneyIn(JPY, 1500.5) = %v; want 1501", got)
+	}
+	if got := RoundMoneyIn("usd", 12.345); got != 12.35 {
+		t.Errorf("RoundMoneyIn(usd, 12.345) = %v; want 12.35", got)
+	}
+	if MinorUnits("jpy") != 0 || MinorUnits("LKR") != 2 {
+		t.Errorf("got minor units %d for JPY and %d for LKR; want 0 and 2", MinorUnits("jpy"), MinorUnits("LKR"))
+	}
+}
+
+func TestSumMoney(t *testing.T) {
+	withRounding(t, RoundHalfUp)
+
+	if got := SumMoney(0.1, 0.2); got != 0.3 {
+		t.Errorf("SumMoney(0.1, 0.2) = %v; want 0.3", got)
+	}
+
+	// Each amount is rounded before adding, so three half cents make three
+	// cents rather than rounding 1.5 cents once.
+	if got := SumMoney(0.005, 0.005, 0.005); got != 0.03 {
+		t.Errorf("SumMoney(0.005, 0.005, 0.005) = %v; want 0.03", got)
+	}
+
+	var total float64
+	for i := 0; i < 10; i++ {
+		total = SumMoney(total, 0.1)
+	}
+	if total != 1 {
+		t.Errorf("ten running sums of 0.1 = %v; want 1", total)
+	}
+}
+
+func TestParseRoundingMode(t *testing.T) {
+	if mode, err := ParseRoundingMode("half-even"); err != nil || mode != RoundHalfEven {
+		t.Errorf("half-even: got %v, %v", mode, err)
+	}
+	if mode, err := ParseRoundingMode("half-up"); err != nil || mode != RoundHalfUp {
+		t.Errorf("half-up: got %v, %v", mode, err)
+	}
+	if _, err := ParseRoundingMode("ceiling"); err == nil {
+		t.Error("ceiling: got no error")
+	}
+}
+
+func TestValidateMoney(t *testing.T) {
+	tests := []struct {
+		currency string
+		amount   float64
+		valid    bool
+	}{
+		{"LKR", 10.5, true},
+		{"LKR", 10.55, true},
+		{"LKR", 10.555, false},
+		{"JPY", 1500, true},
+		{"JPY", 1500.5, false},
+		{"", 10.001, false},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateMoney(v, "amount", tt.currency, tt.amount)
+		if v.Valid() != tt.valid {
+			t.Errorf("ValidateMoney(%q, %v): valid = %t; want %t", tt.currency, tt.amount, v.Valid(), tt.valid)
+		}
+	}
+}
+
+func TestRevenueMatchesRoundedPayments(t *testing.T) {
+	m := newTestModels(t)
+
+	user := insertTestUser(t, m)
+	vehicle := insertTestVehicle(t, m, user.ID)
+	lot, _ := insertTestLot(t, m, user.ID, 1)
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	amounts := []float64{0.1, 0.2, 10.01, 33.33, 33.33, 33.34}
+
+	for i, amount := range amounts {
+		reservation := insertTestReservation(t, m, vehicle, lot.ID, nil, start.Add(time.Duration(i)*time.Hour), time.Hour)
+		insertTestPayment(t, m, reservation, amount, PaymentStatusCompleted)
+	}
+
+	revenue, err := m.Payments.GetRevenueByLot(lot.ID, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := SumMoney(amounts...); revenue != want {
+		t.Errorf("got revenue %v; want %v", revenue, want)
+	}
+	if revenue != 110.31 {
+		t.Errorf("got revenue %v; want 110.31", revenue)
+	}
+
+	// Amounts finer than the currency allows are refused rather than stored.
+	reservation := insertTestReservation(t, m, vehicle, lot.ID, nil, start.Add(24*time.Hour), time.Hour)
+	payment := &Payment{
+		ReservationID: &reservation.ID,
+		UserID:        user.ID,
+		Amount:        MoneyFromFloat(1500.5),
+		Currency:      "JPY",
+		PaymentMethod: PaymentMethodCard,
+		Status:        PaymentStatusCompleted,
+		PaymentDate:   time.Now(),
+	}
+	if err := m.Payments.Insert(payment); !errors.Is(err, ErrUnroundedAmount) {
+		t.Errorf("unrounded JPY payment: got %v; want ErrUnroundedAmount", err)
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	for _, tt := range []struct {
+		amount Money
+		want   string
+	}{
+		{MoneyFromFloat(10), "10.00"},
+		{MoneyFromFloat(10.5), "10.50"},
+		{MoneyFromFloat(0.07), "0.07"},
+		{MoneyFromFloat(-0.5), "-0.50"},
+		{0, "0.00"},
+	} {
+		js, err := json.Marshal(tt.amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(js) != tt.want {
+			t.Errorf("Marshal(%d cents) = %s; want %s", int64(tt.amount), js, tt.want)
+		}
+
+		var back Money
+		if err := json.Unmarshal(js, &back); err != nil || back != tt.amount {
+			t.Errorf("Unmarshal(%s) = %d cents, %v; want %d", js, int64(back), err, int64(tt.amount))
+		}
+	}
+
+	// Plain numbers and strings are both accepted, but not extra decimals
+	for input, want := range map[string]Money{`10`: 1000, `10.5`: 1050, `"10.50"`: 1050, `"0.01"`: 1} {
+		var got Money
+		if err := json.Unmarshal([]byte(input), &got); err != nil || got != want {
+			t.Errorf("Unmarshal(%s) = %d cents, %v; want %d", input, int64(got), err, int64(want))
+		}
+	}
+	for _, input := range []string{`10.005`, `"abc"`, `"1e3"`, `"1/3"`, `""`} {
+		var got Money
+		if err := json.Unmarshal([]byte(input), &got); err == nil {
+			t.Errorf("Unmarshal(%s) = %d cents; want an error", input, int64(got))
+		}
+	}
+
+	// null leaves the amount alone
+	got := Money(1234)
+	if err := json.Unmarshal([]byte(`null`), &got); err != nil || got != 1234 {
+		t.Errorf("Unmarshal(null) = %d cents, %v; want 1234 unchanged", int64(got), err)
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	if got := MoneyFromFloat(0.1) + MoneyFromFloat(0.2); got != MoneyFromFloat(0.3) || got.String() != "0.30" {
+		t.Errorf("0.10 + 0.20 = %s; want 0.30", got)
+	}
+	if got := MoneyFromFloat(10) - MoneyFromFloat(10.01); got.String() != "-0.01" {
+		t.Errorf("10.00 - 10.01 = %s; want -0.01", got)
+	}
+	if got := MoneyFromFloat(33.33).Mul(3); got != MoneyFromFloat(99.99) {
+		t.Errorf("33.33 * 3 = %s; want 99.99", got)
+	}
+	if got := MoneyFromFloat(12.5).Float64(); got != 12.5 {
+		t.Errorf("Float64() = %v; want 12.5", got)
+	}
+
+	// 10.01 * 0.5 is 5.005, exactly halfway between two cents
+	withRounding(t, RoundHalfUp)
+	if got := MoneyFromFloat(10.01).Mul(0.5); got.String() != "5.01" {
+		t.Errorf("half-up: 10.01 * 0.5 = %s; want 5.01", got)
+	}
+	withRounding(t, RoundHalfEven)
+	if got := MoneyFromFloat(10.01).Mul(0.5); got.String() != "5.00" {
+		t.Errorf("half-even: 10.01 * 0.5 = %s; want 5.00", got)
+	}
+}
+
+func TestMoneyStringIn(t *testing.T) {
+	tests := []struct {
+		amount   Money
+		currency string
+		want     string
+	}{
+		{MoneyFromFloat(10), "LKR", "10.00"},
+		{MoneyFromFloat(10), "", "10.00"},
+		{MoneyFromFloat(1500), "JPY", "1500"},
+		{MoneyFromFloat(1500), "jpy", "1500"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.amount.StringIn(tt.currency); got != tt.want {
+			t.Errorf("StringIn(%q) = %s; want %s", tt.currency, got, tt.want)
+		}
+	}
+
+	js, err := json.Marshal(&Payment{Amount: MoneyFromFloat(1500), Currency: "JPY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(js), `"amount":1500`) || !strings.Contains(string(js), `"refunded_amount":0`) || strings.Contains(string(js), ".00") {
+		t.Errorf("JPY payment amounts aren't whole: %s", js)
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		src  any
+		want Money
+	}{
+		{[]byte("10.50"), 1050},
+		{"10.5", 1050},
+		{"-3.00", -300},
+		{[]byte("0.125"), 13},
+		{12.34, 1234},
+		{int64(7), 700},
+	}
+
+	for _, tt := range tests {
+		var got Money
+		if err := got.Scan(tt.src); err != nil || got != tt.want {
+			t.Errorf("Scan(%#v) = %d cents, %v; want %d", tt.src, int64(got), err, int64(tt.want))
+		}
+	}
+
+	for _, src := range []any{"abc", true, nil} {
+		var got Money
+		if err := got.Scan(src); err == nil {
+			t.Errorf("Scan(%#v): got no error", src)
+		}
+	}
+}
+
+func TestMoneyDatabaseRoundTrip(t *testing.T) {
+	m := newTestModels(t)
+
+	for _, amount := range []Money{0, 1, 1050, 99999999, -250} {
+		var got Money
+		err := m.Payments.DB.QueryRow(`SELECT $1::DECIMAL(10, 2)`, amount).Scan(&got)
+		if err != nil || got != amount {
+			t.Errorf("round trip of %s = %s, %v", amount, got, err)
+		}
+	}
+
+	user := insertTestUser(t, m)
+	vehicle := insertTestVehicle(t, m, user.ID)
+	lot, _ := insertTestLot(t, m, user.ID, 1)
+	reservation := insertTestReservation(t, m, vehicle, lot.ID, nil, time.Now().Add(24*time.Hour), time.Hour)
+
+	payment := insertTestPayment(t, m, reservation, 10.5, PaymentStatusPending)
+	stored, err := m.Payments.Get(payment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Amount != MoneyFromFloat(10.5) || stored.RefundedAmount != 0 {
+		t.Errorf("stored amount %s, refunded %s; want 10.50, 0.00", stored.Amount, stored.RefundedAmount)
+	}
+}
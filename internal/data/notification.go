@@ -1,13 +1,13 @@
 package data
 
 import (
-	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
 )
 
@@ -18,7 +18,14 @@ const (
 	NotificationTypeReservationConfirmed = "reservation_confirmed"
 	NotificationTypeReservationCancelled = "reservation_cancelled"
 	NotificationTypePaymentCompleted     = "payment_completed"
+	NotificationTypePaymentFailed        = "payment_failed"
+	NotificationTypePaymentRefunded      = "payment_refunded"
 	NotificationTypeViolationAlert       = "violation_alert"
+	NotificationTypeReservationSkipped   = "reservation_skipped"
+	NotificationTypeSpotMaintenance      = "spot_maintenance"
+	NotificationTypeOrgInvitation        = "org_invitation"
+	NotificationTypeLotClosed            = "lot_closed"
+	NotificationTypeReservationTransfer  = "reservation_transfer"
 )
 
 type Notification struct {
@@ -28,8 +35,11 @@ type Notification struct {
 	Title     string    `json:"title" db:"title"`
 	Message   string    `json:"message" db:"message"`
 	IsRead    bool      `json:"is_read" db:"is_read"`
+	Archived  bool      `json:"archived" db:"archived"`
 	Data      *string   `json:"data" db:"data"` // JSON data for additional context
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	Version   int       `json:"version" db:"version"`
 }
 
 func ValidateNotification(v *validator.Validator, notification *Notification) {
@@ -46,18 +56,26 @@ func ValidateNotification(v *validator.Validator, notification *Notification) {
 		NotificationTypeReservationConfirmed,
 		NotificationTypeReservationCancelled,
 		NotificationTypePaymentCompleted,
-		NotificationTypeViolationAlert), "type", "must be a valid notification type")
+		NotificationTypePaymentFailed,
+		NotificationTypePaymentRefunded,
+		NotificationTypeViolationAlert,
+		NotificationTypeReservationSkipped,
+		NotificationTypeSpotMaintenance,
+		NotificationTypeOrgInvitation,
+		NotificationTypeLotClosed,
+		NotificationTypeReservationTransfer), "type", "must be a valid notification type")
 }
 
 type NotificationModel struct {
 	DB *sql.DB
+	queryScope
 }
 
 func (m NotificationModel) Insert(notification *Notification) error {
 	query := `
 		INSERT INTO notifications (user_id, type, title, message, is_read, data)
 		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, created_at`
+		RETURNING id, created_at, updated_at, version`
 
 	args := []any{
 		notification.UserID,
@@ -68,12 +86,14 @@ func (m NotificationModel) Insert(notification *Notification) error {
 		notification.Data,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
 		&notification.ID,
 		&notification.CreatedAt,
+		&notification.UpdatedAt,
+		&notification.Version,
 	)
 	if err != nil {
 		return err
@@ -82,15 +102,62 @@ func (m NotificationModel) Insert(notification *Notification) error {
 	return nil
 }
 
+// NotificationDedupKey identifies a notification of the given type about one
+// entity for one user, so it is only ever sent once.
+func NotificationDedupKey(notificationType string, entityID, userID uuid.UUID) string {
+	return notificationType + ":" + entityID.String() + ":" + userID.String()
+}
+
+// InsertIfNotExists saves the notification unless one with the same dedup key
+// already exists, and reports whether it was created. Jobs that may run twice
+// for the same event use it so retries don't notify users again.
+func (m NotificationModel) InsertIfNotExists(notification *Notification, dedupKey string) (bool, error) {
+	query := `
+		INSERT INTO notifications (user_id, type, title, message, is_read, data, dedup_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (dedup_key) WHERE dedup_key IS NOT NULL DO NOTHING
+		RETURNING id, created_at, updated_at, version`
+
+	args := []any{
+		notification.UserID,
+		notification.Type,
+		notification.Title,
+		notification.Message,
+		notification.IsRead,
+		notification.Data,
+		dedupKey,
+	}
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&notification.ID,
+		&notification.CreatedAt,
+		&notification.UpdatedAt,
+		&notification.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
 func (m NotificationModel) Get(id uuid.UUID) (*Notification, error) {
 	query := `
-		SELECT id, user_id, type, title, message, is_read, data, created_at
+		SELECT id, user_id, type, title, message, is_read, archived, data, created_at, updated_at, version
 		FROM notifications
 		WHERE id = $1`
 
 	var notification Notification
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
@@ -100,8 +167,11 @@ func (m NotificationModel) Get(id uuid.UUID) (*Notification, error) {
 		&notification.Title,
 		&notification.Message,
 		&notification.IsRead,
+		&notification.Archived,
 		&notification.Data,
 		&notification.CreatedAt,
+		&notification.UpdatedAt,
+		&notification.Version,
 	)
 
 	if err != nil {
@@ -116,20 +186,22 @@ func (m NotificationModel) Get(id uuid.UUID) (*Notification, error) {
 	return &notification, nil
 }
 
-func (m NotificationModel) GetAllForUser(userID uuid.UUID, filters Filters) ([]*Notification, Metadata, error) {
+// GetAllForUser returns the user's notifications. Archived ones are left out
+// unless includeArchived is set.
+func (m NotificationModel) GetAllForUser(userID uuid.UUID, includeArchived bool, filters Filters) ([]*Notification, Metadata, error) {
 	query := `
-		SELECT count(*) OVER(), id, user_id, type, title, message, is_read, data, created_at
+		SELECT count(*) OVER(), id, user_id, type, title, message, is_read, archived, data, created_at, updated_at, version
 		FROM notifications
-		WHERE user_id = $1
+		WHERE user_id = $1 AND ($2 OR archived = false)
 		ORDER BY %s %s, id ASC
-		LIMIT $2 OFFSET $3`
+		LIMIT $3 OFFSET $4`
 
 	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
-	args := []any{userID, filters.limit(), filters.offset()}
+	args := []any{userID, includeArchived, filters.limit(), filters.offset()}
 
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -151,8 +223,11 @@ func (m NotificationModel) GetAllForUser(userID uuid.UUID, filters Filters) ([]*
 			&notification.Title,
 			&notification.Message,
 			&notification.IsRead,
+			&notification.Archived,
 			&notification.Data,
 			&notification.CreatedAt,
+			&notification.UpdatedAt,
+			&notification.Version,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
@@ -172,13 +247,13 @@ func (m NotificationModel) GetAllForUser(userID uuid.UUID, filters Filters) ([]*
 
 func (m NotificationModel) GetUnreadForUser(userID uuid.UUID, limit int) ([]*Notification, error) {
 	query := `
-		SELECT id, user_id, type, title, message, is_read, data, created_at
+		SELECT id, user_id, type, title, message, is_read, archived, data, created_at, updated_at, version
 		FROM notifications
-		WHERE user_id = $1 AND is_read = false
+		WHERE user_id = $1 AND is_read = false AND archived = false
 		ORDER BY created_at DESC
 		LIMIT $2`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	rows, err := m.DB.QueryContext(ctx, query, userID, limit)
@@ -199,8 +274,11 @@ func (m NotificationModel) GetUnreadForUser(userID uuid.UUID, limit int) ([]*Not
 			&notification.Title,
 			&notification.Message,
 			&notification.IsRead,
+			&notification.Archived,
 			&notification.Data,
 			&notification.CreatedAt,
+			&notification.UpdatedAt,
+			&notification.Version,
 		)
 		if err != nil {
 			return nil, err
@@ -217,11 +295,11 @@ func (m NotificationModel) GetUnreadForUser(userID uuid.UUID, limit int) ([]*Not
 }
 
 func (m NotificationModel) GetUnreadCountForUser(userID uuid.UUID) (int, error) {
-	query := `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND is_read = false`
+	query := `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND is_read = false AND archived = false`
 
 	var count int
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&count)
@@ -232,13 +310,44 @@ func (m NotificationModel) GetUnreadCountForUser(userID uuid.UUID) (int, error)
 	return count, nil
 }
 
-func (m NotificationModel) MarkAsRead(id uuid.UUID) error {
-	query := `UPDATE notifications SET is_read = true WHERE id = $1`
+// MarkAsReadForUser marks one of the user's notifications read. Notifications
+// that don't exist or belong to someone else return ErrRecordNotFound.
+func (m NotificationModel) MarkAsReadForUser(id, userID uuid.UUID) error {
+	query := `UPDATE notifications SET is_read = true, updated_at = NOW(), version = version + 1 WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Archive hides one of the user's notifications from their list without deleting
+// it. Notifications that don't exist or belong to someone else return
+// ErrRecordNotFound.
+func (m NotificationModel) Archive(id, userID uuid.UUID) error {
+	query := `
+		UPDATE notifications
+		SET archived = true, updated_at = NOW(), version = version + 1
+		WHERE id = $1 AND user_id = $2`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
 	if err != nil {
 		return err
 	}
@@ -256,22 +365,52 @@ func (m NotificationModel) MarkAsRead(id uuid.UUID) error {
 }
 
 func (m NotificationModel) MarkAllAsReadForUser(userID uuid.UUID) error {
-	query := `UPDATE notifications SET is_read = true WHERE user_id = $1 AND is_read = false`
+	query := `UPDATE notifications SET is_read = true, updated_at = NOW(), version = version + 1 WHERE user_id = $1 AND is_read = false`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, userID)
 	return err
 }
 
-func (m NotificationModel) Delete(id uuid.UUID) error {
-	query := `DELETE FROM notifications WHERE id = $1`
+// MaxMarkReadIDs caps how many notifications one mark-read request may name.
+const MaxMarkReadIDs = 100
+
+// MarkManyAsReadForUser marks the listed notifications read and returns how
+// many changed. IDs that belong to someone else, don't exist or are already
+// read are skipped.
+func (m NotificationModel) MarkManyAsReadForUser(userID uuid.UUID, ids []uuid.UUID) (int, error) {
+	query := `
+		UPDATE notifications
+		SET is_read = true, updated_at = NOW(), version = version + 1
+		WHERE user_id = $1 AND id = ANY($2) AND is_read = false`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+// DeleteForUser deletes one of the user's notifications. Notifications that
+// don't exist or belong to someone else return ErrRecordNotFound.
+func (m NotificationModel) DeleteForUser(id, userID uuid.UUID) error {
+	query := `DELETE FROM notifications WHERE id = $1 AND user_id = $2`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
 	if err != nil {
 		return err
 	}
@@ -291,7 +430,7 @@ func (m NotificationModel) Delete(id uuid.UUID) error {
 func (m NotificationModel) DeleteAllForUser(userID uuid.UUID) error {
 	query := `DELETE FROM notifications WHERE user_id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, userID)
@@ -301,7 +440,7 @@ func (m NotificationModel) DeleteAllForUser(userID uuid.UUID) error {
 func (m NotificationModel) DeleteOldNotifications(olderThan time.Time) error {
 	query := `DELETE FROM notifications WHERE created_at < $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, olderThan)
@@ -313,7 +452,7 @@ func (m NotificationModel) BulkInsert(notifications []*Notification) error {
 		INSERT INTO notifications (user_id, type, title, message, is_read, data)
 		VALUES ($1, $2, $3, $4, $5, $6)`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := m.longQueryContext()
 	defer cancel()
 
 	tx, err := m.DB.BeginTx(ctx, nil)
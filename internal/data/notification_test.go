@@ -0,0 +1,196 @@
+package data
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// insertTestNotification sends the user an unread reminder.
+func insertTestNotification(t *testing.T, m Models, userID uuid.UUID) *Notification {
+	t.Helper()
+
+	notification := &Notification{
+		UserID:  userID,
+		Type:    NotificationTypeReservationReminder,
+		Title:   "Upcoming reservation",
+		Message: "Your reservation starts soon.",
+	}
+	if err := m.Notifications.Insert(notification); err != nil {
+		t.Fatal(err)
+	}
+
+	return notification
+}
+
+func TestInsertIfNotExists(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+	other := insertTestUser(t, m)
+	reservationID := uuid.New()
+
+	insert := func(userID uuid.UUID) bool {
+		t.Helper()
+
+		notification := &Notification{
+			UserID:  userID,
+			Type:    NotificationTypeReservationReminder,
+			Title:   "Upcoming reservation",
+			Message: "Your reservation starts soon.",
+		}
+		created, err := m.Notifications.InsertIfNotExists(notification, NotificationDedupKey(notification.Type, reservationID, userID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created && notification.ID == uuid.Nil {
+			t.Error("created notification has no ID")
+		}
+		return created
+	}
+
+	if !insert(user.ID) {
+		t.Error("first insert: not created")
+	}
+	if insert(user.ID) {
+		t.Error("second insert with the same dedup key: created")
+	}
+	if !insert(other.ID) {
+		t.Error("insert for another user: not created")
+	}
+
+	var count int
+	err := m.Notifications.DB.QueryRow(`SELECT count(*) FROM notifications WHERE user_id = $1`, user.ID).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("got %d notifications; want 1", count)
+	}
+}
+
+func TestNotificationDedupKey(t *testing.T) {
+	entity, user := uuid.New(), uuid.New()
+
+	key := NotificationDedupKey(NotificationTypeReservationReminder, entity, user)
+	if key != NotificationDedupKey(NotificationTypeReservationReminder, entity, user) {
+		t.Error("same inputs gave different keys")
+	}
+	if key == NotificationDedupKey(NotificationTypeReservationConfirmed, entity, user) {
+		t.Error("different types gave the same key")
+	}
+	if key == NotificationDedupKey(NotificationTypeReservationReminder, entity, uuid.New()) {
+		t.Error("different users gave the same key")
+	}
+}
+
+func TestNotificationTimestampsAndVersion(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+
+	notification := insertTestNotification(t, m, user.ID)
+	if notification.CreatedAt.IsZero() || notification.UpdatedAt.IsZero() || notification.Version != 1 {
+		t.Errorf("after insert: created %v, updated %v, version %d", notification.CreatedAt, notification.UpdatedAt, notification.Version)
+	}
+
+	if err := m.Notifications.MarkAsReadForUser(notification.ID, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := m.Notifications.Get(notification.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.IsRead || stored.Version != 2 || stored.UpdatedAt.Before(notification.UpdatedAt) {
+		t.Errorf("after marking read: read %t, version %d, updated %v", stored.IsRead, stored.Version, stored.UpdatedAt)
+	}
+}
+
+func TestArchivedNotificationsAreHiddenByDefault(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+	other := insertTestUser(t, m)
+
+	kept := insertTestNotification(t, m, user.ID)
+	archived := insertTestNotification(t, m, user.ID)
+
+	if err := m.Notifications.Archive(archived.ID, other.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("archiving another user's notification: err = %v, want %v", err, ErrRecordNotFound)
+	}
+	if err := m.Notifications.Archive(archived.ID, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	filters := Filters{Page: 1, PageSize: 20, Sort: "created_at", SortSafelist: []string{"created_at"}}
+
+	notifications, metadata, err := m.Notifications.GetAllForUser(user.ID, false, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 1 || metadata.TotalRecords != 1 || notifications[0].ID != kept.ID {
+		t.Errorf("default listing has %d notifications; want only %s", len(notifications), kept.ID)
+	}
+
+	notifications, metadata, err = m.Notifications.GetAllForUser(user.ID, true, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 2 || metadata.TotalRecords != 2 {
+		t.Fatalf("listing with archived has %d notifications; want 2", len(notifications))
+	}
+	for _, notification := range notifications {
+		if notification.Archived != (notification.ID == archived.ID) {
+			t.Errorf("notification %s archived = %t", notification.ID, notification.Archived)
+		}
+	}
+}
+
+func TestMarkManyAsReadForUser(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+	other := insertTestUser(t, m)
+
+	listed := []*Notification{insertTestNotification(t, m, user.ID), insertTestNotification(t, m, user.ID)}
+	unlisted := insertTestNotification(t, m, user.ID)
+	theirs := insertTestNotification(t, m, other.ID)
+
+	ids := []uuid.UUID{listed[0].ID, listed[1].ID, theirs.ID, uuid.New()}
+
+	updated, err := m.Notifications.MarkManyAsReadForUser(user.ID, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 2 {
+		t.Errorf("marked %d read; want 2", updated)
+	}
+
+	isRead := func(id uuid.UUID) bool {
+		t.Helper()
+
+		notification, err := m.Notifications.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return notification.IsRead
+	}
+
+	for _, n := range listed {
+		if !isRead(n.ID) {
+			t.Errorf("listed notification %s is unread", n.ID)
+		}
+	}
+	if isRead(unlisted.ID) {
+		t.Error("unlisted notification was marked read")
+	}
+	if isRead(theirs.ID) {
+		t.Error("another user's notification was marked read")
+	}
+
+	// Already read notifications aren't counted again
+	updated, err = m.Notifications.MarkManyAsReadForUser(user.ID, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 0 {
+		t.Errorf("marked %d read the second time; want 0", updated)
+	}
+}
@@ -0,0 +1,307 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+const (
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+var (
+	ErrAlreadyInOrganization = errors.New("user already belongs to an organization")
+	ErrDuplicateInvitation   = errors.New("duplicate invitation")
+)
+
+type Organization struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	Name      string     `json:"name" db:"name"`
+	CreatedBy *uuid.UUID `json:"created_by" db:"created_by"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	Version   int        `json:"version" db:"version"`
+}
+
+type OrganizationMember struct {
+	UserID    uuid.UUID `json:"user_id"`
+	UserName  string    `json:"username"`
+	Email     string    `json:"email"`
+	FirstName *string   `json:"first_name"`
+	LastName  *string   `json:"last_name"`
+	Role      string    `json:"role"`
+}
+
+type OrganizationInvitation struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	OrgID      uuid.UUID  `json:"org_id" db:"org_id"`
+	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
+	InvitedBy  *uuid.UUID `json:"invited_by" db:"invited_by"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	AcceptedAt *time.Time `json:"accepted_at" db:"accepted_at"`
+}
+
+func ValidateOrganization(v *validator.Validator, org *Organization) {
+	v.Check(org.Name != "", "name", "must be provided")
+	v.Check(len(org.Name) <= 100, "name", "must not be more than 100 characters long")
+}
+
+// IsOrgAdmin reports whether the user administers the given organization.
+func (u *User) IsOrgAdmin(orgID uuid.UUID) bool {
+	return u.OrgID != nil && *u.OrgID == orgID && u.OrgRole != nil && *u.OrgRole == OrgRoleAdmin
+}
+
+type OrganizationModel struct {
+	DB *sql.DB
+	queryScope
+}
+
+// Insert creates the organization and makes its creator the first admin. The
+// creator must not already belong to an organization.
+func (m OrganizationModel) Insert(org *Organization) error {
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO organizations (name, created_by)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version`
+
+	err = tx.QueryRowContext(ctx, query, org.Name, org.CreatedBy).Scan(&org.ID, &org.CreatedAt, &org.Version)
+	if err != nil {
+		return err
+	}
+
+	err = joinOrganization(ctx, tx, org.ID, *org.CreatedBy, OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func joinOrganization(ctx context.Context, tx *sql.Tx, orgID, userID uuid.UUID, role string) error {
+	query := `
+		UPDATE users
+		SET org_id = $1, org_role = $2, version = version + 1
+		WHERE id = $3 AND org_id IS NULL`
+
+	result, err := tx.ExecContext(ctx, query, orgID, role, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrAlreadyInOrganization
+	}
+
+	return nil
+}
+
+func (m OrganizationModel) Get(id uuid.UUID) (*Organization, error) {
+	query := `
+		SELECT id, name, created_by, created_at, version
+		FROM organizations
+		WHERE id = $1`
+
+	var org Organization
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&org.ID,
+		&org.Name,
+		&org.CreatedBy,
+		&org.CreatedAt,
+		&org.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &org, nil
+}
+
+func (m OrganizationModel) GetMembers(orgID uuid.UUID) ([]*OrganizationMember, error) {
+	query := `
+		SELECT id, user_name, email, first_name, last_name, org_role
+		FROM users
+		WHERE org_id = $1 AND deleted_at IS NULL
+		ORDER BY org_role ASC, user_name ASC`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*OrganizationMember{}
+
+	for rows.Next() {
+		var member OrganizationMember
+
+		err := rows.Scan(
+			&member.UserID,
+			&member.UserName,
+			&member.Email,
+			&member.FirstName,
+			&member.LastName,
+			&member.Role,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, &member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// RemoveMember takes a user out of the organization.
+func (m OrganizationModel) RemoveMember(orgID, userID uuid.UUID) error {
+	query := `
+		UPDATE users
+		SET org_id = NULL, org_role = NULL, version = version + 1
+		WHERE id = $1 AND org_id = $2`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, orgID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m OrganizationModel) Invite(invitation *OrganizationInvitation) error {
+	query := `
+		INSERT INTO organization_invitations (org_id, user_id, invited_by)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, invitation.OrgID, invitation.UserID, invitation.InvitedBy).Scan(
+		&invitation.ID,
+		&invitation.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "organization_invitations_pending_idx"`:
+			return ErrDuplicateInvitation
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetPendingInvitation returns an invitation that hasn't been accepted yet.
+func (m OrganizationModel) GetPendingInvitation(id uuid.UUID) (*OrganizationInvitation, error) {
+	query := `
+		SELECT id, org_id, user_id, invited_by, created_at, accepted_at
+		FROM organization_invitations
+		WHERE id = $1 AND accepted_at IS NULL`
+
+	var invitation OrganizationInvitation
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&invitation.ID,
+		&invitation.OrgID,
+		&invitation.UserID,
+		&invitation.InvitedBy,
+		&invitation.CreatedAt,
+		&invitation.AcceptedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &invitation, nil
+}
+
+// AcceptInvitation adds the invited user to the organization as a member.
+func (m OrganizationModel) AcceptInvitation(invitation *OrganizationInvitation) error {
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = joinOrganization(ctx, tx, invitation.OrgID, invitation.UserID, OrgRoleMember)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE organization_invitations
+		SET accepted_at = NOW()
+		WHERE id = $1 AND accepted_at IS NULL
+		RETURNING accepted_at`
+
+	err = tx.QueryRowContext(ctx, query, invitation.ID).Scan(&invitation.AcceptedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
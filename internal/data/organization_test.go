@@ -0,0 +1,99 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestIsOrgAdmin(t *testing.T) {
+	orgID := uuid.New()
+	admin, member := OrgRoleAdmin, OrgRoleMember
+
+	tests := []struct {
+		name string
+		user *User
+		want bool
+	}{
+		{"admin", &User{OrgID: &orgID, OrgRole: &admin}, true},
+		{"member", &User{OrgID: &orgID, OrgRole: &member}, false},
+		{"admin of another organization", &User{OrgID: new(uuid.UUID), OrgRole: &admin}, false},
+		{"no organization", &User{}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.user.IsOrgAdmin(orgID); got != tt.want {
+			t.Errorf("%s: got %t; want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetAllForOrgRespectsMembership(t *testing.T) {
+	m := newTestModels(t)
+
+	admin := insertTestUser(t, m)
+	member := insertTestUser(t, m)
+	outsider := insertTestUser(t, m)
+
+	org := &Organization{Name: "Test fleet", CreatedBy: &admin.ID}
+	if err := m.Organizations.Insert(org); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		m.Organizations.DB.Exec(`DELETE FROM organizations WHERE id = $1`, org.ID)
+	})
+
+	invitation := &OrganizationInvitation{OrgID: org.ID, UserID: member.ID, InvitedBy: &admin.ID}
+	if err := m.Organizations.Invite(invitation); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Organizations.Invite(&OrganizationInvitation{OrgID: org.ID, UserID: member.ID, InvitedBy: &admin.ID}); !errors.Is(err, ErrDuplicateInvitation) {
+		t.Errorf("second pending invitation: got %v; want ErrDuplicateInvitation", err)
+	}
+	if err := m.Organizations.AcceptInvitation(invitation); err != nil {
+		t.Fatal(err)
+	}
+
+	lot, spots := insertTestLot(t, m, outsider.ID, 3)
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	adminReservation := insertTestReservation(t, m, insertTestVehicle(t, m, admin.ID), lot.ID, spots[0], start, time.Hour)
+	memberReservation := insertTestReservation(t, m, insertTestVehicle(t, m, member.ID), lot.ID, spots[1], start, time.Hour)
+	insertTestReservation(t, m, insertTestVehicle(t, m, outsider.ID), lot.ID, spots[2], start, time.Hour)
+
+	listed := func() map[uuid.UUID]bool {
+		t.Helper()
+		reservations, _, err := m.Reservations.GetAllForOrg(org.ID, Filters{
+			Page:         1,
+			PageSize:     20,
+			Sort:         "start_time",
+			SortSafelist: []string{"start_time"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := map[uuid.UUID]bool{}
+		for _, r := range reservations {
+			ids[r.ID] = true
+		}
+		return ids
+	}
+
+	got := listed()
+	if len(got) != 2 || !got[adminReservation.ID] || !got[memberReservation.ID] {
+		t.Errorf("got %d reservations; want the admin's and the member's only", len(got))
+	}
+
+	if err := m.Organizations.RemoveMember(org.ID, member.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := listed(); got[memberReservation.ID] || len(got) != 1 {
+		t.Errorf("got %d reservations after the member left; want the admin's only", len(got))
+	}
+
+	// Someone already in an organization can't start another.
+	if err := m.Organizations.Insert(&Organization{Name: "Second", CreatedBy: &admin.ID}); !errors.Is(err, ErrAlreadyInOrganization) {
+		t.Errorf("second organization: got %v; want ErrAlreadyInOrganization", err)
+	}
+}
@@ -1,10 +1,12 @@
 package data
 
 import (
-	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,30 +14,79 @@ import (
 )
 
 type ParkingLot struct {
-	ID          uuid.UUID `json:"id" db:"id"`
-	Name        string    `json:"name" db:"name"`
-	Address     string    `json:"address" db:"address"`
-	Latitude    float64   `json:"latitude" db:"latitude"`
-	Longitude   float64   `json:"longitude" db:"longitude"`
-	TotalSpots  int       `json:"total_spots" db:"total_spots"`
-	HourlyRate  float64   `json:"hourly_rate" db:"hourly_rate"`
-	DailyRate   *float64  `json:"daily_rate" db:"daily_rate"`
-	MonthlyRate *float64  `json:"monthly_rate" db:"monthly_rate"`
-	OpenTime    string    `json:"open_time" db:"open_time"`
-	CloseTime   string    `json:"close_time" db:"close_time"`
-	IsActive    bool      `json:"is_active" db:"is_active"`
-	OwnerID     uuid.UUID `json:"owner_id" db:"owner_id"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
-	Version     int       `json:"version" db:"version"`
+	ID                     uuid.UUID              `json:"id" db:"id"`
+	Name                   string                 `json:"name" db:"name"`
+	Address                string                 `json:"address" db:"address"`
+	Latitude               float64                `json:"latitude" db:"latitude"`
+	Longitude              float64                `json:"longitude" db:"longitude"`
+	TotalSpots             int                    `json:"total_spots" db:"total_spots"`
+	HourlyRate             Money                  `json:"hourly_rate" db:"hourly_rate"`
+	DailyRate              *Money                 `json:"daily_rate" db:"daily_rate"`
+	MonthlyRate            *Money                 `json:"monthly_rate" db:"monthly_rate"`
+	OpenTime               string                 `json:"open_time" db:"open_time"`
+	CloseTime              string                 `json:"close_time" db:"close_time"`
+	IsActive               bool                   `json:"is_active" db:"is_active"`
+	IsRefundable           bool                   `json:"is_refundable" db:"is_refundable"`
+	Timezone               string                 `json:"timezone" db:"timezone"`                                 // IANA name, e.g. Asia/Colombo
+	TaxRate                *float64               `json:"tax_rate" db:"tax_rate"`                                 // fraction; nil uses DefaultTaxRate
+	ViolationFee           *float64               `json:"violation_fee" db:"violation_fee"`                       // charged when a session is marked as a violation
+	MaxReservationDays     *int                   `json:"max_reservation_days" db:"max_reservation_days"`         // nil uses DefaultMaxReservationDays
+	MaxAdvanceDays         *int                   `json:"max_advance_days" db:"max_advance_days"`                 // nil uses DefaultMaxAdvanceDays
+	VehicleTypeMultipliers VehicleTypeMultipliers `json:"vehicle_type_multipliers" db:"vehicle_type_multipliers"` // unlisted types pay 1x
+	MinLeadMinutes         int                    `json:"min_lead_minutes" db:"min_lead_minutes"`                 // how far ahead bookings must start
+	OverbookingPercent     int                    `json:"overbooking_percent" db:"overbooking_percent"`           // extra bookings accepted beyond TotalSpots
+	OwnerID                uuid.UUID              `json:"owner_id" db:"owner_id"`
+	CreatedAt              time.Time              `json:"created_at" db:"created_at"`
+	UpdatedAt              time.Time              `json:"updated_at" db:"updated_at"`
+	Version                int                    `json:"version" db:"version"`
 }
 
+// MinReviewsForTopRated is how many visible reviews a lot needs before it can
+// appear in the top rated list, so a single 5-star review can't put it first.
+const MinReviewsForTopRated = 5
+
+// ParkingLotWithStats is a parking lot along with the aggregate figures used by
+// discovery and search listings.
+type ParkingLotWithStats struct {
+	ParkingLot
+	AverageRating     float64 `json:"average_rating"`
+	TotalReviews      int     `json:"total_reviews"`
+	CompletedSessions int     `json:"completed_sessions"`
+}
+
+// LotSuggestion is a search box suggestion: just enough of a lot to show it
+// and look it up.
+type LotSuggestion struct {
+	ID      uuid.UUID `json:"id"`
+	Name    string    `json:"name"`
+	Address string    `json:"address"`
+}
+
+// MaxAutocompleteResults caps how many suggestions one autocomplete returns.
+const MaxAutocompleteResults = 10
+
+// ParkingLotWithDistance is a lot found around a point, with its distance from
+// that point in kilometres.
+type ParkingLotWithDistance struct {
+	ParkingLot
+	Distance float64 `json:"distance_km"`
+}
+
+// MaxLotAddressLength is the longest address a parking lot may have.
+const MaxLotAddressLength = 255
+
+// MaxImportLots caps how many parking lots one import request may create.
+const MaxImportLots = 500
+
+// MaxOverbookingPercent is the most a lot may be overbooked by.
+const MaxOverbookingPercent = 50
+
 func ValidateParkingLot(v *validator.Validator, lot *ParkingLot) {
 	v.Check(lot.Name != "", "name", "must be provided")
 	v.Check(len(lot.Name) <= 100, "name", "must not be more than 100 characters long")
 
 	v.Check(lot.Address != "", "address", "must be provided")
-	v.Check(len(lot.Address) <= 255, "address", "must not be more than 255 characters long")
+	v.Check(len(lot.Address) <= MaxLotAddressLength, "address", fmt.Sprintf("must not be more than %d characters long", MaxLotAddressLength))
 
 	v.Check(lot.Latitude >= -90 && lot.Latitude <= 90, "latitude", "must be between -90 and 90")
 	v.Check(lot.Longitude >= -180 && lot.Longitude <= 180, "longitude", "must be between -180 and 180")
@@ -44,33 +95,181 @@ func ValidateParkingLot(v *validator.Validator, lot *ParkingLot) {
 	v.Check(lot.TotalSpots <= 10000, "total_spots", "must not exceed 10,000")
 
 	v.Check(lot.HourlyRate >= 0, "hourly_rate", "must not be negative")
-	v.Check(lot.HourlyRate <= 1000, "hourly_rate", "must not exceed 1000")
+	v.Check(lot.HourlyRate <= MoneyFromFloat(1000), "hourly_rate", "must not exceed 1000")
 
 	if lot.DailyRate != nil {
 		v.Check(*lot.DailyRate >= 0, "daily_rate", "must not be negative")
-		v.Check(*lot.DailyRate <= 10000, "daily_rate", "must not exceed 10,000")
+		v.Check(*lot.DailyRate <= MoneyFromFloat(10000), "daily_rate", "must not exceed 10,000")
 	}
 
 	if lot.MonthlyRate != nil {
 		v.Check(*lot.MonthlyRate >= 0, "monthly_rate", "must not be negative")
-		v.Check(*lot.MonthlyRate <= 100000, "monthly_rate", "must not exceed 100,000")
+		v.Check(*lot.MonthlyRate <= MoneyFromFloat(100000), "monthly_rate", "must not exceed 100,000")
+	}
+
+	if lot.TaxRate != nil {
+		v.Check(*lot.TaxRate >= 0 && *lot.TaxRate <= 1, "tax_rate", "must be between 0 and 1")
+	}
+
+	if lot.ViolationFee != nil {
+		v.Check(*lot.ViolationFee >= 0, "violation_fee", "must not be negative")
+		v.Check(*lot.ViolationFee <= 10000, "violation_fee", "must not exceed 10,000")
+		ValidateMoney(v, "violation_fee", "", *lot.ViolationFee)
+	}
+
+	ValidateVehicleTypeMultipliers(v, lot.VehicleTypeMultipliers)
+
+	if lot.MaxReservationDays != nil {
+		v.Check(*lot.MaxReservationDays > 0, "max_reservation_days", "must be greater than zero")
+		v.Check(*lot.MaxReservationDays <= 366, "max_reservation_days", "must not exceed 366")
+	}
+
+	if lot.MaxAdvanceDays != nil {
+		v.Check(*lot.MaxAdvanceDays > 0, "max_advance_days", "must be greater than zero")
+		v.Check(*lot.MaxAdvanceDays <= 730, "max_advance_days", "must not exceed 730")
 	}
 
+	v.Check(lot.MinLeadMinutes >= 0, "min_lead_minutes", "must not be negative")
+	v.Check(lot.MinLeadMinutes <= 1440, "min_lead_minutes", "must not exceed 1440")
+
+	v.Check(lot.OverbookingPercent >= 0 && lot.OverbookingPercent <= MaxOverbookingPercent, "overbooking_percent", fmt.Sprintf("must be between 0 and %d", MaxOverbookingPercent))
+
 	v.Check(lot.OpenTime != "", "open_time", "must be provided")
 	v.Check(lot.CloseTime != "", "close_time", "must be provided")
+
+	_, err := time.LoadLocation(lot.Timezone)
+	v.Check(lot.Timezone != "" && err == nil, "timezone", "must be a valid IANA time zone name")
+
+	_, ok := parseClockTime(lot.OpenTime)
+	v.Check(ok, "open_time", "must be a time in HH:MM format")
+	_, ok = parseClockTime(lot.CloseTime)
+	v.Check(ok, "close_time", "must be a time in HH:MM format")
+}
+
+const (
+	// nullIslandEpsilon is how close to (0, 0), in degrees, coordinates must
+	// be to count as the null island (about 11 metres at the equator).
+	nullIslandEpsilon = 0.0001
+	// nullIslandSuspectRange is how close to (0, 0), in degrees, coordinates
+	// are worth a second look even when they aren't rejected.
+	nullIslandSuspectRange = 1.0
+)
+
+// IsNullIsland reports whether the coordinates are (0, 0), which almost always
+// means a client sent default values rather than a real location.
+func IsNullIsland(lat, lng float64) bool {
+	return math.Abs(lat) < nullIslandEpsilon && math.Abs(lng) < nullIslandEpsilon
+}
+
+// NearNullIsland reports whether the coordinates are close enough to (0, 0)
+// to be suspicious.
+func NearNullIsland(lat, lng float64) bool {
+	return math.Abs(lat) < nullIslandSuspectRange && math.Abs(lng) < nullIslandSuspectRange
+}
+
+// ValidateNotNullIsland rejects (0, 0) coordinates. Callers skip it when the
+// client explicitly allows them.
+func ValidateNotNullIsland(v *validator.Validator, lat, lng float64) {
+	v.Check(!IsNullIsland(lat, lng), "latitude", "coordinates must not be (0, 0) unless allow_zero_coordinates is set")
+}
+
+// MaxLotSearchLength caps the length of an owner's lot search term.
+const MaxLotSearchLength = 100
+
+func ValidateLotSearch(v *validator.Validator, search string) {
+	v.Check(len(search) <= MaxLotSearchLength, "q", fmt.Sprintf("must not be more than %d characters long", MaxLotSearchLength))
+}
+
+// parseClockTime turns an "HH:MM" or "HH:MM:SS" time of day into minutes
+// since midnight.
+func parseClockTime(value string) (int, bool) {
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t.Hour()*60 + t.Minute(), true
+		}
+	}
+	return 0, false
+}
+
+// IsOpenAllDay reports whether the lot never closes, which is expressed by
+// equal opening and closing times.
+func (lot *ParkingLot) IsOpenAllDay() bool {
+	open, _ := parseClockTime(lot.OpenTime)
+	closes, _ := parseClockTime(lot.CloseTime)
+	return open == closes
+}
+
+// Capacity is how many overlapping reservations the lot accepts: its spots plus
+// OverbookingPercent more, counting on some drivers not turning up.
+func (lot *ParkingLot) Capacity() int {
+	return lotCapacity(lot.TotalSpots, lot.OverbookingPercent)
+}
+
+// AllowsOverbooking reports whether the lot takes more reservations than it
+// has spots.
+func (lot *ParkingLot) AllowsOverbooking() bool {
+	return lot.Capacity() > lot.TotalSpots
+}
+
+func lotCapacity(totalSpots, overbookingPercent int) int {
+	return totalSpots * (100 + overbookingPercent) / 100
+}
+
+// DefaultLotTimezone is used for lots that don't give a time zone.
+const DefaultLotTimezone = "UTC"
+
+// Location returns the lot's time zone, falling back to UTC for an unknown name.
+func (lot *ParkingLot) Location() *time.Location {
+	loc, err := time.LoadLocation(lot.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// IsOpenAt reports whether the lot is open at t, read on the lot's local clock.
+// Lots whose closing time is earlier than their opening time are open overnight.
+func (lot *ParkingLot) IsOpenAt(t time.Time) bool {
+	open, okOpen := parseClockTime(lot.OpenTime)
+	closes, okCloses := parseClockTime(lot.CloseTime)
+	if !okOpen || !okCloses || open == closes {
+		return true
+	}
+
+	t = t.In(lot.Location())
+	minute := t.Hour()*60 + t.Minute()
+
+	if open < closes {
+		return minute >= open && minute < closes
+	}
+	return minute >= open || minute < closes
+}
+
+// ClosesAfter returns the first closing time after t, in the lot's time zone.
+func (lot *ParkingLot) ClosesAfter(t time.Time) time.Time {
+	closes, _ := parseClockTime(lot.CloseTime)
+
+	t = t.In(lot.Location())
+	closing := time.Date(t.Year(), t.Month(), t.Day(), closes/60, closes%60, 0, 0, t.Location())
+	if !closing.After(t) {
+		closing = closing.AddDate(0, 0, 1)
+	}
+	return closing
 }
 
 type ParkingLotModel struct {
 	DB *sql.DB
+	queryScope
 }
 
-func (m ParkingLotModel) Insert(lot *ParkingLot) error {
-	query := `
-		INSERT INTO parking_lots (name, address, latitude, longitude, total_spots, hourly_rate, daily_rate, monthly_rate, open_time, close_time, is_active, owner_id)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+const insertParkingLotQuery = `
+		INSERT INTO parking_lots (name, address, latitude, longitude, total_spots, hourly_rate, daily_rate, monthly_rate, open_time, close_time, is_active, is_refundable, timezone, tax_rate, violation_fee, max_reservation_days, max_advance_days, vehicle_type_multipliers, min_lead_minutes, overbooking_percent, owner_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
 		RETURNING id, created_at, updated_at, version`
 
-	args := []any{
+func insertParkingLotArgs(lot *ParkingLot) []any {
+	return []any{
 		lot.Name,
 		lot.Address,
 		lot.Latitude,
@@ -82,13 +281,24 @@ func (m ParkingLotModel) Insert(lot *ParkingLot) error {
 		lot.OpenTime,
 		lot.CloseTime,
 		lot.IsActive,
+		lot.IsRefundable,
+		lot.Timezone,
+		lot.TaxRate,
+		lot.ViolationFee,
+		lot.MaxReservationDays,
+		lot.MaxAdvanceDays,
+		lot.VehicleTypeMultipliers,
+		lot.MinLeadMinutes,
+		lot.OverbookingPercent,
 		lot.OwnerID,
 	}
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m ParkingLotModel) Insert(lot *ParkingLot) error {
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+	err := m.DB.QueryRowContext(ctx, insertParkingLotQuery, insertParkingLotArgs(lot)...).Scan(
 		&lot.ID,
 		&lot.CreatedAt,
 		&lot.UpdatedAt,
@@ -101,15 +311,59 @@ func (m ParkingLotModel) Insert(lot *ParkingLot) error {
 	return nil
 }
 
+// Import saves many lots in one transaction, so either all of them are created
+// or none are. With generateSpots each lot also gets TotalSpots regular spots,
+// numbered from 1.
+func (m ParkingLotModel) Import(lots []*ParkingLot, generateSpots bool) error {
+	ctx, cancel := m.longQueryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, lot := range lots {
+		err = tx.QueryRowContext(ctx, insertParkingLotQuery, insertParkingLotArgs(lot)...).Scan(
+			&lot.ID,
+			&lot.CreatedAt,
+			&lot.UpdatedAt,
+			&lot.Version,
+		)
+		if err != nil {
+			return err
+		}
+
+		if generateSpots {
+			spots := make([]ParkingSpot, lot.TotalSpots)
+			for i := range spots {
+				spots[i] = ParkingSpot{
+					SpotNumber: strconv.Itoa(i + 1),
+					SpotType:   SpotTypeRegular,
+					Status:     SpotStatusActive,
+				}
+			}
+
+			err = insertParkingSpots(ctx, tx, lot.ID, spots)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
 func (m ParkingLotModel) Get(id uuid.UUID) (*ParkingLot, error) {
 	query := `
-		SELECT id, name, address, latitude, longitude, total_spots, hourly_rate, daily_rate, monthly_rate, open_time, close_time, is_active, owner_id, created_at, updated_at, version
+		SELECT id, name, address, latitude, longitude, total_spots, hourly_rate, daily_rate, monthly_rate, open_time, close_time, is_active, is_refundable, timezone, tax_rate, violation_fee, max_reservation_days, max_advance_days, vehicle_type_multipliers, min_lead_minutes, overbooking_percent, owner_id, created_at, updated_at, version
 		FROM parking_lots
 		WHERE id = $1`
 
 	var lot ParkingLot
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
@@ -125,6 +379,15 @@ func (m ParkingLotModel) Get(id uuid.UUID) (*ParkingLot, error) {
 		&lot.OpenTime,
 		&lot.CloseTime,
 		&lot.IsActive,
+		&lot.IsRefundable,
+		&lot.Timezone,
+		&lot.TaxRate,
+		&lot.ViolationFee,
+		&lot.MaxReservationDays,
+		&lot.MaxAdvanceDays,
+		&lot.VehicleTypeMultipliers,
+		&lot.MinLeadMinutes,
+		&lot.OverbookingPercent,
 		&lot.OwnerID,
 		&lot.CreatedAt,
 		&lot.UpdatedAt,
@@ -143,9 +406,41 @@ func (m ParkingLotModel) Get(id uuid.UUID) (*ParkingLot, error) {
 	return &lot, nil
 }
 
+// GetPricing returns the rates of the lot with the given ID.
+func (m ParkingLotModel) GetPricing(lotID uuid.UUID) (PricingInfo, error) {
+	query := `
+		SELECT id, hourly_rate, daily_rate, monthly_rate, tax_rate, vehicle_type_multipliers
+		FROM parking_lots
+		WHERE id = $1`
+
+	var lot ParkingLot
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, lotID).Scan(
+		&lot.ID,
+		&lot.HourlyRate,
+		&lot.DailyRate,
+		&lot.MonthlyRate,
+		&lot.TaxRate,
+		&lot.VehicleTypeMultipliers,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return PricingInfo{}, ErrRecordNotFound
+		default:
+			return PricingInfo{}, err
+		}
+	}
+
+	return lot.Pricing(), nil
+}
+
 func (m ParkingLotModel) GetAll(filters Filters) ([]*ParkingLot, Metadata, error) {
 	query := `
-		SELECT count(*) OVER(), id, name, address, latitude, longitude, total_spots, hourly_rate, daily_rate, monthly_rate, open_time, close_time, is_active, owner_id, created_at, updated_at, version
+		SELECT count(*) OVER(), id, name, address, latitude, longitude, total_spots, hourly_rate, daily_rate, monthly_rate, open_time, close_time, is_active, is_refundable, timezone, tax_rate, violation_fee, max_reservation_days, max_advance_days, vehicle_type_multipliers, min_lead_minutes, overbooking_percent, owner_id, created_at, updated_at, version
 		FROM parking_lots
 		WHERE is_active = true
 		ORDER BY %s %s, id ASC
@@ -153,7 +448,7 @@ func (m ParkingLotModel) GetAll(filters Filters) ([]*ParkingLot, Metadata, error
 
 	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	args := []any{filters.limit(), filters.offset()}
@@ -184,6 +479,15 @@ func (m ParkingLotModel) GetAll(filters Filters) ([]*ParkingLot, Metadata, error
 			&lot.OpenTime,
 			&lot.CloseTime,
 			&lot.IsActive,
+			&lot.IsRefundable,
+			&lot.Timezone,
+			&lot.TaxRate,
+			&lot.ViolationFee,
+			&lot.MaxReservationDays,
+			&lot.MaxAdvanceDays,
+			&lot.VehicleTypeMultipliers,
+			&lot.MinLeadMinutes,
+			&lot.OverbookingPercent,
 			&lot.OwnerID,
 			&lot.CreatedAt,
 			&lot.UpdatedAt,
@@ -205,20 +509,24 @@ func (m ParkingLotModel) GetAll(filters Filters) ([]*ParkingLot, Metadata, error
 	return lots, metadata, nil
 }
 
-func (m ParkingLotModel) GetByOwner(ownerID uuid.UUID, filters Filters) ([]*ParkingLot, Metadata, error) {
+// GetByOwner lists an owner's lots. A nil active returns lots in either state;
+// a non-empty search matches against the lot's name and address.
+func (m ParkingLotModel) GetByOwner(ownerID uuid.UUID, active *bool, search string, filters Filters) ([]*ParkingLot, Metadata, error) {
 	query := `
-		SELECT count(*) OVER(), id, name, address, latitude, longitude, total_spots, hourly_rate, daily_rate, monthly_rate, open_time, close_time, is_active, owner_id, created_at, updated_at, version
+		SELECT count(*) OVER(), id, name, address, latitude, longitude, total_spots, hourly_rate, daily_rate, monthly_rate, open_time, close_time, is_active, is_refundable, timezone, tax_rate, violation_fee, max_reservation_days, max_advance_days, vehicle_type_multipliers, min_lead_minutes, overbooking_percent, owner_id, created_at, updated_at, version
 		FROM parking_lots
 		WHERE owner_id = $1
+		AND ($2::boolean IS NULL OR is_active = $2)
+		AND ($3 = '' OR name ILIKE '%%' || $3 || '%%' OR address ILIKE '%%' || $3 || '%%')
 		ORDER BY %s %s, id ASC
-		LIMIT $2 OFFSET $3`
+		LIMIT $4 OFFSET $5`
 
 	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
-	args := []any{ownerID, filters.limit(), filters.offset()}
+	args := []any{ownerID, active, escapeLike(search), filters.limit(), filters.offset()}
 
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -246,6 +554,15 @@ func (m ParkingLotModel) GetByOwner(ownerID uuid.UUID, filters Filters) ([]*Park
 			&lot.OpenTime,
 			&lot.CloseTime,
 			&lot.IsActive,
+			&lot.IsRefundable,
+			&lot.Timezone,
+			&lot.TaxRate,
+			&lot.ViolationFee,
+			&lot.MaxReservationDays,
+			&lot.MaxAdvanceDays,
+			&lot.VehicleTypeMultipliers,
+			&lot.MinLeadMinutes,
+			&lot.OverbookingPercent,
 			&lot.OwnerID,
 			&lot.CreatedAt,
 			&lot.UpdatedAt,
@@ -267,20 +584,40 @@ func (m ParkingLotModel) GetByOwner(ownerID uuid.UUID, filters Filters) ([]*Park
 	return lots, metadata, nil
 }
 
-func (m ParkingLotModel) SearchByLocation(lat, lng, radiusKm float64, filters Filters) ([]*ParkingLot, Metadata, error) {
-	// Using Haversine formula for distance calculation
+// HasLots reports whether the user owns any parking lots.
+func (m ParkingLotModel) HasLots(ownerID uuid.UUID) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM parking_lots WHERE owner_id = $1)`
+
+	var hasLots bool
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, ownerID).Scan(&hasLots)
+	return hasLots, err
+}
+
+// SearchByLocation returns the active lots within radiusKm of the given point,
+// closest first, with their distance from it.
+func (m ParkingLotModel) SearchByLocation(lat, lng, radiusKm float64, filters Filters) ([]*ParkingLotWithDistance, Metadata, error) {
+	// Using Haversine formula for distance calculation. The distance is worked
+	// out in a subquery so the outer query can filter on it.
 	query := `
-		SELECT count(*) OVER(), id, name, address, latitude, longitude, total_spots, hourly_rate, daily_rate, monthly_rate, open_time, close_time, is_active, owner_id, created_at, updated_at, version,
-		(6371 * acos(cos(radians($1)) * cos(radians(latitude)) * cos(radians(longitude) - radians($2)) + sin(radians($1)) * sin(radians(latitude)))) AS distance
-		FROM parking_lots
-		WHERE is_active = true
-		HAVING distance <= $3
+		SELECT count(*) OVER(), id, name, address, latitude, longitude, total_spots, hourly_rate, daily_rate, monthly_rate, open_time, close_time, is_active, is_refundable, timezone, tax_rate, violation_fee, max_reservation_days, max_advance_days, vehicle_type_multipliers, min_lead_minutes, overbooking_percent, owner_id, created_at, updated_at, version,
+		distance
+		FROM (
+			SELECT *,
+			(6371 * acos(LEAST(1, cos(radians($1)) * cos(radians(latitude)) * cos(radians(longitude) - radians($2)) + sin(radians($1)) * sin(radians(latitude))))) AS distance
+			FROM parking_lots
+			WHERE is_active = true
+		) lots
+		WHERE distance <= $3
 		ORDER BY distance ASC, %s %s
 		LIMIT $4 OFFSET $5`
 
 	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	args := []any{lat, lng, radiusKm, filters.limit(), filters.offset()}
@@ -292,11 +629,10 @@ func (m ParkingLotModel) SearchByLocation(lat, lng, radiusKm float64, filters Fi
 	defer rows.Close()
 
 	totalRecords := 0
-	lots := []*ParkingLot{}
+	lots := []*ParkingLotWithDistance{}
 
 	for rows.Next() {
-		var lot ParkingLot
-		var distance float64
+		var lot ParkingLotWithDistance
 
 		err := rows.Scan(
 			&totalRecords,
@@ -312,11 +648,20 @@ func (m ParkingLotModel) SearchByLocation(lat, lng, radiusKm float64, filters Fi
 			&lot.OpenTime,
 			&lot.CloseTime,
 			&lot.IsActive,
+			&lot.IsRefundable,
+			&lot.Timezone,
+			&lot.TaxRate,
+			&lot.ViolationFee,
+			&lot.MaxReservationDays,
+			&lot.MaxAdvanceDays,
+			&lot.VehicleTypeMultipliers,
+			&lot.MinLeadMinutes,
+			&lot.OverbookingPercent,
 			&lot.OwnerID,
 			&lot.CreatedAt,
 			&lot.UpdatedAt,
 			&lot.Version,
-			&distance,
+			&lot.Distance,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
@@ -337,8 +682,8 @@ func (m ParkingLotModel) SearchByLocation(lat, lng, radiusKm float64, filters Fi
 func (m ParkingLotModel) Update(lot *ParkingLot) error {
 	query := `
 		UPDATE parking_lots
-		SET name = $1, address = $2, latitude = $3, longitude = $4, total_spots = $5, hourly_rate = $6, daily_rate = $7, monthly_rate = $8, open_time = $9, close_time = $10, is_active = $11, updated_at = CURRENT_TIMESTAMP, version = version + 1
-		WHERE id = $12 AND version = $13
+		SET name = $1, address = $2, latitude = $3, longitude = $4, total_spots = $5, hourly_rate = $6, daily_rate = $7, monthly_rate = $8, open_time = $9, close_time = $10, is_active = $11, is_refundable = $12, timezone = $13, tax_rate = $14, violation_fee = $15, max_reservation_days = $16, max_advance_days = $17, vehicle_type_multipliers = $18, min_lead_minutes = $19, overbooking_percent = $20, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $21 AND version = $22
 		RETURNING updated_at, version`
 
 	args := []any{
@@ -353,11 +698,20 @@ func (m ParkingLotModel) Update(lot *ParkingLot) error {
 		lot.OpenTime,
 		lot.CloseTime,
 		lot.IsActive,
+		lot.IsRefundable,
+		lot.Timezone,
+		lot.TaxRate,
+		lot.ViolationFee,
+		lot.MaxReservationDays,
+		lot.MaxAdvanceDays,
+		lot.VehicleTypeMultipliers,
+		lot.MinLeadMinutes,
+		lot.OverbookingPercent,
 		lot.ID,
 		lot.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&lot.UpdatedAt, &lot.Version)
@@ -373,10 +727,114 @@ func (m ParkingLotModel) Update(lot *ParkingLot) error {
 	return nil
 }
 
+// Clone creates a lot for the source lot's owner with the same rates, hours
+// and booking settings under a new name and location. With copySpots the
+// source's spot layout is recreated as well, every spot free and active, but
+// decommissioned spots are left out. Reviews, reservations and sessions stay
+// with the source lot.
+func (m ParkingLotModel) Clone(sourceID uuid.UUID, newName, newAddress string, lat, lng float64, copySpots bool) (*ParkingLot, error) {
+	query := `
+		INSERT INTO parking_lots (name, address, latitude, longitude, total_spots, hourly_rate, daily_rate, monthly_rate, open_time, close_time, is_active, is_refundable, timezone, tax_rate, violation_fee, max_reservation_days, max_advance_days, vehicle_type_multipliers, min_lead_minutes, overbooking_percent, owner_id)
+		SELECT $2, $3, $4, $5, total_spots, hourly_rate, daily_rate, monthly_rate, open_time, close_time, is_active, is_refundable, timezone, tax_rate, violation_fee, max_reservation_days, max_advance_days, vehicle_type_multipliers, min_lead_minutes, overbooking_percent, owner_id
+		FROM parking_lots
+		WHERE id = $1
+		RETURNING id, name, address, latitude, longitude, total_spots, hourly_rate, daily_rate, monthly_rate, open_time, close_time, is_active, is_refundable, timezone, tax_rate, violation_fee, max_reservation_days, max_advance_days, vehicle_type_multipliers, min_lead_minutes, overbooking_percent, owner_id, created_at, updated_at, version`
+
+	var lot ParkingLot
+
+	ctx, cancel := m.longQueryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, sourceID, newName, newAddress, lat, lng).Scan(
+		&lot.ID,
+		&lot.Name,
+		&lot.Address,
+		&lot.Latitude,
+		&lot.Longitude,
+		&lot.TotalSpots,
+		&lot.HourlyRate,
+		&lot.DailyRate,
+		&lot.MonthlyRate,
+		&lot.OpenTime,
+		&lot.CloseTime,
+		&lot.IsActive,
+		&lot.IsRefundable,
+		&lot.Timezone,
+		&lot.TaxRate,
+		&lot.ViolationFee,
+		&lot.MaxReservationDays,
+		&lot.MaxAdvanceDays,
+		&lot.VehicleTypeMultipliers,
+		&lot.MinLeadMinutes,
+		&lot.OverbookingPercent,
+		&lot.OwnerID,
+		&lot.CreatedAt,
+		&lot.UpdatedAt,
+		&lot.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if copySpots {
+		query = `
+			SELECT spot_number, spot_type
+			FROM parking_spots
+			WHERE parking_lot_id = $1 AND status <> $2
+			ORDER BY spot_number`
+
+		rows, err := tx.QueryContext(ctx, query, sourceID, SpotStatusDecommissioned)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		spots := []ParkingSpot{}
+
+		for rows.Next() {
+			spot := ParkingSpot{Status: SpotStatusActive}
+
+			err := rows.Scan(&spot.SpotNumber, &spot.SpotType)
+			if err != nil {
+				return nil, err
+			}
+
+			spots = append(spots, spot)
+		}
+
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+
+		err = insertParkingSpots(ctx, tx, lot.ID, spots)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &lot, nil
+}
+
 func (m ParkingLotModel) Delete(id uuid.UUID) error {
 	query := `DELETE FROM parking_lots WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	result, err := m.DB.ExecContext(ctx, query, id)
@@ -396,15 +854,253 @@ func (m ParkingLotModel) Delete(id uuid.UUID) error {
 	return nil
 }
 
+// GetActualSpotCount returns the number of spot rows configured for a lot,
+// which can drift from the free-form TotalSpots field.
+func (m ParkingLotModel) GetActualSpotCount(lotID uuid.UUID) (int, error) {
+	query := `SELECT COUNT(*) FROM parking_spots WHERE parking_lot_id = $1`
+
+	var count int
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, lotID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+type SpotCountMismatch struct {
+	ParkingLotID uuid.UUID `json:"parking_lot_id"`
+	Name         string    `json:"name"`
+	OwnerID      uuid.UUID `json:"owner_id"`
+	TotalSpots   int       `json:"total_spots"`
+	ActualSpots  int       `json:"actual_spots"`
+}
+
+// GetSpotCountMismatches lists lots whose TotalSpots differs from the number of
+// spot rows actually configured for them.
+func (m ParkingLotModel) GetSpotCountMismatches(filters Filters) ([]*SpotCountMismatch, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, name, owner_id, total_spots, actual_spots
+		FROM (
+			SELECT pl.id, pl.name, pl.owner_id, pl.total_spots, COUNT(ps.id) AS actual_spots
+			FROM parking_lots pl
+			LEFT JOIN parking_spots ps ON ps.parking_lot_id = pl.id
+			GROUP BY pl.id
+		) counts
+		WHERE total_spots <> actual_spots
+		ORDER BY %s %s, id ASC
+		LIMIT $1 OFFSET $2`
+
+	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := m.longQueryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	mismatches := []*SpotCountMismatch{}
+
+	for rows.Next() {
+		var mismatch SpotCountMismatch
+
+		err := rows.Scan(
+			&totalRecords,
+			&mismatch.ParkingLotID,
+			&mismatch.Name,
+			&mismatch.OwnerID,
+			&mismatch.TotalSpots,
+			&mismatch.ActualSpots,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		mismatches = append(mismatches, &mismatch)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return mismatches, metadata, nil
+}
+
+// GetTopRated returns active lots ordered by average rating. Only lots with at
+// least MinReviewsForTopRated visible reviews are considered.
+func (m ParkingLotModel) GetTopRated(limit int) ([]*ParkingLotWithStats, error) {
+	query := `
+		SELECT pl.id, pl.name, pl.address, pl.latitude, pl.longitude, pl.total_spots, pl.hourly_rate, pl.daily_rate, pl.monthly_rate,
+		       pl.open_time, pl.close_time, pl.is_active, pl.is_refundable, pl.timezone, pl.tax_rate, pl.violation_fee, pl.max_reservation_days, pl.max_advance_days, pl.vehicle_type_multipliers, pl.min_lead_minutes, pl.overbooking_percent, pl.owner_id, pl.created_at, pl.updated_at, pl.version,
+		       r.average_rating, r.total_reviews, COALESCE(s.completed_sessions, 0)
+		FROM parking_lots pl
+		INNER JOIN (
+			SELECT parking_lot_id, AVG(rating)::float AS average_rating, COUNT(*) AS total_reviews
+			FROM reviews
+			WHERE is_hidden = false
+			GROUP BY parking_lot_id
+			HAVING COUNT(*) >= $1
+		) r ON r.parking_lot_id = pl.id
+		LEFT JOIN (
+			SELECT ps.parking_lot_id, COUNT(*) AS completed_sessions
+			FROM parking_sessions s
+			INNER JOIN parking_spots ps ON ps.id = s.parking_spot_id
+			WHERE s.status = $2
+			GROUP BY ps.parking_lot_id
+		) s ON s.parking_lot_id = pl.id
+		WHERE pl.is_active = true
+		ORDER BY r.average_rating DESC, r.total_reviews DESC, pl.id ASC
+		LIMIT $3`
+
+	return m.getWithStats(query, MinReviewsForTopRated, SessionStatusCompleted, limit)
+}
+
+// GetMostPopular returns active lots ordered by how many parking sessions have
+// been completed in them.
+func (m ParkingLotModel) GetMostPopular(limit int) ([]*ParkingLotWithStats, error) {
+	query := `
+		SELECT pl.id, pl.name, pl.address, pl.latitude, pl.longitude, pl.total_spots, pl.hourly_rate, pl.daily_rate, pl.monthly_rate,
+		       pl.open_time, pl.close_time, pl.is_active, pl.is_refundable, pl.timezone, pl.tax_rate, pl.violation_fee, pl.max_reservation_days, pl.max_advance_days, pl.vehicle_type_multipliers, pl.min_lead_minutes, pl.overbooking_percent, pl.owner_id, pl.created_at, pl.updated_at, pl.version,
+		       COALESCE(r.average_rating, 0), COALESCE(r.total_reviews, 0), s.completed_sessions
+		FROM parking_lots pl
+		INNER JOIN (
+			SELECT ps.parking_lot_id, COUNT(*) AS completed_sessions
+			FROM parking_sessions s
+			INNER JOIN parking_spots ps ON ps.id = s.parking_spot_id
+			WHERE s.status = $1
+			GROUP BY ps.parking_lot_id
+		) s ON s.parking_lot_id = pl.id
+		LEFT JOIN (
+			SELECT parking_lot_id, AVG(rating)::float AS average_rating, COUNT(*) AS total_reviews
+			FROM reviews
+			WHERE is_hidden = false
+			GROUP BY parking_lot_id
+		) r ON r.parking_lot_id = pl.id
+		WHERE pl.is_active = true
+		ORDER BY s.completed_sessions DESC, pl.id ASC
+		LIMIT $2`
+
+	return m.getWithStats(query, SessionStatusCompleted, limit)
+}
+
+func (m ParkingLotModel) getWithStats(query string, args ...any) ([]*ParkingLotWithStats, error) {
+	ctx, cancel := m.longQueryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lots := []*ParkingLotWithStats{}
+
+	for rows.Next() {
+		var lot ParkingLotWithStats
+
+		err := rows.Scan(
+			&lot.ID,
+			&lot.Name,
+			&lot.Address,
+			&lot.Latitude,
+			&lot.Longitude,
+			&lot.TotalSpots,
+			&lot.HourlyRate,
+			&lot.DailyRate,
+			&lot.MonthlyRate,
+			&lot.OpenTime,
+			&lot.CloseTime,
+			&lot.IsActive,
+			&lot.IsRefundable,
+			&lot.Timezone,
+			&lot.TaxRate,
+			&lot.ViolationFee,
+			&lot.MaxReservationDays,
+			&lot.MaxAdvanceDays,
+			&lot.VehicleTypeMultipliers,
+			&lot.MinLeadMinutes,
+			&lot.OverbookingPercent,
+			&lot.OwnerID,
+			&lot.CreatedAt,
+			&lot.UpdatedAt,
+			&lot.Version,
+			&lot.AverageRating,
+			&lot.TotalReviews,
+			&lot.CompletedSessions,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		lots = append(lots, &lot)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lots, nil
+}
+
+// Autocomplete suggests active lots whose name or address starts with term,
+// ignoring case. Name matches come first, shorter names before longer ones.
+func (m ParkingLotModel) Autocomplete(term string, limit int) ([]*LotSuggestion, error) {
+	query := `
+		SELECT id, name, address
+		FROM parking_lots
+		WHERE is_active = true
+		AND (lower(name) LIKE $1 || '%' OR lower(address) LIKE $1 || '%')
+		ORDER BY lower(name) LIKE $1 || '%' DESC, length(name) ASC, name ASC, id ASC
+		LIMIT $2`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, escapeLike(strings.ToLower(term)), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []*LotSuggestion{}
+
+	for rows.Next() {
+		var suggestion LotSuggestion
+
+		err := rows.Scan(&suggestion.ID, &suggestion.Name, &suggestion.Address)
+		if err != nil {
+			return nil, err
+		}
+
+		suggestions = append(suggestions, &suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
 func (m ParkingLotModel) GetAvailableSpots(lotID uuid.UUID) (int, error) {
 	query := `
 		SELECT COUNT(*)
 		FROM parking_spots
-		WHERE parking_lot_id = $1 AND is_active = true AND is_occupied = false AND is_reserved = false`
+		WHERE parking_lot_id = $1 AND status = 'active' AND is_occupied = false AND is_reserved = false`
 
 	var availableSpots int
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, lotID).Scan(&availableSpots)
@@ -414,3 +1110,8 @@ func (m ParkingLotModel) GetAvailableSpots(lotID uuid.UUID) (int, error) {
 
 	return availableSpots, nil
 }
+
+// escapeLike makes s match literally inside a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
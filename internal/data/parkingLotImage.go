@@ -0,0 +1,341 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTooManyLotImages  = errors.New("parking lot has too many images")
+	ErrInvalidImageOrder = errors.New("image order must list each of the lot's images once")
+)
+
+// MaxLotImages caps how many images a parking lot may have.
+const MaxLotImages = 10
+
+// LotImageURLPrefix is where uploaded lot images are served from; the image
+// key is appended to it.
+const LotImageURLPrefix = "/v1/files/lot-images/"
+
+// ParkingLotImage is a photo of a parking lot. Images are shown in
+// DisplayOrder, and at most one per lot is the primary image used as its
+// thumbnail.
+type ParkingLotImage struct {
+	ID           uuid.UUID `json:"id" db:"id"`
+	ParkingLotID uuid.UUID `json:"parking_lot_id" db:"parking_lot_id"`
+	ImageKey     string    `json:"-" db:"image_key"`
+	URL          string    `json:"url"`
+	DisplayOrder int       `json:"display_order" db:"display_order"`
+	IsPrimary    bool      `json:"is_primary" db:"is_primary"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	Version      int       `json:"version" db:"version"`
+}
+
+type ParkingLotImageModel struct {
+	DB *sql.DB
+	queryScope
+}
+
+// Add saves an image after the lot's existing ones. The first image of a lot is
+// always primary; adding another as primary takes the flag from the current
+// one. A lot that already has MaxLotImages returns ErrTooManyLotImages.
+func (m ParkingLotImageModel) Add(image *ParkingLotImage) error {
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the lot so concurrent uploads can't both pass the cap
+	_, err = tx.ExecContext(ctx, `SELECT 1 FROM parking_lots WHERE id = $1 FOR UPDATE`, image.ParkingLotID)
+	if err != nil {
+		return err
+	}
+
+	var count, nextOrder int
+
+	query := `
+		SELECT COUNT(*), COALESCE(MAX(display_order) + 1, 0)
+		FROM parking_lot_images
+		WHERE parking_lot_id = $1`
+
+	err = tx.QueryRowContext(ctx, query, image.ParkingLotID).Scan(&count, &nextOrder)
+	if err != nil {
+		return err
+	}
+
+	if count >= MaxLotImages {
+		return ErrTooManyLotImages
+	}
+
+	image.DisplayOrder = nextOrder
+	if count == 0 {
+		image.IsPrimary = true
+	}
+
+	if image.IsPrimary {
+		err = clearPrimaryLotImage(ctx, tx, image.ParkingLotID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query = `
+		INSERT INTO parking_lot_images (parking_lot_id, image_key, display_order, is_primary)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at, version`
+
+	args := []any{image.ParkingLotID, image.ImageKey, image.DisplayOrder, image.IsPrimary}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&image.ID, &image.CreatedAt, &image.UpdatedAt, &image.Version)
+	if err != nil {
+		return err
+	}
+
+	image.URL = LotImageURLPrefix + image.ImageKey
+
+	return tx.Commit()
+}
+
+func clearPrimaryLotImage(ctx context.Context, tx *sql.Tx, lotID uuid.UUID) error {
+	query := `
+		UPDATE parking_lot_images
+		SET is_primary = false, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE parking_lot_id = $1 AND is_primary`
+
+	_, err := tx.ExecContext(ctx, query, lotID)
+	return err
+}
+
+const parkingLotImageColumns = `
+		SELECT id, parking_lot_id, image_key, display_order, is_primary, created_at, updated_at, version
+		FROM parking_lot_images`
+
+type parkingLotImageScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanParkingLotImage(row parkingLotImageScanner) (*ParkingLotImage, error) {
+	var image ParkingLotImage
+
+	err := row.Scan(
+		&image.ID,
+		&image.ParkingLotID,
+		&image.ImageKey,
+		&image.DisplayOrder,
+		&image.IsPrimary,
+		&image.CreatedAt,
+		&image.UpdatedAt,
+		&image.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	image.URL = LotImageURLPrefix + image.ImageKey
+
+	return &image, nil
+}
+
+// Get returns one of a lot's images.
+func (m ParkingLotImageModel) Get(id, lotID uuid.UUID) (*ParkingLotImage, error) {
+	query := parkingLotImageColumns + `
+		WHERE id = $1 AND parking_lot_id = $2`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	image, err := scanParkingLotImage(m.DB.QueryRowContext(ctx, query, id, lotID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return image, nil
+}
+
+// List returns a lot's images in display order.
+func (m ParkingLotImageModel) List(lotID uuid.UUID) ([]*ParkingLotImage, error) {
+	query := parkingLotImageColumns + `
+		WHERE parking_lot_id = $1
+		ORDER BY display_order ASC, created_at ASC, id ASC`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, lotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []*ParkingLotImage{}
+
+	for rows.Next() {
+		image, err := scanParkingLotImage(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		images = append(images, image)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+// SetPrimary makes the image its lot's primary image.
+func (m ParkingLotImageModel) SetPrimary(image *ParkingLotImage) error {
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = clearPrimaryLotImage(ctx, tx, image.ParkingLotID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE parking_lot_images
+		SET is_primary = true, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $1
+		RETURNING updated_at, version`
+
+	err = tx.QueryRowContext(ctx, query, image.ID).Scan(&image.UpdatedAt, &image.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	image.IsPrimary = true
+
+	return tx.Commit()
+}
+
+// Reorder sets the display order of a lot's images to the order of ids, which
+// must name each of its images exactly once; otherwise it returns
+// ErrInvalidImageOrder.
+func (m ParkingLotImageModel) Reorder(lotID uuid.UUID, ids []uuid.UUID) error {
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM parking_lot_images WHERE parking_lot_id = $1 FOR UPDATE`, lotID)
+	if err != nil {
+		return err
+	}
+
+	existing := map[uuid.UUID]bool{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[id] = true
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if len(ids) != len(existing) {
+		return ErrInvalidImageOrder
+	}
+
+	query := `
+		UPDATE parking_lot_images
+		SET display_order = $1, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $2`
+
+	for i, id := range ids {
+		if !existing[id] {
+			return ErrInvalidImageOrder
+		}
+		// Each id may only be used once
+		delete(existing, id)
+
+		_, err = tx.ExecContext(ctx, query, i, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes an image. When it was the primary image, the next image in
+// display order becomes primary.
+func (m ParkingLotImageModel) Delete(image *ParkingLotImage) error {
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM parking_lot_images WHERE id = $1`, image.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	if image.IsPrimary {
+		query := `
+			UPDATE parking_lot_images
+			SET is_primary = true, updated_at = CURRENT_TIMESTAMP, version = version + 1
+			WHERE id = (
+				SELECT id FROM parking_lot_images
+				WHERE parking_lot_id = $1
+				ORDER BY display_order ASC, created_at ASC, id ASC
+				LIMIT 1
+			)`
+
+		_, err = tx.ExecContext(ctx, query, image.ParkingLotID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
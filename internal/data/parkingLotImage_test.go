@@ -0,0 +1,101 @@
+package data
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestParkingLotImages(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	lot, _ := insertTestLot(t, m, owner.ID, 0)
+
+	add := func(primary bool) *ParkingLotImage {
+		t.Helper()
+
+		image := &ParkingLotImage{ParkingLotID: lot.ID, ImageKey: uuid.NewString(), IsPrimary: primary}
+		if err := m.ParkingLotImages.Add(image); err != nil {
+			t.Fatal(err)
+		}
+		return image
+	}
+
+	// The first image is primary even when not asked to be
+	first := add(false)
+	second := add(false)
+	third := add(true)
+
+	if first.URL != LotImageURLPrefix+first.ImageKey {
+		t.Errorf("url = %q", first.URL)
+	}
+
+	primaries := func() []uuid.UUID {
+		t.Helper()
+
+		images, err := m.ParkingLotImages.List(lot.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []uuid.UUID
+		for _, image := range images {
+			if image.IsPrimary {
+				ids = append(ids, image.ID)
+			}
+		}
+		return ids
+	}
+
+	if got := primaries(); len(got) != 1 || got[0] != third.ID {
+		t.Errorf("primary images = %v; want only %s", got, third.ID)
+	}
+
+	err := m.ParkingLotImages.Reorder(lot.ID, []uuid.UUID{third.ID, first.ID, second.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	images, err := m.ParkingLotImages.List(lot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []uuid.UUID{third.ID, first.ID, second.ID} {
+		if images[i].ID != want || images[i].DisplayOrder != i {
+			t.Errorf("image %d is %s at order %d; want %s", i, images[i].ID, images[i].DisplayOrder, want)
+		}
+	}
+
+	for name, ids := range map[string][]uuid.UUID{
+		"missing an image":  {third.ID, first.ID},
+		"repeating":         {third.ID, first.ID, first.ID},
+		"another lot's":     {third.ID, first.ID, uuid.New()},
+		"with an extra one": {third.ID, first.ID, second.ID, uuid.New()},
+	} {
+		if err := m.ParkingLotImages.Reorder(lot.ID, ids); !errors.Is(err, ErrInvalidImageOrder) {
+			t.Errorf("reorder %s: got %v; want %v", name, err, ErrInvalidImageOrder)
+		}
+	}
+
+	// Deleting the primary image hands the flag to the next one shown
+	if err := m.ParkingLotImages.Delete(third); err != nil {
+		t.Fatal(err)
+	}
+	if got := primaries(); len(got) != 1 || got[0] != first.ID {
+		t.Errorf("primary images after delete = %v; want only %s", got, first.ID)
+	}
+
+	if err := m.ParkingLotImages.SetPrimary(second); err != nil {
+		t.Fatal(err)
+	}
+	if got := primaries(); len(got) != 1 || got[0] != second.ID {
+		t.Errorf("primary images = %v; want only %s", got, second.ID)
+	}
+
+	for i := 2; i < MaxLotImages; i++ {
+		add(false)
+	}
+	err = m.ParkingLotImages.Add(&ParkingLotImage{ParkingLotID: lot.ID, ImageKey: uuid.NewString()})
+	if !errors.Is(err, ErrTooManyLotImages) {
+		t.Errorf("adding past the cap: got %v; want %v", err, ErrTooManyLotImages)
+	}
+}
@@ -0,0 +1,439 @@
+package data
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+func TestSpotCountDivergence(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	lot, _ := insertTestLot(t, m, owner.ID, 3)
+
+	found := func() *SpotCountMismatch {
+		t.Helper()
+
+		mismatches, _, err := m.ParkingLots.GetSpotCountMismatches(Filters{
+			Page:         1,
+			PageSize:     100,
+			Sort:         "-total_spots",
+			SortSafelist: []string{"-total_spots"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, mismatch := range mismatches {
+			if mismatch.ParkingLotID == lot.ID {
+				return mismatch
+			}
+		}
+		return nil
+	}
+
+	actual, err := m.ParkingLots.GetActualSpotCount(lot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual != 3 {
+		t.Errorf("got %d spots; want 3", actual)
+	}
+	if mismatch := found(); mismatch != nil {
+		t.Errorf("lot with matching counts reported as %+v", mismatch)
+	}
+
+	// A large TotalSpots keeps the lot on the first page when sorted by it.
+	_, err = m.ParkingLots.DB.Exec(`UPDATE parking_lots SET total_spots = 1000000 WHERE id = $1`, lot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mismatch := found()
+	if mismatch == nil {
+		t.Fatal("diverging lot is not reported")
+	}
+	if mismatch.TotalSpots != 1000000 || mismatch.ActualSpots != 3 {
+		t.Errorf("got total %d, actual %d; want 1000000 and 3", mismatch.TotalSpots, mismatch.ActualSpots)
+	}
+}
+
+func TestTopRatedRequiresMinimumReviews(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+
+	underReviewed, _ := insertTestLot(t, m, owner.ID, 1)
+	reviewed, _ := insertTestLot(t, m, owner.ID, 1)
+
+	fives := func(n int) []int {
+		ratings := make([]int, n)
+		for i := range ratings {
+			ratings[i] = 5
+		}
+		return ratings
+	}
+
+	insertTestReviews(t, m, underReviewed.ID, fives(MinReviewsForTopRated-1)...)
+	insertTestReviews(t, m, reviewed.ID, fives(MinReviewsForTopRated)...)
+
+	lots, err := m.ParkingLots.GetTopRated(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found *ParkingLotWithStats
+	for _, lot := range lots {
+		if lot.ID == underReviewed.ID {
+			t.Errorf("lot with %d reviews is listed as top rated", MinReviewsForTopRated-1)
+		}
+		if lot.ID == reviewed.ID {
+			found = lot
+		}
+	}
+
+	if found == nil {
+		t.Fatalf("lot with %d reviews is not listed as top rated", MinReviewsForTopRated)
+	}
+	if found.AverageRating != 5 || found.TotalReviews != MinReviewsForTopRated {
+		t.Errorf("got rating %v from %d reviews; want 5 from %d", found.AverageRating, found.TotalReviews, MinReviewsForTopRated)
+	}
+}
+
+func TestGetByOwnerFilters(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	other := insertTestUser(t, m)
+
+	rename := func(lot *ParkingLot, name, address string, active bool) {
+		t.Helper()
+		_, err := m.ParkingLots.DB.Exec(`UPDATE parking_lots SET name = $1, address = $2, is_active = $3 WHERE id = $4`, name, address, active, lot.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	north, _ := insertTestLot(t, m, owner.ID, 1)
+	rename(north, "North Garage", "1 Galle Road", true)
+	south, _ := insertTestLot(t, m, owner.ID, 1)
+	rename(south, "South Garage", "2 Galle Road", false)
+	harbour, _ := insertTestLot(t, m, owner.ID, 1)
+	rename(harbour, "Harbour 100% Lot", "3 Marine Drive", true)
+	elsewhere, _ := insertTestLot(t, m, other.ID, 1)
+	rename(elsewhere, "North Garage", "1 Galle Road", true)
+
+	yes, no := true, false
+
+	tests := []struct {
+		name   string
+		active *bool
+		search string
+		want   []*ParkingLot
+	}{
+		{"everything", nil, "", []*ParkingLot{north, south, harbour}},
+		{"active only", &yes, "", []*ParkingLot{north, harbour}},
+		{"inactive only", &no, "", []*ParkingLot{south}},
+		{"name search ignores case", nil, "garage", []*ParkingLot{north, south}},
+		{"address search", nil, "marine", []*ParkingLot{harbour}},
+		{"search and active", &no, "galle", []*ParkingLot{south}},
+		{"wildcards are literal", nil, "%", []*ParkingLot{harbour}},
+		{"no match", nil, "airport", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lots, metadata, err := m.ParkingLots.GetByOwner(owner.ID, tt.active, tt.search, Filters{
+				Page:         1,
+				PageSize:     20,
+				Sort:         "name",
+				SortSafelist: []string{"name"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := map[uuid.UUID]bool{}
+			for _, lot := range lots {
+				got[lot.ID] = true
+			}
+			if len(got) != len(tt.want) || metadata.TotalRecords != len(tt.want) {
+				t.Errorf("got %d lots (%d total); want %d", len(got), metadata.TotalRecords, len(tt.want))
+			}
+			for _, lot := range tt.want {
+				if !got[lot.ID] {
+					t.Errorf("lot %q missing", lot.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateNotNullIsland(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lng float64
+		rejected bool
+		near     bool
+	}{
+		{"null island", 0, 0, true, true},
+		{"within epsilon", 0.00005, -0.00005, true, true},
+		{"near but not zero", 0.5, 0.3, false, true},
+		{"zero latitude only", 0, 79.8612, false, false},
+		{"colombo", 6.9271, 79.8612, false, false},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateNotNullIsland(v, tt.lat, tt.lng)
+		if _, rejected := v.Errors["latitude"]; rejected != tt.rejected {
+			t.Errorf("%s: rejected = %t; want %t", tt.name, rejected, tt.rejected)
+		}
+		if got := NearNullIsland(tt.lat, tt.lng); got != tt.near {
+			t.Errorf("%s: NearNullIsland = %t; want %t", tt.name, got, tt.near)
+		}
+	}
+}
+
+func TestCloneCopiesConfigNotHistory(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	source, spots := insertTestLot(t, m, owner.ID, 3)
+
+	daily := MoneyFromFloat(800)
+	taxRate := 0.08
+	maxDays := 7
+	source.DailyRate = &daily
+	source.TaxRate = &taxRate
+	source.MaxReservationDays = &maxDays
+	source.OpenTime, source.CloseTime = "06:00", "22:00"
+	source.VehicleTypeMultipliers = VehicleTypeMultipliers{VehicleTypeTruck: 1.5}
+	source.MinLeadMinutes = 30
+	if err := m.ParkingLots.Update(source); err != nil {
+		t.Fatal(err)
+	}
+
+	// History that must stay with the source lot
+	insertTestReviews(t, m, source.ID, 4)
+	vehicle := insertTestVehicle(t, m, owner.ID)
+	insertTestReservation(t, m, vehicle, source.ID, spots[0], time.Now().Add(time.Hour), time.Hour)
+	insertTestSession(t, m, owner.ID, spots[1], time.Now().Add(-time.Hour))
+	if _, err := m.ParkingSpots.DB.Exec(`UPDATE parking_spots SET status = $1 WHERE id = $2`, SpotStatusDecommissioned, spots[2].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	clone, err := m.ParkingLots.Clone(source.ID, "Cloned lot", "2 Test Street", 6.93, 79.86, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if clone.ID == source.ID || clone.Name != "Cloned lot" || clone.Address != "2 Test Street" || clone.Latitude != 6.93 || clone.Longitude != 79.86 {
+		t.Errorf("clone identity = %+v", clone)
+	}
+	if clone.OwnerID != owner.ID {
+		t.Errorf("clone owner = %s, want %s", clone.OwnerID, owner.ID)
+	}
+	if clone.HourlyRate != source.HourlyRate || clone.DailyRate == nil || *clone.DailyRate != daily {
+		t.Errorf("clone rates = %v, %v; want %v, %v", clone.HourlyRate, clone.DailyRate, source.HourlyRate, daily)
+	}
+	if clone.TaxRate == nil || *clone.TaxRate != taxRate || clone.MaxReservationDays == nil || *clone.MaxReservationDays != maxDays {
+		t.Errorf("clone booking settings = tax %v, max days %v", clone.TaxRate, clone.MaxReservationDays)
+	}
+	if clone.OpenTime != "06:00" || clone.CloseTime != "22:00" || clone.Timezone != source.Timezone || clone.MinLeadMinutes != 30 {
+		t.Errorf("clone hours = %s-%s %s, lead %d", clone.OpenTime, clone.CloseTime, clone.Timezone, clone.MinLeadMinutes)
+	}
+	if clone.VehicleTypeMultipliers[VehicleTypeTruck] != 1.5 {
+		t.Errorf("clone multipliers = %v", clone.VehicleTypeMultipliers)
+	}
+
+	cloned, _, err := m.ParkingSpots.GetAllByLot(clone.ID, Filters{
+		Page:         1,
+		PageSize:     100,
+		Sort:         "spot_number",
+		SortSafelist: []string{"spot_number"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cloned) != 2 {
+		t.Fatalf("clone has %d spots, want the 2 in service", len(cloned))
+	}
+	for i, spot := range cloned {
+		if spot.SpotNumber != spots[i].SpotNumber || spot.SpotType != spots[i].SpotType {
+			t.Errorf("spot %d = %s (%s), want %s (%s)", i, spot.SpotNumber, spot.SpotType, spots[i].SpotNumber, spots[i].SpotType)
+		}
+		if spot.IsOccupied || spot.IsReserved || spot.Status != SpotStatusActive {
+			t.Errorf("spot %s isn't free and active: occupied %t, reserved %t, %s", spot.SpotNumber, spot.IsOccupied, spot.IsReserved, spot.Status)
+		}
+	}
+
+	for table, query := range map[string]string{
+		"reviews":          `SELECT count(*) FROM reviews WHERE parking_lot_id = $1`,
+		"reservations":     `SELECT count(*) FROM reservations WHERE parking_lot_id = $1`,
+		"parking_sessions": `SELECT count(*) FROM parking_sessions s JOIN parking_spots ps ON ps.id = s.parking_spot_id WHERE ps.parking_lot_id = $1`,
+	} {
+		var count int
+		if err := m.ParkingLots.DB.QueryRow(query, clone.ID).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("clone has %d %s", count, table)
+		}
+	}
+
+	bare, err := m.ParkingLots.Clone(source.ID, "Bare clone", "3 Test Street", 6.94, 79.87, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, metadata, err := m.ParkingSpots.GetAllByLot(bare.ID, Filters{
+		Page:         1,
+		PageSize:     100,
+		Sort:         "spot_number",
+		SortSafelist: []string{"spot_number"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.TotalRecords != 0 {
+		t.Errorf("clone without spots has %d spots", metadata.TotalRecords)
+	}
+
+	_, err = m.ParkingLots.Clone(uuid.New(), "Nothing", "4 Test Street", 6.95, 79.88, true)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("cloning an unknown lot: err = %v, want %v", err, ErrRecordNotFound)
+	}
+}
+
+func TestAutocomplete(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+
+	// A prefix no other lot has, so the results are only these lots
+	prefix := "zq" + uuid.NewString()[:8]
+
+	lot := func(name, address string, active bool) *ParkingLot {
+		t.Helper()
+
+		lot, _ := insertTestLot(t, m, owner.ID, 0)
+		_, err := m.ParkingLots.DB.Exec(`UPDATE parking_lots SET name = $1, address = $2, is_active = $3 WHERE id = $4`, name, address, active, lot.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lot
+	}
+
+	long := lot(strings.ToUpper(prefix)+" Shopping Plaza", "1 Test Street", true)
+	short := lot(prefix+" Park", "1 Test Street", true)
+	byAddress := lot("Harbour lot", prefix+" Road", true)
+	lot(prefix+" Closed", "1 Test Street", false)
+	lot("Old "+prefix, "1 Test Street", true)
+
+	suggestions, err := m.ParkingLots.Autocomplete(prefix, MaxAutocompleteResults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []uuid.UUID{short.ID, long.ID, byAddress.ID}
+	if len(suggestions) != len(want) {
+		t.Fatalf("got %d suggestions; want %d", len(suggestions), len(want))
+	}
+	for i, suggestion := range suggestions {
+		if suggestion.ID != want[i] {
+			t.Errorf("suggestion %d is %q; want lot %s", i, suggestion.Name, want[i])
+		}
+	}
+
+	suggestions, err = m.ParkingLots.Autocomplete(prefix, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggestions) != 2 {
+		t.Errorf("got %d suggestions; want the limit of 2", len(suggestions))
+	}
+
+	// LIKE wildcards in the term match only themselves
+	suggestions, err = m.ParkingLots.Autocomplete("%"+prefix[2:], MaxAutocompleteResults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggestions) != 0 {
+		t.Errorf("wildcard term matched %d lots", len(suggestions))
+	}
+}
+
+func TestLotCapacity(t *testing.T) {
+	tests := []struct {
+		totalSpots, overbookingPercent int
+		want                           int
+	}{
+		{10, 0, 10},
+		{10, 10, 11},
+		{10, 50, 15},
+		{10, 15, 11},
+		{3, 10, 3},
+		{0, 50, 0},
+	}
+
+	for _, tt := range tests {
+		lot := &ParkingLot{TotalSpots: tt.totalSpots, OverbookingPercent: tt.overbookingPercent}
+		if got := lot.Capacity(); got != tt.want {
+			t.Errorf("%d spots at %d%%: capacity %d; want %d", tt.totalSpots, tt.overbookingPercent, got, tt.want)
+		}
+		if got := lot.AllowsOverbooking(); got != (tt.want > tt.totalSpots) {
+			t.Errorf("%d spots at %d%%: AllowsOverbooking = %t", tt.totalSpots, tt.overbookingPercent, got)
+		}
+	}
+}
+
+func TestValidateOverbookingPercent(t *testing.T) {
+	for percent, valid := range map[int]bool{-1: false, 0: true, MaxOverbookingPercent: true, MaxOverbookingPercent + 1: false} {
+		v := validator.New()
+		ValidateParkingLot(v, &ParkingLot{OverbookingPercent: percent})
+		if _, invalid := v.Errors["overbooking_percent"]; invalid == valid {
+			t.Errorf("%d%%: valid %t; want %t", percent, !invalid, valid)
+		}
+	}
+}
+
+func TestOverbookingAllowsExtraReservations(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+	lot, _ := insertTestLot(t, m, user.ID, 10)
+	vehicle := insertTestVehicle(t, m, user.ID)
+
+	_, err := m.ParkingLots.DB.Exec(`UPDATE parking_lots SET overbooking_percent = 20 WHERE id = $1`, lot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	book := func() (*Reservation, error) {
+		reservation := &Reservation{
+			UserID:       user.ID,
+			VehicleID:    vehicle.ID,
+			ParkingLotID: lot.ID,
+			StartTime:    start,
+			EndTime:      start.Add(time.Hour),
+			Status:       ReservationStatusConfirmed,
+			TotalAmount:  MoneyFromFloat(100),
+		}
+		err := m.Reservations.InsertWithFreeSpot(reservation, []string{SpotTypeRegular}, true)
+		return reservation, err
+	}
+
+	// Ten bookings get a spot each, and 20% more are taken without one
+	for i := 1; i <= 12; i++ {
+		reservation, err := book()
+		if err != nil {
+			t.Fatalf("booking %d: %v", i, err)
+		}
+		if assigned := reservation.ParkingSpotID != nil; assigned != (i <= 10) {
+			t.Errorf("booking %d: assigned a spot %t; want %t", i, assigned, i <= 10)
+		}
+	}
+
+	if _, err := book(); !errors.Is(err, ErrNoSpotAvailable) {
+		t.Errorf("booking past the overbooking limit: got %v; want %v", err, ErrNoSpotAvailable)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
 )
 
@@ -17,6 +18,10 @@ const (
 	SessionStatusViolated  = "violated"
 )
 
+var (
+	ErrVehicleAlreadyParked = errors.New("vehicle already parked")
+)
+
 type ParkingSession struct {
 	ID            uuid.UUID  `json:"id" db:"id"`
 	ReservationID *uuid.UUID `json:"reservation_id" db:"reservation_id"`
@@ -28,6 +33,8 @@ type ParkingSession struct {
 	Status        string     `json:"status" db:"status"`
 	TotalDuration *int       `json:"total_duration" db:"total_duration"` // in minutes
 	TotalAmount   *float64   `json:"total_amount" db:"total_amount"`
+	ExpectedEnd   *time.Time `json:"expected_end,omitempty" db:"expected_end"` // prepaid time for walk-ins
+	PrepaidAmount float64    `json:"prepaid_amount" db:"prepaid_amount"`
 	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
 	Version       int        `json:"version" db:"version"`
@@ -57,9 +64,29 @@ func ValidateParkingSession(v *validator.Validator, session *ParkingSession) {
 
 type ParkingSessionModel struct {
 	DB *sql.DB
+	queryScope
 }
 
 func (m ParkingSessionModel) Insert(session *ParkingSession) error {
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.insertTx(ctx, tx, session)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertTx is Insert within tx.
+func (m ParkingSessionModel) insertTx(ctx context.Context, tx *sql.Tx, session *ParkingSession) error {
 	query := `
 		INSERT INTO parking_sessions (reservation_id, user_id, vehicle_id, parking_spot_id, check_in_time, status)
 		VALUES ($1, $2, $3, $4, $5, $6)
@@ -74,31 +101,79 @@ func (m ParkingSessionModel) Insert(session *ParkingSession) error {
 		session.Status,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+	err := tx.QueryRowContext(ctx, query, args...).Scan(
 		&session.ID,
 		&session.CreatedAt,
 		&session.UpdatedAt,
 		&session.Version,
 	)
 	if err != nil {
-		return err
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "parking_sessions_active_vehicle_idx"`:
+			return ErrVehicleAlreadyParked
+		default:
+			return err
+		}
 	}
 
 	return nil
 }
 
+// CheckInReservation starts an active session for the session's reservation in
+// one transaction: it claims the spot, saves the session and marks the
+// reservation active, rolling all three back if any of them fails. A vehicle
+// that is already parked gets ErrVehicleAlreadyParked, a spot taken in the
+// meantime ErrEditConflict and a reservation that can't be checked in a
+// TransitionError.
+func (m ParkingSessionModel) CheckInReservation(session *ParkingSession) error {
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var parked bool
+
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM parking_sessions WHERE vehicle_id = $1 AND status = $2)`, session.VehicleID, SessionStatusActive).Scan(&parked)
+	if err != nil {
+		return err
+	}
+	if parked {
+		return ErrVehicleAlreadyParked
+	}
+
+	err = ParkingSpotModel{DB: m.DB}.setOccupiedTx(ctx, tx, session.ParkingSpotID, true)
+	if err != nil {
+		return err
+	}
+
+	session.Status = SessionStatusActive
+
+	err = m.insertTx(ctx, tx, session)
+	if err != nil {
+		return err
+	}
+
+	err = ReservationModel{DB: m.DB}.transitionTx(ctx, tx, *session.ReservationID, ReservationStatusActive, "actual_start_time = $3, ", session.CheckInTime)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (m ParkingSessionModel) Get(id uuid.UUID) (*ParkingSession, error) {
 	query := `
-		SELECT id, reservation_id, user_id, vehicle_id, parking_spot_id, check_in_time, check_out_time, status, total_duration, total_amount, created_at, updated_at, version
+		SELECT id, reservation_id, user_id, vehicle_id, parking_spot_id, check_in_time, check_out_time, status, total_duration, total_amount, expected_end, prepaid_amount, created_at, updated_at, version
 		FROM parking_sessions
 		WHERE id = $1`
 
 	var session ParkingSession
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
@@ -112,6 +187,8 @@ func (m ParkingSessionModel) Get(id uuid.UUID) (*ParkingSession, error) {
 		&session.Status,
 		&session.TotalDuration,
 		&session.TotalAmount,
+		&session.ExpectedEnd,
+		&session.PrepaidAmount,
 		&session.CreatedAt,
 		&session.UpdatedAt,
 		&session.Version,
@@ -131,7 +208,7 @@ func (m ParkingSessionModel) Get(id uuid.UUID) (*ParkingSession, error) {
 
 func (m ParkingSessionModel) GetAllForUser(userID uuid.UUID, filters Filters) ([]*ParkingSession, Metadata, error) {
 	query := `
-		SELECT count(*) OVER(), id, reservation_id, user_id, vehicle_id, parking_spot_id, check_in_time, check_out_time, status, total_duration, total_amount, created_at, updated_at, version
+		SELECT count(*) OVER(), id, reservation_id, user_id, vehicle_id, parking_spot_id, check_in_time, check_out_time, status, total_duration, total_amount, expected_end, prepaid_amount, created_at, updated_at, version
 		FROM parking_sessions
 		WHERE user_id = $1
 		ORDER BY %s %s, id ASC
@@ -139,7 +216,7 @@ func (m ParkingSessionModel) GetAllForUser(userID uuid.UUID, filters Filters) ([
 
 	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	args := []any{userID, filters.limit(), filters.offset()}
@@ -168,6 +245,8 @@ func (m ParkingSessionModel) GetAllForUser(userID uuid.UUID, filters Filters) ([
 			&session.Status,
 			&session.TotalDuration,
 			&session.TotalAmount,
+			&session.ExpectedEnd,
+			&session.PrepaidAmount,
 			&session.CreatedAt,
 			&session.UpdatedAt,
 			&session.Version,
@@ -188,15 +267,119 @@ func (m ParkingSessionModel) GetAllForUser(userID uuid.UUID, filters Filters) ([
 	return sessions, metadata, nil
 }
 
+// SessionDetail is a parking session with the spot and lot it was in, for
+// session history listings.
+type SessionDetail struct {
+	ParkingSession
+	SpotNumber   string    `json:"spot_number"`
+	ParkingLotID uuid.UUID `json:"parking_lot_id"`
+	LotName      string    `json:"lot_name"`
+	LotAddress   string    `json:"lot_address"`
+}
+
+const sessionDetailColumns = `
+		count(*) OVER(), ps.id, ps.reservation_id, ps.user_id, ps.vehicle_id, ps.parking_spot_id, ps.check_in_time, ps.check_out_time, ps.status, ps.total_duration, ps.total_amount, ps.expected_end, ps.prepaid_amount, ps.created_at, ps.updated_at, ps.version,
+		spot.spot_number, lot.id, lot.name, lot.address
+		FROM parking_sessions ps
+		INNER JOIN parking_spots spot ON ps.parking_spot_id = spot.id
+		INNER JOIN parking_lots lot ON spot.parking_lot_id = lot.id`
+
+// GetHistoryForUser returns the user's sessions with their spot and lot. The
+// lot is found through the spot rather than the reservation, so walk-in
+// sessions without a reservation are included.
+func (m ParkingSessionModel) GetHistoryForUser(userID uuid.UUID, filters Filters) ([]*SessionDetail, Metadata, error) {
+	query := `
+		SELECT` + sessionDetailColumns + `
+		WHERE ps.user_id = $1
+		ORDER BY ps.%s %s, ps.id ASC
+		LIMIT $2 OFFSET $3`
+
+	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
+
+	return m.getDetails(filters, query, userID, filters.limit(), filters.offset())
+}
+
+// GetDetailsByLot returns the lot's sessions with their spots, violations
+// first. An empty status matches every status, and nil from or to leave that
+// end of the check-in range open; to is exclusive.
+func (m ParkingSessionModel) GetDetailsByLot(lotID uuid.UUID, status string, from, to *time.Time, filters Filters) ([]*SessionDetail, Metadata, error) {
+	query := `
+		SELECT` + sessionDetailColumns + `
+		WHERE spot.parking_lot_id = $1
+		AND ($2 = '' OR ps.status = $2)
+		AND ($3::timestamptz IS NULL OR ps.check_in_time >= $3)
+		AND ($4::timestamptz IS NULL OR ps.check_in_time < $4)
+		ORDER BY ps.status = '` + SessionStatusViolated + `' DESC, ps.%s %s, ps.id ASC
+		LIMIT $5 OFFSET $6`
+
+	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
+
+	return m.getDetails(filters, query, lotID, status, from, to, filters.limit(), filters.offset())
+}
+
+func (m ParkingSessionModel) getDetails(filters Filters, query string, args ...any) ([]*SessionDetail, Metadata, error) {
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	details := []*SessionDetail{}
+
+	for rows.Next() {
+		var detail SessionDetail
+
+		err := rows.Scan(
+			&totalRecords,
+			&detail.ID,
+			&detail.ReservationID,
+			&detail.UserID,
+			&detail.VehicleID,
+			&detail.ParkingSpotID,
+			&detail.CheckInTime,
+			&detail.CheckOutTime,
+			&detail.Status,
+			&detail.TotalDuration,
+			&detail.TotalAmount,
+			&detail.ExpectedEnd,
+			&detail.PrepaidAmount,
+			&detail.CreatedAt,
+			&detail.UpdatedAt,
+			&detail.Version,
+			&detail.SpotNumber,
+			&detail.ParkingLotID,
+			&detail.LotName,
+			&detail.LotAddress,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		details = append(details, &detail)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return details, metadata, nil
+}
+
 func (m ParkingSessionModel) GetActiveBySpot(spotID uuid.UUID) (*ParkingSession, error) {
 	query := `
-		SELECT id, reservation_id, user_id, vehicle_id, parking_spot_id, check_in_time, check_out_time, status, total_duration, total_amount, created_at, updated_at, version
+		SELECT id, reservation_id, user_id, vehicle_id, parking_spot_id, check_in_time, check_out_time, status, total_duration, total_amount, expected_end, prepaid_amount, created_at, updated_at, version
 		FROM parking_sessions
 		WHERE parking_spot_id = $1 AND status = $2`
 
 	var session ParkingSession
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, spotID, SessionStatusActive).Scan(
@@ -210,6 +393,51 @@ func (m ParkingSessionModel) GetActiveBySpot(spotID uuid.UUID) (*ParkingSession,
 		&session.Status,
 		&session.TotalDuration,
 		&session.TotalAmount,
+		&session.ExpectedEnd,
+		&session.PrepaidAmount,
+		&session.CreatedAt,
+		&session.UpdatedAt,
+		&session.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &session, nil
+}
+
+// GetActiveByVehicle returns the vehicle's current session, if any. A vehicle
+// can only be parked in one spot at a time.
+func (m ParkingSessionModel) GetActiveByVehicle(vehicleID uuid.UUID) (*ParkingSession, error) {
+	query := `
+		SELECT id, reservation_id, user_id, vehicle_id, parking_spot_id, check_in_time, check_out_time, status, total_duration, total_amount, expected_end, prepaid_amount, created_at, updated_at, version
+		FROM parking_sessions
+		WHERE vehicle_id = $1 AND status = $2`
+
+	var session ParkingSession
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, vehicleID, SessionStatusActive).Scan(
+		&session.ID,
+		&session.ReservationID,
+		&session.UserID,
+		&session.VehicleID,
+		&session.ParkingSpotID,
+		&session.CheckInTime,
+		&session.CheckOutTime,
+		&session.Status,
+		&session.TotalDuration,
+		&session.TotalAmount,
+		&session.ExpectedEnd,
+		&session.PrepaidAmount,
 		&session.CreatedAt,
 		&session.UpdatedAt,
 		&session.Version,
@@ -229,12 +457,12 @@ func (m ParkingSessionModel) GetActiveBySpot(spotID uuid.UUID) (*ParkingSession,
 
 func (m ParkingSessionModel) GetActiveByUser(userID uuid.UUID) ([]*ParkingSession, error) {
 	query := `
-		SELECT id, reservation_id, user_id, vehicle_id, parking_spot_id, check_in_time, check_out_time, status, total_duration, total_amount, created_at, updated_at, version
+		SELECT id, reservation_id, user_id, vehicle_id, parking_spot_id, check_in_time, check_out_time, status, total_duration, total_amount, expected_end, prepaid_amount, created_at, updated_at, version
 		FROM parking_sessions
 		WHERE user_id = $1 AND status = $2
 		ORDER BY check_in_time DESC`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	rows, err := m.DB.QueryContext(ctx, query, userID, SessionStatusActive)
@@ -259,6 +487,8 @@ func (m ParkingSessionModel) GetActiveByUser(userID uuid.UUID) ([]*ParkingSessio
 			&session.Status,
 			&session.TotalDuration,
 			&session.TotalAmount,
+			&session.ExpectedEnd,
+			&session.PrepaidAmount,
 			&session.CreatedAt,
 			&session.UpdatedAt,
 			&session.Version,
@@ -277,9 +507,206 @@ func (m ParkingSessionModel) GetActiveByUser(userID uuid.UUID) ([]*ParkingSessio
 	return sessions, nil
 }
 
+// ParkedVehicle is an active parking session along with the vehicle and spot
+// an operator needs to find it on the ground.
+type ParkedVehicle struct {
+	ParkingSession
+	LicensePlate   string `json:"license_plate"`
+	VehicleMake    string `json:"vehicle_make"`
+	VehicleColor   string `json:"vehicle_color"`
+	SpotNumber     string `json:"spot_number"`
+	ElapsedMinutes int    `json:"elapsed_minutes"`
+}
+
+// GetActiveByLot returns the vehicles currently parked in the lot, oldest
+// check-in first, with how long each has been parked as of now.
+func (m ParkingSessionModel) GetActiveByLot(lotID uuid.UUID, now time.Time) ([]*ParkedVehicle, error) {
+	query := `
+		SELECT ps.id, ps.reservation_id, ps.user_id, ps.vehicle_id, ps.parking_spot_id, ps.check_in_time, ps.check_out_time, ps.status, ps.total_duration, ps.total_amount, ps.expected_end, ps.prepaid_amount, ps.created_at, ps.updated_at, ps.version,
+		       v.license_plate, v.make, v.color, s.spot_number
+		FROM parking_sessions ps
+		INNER JOIN parking_spots s ON s.id = ps.parking_spot_id
+		INNER JOIN vehicles v ON v.id = ps.vehicle_id
+		WHERE s.parking_lot_id = $1 AND ps.status = $2
+		ORDER BY ps.check_in_time ASC, ps.id ASC`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, lotID, SessionStatusActive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parked := []*ParkedVehicle{}
+
+	for rows.Next() {
+		var vehicle ParkedVehicle
+
+		err := rows.Scan(
+			&vehicle.ID,
+			&vehicle.ReservationID,
+			&vehicle.UserID,
+			&vehicle.VehicleID,
+			&vehicle.ParkingSpotID,
+			&vehicle.CheckInTime,
+			&vehicle.CheckOutTime,
+			&vehicle.Status,
+			&vehicle.TotalDuration,
+			&vehicle.TotalAmount,
+			&vehicle.ExpectedEnd,
+			&vehicle.PrepaidAmount,
+			&vehicle.CreatedAt,
+			&vehicle.UpdatedAt,
+			&vehicle.Version,
+			&vehicle.LicensePlate,
+			&vehicle.VehicleMake,
+			&vehicle.VehicleColor,
+			&vehicle.SpotNumber,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		vehicle.ElapsedMinutes = max(int(now.Sub(vehicle.CheckInTime).Minutes()), 0)
+
+		parked = append(parked, &vehicle)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return parked, nil
+}
+
+// CheckOutAllInLot ends every active session in the lot at checkOutTime in one
+// transaction, for when the lot closes. Each session is charged its closing
+// fee, its spot is freed and the reservation it belongs to is completed. The
+// checked out sessions are returned.
+func (m ParkingSessionModel) CheckOutAllInLot(lot *ParkingLot, checkOutTime time.Time) ([]*ParkingSession, error) {
+	query := `
+		SELECT ps.id, ps.reservation_id, ps.user_id, ps.vehicle_id, ps.parking_spot_id, ps.check_in_time, ps.status, ps.expected_end, ps.prepaid_amount, ps.created_at, ps.version,
+		       r.total_amount
+		FROM parking_sessions ps
+		INNER JOIN parking_spots s ON s.id = ps.parking_spot_id
+		LEFT JOIN reservations r ON r.id = ps.reservation_id
+		WHERE s.parking_lot_id = $1 AND ps.status = $2
+		ORDER BY ps.check_in_time ASC
+		FOR UPDATE OF ps`
+
+	ctx, cancel := m.longQueryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, lot.ID, SessionStatusActive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*ParkingSession{}
+	var spotIDs, reservationIDs []uuid.UUID
+
+	for rows.Next() {
+		var session ParkingSession
+		var bookedAmount *float64
+
+		err := rows.Scan(
+			&session.ID,
+			&session.ReservationID,
+			&session.UserID,
+			&session.VehicleID,
+			&session.ParkingSpotID,
+			&session.CheckInTime,
+			&session.Status,
+			&session.ExpectedEnd,
+			&session.PrepaidAmount,
+			&session.CreatedAt,
+			&session.Version,
+			&bookedAmount,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		duration := int(checkOutTime.Sub(session.CheckInTime).Minutes())
+		amount := lot.ClosingFee(&session, bookedAmount, checkOutTime)
+
+		session.Status = SessionStatusCompleted
+		session.CheckOutTime = &checkOutTime
+		session.TotalDuration = &duration
+		session.TotalAmount = &amount
+
+		sessions = append(sessions, &session)
+		spotIDs = append(spotIDs, session.ParkingSpotID)
+		if session.ReservationID != nil {
+			reservationIDs = append(reservationIDs, *session.ReservationID)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(sessions) == 0 {
+		return sessions, nil
+	}
+
+	query = `
+		UPDATE parking_sessions
+		SET check_out_time = $1, status = $2, total_duration = $3, total_amount = $4, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $5
+		RETURNING updated_at, version`
+
+	for _, session := range sessions {
+		err = tx.QueryRowContext(ctx, query, checkOutTime, session.Status, session.TotalDuration, session.TotalAmount, session.ID).Scan(&session.UpdatedAt, &session.Version)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	query = `
+		UPDATE parking_spots
+		SET is_occupied = false, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = ANY($1) AND is_occupied = true`
+
+	_, err = tx.ExecContext(ctx, query, pq.Array(spotIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reservationIDs) > 0 {
+		query = `
+			UPDATE reservations
+			SET status = $1, actual_end_time = $2, updated_at = CURRENT_TIMESTAMP, version = version + 1
+			WHERE id = ANY($3) AND status = ANY($4)`
+
+		args := []any{ReservationStatusCompleted, checkOutTime, pq.Array(reservationIDs), pq.Array(transitionSources(reservationTransitions, ReservationStatusCompleted))}
+
+		_, err = tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
 func (m ParkingSessionModel) GetByLot(lotID uuid.UUID, filters Filters) ([]*ParkingSession, Metadata, error) {
 	query := `
-		SELECT count(*) OVER(), ps.id, ps.reservation_id, ps.user_id, ps.vehicle_id, ps.parking_spot_id, ps.check_in_time, ps.check_out_time, ps.status, ps.total_duration, ps.total_amount, ps.created_at, ps.updated_at, ps.version
+		SELECT count(*) OVER(), ps.id, ps.reservation_id, ps.user_id, ps.vehicle_id, ps.parking_spot_id, ps.check_in_time, ps.check_out_time, ps.status, ps.total_duration, ps.total_amount, ps.expected_end, ps.prepaid_amount, ps.created_at, ps.updated_at, ps.version
 		FROM parking_sessions ps
 		INNER JOIN parking_spots spot ON ps.parking_spot_id = spot.id
 		WHERE spot.parking_lot_id = $1
@@ -288,7 +715,7 @@ func (m ParkingSessionModel) GetByLot(lotID uuid.UUID, filters Filters) ([]*Park
 
 	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	args := []any{lotID, filters.limit(), filters.offset()}
@@ -317,6 +744,8 @@ func (m ParkingSessionModel) GetByLot(lotID uuid.UUID, filters Filters) ([]*Park
 			&session.Status,
 			&session.TotalDuration,
 			&session.TotalAmount,
+			&session.ExpectedEnd,
+			&session.PrepaidAmount,
 			&session.CreatedAt,
 			&session.UpdatedAt,
 			&session.Version,
@@ -341,7 +770,7 @@ func (m ParkingSessionModel) Update(session *ParkingSession) error {
 	query := `
 		UPDATE parking_sessions
 		SET check_out_time = $1, status = $2, total_duration = $3, total_amount = $4, updated_at = CURRENT_TIMESTAMP, version = version + 1
-		WHERE id = $5 AND version = $6
+		WHERE id = $5 AND version = $6 AND (status = $2 OR status = ANY($7))
 		RETURNING updated_at, version`
 
 	args := []any{
@@ -351,15 +780,23 @@ func (m ParkingSessionModel) Update(session *ParkingSession) error {
 		session.TotalAmount,
 		session.ID,
 		session.Version,
+		pq.Array(transitionSources(sessionTransitions, session.Status)),
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&session.UpdatedAt, &session.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
+			// Either the version moved on or the status change isn't allowed
+			var from string
+			var version int
+			err = m.DB.QueryRowContext(ctx, `SELECT status, version FROM parking_sessions WHERE id = $1`, session.ID).Scan(&from, &version)
+			if err == nil && version == session.Version && from != session.Status {
+				return &TransitionError{From: from, To: session.Status}
+			}
 			return ErrEditConflict
 		default:
 			return err
@@ -372,12 +809,17 @@ func (m ParkingSessionModel) Update(session *ParkingSession) error {
 func (m ParkingSessionModel) CheckOut(id uuid.UUID, checkOutTime time.Time, totalAmount float64) error {
 	// Calculate duration in minutes
 	var durationMinutes int
-	durationQuery := `SELECT EXTRACT(EPOCH FROM ($1 - check_in_time))/60 FROM parking_sessions WHERE id = $2`
+	durationQuery := `SELECT (EXTRACT(EPOCH FROM ($1 - check_in_time))/60)::int FROM parking_sessions WHERE id = $2`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, durationQuery, checkOutTime, id).Scan(&durationMinutes)
+	err := checkTransition(ctx, m.DB, "parking_sessions", sessionTransitions, id, SessionStatusCompleted)
+	if err != nil {
+		return err
+	}
+
+	err = m.DB.QueryRowContext(ctx, durationQuery, checkOutTime, id).Scan(&durationMinutes)
 	if err != nil {
 		return err
 	}
@@ -385,9 +827,9 @@ func (m ParkingSessionModel) CheckOut(id uuid.UUID, checkOutTime time.Time, tota
 	query := `
 		UPDATE parking_sessions
 		SET check_out_time = $1, status = $2, total_duration = $3, total_amount = $4, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $5 AND status = $6`
+		WHERE id = $5 AND status = ANY($6)`
 
-	result, err := m.DB.ExecContext(ctx, query, checkOutTime, SessionStatusCompleted, durationMinutes, totalAmount, id, SessionStatusActive)
+	result, err := m.DB.ExecContext(ctx, query, checkOutTime, SessionStatusCompleted, durationMinutes, totalAmount, id, pq.Array(transitionSources(sessionTransitions, SessionStatusCompleted)))
 	if err != nil {
 		return err
 	}
@@ -397,23 +839,103 @@ func (m ParkingSessionModel) CheckOut(id uuid.UUID, checkOutTime time.Time, tota
 		return err
 	}
 
+	// The status changed between the check and the update
 	if rowsAffected == 0 {
-		return ErrRecordNotFound
+		return ErrEditConflict
 	}
 
 	return nil
 }
 
-func (m ParkingSessionModel) MarkAsViolation(id uuid.UUID) error {
+// MarkAsViolation flags an active session as a violation. With a fee greater
+// than zero a pending payment for it is created in the same transaction and
+// returned. Marking a session that is already a violation changes nothing and
+// never charges the fee twice; it returns a nil payment.
+func (m ParkingSessionModel) MarkAsViolation(id uuid.UUID, fee float64) (*Payment, error) {
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
 	query := `
 		UPDATE parking_sessions
 		SET status = $1, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $2`
+		WHERE id = $2 AND status = ANY($3)
+		RETURNING user_id, reservation_id`
+
+	payment := &Payment{
+		Amount:        MoneyFromFloat(fee),
+		Currency:      "USD",
+		PaymentMethod: PaymentMethodCard,
+		Status:        PaymentStatusPending,
+	}
+
+	err = tx.QueryRowContext(ctx, query, SessionStatusViolated, id, pq.Array(transitionSources(sessionTransitions, SessionStatusViolated))).Scan(&payment.UserID, &payment.ReservationID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		// Either a repeat, which is fine, or a move that isn't allowed
+		err = checkTransition(ctx, m.DB, "parking_sessions", sessionTransitions, id, SessionStatusViolated)
+		var transitionErr *TransitionError
+		if errors.As(err, &transitionErr) && transitionErr.From == SessionStatusViolated {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// The status changed between the update and the check
+		return nil, ErrEditConflict
+	}
+
+	if fee <= 0 {
+		return nil, tx.Commit()
+	}
+
+	// The fee payment is unique per session, so it can't be charged twice
+	query = `
+		INSERT INTO payments (reservation_id, user_id, amount, currency, payment_method, status, violation_session_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (violation_session_id) WHERE violation_session_id IS NOT NULL DO NOTHING
+		RETURNING id, payment_date, created_at, updated_at, version`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	args := []any{payment.ReservationID, payment.UserID, payment.Amount, payment.Currency, payment.PaymentMethod, payment.Status, id}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&payment.ID, &payment.PaymentDate, &payment.CreatedAt, &payment.UpdatedAt, &payment.Version)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		payment = nil
+	case err != nil:
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+// AddPrepaidMinutes extends an active walk-in session's prepaid time. The first
+// top-up counts from check-in; later ones extend the current expected end.
+func (m ParkingSessionModel) AddPrepaidMinutes(id uuid.UUID, minutes int, additionalAmount float64) error {
+	query := `
+		UPDATE parking_sessions
+		SET expected_end = COALESCE(expected_end, check_in_time) + make_interval(mins => $1),
+			prepaid_amount = prepaid_amount + $2, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $3 AND status = $4 AND reservation_id IS NULL`
+
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, SessionStatusViolated, id)
+	result, err := m.DB.ExecContext(ctx, query, minutes, additionalAmount, id, SessionStatusActive)
 	if err != nil {
 		return err
 	}
@@ -433,7 +955,7 @@ func (m ParkingSessionModel) MarkAsViolation(id uuid.UUID) error {
 func (m ParkingSessionModel) Delete(id uuid.UUID) error {
 	query := `DELETE FROM parking_sessions WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	result, err := m.DB.ExecContext(ctx, query, id)
@@ -455,16 +977,17 @@ func (m ParkingSessionModel) Delete(id uuid.UUID) error {
 
 func (m ParkingSessionModel) GetOvertimeSessions() ([]*ParkingSession, error) {
 	query := `
-		SELECT ps.id, ps.reservation_id, ps.user_id, ps.vehicle_id, ps.parking_spot_id, ps.check_in_time, ps.check_out_time, ps.status, ps.total_duration, ps.total_amount, ps.created_at, ps.updated_at, ps.version
+		SELECT ps.id, ps.reservation_id, ps.user_id, ps.vehicle_id, ps.parking_spot_id, ps.check_in_time, ps.check_out_time, ps.status, ps.total_duration, ps.total_amount, ps.expected_end, ps.prepaid_amount, ps.created_at, ps.updated_at, ps.version
 		FROM parking_sessions ps
 		LEFT JOIN reservations r ON ps.reservation_id = r.id
 		WHERE ps.status = $1 
 		AND (
 			(r.id IS NOT NULL AND NOW() > r.end_time) OR
-			(r.id IS NULL AND ps.check_in_time < NOW() - INTERVAL '24 hours')
+			(r.id IS NULL AND ps.expected_end IS NOT NULL AND NOW() > ps.expected_end) OR
+			(r.id IS NULL AND ps.expected_end IS NULL AND ps.check_in_time < NOW() - INTERVAL '24 hours')
 		)`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	rows, err := m.DB.QueryContext(ctx, query, SessionStatusActive)
@@ -489,6 +1012,8 @@ func (m ParkingSessionModel) GetOvertimeSessions() ([]*ParkingSession, error) {
 			&session.Status,
 			&session.TotalDuration,
 			&session.TotalAmount,
+			&session.ExpectedEnd,
+			&session.PrepaidAmount,
 			&session.CreatedAt,
 			&session.UpdatedAt,
 			&session.Version,
@@ -506,3 +1031,138 @@ func (m ParkingSessionModel) GetOvertimeSessions() ([]*ParkingSession, error) {
 
 	return sessions, nil
 }
+
+// GetDailyCheckInCounts counts the lot's check-ins per day from start's date to
+// end's date, inclusive. Days are calendar days in the lot's time zone and are
+// keyed YYYY-MM-DD; days without check-ins are present with a zero count.
+func (m ParkingSessionModel) GetDailyCheckInCounts(lotID uuid.UUID, start, end time.Time) (map[string]int, error) {
+	ctx, cancel := m.longQueryContext()
+	defer cancel()
+
+	var timezone string
+
+	err := m.DB.QueryRowContext(ctx, `SELECT timezone FROM parking_lots WHERE id = $1`, lotID).Scan(&timezone)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	lot := &ParkingLot{Timezone: timezone}
+	loc := lot.Location()
+
+	from := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+	until := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+
+	counts := map[string]int{}
+	for day := from; day.Before(until); day = day.AddDate(0, 0, 1) {
+		counts[day.Format("2006-01-02")] = 0
+	}
+
+	query := `
+		SELECT to_char(date_trunc('day', s.check_in_time AT TIME ZONE $2), 'YYYY-MM-DD'), COUNT(*)
+		FROM parking_sessions s
+		INNER JOIN parking_spots ps ON ps.id = s.parking_spot_id
+		WHERE ps.parking_lot_id = $1 AND s.check_in_time >= $3 AND s.check_in_time < $4
+		GROUP BY 1`
+
+	rows, err := m.DB.QueryContext(ctx, query, lotID, loc.String(), from, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day string
+		var count int
+
+		err := rows.Scan(&day, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		counts[day] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// MaxDurationBuckets caps how many buckets a duration histogram has. Stays
+// longer than that many buckets all land in the last, open-ended one.
+const MaxDurationBuckets = 48
+
+func ValidateDurationBucket(v *validator.Validator, bucketMinutes int) {
+	v.Check(bucketMinutes > 0, "bucket_minutes", "must be greater than zero")
+	v.Check(bucketMinutes <= 1440, "bucket_minutes", "must not exceed 1440")
+}
+
+// durationBucketKey names the bucket starting at index*bucketMinutes, e.g.
+// "30-60". The last bucket is open-ended, e.g. "1410+".
+func durationBucketKey(index, bucketMinutes int) string {
+	if index == MaxDurationBuckets-1 {
+		return fmt.Sprintf("%d+", index*bucketMinutes)
+	}
+	return fmt.Sprintf("%d-%d", index*bucketMinutes, (index+1)*bucketMinutes)
+}
+
+// GetDurationHistogram counts the lot's completed sessions that checked out
+// between start and end by how long they lasted, in buckets bucketMinutes wide.
+// A session of exactly 30 minutes falls in "30-60". Every bucket up to the
+// longest stay is present, with a zero count if empty.
+func (m ParkingSessionModel) GetDurationHistogram(lotID uuid.UUID, start, end time.Time, bucketMinutes int) (map[string]int, error) {
+	if bucketMinutes <= 0 {
+		return nil, fmt.Errorf("bucket size must be positive, got %d", bucketMinutes)
+	}
+
+	query := `
+		SELECT LEAST(s.total_duration / $5, $6), COUNT(*)
+		FROM parking_sessions s
+		INNER JOIN parking_spots ps ON ps.id = s.parking_spot_id
+		WHERE ps.parking_lot_id = $1 AND s.status = $2 AND s.total_duration IS NOT NULL
+		AND s.check_out_time >= $3 AND s.check_out_time < $4
+		GROUP BY 1`
+
+	args := []any{lotID, SessionStatusCompleted, start, end, bucketMinutes, MaxDurationBuckets - 1}
+
+	ctx, cancel := m.longQueryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[int]int{}
+	last := -1
+
+	for rows.Next() {
+		var index, count int
+
+		err := rows.Scan(&index, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		counts[index] = count
+		last = max(last, index)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	histogram := map[string]int{}
+	for index := 0; index <= last; index++ {
+		histogram[durationBucketKey(index, bucketMinutes)] = counts[index]
+	}
+
+	return histogram, nil
+}
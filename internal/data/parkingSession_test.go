@@ -0,0 +1,495 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// insertTestSession starts a walk-in session for a new vehicle of the user's
+// that checked in at checkIn.
+func insertTestSession(t *testing.T, m Models, userID uuid.UUID, spot *ParkingSpot, checkIn time.Time) *ParkingSession {
+	t.Helper()
+
+	session := &ParkingSession{
+		UserID:        userID,
+		VehicleID:     insertTestVehicle(t, m, userID).ID,
+		ParkingSpotID: spot.ID,
+		CheckInTime:   checkIn,
+		Status:        SessionStatusActive,
+	}
+	if err := m.ParkingSessions.Insert(session); err != nil {
+		t.Fatal(err)
+	}
+
+	return session
+}
+
+func TestTopUpDefersOvertime(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+	_, spots := insertTestLot(t, m, user.ID, 3)
+
+	now := time.Now()
+	toppedUp := insertTestSession(t, m, user.ID, spots[0], now.Add(-25*time.Hour))
+	notToppedUp := insertTestSession(t, m, user.ID, spots[1], now.Add(-25*time.Hour))
+	expired := insertTestSession(t, m, user.ID, spots[2], now.Add(-3*time.Hour))
+
+	if err := m.ParkingSessions.AddPrepaidMinutes(toppedUp.ID, 24*60, 480); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ParkingSessions.AddPrepaidMinutes(toppedUp.ID, 2*60, 40); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ParkingSessions.AddPrepaidMinutes(expired.ID, 60, 20); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := m.ParkingSessions.Get(toppedUp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantEnd := toppedUp.CheckInTime.Add(26 * time.Hour)
+	if session.ExpectedEnd == nil || session.ExpectedEnd.Sub(wantEnd).Abs() > time.Second {
+		t.Errorf("got expected end %v; want %s", session.ExpectedEnd, wantEnd)
+	}
+	if session.PrepaidAmount != 520 {
+		t.Errorf("got prepaid %v; want 520", session.PrepaidAmount)
+	}
+
+	overtime, err := m.ParkingSessions.GetOvertimeSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	flagged := map[uuid.UUID]bool{}
+	for _, s := range overtime {
+		flagged[s.ID] = true
+	}
+
+	if flagged[toppedUp.ID] {
+		t.Error("topped up session is flagged as overtime")
+	}
+	if !flagged[notToppedUp.ID] {
+		t.Error("session past 24 hours without a top-up is not flagged")
+	}
+	if !flagged[expired.ID] {
+		t.Error("session past its prepaid time is not flagged")
+	}
+}
+
+func TestCheckInReservationRollsBack(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+	lot, spots := insertTestLot(t, m, user.ID, 1)
+	vehicle := insertTestVehicle(t, m, user.ID)
+
+	checkIn := func(reservation *Reservation) error {
+		return m.ParkingSessions.CheckInReservation(&ParkingSession{
+			ReservationID: &reservation.ID,
+			UserID:        reservation.UserID,
+			VehicleID:     reservation.VehicleID,
+			ParkingSpotID: spots[0].ID,
+			CheckInTime:   time.Now(),
+		})
+	}
+
+	cancelled := insertTestReservation(t, m, vehicle, lot.ID, spots[0], time.Now(), time.Hour)
+	if err := m.Reservations.Cancel(cancelled.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The transition fails last, after the spot and session writes
+	if err := checkIn(cancelled); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("checking in a cancelled reservation: got %v; want ErrInvalidTransition", err)
+	}
+
+	if _, err := m.ParkingSessions.GetActiveByVehicle(vehicle.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("active session after a failed check-in: got %v; want ErrRecordNotFound", err)
+	}
+	spot, err := m.ParkingSpots.Get(spots[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spot.IsOccupied {
+		t.Error("spot left occupied after a failed check-in")
+	}
+
+	// Nothing was left behind, so the vehicle can check in for another booking
+	reservation := insertTestReservation(t, m, vehicle, lot.ID, spots[0], time.Now().Add(2*time.Hour), time.Hour)
+	if err := checkIn(reservation); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkIn(reservation); !errors.Is(err, ErrVehicleAlreadyParked) {
+		t.Errorf("second check-in: got %v; want ErrVehicleAlreadyParked", err)
+	}
+
+	stored, err := m.Reservations.Get(reservation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != ReservationStatusActive || stored.ActualStartTime == nil {
+		t.Errorf("got status %q, actual start %v; want active with a start time", stored.Status, stored.ActualStartTime)
+	}
+}
+
+func TestTopUpOnlyForActiveWalkIns(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+	_, spots := insertTestLot(t, m, user.ID, 1)
+
+	session := insertTestSession(t, m, user.ID, spots[0], time.Now().Add(-time.Hour))
+	if err := m.ParkingSessions.CheckOut(session.ID, time.Now(), 20); err != nil {
+		t.Fatal(err)
+	}
+
+	err := m.ParkingSessions.AddPrepaidMinutes(session.ID, 60, 20)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("topping up a completed session: got %v; want ErrRecordNotFound", err)
+	}
+}
+
+func TestGetDailyCheckInCounts(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+	lot, spots := insertTestLot(t, m, user.ID, 1)
+	_, otherSpots := insertTestLot(t, m, user.ID, 1)
+
+	_, err := m.ParkingLots.DB.Exec(`UPDATE parking_lots SET timezone = 'Asia/Colombo' WHERE id = $1`, lot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	colombo, err := time.LoadLocation("Asia/Colombo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().In(colombo)
+	day1 := time.Date(now.Year(), now.Month(), now.Day()-10, 0, 0, 0, 0, colombo)
+	day3 := day1.AddDate(0, 0, 2)
+
+	at := func(day time.Time, hour, minute int) time.Time {
+		return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+
+	insertTestSession(t, m, user.ID, spots[0], at(day1, 9, 0))
+	insertTestSession(t, m, user.ID, spots[0], at(day1, 17, 45))
+	// 23:30 in Colombo is still 18:00 UTC on the same day...
+	insertTestSession(t, m, user.ID, spots[0], at(day3, 23, 30))
+	// ...while 00:30 the next day is 19:00 UTC on day 3, but falls outside
+	// the range in the lot's time zone.
+	insertTestSession(t, m, user.ID, spots[0], at(day3.AddDate(0, 0, 1), 0, 30))
+	insertTestSession(t, m, user.ID, otherSpots[0], at(day1, 12, 0))
+
+	counts, err := m.ParkingSessions.GetDailyCheckInCounts(lot.ID, day1, day3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int{
+		day1.Format("2006-01-02"):                  2,
+		day1.AddDate(0, 0, 1).Format("2006-01-02"): 0,
+		day3.Format("2006-01-02"):                  1,
+	}
+	if len(counts) != len(want) {
+		t.Errorf("got %d days %v; want %d", len(counts), counts, len(want))
+	}
+	for day, count := range want {
+		if got, ok := counts[day]; !ok || got != count {
+			t.Errorf("%s: got %d (present %t); want %d", day, got, ok, count)
+		}
+	}
+
+	if _, err := m.ParkingSessions.GetDailyCheckInCounts(uuid.New(), day1, day3); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("unknown lot: got %v; want ErrRecordNotFound", err)
+	}
+}
+
+func TestGetHistoryForUser(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+	other := insertTestUser(t, m)
+	lot, spots := insertTestLot(t, m, user.ID, 2)
+
+	now := time.Now()
+	walkIn := insertTestSession(t, m, user.ID, spots[0], now.Add(-2*time.Hour))
+	insertTestSession(t, m, other.ID, spots[0], now.Add(-time.Hour))
+
+	vehicle := insertTestVehicle(t, m, user.ID)
+	reservation := insertTestReservation(t, m, vehicle, lot.ID, spots[1], now.Add(-30*time.Minute), time.Hour)
+	booked := &ParkingSession{
+		ReservationID: &reservation.ID,
+		UserID:        user.ID,
+		VehicleID:     vehicle.ID,
+		ParkingSpotID: spots[1].ID,
+		CheckInTime:   now.Add(-30 * time.Minute),
+		Status:        SessionStatusActive,
+	}
+	if err := m.ParkingSessions.Insert(booked); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, metadata, err := m.ParkingSessions.GetHistoryForUser(user.ID, Filters{
+		Page:         1,
+		PageSize:     20,
+		Sort:         "check_in_time",
+		SortSafelist: []string{"check_in_time"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || metadata.TotalRecords != 2 {
+		t.Fatalf("got %d sessions (%d total); want the user's 2", len(sessions), metadata.TotalRecords)
+	}
+
+	first, second := sessions[0], sessions[1]
+	if first.ID != walkIn.ID || second.ID != booked.ID {
+		t.Fatalf("got sessions %s, %s; want the walk-in first", first.ID, second.ID)
+	}
+
+	if first.ReservationID != nil {
+		t.Errorf("walk-in: got reservation %s; want none", *first.ReservationID)
+	}
+	if second.ReservationID == nil || *second.ReservationID != reservation.ID {
+		t.Errorf("booked: got reservation %v; want %s", second.ReservationID, reservation.ID)
+	}
+
+	for _, session := range sessions {
+		if session.ParkingLotID != lot.ID || session.LotName != lot.Name || session.LotAddress != lot.Address {
+			t.Errorf("session %s: got lot %s %q at %q; want %s %q at %q", session.ID, session.ParkingLotID, session.LotName, session.LotAddress, lot.ID, lot.Name, lot.Address)
+		}
+	}
+	if first.SpotNumber != "1" || second.SpotNumber != "2" {
+		t.Errorf("got spot numbers %q and %q; want 1 and 2", first.SpotNumber, second.SpotNumber)
+	}
+}
+
+func TestCheckOutAllInLot(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	driver := insertTestUser(t, m)
+	lot, spots := insertTestLot(t, m, owner.ID, 3)
+	_, otherSpots := insertTestLot(t, m, owner.ID, 1)
+
+	now := time.Now().Truncate(time.Second)
+	long := insertTestSession(t, m, driver.ID, spots[0], now.Add(-150*time.Minute))
+	short := insertTestSession(t, m, driver.ID, spots[1], now.Add(-20*time.Minute))
+	elsewhere := insertTestSession(t, m, driver.ID, otherSpots[0], now.Add(-time.Hour))
+
+	// A booked session owes what was booked, however long it has been parked
+	vehicle := insertTestVehicle(t, m, driver.ID)
+	reservation := insertTestReservation(t, m, vehicle, lot.ID, spots[2], now.Add(-time.Hour), 3*time.Hour)
+	if err := m.Reservations.UpdateStatus(reservation.ID, ReservationStatusActive); err != nil {
+		t.Fatal(err)
+	}
+	booked := &ParkingSession{
+		ReservationID: &reservation.ID,
+		UserID:        driver.ID,
+		VehicleID:     vehicle.ID,
+		ParkingSpotID: spots[2].ID,
+		CheckInTime:   now.Add(-time.Hour),
+		Status:        SessionStatusActive,
+	}
+	if err := m.ParkingSessions.Insert(booked); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, spot := range append(spots, otherSpots...) {
+		if err := m.ParkingSpots.SetOccupied(spot.ID, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	closed, err := m.ParkingSessions.CheckOutAllInLot(lot, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) != 3 {
+		t.Fatalf("closed %d sessions, want 3", len(closed))
+	}
+
+	wantAmounts := map[uuid.UUID]float64{
+		long.ID:   lot.PriceFor(long.CheckInTime, now).Float64(),
+		short.ID:  lot.PriceFor(short.CheckInTime, now).Float64(),
+		booked.ID: reservation.TotalAmount.Float64(),
+	}
+	for _, session := range closed {
+		stored, err := m.ParkingSessions.Get(session.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Status != SessionStatusCompleted || stored.CheckOutTime == nil || !stored.CheckOutTime.Equal(now) {
+			t.Errorf("session %s: status %s, checked out %v; want completed at %s", session.ID, stored.Status, stored.CheckOutTime, now)
+		}
+		if stored.TotalAmount == nil || *stored.TotalAmount != wantAmounts[session.ID] {
+			t.Errorf("session %s: amount %v, want %v", session.ID, stored.TotalAmount, wantAmounts[session.ID])
+		}
+	}
+
+	for _, spot := range spots {
+		stored, err := m.ParkingSpots.Get(spot.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.IsOccupied {
+			t.Errorf("spot %s is still occupied", spot.SpotNumber)
+		}
+	}
+
+	storedReservation, err := m.Reservations.Get(reservation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if storedReservation.Status != ReservationStatusCompleted {
+		t.Errorf("reservation status = %s, want %s", storedReservation.Status, ReservationStatusCompleted)
+	}
+
+	parked, err := m.ParkingSessions.GetActiveByLot(lot.ID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parked) != 0 {
+		t.Errorf("%d sessions still active in the closed lot", len(parked))
+	}
+
+	// Other lots are untouched
+	stored, err := m.ParkingSessions.Get(elsewhere.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != SessionStatusActive {
+		t.Errorf("session in another lot = %s, want active", stored.Status)
+	}
+
+	// Closing again finds nothing left to do
+	closed, err = m.ParkingSessions.CheckOutAllInLot(lot, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) != 0 {
+		t.Errorf("second close checked out %d sessions", len(closed))
+	}
+}
+
+func TestGetActiveByLotJoinsVehicleAndSpot(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+	lot, spots := insertTestLot(t, m, user.ID, 3)
+	_, otherSpots := insertTestLot(t, m, user.ID, 1)
+
+	now := time.Now()
+	parked := insertTestSession(t, m, user.ID, spots[1], now.Add(-90*time.Minute))
+	later := insertTestSession(t, m, user.ID, spots[2], now.Add(-10*time.Minute))
+	left := insertTestSession(t, m, user.ID, spots[0], now.Add(-3*time.Hour))
+	insertTestSession(t, m, user.ID, otherSpots[0], now.Add(-time.Hour))
+
+	_, err := m.ParkingSessions.DB.Exec(`UPDATE parking_sessions SET status = $1, check_out_time = NOW() WHERE id = $2`, SessionStatusCompleted, left.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vehicles, err := m.ParkingSessions.GetActiveByLot(lot.ID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vehicles) != 2 {
+		t.Fatalf("got %d parked vehicles; want 2", len(vehicles))
+	}
+	if vehicles[0].ID != parked.ID || vehicles[1].ID != later.ID {
+		t.Errorf("got sessions %s, %s; want %s, %s", vehicles[0].ID, vehicles[1].ID, parked.ID, later.ID)
+	}
+
+	vehicle, err := m.Vehicles.Get(parked.VehicleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := vehicles[0]
+	if got.LicensePlate != vehicle.LicensePlate || got.VehicleMake != vehicle.Make || got.VehicleColor != vehicle.Color {
+		t.Errorf("got vehicle %q %q %q; want %q %q %q", got.LicensePlate, got.VehicleMake, got.VehicleColor, vehicle.LicensePlate, vehicle.Make, vehicle.Color)
+	}
+	if got.SpotNumber != spots[1].SpotNumber {
+		t.Errorf("spot number = %q; want %q", got.SpotNumber, spots[1].SpotNumber)
+	}
+	if got.ElapsedMinutes != 90 || vehicles[1].ElapsedMinutes != 10 {
+		t.Errorf("elapsed minutes = %d, %d; want 90, 10", got.ElapsedMinutes, vehicles[1].ElapsedMinutes)
+	}
+
+	// A check-in recorded slightly ahead of the clock isn't negative
+	vehicles, err = m.ParkingSessions.GetActiveByLot(lot.ID, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vehicles[1].ElapsedMinutes != 0 {
+		t.Errorf("elapsed minutes before check-in = %d; want 0", vehicles[1].ElapsedMinutes)
+	}
+}
+
+func TestGetDurationHistogram(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+	lot, spots := insertTestLot(t, m, user.ID, 1)
+
+	now := time.Now()
+	start, end := now.Add(-24*time.Hour), now
+
+	complete := func(minutes int, checkOut time.Time, status string) {
+		t.Helper()
+
+		session := insertTestSession(t, m, user.ID, spots[0], checkOut.Add(-time.Duration(minutes)*time.Minute))
+		_, err := m.ParkingSessions.DB.Exec(`
+			UPDATE parking_sessions SET status = $1, check_out_time = $2, total_duration = $3
+			WHERE id = $4`, status, checkOut, minutes, session.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	complete(10, now.Add(-time.Hour), SessionStatusCompleted)
+	complete(29, now.Add(-time.Hour), SessionStatusCompleted)
+	complete(30, now.Add(-time.Hour), SessionStatusCompleted)
+	complete(95, now.Add(-time.Hour), SessionStatusCompleted)
+	// Ignored: checked out before the range, or not completed
+	complete(45, now.Add(-48*time.Hour), SessionStatusCompleted)
+	complete(45, now.Add(-time.Hour), SessionStatusViolated)
+	insertTestSession(t, m, user.ID, spots[0], now.Add(-time.Hour))
+
+	histogram, err := m.ParkingSessions.GetDurationHistogram(lot.ID, start, end, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int{"0-30": 2, "30-60": 1, "60-90": 0, "90-120": 1}
+	if len(histogram) != len(want) {
+		t.Errorf("got buckets %v; want %v", histogram, want)
+	}
+	for bucket, count := range want {
+		if got, ok := histogram[bucket]; !ok || got != count {
+			t.Errorf("%s: got %d (present %t); want %d", bucket, got, ok, count)
+		}
+	}
+
+	// Stays past the last bucket are counted in the open-ended one
+	histogram, err = m.ParkingSessions.GetDurationHistogram(lot.ID, start, end, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := durationBucketKey(MaxDurationBuckets-1, 2)
+	if last != "94+" || histogram[last] != 1 || len(histogram) != MaxDurationBuckets {
+		t.Errorf("open-ended bucket %s = %d in %d buckets; want 94+ = 1 in %d", last, histogram[last], len(histogram), MaxDurationBuckets)
+	}
+
+	if _, err := m.ParkingSessions.GetDurationHistogram(lot.ID, start, end, 0); err == nil {
+		t.Error("zero bucket size: got no error")
+	}
+}
+
+func TestValidateDurationBucket(t *testing.T) {
+	for minutes, valid := range map[int]bool{-1: false, 0: false, 1: true, 30: true, 1440: true, 1441: false} {
+		v := validator.New()
+		if ValidateDurationBucket(v, minutes); v.Valid() != valid {
+			t.Errorf("%d minutes: valid = %t; want %t", minutes, v.Valid(), valid)
+		}
+	}
+}
@@ -8,39 +8,71 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
 )
 
+var (
+	ErrDuplicateSpotNumber = errors.New("duplicate spot number")
+)
+
+const (
+	SpotStatusActive         = "active"
+	SpotStatusMaintenance    = "maintenance"
+	SpotStatusDecommissioned = "decommissioned"
+)
+
+const (
+	SpotTypeRegular     = "regular"
+	SpotTypeHandicapped = "handicapped"
+	SpotTypeElectric    = "electric"
+	SpotTypeCompact     = "compact"
+)
+
+var SpotTypes = []string{SpotTypeRegular, SpotTypeHandicapped, SpotTypeElectric, SpotTypeCompact}
+
 type ParkingSpot struct {
-	ID           uuid.UUID `json:"id" db:"id"`
-	ParkingLotID uuid.UUID `json:"parking_lot_id" db:"parking_lot_id"`
-	SpotNumber   string    `json:"spot_number" db:"spot_number"`
-	SpotType     string    `json:"spot_type" db:"spot_type"` // regular, handicapped, electric, compact
-	IsOccupied   bool      `json:"is_occupied" db:"is_occupied"`
-	IsReserved   bool      `json:"is_reserved" db:"is_reserved"`
-	IsActive     bool      `json:"is_active" db:"is_active"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
-	Version      int       `json:"version" db:"version"`
+	ID                uuid.UUID  `json:"id" db:"id"`
+	ParkingLotID      uuid.UUID  `json:"parking_lot_id" db:"parking_lot_id"`
+	SpotNumber        string     `json:"spot_number" db:"spot_number"`
+	SpotType          string     `json:"spot_type" db:"spot_type"` // regular, handicapped, electric, compact
+	IsOccupied        bool       `json:"is_occupied" db:"is_occupied"`
+	IsReserved        bool       `json:"is_reserved" db:"is_reserved"`
+	IsActive          bool       `json:"is_active" db:"is_active"`
+	Status            string     `json:"status" db:"status"` // active, maintenance, decommissioned
+	MaintenanceReason *string    `json:"maintenance_reason,omitempty" db:"maintenance_reason"`
+	MaintenanceSince  *time.Time `json:"maintenance_since,omitempty" db:"maintenance_since"`
+	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at" db:"updated_at"`
+	Version           int        `json:"version" db:"version"`
 }
 
 func ValidateParkingSpot(v *validator.Validator, spot *ParkingSpot) {
 	v.Check(spot.SpotNumber != "", "spot_number", "must be provided")
 	v.Check(len(spot.SpotNumber) <= 20, "spot_number", "must not be more than 20 characters long")
 
-	v.Check(validator.PermittedValue(spot.SpotType, "regular", "handicapped", "electric", "compact"), "spot_type", "must be a valid spot type")
+	v.Check(validator.PermittedValue(spot.SpotType, SpotTypes...), "spot_type", "must be a valid spot type")
+
+	v.Check(validator.PermittedValue(spot.Status,
+		SpotStatusActive,
+		SpotStatusMaintenance,
+		SpotStatusDecommissioned), "status", "must be a valid status")
 }
 
 type ParkingSpotModel struct {
 	DB *sql.DB
+	queryScope
 }
 
 func (m ParkingSpotModel) Insert(spot *ParkingSpot) error {
 	query := `
-		INSERT INTO parking_spots (parking_lot_id, spot_number, spot_type, is_occupied, is_reserved, is_active)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO parking_spots (parking_lot_id, spot_number, spot_type, is_occupied, is_reserved, is_active, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id, created_at, updated_at, version`
 
+	// is_active is kept in step with status for older queries
+	spot.IsActive = spot.Status == SpotStatusActive
+
 	args := []any{
 		spot.ParkingLotID,
 		spot.SpotNumber,
@@ -48,9 +80,10 @@ func (m ParkingSpotModel) Insert(spot *ParkingSpot) error {
 		spot.IsOccupied,
 		spot.IsReserved,
 		spot.IsActive,
+		spot.Status,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
@@ -60,7 +93,12 @@ func (m ParkingSpotModel) Insert(spot *ParkingSpot) error {
 		&spot.Version,
 	)
 	if err != nil {
-		return err
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "parking_spots_parking_lot_id_spot_number_key"`:
+			return ErrDuplicateSpotNumber
+		default:
+			return err
+		}
 	}
 
 	return nil
@@ -68,13 +106,13 @@ func (m ParkingSpotModel) Insert(spot *ParkingSpot) error {
 
 func (m ParkingSpotModel) Get(id uuid.UUID) (*ParkingSpot, error) {
 	query := `
-		SELECT id, parking_lot_id, spot_number, spot_type, is_occupied, is_reserved, is_active, created_at, updated_at, version
+		SELECT id, parking_lot_id, spot_number, spot_type, is_occupied, is_reserved, is_active, status, maintenance_reason, maintenance_since, created_at, updated_at, version
 		FROM parking_spots
 		WHERE id = $1`
 
 	var spot ParkingSpot
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
@@ -85,6 +123,9 @@ func (m ParkingSpotModel) Get(id uuid.UUID) (*ParkingSpot, error) {
 		&spot.IsOccupied,
 		&spot.IsReserved,
 		&spot.IsActive,
+		&spot.Status,
+		&spot.MaintenanceReason,
+		&spot.MaintenanceSince,
 		&spot.CreatedAt,
 		&spot.UpdatedAt,
 		&spot.Version,
@@ -102,9 +143,22 @@ func (m ParkingSpotModel) Get(id uuid.UUID) (*ParkingSpot, error) {
 	return &spot, nil
 }
 
+// BelongsToLot reports whether the spot is one of the lot's spots.
+func (m ParkingSpotModel) BelongsToLot(spotID, lotID uuid.UUID) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM parking_spots WHERE id = $1 AND parking_lot_id = $2)`
+
+	var belongs bool
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, spotID, lotID).Scan(&belongs)
+	return belongs, err
+}
+
 func (m ParkingSpotModel) GetAllByLot(lotID uuid.UUID, filters Filters) ([]*ParkingSpot, Metadata, error) {
 	query := `
-		SELECT count(*) OVER(), id, parking_lot_id, spot_number, spot_type, is_occupied, is_reserved, is_active, created_at, updated_at, version
+		SELECT count(*) OVER(), id, parking_lot_id, spot_number, spot_type, is_occupied, is_reserved, is_active, status, maintenance_reason, maintenance_since, created_at, updated_at, version
 		FROM parking_spots
 		WHERE parking_lot_id = $1
 		ORDER BY %s %s, id ASC
@@ -112,7 +166,7 @@ func (m ParkingSpotModel) GetAllByLot(lotID uuid.UUID, filters Filters) ([]*Park
 
 	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	args := []any{lotID, filters.limit(), filters.offset()}
@@ -138,6 +192,9 @@ func (m ParkingSpotModel) GetAllByLot(lotID uuid.UUID, filters Filters) ([]*Park
 			&spot.IsOccupied,
 			&spot.IsReserved,
 			&spot.IsActive,
+			&spot.Status,
+			&spot.MaintenanceReason,
+			&spot.MaintenanceSince,
 			&spot.CreatedAt,
 			&spot.UpdatedAt,
 			&spot.Version,
@@ -164,21 +221,21 @@ func (m ParkingSpotModel) GetAvailableByLot(lotID uuid.UUID, spotType string) ([
 
 	if spotType != "" {
 		query = `
-			SELECT id, parking_lot_id, spot_number, spot_type, is_occupied, is_reserved, is_active, created_at, updated_at, version
+			SELECT id, parking_lot_id, spot_number, spot_type, is_occupied, is_reserved, is_active, status, maintenance_reason, maintenance_since, created_at, updated_at, version
 			FROM parking_spots
-			WHERE parking_lot_id = $1 AND spot_type = $2 AND is_active = true AND is_occupied = false AND is_reserved = false
+			WHERE parking_lot_id = $1 AND spot_type = $2 AND status = 'active' AND is_occupied = false AND is_reserved = false
 			ORDER BY spot_number ASC`
 		args = []any{lotID, spotType}
 	} else {
 		query = `
-			SELECT id, parking_lot_id, spot_number, spot_type, is_occupied, is_reserved, is_active, created_at, updated_at, version
+			SELECT id, parking_lot_id, spot_number, spot_type, is_occupied, is_reserved, is_active, status, maintenance_reason, maintenance_since, created_at, updated_at, version
 			FROM parking_spots
-			WHERE parking_lot_id = $1 AND is_active = true AND is_occupied = false AND is_reserved = false
+			WHERE parking_lot_id = $1 AND status = 'active' AND is_occupied = false AND is_reserved = false
 			ORDER BY spot_number ASC`
 		args = []any{lotID}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	rows, err := m.DB.QueryContext(ctx, query, args...)
@@ -200,6 +257,9 @@ func (m ParkingSpotModel) GetAvailableByLot(lotID uuid.UUID, spotType string) ([
 			&spot.IsOccupied,
 			&spot.IsReserved,
 			&spot.IsActive,
+			&spot.Status,
+			&spot.MaintenanceReason,
+			&spot.MaintenanceSince,
 			&spot.CreatedAt,
 			&spot.UpdatedAt,
 			&spot.Version,
@@ -218,24 +278,89 @@ func (m ParkingSpotModel) GetAvailableByLot(lotID uuid.UUID, spotType string) ([
 	return spots, nil
 }
 
+// freeSpotForWindowQuery finds the first free spot for a booking window. It is
+// shared with ReservationModel.InsertWithFreeSpot, which runs it inside the
+// booking transaction.
+const freeSpotForWindowQuery = `
+		FROM parking_spots s
+		WHERE s.parking_lot_id = $1 AND s.status = 'active' AND s.spot_type = ANY($7)
+		AND NOT EXISTS (
+			SELECT 1 FROM reservations r
+			WHERE r.parking_spot_id = s.id
+			AND r.status IN ($2, $3, $4)
+			AND r.start_time < $6 AND r.end_time > $5
+		)
+		AND (s.reserved_until IS NULL OR s.reserved_until <= NOW() OR s.held_by = $8)
+		ORDER BY array_position($7, s.spot_type), s.spot_number ASC
+		LIMIT 1`
+
+func freeSpotForWindowArgs(lotID uuid.UUID, start, end time.Time, spotTypes []string, userID uuid.UUID) []any {
+	return []any{lotID, ReservationStatusPending, ReservationStatusConfirmed, ReservationStatusActive, start, end, pq.Array(spotTypes), userID}
+}
+
+// CountByType returns how many spots the lot has of each type. Every known
+// type is present, with zero when the lot has none of it.
+func (m ParkingSpotModel) CountByType(lotID uuid.UUID) (map[string]int, error) {
+	query := `
+		SELECT spot_type, COUNT(*)
+		FROM parking_spots
+		WHERE parking_lot_id = $1
+		GROUP BY spot_type`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, lotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int, len(SpotTypes))
+	for _, spotType := range SpotTypes {
+		counts[spotType] = 0
+	}
+
+	for rows.Next() {
+		var spotType string
+		var count int
+
+		err := rows.Scan(&spotType, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		counts[spotType] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
 func (m ParkingSpotModel) Update(spot *ParkingSpot) error {
 	query := `
 		UPDATE parking_spots
-		SET spot_number = $1, spot_type = $2, is_occupied = $3, is_reserved = $4, is_active = $5, updated_at = CURRENT_TIMESTAMP, version = version + 1
-		WHERE id = $6 AND version = $7
+		SET spot_number = $1, spot_type = $2, is_occupied = $3, is_reserved = $4, is_active = $5, status = $6, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $7 AND version = $8
 		RETURNING updated_at, version`
 
+	spot.IsActive = spot.Status == SpotStatusActive
+
 	args := []any{
 		spot.SpotNumber,
 		spot.SpotType,
 		spot.IsOccupied,
 		spot.IsReserved,
 		spot.IsActive,
+		spot.Status,
 		spot.ID,
 		spot.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&spot.UpdatedAt, &spot.Version)
@@ -251,16 +376,109 @@ func (m ParkingSpotModel) Update(spot *ParkingSpot) error {
 	return nil
 }
 
+// SetOccupied flips the spot's occupied flag. The update only applies while the flag
+// still has the opposite value, so two concurrent writers can't both claim the
+// same change; the loser gets ErrEditConflict.
 func (m ParkingSpotModel) SetOccupied(spotID uuid.UUID, occupied bool) error {
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.setOccupiedTx(ctx, tx, spotID, occupied)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// setOccupiedTx is SetOccupied within tx.
+func (m ParkingSpotModel) setOccupiedTx(ctx context.Context, tx *sql.Tx, spotID uuid.UUID, occupied bool) error {
+	query := `
+		UPDATE parking_spots
+		SET is_occupied = $1, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $2 AND is_occupied <> $1`
+
+	result, err := tx.ExecContext(ctx, query, occupied, spotID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return m.missingOrConflict(ctx, spotID)
+	}
+
+	return nil
+}
+
+// SetReserved flips the spot's reserved flag. The update only applies while the flag
+// still has the opposite value, so two concurrent writers can't both claim the
+// same change; the loser gets ErrEditConflict.
+func (m ParkingSpotModel) SetReserved(spotID uuid.UUID, reserved bool) error {
+	query := `
+		UPDATE parking_spots
+		SET is_reserved = $1, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $2 AND is_reserved <> $1`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, reserved, spotID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return m.missingOrConflict(ctx, spotID)
+	}
+
+	return nil
+}
+
+// missingOrConflict explains why a conditional update touched no rows: the
+// spot doesn't exist, or it was changed by someone else first.
+func (m ParkingSpotModel) missingOrConflict(ctx context.Context, spotID uuid.UUID) error {
+	var exists bool
+
+	err := m.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM parking_spots WHERE id = $1)`, spotID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrRecordNotFound
+	}
+	return ErrEditConflict
+}
+
+// SetStatus moves a spot between active, maintenance and decommissioned.
+// Returning a spot to active or decommissioning it clears any maintenance reason.
+func (m ParkingSpotModel) SetStatus(spotID uuid.UUID, status string) error {
 	query := `
 		UPDATE parking_spots
-		SET is_occupied = $1, updated_at = CURRENT_TIMESTAMP
+		SET status = $1, is_active = ($1 = 'active'), maintenance_reason = NULL, maintenance_since = NULL,
+		    updated_at = CURRENT_TIMESTAMP, version = version + 1
 		WHERE id = $2`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, occupied, spotID)
+	result, err := m.DB.ExecContext(ctx, query, status, spotID)
 	if err != nil {
 		return err
 	}
@@ -277,16 +495,19 @@ func (m ParkingSpotModel) SetOccupied(spotID uuid.UUID, occupied bool) error {
 	return nil
 }
 
-func (m ParkingSpotModel) SetReserved(spotID uuid.UUID, reserved bool) error {
+// SetMaintenance takes a spot out of service for maintenance, recording why and
+// since when. Reservation holders on the spot are notified by a background job.
+func (m ParkingSpotModel) SetMaintenance(spotID uuid.UUID, reason string) error {
 	query := `
 		UPDATE parking_spots
-		SET is_reserved = $1, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $2`
+		SET status = $1, is_active = false, maintenance_reason = $2, maintenance_since = CURRENT_TIMESTAMP,
+		    updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $3`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, reserved, spotID)
+	result, err := m.DB.ExecContext(ctx, query, SpotStatusMaintenance, reason, spotID)
 	if err != nil {
 		return err
 	}
@@ -303,10 +524,191 @@ func (m ParkingSpotModel) SetReserved(spotID uuid.UUID, reserved bool) error {
 	return nil
 }
 
+// MaxMaintenanceBatch is the most spots SetMaintenanceBulk takes by ID at once.
+const MaxMaintenanceBatch = 500
+
+// SpotSelection picks spots of a lot either by ID or, when no IDs are given, as
+// the range of spot numbers from FromNumber to ToNumber inclusive. Ranges are
+// compared numerically and only match spot numbers made of digits, so 1 to 20
+// takes "7" and "012" but not "100" or "A12"; other spots are picked by ID.
+type SpotSelection struct {
+	SpotIDs    []uuid.UUID
+	FromNumber int64
+	ToNumber   int64
+}
+
+// maxNumericSpotDigits keeps numeric spot numbers within an int64.
+const maxNumericSpotDigits = 18
+
+// NumericSpotNumber returns the value of a spot number made only of digits,
+// such as "7" or "012", and false for any other, such as "A12".
+func NumericSpotNumber(number string) (int64, bool) {
+	if number == "" || len(number) > maxNumericSpotDigits {
+		return 0, false
+	}
+
+	var value int64
+	for _, c := range number {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		value = value*10 + int64(c-'0')
+	}
+	return value, true
+}
+
+// SetMaintenanceBulk takes the selected spots of a lot out of service for
+// maintenance together, e.g. when a section of the lot is closed, and returns
+// the pending and confirmed reservations on them that haven't ended yet so
+// their holders can be told. Spots are updated in one transaction: if any of
+// the given IDs is not a spot of the lot, or the range matches no spots,
+// nothing changes and ErrRecordNotFound is returned.
+func (m ParkingSpotModel) SetMaintenanceBulk(lotID uuid.UUID, selection SpotSelection, reason string) (int, []*MaintenanceAffectedReservation, error) {
+	ctx, cancel := m.longQueryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE parking_spots
+		SET status = $1, is_active = false, maintenance_reason = $2, maintenance_since = CURRENT_TIMESTAMP,
+		    updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE parking_lot_id = $3`
+
+	args := []any{SpotStatusMaintenance, reason, lotID}
+
+	// IDs may repeat; each spot only counts once
+	wanted := map[uuid.UUID]bool{}
+	for _, id := range selection.SpotIDs {
+		wanted[id] = true
+	}
+
+	if len(selection.SpotIDs) > 0 {
+		query += ` AND id = ANY($4) RETURNING id`
+		args = append(args, pq.Array(selection.SpotIDs))
+	} else {
+		// The CASE keeps the cast away from spot numbers that aren't numeric
+		query += fmt.Sprintf(` AND CASE WHEN spot_number ~ '^[0-9]{1,%d}$' THEN spot_number::bigint BETWEEN $4 AND $5 ELSE false END RETURNING id`, maxNumericSpotDigits)
+		args = append(args, selection.FromNumber, selection.ToNumber)
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	spotIDs := []uuid.UUID{}
+
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return 0, nil, err
+		}
+		spotIDs = append(spotIDs, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	if len(spotIDs) == 0 || len(spotIDs) < len(wanted) {
+		return 0, nil, ErrRecordNotFound
+	}
+
+	query = maintenanceAffectedColumns + `
+		WHERE r.parking_spot_id = ANY($1)
+		AND r.status IN ($2, $3)
+		AND r.end_time > NOW()
+		ORDER BY r.start_time ASC`
+
+	rows, err = tx.QueryContext(ctx, query, pq.Array(spotIDs), ReservationStatusPending, ReservationStatusConfirmed)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	affected := []*MaintenanceAffectedReservation{}
+
+	for rows.Next() {
+		reservation, err := scanMaintenanceAffected(rows)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		affected = append(affected, reservation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return len(spotIDs), affected, nil
+}
+
+func (m ParkingSpotModel) GetMaintenanceSpots(lotID uuid.UUID) ([]*ParkingSpot, error) {
+	query := `
+		SELECT id, parking_lot_id, spot_number, spot_type, is_occupied, is_reserved, is_active, status, maintenance_reason, maintenance_since, created_at, updated_at, version
+		FROM parking_spots
+		WHERE parking_lot_id = $1 AND status = $2
+		ORDER BY maintenance_since ASC, spot_number ASC`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, lotID, SpotStatusMaintenance)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	spots := []*ParkingSpot{}
+
+	for rows.Next() {
+		var spot ParkingSpot
+
+		err := rows.Scan(
+			&spot.ID,
+			&spot.ParkingLotID,
+			&spot.SpotNumber,
+			&spot.SpotType,
+			&spot.IsOccupied,
+			&spot.IsReserved,
+			&spot.IsActive,
+			&spot.Status,
+			&spot.MaintenanceReason,
+			&spot.MaintenanceSince,
+			&spot.CreatedAt,
+			&spot.UpdatedAt,
+			&spot.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		spots = append(spots, &spot)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return spots, nil
+}
+
 func (m ParkingSpotModel) Delete(id uuid.UUID) error {
 	query := `DELETE FROM parking_spots WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	result, err := m.DB.ExecContext(ctx, query, id)
@@ -327,11 +729,7 @@ func (m ParkingSpotModel) Delete(id uuid.UUID) error {
 }
 
 func (m ParkingSpotModel) BulkCreate(lotID uuid.UUID, spots []ParkingSpot) error {
-	query := `
-		INSERT INTO parking_spots (parking_lot_id, spot_number, spot_type, is_occupied, is_reserved, is_active)
-		VALUES ($1, $2, $3, $4, $5, $6)`
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := m.longQueryContext()
 	defer cancel()
 
 	tx, err := m.DB.BeginTx(ctx, nil)
@@ -340,6 +738,20 @@ func (m ParkingSpotModel) BulkCreate(lotID uuid.UUID, spots []ParkingSpot) error
 	}
 	defer tx.Rollback()
 
+	err = insertParkingSpots(ctx, tx, lotID, spots)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertParkingSpots adds spots to a lot inside tx.
+func insertParkingSpots(ctx context.Context, tx *sql.Tx, lotID uuid.UUID, spots []ParkingSpot) error {
+	query := `
+		INSERT INTO parking_spots (parking_lot_id, spot_number, spot_type, is_occupied, is_reserved, is_active, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return err
@@ -353,12 +765,13 @@ func (m ParkingSpotModel) BulkCreate(lotID uuid.UUID, spots []ParkingSpot) error
 			spot.SpotType,
 			spot.IsOccupied,
 			spot.IsReserved,
-			spot.IsActive,
+			spot.Status == SpotStatusActive,
+			spot.Status,
 		)
 		if err != nil {
 			return err
 		}
 	}
 
-	return tx.Commit()
+	return nil
 }
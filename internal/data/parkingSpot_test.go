@@ -0,0 +1,373 @@
+package data
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMaintenanceSpotsAreNotAvailable(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	lot, spots := insertTestLot(t, m, owner.ID, 3)
+
+	if err := m.ParkingSpots.SetMaintenance(spots[1].ID, "broken barrier"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, spotType := range []string{"", SpotTypeRegular} {
+		available, err := m.ParkingSpots.GetAvailableByLot(lot.ID, spotType)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := map[uuid.UUID]bool{}
+		for _, spot := range available {
+			ids[spot.ID] = true
+		}
+		if len(available) != 2 || !ids[spots[0].ID] || !ids[spots[2].ID] {
+			t.Errorf("type %q: got %d available spots; want spots 1 and 3", spotType, len(available))
+		}
+		if ids[spots[1].ID] {
+			t.Errorf("type %q: maintenance spot listed as available", spotType)
+		}
+	}
+
+	maintenance, err := m.ParkingSpots.GetMaintenanceSpots(lot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(maintenance) != 1 || maintenance[0].ID != spots[1].ID {
+		t.Fatalf("got %d maintenance spots; want spot 2 only", len(maintenance))
+	}
+	spot := maintenance[0]
+	if spot.Status != SpotStatusMaintenance || spot.IsActive {
+		t.Errorf("got status %q, active %t; want maintenance and inactive", spot.Status, spot.IsActive)
+	}
+	if spot.MaintenanceReason == nil || *spot.MaintenanceReason != "broken barrier" || spot.MaintenanceSince == nil {
+		t.Errorf("maintenance reason and time not recorded: %v %v", spot.MaintenanceReason, spot.MaintenanceSince)
+	}
+}
+
+func TestGetAffectedByMaintenance(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+	lot, spots := insertTestLot(t, m, user.ID, 2)
+	vehicle := insertTestVehicle(t, m, user.ID)
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	affected := insertTestReservation(t, m, vehicle, lot.ID, spots[0], start, time.Hour)
+	unaffected := insertTestReservation(t, m, vehicle, lot.ID, spots[1], start.Add(2*time.Hour), time.Hour)
+
+	if err := m.ParkingSpots.SetMaintenance(spots[0].ID, "resurfacing"); err != nil {
+		t.Fatal(err)
+	}
+
+	find := func() map[uuid.UUID]*MaintenanceAffectedReservation {
+		t.Helper()
+		reservations, err := m.Reservations.GetAffectedByMaintenance()
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := map[uuid.UUID]*MaintenanceAffectedReservation{}
+		for _, r := range reservations {
+			found[r.ID] = r
+		}
+		return found
+	}
+
+	found := find()
+	got, ok := found[affected.ID]
+	if !ok {
+		t.Fatal("reservation on the maintenance spot is not reported")
+	}
+	if got.SpotNumber != spots[0].SpotNumber || got.MaintenanceReason == nil || *got.MaintenanceReason != "resurfacing" {
+		t.Errorf("got spot %q, reason %v; want spot %q and the reason", got.SpotNumber, got.MaintenanceReason, spots[0].SpotNumber)
+	}
+	if _, ok := found[unaffected.ID]; ok {
+		t.Error("reservation on an active spot is reported")
+	}
+
+	if err := m.Reservations.MarkMaintenanceNotified(affected.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := find()[affected.ID]; ok {
+		t.Error("reservation is reported again after its holder was notified")
+	}
+}
+
+func TestSetOccupiedLostUpdate(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	_, spots := insertTestLot(t, m, owner.ID, 1)
+	spot := spots[0]
+
+	// Racing check-ins all try to claim the same free spot; only one may win.
+	const writers = 8
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- m.ParkingSpots.SetOccupied(spot.ID, true)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	won, conflicts := 0, 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			won++
+		case errors.Is(err, ErrEditConflict):
+			conflicts++
+		default:
+			t.Fatal(err)
+		}
+	}
+	if won != 1 || conflicts != writers-1 {
+		t.Errorf("got %d winners and %d conflicts; want 1 and %d", won, conflicts, writers-1)
+	}
+
+	got, err := m.ParkingSpots.Get(spot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.IsOccupied || got.Version != spot.Version+1 {
+		t.Errorf("got occupied %t at version %d; want occupied at version %d", got.IsOccupied, got.Version, spot.Version+1)
+	}
+
+	// Freeing it works once; a second release finds nothing to change.
+	if err := m.ParkingSpots.SetOccupied(spot.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ParkingSpots.SetOccupied(spot.ID, false); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("second release: got %v; want ErrEditConflict", err)
+	}
+
+	if err := m.ParkingSpots.SetReserved(spot.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ParkingSpots.SetReserved(spot.ID, true); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("second reservation: got %v; want ErrEditConflict", err)
+	}
+
+	if err := m.ParkingSpots.SetOccupied(uuid.New(), true); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("unknown spot: got %v; want ErrRecordNotFound", err)
+	}
+}
+
+func TestCountByType(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	lot, _ := insertTestLot(t, m, owner.ID, 2)
+	other, _ := insertTestLot(t, m, owner.ID, 1)
+
+	for i, spotType := range []string{SpotTypeHandicapped, SpotTypeElectric, SpotTypeElectric, SpotTypeElectric} {
+		spot := &ParkingSpot{
+			ParkingLotID: lot.ID,
+			SpotNumber:   "T" + strconv.Itoa(i),
+			SpotType:     spotType,
+			Status:       SpotStatusActive,
+		}
+		if err := m.ParkingSpots.Insert(spot); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	counts, err := m.ParkingSpots.CountByType(lot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int{
+		SpotTypeRegular:     2,
+		SpotTypeHandicapped: 1,
+		SpotTypeElectric:    3,
+		SpotTypeCompact:     0,
+	}
+	if len(counts) != len(want) {
+		t.Errorf("got %d spot types; want %d: %v", len(counts), len(want), counts)
+	}
+	for spotType, n := range want {
+		got, ok := counts[spotType]
+		if !ok {
+			t.Errorf("%s missing from counts", spotType)
+		} else if got != n {
+			t.Errorf("%s: got %d; want %d", spotType, got, n)
+		}
+	}
+
+	counts, err = m.ParkingSpots.CountByType(other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[SpotTypeRegular] != 1 || counts[SpotTypeElectric] != 0 {
+		t.Errorf("other lot: got %v; want 1 regular spot only", counts)
+	}
+}
+
+func TestBelongsToLot(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	lot, spots := insertTestLot(t, m, owner.ID, 1)
+	other, _ := insertTestLot(t, m, owner.ID, 1)
+
+	tests := []struct {
+		name   string
+		spotID uuid.UUID
+		lotID  uuid.UUID
+		want   bool
+	}{
+		{"own lot", spots[0].ID, lot.ID, true},
+		{"another lot", spots[0].ID, other.ID, false},
+		{"unknown spot", uuid.New(), lot.ID, false},
+	}
+
+	for _, tt := range tests {
+		got, err := m.ParkingSpots.BelongsToLot(tt.spotID, tt.lotID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSetMaintenanceBulk(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	driver := insertTestUser(t, m)
+	lot, spots := insertTestLot(t, m, owner.ID, 4)
+	_, otherSpots := insertTestLot(t, m, owner.ID, 1)
+	vehicle := insertTestVehicle(t, m, owner.ID)
+	driverVehicle := insertTestVehicle(t, m, driver.ID)
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	upcoming := insertTestReservation(t, m, vehicle, lot.ID, spots[0], start, time.Hour)
+	insertTestReservation(t, m, vehicle, lot.ID, spots[0], time.Now().Add(-3*time.Hour), time.Hour)
+	driverUpcoming := insertTestReservation(t, m, driverVehicle, lot.ID, spots[1], start, time.Hour)
+	cancelled := insertTestReservation(t, m, driverVehicle, lot.ID, spots[1], start.Add(2*time.Hour), time.Hour)
+	if err := m.Reservations.UpdateStatus(cancelled.ID, ReservationStatusCancelled); err != nil {
+		t.Fatal(err)
+	}
+	later := insertTestReservation(t, m, driverVehicle, lot.ID, spots[2], start, time.Hour)
+
+	lettered := &ParkingSpot{ParkingLotID: lot.ID, SpotNumber: "A3", SpotType: SpotTypeRegular, Status: SpotStatusActive}
+	if err := m.ParkingSpots.Insert(lettered); err != nil {
+		t.Fatal(err)
+	}
+
+	status := func(spot *ParkingSpot) string {
+		t.Helper()
+		stored, err := m.ParkingSpots.Get(spot.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stored.Status
+	}
+
+	affectedIDs := func(affected []*MaintenanceAffectedReservation) map[uuid.UUID]uuid.UUID {
+		ids := map[uuid.UUID]uuid.UUID{}
+		for _, r := range affected {
+			ids[r.ID] = r.UserID
+		}
+		return ids
+	}
+
+	// A spot of another lot spoils the whole batch
+	_, _, err := m.ParkingSpots.SetMaintenanceBulk(lot.ID, SpotSelection{SpotIDs: []uuid.UUID{spots[0].ID, otherSpots[0].ID}}, "repaving")
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("foreign spot: got %v; want ErrRecordNotFound", err)
+	}
+	if got := status(spots[0]); got != SpotStatusActive {
+		t.Errorf("spot 1 is %s after a failed batch; want %s", got, SpotStatusActive)
+	}
+
+	// By ID, repeats counted once
+	updated, affected, err := m.ParkingSpots.SetMaintenanceBulk(lot.ID, SpotSelection{SpotIDs: []uuid.UUID{spots[0].ID, spots[1].ID, spots[0].ID}}, "repaving")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 2 {
+		t.Errorf("updated %d spots; want 2", updated)
+	}
+	want := map[uuid.UUID]uuid.UUID{upcoming.ID: owner.ID, driverUpcoming.ID: driver.ID}
+	got := affectedIDs(affected)
+	if len(got) != len(want) {
+		t.Errorf("got %d affected reservations; want %d", len(got), len(want))
+	}
+	for id, holder := range want {
+		if got[id] != holder {
+			t.Errorf("reservation %s: got holder %s; want %s", id, got[id], holder)
+		}
+	}
+	for _, r := range affected {
+		if r.MaintenanceReason == nil || *r.MaintenanceReason != "repaving" || r.SpotNumber == "" {
+			t.Errorf("reservation %s: spot %q, reason %v; want the spot and reason", r.ID, r.SpotNumber, r.MaintenanceReason)
+		}
+	}
+	for _, spot := range spots[:2] {
+		if got := status(spot); got != SpotStatusMaintenance {
+			t.Errorf("spot %s is %s; want %s", spot.SpotNumber, got, SpotStatusMaintenance)
+		}
+	}
+	if got := status(spots[2]); got != SpotStatusActive {
+		t.Errorf("unselected spot 3 is %s; want %s", got, SpotStatusActive)
+	}
+
+	// By spot number range
+	updated, affected, err = m.ParkingSpots.SetMaintenanceBulk(lot.ID, SpotSelection{FromNumber: 3, ToNumber: 4}, "line painting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 2 {
+		t.Errorf("range: updated %d spots; want 2", updated)
+	}
+	if got := affectedIDs(affected); len(got) != 1 || got[later.ID] != driver.ID {
+		t.Errorf("range: got affected %v; want only %s", got, later.ID)
+	}
+	if got := status(spots[3]); got != SpotStatusMaintenance {
+		t.Errorf("spot 4 is %s; want %s", got, SpotStatusMaintenance)
+	}
+	if got := status(lettered); got != SpotStatusActive {
+		t.Errorf("spot A3 is %s after a numeric range; want %s", got, SpotStatusActive)
+	}
+
+	_, _, err = m.ParkingSpots.SetMaintenanceBulk(lot.ID, SpotSelection{FromNumber: 7, ToNumber: 8}, "repaving")
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("empty range: got %v; want ErrRecordNotFound", err)
+	}
+}
+
+func TestNumericSpotNumber(t *testing.T) {
+	tests := []struct {
+		number string
+		want   int64
+		ok     bool
+	}{
+		{"7", 7, true},
+		{"012", 12, true},
+		{"0", 0, true},
+		{"A12", 0, false},
+		{"12B", 0, false},
+		{"-1", 0, false},
+		{"", 0, false},
+		{"1234567890123456789", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := NumericSpotNumber(tt.number)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("NumericSpotNumber(%q) = %d, %t; want %d, %t", tt.number, got, ok, tt.want, tt.ok)
+		}
+	}
+}
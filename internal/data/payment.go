@@ -3,6 +3,7 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -24,27 +25,49 @@ const (
 	PaymentMethodDigitalWallet = "digital_wallet"
 )
 
+var (
+	ErrInvalidRefund   = errors.New("refund exceeds the refundable amount")
+	ErrUnroundedAmount = errors.New("amount has more decimals than the currency allows")
+)
+
 type Payment struct {
-	ID            uuid.UUID `json:"id" db:"id"`
-	ReservationID uuid.UUID `json:"reservation_id" db:"reservation_id"`
-	UserID        uuid.UUID `json:"user_id" db:"user_id"`
-	Amount        float64   `json:"amount" db:"amount"`
-	Currency      string    `json:"currency" db:"currency"`
-	PaymentMethod string    `json:"payment_method" db:"payment_method"`
-	Status        string    `json:"status" db:"status"`
-	TransactionID *string   `json:"transaction_id" db:"transaction_id"`
-	PaymentDate   time.Time `json:"payment_date" db:"payment_date"`
-	CreatedAt     time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
-	Version       int       `json:"version" db:"version"`
+	ID             uuid.UUID  `json:"id" db:"id"`
+	ReservationID  *uuid.UUID `json:"reservation_id" db:"reservation_id"` // nil for violation fees on walk-in sessions
+	UserID         uuid.UUID  `json:"user_id" db:"user_id"`
+	Amount         Money      `json:"amount" db:"amount"`
+	Currency       string     `json:"currency" db:"currency"`
+	PaymentMethod  string     `json:"payment_method" db:"payment_method"`
+	Status         string     `json:"status" db:"status"`
+	TransactionID  *string    `json:"transaction_id" db:"transaction_id"`
+	PaymentDate    time.Time  `json:"payment_date" db:"payment_date"`
+	RefundedAmount Money      `json:"refunded_amount" db:"refunded_amount"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+	Version        int        `json:"version" db:"version"`
+}
+
+// MarshalJSON writes the amounts with the payment currency's minor units.
+func (p Payment) MarshalJSON() ([]byte, error) {
+	type payment Payment
+
+	return json.Marshal(struct {
+		payment
+		Amount         json.RawMessage `json:"amount"`
+		RefundedAmount json.RawMessage `json:"refunded_amount"`
+	}{
+		payment:        payment(p),
+		Amount:         json.RawMessage(p.Amount.StringIn(p.Currency)),
+		RefundedAmount: json.RawMessage(p.RefundedAmount.StringIn(p.Currency)),
+	})
 }
 
 func ValidatePayment(v *validator.Validator, payment *Payment) {
 	v.Check(payment.Amount > 0, "amount", "must be greater than zero")
-	v.Check(payment.Amount <= 100000, "amount", "must not exceed 100,000")
+	v.Check(payment.Amount <= MoneyFromFloat(100000), "amount", "must not exceed 100,000")
 
 	v.Check(payment.Currency != "", "currency", "must be provided")
 	v.Check(len(payment.Currency) == 3, "currency", "must be a valid 3-letter currency code")
+	ValidateMoney(v, "amount", payment.Currency, payment.Amount.Float64())
 
 	v.Check(validator.PermittedValue(payment.PaymentMethod,
 		PaymentMethodCard,
@@ -60,9 +83,17 @@ func ValidatePayment(v *validator.Validator, payment *Payment) {
 
 type PaymentModel struct {
 	DB *sql.DB
+	queryScope
 }
 
+// Insert saves the payment. Amounts must already be rounded to the currency's
+// minor units; ErrUnroundedAmount is returned otherwise so the stored amount
+// never differs from the one that was charged.
 func (m PaymentModel) Insert(payment *Payment) error {
+	if !IsRoundedMoney(payment.Currency, payment.Amount.Float64()) {
+		return ErrUnroundedAmount
+	}
+
 	query := `
 		INSERT INTO payments (reservation_id, user_id, amount, currency, payment_method, status, transaction_id, payment_date)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
@@ -79,10 +110,16 @@ func (m PaymentModel) Insert(payment *Payment) error {
 		payment.PaymentDate,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(
 		&payment.ID,
 		&payment.CreatedAt,
 		&payment.UpdatedAt,
@@ -92,18 +129,31 @@ func (m PaymentModel) Insert(payment *Payment) error {
 		return err
 	}
 
-	return nil
+	err = m.accrueIfCompleted(ctx, tx, payment.ID, payment.UserID, payment.Status, payment.Amount)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// accrueIfCompleted credits loyalty points once a payment is completed.
+func (m PaymentModel) accrueIfCompleted(ctx context.Context, tx *sql.Tx, id, userID uuid.UUID, status string, amount Money) error {
+	if status != PaymentStatusCompleted {
+		return nil
+	}
+	return LoyaltyModel{DB: m.DB}.Accrue(ctx, tx, id, userID, amount.Float64())
 }
 
 func (m PaymentModel) Get(id uuid.UUID) (*Payment, error) {
 	query := `
-		SELECT id, reservation_id, user_id, amount, currency, payment_method, status, transaction_id, payment_date, created_at, updated_at, version
+		SELECT id, reservation_id, user_id, amount, currency, payment_method, status, transaction_id, payment_date, refunded_amount, created_at, updated_at, version
 		FROM payments
 		WHERE id = $1`
 
 	var payment Payment
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
@@ -116,6 +166,7 @@ func (m PaymentModel) Get(id uuid.UUID) (*Payment, error) {
 		&payment.Status,
 		&payment.TransactionID,
 		&payment.PaymentDate,
+		&payment.RefundedAmount,
 		&payment.CreatedAt,
 		&payment.UpdatedAt,
 		&payment.Version,
@@ -135,13 +186,13 @@ func (m PaymentModel) Get(id uuid.UUID) (*Payment, error) {
 
 func (m PaymentModel) GetByReservation(reservationID uuid.UUID) (*Payment, error) {
 	query := `
-		SELECT id, reservation_id, user_id, amount, currency, payment_method, status, transaction_id, payment_date, created_at, updated_at, version
+		SELECT id, reservation_id, user_id, amount, currency, payment_method, status, transaction_id, payment_date, refunded_amount, created_at, updated_at, version
 		FROM payments
 		WHERE reservation_id = $1`
 
 	var payment Payment
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, reservationID).Scan(
@@ -154,6 +205,7 @@ func (m PaymentModel) GetByReservation(reservationID uuid.UUID) (*Payment, error
 		&payment.Status,
 		&payment.TransactionID,
 		&payment.PaymentDate,
+		&payment.RefundedAmount,
 		&payment.CreatedAt,
 		&payment.UpdatedAt,
 		&payment.Version,
@@ -173,7 +225,7 @@ func (m PaymentModel) GetByReservation(reservationID uuid.UUID) (*Payment, error
 
 func (m PaymentModel) GetAllForUser(userID uuid.UUID, filters Filters) ([]*Payment, Metadata, error) {
 	query := `
-		SELECT count(*) OVER(), id, reservation_id, user_id, amount, currency, payment_method, status, transaction_id, payment_date, created_at, updated_at, version
+		SELECT count(*) OVER(), id, reservation_id, user_id, amount, currency, payment_method, status, transaction_id, payment_date, refunded_amount, created_at, updated_at, version
 		FROM payments
 		WHERE user_id = $1
 		ORDER BY %s %s, id ASC
@@ -181,7 +233,7 @@ func (m PaymentModel) GetAllForUser(userID uuid.UUID, filters Filters) ([]*Payme
 
 	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	args := []any{userID, filters.limit(), filters.offset()}
@@ -209,6 +261,7 @@ func (m PaymentModel) GetAllForUser(userID uuid.UUID, filters Filters) ([]*Payme
 			&payment.Status,
 			&payment.TransactionID,
 			&payment.PaymentDate,
+			&payment.RefundedAmount,
 			&payment.CreatedAt,
 			&payment.UpdatedAt,
 			&payment.Version,
@@ -229,20 +282,85 @@ func (m PaymentModel) GetAllForUser(userID uuid.UUID, filters Filters) ([]*Payme
 	return payments, metadata, nil
 }
 
-func (m PaymentModel) GetByStatus(status string, filters Filters) ([]*Payment, Metadata, error) {
+// GetAllForOrg lists the payments of every member of the organization.
+func (m PaymentModel) GetAllForOrg(orgID uuid.UUID, filters Filters) ([]*Payment, Metadata, error) {
 	query := `
-		SELECT count(*) OVER(), id, reservation_id, user_id, amount, currency, payment_method, status, transaction_id, payment_date, created_at, updated_at, version
+		SELECT count(*) OVER(), id, reservation_id, user_id, amount, currency, payment_method, status, transaction_id, payment_date, refunded_amount, created_at, updated_at, version
 		FROM payments
-		WHERE status = $1
+		WHERE user_id IN (SELECT id FROM users WHERE org_id = $1)
 		ORDER BY %s %s, id ASC
 		LIMIT $2 OFFSET $3`
 
 	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	args := []any{orgID, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	payments := []*Payment{}
+
+	for rows.Next() {
+		var payment Payment
+
+		err := rows.Scan(
+			&totalRecords,
+			&payment.ID,
+			&payment.ReservationID,
+			&payment.UserID,
+			&payment.Amount,
+			&payment.Currency,
+			&payment.PaymentMethod,
+			&payment.Status,
+			&payment.TransactionID,
+			&payment.PaymentDate,
+			&payment.RefundedAmount,
+			&payment.CreatedAt,
+			&payment.UpdatedAt,
+			&payment.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		payments = append(payments, &payment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return payments, metadata, nil
+}
+
+// GetByStatus returns payments with the status made between from and to. An
+// empty status matches every status, and nil from or to leave that end of the
+// payment date range open; to is exclusive.
+func (m PaymentModel) GetByStatus(status string, from, to *time.Time, filters Filters) ([]*Payment, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, reservation_id, user_id, amount, currency, payment_method, status, transaction_id, payment_date, refunded_amount, created_at, updated_at, version
+		FROM payments
+		WHERE ($1 = '' OR status = $1)
+		AND ($2::timestamptz IS NULL OR payment_date >= $2)
+		AND ($3::timestamptz IS NULL OR payment_date < $3)
+		ORDER BY %s %s, id ASC
+		LIMIT $4 OFFSET $5`
+
+	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
-	args := []any{status, filters.limit(), filters.offset()}
+	args := []any{status, from, to, filters.limit(), filters.offset()}
 
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -267,6 +385,7 @@ func (m PaymentModel) GetByStatus(status string, filters Filters) ([]*Payment, M
 			&payment.Status,
 			&payment.TransactionID,
 			&payment.PaymentDate,
+			&payment.RefundedAmount,
 			&payment.CreatedAt,
 			&payment.UpdatedAt,
 			&payment.Version,
@@ -289,13 +408,13 @@ func (m PaymentModel) GetByStatus(status string, filters Filters) ([]*Payment, M
 
 func (m PaymentModel) GetByTransactionID(transactionID string) (*Payment, error) {
 	query := `
-		SELECT id, reservation_id, user_id, amount, currency, payment_method, status, transaction_id, payment_date, created_at, updated_at, version
+		SELECT id, reservation_id, user_id, amount, currency, payment_method, status, transaction_id, payment_date, refunded_amount, created_at, updated_at, version
 		FROM payments
 		WHERE transaction_id = $1`
 
 	var payment Payment
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, transactionID).Scan(
@@ -308,6 +427,7 @@ func (m PaymentModel) GetByTransactionID(transactionID string) (*Payment, error)
 		&payment.Status,
 		&payment.TransactionID,
 		&payment.PaymentDate,
+		&payment.RefundedAmount,
 		&payment.CreatedAt,
 		&payment.UpdatedAt,
 		&payment.Version,
@@ -343,10 +463,16 @@ func (m PaymentModel) Update(payment *Payment) error {
 		payment.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&payment.UpdatedAt, &payment.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&payment.UpdatedAt, &payment.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -356,30 +482,101 @@ func (m PaymentModel) Update(payment *Payment) error {
 		}
 	}
 
-	return nil
+	err = m.accrueIfCompleted(ctx, tx, payment.ID, payment.UserID, payment.Status, payment.Amount)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
+// UpdateStatus sets the payment's status. Completing a payment credits the
+// payer's loyalty points in the same transaction.
 func (m PaymentModel) UpdateStatus(id uuid.UUID, status string, transactionID *string) error {
 	query := `
 		UPDATE payments
 		SET status = $1, transaction_id = $2, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $3`
+		WHERE id = $3
+		RETURNING user_id, amount`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, status, transactionID, id)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
+	var userID uuid.UUID
+	var amount Money
+
+	err = tx.QueryRowContext(ctx, query, status, transactionID, id).Scan(&userID, &amount)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	err = m.accrueIfCompleted(ctx, tx, id, userID, status, amount)
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	return tx.Commit()
+}
+
+// Refund gives back part or all of a completed payment. Refunds accumulate in
+// refunded_amount; once the whole amount has been refunded the payment is marked
+// as refunded. Refunding more than what remains returns ErrInvalidRefund.
+func (m PaymentModel) Refund(payment *Payment, amount Money) error {
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.refundTx(ctx, tx, payment, amount)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// refundTx is Refund within tx.
+func (m PaymentModel) refundTx(ctx context.Context, tx *sql.Tx, payment *Payment, amount Money) error {
+	if !IsRoundedMoney(payment.Currency, amount.Float64()) {
+		return ErrUnroundedAmount
+	}
+
+	query := `
+		UPDATE payments
+		SET refunded_amount = refunded_amount + $1,
+		    status = CASE WHEN refunded_amount + $1 >= amount THEN $2 ELSE status END,
+		    updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $3 AND status = $4 AND refunded_amount + $1 <= amount
+		RETURNING refunded_amount, status, updated_at, version`
+
+	err := tx.QueryRowContext(ctx, query, amount, PaymentStatusRefunded, payment.ID, PaymentStatusCompleted).Scan(
+		&payment.RefundedAmount,
+		&payment.Status,
+		&payment.UpdatedAt,
+		&payment.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrInvalidRefund
+		default:
+			return err
+		}
 	}
 
 	return nil
@@ -388,7 +585,7 @@ func (m PaymentModel) UpdateStatus(id uuid.UUID, status string, transactionID *s
 func (m PaymentModel) Delete(id uuid.UUID) error {
 	query := `DELETE FROM payments WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	result, err := m.DB.ExecContext(ctx, query, id)
@@ -416,7 +613,7 @@ func (m PaymentModel) GetTotalRevenue(startDate, endDate time.Time) (float64, er
 
 	var totalRevenue float64
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.longQueryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, PaymentStatusCompleted, startDate, endDate).Scan(&totalRevenue)
@@ -424,7 +621,7 @@ func (m PaymentModel) GetTotalRevenue(startDate, endDate time.Time) (float64, er
 		return 0, err
 	}
 
-	return totalRevenue, nil
+	return RoundMoney(totalRevenue), nil
 }
 
 func (m PaymentModel) GetRevenueByLot(lotID uuid.UUID, startDate, endDate time.Time) (float64, error) {
@@ -436,7 +633,7 @@ func (m PaymentModel) GetRevenueByLot(lotID uuid.UUID, startDate, endDate time.T
 
 	var totalRevenue float64
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.longQueryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, PaymentStatusCompleted, lotID, startDate, endDate).Scan(&totalRevenue)
@@ -444,5 +641,88 @@ func (m PaymentModel) GetRevenueByLot(lotID uuid.UUID, startDate, endDate time.T
 		return 0, err
 	}
 
-	return totalRevenue, nil
+	return RoundMoney(totalRevenue), nil
+}
+
+// GetTaxCollected sums the tax on the lot's completed payments in the period,
+// as itemized on their reservations. Reservations booked before tax was
+// itemized count as untaxed.
+func (m PaymentModel) GetTaxCollected(lotID uuid.UUID, startDate, endDate time.Time) (float64, error) {
+	query := `
+		SELECT COALESCE(SUM((r.price_breakdown->>'tax')::numeric), 0)
+		FROM payments p
+		INNER JOIN reservations r ON p.reservation_id = r.id
+		WHERE p.status = $1 AND r.parking_lot_id = $2 AND p.payment_date BETWEEN $3 AND $4`
+
+	var taxCollected float64
+
+	ctx, cancel := m.longQueryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, PaymentStatusCompleted, lotID, startDate, endDate).Scan(&taxCollected)
+	if err != nil {
+		return 0, err
+	}
+
+	return RoundMoney(taxCollected), nil
+}
+
+// MemberBilling is one member's share of an organization's spend.
+type MemberBilling struct {
+	UserID       uuid.UUID `json:"user_id"`
+	UserName     string    `json:"username"`
+	PaymentCount int       `json:"payment_count"`
+	Total        float64   `json:"total"`
+}
+
+// OrgBilling totals what an organization's members paid, net of refunds.
+type OrgBilling struct {
+	OrgID        uuid.UUID        `json:"org_id"`
+	PaymentCount int              `json:"payment_count"`
+	Total        float64          `json:"total"`
+	Members      []*MemberBilling `json:"members"`
+}
+
+func (m PaymentModel) GetOrgBilling(orgID uuid.UUID, startDate, endDate time.Time) (*OrgBilling, error) {
+	query := `
+		SELECT u.id, u.user_name, COUNT(p.id), COALESCE(SUM(p.amount - p.refunded_amount), 0)
+		FROM users u
+		LEFT JOIN payments p ON p.user_id = u.id
+			AND p.status IN ($2, $3)
+			AND p.payment_date BETWEEN $4 AND $5
+		WHERE u.org_id = $1
+		GROUP BY u.id, u.user_name
+		ORDER BY u.user_name ASC`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, orgID, PaymentStatusCompleted, PaymentStatusRefunded, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	billing := &OrgBilling{OrgID: orgID, Members: []*MemberBilling{}}
+
+	for rows.Next() {
+		var member MemberBilling
+
+		err := rows.Scan(&member.UserID, &member.UserName, &member.PaymentCount, &member.Total)
+		if err != nil {
+			return nil, err
+		}
+
+		member.Total = RoundMoney(member.Total)
+
+		billing.PaymentCount += member.PaymentCount
+		billing.Total = SumMoney(billing.Total, member.Total)
+		billing.Members = append(billing.Members, &member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return billing, nil
 }
@@ -0,0 +1,152 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// GatewayEvent is a payment status change reported by a payment gateway.
+type GatewayEvent struct {
+	Provider      string
+	EventID       string
+	TransactionID string
+	Status        string
+}
+
+// ApplyGatewayEvent moves the payment with the event's transaction ID to the
+// reported status and reports whether anything changed. The event ID is
+// recorded in the same transaction, so a redelivered event, or one reporting a
+// status the payment already has, changes nothing. Events the payment's
+// current status doesn't allow, e.g. a late "failed" after "completed", return
+// a *TransitionError and are not recorded.
+func (m PaymentModel) ApplyGatewayEvent(event GatewayEvent) (*Payment, bool, error) {
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT id, reservation_id, user_id, amount, currency, payment_method, status, transaction_id, payment_date, refunded_amount, created_at, updated_at, version
+		FROM payments
+		WHERE transaction_id = $1
+		FOR UPDATE`
+
+	var payment Payment
+
+	err = tx.QueryRowContext(ctx, query, event.TransactionID).Scan(
+		&payment.ID,
+		&payment.ReservationID,
+		&payment.UserID,
+		&payment.Amount,
+		&payment.Currency,
+		&payment.PaymentMethod,
+		&payment.Status,
+		&payment.TransactionID,
+		&payment.PaymentDate,
+		&payment.RefundedAmount,
+		&payment.CreatedAt,
+		&payment.UpdatedAt,
+		&payment.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, false, ErrRecordNotFound
+		default:
+			return nil, false, err
+		}
+	}
+
+	query = `
+		INSERT INTO payment_gateway_events (provider, event_id, payment_id, status)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (provider, event_id) DO NOTHING`
+
+	result, err := tx.ExecContext(ctx, query, event.Provider, event.EventID, payment.ID, event.Status)
+	if err != nil {
+		return nil, false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if rowsAffected == 0 || payment.Status == event.Status {
+		return &payment, false, tx.Commit()
+	}
+
+	if !CanTransitionPayment(payment.Status, event.Status) {
+		return &payment, false, &TransitionError{From: payment.Status, To: event.Status}
+	}
+
+	// A refund reported by the gateway covers whatever hasn't been refunded yet
+	query = `
+		UPDATE payments
+		SET status = $1,
+		    refunded_amount = CASE WHEN $1 = 'refunded' THEN amount ELSE refunded_amount END,
+		    updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $2
+		RETURNING status, refunded_amount, updated_at, version`
+
+	err = tx.QueryRowContext(ctx, query, event.Status, payment.ID).Scan(
+		&payment.Status,
+		&payment.RefundedAmount,
+		&payment.UpdatedAt,
+		&payment.Version,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = m.accrueIfCompleted(ctx, tx, payment.ID, payment.UserID, payment.Status, payment.Amount)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &payment, true, nil
+}
+
+// GetParkingLotID returns the lot a payment was made at, through its
+// reservation or, for violation fees, through the session's spot.
+func (m PaymentModel) GetParkingLotID(id uuid.UUID) (uuid.UUID, error) {
+	query := `
+		SELECT COALESCE(r.parking_lot_id, ps.parking_lot_id)
+		FROM payments p
+		LEFT JOIN reservations r ON r.id = p.reservation_id
+		LEFT JOIN parking_sessions s ON s.id = p.violation_session_id
+		LEFT JOIN parking_spots ps ON ps.id = s.parking_spot_id
+		WHERE p.id = $1`
+
+	var lotID uuid.NullUUID
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&lotID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return uuid.Nil, ErrRecordNotFound
+		default:
+			return uuid.Nil, err
+		}
+	}
+
+	if !lotID.Valid {
+		return uuid.Nil, ErrRecordNotFound
+	}
+
+	return lotID.UUID, nil
+}
@@ -0,0 +1,115 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetTaxCollectedSplitsNetAndTax(t *testing.T) {
+	m := newTestModels(t)
+	withCharges(t, 0, 0)
+
+	user := insertTestUser(t, m)
+	vehicle := insertTestVehicle(t, m, user.ID)
+	lot, _ := insertTestLot(t, m, user.ID, 1)
+
+	rate := 0.1
+	lot.TaxRate = &rate
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	book := func(offset time.Duration, status string) {
+		t.Helper()
+
+		reservation := &Reservation{
+			UserID:       user.ID,
+			VehicleID:    vehicle.ID,
+			ParkingLotID: lot.ID,
+			StartTime:    start.Add(offset),
+			EndTime:      start.Add(offset + time.Hour),
+			Status:       ReservationStatusConfirmed,
+			TotalAmount:  lot.PriceFor(start, start.Add(time.Hour)),
+		}
+		reservation.ApplyCharges(lot)
+		if err := m.Reservations.Insert(reservation); err != nil {
+			t.Fatal(err)
+		}
+		insertTestPayment(t, m, reservation, reservation.TotalAmount.Float64(), status)
+	}
+
+	book(0, PaymentStatusCompleted)
+	book(2*time.Hour, PaymentStatusCompleted)
+	book(4*time.Hour, PaymentStatusPending)
+	// Reservations from before tax was itemized count as untaxed.
+	insertTestPayment(t, m, insertTestReservation(t, m, vehicle, lot.ID, nil, start.Add(6*time.Hour), time.Hour), 50, PaymentStatusCompleted)
+
+	from, to := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+
+	revenue, err := m.Payments.GetRevenueByLot(lot.ID, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tax, err := m.Payments.GetTaxCollected(lot.ID, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if revenue != 270 || tax != 20 {
+		t.Errorf("got revenue %v and tax %v; want 270 and 20", revenue, tax)
+	}
+	if net := SumMoney(revenue, -tax); net != 250 {
+		t.Errorf("got net %v; want 250", net)
+	}
+}
+
+func TestGetByStatusFiltersStatusAndDate(t *testing.T) {
+	m := newTestModels(t)
+
+	user := insertTestUser(t, m)
+	lot, spots := insertTestLot(t, m, user.ID, 1)
+	reservation := insertTestReservation(t, m, insertTestVehicle(t, m, user.ID), lot.ID, spots[0], time.Now().Add(time.Hour), time.Hour)
+
+	// Long past dates keep other tests' payments out of the window
+	day := func(d int) time.Time { return time.Date(1999, 3, d, 12, 0, 0, 0, time.UTC) }
+
+	pay := func(date time.Time, status string) *Payment {
+		t.Helper()
+
+		payment := insertTestPayment(t, m, reservation, 10, status)
+		_, err := m.Payments.DB.Exec(`UPDATE payments SET payment_date = $1 WHERE id = $2`, date, payment.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return payment
+	}
+
+	first := pay(day(1), PaymentStatusCompleted)
+	second := pay(day(5), PaymentStatusCompleted)
+	pay(day(5), PaymentStatusPending)
+	pay(day(10), PaymentStatusCompleted)
+	pay(day(1).Add(-time.Hour), PaymentStatusCompleted)
+
+	from := time.Date(1999, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(1999, 3, 10, 0, 0, 0, 0, time.UTC)
+	filters := Filters{Page: 1, PageSize: 20, Sort: "payment_date", SortSafelist: []string{"payment_date"}}
+
+	payments, metadata, err := m.Payments.GetByStatus(PaymentStatusCompleted, &from, &to, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payments) != 2 || metadata.TotalRecords != 2 {
+		t.Fatalf("got %d payments (%d total); want 2", len(payments), metadata.TotalRecords)
+	}
+	if payments[0].ID != first.ID || payments[1].ID != second.ID {
+		t.Errorf("got payments %s, %s; want %s, %s", payments[0].ID, payments[1].ID, first.ID, second.ID)
+	}
+
+	// Any status in the window, a page at a time
+	filters.PageSize = 2
+	payments, metadata, err = m.Payments.GetByStatus("", &from, &to, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payments) != 2 || metadata.TotalRecords != 3 || metadata.LastPage != 2 {
+		t.Errorf("got %d payments (%d total, last page %d); want 2 of 3 over 2 pages", len(payments), metadata.TotalRecords, metadata.LastPage)
+	}
+}
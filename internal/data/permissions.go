@@ -1,9 +1,7 @@
 package data
 
 import (
-	"context"
 	"database/sql"
-	"time"
 
 	"github.com/google/uuid"
 	"github.com/lib/pq"
@@ -22,6 +20,7 @@ func (p Permissions)  Include(code string) bool {
 
 type PermissionModel struct {
 	DB *sql.DB
+	queryScope
 }
 
 func (m PermissionModel) GetAllForUser(userID uuid.UUID) (Permissions, error) {
@@ -32,7 +31,7 @@ func (m PermissionModel) GetAllForUser(userID uuid.UUID) (Permissions, error) {
 		INNER JOIN users ON users_permissions.user_id = users.id
 		WHERE users.id = $1
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	rows, err := m.DB.QueryContext(ctx, query, userID)
@@ -42,7 +41,7 @@ func (m PermissionModel) GetAllForUser(userID uuid.UUID) (Permissions, error) {
 	}
 	defer rows.Close()
 
-	var permissions Permissions
+	permissions := Permissions{}
 
 	for rows.Next() {
 		var permission string
@@ -68,7 +67,7 @@ func (m PermissionModel) AddForUser(userID uuid.UUID, codes ...string) error {
 		WHERE permissions.code = ANY($2)
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 
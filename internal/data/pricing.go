@@ -0,0 +1,392 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// MinRefundableMinutes is the smallest amount of unused booked time that is
+// worth refunding when a driver checks out early.
+const MinRefundableMinutes = 15
+
+// DefaultTaxRate and ServiceFee are added on top of every paid booking. Both
+// are set once at startup; DefaultTaxRate is a fraction, so 0.08 is 8%.
+var (
+	DefaultTaxRate float64
+	ServiceFee     float64
+)
+
+// PerMinuteRate is the lot's hourly rate spread over the minutes of an hour.
+func (lot *ParkingLot) PerMinuteRate() float64 {
+	return lot.HourlyRate.Float64() / 60
+}
+
+// TopUpPrice is the cost of prepaying extra minutes in an active session.
+// Top-ups are billed by the minute rather than per started hour.
+func (lot *ParkingLot) TopUpPrice(minutes int) float64 {
+	return RoundMoney(float64(minutes) * lot.PerMinuteRate())
+}
+
+// PriceFor returns the cost of parking in the lot from start to end. Time is
+// billed per started hour, and each full day is capped at the daily rate when
+// the lot has one.
+func (lot *ParkingLot) PriceFor(start, end time.Time) Money {
+	if !end.After(start) {
+		return 0
+	}
+
+	duration := end.Sub(start)
+	days := int(duration / (24 * time.Hour))
+	hours := int(math.Ceil((duration - time.Duration(days)*24*time.Hour).Hours()))
+
+	dayPrice := 24 * lot.HourlyRate
+	if lot.DailyRate != nil && *lot.DailyRate < dayPrice {
+		dayPrice = *lot.DailyRate
+	}
+
+	remainder := Money(hours) * lot.HourlyRate
+	if remainder > dayPrice {
+		remainder = dayPrice
+	}
+
+	return Money(days)*dayPrice + remainder
+}
+
+// VehicleTypeMultipliers scales a lot's prices by vehicle type, e.g. 1.5 for
+// trucks and 0.7 for motorcycles. Types that aren't listed pay the normal price.
+type VehicleTypeMultipliers map[string]float64
+
+// MaxVehicleTypeMultiplier is the largest multiplier a lot may charge.
+const MaxVehicleTypeMultiplier = 10
+
+func ValidateVehicleTypeMultipliers(v *validator.Validator, multipliers VehicleTypeMultipliers) {
+	// Sorted so the reported error doesn't depend on map order
+	vehicleTypes := make([]string, 0, len(multipliers))
+	for vehicleType := range multipliers {
+		vehicleTypes = append(vehicleTypes, vehicleType)
+	}
+	slices.Sort(vehicleTypes)
+
+	for _, vehicleType := range vehicleTypes {
+		multiplier := multipliers[vehicleType]
+		v.Check(validator.PermittedValue(vehicleType, VehicleTypes...), "vehicle_type_multipliers", fmt.Sprintf("%q is not a valid vehicle type", vehicleType))
+		v.Check(multiplier > 0, "vehicle_type_multipliers", fmt.Sprintf("multiplier for %s must be greater than zero", vehicleType))
+		v.Check(multiplier <= MaxVehicleTypeMultiplier, "vehicle_type_multipliers", fmt.Sprintf("multiplier for %s must not exceed %d", vehicleType, MaxVehicleTypeMultiplier))
+	}
+}
+
+// Value stores the multipliers as a JSON object; nil is stored as {}.
+func (m VehicleTypeMultipliers) Value() (driver.Value, error) {
+	if m == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(map[string]float64(m))
+}
+
+// Scan reads multipliers stored as JSON.
+func (m *VehicleTypeMultipliers) Scan(src any) error {
+	source, ok := src.([]byte)
+	if !ok {
+		return errors.New("vehicle type multipliers must be stored as JSON")
+	}
+	return json.Unmarshal(source, m)
+}
+
+// VehicleMultiplier is what the lot multiplies prices by for the vehicle type.
+func (lot *ParkingLot) VehicleMultiplier(vehicleType string) float64 {
+	if multiplier, ok := lot.VehicleTypeMultipliers[vehicleType]; ok {
+		return multiplier
+	}
+	return 1
+}
+
+// VehicleRate is a vehicle type multiplier applied to a booking. Adjustment is
+// the amount it added to the base price, negative for multipliers below 1.
+type VehicleRate struct {
+	VehicleType string  `json:"vehicle_type"`
+	Multiplier  float64 `json:"multiplier"`
+	Adjustment  float64 `json:"adjustment"`
+}
+
+// vehicleRate prices base for the vehicle type. It returns nil when the lot
+// charges the type the normal price.
+func (lot *ParkingLot) vehicleRate(vehicleType string, base float64) *VehicleRate {
+	multiplier := lot.VehicleMultiplier(vehicleType)
+	if multiplier == 1 {
+		return nil
+	}
+
+	return &VehicleRate{
+		VehicleType: vehicleType,
+		Multiplier:  multiplier,
+		Adjustment:  SumMoney(base*multiplier, -base),
+	}
+}
+
+// ClosingFee is what a session ended by the lot closing at t owes. Sessions
+// for a reservation owe the booked amount; walk-ins owe the time parked or what
+// they prepaid, whichever is more.
+func (lot *ParkingLot) ClosingFee(session *ParkingSession, bookedAmount *float64, t time.Time) float64 {
+	if bookedAmount != nil {
+		return *bookedAmount
+	}
+	return math.Max(lot.PriceFor(session.CheckInTime, t).Float64(), session.PrepaidAmount)
+}
+
+// EarlyCheckoutRefund works out how much of the paid amount to give back when a
+// driver leaves before the booked end time. Non-refundable lots, and unused
+// time shorter than MinRefundableMinutes, produce no refund. The refund never
+// exceeds what is still refundable on the payment.
+func (lot *ParkingLot) EarlyCheckoutRefund(bookedEnd, actualEnd time.Time, refundable Money) Money {
+	if !lot.IsRefundable || !actualEnd.Before(bookedEnd) {
+		return 0
+	}
+
+	unusedMinutes := math.Floor(bookedEnd.Sub(actualEnd).Minutes())
+	if unusedMinutes < MinRefundableMinutes {
+		return 0
+	}
+
+	return min(MoneyFromFloat(unusedMinutes*lot.PerMinuteRate()), refundable)
+}
+
+// PriceBreakdown itemizes what a booking costs. Tax is charged on the base
+// after the vehicle type and surge adjustments and discounts; the service fee
+// is not taxed. Total is the sum of the other amounts. Breakdowns stored
+// before vehicle type pricing have no multiplier.
+type PriceBreakdown struct {
+	Base              float64 `json:"base"`
+	VehicleMultiplier float64 `json:"vehicle_multiplier,omitempty"`
+	VehicleAdjustment float64 `json:"vehicle_adjustment"`
+	SurgeAdjustment   float64 `json:"surge_adjustment"`
+	Discount          float64 `json:"discount"`
+	TaxRate           float64 `json:"tax_rate"`
+	Tax               float64 `json:"tax"`
+	ServiceFee        float64 `json:"service_fee"`
+	Total             float64 `json:"total"`
+}
+
+func BuildPriceBreakdown(base, vehicleAdjustment, surgeAdjustment, discount, taxRate, serviceFee float64) PriceBreakdown {
+	taxable := math.Max(SumMoney(base, vehicleAdjustment, surgeAdjustment, -discount), 0)
+	tax := RoundMoney(taxable * taxRate)
+
+	return PriceBreakdown{
+		Base:              RoundMoney(base),
+		VehicleMultiplier: 1,
+		VehicleAdjustment: RoundMoney(vehicleAdjustment),
+		SurgeAdjustment:   RoundMoney(surgeAdjustment),
+		Discount:          RoundMoney(discount),
+		TaxRate:           taxRate,
+		Tax:               tax,
+		ServiceFee:        RoundMoney(serviceFee),
+		Total:             SumMoney(taxable, tax, serviceFee),
+	}
+}
+
+// chargesFor itemizes an amount that already has discount taken off and
+// includes any vehicle type adjustment. Free bookings carry no service fee.
+func chargesFor(amount, discount float64, vehicle *VehicleRate, taxRate float64) PriceBreakdown {
+	priced := SumMoney(amount, discount)
+
+	fee := ServiceFee
+	if priced == 0 {
+		fee = 0
+	}
+
+	if vehicle == nil {
+		return BuildPriceBreakdown(priced, 0, 0, discount, taxRate, fee)
+	}
+
+	breakdown := BuildPriceBreakdown(SumMoney(priced, -vehicle.Adjustment), vehicle.Adjustment, 0, discount, taxRate, fee)
+	breakdown.VehicleMultiplier = vehicle.Multiplier
+	return breakdown
+}
+
+// Value stores the breakdown as JSON.
+func (b PriceBreakdown) Value() (driver.Value, error) {
+	return json.Marshal(b)
+}
+
+// Scan reads a breakdown stored as JSON.
+func (b *PriceBreakdown) Scan(src any) error {
+	source, ok := src.([]byte)
+	if !ok {
+		return errors.New("price breakdown must be stored as JSON")
+	}
+	return json.Unmarshal(source, b)
+}
+
+// EffectiveTaxRate is the rate charged on bookings in the lot: its own rate
+// when it has one, DefaultTaxRate otherwise.
+func (lot *ParkingLot) EffectiveTaxRate() float64 {
+	if lot.TaxRate != nil {
+		return *lot.TaxRate
+	}
+	return DefaultTaxRate
+}
+
+// PricingInfo lists the rates a lot charges, before tax. Daily and monthly
+// rates are optional; when a lot has none they are null and marked unavailable.
+type PricingInfo struct {
+	ParkingLotID         uuid.UUID `json:"parking_lot_id"`
+	HourlyRate           Money     `json:"hourly_rate"`
+	DailyRate            *Money    `json:"daily_rate"`
+	DailyRateAvailable   bool      `json:"daily_rate_available"`
+	MonthlyRate          *Money    `json:"monthly_rate"`
+	MonthlyRateAvailable bool      `json:"monthly_rate_available"`
+	EffectiveHourlyRate  Money     `json:"effective_hourly_rate"`
+	EffectiveDailyRate   Money     `json:"effective_daily_rate"`
+	TaxRate              float64   `json:"tax_rate"`
+	// VehicleTypeMultipliers scale every rate for the listed vehicle types
+	VehicleTypeMultipliers VehicleTypeMultipliers `json:"vehicle_type_multipliers"`
+	Promo                  *PricingPromo          `json:"promo,omitempty"`
+}
+
+// PricingPromo describes a promo code shown alongside a lot's rates.
+type PricingPromo struct {
+	Code          string  `json:"code"`
+	DiscountType  string  `json:"discount_type"`
+	DiscountValue float64 `json:"discount_value"`
+}
+
+// Pricing returns the lot's rates. Lots have no surge pricing, so the
+// effective hourly rate is the hourly rate; the effective daily rate is the
+// most a full day costs, which is the daily rate when it beats 24 hours.
+func (lot *ParkingLot) Pricing() PricingInfo {
+	pricing := PricingInfo{
+		ParkingLotID:           lot.ID,
+		HourlyRate:             lot.HourlyRate,
+		DailyRate:              lot.DailyRate,
+		DailyRateAvailable:     lot.DailyRate != nil,
+		MonthlyRate:            lot.MonthlyRate,
+		MonthlyRateAvailable:   lot.MonthlyRate != nil,
+		EffectiveHourlyRate:    lot.HourlyRate,
+		TaxRate:                lot.EffectiveTaxRate(),
+		VehicleTypeMultipliers: lot.VehicleTypeMultipliers,
+	}
+
+	pricing.EffectiveDailyRate = 24 * lot.HourlyRate
+	if lot.DailyRate != nil && *lot.DailyRate < pricing.EffectiveDailyRate {
+		pricing.EffectiveDailyRate = *lot.DailyRate
+	}
+
+	return pricing
+}
+
+// ApplyPromo attaches the promo code and takes its discount off the effective
+// rates. Flat discounts are per booking, so they only show up in the promo.
+func (p *PricingInfo) ApplyPromo(promo *PromoCode) {
+	p.Promo = &PricingPromo{
+		Code:          promo.Code,
+		DiscountType:  promo.DiscountType,
+		DiscountValue: promo.DiscountValue,
+	}
+
+	if promo.DiscountType == DiscountTypePercent {
+		p.EffectiveHourlyRate -= MoneyFromFloat(promo.Discount(p.EffectiveHourlyRate.Float64()))
+		p.EffectiveDailyRate -= MoneyFromFloat(promo.Discount(p.EffectiveDailyRate.Float64()))
+	}
+}
+
+// Quote is the price of parking in a lot for a given window.
+type Quote struct {
+	ParkingLotID uuid.UUID        `json:"parking_lot_id"`
+	StartTime    time.Time        `json:"start_time"`
+	EndTime      time.Time        `json:"end_time"`
+	TotalAmount  Money            `json:"total_amount"`
+	VehicleType  string           `json:"vehicle_type,omitempty"`
+	Vehicle      *VehicleRate     `json:"vehicle_rate,omitempty"`
+	Promo        *PromoRedemption `json:"promo,omitempty"`
+	Breakdown    *PriceBreakdown  `json:"price_breakdown,omitempty"`
+}
+
+func (lot *ParkingLot) Quote(start, end time.Time) *Quote {
+	return &Quote{
+		ParkingLotID: lot.ID,
+		StartTime:    start,
+		EndTime:      end,
+		TotalAmount:  lot.PriceFor(start, end),
+	}
+}
+
+// ApplyVehicleType prices the quote for the vehicle type. Call it before any
+// discounts.
+func (q *Quote) ApplyVehicleType(lot *ParkingLot, vehicleType string) {
+	q.VehicleType = vehicleType
+	q.Vehicle = lot.vehicleRate(vehicleType, q.TotalAmount.Float64())
+	if q.Vehicle != nil {
+		q.TotalAmount += MoneyFromFloat(q.Vehicle.Adjustment)
+	}
+}
+
+// ApplyPromo takes the promo code's discount off the quoted amount.
+func (q *Quote) ApplyPromo(promo *PromoCode) {
+	q.Promo = promo.Apply(q.TotalAmount.Float64())
+	q.TotalAmount -= MoneyFromFloat(q.Promo.Discount)
+}
+
+// ApplyCharges adds the lot's tax and the service fee to the quoted amount and
+// itemizes it. Call it after any discounts.
+func (q *Quote) ApplyCharges(lot *ParkingLot) {
+	var discount float64
+	if q.Promo != nil {
+		discount = q.Promo.Discount
+	}
+
+	breakdown := chargesFor(q.TotalAmount.Float64(), discount, q.Vehicle, lot.EffectiveTaxRate())
+	q.Breakdown = &breakdown
+	q.TotalAmount = MoneyFromFloat(breakdown.Total)
+}
+
+// ApplyVehicleType prices the reservation for its vehicle's type. Call it
+// before any promo code or points.
+func (r *Reservation) ApplyVehicleType(lot *ParkingLot, vehicleType string) {
+	r.Vehicle = lot.vehicleRate(vehicleType, r.TotalAmount.Float64())
+	if r.Vehicle != nil {
+		r.TotalAmount += MoneyFromFloat(r.Vehicle.Adjustment)
+	}
+}
+
+// ApplyPromo takes the promo code's discount off the reservation's amount. The
+// code is redeemed when the reservation is inserted.
+func (r *Reservation) ApplyPromo(promo *PromoCode) {
+	r.Promo = promo.Apply(r.TotalAmount.Float64())
+	r.TotalAmount -= MoneyFromFloat(r.Promo.Discount)
+}
+
+// ApplyPoints spends up to points on the reservation's amount, never more than
+// the amount left after any promo discount. The points are deducted when the
+// reservation is inserted.
+func (r *Reservation) ApplyPoints(points int) {
+	points = RedeemablePoints(points, r.TotalAmount.Float64())
+	if points <= 0 {
+		return
+	}
+
+	r.Points = &PointsRedemption{Points: points, Discount: PointsDiscount(points)}
+	r.TotalAmount -= MoneyFromFloat(r.Points.Discount)
+}
+
+// ApplyCharges adds the lot's tax and the service fee to the reservation's
+// amount and itemizes it. Call it after any promo code or points.
+func (r *Reservation) ApplyCharges(lot *ParkingLot) {
+	var discount float64
+	if r.Promo != nil {
+		discount = SumMoney(discount, r.Promo.Discount)
+	}
+	if r.Points != nil {
+		discount = SumMoney(discount, r.Points.Discount)
+	}
+
+	breakdown := chargesFor(r.TotalAmount.Float64(), discount, r.Vehicle, lot.EffectiveTaxRate())
+	r.Breakdown = &breakdown
+	r.TotalAmount = MoneyFromFloat(breakdown.Total)
+}
@@ -0,0 +1,391 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+func TestEarlyCheckoutRefund(t *testing.T) {
+	bookedEnd := time.Date(2025, 3, 10, 18, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		refundable bool
+		actualEnd  time.Time
+		paid       Money
+		want       Money
+	}{
+		{"an hour early", true, bookedEnd.Add(-time.Hour), MoneyFromFloat(360), MoneyFromFloat(120)},
+		{"ninety minutes and some seconds early", true, bookedEnd.Add(-90*time.Minute - 40*time.Second), MoneyFromFloat(360), MoneyFromFloat(180)},
+		{"just under the minimum", true, bookedEnd.Add(-(MinRefundableMinutes - 1) * time.Minute), MoneyFromFloat(360), 0},
+		{"exactly the minimum", true, bookedEnd.Add(-MinRefundableMinutes * time.Minute), MoneyFromFloat(360), MoneyFromFloat(30)},
+		{"capped at what is still refundable", true, bookedEnd.Add(-3 * time.Hour), MoneyFromFloat(100), MoneyFromFloat(100)},
+		{"on time", true, bookedEnd, MoneyFromFloat(360), 0},
+		{"late", true, bookedEnd.Add(time.Hour), MoneyFromFloat(360), 0},
+		{"non-refundable lot", false, bookedEnd.Add(-time.Hour), MoneyFromFloat(360), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lot := &ParkingLot{HourlyRate: MoneyFromFloat(120), IsRefundable: tt.refundable}
+
+			got := lot.EarlyCheckoutRefund(bookedEnd, tt.actualEnd, tt.paid)
+			if got != tt.want {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTopUpPrice(t *testing.T) {
+	lot := &ParkingLot{HourlyRate: MoneyFromFloat(100)}
+
+	for minutes, want := range map[int]float64{0: 0, 1: 1.67, 30: 50, 60: 100, 90: 150} {
+		if got := lot.TopUpPrice(minutes); got != want {
+			t.Errorf("%d minutes: got %v; want %v", minutes, got, want)
+		}
+	}
+}
+
+func TestPricingOptionalRates(t *testing.T) {
+	daily, monthly := MoneyFromFloat(1000), MoneyFromFloat(20000)
+
+	tests := []struct {
+		name           string
+		lot            ParkingLot
+		dailyAvailable bool
+		effectiveDaily Money
+	}{
+		{"hourly only", ParkingLot{HourlyRate: MoneyFromFloat(100)}, false, MoneyFromFloat(2400)},
+		{"daily beats 24 hours", ParkingLot{HourlyRate: MoneyFromFloat(100), DailyRate: &daily, MonthlyRate: &monthly}, true, daily},
+		{"24 hours beats daily", ParkingLot{HourlyRate: MoneyFromFloat(10), DailyRate: &daily}, true, MoneyFromFloat(240)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pricing := tt.lot.Pricing()
+
+			if pricing.DailyRateAvailable != tt.dailyAvailable {
+				t.Errorf("daily_rate_available = %t; want %t", pricing.DailyRateAvailable, tt.dailyAvailable)
+			}
+			if pricing.MonthlyRateAvailable != (tt.lot.MonthlyRate != nil) {
+				t.Errorf("monthly_rate_available = %t; want %t", pricing.MonthlyRateAvailable, tt.lot.MonthlyRate != nil)
+			}
+			if pricing.EffectiveDailyRate != tt.effectiveDaily {
+				t.Errorf("effective daily rate = %v; want %v", pricing.EffectiveDailyRate, tt.effectiveDaily)
+			}
+
+			js, err := json.Marshal(pricing)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got map[string]any
+			if err := json.Unmarshal(js, &got); err != nil {
+				t.Fatal(err)
+			}
+			for _, field := range []string{"daily_rate", "monthly_rate"} {
+				value, present := got[field]
+				if !present {
+					t.Errorf("%s missing from %s", field, js)
+				}
+				available := got[field+"_available"].(bool)
+				if (value == nil) == available {
+					t.Errorf("%s is %v but %s_available is %t", field, value, field, available)
+				}
+			}
+		})
+	}
+}
+
+func TestPricingApplyPromo(t *testing.T) {
+	lot := ParkingLot{HourlyRate: MoneyFromFloat(100)}
+
+	pricing := lot.Pricing()
+	pricing.ApplyPromo(&PromoCode{Code: "HALF", DiscountType: DiscountTypePercent, DiscountValue: 50})
+	if pricing.EffectiveHourlyRate != MoneyFromFloat(50) || pricing.EffectiveDailyRate != MoneyFromFloat(1200) {
+		t.Errorf("percent: got effective rates %v and %v; want 50 and 1200", pricing.EffectiveHourlyRate, pricing.EffectiveDailyRate)
+	}
+	if pricing.HourlyRate != MoneyFromFloat(100) {
+		t.Errorf("percent: hourly rate changed to %v", pricing.HourlyRate)
+	}
+
+	pricing = lot.Pricing()
+	pricing.ApplyPromo(&PromoCode{Code: "FLAT", DiscountType: DiscountTypeFlat, DiscountValue: 20})
+	if pricing.EffectiveHourlyRate != MoneyFromFloat(100) || pricing.Promo == nil || pricing.Promo.Code != "FLAT" {
+		t.Errorf("flat: got effective hourly rate %v and promo %+v; want 100 and the code listed", pricing.EffectiveHourlyRate, pricing.Promo)
+	}
+}
+
+// withCharges sets DefaultTaxRate and ServiceFee for the rest of the test.
+func withCharges(t *testing.T, taxRate, serviceFee float64) {
+	t.Helper()
+
+	previousTax, previousFee := DefaultTaxRate, ServiceFee
+	DefaultTaxRate, ServiceFee = taxRate, serviceFee
+	t.Cleanup(func() { DefaultTaxRate, ServiceFee = previousTax, previousFee })
+}
+
+func TestBuildPriceBreakdownSumsToTotal(t *testing.T) {
+	tests := []struct {
+		name                                     string
+		base, vehicle, surge, discount, tax, fee float64
+		wantTax, wantTotal                       float64
+	}{
+		{"base only", 100, 0, 0, 0, 0, 0, 0, 100},
+		{"tax and fee", 100, 0, 0, 0, 0.08, 2.5, 8, 110.5},
+		{"discount before tax", 100, 0, 0, 20, 0.1, 1, 8, 89},
+		{"vehicle and surge", 100, 50, 10, 0, 0.15, 0, 24, 184},
+		{"tax rounds to cents", 33.33, 0, 0, 0, 0.075, 0, 2.5, 35.83},
+		{"discount larger than price", 10, 0, 0, 15, 0.1, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := BuildPriceBreakdown(tt.base, tt.vehicle, tt.surge, tt.discount, tt.tax, tt.fee)
+
+			if b.Tax != tt.wantTax || b.Total != tt.wantTotal {
+				t.Errorf("got tax %v, total %v; want %v and %v", b.Tax, b.Total, tt.wantTax, tt.wantTotal)
+			}
+
+			sum := SumMoney(b.Base, b.VehicleAdjustment, b.SurgeAdjustment, -b.Discount, b.Tax, b.ServiceFee)
+			if tt.discount <= SumMoney(tt.base, tt.vehicle, tt.surge) && sum != b.Total {
+				t.Errorf("components %+v sum to %v; total is %v", b, sum, b.Total)
+			}
+		})
+	}
+}
+
+func TestQuoteApplyCharges(t *testing.T) {
+	withCharges(t, 0.1, 2)
+
+	lot := &ParkingLot{HourlyRate: MoneyFromFloat(100)}
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	q := lot.Quote(start, start.Add(2*time.Hour))
+	q.ApplyPromo(&PromoCode{Code: "TENOFF", DiscountType: DiscountTypePercent, DiscountValue: 10})
+	q.ApplyCharges(lot)
+
+	b := q.Breakdown
+	if b == nil {
+		t.Fatal("no breakdown")
+	}
+	if b.Base != 200 || b.Discount != 20 || b.Tax != 18 || b.ServiceFee != 2 || b.Total != 200 {
+		t.Errorf("got %+v; want base 200, discount 20, tax 18, fee 2 and total 200", *b)
+	}
+	if q.TotalAmount != MoneyFromFloat(b.Total) {
+		t.Errorf("quote total %v doesn't match breakdown total %v", q.TotalAmount, b.Total)
+	}
+
+	// Free parking carries no service fee.
+	free := &ParkingLot{}
+	q = free.Quote(start, start.Add(2*time.Hour))
+	q.ApplyCharges(free)
+	if q.TotalAmount != 0 || q.Breakdown.ServiceFee != 0 {
+		t.Errorf("free booking: got total %v and fee %v; want 0", q.TotalAmount, q.Breakdown.ServiceFee)
+	}
+}
+
+func TestReservationStoresPriceBreakdown(t *testing.T) {
+	m := newTestModels(t)
+	withCharges(t, 0.08, 1.5)
+
+	user := insertTestUser(t, m)
+	vehicle := insertTestVehicle(t, m, user.ID)
+	lot, spots := insertTestLot(t, m, user.ID, 1)
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	reservation := &Reservation{
+		UserID:        user.ID,
+		VehicleID:     vehicle.ID,
+		ParkingLotID:  lot.ID,
+		ParkingSpotID: &spots[0].ID,
+		StartTime:     start,
+		EndTime:       start.Add(time.Hour),
+		Status:        ReservationStatusConfirmed,
+		TotalAmount:   lot.PriceFor(start, start.Add(time.Hour)),
+	}
+	reservation.ApplyCharges(lot)
+	if err := m.Reservations.Insert(reservation); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := m.Reservations.Get(reservation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Breakdown == nil || *got.Breakdown != *reservation.Breakdown {
+		t.Fatalf("got breakdown %+v; want %+v", got.Breakdown, reservation.Breakdown)
+	}
+	if got.TotalAmount != MoneyFromFloat(109.5) || got.Breakdown.Total != 109.5 {
+		t.Errorf("got total %v and breakdown total %v; want 109.5", got.TotalAmount, got.Breakdown.Total)
+	}
+
+	// Reservations without a breakdown read back without one.
+	plain := insertTestReservation(t, m, vehicle, lot.ID, nil, start.Add(2*time.Hour), time.Hour)
+	got, err = m.Reservations.Get(plain.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Breakdown != nil {
+		t.Errorf("got breakdown %+v; want none", *got.Breakdown)
+	}
+}
+
+func TestLotTaxRate(t *testing.T) {
+	withCharges(t, 0.05, 0)
+
+	rate := 0.15
+	zero := 0.0
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		taxRate *float64
+		want    float64
+		tax     float64
+	}{
+		{"default rate", nil, 0.05, 5},
+		{"lot rate", &rate, 0.15, 15},
+		{"tax free lot", &zero, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lot := &ParkingLot{HourlyRate: MoneyFromFloat(100), TaxRate: tt.taxRate}
+			if got := lot.EffectiveTaxRate(); got != tt.want {
+				t.Errorf("EffectiveTaxRate() = %v; want %v", got, tt.want)
+			}
+
+			r := &Reservation{TotalAmount: lot.PriceFor(start, start.Add(time.Hour))}
+			r.ApplyCharges(lot)
+			if r.Breakdown.TaxRate != tt.want || r.Breakdown.Tax != tt.tax {
+				t.Errorf("got tax %v at %v; want %v at %v", r.Breakdown.Tax, r.Breakdown.TaxRate, tt.tax, tt.want)
+			}
+			if r.TotalAmount != MoneyFromFloat(100+tt.tax) {
+				t.Errorf("got total %v; want %v", r.TotalAmount, 100+tt.tax)
+			}
+		})
+	}
+}
+
+func TestValidateTaxRate(t *testing.T) {
+	for _, rate := range []float64{-0.01, 1.01} {
+		v := validator.New()
+		ValidateParkingLot(v, &ParkingLot{TaxRate: &rate})
+		if _, ok := v.Errors["tax_rate"]; !ok {
+			t.Errorf("tax rate %v: no tax_rate error", rate)
+		}
+	}
+	for _, rate := range []float64{0, 0.5, 1} {
+		v := validator.New()
+		ValidateParkingLot(v, &ParkingLot{TaxRate: &rate})
+		if msg, ok := v.Errors["tax_rate"]; ok {
+			t.Errorf("tax rate %v: got error %q", rate, msg)
+		}
+	}
+}
+
+func TestVehicleTypeMultipliersInQuote(t *testing.T) {
+	withCharges(t, 0.1, 0)
+
+	lot := &ParkingLot{
+		HourlyRate:             MoneyFromFloat(100),
+		VehicleTypeMultipliers: VehicleTypeMultipliers{VehicleTypeTruck: 1.5, VehicleTypeMotorcycle: 0.7},
+	}
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		vehicleType    string
+		wantMultiplier float64
+		wantAdjustment float64
+		wantTotal      Money
+	}{
+		{VehicleTypeCar, 1, 0, MoneyFromFloat(220)},
+		{VehicleTypeTruck, 1.5, 100, MoneyFromFloat(330)},
+		{VehicleTypeMotorcycle, 0.7, -60, MoneyFromFloat(154)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.vehicleType, func(t *testing.T) {
+			q := lot.Quote(start, start.Add(2*time.Hour))
+			q.ApplyVehicleType(lot, tt.vehicleType)
+			q.ApplyCharges(lot)
+
+			if tt.wantMultiplier == 1 && q.Vehicle != nil {
+				t.Errorf("unlisted vehicle type got a rate: %+v", q.Vehicle)
+			}
+			b := q.Breakdown
+			if b.Base != 200 || b.VehicleMultiplier != tt.wantMultiplier || b.VehicleAdjustment != tt.wantAdjustment {
+				t.Errorf("got base %v, multiplier %v, adjustment %v; want 200, %v, %v", b.Base, b.VehicleMultiplier, b.VehicleAdjustment, tt.wantMultiplier, tt.wantAdjustment)
+			}
+			if q.TotalAmount != tt.wantTotal || MoneyFromFloat(b.Total) != tt.wantTotal {
+				t.Errorf("got total %v (breakdown %v); want %v", q.TotalAmount, b.Total, tt.wantTotal)
+			}
+		})
+	}
+
+	// Discounts come off the adjusted price
+	q := lot.Quote(start, start.Add(2*time.Hour))
+	q.ApplyVehicleType(lot, VehicleTypeTruck)
+	q.ApplyPromo(&PromoCode{Code: "TENOFF", DiscountType: DiscountTypePercent, DiscountValue: 10})
+	q.ApplyCharges(lot)
+	if q.Promo.Discount != 30 || q.TotalAmount != MoneyFromFloat(297) {
+		t.Errorf("truck with 10%% off: got discount %v and total %v; want 30 and 297", q.Promo.Discount, q.TotalAmount)
+	}
+}
+
+func TestValidateVehicleTypeMultipliers(t *testing.T) {
+	invalid := []VehicleTypeMultipliers{
+		{VehicleTypeTruck: 0},
+		{VehicleTypeTruck: -1},
+		{VehicleTypeTruck: MaxVehicleTypeMultiplier + 0.5},
+		{"spaceship": 2},
+	}
+	for _, multipliers := range invalid {
+		v := validator.New()
+		ValidateVehicleTypeMultipliers(v, multipliers)
+		if _, ok := v.Errors["vehicle_type_multipliers"]; !ok {
+			t.Errorf("%v: no vehicle_type_multipliers error", multipliers)
+		}
+	}
+
+	v := validator.New()
+	ValidateVehicleTypeMultipliers(v, VehicleTypeMultipliers{VehicleTypeTruck: 1.5, VehicleTypeMotorcycle: 0.7})
+	if !v.Valid() {
+		t.Errorf("valid multipliers rejected: %v", v.Errors)
+	}
+}
+
+func TestVehicleTypeMultipliersStorage(t *testing.T) {
+	var none VehicleTypeMultipliers
+	value, err := none.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value.([]byte)) != "{}" {
+		t.Errorf("nil multipliers stored as %s; want {}", value)
+	}
+
+	stored := VehicleTypeMultipliers{VehicleTypeTruck: 1.5}
+	value, err = stored.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var read VehicleTypeMultipliers
+	if err := read.Scan(value); err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 1 || read[VehicleTypeTruck] != 1.5 {
+		t.Errorf("read back %v; want %v", read, stored)
+	}
+
+	lot := &ParkingLot{VehicleTypeMultipliers: read}
+	if lot.VehicleMultiplier(VehicleTypeTruck) != 1.5 || lot.VehicleMultiplier(VehicleTypeCar) != 1 {
+		t.Errorf("VehicleMultiplier: truck %v, car %v; want 1.5 and 1", lot.VehicleMultiplier(VehicleTypeTruck), lot.VehicleMultiplier(VehicleTypeCar))
+	}
+}
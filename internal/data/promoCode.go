@@ -0,0 +1,288 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+const (
+	DiscountTypePercent = "percent"
+	DiscountTypeFlat    = "flat"
+)
+
+var (
+	ErrPromoCodeInvalid     = errors.New("promo code is not valid")
+	ErrPromoCodeNotYetValid = errors.New("promo code is not valid yet")
+	ErrPromoCodeExpired     = errors.New("promo code has expired")
+	ErrPromoCodeExhausted   = errors.New("promo code has reached its usage limit")
+	ErrDuplicatePromoCode   = errors.New("duplicate promo code")
+)
+
+type PromoCode struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	Code          string     `json:"code" db:"code"`
+	DiscountType  string     `json:"discount_type" db:"discount_type"`
+	DiscountValue float64    `json:"discount_value" db:"discount_value"`
+	ValidFrom     time.Time  `json:"valid_from" db:"valid_from"`
+	ValidUntil    *time.Time `json:"valid_until" db:"valid_until"`
+	MaxUses       *int       `json:"max_uses" db:"max_uses"`
+	UsedCount     int        `json:"used_count" db:"used_count"`
+	IsActive      bool       `json:"is_active" db:"is_active"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	Version       int        `json:"version" db:"version"`
+}
+
+// PromoRedemption is the promo code applied to a reservation at booking time.
+type PromoRedemption struct {
+	PromoCodeID uuid.UUID `json:"promo_code_id"`
+	Code        string    `json:"code"`
+	Discount    float64   `json:"discount"`
+}
+
+// NormalizePromoCode makes codes case-insensitive.
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func ValidatePromoCode(v *validator.Validator, promo *PromoCode) {
+	v.Check(promo.Code != "", "code", "must be provided")
+	v.Check(len(promo.Code) <= 50, "code", "must not be more than 50 characters long")
+
+	v.Check(validator.PermittedValue(promo.DiscountType, DiscountTypePercent, DiscountTypeFlat), "discount_type", "must be percent or flat")
+	v.Check(promo.DiscountValue > 0, "discount_value", "must be greater than zero")
+	if promo.DiscountType == DiscountTypePercent {
+		v.Check(promo.DiscountValue <= 100, "discount_value", "must not be more than 100 percent")
+	}
+
+	if promo.ValidUntil != nil {
+		v.Check(promo.ValidUntil.After(promo.ValidFrom), "valid_until", "must be after valid_from")
+	}
+	if promo.MaxUses != nil {
+		v.Check(*promo.MaxUses > 0, "max_uses", "must be greater than zero")
+	}
+}
+
+// Usable checks that the code can be redeemed at t.
+func (p *PromoCode) Usable(t time.Time) error {
+	switch {
+	case !p.IsActive:
+		return ErrPromoCodeInvalid
+	case t.Before(p.ValidFrom):
+		return ErrPromoCodeNotYetValid
+	case p.ValidUntil != nil && !t.Before(*p.ValidUntil):
+		return ErrPromoCodeExpired
+	case p.MaxUses != nil && p.UsedCount >= *p.MaxUses:
+		return ErrPromoCodeExhausted
+	}
+	return nil
+}
+
+// Discount is how much the code takes off amount. It never exceeds the amount.
+func (p *PromoCode) Discount(amount float64) float64 {
+	var discount float64
+	switch p.DiscountType {
+	case DiscountTypePercent:
+		discount = amount * p.DiscountValue / 100
+	case DiscountTypeFlat:
+		discount = p.DiscountValue
+	}
+	return RoundMoney(math.Min(discount, amount))
+}
+
+// Apply returns the redemption for amount, to attach to a reservation.
+func (p *PromoCode) Apply(amount float64) *PromoRedemption {
+	return &PromoRedemption{
+		PromoCodeID: p.ID,
+		Code:        p.Code,
+		Discount:    p.Discount(amount),
+	}
+}
+
+type PromoCodeModel struct {
+	DB *sql.DB
+	queryScope
+}
+
+func (m PromoCodeModel) Insert(promo *PromoCode) error {
+	query := `
+		INSERT INTO promo_codes (code, discount_type, discount_value, valid_from, valid_until, max_uses, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, used_count, created_at, version`
+
+	args := []any{
+		promo.Code,
+		promo.DiscountType,
+		promo.DiscountValue,
+		promo.ValidFrom,
+		promo.ValidUntil,
+		promo.MaxUses,
+		promo.IsActive,
+	}
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&promo.ID, &promo.UsedCount, &promo.CreatedAt, &promo.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "promo_codes_code_key"`:
+			return ErrDuplicatePromoCode
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m PromoCodeModel) GetByCode(code string) (*PromoCode, error) {
+	query := `
+		SELECT id, code, discount_type, discount_value, valid_from, valid_until, max_uses, used_count, is_active, created_at, version
+		FROM promo_codes
+		WHERE code = $1`
+
+	var promo PromoCode
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, NormalizePromoCode(code)).Scan(
+		&promo.ID,
+		&promo.Code,
+		&promo.DiscountType,
+		&promo.DiscountValue,
+		&promo.ValidFrom,
+		&promo.ValidUntil,
+		&promo.MaxUses,
+		&promo.UsedCount,
+		&promo.IsActive,
+		&promo.CreatedAt,
+		&promo.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &promo, nil
+}
+
+// Validate looks up the code and checks it can be redeemed at t. Unknown codes
+// are reported as ErrPromoCodeInvalid.
+func (m PromoCodeModel) Validate(code string, t time.Time) (*PromoCode, error) {
+	promo, err := m.GetByCode(code)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			return nil, ErrPromoCodeInvalid
+		default:
+			return nil, err
+		}
+	}
+
+	if err := promo.Usable(t); err != nil {
+		return nil, err
+	}
+
+	return promo, nil
+}
+
+func (m PromoCodeModel) GetAll(filters Filters) ([]*PromoCode, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, code, discount_type, discount_value, valid_from, valid_until, max_uses, used_count, is_active, created_at, version
+		FROM promo_codes
+		ORDER BY %s %s, id ASC
+		LIMIT $1 OFFSET $2`
+
+	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	promos := []*PromoCode{}
+
+	for rows.Next() {
+		var promo PromoCode
+
+		err := rows.Scan(
+			&totalRecords,
+			&promo.ID,
+			&promo.Code,
+			&promo.DiscountType,
+			&promo.DiscountValue,
+			&promo.ValidFrom,
+			&promo.ValidUntil,
+			&promo.MaxUses,
+			&promo.UsedCount,
+			&promo.IsActive,
+			&promo.CreatedAt,
+			&promo.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		promos = append(promos, &promo)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return promos, metadata, nil
+}
+
+// Redeem records the use of a promo code for a reservation inside tx. The usage
+// counter only moves while the code is active, within its validity window and
+// under its limit, so concurrent bookings can't overspend it; when it can't be
+// claimed Redeem returns ErrPromoCodeExhausted.
+func (m PromoCodeModel) Redeem(ctx context.Context, tx *sql.Tx, redemption *PromoRedemption, reservation *Reservation) error {
+	query := `
+		UPDATE promo_codes
+		SET used_count = used_count + 1
+		WHERE id = $1 AND is_active
+		AND valid_from <= NOW() AND (valid_until IS NULL OR valid_until > NOW())
+		AND (max_uses IS NULL OR used_count < max_uses)`
+
+	result, err := tx.ExecContext(ctx, query, redemption.PromoCodeID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrPromoCodeExhausted
+	}
+
+	query = `
+		INSERT INTO promo_code_redemptions (promo_code_id, user_id, reservation_id, discount_amount)
+		VALUES ($1, $2, $3, $4)`
+
+	_, err = tx.ExecContext(ctx, query, redemption.PromoCodeID, reservation.UserID, reservation.ID, redemption.Discount)
+	return err
+}
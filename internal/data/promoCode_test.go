@@ -0,0 +1,199 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+func TestPromoCodeDiscount(t *testing.T) {
+	tests := []struct {
+		name   string
+		promo  PromoCode
+		amount float64
+		want   float64
+	}{
+		{"percent", PromoCode{DiscountType: DiscountTypePercent, DiscountValue: 20}, 250, 50},
+		{"percent rounds to cents", PromoCode{DiscountType: DiscountTypePercent, DiscountValue: 15}, 33.33, 5},
+		{"full percent", PromoCode{DiscountType: DiscountTypePercent, DiscountValue: 100}, 80, 80},
+		{"flat", PromoCode{DiscountType: DiscountTypeFlat, DiscountValue: 30}, 250, 30},
+		{"flat capped at amount", PromoCode{DiscountType: DiscountTypeFlat, DiscountValue: 300}, 250, 250},
+	}
+
+	for _, tt := range tests {
+		if got := tt.promo.Discount(tt.amount); got != tt.want {
+			t.Errorf("%s: got %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteApplyPromo(t *testing.T) {
+	percent := &PromoCode{Code: "TENOFF", DiscountType: DiscountTypePercent, DiscountValue: 10}
+	flat := &PromoCode{Code: "FLAT25", DiscountType: DiscountTypeFlat, DiscountValue: 25}
+
+	q := &Quote{TotalAmount: MoneyFromFloat(200)}
+	q.ApplyPromo(percent)
+	if q.TotalAmount != MoneyFromFloat(180) || q.Promo.Discount != 20 || q.Promo.Code != "TENOFF" {
+		t.Errorf("percent: got total %v, promo %+v; want 180 after a 20 discount", q.TotalAmount, q.Promo)
+	}
+
+	q = &Quote{TotalAmount: MoneyFromFloat(200)}
+	q.ApplyPromo(flat)
+	if q.TotalAmount != MoneyFromFloat(175) || q.Promo.Discount != 25 {
+		t.Errorf("flat: got total %v, promo %+v; want 175 after a 25 discount", q.TotalAmount, q.Promo)
+	}
+}
+
+func TestPromoCodeUsable(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	limit := 2
+
+	tests := []struct {
+		name  string
+		promo PromoCode
+		want  error
+	}{
+		{"usable", PromoCode{IsActive: true, ValidFrom: past, ValidUntil: &future, MaxUses: &limit, UsedCount: 1}, nil},
+		{"no limits", PromoCode{IsActive: true, ValidFrom: past}, nil},
+		{"inactive", PromoCode{IsActive: false, ValidFrom: past}, ErrPromoCodeInvalid},
+		{"not yet valid", PromoCode{IsActive: true, ValidFrom: future}, ErrPromoCodeNotYetValid},
+		{"expired", PromoCode{IsActive: true, ValidFrom: past.Add(-time.Hour), ValidUntil: &past}, ErrPromoCodeExpired},
+		{"exhausted", PromoCode{IsActive: true, ValidFrom: past, MaxUses: &limit, UsedCount: 2}, ErrPromoCodeExhausted},
+	}
+
+	for _, tt := range tests {
+		if err := tt.promo.Usable(now); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v; want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestValidatePromoCode(t *testing.T) {
+	zero := 0
+
+	tests := []struct {
+		name  string
+		promo PromoCode
+		field string
+	}{
+		{"missing code", PromoCode{DiscountType: DiscountTypeFlat, DiscountValue: 5}, "code"},
+		{"unknown type", PromoCode{Code: "X", DiscountType: "bogo", DiscountValue: 5}, "discount_type"},
+		{"over 100 percent", PromoCode{Code: "X", DiscountType: DiscountTypePercent, DiscountValue: 120}, "discount_value"},
+		{"zero value", PromoCode{Code: "X", DiscountType: DiscountTypeFlat}, "discount_value"},
+		{"zero max uses", PromoCode{Code: "X", DiscountType: DiscountTypeFlat, DiscountValue: 5, MaxUses: &zero}, "max_uses"},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidatePromoCode(v, &tt.promo)
+		if _, ok := v.Errors[tt.field]; !ok {
+			t.Errorf("%s: got errors %v; want one for %q", tt.name, v.Errors, tt.field)
+		}
+	}
+
+	v := validator.New()
+	ValidatePromoCode(v, &PromoCode{Code: "SAVE150", DiscountType: DiscountTypeFlat, DiscountValue: 150})
+	if !v.Valid() {
+		t.Errorf("got errors %v for a flat discount over 100", v.Errors)
+	}
+}
+
+func TestPromoCodeUsageLimit(t *testing.T) {
+	m := newTestModels(t)
+
+	user := insertTestUser(t, m)
+	vehicle := insertTestVehicle(t, m, user.ID)
+	lot, spots := insertTestLot(t, m, user.ID, 2)
+
+	limit := 1
+	promo := &PromoCode{
+		Code:          "TEST" + NormalizePromoCode(uuid.NewString()[:8]),
+		DiscountType:  DiscountTypePercent,
+		DiscountValue: 50,
+		ValidFrom:     time.Now().Add(-time.Hour),
+		MaxUses:       &limit,
+		IsActive:      true,
+	}
+	if err := m.PromoCodes.Insert(promo); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		m.PromoCodes.DB.Exec(`DELETE FROM promo_codes WHERE id = $1`, promo.ID)
+	})
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	book := func(spot *ParkingSpot) (*Reservation, error) {
+		t.Helper()
+
+		found, err := m.PromoCodes.Validate(promo.Code, time.Now())
+		if err != nil {
+			return nil, err
+		}
+
+		reservation := &Reservation{
+			UserID:        user.ID,
+			VehicleID:     vehicle.ID,
+			ParkingLotID:  lot.ID,
+			ParkingSpotID: &spot.ID,
+			StartTime:     start,
+			EndTime:       start.Add(time.Hour),
+			Status:        ReservationStatusConfirmed,
+			TotalAmount:   MoneyFromFloat(100),
+		}
+		reservation.ApplyPromo(found)
+
+		return reservation, m.Reservations.Insert(reservation)
+	}
+
+	reservation, err := book(spots[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reservation.TotalAmount != MoneyFromFloat(50) {
+		t.Errorf("got total %v; want 50 after the discount", reservation.TotalAmount)
+	}
+
+	if _, err := book(spots[1]); !errors.Is(err, ErrPromoCodeExhausted) {
+		t.Errorf("booking past the usage limit: got %v; want ErrPromoCodeExhausted", err)
+	}
+
+	// A code validated before it ran out is still refused when the booking is
+	// saved, and the reservation isn't kept.
+	stale := *promo
+	stale.UsedCount = 0
+	late := &Reservation{
+		UserID:        user.ID,
+		VehicleID:     vehicle.ID,
+		ParkingLotID:  lot.ID,
+		ParkingSpotID: &spots[1].ID,
+		StartTime:     start,
+		EndTime:       start.Add(time.Hour),
+		Status:        ReservationStatusConfirmed,
+		TotalAmount:   MoneyFromFloat(100),
+	}
+	late.ApplyPromo(&stale)
+	if err := m.Reservations.Insert(late); !errors.Is(err, ErrPromoCodeExhausted) {
+		t.Errorf("redeeming a stale code: got %v; want ErrPromoCodeExhausted", err)
+	}
+
+	var count int
+	err = m.Reservations.DB.QueryRow(`SELECT count(*) FROM reservations WHERE user_id = $1`, user.ID).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("got %d reservations; want 1", count)
+	}
+
+	got, err := m.PromoCodes.GetByCode(promo.Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UsedCount != 1 {
+		t.Errorf("got used_count %d; want 1", got.UsedCount)
+	}
+}
@@ -1,26 +1,43 @@
 package data
 
 import (
-    "context"
     "database/sql"
     "time"
 
     "github.com/google/uuid"
 )
 
+const (
+    QRPurposeReservation = "reservation"
+    QRPurposeSpot        = "spot"
+)
+
+// QRDataVersion is the version of the QRCodeData layout written into new
+// codes. Codes issued before the payload was versioned have no version and
+// read as version 1.
+const QRDataVersion = 1
+
+// SpotCodeValidity is how long a spot code stays valid. They are printed on
+// signage, so they effectively don't expire.
+const SpotCodeValidity = 10 * 365 * 24 * time.Hour
+
 type QRCode struct {
-    ID        uuid.UUID `json:"id" db:"id"`
-    UserID    uuid.UUID `json:"user_id" db:"user_id"`
-    VehicleID uuid.UUID `json:"vehicle_id" db:"vehicle_id"`
-    Code      string    `json:"code" db:"code"`
-    Data      string    `json:"data" db:"data"` // JSON string of embedded data
-    ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
-    IsActive  bool      `json:"is_active" db:"is_active"`
-    CreatedAt time.Time `json:"created_at" db:"created_at"`
-    Version   int       `json:"version" db:"version"`
+    ID            uuid.UUID  `json:"id" db:"id"`
+    UserID        *uuid.UUID `json:"user_id" db:"user_id"` // unset for spot codes
+    VehicleID     *uuid.UUID `json:"vehicle_id" db:"vehicle_id"` // unset for spot codes
+    ReservationID *uuid.UUID `json:"reservation_id,omitempty" db:"reservation_id"` // set for reservation passes
+    ParkingSpotID *uuid.UUID `json:"parking_spot_id,omitempty" db:"parking_spot_id"` // set for spot codes
+    Code          string     `json:"code" db:"code"`
+    Data          string     `json:"data" db:"data"` // JSON string of embedded data
+    ExpiresAt     time.Time  `json:"expires_at" db:"expires_at"`
+    IsActive      bool       `json:"is_active" db:"is_active"`
+    CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+    UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
+    Version       int        `json:"version" db:"version"`
 }
 
 type QRCodeData struct {
+    Version     int             `json:"version"`
     UserProfile UserProfile     `json:"user_profile"`
     Vehicle     VehicleData     `json:"vehicle"`
     QRInfo      QRCodeInfo      `json:"qr_info"`
@@ -32,7 +49,7 @@ type UserProfile struct {
     FirstName    *string   `json:"first_name"`
     LastName     *string   `json:"last_name"`
     MobileNumber *string   `json:"mobile_number"`
-    Email        string    `json:"email"`
+    Email        string    `json:"email,omitempty"`
 }
 
 type VehicleData struct {
@@ -45,63 +62,76 @@ type VehicleData struct {
 }
 
 type QRCodeInfo struct {
-    Code        string    `json:"code"`
-    GeneratedAt time.Time `json:"generated_at"`
-    ExpiresAt   time.Time `json:"expires_at"`
-    Purpose     string    `json:"purpose"` // "parking", "identification", etc.
+    Code          string     `json:"code"`
+    GeneratedAt   time.Time  `json:"generated_at"`
+    ExpiresAt     time.Time  `json:"expires_at"`
+    Purpose       string     `json:"purpose"` // "parking", "identification", "reservation", etc.
+    ReservationID *uuid.UUID `json:"reservation_id,omitempty"`
+    ParkingLotID  *uuid.UUID `json:"parking_lot_id,omitempty"` // set for spot codes
+    ParkingSpotID *uuid.UUID `json:"parking_spot_id,omitempty"` // set for spot codes
+    Token         string     `json:"token,omitempty"` // signature over the reservation pass or spot code
 }
 
 type QRCodeModel struct {
     DB *sql.DB
+    queryScope
 }
 
 func (m QRCodeModel) Insert(qrCode *QRCode) error {
     query := `
-        INSERT INTO qr_codes (user_id, vehicle_id, code, data, expires_at, is_active)
-        VALUES ($1, $2, $3, $4, $5, $6)
-        RETURNING id, created_at, version`
+        INSERT INTO qr_codes (user_id, vehicle_id, reservation_id, parking_spot_id, code, data, expires_at, is_active)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        RETURNING id, created_at, updated_at, version`
 
     args := []any{
         qrCode.UserID,
         qrCode.VehicleID,
+        qrCode.ReservationID,
+        qrCode.ParkingSpotID,
         qrCode.Code,
         qrCode.Data,
         qrCode.ExpiresAt,
         qrCode.IsActive,
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    ctx, cancel := m.queryContext()
     defer cancel()
 
     err := m.DB.QueryRowContext(ctx, query, args...).Scan(
         &qrCode.ID,
         &qrCode.CreatedAt,
+        &qrCode.UpdatedAt,
         &qrCode.Version,
     )
 
     return err
 }
 
+// GetByCode returns the QR code with the code whether or not it is still
+// active; checking that is left to the caller.
 func (m QRCodeModel) GetByCode(code string) (*QRCode, error) {
     query := `
-        SELECT id, user_id, vehicle_id, code, data, expires_at, is_active, created_at, version
+        SELECT id, user_id, vehicle_id, reservation_id, parking_spot_id, code, data, expires_at, is_active, created_at, updated_at, version
         FROM qr_codes
-        WHERE code = $1 AND is_active = true AND expires_at > CURRENT_TIMESTAMP`
+        WHERE code = $1`
 
     var qrCode QRCode
 
-    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    ctx, cancel := m.queryContext()
     defer cancel()
 
     err := m.DB.QueryRowContext(ctx, query, code).Scan(
         &qrCode.ID,
         &qrCode.UserID,
         &qrCode.VehicleID,
+        &qrCode.ReservationID,
+        &qrCode.ParkingSpotID,
         &qrCode.Code,
         &qrCode.Data,
         &qrCode.ExpiresAt,
         &qrCode.IsActive,
         &qrCode.CreatedAt,
+        &qrCode.UpdatedAt,
         &qrCode.Version,
     )
 
@@ -117,24 +147,144 @@ func (m QRCodeModel) GetByCode(code string) (*QRCode, error) {
     return &qrCode, nil
 }
 
+// DeactivateAllForUser deactivates the user's personal QR codes. Reservation
+// passes are left alone; they live and die with their reservation.
 func (m QRCodeModel) DeactivateAllForUser(userID uuid.UUID) error {
-    query := `UPDATE qr_codes SET is_active = false WHERE user_id = $1`
+    query := `UPDATE qr_codes SET is_active = false, updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE user_id = $1 AND reservation_id IS NULL AND is_active = true`
 
-    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    ctx, cancel := m.queryContext()
     defer cancel()
 
     _, err := m.DB.ExecContext(ctx, query, userID)
     return err
 }
 
+func (m QRCodeModel) DeactivateForReservation(reservationID uuid.UUID) error {
+    query := `UPDATE qr_codes SET is_active = false, updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE reservation_id = $1 AND is_active = true`
+
+    ctx, cancel := m.queryContext()
+    defer cancel()
+
+    _, err := m.DB.ExecContext(ctx, query, reservationID)
+    return err
+}
+
+// Revoke deactivates a single QR code. The update only applies to the version
+// the caller read, so a code changed in the meantime returns ErrEditConflict.
+func (m QRCodeModel) Revoke(qrCode *QRCode) error {
+    query := `
+        UPDATE qr_codes
+        SET is_active = false, updated_at = CURRENT_TIMESTAMP, version = version + 1
+        WHERE id = $1 AND version = $2
+        RETURNING updated_at, version`
+
+    ctx, cancel := m.queryContext()
+    defer cancel()
+
+    err := m.DB.QueryRowContext(ctx, query, qrCode.ID, qrCode.Version).Scan(&qrCode.UpdatedAt, &qrCode.Version)
+    if err != nil {
+        switch {
+        case err == sql.ErrNoRows:
+            return ErrEditConflict
+        default:
+            return err
+        }
+    }
+
+    qrCode.IsActive = false
+
+    return nil
+}
+
+func (m QRCodeModel) GetActiveForReservation(reservationID uuid.UUID) (*QRCode, error) {
+    query := `
+        SELECT id, user_id, vehicle_id, reservation_id, parking_spot_id, code, data, expires_at, is_active, created_at, updated_at, version
+        FROM qr_codes
+        WHERE reservation_id = $1 AND is_active = true AND expires_at > CURRENT_TIMESTAMP
+        ORDER BY created_at DESC
+        LIMIT 1`
+
+    var qrCode QRCode
+
+    ctx, cancel := m.queryContext()
+    defer cancel()
+
+    err := m.DB.QueryRowContext(ctx, query, reservationID).Scan(
+        &qrCode.ID,
+        &qrCode.UserID,
+        &qrCode.VehicleID,
+        &qrCode.ReservationID,
+        &qrCode.ParkingSpotID,
+        &qrCode.Code,
+        &qrCode.Data,
+        &qrCode.ExpiresAt,
+        &qrCode.IsActive,
+        &qrCode.CreatedAt,
+        &qrCode.UpdatedAt,
+        &qrCode.Version,
+    )
+
+    if err != nil {
+        switch {
+        case err == sql.ErrNoRows:
+            return nil, ErrRecordNotFound
+        default:
+            return nil, err
+        }
+    }
+
+    return &qrCode, nil
+}
+
+// GetActiveForSpot returns the newest active code printed for the spot.
+func (m QRCodeModel) GetActiveForSpot(spotID uuid.UUID) (*QRCode, error) {
+    query := `
+        SELECT id, user_id, vehicle_id, reservation_id, parking_spot_id, code, data, expires_at, is_active, created_at, updated_at, version
+        FROM qr_codes
+        WHERE parking_spot_id = $1 AND is_active = true AND expires_at > CURRENT_TIMESTAMP
+        ORDER BY created_at DESC
+        LIMIT 1`
+
+    var qrCode QRCode
+
+    ctx, cancel := m.queryContext()
+    defer cancel()
+
+    err := m.DB.QueryRowContext(ctx, query, spotID).Scan(
+        &qrCode.ID,
+        &qrCode.UserID,
+        &qrCode.VehicleID,
+        &qrCode.ReservationID,
+        &qrCode.ParkingSpotID,
+        &qrCode.Code,
+        &qrCode.Data,
+        &qrCode.ExpiresAt,
+        &qrCode.IsActive,
+        &qrCode.CreatedAt,
+        &qrCode.UpdatedAt,
+        &qrCode.Version,
+    )
+
+    if err != nil {
+        switch {
+        case err == sql.ErrNoRows:
+            return nil, ErrRecordNotFound
+        default:
+            return nil, err
+        }
+    }
+
+    return &qrCode, nil
+}
+
 func (m QRCodeModel) GetActiveForUser(userID uuid.UUID) ([]*QRCode, error) {
     query := `
-        SELECT id, user_id, vehicle_id, code, data, expires_at, is_active, created_at, version
+        SELECT id, user_id, vehicle_id, reservation_id, parking_spot_id, code, data, expires_at, is_active, created_at, updated_at, version
         FROM qr_codes
         WHERE user_id = $1 AND is_active = true AND expires_at > CURRENT_TIMESTAMP
         ORDER BY created_at DESC`
 
-    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    ctx, cancel := m.queryContext()
     defer cancel()
 
     rows, err := m.DB.QueryContext(ctx, query, userID)
@@ -151,11 +301,14 @@ func (m QRCodeModel) GetActiveForUser(userID uuid.UUID) ([]*QRCode, error) {
             &qrCode.ID,
             &qrCode.UserID,
             &qrCode.VehicleID,
+            &qrCode.ReservationID,
+            &qrCode.ParkingSpotID,
             &qrCode.Code,
             &qrCode.Data,
             &qrCode.ExpiresAt,
             &qrCode.IsActive,
             &qrCode.CreatedAt,
+            &qrCode.UpdatedAt,
             &qrCode.Version,
         )
         if err != nil {
@@ -168,9 +321,9 @@ func (m QRCodeModel) GetActiveForUser(userID uuid.UUID) ([]*QRCode, error) {
 }
 
 func (m QRCodeModel) CleanupExpired() error {
-    query := `UPDATE qr_codes SET is_active = false WHERE expires_at <= CURRENT_TIMESTAMP`
+    query := `UPDATE qr_codes SET is_active = false, updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE expires_at <= CURRENT_TIMESTAMP AND is_active = true`
 
-    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    ctx, cancel := m.queryContext()
     defer cancel()
 
     _, err := m.DB.ExecContext(ctx, query)
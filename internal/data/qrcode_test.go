@@ -0,0 +1,53 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestQRCodeTimestampsAndRevoke(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+	vehicle := insertTestVehicle(t, m, user.ID)
+
+	qrCode := &QRCode{
+		UserID:    &user.ID,
+		VehicleID: &vehicle.ID,
+		Code:      "T" + uuid.NewString()[:15],
+		Data:      "{}",
+		ExpiresAt: time.Now().Add(time.Hour),
+		IsActive:  true,
+	}
+	if err := m.QRCodes.Insert(qrCode); err != nil {
+		t.Fatal(err)
+	}
+	if qrCode.CreatedAt.IsZero() || qrCode.UpdatedAt.IsZero() || qrCode.Version != 1 {
+		t.Errorf("after insert: created %v, updated %v, version %d", qrCode.CreatedAt, qrCode.UpdatedAt, qrCode.Version)
+	}
+
+	stored, err := m.QRCodes.GetByCode(qrCode.Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.UpdatedAt.Equal(qrCode.UpdatedAt) || stored.Version != qrCode.Version {
+		t.Errorf("GetByCode: updated %v, version %d; want %v, %d", stored.UpdatedAt, stored.Version, qrCode.UpdatedAt, qrCode.Version)
+	}
+
+	if err := m.QRCodes.Revoke(qrCode); err != nil {
+		t.Fatal(err)
+	}
+	if qrCode.IsActive || qrCode.Version != 2 {
+		t.Errorf("after revoke: active %t, version %d", qrCode.IsActive, qrCode.Version)
+	}
+	if _, err := m.QRCodes.GetByCode(qrCode.Code); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("GetByCode after revoke: err = %v, want %v", err, ErrRecordNotFound)
+	}
+
+	// A copy read before the revocation is out of date
+	if err := m.QRCodes.Revoke(stored); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("revoking a stale copy: err = %v, want %v", err, ErrEditConflict)
+	}
+}
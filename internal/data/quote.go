@@ -0,0 +1,94 @@
+package data
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidQuoteToken = errors.New("invalid quote token")
+	ErrQuoteExpired      = errors.New("quote has expired")
+)
+
+// quoteClaims is what a quote token carries: the whole quote, so its price can
+// be honored as quoted, and when that stops.
+type quoteClaims struct {
+	Quote     *Quote    `json:"quote"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SignQuote returns a token that locks in the quote's price until expiresAt.
+// The token is the quote itself followed by its HMAC under key, so it can be
+// checked without storing anything.
+func SignQuote(key []byte, quote *Quote, expiresAt time.Time) (string, error) {
+	payload, err := json.Marshal(quoteClaims{Quote: quote, ExpiresAt: expiresAt})
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + signQuotePayload(key, encoded), nil
+}
+
+// VerifyQuote returns the quote locked in by a token from SignQuote. Tokens
+// that were altered or not signed with key return ErrInvalidQuoteToken, and
+// those past their expiry at now return ErrQuoteExpired.
+func VerifyQuote(key []byte, token string, now time.Time) (*Quote, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(signQuotePayload(key, encoded))) {
+		return nil, ErrInvalidQuoteToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidQuoteToken
+	}
+
+	var claims quoteClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Quote == nil {
+		return nil, ErrInvalidQuoteToken
+	}
+
+	if !now.Before(claims.ExpiresAt) {
+		return nil, ErrQuoteExpired
+	}
+
+	return claims.Quote, nil
+}
+
+func signQuotePayload(key []byte, encoded string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Covers reports whether the quote priced the same booking: the same lot and
+// window, the same vehicle type, and the same promo code, if any.
+func (q *Quote) Covers(lotID uuid.UUID, start, end time.Time, vehicleType string, promoCode *string) bool {
+	if q.ParkingLotID != lotID || !q.StartTime.Equal(start) || !q.EndTime.Equal(end) || q.VehicleType != vehicleType {
+		return false
+	}
+
+	if promoCode == nil || q.Promo == nil {
+		return promoCode == nil && q.Promo == nil
+	}
+
+	return NormalizePromoCode(*promoCode) == q.Promo.Code
+}
+
+// ApplyQuote prices the reservation exactly as the quote did, in place of
+// ApplyVehicleType, ApplyPromo and ApplyCharges. A promo code in the quote is
+// still redeemed when the reservation is inserted.
+func (r *Reservation) ApplyQuote(q *Quote) {
+	r.TotalAmount = q.TotalAmount
+	r.Vehicle = q.Vehicle
+	r.Promo = q.Promo
+	r.Breakdown = q.Breakdown
+}
@@ -0,0 +1,110 @@
+package data
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestVerifyQuote(t *testing.T) {
+	key := []byte("test quote key")
+	now := time.Now()
+
+	lot := &ParkingLot{ID: uuid.New(), HourlyRate: MoneyFromFloat(100)}
+	quote := lot.Quote(now.Add(time.Hour).Truncate(time.Second), now.Add(3*time.Hour).Truncate(time.Second))
+	quote.ApplyVehicleType(lot, "car")
+
+	token, err := SignQuote(key, quote, now.Add(10*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Honored until it expires, at the quoted price
+	got, err := VerifyQuote(key, token, now.Add(9*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TotalAmount != quote.TotalAmount || got.ParkingLotID != lot.ID || got.VehicleType != "car" {
+		t.Errorf("got quote %+v; want %+v", got, quote)
+	}
+	if !got.StartTime.Equal(quote.StartTime) || !got.EndTime.Equal(quote.EndTime) {
+		t.Errorf("got window %s-%s; want %s-%s", got.StartTime, got.EndTime, quote.StartTime, quote.EndTime)
+	}
+
+	if _, err := VerifyQuote(key, token, now.Add(10*time.Minute)); !errors.Is(err, ErrQuoteExpired) {
+		t.Errorf("at expiry: got %v; want ErrQuoteExpired", err)
+	}
+
+	// A token with its price lowered no longer matches its signature
+	encoded, signature, _ := strings.Cut(token, ".")
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cheaper := strings.Replace(string(payload), `"total_amount":`+quote.TotalAmount.String(), `"total_amount":1.00`, 1)
+	if cheaper == string(payload) {
+		t.Fatalf("total amount not found in %s", payload)
+	}
+	tampered := base64.RawURLEncoding.EncodeToString([]byte(cheaper)) + "." + signature
+
+	for name, token := range map[string]string{
+		"tampered":     tampered,
+		"no signature": encoded,
+		"garbage":      "not.a-token",
+		"empty":        "",
+	} {
+		if _, err := VerifyQuote(key, token, now); !errors.Is(err, ErrInvalidQuoteToken) {
+			t.Errorf("%s: got %v; want ErrInvalidQuoteToken", name, err)
+		}
+	}
+
+	if _, err := VerifyQuote([]byte("other key"), token, now); !errors.Is(err, ErrInvalidQuoteToken) {
+		t.Errorf("other key: got %v; want ErrInvalidQuoteToken", err)
+	}
+}
+
+func TestQuoteCovers(t *testing.T) {
+	lotID := uuid.New()
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+	promo := "SAVE10"
+	lowerPromo := " save10"
+	otherPromo := "SAVE20"
+
+	quote := &Quote{ParkingLotID: lotID, StartTime: start, EndTime: end, VehicleType: "car"}
+	promoQuote := &Quote{ParkingLotID: lotID, StartTime: start, EndTime: end, VehicleType: "car", Promo: &PromoRedemption{Code: promo}}
+
+	tests := []struct {
+		name        string
+		quote       *Quote
+		lotID       uuid.UUID
+		start       time.Time
+		end         time.Time
+		vehicleType string
+		promoCode   *string
+		want        bool
+	}{
+		{"same booking", quote, lotID, start, end, "car", nil, true},
+		{"same instant in another zone", quote, lotID, start.In(time.FixedZone("+0530", 5*3600+1800)), end, "car", nil, true},
+		{"other lot", quote, uuid.New(), start, end, "car", nil, false},
+		{"longer stay", quote, lotID, start, end.Add(time.Hour), "car", nil, false},
+		{"other vehicle type", quote, lotID, start, end, "motorcycle", nil, false},
+		{"promo added", quote, lotID, start, end, "car", &promo, false},
+		{"same promo", promoQuote, lotID, start, end, "car", &promo, true},
+		{"same promo typed differently", promoQuote, lotID, start, end, "car", &lowerPromo, true},
+		{"promo dropped", promoQuote, lotID, start, end, "car", nil, false},
+		{"other promo", promoQuote, lotID, start, end, "car", &otherPromo, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.quote.Covers(tt.lotID, tt.start, tt.end, tt.vehicleType, tt.promoCode); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
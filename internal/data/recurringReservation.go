@@ -0,0 +1,351 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// RecurringReservation is a standing booking rule, e.g. weekdays 08:00-18:00.
+// Concrete Reservations are materialized from it one day ahead.
+type RecurringReservation struct {
+	ID                 uuid.UUID  `json:"id" db:"id"`
+	UserID             uuid.UUID  `json:"user_id" db:"user_id"`
+	VehicleID          uuid.UUID  `json:"vehicle_id" db:"vehicle_id"`
+	ParkingLotID       uuid.UUID  `json:"parking_lot_id" db:"parking_lot_id"`
+	DaysOfWeek         []int64    `json:"days_of_week" db:"days_of_week"` // 0 = Sunday ... 6 = Saturday
+	StartTime          string     `json:"start_time" db:"start_time"`     // HH:MM
+	EndTime            string     `json:"end_time" db:"end_time"`         // HH:MM
+	StartsOn           time.Time  `json:"starts_on" db:"starts_on"`
+	EndsOn             *time.Time `json:"ends_on" db:"ends_on"`
+	MonthlyAmount      Money      `json:"monthly_amount" db:"monthly_amount"`
+	IsActive           bool       `json:"is_active" db:"is_active"`
+	LastMaterializedOn *time.Time `json:"last_materialized_on" db:"last_materialized_on"`
+	CreatedAt          time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at" db:"updated_at"`
+	Version            int        `json:"version" db:"version"`
+}
+
+func ValidateRecurringReservation(v *validator.Validator, rule *RecurringReservation) {
+	v.Check(len(rule.DaysOfWeek) > 0, "days_of_week", "must contain at least one day")
+	v.Check(validator.Unique(rule.DaysOfWeek), "days_of_week", "must not contain duplicate values")
+	for _, day := range rule.DaysOfWeek {
+		v.Check(day >= 0 && day <= 6, "days_of_week", "must only contain values between 0 (Sunday) and 6 (Saturday)")
+	}
+
+	start, startErr := time.Parse("15:04", rule.StartTime)
+	end, endErr := time.Parse("15:04", rule.EndTime)
+	v.Check(startErr == nil, "start_time", "must be a time in HH:MM format")
+	v.Check(endErr == nil, "end_time", "must be a time in HH:MM format")
+	if startErr == nil && endErr == nil {
+		v.Check(end.After(start), "end_time", "must be after start time")
+	}
+
+	v.Check(!rule.StartsOn.IsZero(), "starts_on", "must be provided")
+	if rule.EndsOn != nil {
+		v.Check(!rule.EndsOn.Before(rule.StartsOn), "ends_on", "must not be before starts_on")
+	}
+
+	v.Check(rule.MonthlyAmount >= 0, "monthly_amount", "must not be negative")
+}
+
+// Occurrence returns the concrete start and end time of the rule on the given
+// calendar date, read on the clock of loc, normally the lot's time zone.
+func (rule *RecurringReservation) Occurrence(date time.Time, loc *time.Location) (time.Time, time.Time, error) {
+	start, err := time.Parse("15:04", rule.StartTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	end, err := time.Parse("15:04", rule.EndTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	y, mo, d := date.Date()
+
+	return time.Date(y, mo, d, start.Hour(), start.Minute(), 0, 0, loc),
+		time.Date(y, mo, d, end.Hour(), end.Minute(), 0, 0, loc),
+		nil
+}
+
+type RecurringReservationModel struct {
+	DB *sql.DB
+	queryScope
+}
+
+func (m RecurringReservationModel) Insert(rule *RecurringReservation) error {
+	query := `
+		INSERT INTO recurring_reservations (user_id, vehicle_id, parking_lot_id, days_of_week, start_time, end_time, starts_on, ends_on, monthly_amount, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at, updated_at, version`
+
+	args := []any{
+		rule.UserID,
+		rule.VehicleID,
+		rule.ParkingLotID,
+		pq.Array(rule.DaysOfWeek),
+		rule.StartTime,
+		rule.EndTime,
+		rule.StartsOn,
+		rule.EndsOn,
+		rule.MonthlyAmount,
+		rule.IsActive,
+	}
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&rule.ID,
+		&rule.CreatedAt,
+		&rule.UpdatedAt,
+		&rule.Version,
+	)
+}
+
+func (m RecurringReservationModel) Get(id uuid.UUID) (*RecurringReservation, error) {
+	query := `
+		SELECT id, user_id, vehicle_id, parking_lot_id, days_of_week, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI'), starts_on, ends_on, monthly_amount, is_active, last_materialized_on, created_at, updated_at, version
+		FROM recurring_reservations
+		WHERE id = $1`
+
+	var rule RecurringReservation
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&rule.ID,
+		&rule.UserID,
+		&rule.VehicleID,
+		&rule.ParkingLotID,
+		pq.Array(&rule.DaysOfWeek),
+		&rule.StartTime,
+		&rule.EndTime,
+		&rule.StartsOn,
+		&rule.EndsOn,
+		&rule.MonthlyAmount,
+		&rule.IsActive,
+		&rule.LastMaterializedOn,
+		&rule.CreatedAt,
+		&rule.UpdatedAt,
+		&rule.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &rule, nil
+}
+
+func (m RecurringReservationModel) GetAllForUser(userID uuid.UUID, filters Filters) ([]*RecurringReservation, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, user_id, vehicle_id, parking_lot_id, days_of_week, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI'), starts_on, ends_on, monthly_amount, is_active, last_materialized_on, created_at, updated_at, version
+		FROM recurring_reservations
+		WHERE user_id = $1
+		ORDER BY %s %s, id ASC
+		LIMIT $2 OFFSET $3`
+
+	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	rules := []*RecurringReservation{}
+
+	for rows.Next() {
+		var rule RecurringReservation
+
+		err := rows.Scan(
+			&totalRecords,
+			&rule.ID,
+			&rule.UserID,
+			&rule.VehicleID,
+			&rule.ParkingLotID,
+			pq.Array(&rule.DaysOfWeek),
+			&rule.StartTime,
+			&rule.EndTime,
+			&rule.StartsOn,
+			&rule.EndsOn,
+			&rule.MonthlyAmount,
+			&rule.IsActive,
+			&rule.LastMaterializedOn,
+			&rule.CreatedAt,
+			&rule.UpdatedAt,
+			&rule.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		rules = append(rules, &rule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return rules, metadata, nil
+}
+
+// GetDueForDate returns the active rules that apply on the given date and have
+// not been materialized for it yet.
+func (m RecurringReservationModel) GetDueForDate(date time.Time) ([]*RecurringReservation, error) {
+	query := `
+		SELECT id, user_id, vehicle_id, parking_lot_id, days_of_week, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI'), starts_on, ends_on, monthly_amount, is_active, last_materialized_on, created_at, updated_at, version
+		FROM recurring_reservations
+		WHERE is_active = true
+		AND starts_on <= $1
+		AND (ends_on IS NULL OR ends_on >= $1)
+		AND $2 = ANY(days_of_week)
+		AND (last_materialized_on IS NULL OR last_materialized_on < $1)
+		ORDER BY created_at ASC`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	day := date.Format("2006-01-02")
+
+	rows, err := m.DB.QueryContext(ctx, query, day, int(date.Weekday()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []*RecurringReservation
+
+	for rows.Next() {
+		var rule RecurringReservation
+
+		err := rows.Scan(
+			&rule.ID,
+			&rule.UserID,
+			&rule.VehicleID,
+			&rule.ParkingLotID,
+			pq.Array(&rule.DaysOfWeek),
+			&rule.StartTime,
+			&rule.EndTime,
+			&rule.StartsOn,
+			&rule.EndsOn,
+			&rule.MonthlyAmount,
+			&rule.IsActive,
+			&rule.LastMaterializedOn,
+			&rule.CreatedAt,
+			&rule.UpdatedAt,
+			&rule.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, &rule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// MarkMaterialized records that the rule has been processed for the given date,
+// whether or not a reservation could be created, so the job doesn't retry it.
+func (m RecurringReservationModel) MarkMaterialized(id uuid.UUID, date time.Time) error {
+	query := `
+		UPDATE recurring_reservations
+		SET last_materialized_on = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, date.Format("2006-01-02"), id)
+	return err
+}
+
+// ChargeMonth bills the rule's monthly amount as a pending payment for the month
+// of the given date. Each month is only billed once per rule: billing it again,
+// or billing a rule without a monthly amount, returns a nil payment.
+func (m RecurringReservationModel) ChargeMonth(rule *RecurringReservation, date time.Time) (*Payment, error) {
+	if rule.MonthlyAmount <= 0 {
+		return nil, nil
+	}
+
+	query := `
+		INSERT INTO payments (user_id, amount, currency, payment_method, status, recurring_reservation_id, billing_month)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (recurring_reservation_id, billing_month) WHERE recurring_reservation_id IS NOT NULL DO NOTHING
+		RETURNING id, payment_date, created_at, updated_at, version`
+
+	payment := &Payment{
+		UserID:        rule.UserID,
+		Amount:        rule.MonthlyAmount,
+		Currency:      "USD",
+		PaymentMethod: PaymentMethodCard,
+		Status:        PaymentStatusPending,
+	}
+
+	args := []any{payment.UserID, payment.Amount, payment.Currency, payment.PaymentMethod, payment.Status, rule.ID, date.Format("2006-01") + "-01"}
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&payment.ID, &payment.PaymentDate, &payment.CreatedAt, &payment.UpdatedAt, &payment.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return payment, nil
+}
+
+func (m RecurringReservationModel) Cancel(id uuid.UUID) error {
+	query := `
+		UPDATE recurring_reservations
+		SET is_active = false, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $1 AND is_active = true`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
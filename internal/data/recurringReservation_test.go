@@ -0,0 +1,80 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+func TestRecurringReservationOccurrence(t *testing.T) {
+	colombo, err := time.LoadLocation("Asia/Colombo")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	rule := &RecurringReservation{StartTime: "08:00", EndTime: "18:30"}
+
+	start, end, err := rule.Occurrence(time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC), colombo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantStart := time.Date(2025, 3, 10, 8, 0, 0, 0, colombo)
+	wantEnd := time.Date(2025, 3, 10, 18, 30, 0, 0, colombo)
+	if !start.Equal(wantStart) || !end.Equal(wantEnd) {
+		t.Errorf("got %s to %s; want %s to %s", start, end, wantStart, wantEnd)
+	}
+
+	rule.StartTime = "8am"
+	if _, _, err := rule.Occurrence(wantStart, colombo); err == nil {
+		t.Error("expected an error for a malformed start time")
+	}
+}
+
+func TestValidateRecurringReservation(t *testing.T) {
+	valid := func() *RecurringReservation {
+		return &RecurringReservation{
+			DaysOfWeek: []int64{1, 2, 3, 4, 5},
+			StartTime:  "08:00",
+			EndTime:    "18:00",
+			StartsOn:   time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		change  func(*RecurringReservation)
+		wantKey string
+	}{
+		{"valid", func(*RecurringReservation) {}, ""},
+		{"no days", func(r *RecurringReservation) { r.DaysOfWeek = nil }, "days_of_week"},
+		{"duplicate days", func(r *RecurringReservation) { r.DaysOfWeek = []int64{1, 1} }, "days_of_week"},
+		{"day out of range", func(r *RecurringReservation) { r.DaysOfWeek = []int64{7} }, "days_of_week"},
+		{"end before start", func(r *RecurringReservation) { r.EndTime = "07:00" }, "end_time"},
+		{"ends before it starts", func(r *RecurringReservation) {
+			endsOn := r.StartsOn.AddDate(0, 0, -1)
+			r.EndsOn = &endsOn
+		}, "ends_on"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := valid()
+			tt.change(rule)
+
+			v := validator.New()
+			ValidateRecurringReservation(v, rule)
+
+			if tt.wantKey == "" {
+				if !v.Valid() {
+					t.Errorf("unexpected errors: %v", v.Errors)
+				}
+				return
+			}
+			if _, ok := v.Errors[tt.wantKey]; !ok {
+				t.Errorf("got errors %v; want one for %q", v.Errors, tt.wantKey)
+			}
+		})
+	}
+}
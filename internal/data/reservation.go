@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
 )
 
@@ -20,6 +21,25 @@ const (
 	ReservationStatusExpired   = "expired"
 )
 
+// MaxBatchReservations caps how many reservations one batch request may create.
+const MaxBatchReservations = 50
+
+// ErrNoSpotAvailable is returned, or set on a batch item, when no spot is free
+// for a reservation's window or the lot is already booked to capacity.
+var ErrNoSpotAvailable = errors.New("no spot available")
+
+// BatchReservation is one item of a batch booking. BatchInsert picks the spot,
+// trying SpotTypes in order, and records any failure in Err.
+type BatchReservation struct {
+	Reservation *Reservation
+	SpotTypes   []string
+	Err         error
+}
+
+// ReservationEarlyArrival is how long before its start a reservation pass
+// admits a driver at the gate.
+const ReservationEarlyArrival = 15 * time.Minute
+
 type Reservation struct {
 	ID              uuid.UUID  `json:"id" db:"id"`
 	UserID          uuid.UUID  `json:"user_id" db:"user_id"`
@@ -31,10 +51,27 @@ type Reservation struct {
 	ActualStartTime *time.Time `json:"actual_start_time" db:"actual_start_time"`
 	ActualEndTime   *time.Time `json:"actual_end_time" db:"actual_end_time"`
 	Status          string     `json:"status" db:"status"`
-	TotalAmount     float64    `json:"total_amount" db:"total_amount"`
+	TotalAmount     Money      `json:"total_amount" db:"total_amount"`
 	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
 	Version         int        `json:"version" db:"version"`
+
+	// Vehicle is set when the lot prices the vehicle's type differently;
+	// TotalAmount already includes its adjustment.
+	Vehicle *VehicleRate `json:"vehicle_rate,omitempty" db:"-"`
+	// Promo is set when a promo code was applied while booking; TotalAmount is
+	// already net of its discount.
+	Promo *PromoRedemption `json:"promo,omitempty" db:"-"`
+	// Points is set when loyalty points were spent while booking.
+	Points *PointsRedemption `json:"points,omitempty" db:"-"`
+	// Breakdown itemizes TotalAmount. Reservations made before tax and fees
+	// were itemized have none.
+	Breakdown *PriceBreakdown `json:"price_breakdown,omitempty" db:"price_breakdown"`
+}
+
+// AdmitsAt reports whether the reservation's gate window is open at t.
+func (r *Reservation) AdmitsAt(t time.Time) bool {
+	return !t.Before(r.StartTime.Add(-ReservationEarlyArrival)) && t.Before(r.EndTime)
 }
 
 func ValidateReservation(v *validator.Validator, reservation *Reservation) {
@@ -52,20 +89,85 @@ func ValidateReservation(v *validator.Validator, reservation *Reservation) {
 		ReservationStatusExpired), "status", "must be a valid status")
 
 	v.Check(reservation.TotalAmount >= 0, "total_amount", "must not be negative")
-	v.Check(reservation.TotalAmount <= 100000, "total_amount", "must not exceed 100,000")
+	v.Check(reservation.TotalAmount <= MoneyFromFloat(100000), "total_amount", "must not exceed 100,000")
+}
+
+// ValidateReservationWindow checks that a booking from start to end falls within
+// a single opening period of the lot. Lots that are open all day accept any window.
+// Opening hours are read in the lot's time zone, whatever offset start and end carry.
+func ValidateReservationWindow(v *validator.Validator, lot *ParkingLot, start, end time.Time) {
+	if lot.IsOpenAllDay() {
+		return
+	}
+
+	hours := fmt.Sprintf("(%s-%s)", clockLabel(lot.OpenTime), clockLabel(lot.CloseTime))
+
+	if !lot.IsOpenAt(start) {
+		v.AddError("start_time", "must be within the lot's operating hours "+hours)
+		return
+	}
+
+	v.Check(!end.After(lot.ClosesAfter(start)), "end_time", "must not be after the lot closes "+hours)
+}
+
+// DefaultMaxReservationDays and DefaultMaxAdvanceDays limit bookings in lots
+// that don't set their own limits. Both are set once at startup.
+var (
+	DefaultMaxReservationDays = 30
+	DefaultMaxAdvanceDays     = 90
+)
+
+// EffectiveMaxReservationDays is the longest booking the lot accepts, in days.
+func (lot *ParkingLot) EffectiveMaxReservationDays() int {
+	if lot.MaxReservationDays != nil {
+		return *lot.MaxReservationDays
+	}
+	return DefaultMaxReservationDays
+}
+
+// EffectiveMaxAdvanceDays is how many days ahead the lot takes bookings.
+func (lot *ParkingLot) EffectiveMaxAdvanceDays() int {
+	if lot.MaxAdvanceDays != nil {
+		return *lot.MaxAdvanceDays
+	}
+	return DefaultMaxAdvanceDays
+}
+
+// ValidateReservationLimits checks that a booking from start to end is no
+// longer than the lot allows, starts at least the lot's lead time from now and
+// doesn't start further ahead of now than the lot takes bookings.
+func ValidateReservationLimits(v *validator.Validator, lot *ParkingLot, start, end, now time.Time) {
+	if lot.MinLeadMinutes > 0 {
+		v.Check(!start.Before(now.Add(time.Duration(lot.MinLeadMinutes)*time.Minute)), "start_time", fmt.Sprintf("must be at least %d minutes from now", lot.MinLeadMinutes))
+	}
+
+	maxDays := lot.EffectiveMaxReservationDays()
+	v.Check(!end.After(start.AddDate(0, 0, maxDays)), "end_time", fmt.Sprintf("must not be more than %d days after start time", maxDays))
+
+	advanceDays := lot.EffectiveMaxAdvanceDays()
+	v.Check(!start.After(now.AddDate(0, 0, advanceDays)), "start_time", fmt.Sprintf("must not be more than %d days in advance", advanceDays))
+}
+
+func clockLabel(value string) string {
+	minutes, ok := parseClockTime(value)
+	if !ok {
+		return value
+	}
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
 }
 
 type ReservationModel struct {
 	DB *sql.DB
+	queryScope
 }
 
-func (m ReservationModel) Insert(reservation *Reservation) error {
-	query := `
-		INSERT INTO reservations (user_id, vehicle_id, parking_lot_id, parking_spot_id, start_time, end_time, status, total_amount)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+const insertReservationQuery = `
+		INSERT INTO reservations (user_id, vehicle_id, parking_lot_id, parking_spot_id, start_time, end_time, status, total_amount, price_breakdown)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id, created_at, updated_at, version`
 
-	args := []any{
+func insertReservationArgs(reservation *Reservation) []any {
+	return []any{
 		reservation.UserID,
 		reservation.VehicleID,
 		reservation.ParkingLotID,
@@ -74,12 +176,185 @@ func (m ReservationModel) Insert(reservation *Reservation) error {
 		reservation.EndTime,
 		reservation.Status,
 		reservation.TotalAmount,
+		reservation.Breakdown,
 	}
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// Insert saves the reservation. A reservation with a promo code or loyalty
+// points is saved in the same transaction as their redemption, so it fails
+// with ErrPromoCodeExhausted or ErrInsufficientPoints rather than overspend
+// either. A reservation for a spot that has been booked for an overlapping
+// window in the meantime fails with ErrSpotUnavailable.
+func (m ReservationModel) Insert(reservation *Reservation) error {
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.insertTx(ctx, tx, reservation)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// InsertWithFreeSpot saves the reservation at the first free spot of the given
+// types, earlier types first. The spot is picked inside the booking transaction
+// so concurrent bookings can't both get it. Without a free spot it returns
+// ErrNoSpotAvailable, unless allowUnassigned is set, in which case the booking
+// is saved without a spot and is still held to the lot's capacity.
+func (m ReservationModel) InsertWithFreeSpot(reservation *Reservation, spotTypes []string, allowUnassigned bool) error {
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.insertWithFreeSpotTx(ctx, tx, reservation, spotTypes, allowUnassigned)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertWithFreeSpotTx is InsertWithFreeSpot within tx. The lot is locked
+// before the spot, in the same order as insertTx, so the two can't deadlock.
+func (m ReservationModel) insertWithFreeSpotTx(ctx context.Context, tx *sql.Tx, reservation *Reservation, spotTypes []string, allowUnassigned bool) error {
+	err := checkCapacityTx(ctx, tx, reservation)
+	if err != nil {
+		return err
+	}
+
+	spotQuery := `SELECT s.id` + freeSpotForWindowQuery + ` FOR UPDATE OF s`
+
+	var spotID uuid.UUID
+	err = tx.QueryRowContext(ctx, spotQuery, freeSpotForWindowArgs(reservation.ParkingLotID, reservation.StartTime, reservation.EndTime, spotTypes, reservation.UserID)...).Scan(&spotID)
+	switch {
+	case err == nil:
+		reservation.ParkingSpotID = &spotID
+	case errors.Is(err, sql.ErrNoRows) && allowUnassigned:
+		reservation.ParkingSpotID = nil
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNoSpotAvailable
+	default:
+		return err
+	}
+
+	return m.insertCheckedTx(ctx, tx, reservation)
+}
+
+// overlappingReservationsQuery counts the lot's confirmed and active
+// reservations whose window overlaps [$2, $3).
+const overlappingReservationsQuery = `
+		SELECT COUNT(*)
+		FROM reservations
+		WHERE parking_lot_id = $1 AND status IN ($4, $5) AND start_time < $3 AND end_time > $2`
+
+func overlappingReservationsArgs(lotID uuid.UUID, start, end time.Time) []any {
+	return []any{lotID, start, end, ReservationStatusConfirmed, ReservationStatusActive}
+}
+
+// CountOverlapping returns how many confirmed or active reservations at the
+// lot overlap the window from start to end.
+func (m ReservationModel) CountOverlapping(lotID uuid.UUID, start, end time.Time) (int, error) {
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	var count int
+
+	err := m.DB.QueryRowContext(ctx, overlappingReservationsQuery, overlappingReservationsArgs(lotID, start, end)...).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// checkCapacityTx returns ErrNoSpotAvailable when the lot already has as many
+// overlapping reservations as its capacity: its spots, plus any overbooking
+// allowance. The lot row is locked so concurrent bookings are counted one after
+// the other.
+func checkCapacityTx(ctx context.Context, tx *sql.Tx, reservation *Reservation) error {
+	var totalSpots, overbookingPercent int
+
+	err := tx.QueryRowContext(ctx, `SELECT total_spots, overbooking_percent FROM parking_lots WHERE id = $1 FOR UPDATE`, reservation.ParkingLotID).Scan(&totalSpots, &overbookingPercent)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	var overlapping int
+
+	err = tx.QueryRowContext(ctx, overlappingReservationsQuery, overlappingReservationsArgs(reservation.ParkingLotID, reservation.StartTime, reservation.EndTime)...).Scan(&overlapping)
+	if err != nil {
+		return err
+	}
+
+	if overlapping >= lotCapacity(totalSpots, overbookingPercent) {
+		return ErrNoSpotAvailable
+	}
+
+	return nil
+}
+
+// checkSpotFreeTx returns ErrSpotUnavailable when the reservation's spot already
+// has a pending, confirmed or active reservation overlapping its window. It
+// must run after checkCapacityTx, whose lock on the lot keeps another booking
+// from taking the spot between this check and the insert.
+func checkSpotFreeTx(ctx context.Context, tx *sql.Tx, reservation *Reservation) error {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM reservations
+			WHERE parking_spot_id = $1 AND status IN ($2, $3, $4) AND start_time < $6 AND end_time > $5
+		)`
+
+	var taken bool
+
+	err := tx.QueryRowContext(ctx, query, reservation.ParkingSpotID, ReservationStatusPending, ReservationStatusConfirmed, ReservationStatusActive, reservation.StartTime, reservation.EndTime).Scan(&taken)
+	if err != nil {
+		return err
+	}
+
+	if taken {
+		return ErrSpotUnavailable
+	}
+
+	return nil
+}
+
+func (m ReservationModel) insertTx(ctx context.Context, tx *sql.Tx, reservation *Reservation) error {
+	err := checkCapacityTx(ctx, tx, reservation)
+	if err != nil {
+		return err
+	}
+
+	if reservation.ParkingSpotID != nil {
+		err = checkSpotFreeTx(ctx, tx, reservation)
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.insertCheckedTx(ctx, tx, reservation)
+}
+
+// insertCheckedTx saves a reservation whose lot capacity and spot have already
+// been checked in tx, along with any promo code or points it redeems.
+func (m ReservationModel) insertCheckedTx(ctx context.Context, tx *sql.Tx, reservation *Reservation) error {
+	err := tx.QueryRowContext(ctx, insertReservationQuery, insertReservationArgs(reservation)...).Scan(
 		&reservation.ID,
 		&reservation.CreatedAt,
 		&reservation.UpdatedAt,
@@ -89,18 +364,73 @@ func (m ReservationModel) Insert(reservation *Reservation) error {
 		return err
 	}
 
+	if reservation.Promo != nil {
+		err = PromoCodeModel{DB: m.DB}.Redeem(ctx, tx, reservation.Promo, reservation)
+		if err != nil {
+			return err
+		}
+	}
+
+	if reservation.Points != nil {
+		return LoyaltyModel{DB: m.DB}.Redeem(ctx, tx, reservation.Points, reservation)
+	}
+
 	return nil
 }
 
+// BatchInsert books each item in one transaction. Items are independent: one
+// that can't be booked gets its Err set and is rolled back to a savepoint
+// while the rest go ahead. Spots are picked inside the transaction, so items
+// in the same batch never double-book a spot. The returned error is only for
+// failures of the batch as a whole.
+func (m ReservationModel) BatchInsert(items []*BatchReservation) error {
+	ctx, cancel := m.longQueryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, item := range items {
+		reservation := item.Reservation
+
+		_, err = tx.ExecContext(ctx, `SAVEPOINT batch_item`)
+		if err != nil {
+			return err
+		}
+
+		err = m.insertWithFreeSpotTx(ctx, tx, reservation, item.SpotTypes, false)
+		if err != nil {
+			item.Err = err
+			reservation.ParkingSpotID = nil
+
+			_, err = tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT batch_item`)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, `RELEASE SAVEPOINT batch_item`)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
 func (m ReservationModel) Get(id uuid.UUID) (*Reservation, error) {
 	query := `
-		SELECT id, user_id, vehicle_id, parking_lot_id, parking_spot_id, start_time, end_time, actual_start_time, actual_end_time, status, total_amount, created_at, updated_at, version
+		SELECT id, user_id, vehicle_id, parking_lot_id, parking_spot_id, start_time, end_time, actual_start_time, actual_end_time, status, total_amount, price_breakdown, created_at, updated_at, version
 		FROM reservations
 		WHERE id = $1`
 
 	var reservation Reservation
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
@@ -115,6 +445,7 @@ func (m ReservationModel) Get(id uuid.UUID) (*Reservation, error) {
 		&reservation.ActualEndTime,
 		&reservation.Status,
 		&reservation.TotalAmount,
+		&reservation.Breakdown,
 		&reservation.CreatedAt,
 		&reservation.UpdatedAt,
 		&reservation.Version,
@@ -134,7 +465,7 @@ func (m ReservationModel) Get(id uuid.UUID) (*Reservation, error) {
 
 func (m ReservationModel) GetAllForUser(userID uuid.UUID, filters Filters) ([]*Reservation, Metadata, error) {
 	query := `
-		SELECT count(*) OVER(), id, user_id, vehicle_id, parking_lot_id, parking_spot_id, start_time, end_time, actual_start_time, actual_end_time, status, total_amount, created_at, updated_at, version
+		SELECT count(*) OVER(), id, user_id, vehicle_id, parking_lot_id, parking_spot_id, start_time, end_time, actual_start_time, actual_end_time, status, total_amount, price_breakdown, created_at, updated_at, version
 		FROM reservations
 		WHERE user_id = $1
 		ORDER BY %s %s, id ASC
@@ -142,7 +473,7 @@ func (m ReservationModel) GetAllForUser(userID uuid.UUID, filters Filters) ([]*R
 
 	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	args := []any{userID, filters.limit(), filters.offset()}
@@ -172,6 +503,69 @@ func (m ReservationModel) GetAllForUser(userID uuid.UUID, filters Filters) ([]*R
 			&reservation.ActualEndTime,
 			&reservation.Status,
 			&reservation.TotalAmount,
+			&reservation.Breakdown,
+			&reservation.CreatedAt,
+			&reservation.UpdatedAt,
+			&reservation.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		reservations = append(reservations, &reservation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return reservations, metadata, nil
+}
+
+// GetAllForOrg lists the reservations of every member of the organization.
+func (m ReservationModel) GetAllForOrg(orgID uuid.UUID, filters Filters) ([]*Reservation, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, user_id, vehicle_id, parking_lot_id, parking_spot_id, start_time, end_time, actual_start_time, actual_end_time, status, total_amount, price_breakdown, created_at, updated_at, version
+		FROM reservations
+		WHERE user_id IN (SELECT id FROM users WHERE org_id = $1)
+		ORDER BY %s %s, id ASC
+		LIMIT $2 OFFSET $3`
+
+	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	args := []any{orgID, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reservations := []*Reservation{}
+
+	for rows.Next() {
+		var reservation Reservation
+
+		err := rows.Scan(
+			&totalRecords,
+			&reservation.ID,
+			&reservation.UserID,
+			&reservation.VehicleID,
+			&reservation.ParkingLotID,
+			&reservation.ParkingSpotID,
+			&reservation.StartTime,
+			&reservation.EndTime,
+			&reservation.ActualStartTime,
+			&reservation.ActualEndTime,
+			&reservation.Status,
+			&reservation.TotalAmount,
+			&reservation.Breakdown,
 			&reservation.CreatedAt,
 			&reservation.UpdatedAt,
 			&reservation.Version,
@@ -194,7 +588,7 @@ func (m ReservationModel) GetAllForUser(userID uuid.UUID, filters Filters) ([]*R
 
 func (m ReservationModel) GetByStatus(status string, filters Filters) ([]*Reservation, Metadata, error) {
 	query := `
-		SELECT count(*) OVER(), id, user_id, vehicle_id, parking_lot_id, parking_spot_id, start_time, end_time, actual_start_time, actual_end_time, status, total_amount, created_at, updated_at, version
+		SELECT count(*) OVER(), id, user_id, vehicle_id, parking_lot_id, parking_spot_id, start_time, end_time, actual_start_time, actual_end_time, status, total_amount, price_breakdown, created_at, updated_at, version
 		FROM reservations
 		WHERE status = $1
 		ORDER BY %s %s, id ASC
@@ -202,7 +596,7 @@ func (m ReservationModel) GetByStatus(status string, filters Filters) ([]*Reserv
 
 	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	args := []any{status, filters.limit(), filters.offset()}
@@ -232,6 +626,74 @@ func (m ReservationModel) GetByStatus(status string, filters Filters) ([]*Reserv
 			&reservation.ActualEndTime,
 			&reservation.Status,
 			&reservation.TotalAmount,
+			&reservation.Breakdown,
+			&reservation.CreatedAt,
+			&reservation.UpdatedAt,
+			&reservation.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		reservations = append(reservations, &reservation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return reservations, metadata, nil
+}
+
+// GetUnpaidCompleted returns the lot's completed reservations whose completed
+// payments add up to less than their total amount. Reservations paid in several
+// parts only count as paid once the parts cover the total.
+func (m ReservationModel) GetUnpaidCompleted(lotID uuid.UUID, filters Filters) ([]*Reservation, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), r.id, r.user_id, r.vehicle_id, r.parking_lot_id, r.parking_spot_id, r.start_time, r.end_time, r.actual_start_time, r.actual_end_time, r.status, r.total_amount, r.price_breakdown, r.created_at, r.updated_at, r.version
+		FROM reservations r
+		LEFT JOIN payments p ON p.reservation_id = r.id AND p.status = $2
+		WHERE r.parking_lot_id = $1 AND r.status = $3
+		GROUP BY r.id
+		HAVING COALESCE(SUM(p.amount), 0) < r.total_amount
+		ORDER BY r.%s %s, r.id ASC
+		LIMIT $4 OFFSET $5`
+
+	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := m.longQueryContext()
+	defer cancel()
+
+	args := []any{lotID, PaymentStatusCompleted, ReservationStatusCompleted, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reservations := []*Reservation{}
+
+	for rows.Next() {
+		var reservation Reservation
+
+		err := rows.Scan(
+			&totalRecords,
+			&reservation.ID,
+			&reservation.UserID,
+			&reservation.VehicleID,
+			&reservation.ParkingLotID,
+			&reservation.ParkingSpotID,
+			&reservation.StartTime,
+			&reservation.EndTime,
+			&reservation.ActualStartTime,
+			&reservation.ActualEndTime,
+			&reservation.Status,
+			&reservation.TotalAmount,
+			&reservation.Breakdown,
 			&reservation.CreatedAt,
 			&reservation.UpdatedAt,
 			&reservation.Version,
@@ -254,12 +716,12 @@ func (m ReservationModel) GetByStatus(status string, filters Filters) ([]*Reserv
 
 func (m ReservationModel) GetActiveByLot(lotID uuid.UUID) ([]*Reservation, error) {
 	query := `
-		SELECT id, user_id, vehicle_id, parking_lot_id, parking_spot_id, start_time, end_time, actual_start_time, actual_end_time, status, total_amount, created_at, updated_at, version
+		SELECT id, user_id, vehicle_id, parking_lot_id, parking_spot_id, start_time, end_time, actual_start_time, actual_end_time, status, total_amount, price_breakdown, created_at, updated_at, version
 		FROM reservations
 		WHERE parking_lot_id = $1 AND status IN ($2, $3) AND start_time <= NOW() AND end_time >= NOW()
 		ORDER BY start_time ASC`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	rows, err := m.DB.QueryContext(ctx, query, lotID, ReservationStatusConfirmed, ReservationStatusActive)
@@ -285,6 +747,7 @@ func (m ReservationModel) GetActiveByLot(lotID uuid.UUID) ([]*Reservation, error
 			&reservation.ActualEndTime,
 			&reservation.Status,
 			&reservation.TotalAmount,
+			&reservation.Breakdown,
 			&reservation.CreatedAt,
 			&reservation.UpdatedAt,
 			&reservation.Version,
@@ -303,11 +766,37 @@ func (m ReservationModel) GetActiveByLot(lotID uuid.UUID) ([]*Reservation, error
 	return reservations, nil
 }
 
+// GetForecast sums what the lot's confirmed and active reservations starting in
+// the window [start, end) are booked for. It is projected revenue, not money
+// received; payments record that. An empty window forecasts nothing.
+func (m ReservationModel) GetForecast(lotID uuid.UUID, start, end time.Time) (float64, error) {
+	if !end.After(start) {
+		return 0, nil
+	}
+
+	query := `
+		SELECT COALESCE(SUM(total_amount), 0)
+		FROM reservations
+		WHERE parking_lot_id = $1 AND status IN ($2, $3) AND start_time >= $4 AND start_time < $5`
+
+	var forecast float64
+
+	ctx, cancel := m.longQueryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, lotID, ReservationStatusConfirmed, ReservationStatusActive, start, end).Scan(&forecast)
+	if err != nil {
+		return 0, err
+	}
+
+	return RoundMoney(forecast), nil
+}
+
 func (m ReservationModel) Update(reservation *Reservation) error {
 	query := `
 		UPDATE reservations
 		SET parking_spot_id = $1, start_time = $2, end_time = $3, actual_start_time = $4, actual_end_time = $5, status = $6, total_amount = $7, updated_at = CURRENT_TIMESTAMP, version = version + 1
-		WHERE id = $8 AND version = $9
+		WHERE id = $8 AND version = $9 AND (status = $6 OR status = ANY($10))
 		RETURNING updated_at, version`
 
 	args := []any{
@@ -320,15 +809,23 @@ func (m ReservationModel) Update(reservation *Reservation) error {
 		reservation.TotalAmount,
 		reservation.ID,
 		reservation.Version,
+		pq.Array(transitionSources(reservationTransitions, reservation.Status)),
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&reservation.UpdatedAt, &reservation.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
+			// Either the version moved on or the status change isn't allowed
+			var from string
+			var version int
+			err = m.DB.QueryRowContext(ctx, `SELECT status, version FROM reservations WHERE id = $1`, reservation.ID).Scan(&from, &version)
+			if err == nil && version == reservation.Version && from != reservation.Status {
+				return &TransitionError{From: from, To: reservation.Status}
+			}
 			return ErrEditConflict
 		default:
 			return err
@@ -338,16 +835,26 @@ func (m ReservationModel) Update(reservation *Reservation) error {
 	return nil
 }
 
-func (m ReservationModel) UpdateStatus(id uuid.UUID, status string) error {
+// transition moves a reservation to a new status, checking the state machine
+// first. set holds any extra assignments; their placeholders start at $3.
+func (m ReservationModel) transition(id uuid.UUID, to string, set string, args ...any) error {
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := checkTransition(ctx, m.DB, "reservations", reservationTransitions, id, to)
+	if err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE reservations
-		SET status = $1, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $2`
+		SET status = $1, ` + set + `updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND status = ANY($` + fmt.Sprint(len(args)+3) + `)`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	args = append([]any{to, id}, args...)
+	args = append(args, pq.Array(transitionSources(reservationTransitions, to)))
 
-	result, err := m.DB.ExecContext(ctx, query, status, id)
+	result, err := m.DB.ExecContext(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -357,23 +864,27 @@ func (m ReservationModel) UpdateStatus(id uuid.UUID, status string) error {
 		return err
 	}
 
+	// The status changed between the check and the update
 	if rowsAffected == 0 {
-		return ErrRecordNotFound
+		return ErrEditConflict
 	}
 
 	return nil
 }
 
-func (m ReservationModel) CheckIn(id uuid.UUID, actualStartTime time.Time) error {
+// transitionTx is transition within tx. The update runs first so the row stays
+// locked until tx ends; only when it matches nothing is the state machine
+// checked to tell a move that isn't allowed from a lost race.
+func (m ReservationModel) transitionTx(ctx context.Context, tx *sql.Tx, id uuid.UUID, to string, set string, args ...any) error {
 	query := `
 		UPDATE reservations
-		SET actual_start_time = $1, status = $2, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $3 AND status = $4`
+		SET status = $1, ` + set + `updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND status = ANY($` + fmt.Sprint(len(args)+3) + `)`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	args = append([]any{to, id}, args...)
+	args = append(args, pq.Array(transitionSources(reservationTransitions, to)))
 
-	result, err := m.DB.ExecContext(ctx, query, actualStartTime, ReservationStatusActive, id, ReservationStatusConfirmed)
+	result, err := tx.ExecContext(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -384,48 +895,71 @@ func (m ReservationModel) CheckIn(id uuid.UUID, actualStartTime time.Time) error
 	}
 
 	if rowsAffected == 0 {
-		return ErrRecordNotFound
+		err = checkTransition(ctx, m.DB, "reservations", reservationTransitions, id, to)
+		if err != nil {
+			return err
+		}
+
+		// The status changed between the update and the check
+		return ErrEditConflict
 	}
 
 	return nil
 }
 
+func (m ReservationModel) UpdateStatus(id uuid.UUID, status string) error {
+	return m.transition(id, status, "")
+}
+
+func (m ReservationModel) CheckIn(id uuid.UUID, actualStartTime time.Time) error {
+	return m.transition(id, ReservationStatusActive, "actual_start_time = $3, ", actualStartTime)
+}
+
 func (m ReservationModel) CheckOut(id uuid.UUID, actualEndTime time.Time) error {
-	query := `
-		UPDATE reservations
-		SET actual_end_time = $1, status = $2, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $3 AND status = $4`
+	return m.transition(id, ReservationStatusCompleted, "actual_end_time = $3, ", actualEndTime)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// CheckOutWithRefund completes an active reservation and refunds amount of its
+// payment in the same transaction. A refund that fails leaves the reservation
+// active, so the checkout can be retried rather than the refund being lost;
+// a checkout that already happened fails the transition and refunds nothing.
+// With a nil payment or a zero amount it is the same as CheckOut.
+func (m ReservationModel) CheckOutWithRefund(id uuid.UUID, actualEndTime time.Time, payment *Payment, amount Money) error {
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, actualEndTime, ReservationStatusCompleted, id, ReservationStatusActive)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
+	err = m.transitionTx(ctx, tx, id, ReservationStatusCompleted, "actual_end_time = $3, ", actualEndTime)
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	if payment != nil && amount > 0 {
+		err = PaymentModel{DB: m.DB}.refundTx(ctx, tx, payment, amount)
+		if err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return tx.Commit()
 }
 
 func (m ReservationModel) Cancel(id uuid.UUID) error {
-	query := `
-		UPDATE reservations
-		SET status = $1, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $2 AND status IN ($3, $4)`
+	return m.transition(id, ReservationStatusCancelled, "")
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m ReservationModel) Delete(id uuid.UUID) error {
+	query := `DELETE FROM reservations WHERE id = $1`
+
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, ReservationStatusCancelled, id, ReservationStatusPending, ReservationStatusConfirmed)
+	result, err := m.DB.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -442,38 +976,257 @@ func (m ReservationModel) Cancel(id uuid.UUID) error {
 	return nil
 }
 
-func (m ReservationModel) Delete(id uuid.UUID) error {
-	query := `DELETE FROM reservations WHERE id = $1`
+func (m ReservationModel) ExpireOverdue() error {
+	query := `
+		UPDATE reservations
+		SET status = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE status = ANY($2) AND end_time < NOW()`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	_, err := m.DB.ExecContext(ctx, query, ReservationStatusExpired, pq.Array(transitionSources(reservationTransitions, ReservationStatusExpired)))
+	return err
+}
+
+// GetUpcomingForReminders returns confirmed reservations that haven't been
+// reminded yet and whose start falls within their owner's reminder lead time
+// of now. Each user's window is computed from their own preference.
+func (m ReservationModel) GetUpcomingForReminders(now time.Time) ([]*Reservation, error) {
+	query := `
+		SELECT r.id, r.user_id, r.vehicle_id, r.parking_lot_id, r.parking_spot_id, r.start_time, r.end_time, r.actual_start_time, r.actual_end_time, r.status, r.total_amount, r.created_at, r.updated_at, r.version
+		FROM reservations r
+		INNER JOIN users u ON u.id = r.user_id
+		WHERE r.status = $1
+		AND r.reminder_sent_at IS NULL
+		AND u.deleted_at IS NULL
+		AND r.start_time > $2
+		AND r.start_time <= $2 + make_interval(mins => u.reminder_lead_minutes)
+		ORDER BY r.start_time ASC`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, ReservationStatusConfirmed, now)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	rowsAffected, err := result.RowsAffected()
+	reservations := []*Reservation{}
+
+	for rows.Next() {
+		var reservation Reservation
+
+		err := rows.Scan(
+			&reservation.ID,
+			&reservation.UserID,
+			&reservation.VehicleID,
+			&reservation.ParkingLotID,
+			&reservation.ParkingSpotID,
+			&reservation.StartTime,
+			&reservation.EndTime,
+			&reservation.ActualStartTime,
+			&reservation.ActualEndTime,
+			&reservation.Status,
+			&reservation.TotalAmount,
+			&reservation.CreatedAt,
+			&reservation.UpdatedAt,
+			&reservation.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		reservations = append(reservations, &reservation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reservations, nil
+}
+
+func (m ReservationModel) MarkReminderSent(id uuid.UUID, sentAt time.Time) error {
+	query := `
+		UPDATE reservations
+		SET reminder_sent_at = $1
+		WHERE id = $2`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, sentAt, id)
+	return err
+}
+
+// MaintenanceAffectedReservation is an upcoming reservation whose spot has been
+// put under maintenance, along with the reason given for the maintenance.
+type MaintenanceAffectedReservation struct {
+	Reservation
+	SpotNumber        string  `json:"spot_number"`
+	MaintenanceReason *string `json:"maintenance_reason"`
+}
+
+const maintenanceAffectedColumns = `
+		SELECT r.id, r.user_id, r.vehicle_id, r.parking_lot_id, r.parking_spot_id, r.start_time, r.end_time, r.actual_start_time, r.actual_end_time, r.status, r.total_amount, r.created_at, r.updated_at, r.version,
+		       s.spot_number, s.maintenance_reason
+		FROM reservations r
+		INNER JOIN parking_spots s ON s.id = r.parking_spot_id`
+
+type maintenanceAffectedScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMaintenanceAffected(row maintenanceAffectedScanner) (*MaintenanceAffectedReservation, error) {
+	var reservation MaintenanceAffectedReservation
+
+	err := row.Scan(
+		&reservation.ID,
+		&reservation.UserID,
+		&reservation.VehicleID,
+		&reservation.ParkingLotID,
+		&reservation.ParkingSpotID,
+		&reservation.StartTime,
+		&reservation.EndTime,
+		&reservation.ActualStartTime,
+		&reservation.ActualEndTime,
+		&reservation.Status,
+		&reservation.TotalAmount,
+		&reservation.CreatedAt,
+		&reservation.UpdatedAt,
+		&reservation.Version,
+		&reservation.SpotNumber,
+		&reservation.MaintenanceReason,
+	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	return &reservation, nil
+}
+
+// GetAffectedByMaintenance returns pending and confirmed reservations that
+// haven't ended yet, sit on a spot under maintenance, and whose holder hasn't
+// been told about it.
+func (m ReservationModel) GetAffectedByMaintenance() ([]*MaintenanceAffectedReservation, error) {
+	query := maintenanceAffectedColumns + `
+		WHERE s.status = $1
+		AND r.status IN ($2, $3)
+		AND r.end_time > NOW()
+		AND r.maintenance_notified_at IS NULL
+		ORDER BY r.start_time ASC`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, SpotStatusMaintenance, ReservationStatusPending, ReservationStatusConfirmed)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return nil
+	affected := []*MaintenanceAffectedReservation{}
+
+	for rows.Next() {
+		reservation, err := scanMaintenanceAffected(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		affected = append(affected, reservation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return affected, nil
 }
 
-func (m ReservationModel) ExpireOverdue() error {
+func (m ReservationModel) MarkMaintenanceNotified(id uuid.UUID, notifiedAt time.Time) error {
 	query := `
 		UPDATE reservations
-		SET status = $1, updated_at = CURRENT_TIMESTAMP
-		WHERE status = $2 AND end_time < NOW()`
+		SET maintenance_notified_at = $1
+		WHERE id = $2`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, ReservationStatusExpired, ReservationStatusConfirmed)
+	_, err := m.DB.ExecContext(ctx, query, notifiedAt, id)
 	return err
 }
+
+// CalendarReservation is a reservation with the lot and spot details shown in
+// a calendar feed.
+type CalendarReservation struct {
+	Reservation
+	LotName    string  `json:"lot_name"`
+	LotAddress string  `json:"lot_address"`
+	SpotNumber *string `json:"spot_number"`
+}
+
+// GetUpcomingForCalendar returns the user's pending, confirmed and active
+// reservations that haven't ended by now, soonest first.
+func (m ReservationModel) GetUpcomingForCalendar(userID uuid.UUID, now time.Time) ([]*CalendarReservation, error) {
+	query := `
+		SELECT r.id, r.user_id, r.vehicle_id, r.parking_lot_id, r.parking_spot_id, r.start_time, r.end_time, r.actual_start_time, r.actual_end_time, r.status, r.total_amount, r.created_at, r.updated_at, r.version,
+		       pl.name, pl.address, s.spot_number
+		FROM reservations r
+		INNER JOIN parking_lots pl ON pl.id = r.parking_lot_id
+		LEFT JOIN parking_spots s ON s.id = r.parking_spot_id
+		WHERE r.user_id = $1
+		AND r.status IN ($2, $3, $4)
+		AND r.end_time > $5
+		ORDER BY r.start_time ASC
+		LIMIT 500`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	args := []any{userID, ReservationStatusPending, ReservationStatusConfirmed, ReservationStatusActive, now}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reservations := []*CalendarReservation{}
+
+	for rows.Next() {
+		var reservation CalendarReservation
+
+		err := rows.Scan(
+			&reservation.ID,
+			&reservation.UserID,
+			&reservation.VehicleID,
+			&reservation.ParkingLotID,
+			&reservation.ParkingSpotID,
+			&reservation.StartTime,
+			&reservation.EndTime,
+			&reservation.ActualStartTime,
+			&reservation.ActualEndTime,
+			&reservation.Status,
+			&reservation.TotalAmount,
+			&reservation.CreatedAt,
+			&reservation.UpdatedAt,
+			&reservation.Version,
+			&reservation.LotName,
+			&reservation.LotAddress,
+			&reservation.SpotNumber,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		reservations = append(reservations, &reservation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reservations, nil
+}
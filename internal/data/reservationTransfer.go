@@ -0,0 +1,127 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrReservationNotOwned        = errors.New("reservation belongs to another user")
+	ErrReservationNotTransferable = errors.New("only upcoming confirmed reservations can be transferred")
+	ErrNoCompatibleVehicle        = errors.New("recipient has no vehicle of the reserved type")
+)
+
+// Transfer gives a reservation to another user. Only the owner can transfer
+// it, and only while it is confirmed and hasn't started. The booking was priced
+// for the reserved vehicle's type, so the recipient must have a vehicle of the
+// same type; their default one is preferred. Recipients must also be eligible
+// for the reserved spot's type.
+//
+// The new owner and vehicle, the audit record and the revocation of the old
+// owner's reservation passes are written in one transaction.
+func (m ReservationModel) Transfer(id, fromUserID, toUserID uuid.UUID) error {
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT r.user_id, r.vehicle_id, v.vehicle_type, COALESCE(spot.spot_type, $2), r.status = $3 AND r.start_time > NOW()
+		FROM reservations r
+		INNER JOIN vehicles v ON v.id = r.vehicle_id
+		LEFT JOIN parking_spots spot ON spot.id = r.parking_spot_id
+		WHERE r.id = $1
+		FOR UPDATE OF r`
+
+	var ownerID, fromVehicleID uuid.UUID
+	var vehicleType, spotType string
+	var transferable bool
+
+	err = tx.QueryRowContext(ctx, query, id, SpotTypeRegular, ReservationStatusConfirmed).Scan(&ownerID, &fromVehicleID, &vehicleType, &spotType, &transferable)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	switch {
+	case ownerID != fromUserID:
+		return ErrReservationNotOwned
+	case !transferable:
+		return ErrReservationNotTransferable
+	}
+
+	recipient := &User{ID: toUserID}
+
+	query = `SELECT has_disability_permit FROM users WHERE id = $1 AND deleted_at IS NULL`
+
+	err = tx.QueryRowContext(ctx, query, toUserID).Scan(&recipient.HasDisabilityPermit)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	err = recipient.CheckSpotEligibility(spotType)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		SELECT id
+		FROM vehicles
+		WHERE user_id = $1 AND vehicle_type = $2
+		ORDER BY is_default DESC, created_at ASC, id ASC
+		LIMIT 1`
+
+	var toVehicleID uuid.UUID
+
+	err = tx.QueryRowContext(ctx, query, toUserID, vehicleType).Scan(&toVehicleID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNoCompatibleVehicle
+		default:
+			return err
+		}
+	}
+
+	query = `
+		UPDATE reservations
+		SET user_id = $1, vehicle_id = $2, reminder_sent_at = NULL, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $3`
+
+	_, err = tx.ExecContext(ctx, query, toUserID, toVehicleID, id)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO reservation_transfers (reservation_id, from_user_id, to_user_id, from_vehicle_id, to_vehicle_id)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	_, err = tx.ExecContext(ctx, query, id, fromUserID, toUserID, fromVehicleID, toVehicleID)
+	if err != nil {
+		return err
+	}
+
+	// Passes were issued to the old owner's vehicle
+	_, err = tx.ExecContext(ctx, `UPDATE qr_codes SET is_active = false, updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE reservation_id = $1 AND is_active = true`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
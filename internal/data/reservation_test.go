@@ -0,0 +1,656 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+func TestGetUpcomingForRemindersHonorsLeadTime(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	lot, spots := insertTestLot(t, m, owner.ID, 2)
+
+	early := insertTestUser(t, m)
+	late := insertTestUser(t, m)
+	if err := m.Users.SetReminderLeadMinutes(early.ID, 120); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Users.SetReminderLeadMinutes(late.ID, 15); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().AddDate(0, 1, 0).Truncate(time.Hour)
+	earlyReservation := insertTestReservation(t, m, insertTestVehicle(t, m, early.ID), lot.ID, spots[0], start, time.Hour)
+	lateReservation := insertTestReservation(t, m, insertTestVehicle(t, m, late.ID), lot.ID, spots[1], start, time.Hour)
+
+	due := func(now time.Time) map[uuid.UUID]bool {
+		t.Helper()
+		reservations, err := m.Reservations.GetUpcomingForReminders(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := map[uuid.UUID]bool{}
+		for _, r := range reservations {
+			ids[r.ID] = true
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name      string
+		now       time.Time
+		wantEarly bool
+		wantLate  bool
+	}{
+		{"three hours ahead", start.Add(-3 * time.Hour), false, false},
+		{"two hours ahead", start.Add(-2 * time.Hour), true, false},
+		{"an hour ahead", start.Add(-time.Hour), true, false},
+		{"fifteen minutes ahead", start.Add(-15 * time.Minute), true, true},
+		{"at the start", start, false, false},
+	}
+
+	for _, tt := range tests {
+		got := due(tt.now)
+		if got[earlyReservation.ID] != tt.wantEarly {
+			t.Errorf("%s: 120 minute lead reminded = %t; want %t", tt.name, got[earlyReservation.ID], tt.wantEarly)
+		}
+		if got[lateReservation.ID] != tt.wantLate {
+			t.Errorf("%s: 15 minute lead reminded = %t; want %t", tt.name, got[lateReservation.ID], tt.wantLate)
+		}
+	}
+
+	if err := m.Reservations.MarkReminderSent(earlyReservation.ID, start.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if due(start.Add(-15 * time.Minute))[earlyReservation.ID] {
+		t.Error("reservation is reminded again after MarkReminderSent")
+	}
+}
+
+func TestValidateReservationWindow(t *testing.T) {
+	day := func(hour, minute int) time.Time {
+		return time.Date(2025, 3, 10, hour, minute, 0, 0, time.UTC)
+	}
+
+	daytime := &ParkingLot{OpenTime: "08:00", CloseTime: "20:00", Timezone: "UTC"}
+	overnight := &ParkingLot{OpenTime: "18:00", CloseTime: "06:00", Timezone: "UTC"}
+	allDay := &ParkingLot{OpenTime: "00:00", CloseTime: "00:00", Timezone: "UTC"}
+
+	tests := []struct {
+		name    string
+		lot     *ParkingLot
+		start   time.Time
+		end     time.Time
+		wantKey string
+	}{
+		{"fully within hours", daytime, day(9, 0), day(17, 0), ""},
+		{"ends exactly at closing", daytime, day(18, 0), day(20, 0), ""},
+		{"spans closing time", daytime, day(19, 0), day(21, 0), "end_time"},
+		{"starts before opening", daytime, day(7, 0), day(9, 0), "start_time"},
+		{"runs into the next day", daytime, day(9, 0), day(9, 0).AddDate(0, 0, 1), "end_time"},
+		{"overnight across midnight", overnight, day(22, 0), day(5, 0).AddDate(0, 0, 1), ""},
+		{"overnight past closing", overnight, day(22, 0), day(7, 0).AddDate(0, 0, 1), "end_time"},
+		{"overnight while closed", overnight, day(12, 0), day(13, 0), "start_time"},
+		{"24h lot accepts anything", allDay, day(3, 0), day(3, 0).AddDate(0, 0, 2), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateReservationWindow(v, tt.lot, tt.start, tt.end)
+
+			if tt.wantKey == "" {
+				if !v.Valid() {
+					t.Errorf("unexpected errors: %v", v.Errors)
+				}
+				return
+			}
+			if _, ok := v.Errors[tt.wantKey]; !ok || len(v.Errors) != 1 {
+				t.Errorf("got errors %v; want one for %q", v.Errors, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestValidateReservationWindowUsesLotTimezone(t *testing.T) {
+	colombo, err := time.LoadLocation("Asia/Colombo")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	lot := &ParkingLot{OpenTime: "08:00", CloseTime: "20:00", Timezone: "Asia/Colombo"}
+
+	// 03:00 UTC is 08:30 in Colombo, and 14:00 UTC is 19:30.
+	start := time.Date(2025, 3, 10, 3, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 3, 10, 14, 0, 0, 0, time.UTC)
+
+	v := validator.New()
+	if ValidateReservationWindow(v, lot, start, end); !v.Valid() {
+		t.Errorf("window within local hours rejected: %v", v.Errors)
+	}
+
+	if got, want := lot.ClosesAfter(start), time.Date(2025, 3, 10, 20, 0, 0, 0, colombo); !got.Equal(want) {
+		t.Errorf("ClosesAfter: got %s; want %s", got, want)
+	}
+}
+
+func TestValidateReservationLimits(t *testing.T) {
+	now := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	days := func(n int) *int { return &n }
+
+	defaults := &ParkingLot{}
+	strict := &ParkingLot{MaxReservationDays: days(2), MaxAdvanceDays: days(7)}
+
+	tests := []struct {
+		name    string
+		lot     *ParkingLot
+		start   time.Time
+		end     time.Time
+		wantKey string
+	}{
+		{"within the defaults", defaults, now.Add(time.Hour), now.AddDate(0, 0, 30).Add(time.Hour), ""},
+		{"longer than the default", defaults, now.Add(time.Hour), now.AddDate(0, 0, 30).Add(2 * time.Hour), "end_time"},
+		{"furthest default advance", defaults, now.AddDate(0, 0, 90), now.AddDate(0, 0, 90).Add(time.Hour), ""},
+		{"beyond the default advance", defaults, now.AddDate(0, 0, 90).Add(time.Minute), now.AddDate(0, 0, 91), "start_time"},
+		{"within the lot's limits", strict, now.AddDate(0, 0, 5), now.AddDate(0, 0, 7), ""},
+		{"longer than the lot allows", strict, now.AddDate(0, 0, 1), now.AddDate(0, 0, 3).Add(time.Minute), "end_time"},
+		{"further ahead than the lot allows", strict, now.AddDate(0, 0, 8), now.AddDate(0, 0, 8).Add(time.Hour), "start_time"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateReservationLimits(v, tt.lot, tt.start, tt.end, now)
+
+			if tt.wantKey == "" {
+				if !v.Valid() {
+					t.Errorf("unexpected errors: %v", v.Errors)
+				}
+				return
+			}
+			if _, ok := v.Errors[tt.wantKey]; !ok || len(v.Errors) != 1 {
+				t.Errorf("got errors %v; want one for %q", v.Errors, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestValidateReservationLimitsFollowsDefaults(t *testing.T) {
+	maxDays, advanceDays := DefaultMaxReservationDays, DefaultMaxAdvanceDays
+	t.Cleanup(func() {
+		DefaultMaxReservationDays, DefaultMaxAdvanceDays = maxDays, advanceDays
+	})
+	DefaultMaxReservationDays, DefaultMaxAdvanceDays = 1, 3
+
+	now := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	lot := &ParkingLot{}
+
+	v := validator.New()
+	ValidateReservationLimits(v, lot, now.AddDate(0, 0, 4), now.AddDate(0, 0, 6), now)
+	if _, ok := v.Errors["start_time"]; !ok {
+		t.Errorf("booking past the default advance window accepted: %v", v.Errors)
+	}
+	if _, ok := v.Errors["end_time"]; !ok {
+		t.Errorf("booking longer than the default limit accepted: %v", v.Errors)
+	}
+}
+
+func TestValidateReservationMinLeadTime(t *testing.T) {
+	now := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	lot := &ParkingLot{MinLeadMinutes: 30}
+
+	tests := []struct {
+		name  string
+		lot   *ParkingLot
+		start time.Time
+		valid bool
+	}{
+		{"too soon", lot, now.Add(29*time.Minute + 59*time.Second), false},
+		{"at the lead time", lot, now.Add(30 * time.Minute), true},
+		{"just past the lead time", lot, now.Add(30*time.Minute + time.Second), true},
+		{"no lead time", &ParkingLot{}, now.Add(time.Second), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateReservationLimits(v, tt.lot, tt.start, tt.start.Add(time.Hour), now)
+
+			if tt.valid && !v.Valid() {
+				t.Errorf("unexpected errors: %v", v.Errors)
+			}
+			if !tt.valid && v.Errors["start_time"] != "must be at least 30 minutes from now" {
+				t.Errorf("start_time error = %q", v.Errors["start_time"])
+			}
+		})
+	}
+
+	for _, minutes := range []int{-1, 1441} {
+		v := validator.New()
+		ValidateParkingLot(v, &ParkingLot{MinLeadMinutes: minutes})
+		if _, ok := v.Errors["min_lead_minutes"]; !ok {
+			t.Errorf("lead time of %d minutes accepted", minutes)
+		}
+	}
+}
+
+func TestValidateParkingLotBookingLimits(t *testing.T) {
+	days := func(n int) *int { return &n }
+
+	tests := []struct {
+		name    string
+		lot     *ParkingLot
+		wantKey string
+	}{
+		{"no length", &ParkingLot{MaxReservationDays: days(0)}, "max_reservation_days"},
+		{"over a year", &ParkingLot{MaxReservationDays: days(367)}, "max_reservation_days"},
+		{"no advance", &ParkingLot{MaxAdvanceDays: days(0)}, "max_advance_days"},
+		{"over two years ahead", &ParkingLot{MaxAdvanceDays: days(731)}, "max_advance_days"},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateParkingLot(v, tt.lot)
+		if _, ok := v.Errors[tt.wantKey]; !ok {
+			t.Errorf("%s: no %s error", tt.name, tt.wantKey)
+		}
+	}
+
+	v := validator.New()
+	ValidateParkingLot(v, &ParkingLot{MaxReservationDays: days(366), MaxAdvanceDays: days(730)})
+	for _, key := range []string{"max_reservation_days", "max_advance_days"} {
+		if msg, ok := v.Errors[key]; ok {
+			t.Errorf("upper limits rejected: %s %q", key, msg)
+		}
+	}
+}
+
+func TestReservationAdmitsAt(t *testing.T) {
+	start := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	reservation := &Reservation{StartTime: start, EndTime: start.Add(2 * time.Hour)}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want bool
+	}{
+		{"well before the start", start.Add(-time.Hour), false},
+		{"just before early arrival opens", start.Add(-ReservationEarlyArrival - time.Second), false},
+		{"early arrival", start.Add(-ReservationEarlyArrival), true},
+		{"at the start", start, true},
+		{"during", start.Add(time.Hour), true},
+		{"at the end", start.Add(2 * time.Hour), false},
+		{"after the end", start.Add(3 * time.Hour), false},
+	}
+
+	for _, tt := range tests {
+		if got := reservation.AdmitsAt(tt.at); got != tt.want {
+			t.Errorf("%s: got %t; want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBatchInsertPartialSuccess(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+	lot, _ := insertTestLot(t, m, user.ID, 2)
+
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Hour)
+
+	item := func(start time.Time) *BatchReservation {
+		return &BatchReservation{
+			Reservation: &Reservation{
+				UserID:       user.ID,
+				VehicleID:    insertTestVehicle(t, m, user.ID).ID,
+				ParkingLotID: lot.ID,
+				StartTime:    start,
+				EndTime:      start.Add(2 * time.Hour),
+				Status:       ReservationStatusConfirmed,
+				TotalAmount:  MoneyFromFloat(200),
+			},
+			SpotTypes: []string{SpotTypeRegular},
+		}
+	}
+
+	items := []*BatchReservation{
+		item(start),
+		item(start),
+		item(start.Add(time.Hour)), // overlaps both: the lot is full
+		item(start.Add(4 * time.Hour)),
+	}
+
+	if err := m.Reservations.BatchInsert(items); err != nil {
+		t.Fatal(err)
+	}
+
+	spots := map[uuid.UUID]bool{}
+	for i, want := range []bool{true, true, false, true} {
+		got := items[i]
+		if want {
+			if got.Err != nil || got.Reservation.ID == uuid.Nil || got.Reservation.ParkingSpotID == nil {
+				t.Errorf("item %d: got error %v, id %s; want it created with a spot", i, got.Err, got.Reservation.ID)
+				continue
+			}
+			if i < 2 {
+				spots[*got.Reservation.ParkingSpotID] = true
+			}
+			continue
+		}
+
+		if !errors.Is(got.Err, ErrNoSpotAvailable) {
+			t.Errorf("item %d: got error %v; want ErrNoSpotAvailable", i, got.Err)
+		}
+		if got.Reservation.ParkingSpotID != nil {
+			t.Errorf("item %d: failed item kept a spot", i)
+		}
+	}
+	if len(spots) != 2 {
+		t.Error("overlapping reservations in the batch share a spot")
+	}
+
+	var count int
+	err := m.Reservations.DB.QueryRow(`SELECT count(*) FROM reservations WHERE parking_lot_id = $1`, lot.ID).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("got %d reservations saved; want 3", count)
+	}
+}
+
+func TestTransferReservation(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	recipient := insertTestUser(t, m)
+	stranger := insertTestUser(t, m)
+	lot, spots := insertTestLot(t, m, owner.ID, 2)
+
+	ownerVehicle := insertTestVehicle(t, m, owner.ID)
+	recipientVehicle := insertTestVehicle(t, m, recipient.ID)
+
+	start := time.Now().Add(24 * time.Hour)
+	reservation := insertTestReservation(t, m, ownerVehicle, lot.ID, spots[0], start, time.Hour)
+
+	// Only the owner can give the reservation away
+	err := m.Reservations.Transfer(reservation.ID, stranger.ID, recipient.ID)
+	if !errors.Is(err, ErrReservationNotOwned) {
+		t.Errorf("non-owner transfer: err = %v, want %v", err, ErrReservationNotOwned)
+	}
+
+	// The recipient needs a vehicle of the booked type
+	err = m.Reservations.Transfer(reservation.ID, owner.ID, stranger.ID)
+	if !errors.Is(err, ErrNoCompatibleVehicle) {
+		t.Errorf("recipient without a vehicle: err = %v, want %v", err, ErrNoCompatibleVehicle)
+	}
+
+	err = m.Reservations.Transfer(reservation.ID, owner.ID, recipient.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := m.Reservations.Get(reservation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.UserID != recipient.ID || stored.VehicleID != recipientVehicle.ID {
+		t.Errorf("after transfer: user %s, vehicle %s; want %s, %s", stored.UserID, stored.VehicleID, recipient.ID, recipientVehicle.ID)
+	}
+	if stored.Version != reservation.Version+1 {
+		t.Errorf("version = %d, want %d", stored.Version, reservation.Version+1)
+	}
+
+	var transfers int
+	err = m.Reservations.DB.QueryRow(`SELECT COUNT(*) FROM reservation_transfers WHERE reservation_id = $1 AND from_user_id = $2 AND to_user_id = $3`,
+		reservation.ID, owner.ID, recipient.ID).Scan(&transfers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transfers != 1 {
+		t.Errorf("got %d audit records, want 1", transfers)
+	}
+
+	// The old owner can't take it back
+	err = m.Reservations.Transfer(reservation.ID, owner.ID, owner.ID)
+	if !errors.Is(err, ErrReservationNotOwned) {
+		t.Errorf("transfer by the previous owner: err = %v, want %v", err, ErrReservationNotOwned)
+	}
+
+	// Reservations that have started can't be transferred
+	past := insertTestReservation(t, m, ownerVehicle, lot.ID, spots[1], time.Now().Add(-time.Hour), 2*time.Hour)
+	err = m.Reservations.Transfer(past.ID, owner.ID, recipient.ID)
+	if !errors.Is(err, ErrReservationNotTransferable) {
+		t.Errorf("started reservation: err = %v, want %v", err, ErrReservationNotTransferable)
+	}
+
+	if err := m.Reservations.Transfer(uuid.New(), owner.ID, recipient.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("unknown reservation: err = %v, want %v", err, ErrRecordNotFound)
+	}
+}
+
+func TestTransferReservationChecksSpotEligibility(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	recipient := insertTestUser(t, m)
+	lot, _ := insertTestLot(t, m, owner.ID, 0)
+
+	spot := &ParkingSpot{ParkingLotID: lot.ID, SpotNumber: "H1", SpotType: SpotTypeHandicapped, Status: SpotStatusActive}
+	if err := m.ParkingSpots.Insert(spot); err != nil {
+		t.Fatal(err)
+	}
+
+	insertTestVehicle(t, m, recipient.ID)
+	reservation := insertTestReservation(t, m, insertTestVehicle(t, m, owner.ID), lot.ID, spot, time.Now().Add(24*time.Hour), time.Hour)
+
+	err := m.Reservations.Transfer(reservation.ID, owner.ID, recipient.ID)
+	if !errors.Is(err, ErrNotEligibleForSpot) {
+		t.Errorf("recipient without a permit: err = %v, want %v", err, ErrNotEligibleForSpot)
+	}
+
+	if err := m.Users.SubmitDisabilityPermit(recipient.ID, "DP-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Users.SetDisabilityPermitVerified(recipient.ID, "DP-1", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reservations.Transfer(reservation.ID, owner.ID, recipient.ID); err != nil {
+		t.Errorf("recipient with a permit: %v", err)
+	}
+}
+
+func TestGetForecast(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	lot, spots := insertTestLot(t, m, owner.ID, 1)
+	other, otherSpots := insertTestLot(t, m, owner.ID, 1)
+	vehicle := insertTestVehicle(t, m, owner.ID)
+
+	from := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	to := from.Add(7 * 24 * time.Hour)
+
+	book := func(lotID uuid.UUID, spot *ParkingSpot, start time.Time, amount float64, status string) {
+		t.Helper()
+
+		reservation := insertTestReservation(t, m, vehicle, lotID, spot, start, time.Hour)
+		_, err := m.Reservations.DB.Exec(`UPDATE reservations SET total_amount = $1, status = $2 WHERE id = $3`, amount, status, reservation.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	book(lot.ID, spots[0], from, 120.50, ReservationStatusConfirmed)
+	book(lot.ID, spots[0], from.Add(48*time.Hour), 80.25, ReservationStatusConfirmed)
+	book(lot.ID, spots[0], from.Add(72*time.Hour), 40, ReservationStatusActive)
+
+	// None of these count towards the forecast
+	book(lot.ID, spots[0], from.Add(24*time.Hour), 500, ReservationStatusCancelled)
+	book(lot.ID, spots[0], from.Add(-time.Hour), 500, ReservationStatusConfirmed)
+	book(lot.ID, spots[0], to, 500, ReservationStatusConfirmed)
+	book(other.ID, otherSpots[0], from, 500, ReservationStatusConfirmed)
+
+	forecast, err := m.Reservations.GetForecast(lot.ID, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forecast != 240.75 {
+		t.Errorf("forecast = %v, want 240.75", forecast)
+	}
+
+	for _, window := range [][2]time.Time{{from, from}, {to, from}} {
+		forecast, err := m.Reservations.GetForecast(lot.ID, window[0], window[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if forecast != 0 {
+			t.Errorf("empty window %v to %v forecast %v, want 0", window[0], window[1], forecast)
+		}
+	}
+}
+
+func TestGetUnpaidCompleted(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	lot, spots := insertTestLot(t, m, owner.ID, 1)
+	vehicle := insertTestVehicle(t, m, owner.ID)
+
+	start := time.Now().Add(-10 * 24 * time.Hour)
+	book := func(day int, status string) *Reservation {
+		t.Helper()
+
+		reservation := insertTestReservation(t, m, vehicle, lot.ID, spots[0], start.AddDate(0, 0, day), time.Hour)
+		_, err := m.Reservations.DB.Exec(`UPDATE reservations SET status = $1 WHERE id = $2`, status, reservation.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reservation
+	}
+
+	paid := book(0, ReservationStatusCompleted)
+	insertTestPayment(t, m, paid, 100, PaymentStatusCompleted)
+
+	split := book(1, ReservationStatusCompleted)
+	insertTestPayment(t, m, split, 60, PaymentStatusCompleted)
+	insertTestPayment(t, m, split, 40, PaymentStatusCompleted)
+
+	partial := book(2, ReservationStatusCompleted)
+	insertTestPayment(t, m, partial, 60, PaymentStatusCompleted)
+	insertTestPayment(t, m, partial, 40, PaymentStatusPending)
+
+	unpaid := book(3, ReservationStatusCompleted)
+	insertTestPayment(t, m, unpaid, 100, PaymentStatusFailed)
+
+	// Only completed reservations are reconciled
+	book(4, ReservationStatusConfirmed)
+
+	filters := Filters{Page: 1, PageSize: 20, Sort: "start_time", SortSafelist: []string{"start_time"}}
+	reservations, metadata, err := m.Reservations.GetUnpaidCompleted(lot.ID, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reservations) != 2 || metadata.TotalRecords != 2 {
+		t.Fatalf("got %d reservations (%d total); want 2", len(reservations), metadata.TotalRecords)
+	}
+	if reservations[0].ID != partial.ID || reservations[1].ID != unpaid.ID {
+		t.Errorf("got %s, %s; want the partially paid %s and the unpaid %s", reservations[0].ID, reservations[1].ID, partial.ID, unpaid.ID)
+	}
+}
+
+func TestReservationsAreHeldToLotCapacity(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+	lot, _ := insertTestLot(t, m, user.ID, 2)
+	vehicle := insertTestVehicle(t, m, user.ID)
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	book := func(start time.Time, status string) error {
+		return m.Reservations.Insert(&Reservation{
+			UserID:       user.ID,
+			VehicleID:    vehicle.ID,
+			ParkingLotID: lot.ID,
+			StartTime:    start,
+			EndTime:      start.Add(2 * time.Hour),
+			Status:       status,
+			TotalAmount:  MoneyFromFloat(100),
+		})
+	}
+
+	// Cancelled bookings don't take up room
+	if err := book(start, ReservationStatusCancelled); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 2 {
+		if err := book(start.Add(time.Duration(i)*time.Hour), ReservationStatusConfirmed); err != nil {
+			t.Fatalf("booking %d of 2: %v", i+1, err)
+		}
+	}
+
+	count, err := m.Reservations.CountOverlapping(lot.ID, start.Add(time.Hour), start.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("got %d overlapping reservations; want 2", count)
+	}
+
+	// Both spot-less bookings overlap this window, so the lot is full
+	err = book(start.Add(time.Hour), ReservationStatusConfirmed)
+	if !errors.Is(err, ErrNoSpotAvailable) {
+		t.Errorf("third overlapping booking: got %v; want %v", err, ErrNoSpotAvailable)
+	}
+
+	// Windows that only touch the full one don't overlap it
+	if err := book(start.Add(3*time.Hour), ReservationStatusConfirmed); err != nil {
+		t.Errorf("booking after the full window: %v", err)
+	}
+	if err := book(start.Add(-2*time.Hour), ReservationStatusConfirmed); err != nil {
+		t.Errorf("booking before the full window: %v", err)
+	}
+}
+
+func TestCheckOutWithRefundIsAtomic(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+	lot, spots := insertTestLot(t, m, user.ID, 1)
+	vehicle := insertTestVehicle(t, m, user.ID)
+
+	reservation := insertTestReservation(t, m, vehicle, lot.ID, spots[0], time.Now(), time.Hour)
+	payment := insertTestPayment(t, m, reservation, 10, PaymentStatusCompleted)
+
+	if err := m.Reservations.CheckIn(reservation.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A refund larger than the payment fails, and the checkout with it
+	err := m.Reservations.CheckOutWithRefund(reservation.ID, time.Now(), payment, MoneyFromFloat(20))
+	if !errors.Is(err, ErrInvalidRefund) {
+		t.Fatalf("got %v; want ErrInvalidRefund", err)
+	}
+
+	stored, err := m.Reservations.Get(reservation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != ReservationStatusActive {
+		t.Fatalf("status after a failed refund: got %q; want %q", stored.Status, ReservationStatusActive)
+	}
+
+	// Retrying refunds once
+	if err := m.Reservations.CheckOutWithRefund(reservation.ID, time.Now(), payment, MoneyFromFloat(4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reservations.CheckOutWithRefund(reservation.ID, time.Now(), payment, MoneyFromFloat(4)); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("second checkout: got %v; want ErrInvalidTransition", err)
+	}
+
+	refunded, err := m.Payments.Get(payment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refunded.RefundedAmount != MoneyFromFloat(4) {
+		t.Errorf("refunded %s; want 4.00", refunded.RefundedAmount)
+	}
+}
@@ -1,22 +1,30 @@
 package data
 
 import (
-	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
 )
 
+var (
+	ErrDuplicateReport = errors.New("duplicate review report")
+)
+
 type Review struct {
 	ID           uuid.UUID `json:"id" db:"id"`
 	UserID       uuid.UUID `json:"user_id" db:"user_id"`
 	ParkingLotID uuid.UUID `json:"parking_lot_id" db:"parking_lot_id"`
 	Rating       int       `json:"rating" db:"rating"` // 1-5 stars
 	Comment      *string   `json:"comment" db:"comment"`
+	IsHidden     bool      `json:"is_hidden" db:"is_hidden"`
+	HiddenReason *string   `json:"hidden_reason,omitempty" db:"hidden_reason"`
+	IsFlagged    bool      `json:"is_flagged" db:"is_flagged"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 	Version      int       `json:"version" db:"version"`
@@ -31,8 +39,67 @@ func ValidateReview(v *validator.Validator, review *Review) {
 	}
 }
 
+// ReviewWithAuthor is a review as the public sees it. The author is shown by
+// display name only, never by user ID or email; see ReviewAuthorName.
+type ReviewWithAuthor struct {
+	ID           uuid.UUID `json:"id"`
+	ParkingLotID uuid.UUID `json:"parking_lot_id"`
+	Rating       int       `json:"rating"`
+	Comment      *string   `json:"comment"`
+	Author       string    `json:"author"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ReviewWithLot is a public review shown outside its lot's page, with the lot's
+// name.
+type ReviewWithLot struct {
+	ReviewWithAuthor
+	ParkingLotName string `json:"parking_lot_name"`
+}
+
+// MaxRecentReviews caps how many reviews the recent reviews feed returns.
+const MaxRecentReviews = 50
+
+// MaskUsername keeps the first and last characters of a username and hides the
+// rest, e.g. "johnny" becomes "j***y". Very short names keep only the first.
+func MaskUsername(username string) string {
+	runes := []rune(username)
+
+	switch {
+	case len(runes) == 0:
+		return ""
+	case len(runes) <= 2:
+		return string(runes[0]) + "***"
+	default:
+		return string(runes[0]) + "***" + string(runes[len(runes)-1])
+	}
+}
+
+// ReviewAuthorName is how a reviewer is named on public reviews. By default
+// that is their first name and last initial, e.g. "Jane D."; users who opt in
+// get their full name. Without a first name the masked username is used.
+func ReviewAuthorName(username string, firstName, lastName *string, showFullName bool) string {
+	if firstName == nil || strings.TrimSpace(*firstName) == "" {
+		return MaskUsername(username)
+	}
+
+	name := strings.TrimSpace(*firstName)
+	if lastName == nil || strings.TrimSpace(*lastName) == "" {
+		return name
+	}
+
+	last := strings.TrimSpace(*lastName)
+	if showFullName {
+		return name + " " + last
+	}
+
+	return name + " " + string([]rune(last)[0]) + "."
+}
+
 type ReviewModel struct {
 	DB *sql.DB
+	queryScope
 }
 
 func (m ReviewModel) Insert(review *Review) error {
@@ -48,7 +115,7 @@ func (m ReviewModel) Insert(review *Review) error {
 		review.Comment,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
@@ -66,13 +133,13 @@ func (m ReviewModel) Insert(review *Review) error {
 
 func (m ReviewModel) Get(id uuid.UUID) (*Review, error) {
 	query := `
-		SELECT id, user_id, parking_lot_id, rating, comment, created_at, updated_at, version
+		SELECT id, user_id, parking_lot_id, rating, comment, is_hidden, hidden_reason, is_flagged, created_at, updated_at, version
 		FROM reviews
 		WHERE id = $1`
 
 	var review Review
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
@@ -81,6 +148,9 @@ func (m ReviewModel) Get(id uuid.UUID) (*Review, error) {
 		&review.ParkingLotID,
 		&review.Rating,
 		&review.Comment,
+		&review.IsHidden,
+		&review.HiddenReason,
+		&review.IsFlagged,
 		&review.CreatedAt,
 		&review.UpdatedAt,
 		&review.Version,
@@ -100,15 +170,15 @@ func (m ReviewModel) Get(id uuid.UUID) (*Review, error) {
 
 func (m ReviewModel) GetByLot(lotID uuid.UUID, filters Filters) ([]*Review, Metadata, error) {
 	query := `
-		SELECT count(*) OVER(), id, user_id, parking_lot_id, rating, comment, created_at, updated_at, version
+		SELECT count(*) OVER(), id, user_id, parking_lot_id, rating, comment, is_hidden, hidden_reason, is_flagged, created_at, updated_at, version
 		FROM reviews
-		WHERE parking_lot_id = $1
+		WHERE parking_lot_id = $1 AND is_hidden = false
 		ORDER BY %s %s, id ASC
 		LIMIT $2 OFFSET $3`
 
 	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	args := []any{lotID, filters.limit(), filters.offset()}
@@ -132,6 +202,9 @@ func (m ReviewModel) GetByLot(lotID uuid.UUID, filters Filters) ([]*Review, Meta
 			&review.ParkingLotID,
 			&review.Rating,
 			&review.Comment,
+			&review.IsHidden,
+			&review.HiddenReason,
+			&review.IsFlagged,
 			&review.CreatedAt,
 			&review.UpdatedAt,
 			&review.Version,
@@ -154,7 +227,7 @@ func (m ReviewModel) GetByLot(lotID uuid.UUID, filters Filters) ([]*Review, Meta
 
 func (m ReviewModel) GetByUser(userID uuid.UUID, filters Filters) ([]*Review, Metadata, error) {
 	query := `
-		SELECT count(*) OVER(), id, user_id, parking_lot_id, rating, comment, created_at, updated_at, version
+		SELECT count(*) OVER(), id, user_id, parking_lot_id, rating, comment, is_hidden, hidden_reason, is_flagged, created_at, updated_at, version
 		FROM reviews
 		WHERE user_id = $1
 		ORDER BY %s %s, id ASC
@@ -162,7 +235,7 @@ func (m ReviewModel) GetByUser(userID uuid.UUID, filters Filters) ([]*Review, Me
 
 	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	args := []any{userID, filters.limit(), filters.offset()}
@@ -186,6 +259,9 @@ func (m ReviewModel) GetByUser(userID uuid.UUID, filters Filters) ([]*Review, Me
 			&review.ParkingLotID,
 			&review.Rating,
 			&review.Comment,
+			&review.IsHidden,
+			&review.HiddenReason,
+			&review.IsFlagged,
 			&review.CreatedAt,
 			&review.UpdatedAt,
 			&review.Version,
@@ -206,15 +282,139 @@ func (m ReviewModel) GetByUser(userID uuid.UUID, filters Filters) ([]*Review, Me
 	return reviews, metadata, nil
 }
 
+// GetByLotWithAuthors lists a lot's visible reviews like GetByLot, with each
+// author named by ReviewAuthorName instead of identified by user ID.
+func (m ReviewModel) GetByLotWithAuthors(lotID uuid.UUID, filters Filters) ([]*ReviewWithAuthor, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), r.id, r.parking_lot_id, r.rating, r.comment, r.created_at, r.updated_at,
+		       u.user_name, u.first_name, u.last_name, u.show_full_name
+		FROM reviews r
+		INNER JOIN users u ON u.id = r.user_id
+		WHERE r.parking_lot_id = $1 AND r.is_hidden = false
+		ORDER BY r.%s %s, r.id ASC
+		LIMIT $2 OFFSET $3`
+
+	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	args := []any{lotID, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []*ReviewWithAuthor{}
+
+	for rows.Next() {
+		var review ReviewWithAuthor
+		var username string
+		var firstName, lastName *string
+		var showFullName bool
+
+		err := rows.Scan(
+			&totalRecords,
+			&review.ID,
+			&review.ParkingLotID,
+			&review.Rating,
+			&review.Comment,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&username,
+			&firstName,
+			&lastName,
+			&showFullName,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		review.Author = ReviewAuthorName(username, firstName, lastName, showFullName)
+
+		reviews = append(reviews, &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return reviews, metadata, nil
+}
+
+// GetRecent returns the newest visible reviews across all active lots, up to
+// limit, for a homepage feed.
+func (m ReviewModel) GetRecent(limit int) ([]*ReviewWithLot, error) {
+	query := `
+		SELECT r.id, r.parking_lot_id, r.rating, r.comment, r.created_at, r.updated_at,
+		       u.user_name, u.first_name, u.last_name, u.show_full_name, pl.name
+		FROM reviews r
+		INNER JOIN parking_lots pl ON pl.id = r.parking_lot_id
+		INNER JOIN users u ON u.id = r.user_id
+		WHERE r.is_hidden = false AND pl.is_active = true
+		ORDER BY r.created_at DESC, r.id ASC
+		LIMIT $1`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []*ReviewWithLot{}
+
+	for rows.Next() {
+		var review ReviewWithLot
+		var username string
+		var firstName, lastName *string
+		var showFullName bool
+
+		err := rows.Scan(
+			&review.ID,
+			&review.ParkingLotID,
+			&review.Rating,
+			&review.Comment,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&username,
+			&firstName,
+			&lastName,
+			&showFullName,
+			&review.ParkingLotName,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		review.Author = ReviewAuthorName(username, firstName, lastName, showFullName)
+
+		reviews = append(reviews, &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reviews, nil
+}
+
 func (m ReviewModel) GetUserReviewForLot(userID, lotID uuid.UUID) (*Review, error) {
 	query := `
-		SELECT id, user_id, parking_lot_id, rating, comment, created_at, updated_at, version
+		SELECT id, user_id, parking_lot_id, rating, comment, is_hidden, hidden_reason, is_flagged, created_at, updated_at, version
 		FROM reviews
 		WHERE user_id = $1 AND parking_lot_id = $2`
 
 	var review Review
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, userID, lotID).Scan(
@@ -223,6 +423,9 @@ func (m ReviewModel) GetUserReviewForLot(userID, lotID uuid.UUID) (*Review, erro
 		&review.ParkingLotID,
 		&review.Rating,
 		&review.Comment,
+		&review.IsHidden,
+		&review.HiddenReason,
+		&review.IsFlagged,
 		&review.CreatedAt,
 		&review.UpdatedAt,
 		&review.Version,
@@ -254,7 +457,7 @@ func (m ReviewModel) Update(review *Review) error {
 		review.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&review.UpdatedAt, &review.Version)
@@ -273,7 +476,7 @@ func (m ReviewModel) Update(review *Review) error {
 func (m ReviewModel) Delete(id uuid.UUID) error {
 	query := `DELETE FROM reviews WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	result, err := m.DB.ExecContext(ctx, query, id)
@@ -293,12 +496,160 @@ func (m ReviewModel) Delete(id uuid.UUID) error {
 	return nil
 }
 
+// Moderate hides or unhides a review. Hidden reviews are left out of public
+// listings and rating aggregates but remain visible to admins. The reason is
+// cleared when a review is unhidden, and either way the review is no longer
+// flagged for attention.
+func (m ReviewModel) Moderate(id uuid.UUID, hidden bool, reason *string) error {
+	_, err := m.ModerateBulk([]uuid.UUID{id}, hidden, reason)
+	return err
+}
+
+// ModerateBulk applies the same moderation decision to several reviews at once
+// and returns how many were updated. ErrRecordNotFound is returned when none were.
+func (m ReviewModel) ModerateBulk(ids []uuid.UUID, hidden bool, reason *string) (int, error) {
+	query := `
+		UPDATE reviews
+		SET is_hidden = $1, hidden_reason = CASE WHEN $1 THEN $2 ELSE NULL END, is_flagged = false, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = ANY($3)`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, hidden, reason, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if rowsAffected == 0 {
+		return 0, ErrRecordNotFound
+	}
+
+	return int(rowsAffected), nil
+}
+
+// GetForModeration lists reviews across all lots for admins, including hidden
+// ones. Non-nil hidden and flagged narrow the list on those fields.
+func (m ReviewModel) GetForModeration(hidden, flagged *bool, filters Filters) ([]*Review, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, user_id, parking_lot_id, rating, comment, is_hidden, hidden_reason, is_flagged, created_at, updated_at, version
+		FROM reviews
+		WHERE ($1::boolean IS NULL OR is_hidden = $1)
+		AND ($2::boolean IS NULL OR is_flagged = $2)
+		ORDER BY %s %s, id ASC
+		LIMIT $3 OFFSET $4`
+
+	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, hidden, flagged, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []*Review{}
+
+	for rows.Next() {
+		var review Review
+
+		err := rows.Scan(
+			&totalRecords,
+			&review.ID,
+			&review.UserID,
+			&review.ParkingLotID,
+			&review.Rating,
+			&review.Comment,
+			&review.IsHidden,
+			&review.HiddenReason,
+			&review.IsFlagged,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&review.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		reviews = append(reviews, &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return reviews, metadata, nil
+}
+
+// Report records a user's complaint about a review. Each user can report a
+// given review once; a second report returns ErrDuplicateReport.
+func (m ReviewModel) Report(reviewID, userID uuid.UUID, reason string) error {
+	query := `
+		INSERT INTO review_reports (review_id, user_id, reason)
+		VALUES ($1, $2, $3)`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, reviewID, userID, reason)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "review_reports_review_id_user_id_key"`:
+			return ErrDuplicateReport
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ReviewModel) GetReportCount(reviewID uuid.UUID) (int, error) {
+	query := `SELECT COUNT(*) FROM review_reports WHERE review_id = $1`
+
+	var count int
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, reviewID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Flag marks a review as needing an admin's attention.
+func (m ReviewModel) Flag(id uuid.UUID) error {
+	query := `
+		UPDATE reviews
+		SET is_flagged = true, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
 func (m ReviewModel) GetAverageRatingForLot(lotID uuid.UUID) (float64, error) {
-	query := `SELECT COALESCE(AVG(rating), 0) FROM reviews WHERE parking_lot_id = $1`
+	query := `SELECT COALESCE(AVG(rating), 0) FROM reviews WHERE parking_lot_id = $1 AND is_hidden = false`
 
 	var avgRating float64
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, lotID).Scan(&avgRating)
@@ -313,11 +664,11 @@ func (m ReviewModel) GetRatingDistributionForLot(lotID uuid.UUID) (map[int]int,
 	query := `
 		SELECT rating, COUNT(*) as count
 		FROM reviews
-		WHERE parking_lot_id = $1
+		WHERE parking_lot_id = $1 AND is_hidden = false
 		GROUP BY rating
 		ORDER BY rating`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	rows, err := m.DB.QueryContext(ctx, query, lotID)
@@ -350,11 +701,11 @@ func (m ReviewModel) GetRatingDistributionForLot(lotID uuid.UUID) (map[int]int,
 }
 
 func (m ReviewModel) GetTotalReviewsForLot(lotID uuid.UUID) (int, error) {
-	query := `SELECT COUNT(*) FROM reviews WHERE parking_lot_id = $1`
+	query := `SELECT COUNT(*) FROM reviews WHERE parking_lot_id = $1 AND is_hidden = false`
 
 	var totalReviews int
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, lotID).Scan(&totalReviews)
@@ -0,0 +1,286 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// insertTestReviews has a new user rate the lot once for each rating given.
+func insertTestReviews(t *testing.T, m Models, lotID uuid.UUID, ratings ...int) []*Review {
+	t.Helper()
+
+	reviews := make([]*Review, len(ratings))
+	for i, rating := range ratings {
+		reviews[i] = &Review{
+			UserID:       insertTestUser(t, m).ID,
+			ParkingLotID: lotID,
+			Rating:       rating,
+		}
+		if err := m.Reviews.Insert(reviews[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return reviews
+}
+
+func TestHidingReviewUpdatesAverageAndListings(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	lot, _ := insertTestLot(t, m, owner.ID, 1)
+	reviews := insertTestReviews(t, m, lot.ID, 5, 4, 1)
+
+	average := func() float64 {
+		t.Helper()
+		avg, err := m.Reviews.GetAverageRatingForLot(lot.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return avg
+	}
+
+	if got := average(); math.Abs(got-10.0/3) > 1e-9 {
+		t.Errorf("average before hiding: got %v; want 3.33", got)
+	}
+
+	reason := "abusive"
+	if err := m.Reviews.Moderate(reviews[2].ID, true, &reason); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := average(); got != 4.5 {
+		t.Errorf("average after hiding: got %v; want 4.5", got)
+	}
+
+	total, err := m.Reviews.GetTotalReviewsForLot(lot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 {
+		t.Errorf("total reviews after hiding: got %d; want 2", total)
+	}
+
+	listed, _, err := m.Reviews.GetByLot(lot.ID, Filters{Page: 1, PageSize: 20, Sort: "rating", SortSafelist: []string{"rating"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, review := range listed {
+		if review.ID == reviews[2].ID {
+			t.Error("hidden review is still publicly listed")
+		}
+	}
+	if len(listed) != 2 {
+		t.Errorf("got %d public reviews; want 2", len(listed))
+	}
+
+	// Admins still see it, with the reason.
+	hidden, err := m.Reviews.Get(reviews[2].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hidden.IsHidden || hidden.HiddenReason == nil || *hidden.HiddenReason != reason {
+		t.Errorf("got hidden %t, reason %v; want hidden with reason %q", hidden.IsHidden, hidden.HiddenReason, reason)
+	}
+
+	// Unhiding restores it and clears the reason.
+	if err := m.Reviews.Moderate(reviews[2].ID, false, &reason); err != nil {
+		t.Fatal(err)
+	}
+	if got := average(); math.Abs(got-10.0/3) > 1e-9 {
+		t.Errorf("average after unhiding: got %v; want 3.33", got)
+	}
+}
+
+func TestModerateBulk(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	lot, _ := insertTestLot(t, m, owner.ID, 1)
+	reviews := insertTestReviews(t, m, lot.ID, 1, 2, 5)
+
+	n, err := m.Reviews.ModerateBulk([]uuid.UUID{reviews[0].ID, reviews[1].ID, uuid.New()}, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("got %d moderated; want 2", n)
+	}
+
+	avg, err := m.Reviews.GetAverageRatingForLot(lot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if avg != 5 {
+		t.Errorf("average: got %v; want 5", avg)
+	}
+
+	_, err = m.Reviews.ModerateBulk([]uuid.UUID{uuid.New()}, true, nil)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("unknown ids: got %v; want ErrRecordNotFound", err)
+	}
+}
+
+func TestReportReviewOncePerUser(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	lot, _ := insertTestLot(t, m, owner.ID, 1)
+	review := insertTestReviews(t, m, lot.ID, 2)[0]
+
+	first := insertTestUser(t, m)
+	second := insertTestUser(t, m)
+
+	if err := m.Reviews.Report(review.ID, first.ID, "spam"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reviews.Report(review.ID, first.ID, "still spam"); !errors.Is(err, ErrDuplicateReport) {
+		t.Errorf("second report by the same user: got %v; want ErrDuplicateReport", err)
+	}
+	if err := m.Reviews.Report(review.ID, second.ID, "spam"); err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := m.Reviews.GetReportCount(review.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("got %d reports; want 2", count)
+	}
+}
+
+func TestGetRecent(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	lot, _ := insertTestLot(t, m, owner.ID, 0)
+	closed, _ := insertTestLot(t, m, owner.ID, 0)
+
+	_, err := m.ParkingLots.DB.Exec(`UPDATE parking_lots SET is_active = false WHERE id = $1`, closed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reviews := insertTestReviews(t, m, lot.ID, 5, 1, 4)
+	reviews = append(reviews, insertTestReviews(t, m, closed.ID, 3)...)
+
+	// Far in the future, so no other review is newer than these
+	for i, review := range reviews {
+		_, err := m.Reviews.DB.Exec(`UPDATE reviews SET created_at = '2999-01-01'::timestamptz + $1::int * INTERVAL '1 day' WHERE id = $2`, i, review.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = m.Reviews.DB.Exec(`UPDATE reviews SET is_hidden = true WHERE id = $1`, reviews[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recent, err := m.Reviews.GetRecent(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 2 {
+		t.Fatalf("got %d reviews; want 2", len(recent))
+	}
+
+	// Newest first, skipping the closed lot's review and the hidden one
+	if recent[0].ID != reviews[2].ID || recent[1].ID != reviews[0].ID {
+		t.Errorf("got reviews %s, %s; want %s, %s", recent[0].ID, recent[1].ID, reviews[2].ID, reviews[0].ID)
+	}
+	if recent[0].ParkingLotName != lot.Name {
+		t.Errorf("lot name = %q; want %q", recent[0].ParkingLotName, lot.Name)
+	}
+}
+
+func TestReviewAuthorName(t *testing.T) {
+	name := func(s string) *string { return &s }
+
+	tests := []struct {
+		name         string
+		username     string
+		firstName    *string
+		lastName     *string
+		showFullName bool
+		want         string
+	}{
+		{"first and last initial", "jdoe", name("Jane"), name("Doe"), false, "Jane D."},
+		{"full name opted in", "jdoe", name("Jane"), name("Doe"), true, "Jane Doe"},
+		{"multibyte last name", "nimal", name("Nimal"), name("ශාන්ත"), false, "Nimal ශ."},
+		{"first name only", "jdoe", name(" Jane "), name(" "), false, "Jane"},
+		{"no first name", "johnny", nil, name("Doe"), true, "j***y"},
+		{"blank first name", "johnny", name(""), nil, false, "j***y"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReviewAuthorName(tt.username, tt.firstName, tt.lastName, tt.showFullName); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaskUsername(t *testing.T) {
+	for username, want := range map[string]string{"johnny": "j***y", "abc": "a***c", "ab": "a***", "a": "a***", "": "", "Ωmega": "Ω***a"} {
+		if got := MaskUsername(username); got != want {
+			t.Errorf("MaskUsername(%q) = %q; want %q", username, got, want)
+		}
+	}
+}
+
+func TestGetByLotWithAuthorsHidesIdentity(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	lot, _ := insertTestLot(t, m, owner.ID, 0)
+	review := insertTestReviews(t, m, lot.ID, 4)[0]
+
+	author, err := m.Users.Get(review.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Users.DB.Exec(`UPDATE users SET first_name = 'Jane', last_name = 'Doe' WHERE id = $1`, author.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := func() *ReviewWithAuthor {
+		t.Helper()
+
+		reviews, _, err := m.Reviews.GetByLotWithAuthors(lot.ID, Filters{Page: 1, PageSize: 10, Sort: "-created_at", SortSafelist: []string{"-created_at"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reviews) != 1 {
+			t.Fatalf("got %d reviews; want 1", len(reviews))
+		}
+		return reviews[0]
+	}
+
+	got := list()
+	if got.Author != "Jane D." {
+		t.Errorf("author = %q; want %q", got.Author, "Jane D.")
+	}
+
+	js, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{author.Email, author.ID.String(), "Doe"} {
+		if strings.Contains(string(js), secret) {
+			t.Errorf("review JSON reveals %q: %s", secret, js)
+		}
+	}
+
+	if err := m.Users.SetShowFullName(author.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if show, err := m.Users.GetShowFullName(author.ID); err != nil || !show {
+		t.Errorf("GetShowFullName = %t, %v; want true", show, err)
+	}
+	if got := list(); got.Author != "Jane Doe" {
+		t.Errorf("author after opting in = %q; want %q", got.Author, "Jane Doe")
+	}
+}
@@ -0,0 +1,200 @@
+package data
+
+import (
+	"sort"
+)
+
+// maxSearchCandidates caps how many lots a location search loads before they
+// are ranked and paginated in memory.
+const maxSearchCandidates = 500
+
+// Distance units accepted by location searches. Distances are always computed
+// in kilometres; miles are converted at the edges.
+const (
+	DistanceUnitKm = "km"
+	DistanceUnitMi = "mi"
+)
+
+var DistanceUnits = []string{DistanceUnitKm, DistanceUnitMi}
+
+const kmPerMile = 1.609344
+
+// ToKm converts a distance given in unit to kilometres.
+func ToKm(distance float64, unit string) float64 {
+	if unit == DistanceUnitMi {
+		return distance * kmPerMile
+	}
+	return distance
+}
+
+// FromKm converts a distance in kilometres to unit.
+func FromKm(km float64, unit string) float64 {
+	if unit == DistanceUnitMi {
+		return km / kmPerMile
+	}
+	return km
+}
+
+// ParkingLotSearchResult is a lot found by a location search, with its distance
+// from the search point and current availability. Distance is DistanceKm
+// expressed in DistanceUnit.
+type ParkingLotSearchResult struct {
+	ParkingLotWithStats
+	DistanceKm     float64 `json:"distance_km"`
+	Distance       float64 `json:"distance"`
+	DistanceUnit   string  `json:"distance_unit"`
+	ActiveSpots    int     `json:"active_spots"`
+	AvailableSpots int     `json:"available_spots"`
+	Score          float64 `json:"score,omitempty"`
+}
+
+// RankWeights control how much distance, availability and rating each
+// contribute to a search result's rank score.
+type RankWeights struct {
+	Distance     float64
+	Availability float64
+	Rating       float64
+}
+
+// SearchByLocationWithStats returns the active lots within radiusKm of the given
+// point, closest first, along with their review and availability figures.
+func (m ParkingLotModel) SearchByLocationWithStats(lat, lng, radiusKm float64) ([]*ParkingLotSearchResult, error) {
+	query := `
+		SELECT id, name, address, latitude, longitude, total_spots, hourly_rate, daily_rate, monthly_rate, open_time, close_time, is_active, is_refundable, timezone, tax_rate, violation_fee, max_reservation_days, max_advance_days, vehicle_type_multipliers, min_lead_minutes, overbooking_percent, owner_id, created_at, updated_at, version,
+		       average_rating, total_reviews, completed_sessions, distance, active_spots, available_spots
+		FROM (
+			SELECT pl.*,
+			       COALESCE(r.average_rating, 0) AS average_rating,
+			       COALESCE(r.total_reviews, 0) AS total_reviews,
+			       COALESCE(s.completed_sessions, 0) AS completed_sessions,
+			       COALESCE(sp.active_spots, 0) AS active_spots,
+			       COALESCE(sp.available_spots, 0) AS available_spots,
+			       (6371 * acos(LEAST(1, cos(radians($1)) * cos(radians(pl.latitude)) * cos(radians(pl.longitude) - radians($2)) + sin(radians($1)) * sin(radians(pl.latitude))))) AS distance
+			FROM parking_lots pl
+			LEFT JOIN (
+				SELECT parking_lot_id, AVG(rating)::float AS average_rating, COUNT(*) AS total_reviews
+				FROM reviews
+				WHERE is_hidden = false
+				GROUP BY parking_lot_id
+			) r ON r.parking_lot_id = pl.id
+			LEFT JOIN (
+				SELECT ps.parking_lot_id, COUNT(*) AS completed_sessions
+				FROM parking_sessions s
+				INNER JOIN parking_spots ps ON ps.id = s.parking_spot_id
+				WHERE s.status = $4
+				GROUP BY ps.parking_lot_id
+			) s ON s.parking_lot_id = pl.id
+			LEFT JOIN (
+				SELECT parking_lot_id,
+				       COUNT(*) AS active_spots,
+				       COUNT(*) FILTER (WHERE is_occupied = false AND is_reserved = false) AS available_spots
+				FROM parking_spots
+				WHERE status = $5
+				GROUP BY parking_lot_id
+			) sp ON sp.parking_lot_id = pl.id
+			WHERE pl.is_active = true
+		) lots
+		WHERE distance <= $3
+		ORDER BY distance ASC, id ASC
+		LIMIT $6`
+
+	ctx, cancel := m.longQueryContext()
+	defer cancel()
+
+	args := []any{lat, lng, radiusKm, SessionStatusCompleted, SpotStatusActive, maxSearchCandidates}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*ParkingLotSearchResult{}
+
+	for rows.Next() {
+		var result ParkingLotSearchResult
+
+		err := rows.Scan(
+			&result.ID,
+			&result.Name,
+			&result.Address,
+			&result.Latitude,
+			&result.Longitude,
+			&result.TotalSpots,
+			&result.HourlyRate,
+			&result.DailyRate,
+			&result.MonthlyRate,
+			&result.OpenTime,
+			&result.CloseTime,
+			&result.IsActive,
+			&result.IsRefundable,
+			&result.Timezone,
+			&result.TaxRate,
+			&result.ViolationFee,
+			&result.MaxReservationDays,
+			&result.MaxAdvanceDays,
+			&result.VehicleTypeMultipliers,
+			&result.MinLeadMinutes,
+			&result.OverbookingPercent,
+			&result.OwnerID,
+			&result.CreatedAt,
+			&result.UpdatedAt,
+			&result.Version,
+			&result.AverageRating,
+			&result.TotalReviews,
+			&result.CompletedSessions,
+			&result.DistanceKm,
+			&result.ActiveSpots,
+			&result.AvailableSpots,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, &result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// RankSearchResults scores each result by blending its closeness, share of free
+// spots and average rating, each normalised to 0..1, and sorts the results best
+// first. Ties keep their distance order.
+func RankSearchResults(results []*ParkingLotSearchResult, radiusKm float64, weights RankWeights) {
+	for _, result := range results {
+		closeness := 0.0
+		if radiusKm > 0 {
+			closeness = 1 - result.DistanceKm/radiusKm
+		}
+
+		availability := 0.0
+		if result.ActiveSpots > 0 {
+			availability = float64(result.AvailableSpots) / float64(result.ActiveSpots)
+		}
+
+		rating := result.AverageRating / 5
+
+		result.Score = weights.Distance*closeness + weights.Availability*availability + weights.Rating*rating
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+}
+
+// SetDistanceUnit expresses each result's distance in unit.
+func SetDistanceUnit(results []*ParkingLotSearchResult, unit string) {
+	for _, result := range results {
+		result.Distance = FromKm(result.DistanceKm, unit)
+		result.DistanceUnit = unit
+	}
+}
+
+// PaginateSearchResults applies the filters' page and page size to ranked results.
+func PaginateSearchResults(results []*ParkingLotSearchResult, filters Filters) ([]*ParkingLotSearchResult, Metadata) {
+	return paginate(results, filters)
+}
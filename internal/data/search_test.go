@@ -0,0 +1,149 @@
+package data
+
+import (
+	"math"
+	"testing"
+)
+
+func searchResult(name string, distanceKm float64, active, available int, rating float64) *ParkingLotSearchResult {
+	result := &ParkingLotSearchResult{
+		DistanceKm:     distanceKm,
+		ActiveSpots:    active,
+		AvailableSpots: available,
+	}
+	result.Name = name
+	result.AverageRating = rating
+	return result
+}
+
+func names(results []*ParkingLotSearchResult) []string {
+	out := make([]string, len(results))
+	for i, result := range results {
+		out[i] = result.Name
+	}
+	return out
+}
+
+func TestRankSearchResults(t *testing.T) {
+	weights := RankWeights{Distance: 0.5, Availability: 0.3, Rating: 0.2}
+
+	results := []*ParkingLotSearchResult{
+		searchResult("close and full", 0.5, 10, 0, 0),
+		searchResult("farther, free and well rated", 1.5, 10, 9, 4.8),
+	}
+
+	RankSearchResults(results, 5, weights)
+
+	if got := names(results); got[0] != "farther, free and well rated" {
+		t.Errorf("got order %v; want the free, well rated lot first", got)
+	}
+	if want := 0.5*0.7 + 0.3*0.9 + 0.2*0.96; math.Abs(results[0].Score-want) > 1e-9 {
+		t.Errorf("got score %v; want %v", results[0].Score, want)
+	}
+	if want := 0.5 * 0.9; math.Abs(results[1].Score-want) > 1e-9 {
+		t.Errorf("got score %v; want %v", results[1].Score, want)
+	}
+}
+
+func TestRankSearchResultsDistanceOnly(t *testing.T) {
+	results := []*ParkingLotSearchResult{
+		searchResult("near", 0.5, 10, 0, 1),
+		searchResult("no spots configured", 1, 0, 0, 0),
+		searchResult("far", 3, 10, 10, 5),
+	}
+
+	RankSearchResults(results, 5, RankWeights{Distance: 1})
+
+	got := names(results)
+	want := []string{"near", "no spots configured", "far"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got order %v; want %v", got, want)
+		}
+	}
+}
+
+func TestRankSearchResultsTiesKeepDistanceOrder(t *testing.T) {
+	results := []*ParkingLotSearchResult{
+		searchResult("first", 1, 10, 5, 4),
+		searchResult("second", 1, 10, 5, 4),
+		searchResult("third", 1, 10, 5, 4),
+	}
+
+	RankSearchResults(results, 5, RankWeights{Distance: 0.5, Availability: 0.3, Rating: 0.2})
+
+	if got := names(results); got[0] != "first" || got[1] != "second" || got[2] != "third" {
+		t.Errorf("got order %v; want the original order", got)
+	}
+}
+
+func TestDistanceUnits(t *testing.T) {
+	if got := ToKm(10, DistanceUnitMi); math.Abs(got-16.09344) > 1e-9 {
+		t.Errorf("10 mi: got %v km", got)
+	}
+	if got := FromKm(16.09344, DistanceUnitMi); math.Abs(got-10) > 1e-9 {
+		t.Errorf("16.09344 km: got %v mi", got)
+	}
+	if got := ToKm(10, DistanceUnitKm); got != 10 {
+		t.Errorf("10 km: got %v km", got)
+	}
+
+	results := []*ParkingLotSearchResult{searchResult("lot", kmPerMile, 1, 1, 0)}
+	SetDistanceUnit(results, DistanceUnitMi)
+	if math.Abs(results[0].Distance-1) > 1e-9 || results[0].DistanceUnit != DistanceUnitMi {
+		t.Errorf("got %v %s; want 1 mi", results[0].Distance, results[0].DistanceUnit)
+	}
+}
+
+// haversineKm is the great circle distance between two points on a 6371 km
+// sphere, the same model the search queries use.
+func haversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLng := toRad(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+
+	return 6371 * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+func TestSearchByLocationReturnsDistance(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+
+	// Open ocean, so the test's lots are the only ones around
+	const lat, lng = -52.5, 141.5
+	points := [][2]float64{{lat + 0.05, lng + 0.03}, {lat, lng + 0.01}, {lat - 0.2, lng}}
+
+	for _, point := range points {
+		lot, _ := insertTestLot(t, m, owner.ID, 0)
+		_, err := m.ParkingLots.DB.Exec(`UPDATE parking_lots SET latitude = $1, longitude = $2 WHERE id = $3`, point[0], point[1], lot.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filters := Filters{Page: 1, PageSize: 20, Sort: "id", SortSafelist: []string{"id"}}
+	lots, metadata, err := m.ParkingLots.SearchByLocation(lat, lng, 10, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The third lot is about 22 km south, outside the radius
+	if len(lots) != 2 || metadata.TotalRecords != 2 {
+		t.Fatalf("got %d lots (%d total); want 2", len(lots), metadata.TotalRecords)
+	}
+
+	for i, lot := range lots {
+		want := haversineKm(lat, lng, lot.Latitude, lot.Longitude)
+		if math.Abs(lot.Distance-want) > 1e-6 {
+			t.Errorf("%s: distance %v km, want %v", lot.Name, lot.Distance, want)
+		}
+		if i > 0 && lot.Distance < lots[i-1].Distance {
+			t.Errorf("lots aren't ordered by distance: %v after %v", lot.Distance, lots[i-1].Distance)
+		}
+	}
+	if lots[0].Latitude != points[1][0] || lots[0].Longitude != points[1][1] {
+		t.Errorf("closest lot is at %v,%v; want %v", lots[0].Latitude, lots[0].Longitude, points[1])
+	}
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// SMSPreference is whether a user wants reservation texts, and the mobile
+// number they would go to. Texts are only sent to numbers the user has
+// verified with a code.
+type SMSPreference struct {
+	Enabled        bool    `json:"enabled"`
+	MobileNumber   *string `json:"mobile_number"`
+	MobileVerified bool    `json:"mobile_verified"`
+}
+
+// CanReceive reports whether texts may be sent to the user.
+func (p *SMSPreference) CanReceive() bool {
+	return p.Enabled && p.MobileVerified && p.MobileNumber != nil && *p.MobileNumber != ""
+}
+
+func (m UserModal) GetSMSPreference(id uuid.UUID) (*SMSPreference, error) {
+	query := `SELECT sms_notifications, mobile_number, mobile_verified FROM users WHERE id = $1 AND deleted_at IS NULL`
+
+	var preference SMSPreference
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&preference.Enabled, &preference.MobileNumber, &preference.MobileVerified)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &preference, nil
+}
+
+func (m UserModal) SetSMSEnabled(id uuid.UUID, enabled bool) error {
+	query := `
+		UPDATE users
+		SET sms_notifications = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND deleted_at IS NULL`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, enabled, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// VerifyMobileNumber marks the user's mobile number as verified and stores it
+// in its normalized form. It only applies while the number is still the one the
+// code was sent to; if the user changed it in the meantime it returns
+// ErrEditConflict.
+func (m UserModal) VerifyMobileNumber(id uuid.UUID, number, normalized string) error {
+	query := `
+		UPDATE users
+		SET mobile_number = $1, mobile_verified = true, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $2 AND mobile_number = $3 AND deleted_at IS NULL`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, normalized, id, number)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrSpotUnavailable = errors.New("spot is not available")
+
+// SpotHold keeps a spot reserved for a user while they finish booking it. The
+// spot is marked reserved until ExpiresAt, after which anyone may take it.
+type SpotHold struct {
+	ParkingSpotID uuid.UUID `json:"parking_spot_id"`
+	ParkingLotID  uuid.UUID `json:"parking_lot_id"`
+	UserID        uuid.UUID `json:"user_id"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// Active reports whether the hold still applies at t.
+func (h *SpotHold) Active(t time.Time) bool {
+	return t.Before(h.ExpiresAt)
+}
+
+// Hold reserves a free, active spot for the user until the given time. A spot
+// whose hold has lapsed can be held again straight away, before the release
+// job gets to it, and holding a spot the user already holds extends the hold.
+// Spots that are occupied, reserved or held by someone else return
+// ErrSpotUnavailable.
+func (m ParkingSpotModel) Hold(spotID, userID uuid.UUID, until time.Time) (*SpotHold, error) {
+	query := `
+		UPDATE parking_spots
+		SET is_reserved = true, reserved_until = $1, held_by = $2, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $3 AND status = 'active' AND is_occupied = false
+		AND (is_reserved = false OR (reserved_until IS NOT NULL AND (reserved_until <= NOW() OR held_by = $2)))
+		RETURNING parking_lot_id`
+
+	hold := &SpotHold{
+		ParkingSpotID: spotID,
+		UserID:        userID,
+		ExpiresAt:     until,
+	}
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, until, userID, spotID).Scan(&hold.ParkingLotID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			err = m.missingOrConflict(ctx, spotID)
+			if errors.Is(err, ErrEditConflict) {
+				return nil, ErrSpotUnavailable
+			}
+			return nil, err
+		default:
+			return nil, err
+		}
+	}
+
+	return hold, nil
+}
+
+// GetHold returns the spot's hold, lapsed or not. Spots without a hold return
+// ErrRecordNotFound.
+func (m ParkingSpotModel) GetHold(spotID uuid.UUID) (*SpotHold, error) {
+	query := `
+		SELECT id, parking_lot_id, held_by, reserved_until
+		FROM parking_spots
+		WHERE id = $1 AND held_by IS NOT NULL AND reserved_until IS NOT NULL`
+
+	var hold SpotHold
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, spotID).Scan(&hold.ParkingSpotID, &hold.ParkingLotID, &hold.UserID, &hold.ExpiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &hold, nil
+}
+
+// ReleaseHold frees a spot the user holds, whether the hold is cancelled or
+// has been turned into a reservation. Spots the user doesn't hold return
+// ErrRecordNotFound.
+func (m ParkingSpotModel) ReleaseHold(spotID, userID uuid.UUID) error {
+	query := `
+		UPDATE parking_spots
+		SET is_reserved = false, reserved_until = NULL, held_by = NULL, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $1 AND held_by = $2 AND reserved_until IS NOT NULL`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, spotID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// ReleaseExpiredHolds frees every spot whose hold lapsed by now and returns how
+// many were freed. Spots reserved without a hold are left alone.
+func (m ParkingSpotModel) ReleaseExpiredHolds(now time.Time) (int64, error) {
+	query := `
+		UPDATE parking_spots
+		SET is_reserved = false, reserved_until = NULL, held_by = NULL, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE reserved_until IS NOT NULL AND reserved_until <= $1`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, now)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// IsFreeForWindow reports whether the spot has no pending, confirmed or active
+// reservation overlapping the window.
+func (m ParkingSpotModel) IsFreeForWindow(spotID uuid.UUID, start, end time.Time) (bool, error) {
+	query := `
+		SELECT NOT EXISTS (
+			SELECT 1 FROM reservations
+			WHERE parking_spot_id = $1
+			AND status IN ($2, $3, $4)
+			AND start_time < $6 AND end_time > $5
+		)`
+
+	args := []any{spotID, ReservationStatusPending, ReservationStatusConfirmed, ReservationStatusActive, start, end}
+
+	var free bool
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&free)
+	return free, err
+}
@@ -0,0 +1,142 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSpotHoldExpiry(t *testing.T) {
+	m := newTestModels(t)
+
+	holder := insertTestUser(t, m)
+	other := insertTestUser(t, m)
+	lot, spots := insertTestLot(t, m, holder.ID, 1)
+	spot := spots[0]
+
+	now := time.Now()
+	start, end := now.Add(time.Hour), now.Add(2*time.Hour)
+
+	vehicles := map[*User]*Vehicle{holder: insertTestVehicle(t, m, holder.ID), other: insertTestVehicle(t, m, other.ID)}
+	book := func(user *User, start time.Time) *Reservation {
+		return &Reservation{
+			UserID:       user.ID,
+			VehicleID:    vehicles[user].ID,
+			ParkingLotID: lot.ID,
+			StartTime:    start,
+			EndTime:      start.Add(time.Hour),
+			Status:       ReservationStatusConfirmed,
+			TotalAmount:  MoneyFromFloat(100),
+		}
+	}
+
+	hold, err := m.ParkingSpots.Hold(spot.ID, holder.ID, now.Add(10*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hold.ParkingLotID != lot.ID || !hold.Active(now) {
+		t.Errorf("hold = %+v, want an active hold at lot %s", hold, lot.ID)
+	}
+
+	// While the hold lasts nobody else can hold or be assigned the spot
+	_, err = m.ParkingSpots.Hold(spot.ID, other.ID, now.Add(10*time.Minute))
+	if !errors.Is(err, ErrSpotUnavailable) {
+		t.Errorf("holding a held spot: err = %v, want %v", err, ErrSpotUnavailable)
+	}
+
+	err = m.Reservations.InsertWithFreeSpot(book(other, start), []string{SpotTypeRegular}, false)
+	if !errors.Is(err, ErrNoSpotAvailable) {
+		t.Errorf("held spot booked by another user: err = %v, want %v", err, ErrNoSpotAvailable)
+	}
+	booked := book(holder, start)
+	err = m.Reservations.InsertWithFreeSpot(booked, []string{SpotTypeRegular}, false)
+	if err != nil || booked.ParkingSpotID == nil || *booked.ParkingSpotID != spot.ID {
+		t.Errorf("holder couldn't book their held spot: err %v", err)
+	}
+
+	// The holder can extend their own hold
+	_, err = m.ParkingSpots.Hold(spot.ID, holder.ID, now.Add(20*time.Minute))
+	if err != nil {
+		t.Errorf("extending a hold: %v", err)
+	}
+
+	// Let the hold lapse. Until the release job runs, it no longer blocks anyone.
+	_, err = m.ParkingSpots.DB.Exec(`UPDATE parking_spots SET reserved_until = NOW() - INTERVAL '1 second' WHERE id = $1`, spot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lapsed, err := m.ParkingSpots.GetHold(spot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lapsed.Active(time.Now()) {
+		t.Error("lapsed hold is still active")
+	}
+
+	err = m.Reservations.InsertWithFreeSpot(book(other, end.Add(time.Hour)), []string{SpotTypeRegular}, false)
+	if err != nil {
+		t.Errorf("lapsed hold still blocks the spot: %v", err)
+	}
+
+	released, err := m.ParkingSpots.ReleaseExpiredHolds(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if released < 1 {
+		t.Errorf("released %d holds, want at least 1", released)
+	}
+
+	_, err = m.ParkingSpots.GetHold(spot.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("GetHold after release: err = %v, want %v", err, ErrRecordNotFound)
+	}
+
+	stored, err := m.ParkingSpots.Get(spot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.IsReserved {
+		t.Error("released spot is still reserved")
+	}
+
+	// Now the other user may hold it, and the first user can't release it
+	_, err = m.ParkingSpots.Hold(spot.ID, other.ID, time.Now().Add(10*time.Minute))
+	if err != nil {
+		t.Fatalf("holding a released spot: %v", err)
+	}
+	err = m.ParkingSpots.ReleaseHold(spot.ID, holder.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("releasing someone else's hold: err = %v, want %v", err, ErrRecordNotFound)
+	}
+	err = m.ParkingSpots.ReleaseHold(spot.ID, other.ID)
+	if err != nil {
+		t.Errorf("releasing own hold: %v", err)
+	}
+}
+
+func TestReleaseExpiredHoldsKeepsPlainReservations(t *testing.T) {
+	m := newTestModels(t)
+
+	owner := insertTestUser(t, m)
+	_, spots := insertTestLot(t, m, owner.ID, 1)
+
+	// A spot reserved without a hold has no timeout to lapse
+	err := m.ParkingSpots.SetReserved(spots[0].ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.ParkingSpots.ReleaseExpiredHolds(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := m.ParkingSpots.Get(spots[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.IsReserved {
+		t.Error("plain reservation was released")
+	}
+}
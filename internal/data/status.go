@@ -0,0 +1,113 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidTransition is matched by every *TransitionError.
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// TransitionError reports a status change the state machine doesn't allow.
+type TransitionError struct {
+	From string
+	To   string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot change status from %s to %s", e.From, e.To)
+}
+
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrInvalidTransition
+}
+
+// Reservations move pending → confirmed → active → completed. Pending and
+// confirmed reservations may also be cancelled, or expire once their window
+// passes without a check-in. Completed, cancelled and expired are final.
+var reservationTransitions = map[string][]string{
+	ReservationStatusPending:   {ReservationStatusConfirmed, ReservationStatusCancelled, ReservationStatusExpired},
+	ReservationStatusConfirmed: {ReservationStatusActive, ReservationStatusCancelled, ReservationStatusExpired},
+	ReservationStatusActive:    {ReservationStatusCompleted},
+}
+
+// Sessions start active and end completed. An active session can be flagged
+// as a violation, and a violated session still completes when the driver leaves.
+var sessionTransitions = map[string][]string{
+	SessionStatusActive:   {SessionStatusCompleted, SessionStatusViolated},
+	SessionStatusViolated: {SessionStatusCompleted},
+}
+
+// Payments start pending and are completed or failed by the gateway. A failed
+// payment can still complete when the gateway retries it, and a completed one
+// can be refunded. Refunded is final.
+var paymentTransitions = map[string][]string{
+	PaymentStatusPending:   {PaymentStatusCompleted, PaymentStatusFailed},
+	PaymentStatusFailed:    {PaymentStatusCompleted},
+	PaymentStatusCompleted: {PaymentStatusRefunded},
+}
+
+// CanTransition reports whether a reservation may move from one status to another.
+func CanTransition(from, to string) bool {
+	return canTransition(reservationTransitions, from, to)
+}
+
+// CanTransitionSession reports whether a parking session may move from one
+// status to another.
+func CanTransitionSession(from, to string) bool {
+	return canTransition(sessionTransitions, from, to)
+}
+
+// CanTransitionPayment reports whether a payment may move from one status to
+// another.
+func CanTransitionPayment(from, to string) bool {
+	return canTransition(paymentTransitions, from, to)
+}
+
+func canTransition(transitions map[string][]string, from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// transitionSources lists the statuses that may move to the given one. Status
+// writes filter on these so a concurrent change can't slip an illegal
+// transition past the check.
+func transitionSources(transitions map[string][]string, to string) []string {
+	var sources []string
+	for from := range transitions {
+		if canTransition(transitions, from, to) {
+			sources = append(sources, from)
+		}
+	}
+	return sources
+}
+
+// checkTransition loads the current status from table and validates the move
+// to the new one.
+func checkTransition(ctx context.Context, db *sql.DB, table string, transitions map[string][]string, id uuid.UUID, to string) error {
+	var from string
+
+	err := db.QueryRowContext(ctx, `SELECT status FROM `+table+` WHERE id = $1`, id).Scan(&from)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if !canTransition(transitions, from, to) {
+		return &TransitionError{From: from, To: to}
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+// checkTransitions tries every pair of statuses and compares the result with
+// the legal moves, given as "from→to".
+func checkTransitions(t *testing.T, statuses []string, can func(from, to string) bool, legal ...string) {
+	t.Helper()
+
+	want := map[string]bool{}
+	for _, move := range legal {
+		want[move] = true
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			move := from + "→" + to
+			if got := can(from, to); got != want[move] {
+				t.Errorf("%s: got %t; want %t", move, got, want[move])
+			}
+		}
+	}
+
+	for _, unknown := range []string{"", "unknown"} {
+		for _, status := range statuses {
+			if can(unknown, status) || can(status, unknown) {
+				t.Errorf("transition between %q and %q allowed", unknown, status)
+			}
+		}
+	}
+}
+
+func TestReservationTransitions(t *testing.T) {
+	statuses := []string{
+		ReservationStatusPending,
+		ReservationStatusConfirmed,
+		ReservationStatusActive,
+		ReservationStatusCompleted,
+		ReservationStatusCancelled,
+		ReservationStatusExpired,
+	}
+
+	checkTransitions(t, statuses, CanTransition,
+		"pending→confirmed",
+		"pending→cancelled",
+		"pending→expired",
+		"confirmed→active",
+		"confirmed→cancelled",
+		"confirmed→expired",
+		"active→completed",
+	)
+}
+
+func TestSessionTransitions(t *testing.T) {
+	statuses := []string{SessionStatusActive, SessionStatusCompleted, SessionStatusViolated}
+
+	checkTransitions(t, statuses, CanTransitionSession,
+		"active→completed",
+		"active→violated",
+		"violated→completed",
+	)
+}
+
+func TestPaymentTransitions(t *testing.T) {
+	statuses := []string{PaymentStatusPending, PaymentStatusCompleted, PaymentStatusFailed, PaymentStatusRefunded}
+
+	checkTransitions(t, statuses, CanTransitionPayment,
+		"pending→completed",
+		"pending→failed",
+		"failed→completed",
+		"completed→refunded",
+	)
+}
+
+func TestTransitionSources(t *testing.T) {
+	got := transitionSources(reservationTransitions, ReservationStatusCancelled)
+	sort.Strings(got)
+
+	want := []string{ReservationStatusConfirmed, ReservationStatusPending}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+
+	if got := transitionSources(reservationTransitions, ReservationStatusPending); len(got) != 0 {
+		t.Errorf("got %v; want no way back to pending", got)
+	}
+}
+
+func TestTransitionError(t *testing.T) {
+	var err error = &TransitionError{From: ReservationStatusCompleted, To: ReservationStatusActive}
+
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Error("TransitionError does not match ErrInvalidTransition")
+	}
+	if got, want := err.Error(), "cannot change status from completed to active"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+
+	var te *TransitionError
+	if !errors.As(fmt.Errorf("checking in: %w", err), &te) || te.From != ReservationStatusCompleted {
+		t.Error("wrapped TransitionError can't be recovered with errors.As")
+	}
+}
+
+func TestReservationStatusWritesAreChecked(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+	lot, spots := insertTestLot(t, m, user.ID, 1)
+	vehicle := insertTestVehicle(t, m, user.ID)
+
+	reservation := insertTestReservation(t, m, vehicle, lot.ID, spots[0], time.Now(), time.Hour)
+
+	if err := m.Reservations.CheckOut(reservation.ID, time.Now()); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("confirmed→completed: got %v; want ErrInvalidTransition", err)
+	}
+	if err := m.Reservations.CheckIn(reservation.ID, time.Now()); err != nil {
+		t.Fatalf("confirmed→active: %v", err)
+	}
+	if err := m.Reservations.CheckOut(reservation.ID, time.Now()); err != nil {
+		t.Fatalf("active→completed: %v", err)
+	}
+	if err := m.Reservations.CheckIn(reservation.ID, time.Now()); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("completed→active: got %v; want ErrInvalidTransition", err)
+	}
+	if err := m.Reservations.Cancel(reservation.ID); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("completed→cancelled: got %v; want ErrInvalidTransition", err)
+	}
+}
@@ -0,0 +1,174 @@
+package data
+
+import (
+	"database/sql"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestModels connects to the database named by TEST_DB_DSN, which must
+// already have the current schema. Tests that need a database are skipped
+// when it isn't set.
+func newTestModels(t *testing.T) Models {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	PasswordCost = bcrypt.MinCost
+
+	return NewModels(db)
+}
+
+// insertTestUser creates an activated user with the password "pa55word". The
+// user, and everything that belongs to them, is removed when the test ends.
+func insertTestUser(t *testing.T, m Models) *User {
+	t.Helper()
+
+	user := &User{
+		UserName:  "test user",
+		Email:     "test-" + uuid.NewString() + "@example.com",
+		Role:      "normal",
+		AuthType:  AuthTypeNormal,
+		Activated: true,
+	}
+	if err := user.Password.Set("pa55word"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Users.Insert(user); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		m.Users.DB.Exec(`DELETE FROM users WHERE id = $1`, user.ID)
+	})
+
+	return user
+}
+
+// insertTestLot creates an always open UTC lot with the given number of spots
+// owned by ownerID, and returns it with its spots numbered from 1.
+func insertTestLot(t *testing.T, m Models, ownerID uuid.UUID, spots int) (*ParkingLot, []*ParkingSpot) {
+	t.Helper()
+
+	lot := &ParkingLot{
+		Name:       "Test lot " + uuid.NewString()[:8],
+		Address:    "1 Test Street",
+		Latitude:   6.9271,
+		Longitude:  79.8612,
+		TotalSpots: spots,
+		HourlyRate: MoneyFromFloat(100),
+		OpenTime:   "00:00",
+		CloseTime:  "00:00",
+		IsActive:   true,
+		Timezone:   "UTC",
+		OwnerID:    ownerID,
+	}
+	if err := m.ParkingLots.Insert(lot); err != nil {
+		t.Fatal(err)
+	}
+
+	created := make([]*ParkingSpot, spots)
+	for i := range created {
+		created[i] = insertTestSpot(t, m, lot.ID, strconv.Itoa(i+1))
+	}
+
+	return lot, created
+}
+
+func insertTestSpot(t *testing.T, m Models, lotID uuid.UUID, number string) *ParkingSpot {
+	t.Helper()
+
+	spot := &ParkingSpot{
+		ParkingLotID: lotID,
+		SpotNumber:   number,
+		SpotType:     SpotTypeRegular,
+		Status:       SpotStatusActive,
+	}
+	if err := m.ParkingSpots.Insert(spot); err != nil {
+		t.Fatal(err)
+	}
+
+	return spot
+}
+
+func insertTestVehicle(t *testing.T, m Models, userID uuid.UUID) *Vehicle {
+	t.Helper()
+
+	vehicle := &Vehicle{
+		UserID:       userID,
+		LicensePlate: "T" + strings.ToUpper(uuid.NewString()[:7]),
+		Make:         "Toyota",
+		Model:        "Corolla",
+		Color:        "white",
+		VehicleType:  "car",
+		IsDefault:    true,
+	}
+	if err := m.Vehicles.Insert(vehicle); err != nil {
+		t.Fatal(err)
+	}
+
+	return vehicle
+}
+
+// insertTestReservation books spot (which may be nil) for the vehicle's owner
+// from start for the given duration.
+func insertTestReservation(t *testing.T, m Models, vehicle *Vehicle, lotID uuid.UUID, spot *ParkingSpot, start time.Time, d time.Duration) *Reservation {
+	t.Helper()
+
+	reservation := &Reservation{
+		UserID:       vehicle.UserID,
+		VehicleID:    vehicle.ID,
+		ParkingLotID: lotID,
+		StartTime:    start,
+		EndTime:      start.Add(d),
+		Status:       ReservationStatusConfirmed,
+		TotalAmount:  MoneyFromFloat(100),
+	}
+	if spot != nil {
+		reservation.ParkingSpotID = &spot.ID
+	}
+	if err := m.Reservations.Insert(reservation); err != nil {
+		t.Fatal(err)
+	}
+
+	return reservation
+}
+
+// insertTestPayment records a card payment in LKR for the reservation.
+func insertTestPayment(t *testing.T, m Models, reservation *Reservation, amount float64, status string) *Payment {
+	t.Helper()
+
+	payment := &Payment{
+		ReservationID: &reservation.ID,
+		UserID:        reservation.UserID,
+		Amount:        MoneyFromFloat(amount),
+		Currency:      "LKR",
+		PaymentMethod: PaymentMethodCard,
+		Status:        status,
+		PaymentDate:   time.Now(),
+	}
+	if err := m.Payments.Insert(payment); err != nil {
+		t.Fatal(err)
+	}
+
+	return payment
+}
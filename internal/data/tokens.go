@@ -1,11 +1,14 @@
 package data
 
 import (
-	"context"
+	"bytes"
 	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
+	"fmt"
+	"math/big"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,11 +16,20 @@ import (
 )
 
 const (
-	ScopeActivation     = "activation"
-	ScopeAuthentication = "authentication"
-	ScopePasswordReset  = "password-reset"
+	ScopeActivation         = "activation"
+	ScopeAuthentication     = "authentication"
+	ScopePasswordReset      = "password-reset"
+	ScopeCalendarFeed       = "calendar-feed"
+	ScopeMobileVerification = "mobile-verification"
+	ScopeAccountDeletion    = "account-deletion"
 )
 
+// MaxCodeAttempts is how many times a user may check codes for a scope before
+// all of their outstanding codes for it are thrown away.
+const MaxCodeAttempts = 5
+
+var ErrTooManyCodeAttempts = errors.New("too many incorrect code attempts")
+
 type Token struct {
 	Plaintext string    `json:"token"`
 	Hash      []byte    `json:"-"`
@@ -56,6 +68,7 @@ func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 
 type TokenModel struct {
 	DB *sql.DB
+	queryScope
 }
 
 func (m TokenModel) New(userID uuid.UUID, ttl time.Duration, scope string) (*Token, error) {
@@ -75,7 +88,7 @@ func (m TokenModel) Insert(token *Token) error {
 
 	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, args...)
@@ -86,10 +99,134 @@ func (m TokenModel) Insert(token *Token) error {
 func (m TokenModel) DeleteAllForUser(scope string, userID uuid.UUID) error {
 	query := `DELETE FROM tokens WHERE scope = $1 AND user_id = $2`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
 
 	return err
 }
+
+// DeleteExpired removes every token, of any scope, that has expired and returns
+// how many were removed.
+func (m TokenModel) DeleteExpired() (int64, error) {
+	query := `DELETE FROM tokens WHERE expiry < $1`
+
+	ctx, cancel := m.longQueryContext()
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// codeHash binds a short code to the user and subject it was issued for, so the
+// same six digits issued to different users don't collide.
+func codeHash(userID uuid.UUID, subject, code string) []byte {
+	hash := sha256.Sum256([]byte(userID.String() + ":" + subject + ":" + code))
+	return hash[:]
+}
+
+// NewCode creates a six digit code for the user to type back in, such as one
+// sent by SMS. The code is bound to subject, e.g. the number it was sent to, and
+// only checks out for the same subject.
+func (m TokenModel) NewCode(userID uuid.UUID, ttl time.Duration, scope, subject string) (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	token := &Token{
+		Hash:   codeHash(userID, subject, code),
+		UserID: userID,
+		Expiry: time.Now().Add(ttl),
+		Scope:  scope,
+	}
+
+	err = m.Insert(token)
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// CheckCode reports whether code is an unexpired code issued to the user for
+// scope and subject. Every check counts against all of the user's outstanding
+// codes for scope, and the wrong guess that uses up MaxCodeAttempts deletes
+// them and returns ErrTooManyCodeAttempts, so codes can't be brute forced.
+func (m TokenModel) CheckCode(userID uuid.UUID, scope, subject, code string) (bool, error) {
+	query := `
+		UPDATE tokens
+		SET attempts = attempts + 1
+		WHERE user_id = $1 AND scope = $2 AND expiry > $3
+		RETURNING hash, attempts`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, scope, time.Now())
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	hash := codeHash(userID, subject, code)
+	valid, exhausted := false, false
+
+	for rows.Next() {
+		var tokenHash []byte
+		var attempts int
+
+		err := rows.Scan(&tokenHash, &attempts)
+		if err != nil {
+			return false, err
+		}
+
+		if attempts <= MaxCodeAttempts && bytes.Equal(tokenHash, hash) {
+			valid = true
+		}
+		if attempts >= MaxCodeAttempts {
+			exhausted = true
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return false, err
+	}
+
+	if valid || !exhausted {
+		return valid, nil
+	}
+
+	query = `DELETE FROM tokens WHERE user_id = $1 AND scope = $2 AND attempts >= $3`
+
+	_, err = m.DB.ExecContext(ctx, query, userID, scope, MaxCodeAttempts)
+	if err != nil {
+		return false, err
+	}
+
+	return false, ErrTooManyCodeAttempts
+}
+
+// CountActive returns how many of the user's tokens for scope haven't expired.
+func (m TokenModel) CountActive(scope string, userID uuid.UUID) (int, error) {
+	query := `SELECT COUNT(*) FROM tokens WHERE scope = $1 AND user_id = $2 AND expiry > $3`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	var count int
+
+	err := m.DB.QueryRowContext(ctx, query, scope, userID, time.Now()).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
@@ -0,0 +1,135 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckCode(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+
+	const number = "+94771234567"
+
+	code, err := m.Tokens.NewCode(user.ID, time.Minute, ScopeMobileVerification, number)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != 6 {
+		t.Errorf("code %q isn't six digits", code)
+	}
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	check := func(subject, code string) bool {
+		t.Helper()
+
+		valid, err := m.Tokens.CheckCode(user.ID, ScopeMobileVerification, subject, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return valid
+	}
+
+	if check(number, wrong) {
+		t.Error("wrong code checked out")
+	}
+	if check("+94770000000", code) {
+		t.Error("code checked out for another number")
+	}
+	if !check(number, code) {
+		t.Error("correct code didn't check out")
+	}
+
+	// An expired code no longer checks out, and doesn't count as active
+	_, err = m.Tokens.DB.Exec(`UPDATE tokens SET expiry = NOW() - INTERVAL '1 second' WHERE user_id = $1 AND scope = $2`, user.ID, ScopeMobileVerification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check(number, code) {
+		t.Error("expired code checked out")
+	}
+	if active, err := m.Tokens.CountActive(ScopeMobileVerification, user.ID); err != nil || active != 0 {
+		t.Errorf("got %d active codes, %v; want 0", active, err)
+	}
+}
+
+func TestCheckCodeLimitsAttempts(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+
+	const number = "+94771234567"
+
+	code, err := m.Tokens.NewCode(user.ID, time.Minute, ScopeMobileVerification, number)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	for i := 1; i < MaxCodeAttempts; i++ {
+		if _, err := m.Tokens.CheckCode(user.ID, ScopeMobileVerification, number, wrong); err != nil {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+	}
+
+	_, err = m.Tokens.CheckCode(user.ID, ScopeMobileVerification, number, wrong)
+	if !errors.Is(err, ErrTooManyCodeAttempts) {
+		t.Fatalf("attempt %d: got %v; want %v", MaxCodeAttempts, err, ErrTooManyCodeAttempts)
+	}
+
+	// The code is gone, so even the right one fails now
+	valid, err := m.Tokens.CheckCode(user.ID, ScopeMobileVerification, number, code)
+	if err != nil || valid {
+		t.Errorf("correct code after lockout: got %t, %v; want false", valid, err)
+	}
+}
+
+func TestDeleteExpired(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+
+	scopes := []string{ScopeActivation, ScopeAuthentication, ScopePasswordReset}
+	for _, scope := range scopes {
+		if _, err := m.Tokens.New(user.ID, time.Hour, scope); err != nil {
+			t.Fatal(err)
+		}
+
+		expired, err := m.Tokens.New(user.ID, time.Hour, scope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = m.Tokens.DB.Exec(`UPDATE tokens SET expiry = NOW() - INTERVAL '1 minute' WHERE hash = $1`, expired.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := m.Tokens.DeleteExpired()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Other tests may leave expired tokens behind too
+	if deleted < int64(len(scopes)) {
+		t.Errorf("deleted %d tokens; want at least %d", deleted, len(scopes))
+	}
+
+	for _, scope := range scopes {
+		var valid, expired int
+		err := m.Tokens.DB.QueryRow(`
+			SELECT COUNT(*) FILTER (WHERE expiry >= NOW()), COUNT(*) FILTER (WHERE expiry < NOW())
+			FROM tokens WHERE user_id = $1 AND scope = $2`, user.ID, scope).Scan(&valid, &expired)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if valid != 1 || expired != 0 {
+			t.Errorf("%s: %d valid and %d expired tokens left; want 1 and 0", scope, valid, expired)
+		}
+	}
+}
@@ -1,12 +1,13 @@
 package data
 
 import (
-	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base64"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,7 +16,18 @@ import (
 )
 
 var (
-	ErrDuplicateEmail = errors.New("duplicate email")
+	ErrDuplicateEmail     = errors.New("duplicate email")
+	ErrNotEligibleForSpot = errors.New("user is not eligible for this spot type")
+	ErrGoogleLinkRefused  = errors.New("google account cannot be linked to this user")
+	ErrMissingGoogleID    = errors.New("google user info has no account id")
+)
+
+// How a user signs in. Accounts made with a password that were later linked to
+// a Google account can use either.
+const (
+	AuthTypeNormal = "normal"
+	AuthTypeGoogle = "google"
+	AuthTypeBoth   = "normal+google"
 )
 
 type User struct {
@@ -28,21 +40,32 @@ type User struct {
 	MobileNumber           *string   `json:"mobile_number" db:"mobile_number"`
 	AvatarURL              *string   `json:"avatar_url" db:"avatar_url"`
 	Role                   string    `json:"role" db:"role"`
+	OrgID                  *uuid.UUID `json:"org_id" db:"org_id"`
+	OrgRole                *string    `json:"org_role" db:"org_role"`
 	AuthType string `json:"authtype" db:"authtype"`
+	GoogleID               *string    `json:"-" db:"google_id"`
 	HasCompletedOnboarding bool      `json:"has_completed_onboarding" db:"has_completed_onboarding"`
+	// HasDisabilityPermit is set once an admin has verified the permit number
+	HasDisabilityPermit    bool      `json:"has_disability_permit" db:"has_disability_permit"`
+	DisabilityPermitNumber *string   `json:"disability_permit_number" db:"disability_permit_number"`
 	Activated              bool      `json:"activated" db:"activated"`
 	Version                int       `json:"version" db:"version"`
 	CreatedAt              time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt              time.Time `json:"updated_at" db:"updated_at"`
+	UpdatedAt              time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt              *time.Time `json:"-" db:"deleted_at"`
 }
 
+// PasswordCost is the bcrypt cost new password hashes are made with. It is set
+// once at startup; hashes made with a lower cost are upgraded at login.
+var PasswordCost = 12
+
 type password struct {
 	plaintext *string
 	hash      []byte
 }
 
 func (p *password) Set(plaintextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), PasswordCost)
 	if err != nil {
 		return err
 	}
@@ -66,6 +89,44 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 	return true, nil
 }
 
+// setRandom sets a password nobody knows, for accounts that sign in with Google.
+func (p *password) setRandom() error {
+	randomPassword := make([]byte, 32)
+	_, err := rand.Read(randomPassword)
+	if err != nil {
+		return err
+	}
+
+	return p.Set(base64.URLEncoding.EncodeToString(randomPassword))
+}
+
+// NeedsRehash reports whether the hash was made with a lower cost than
+// PasswordCost.
+func (p *password) NeedsRehash() bool {
+	cost, err := bcrypt.Cost(p.hash)
+	return err == nil && cost < PasswordCost
+}
+
+// RehashPassword hashes the user's password again at PasswordCost. It takes the
+// plaintext from a successful login, and leaves the stored hash alone if the
+// password was changed in the meantime.
+func (m UserModal) RehashPassword(user *User, plaintextPassword string) error {
+	oldHash := user.Password.hash
+
+	err := user.Password.Set(plaintextPassword)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE users SET password_hash = $1 WHERE id = $2 AND password_hash = $3`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, user.Password.hash, user.ID, oldHash)
+	return err
+}
+
 func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(email != "", "email", "must be provided")
 	v.Check(validator.Matches(email, validator.EmailRx), "email", "must be a valid email address")
@@ -95,16 +156,17 @@ func ValidateUser(v *validator.Validator, user *User) {
 
 type UserModal struct {
 	DB *sql.DB
+	queryScope
 }
 
 func (m UserModal) Insert(user *User) error {
-	query := `INSERT INTO users (user_name, email, first_name, last_name, mobile_number, avatar_url, password_hash, user_role, authtype, activated, has_completed_onboarding) 
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) 
+	query := `INSERT INTO users (user_name, email, first_name, last_name, mobile_number, avatar_url, password_hash, user_role, authtype, google_id, activated, has_completed_onboarding) 
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) 
 			RETURNING id, created_at, version`
 
-	args := []any{user.UserName, user.Email, user.FirstName, user.LastName, user.MobileNumber, user.AvatarURL, user.Password.hash, user.Role, user.AuthType, user.Activated, user.HasCompletedOnboarding}
+	args := []any{user.UserName, user.Email, user.FirstName, user.LastName, user.MobileNumber, user.AvatarURL, user.Password.hash, user.Role, user.AuthType, user.GoogleID, user.Activated, user.HasCompletedOnboarding}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
@@ -120,13 +182,13 @@ func (m UserModal) Insert(user *User) error {
 }
 
 func (m UserModal) GetByEmail(email string) (*User, error) {
-	query := `SELECT id, created_at, user_name, email, first_name, last_name, mobile_number, avatar_url, password_hash, user_role, authtype, activated, has_completed_onboarding, version
+	query := `SELECT id, created_at, user_name, email, first_name, last_name, mobile_number, avatar_url, password_hash, user_role, org_id, org_role, authtype, activated, has_completed_onboarding, has_disability_permit, disability_permit_number, version
       		  FROM users
-      		  WHERE email = $1`
+      		  WHERE email = $1 AND deleted_at IS NULL`
 
 	var user User
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, email).Scan(
@@ -140,9 +202,13 @@ func (m UserModal) GetByEmail(email string) (*User, error) {
 		&user.AvatarURL,
 		&user.Password.hash,
 		&user.Role,
+		&user.OrgID,
+		&user.OrgRole,
 		&user.AuthType,
 		&user.Activated,
 		&user.HasCompletedOnboarding,
+		&user.HasDisabilityPermit,
+		&user.DisabilityPermitNumber,
 		&user.Version)
 
 	if err != nil {
@@ -172,7 +238,7 @@ func (m UserModal) Update(user *User) error {
 		user.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
@@ -192,19 +258,20 @@ func (m UserModal) Update(user *User) error {
 func (m UserModal) GetForToken(tokenScope, tokenPlainText string) (*User, error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlainText))
 
-	query := `SELECT users.id, users.created_at, users.user_name, users.email, users.password_hash, users.user_role, users.authtype, users.activated, users.has_completed_onboarding, users.version
+	query := `SELECT users.id, users.created_at, users.user_name, users.email, users.password_hash, users.user_role, users.org_id, users.org_role, users.authtype, users.activated, users.has_completed_onboarding, users.has_disability_permit, users.disability_permit_number, users.version
 	FROM users
 	INNER JOIN tokens
 	ON users.id = tokens.user_id
 	WHERE tokens.hash = $1
 	AND tokens.scope = $2
-	AND tokens.expiry > $3`
+	AND tokens.expiry > $3
+	AND users.deleted_at IS NULL`
 
 	args := []any{tokenHash[:], tokenScope, time.Now()}
 
 	var user User
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 
 	defer cancel()
 
@@ -215,9 +282,13 @@ func (m UserModal) GetForToken(tokenScope, tokenPlainText string) (*User, error)
 		&user.Email,
 		&user.Password.hash,
 		&user.Role,
+		&user.OrgID,
+		&user.OrgRole,
 		&user.AuthType,
 		&user.Activated,
 		&user.HasCompletedOnboarding,
+		&user.HasDisabilityPermit,
+		&user.DisabilityPermitNumber,
 		&user.Version,
 	)
 	if err != nil {
@@ -246,11 +317,33 @@ type GoogleUser struct {
 	Picture       string `json:"picture"`
 }
 
-func (m UserModal) FindOrCreateFromGoogle(googleUser *GoogleUser) (*User, error) {
-	// Try to find existing user by email
-	user, err := m.GetByEmail(googleUser.Email)
+// FindOrCreateFromGoogle returns the user signing in with a Google account, and
+// whether they were created just now. Users are matched on the stable Google
+// account ID, so a Google account whose email changed, or an address reused by
+// someone else, still maps to the right user. Email is only a fallback for the
+// first sign-in: an account found by email is linked to the Google account on
+// the way, but only once Google has verified the address belongs to the same
+// person; otherwise, or when the account is already linked to a different
+// Google account, ErrGoogleLinkRefused is returned.
+func (m UserModal) FindOrCreateFromGoogle(googleUser *GoogleUser) (*User, bool, error) {
+	if googleUser.ID == "" {
+		return nil, false, ErrMissingGoogleID
+	}
+
+	user, err := m.getByGoogleID(googleUser.ID)
+	if err == nil {
+		return user, false, nil
+	} else if !errors.Is(err, ErrRecordNotFound) {
+		return nil, false, err
+	}
+
+	user, err = m.GetByEmail(googleUser.Email)
 	if err == nil {
-		return user, nil
+		err = m.linkGoogle(user, googleUser)
+		if err != nil {
+			return nil, false, err
+		}
+		return user, false, nil
 	}
 
 	// If user doesn't exist, create new one
@@ -258,35 +351,123 @@ func (m UserModal) FindOrCreateFromGoogle(googleUser *GoogleUser) (*User, error)
 		user = &User{
 			UserName:  googleUser.Name,
 			Email:     googleUser.Email,
-			AuthType:  "google",
+			AuthType:  AuthTypeGoogle,
+			GoogleID:  &googleUser.ID,
 			Activated: googleUser.VerifiedEmail,
 		}
 
 		// Generate random password for Google users
-		randomPassword := make([]byte, 32)
-		rand.Read(randomPassword)
-		user.Password.Set(base64.URLEncoding.EncodeToString(randomPassword))
+		err = user.Password.setRandom()
+		if err != nil {
+			return nil, false, err
+		}
 
 		err = m.Insert(user)
 		if err != nil {
+			return nil, false, err
+		}
+
+		return user, true, nil
+	}
+
+	return nil, false, err
+}
+
+func (m UserModal) getByGoogleID(googleID string) (*User, error) {
+	query := `SELECT id FROM users WHERE google_id = $1 AND deleted_at IS NULL`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	var id uuid.UUID
+
+	err := m.DB.QueryRowContext(ctx, query, googleID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
 			return nil, err
 		}
+	}
+
+	return m.Get(id)
+}
 
-		return user, nil
+// linkGoogle records the Google account against an existing user, who can then
+// sign in with either. Google having verified the email stands in for the
+// user's own activation.
+func (m UserModal) linkGoogle(user *User, googleUser *GoogleUser) error {
+	if !googleUser.VerifiedEmail {
+		return ErrGoogleLinkRefused
 	}
 
-	return nil, err
+	// An account that was never activated was registered by someone who never
+	// proved they own the address, so its password and sessions may be an
+	// attacker's. They are replaced, and the account becomes Google only.
+	claimed := !user.Activated
+	if claimed {
+		user.AuthType = AuthTypeGoogle
+		err := user.Password.setRandom()
+		if err != nil {
+			return err
+		}
+	} else if user.AuthType == AuthTypeNormal {
+		user.AuthType = AuthTypeBoth
+	}
+
+	query := `
+		UPDATE users
+		SET google_id = $1, authtype = $2, password_hash = $3, activated = true, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $4 AND activated = $5 AND (google_id IS NULL OR google_id = $1)
+		RETURNING activated, version`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, googleUser.ID, user.AuthType, user.Password.hash, user.ID, !claimed).Scan(&user.Activated, &user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrGoogleLinkRefused
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_google_id_idx"`:
+			return ErrGoogleLinkRefused
+		default:
+			return err
+		}
+	}
+
+	if claimed {
+		_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE user_id = $1`, user.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	user.GoogleID = &googleUser.ID
+	return nil
 }
 
 
 func (m UserModal) Get(id uuid.UUID) (*User, error) {
-    query := `SELECT id, created_at, updated_at, user_name, email, first_name, last_name, mobile_number, avatar_url, user_role, authtype, activated, has_completed_onboarding, version
+    query := `SELECT id, created_at, updated_at, user_name, email, first_name, last_name, mobile_number, avatar_url, user_role, org_id, org_role, authtype, activated, has_completed_onboarding, has_disability_permit, disability_permit_number, version
                 FROM users
-                WHERE id = $1`
+                WHERE id = $1 AND deleted_at IS NULL`
 
     var user User
 
-    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    ctx, cancel := m.queryContext()
     defer cancel()
 
     err := m.DB.QueryRowContext(ctx, query, id).Scan(
@@ -300,9 +481,13 @@ func (m UserModal) Get(id uuid.UUID) (*User, error) {
         &user.MobileNumber,
         &user.AvatarURL,
         &user.Role,
+        &user.OrgID,
+        &user.OrgRole,
         &user.AuthType,
         &user.Activated,
         &user.HasCompletedOnboarding,
+        &user.HasDisabilityPermit,
+        &user.DisabilityPermitNumber,
         &user.Version)
 
     if err != nil {
@@ -319,7 +504,8 @@ func (m UserModal) Get(id uuid.UUID) (*User, error) {
 // Update profile information
 func (m UserModal) UpdateProfile(user *User) error {
     query := `UPDATE users
-            SET first_name = $1, last_name = $2, mobile_number = $3, avatar_url = $4, has_completed_onboarding = $5, updated_at = CURRENT_TIMESTAMP, version = version + 1
+            SET first_name = $1, last_name = $2, mobile_number = $3, avatar_url = $4, has_completed_onboarding = $5,
+                mobile_verified = mobile_verified AND mobile_number IS NOT DISTINCT FROM $3, updated_at = CURRENT_TIMESTAMP, version = version + 1
             WHERE id = $6 AND version = $7
             RETURNING version`
 
@@ -333,7 +519,7 @@ func (m UserModal) UpdateProfile(user *User) error {
         user.Version,
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    ctx, cancel := m.queryContext()
     defer cancel()
 
     err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
@@ -348,6 +534,250 @@ func (m UserModal) UpdateProfile(user *User) error {
     return nil
 }
 
+// SoftDelete deactivates a user account and scrubs its personal data. The row is
+// kept so that reservations and payments referencing it stay intact, but the
+// email is replaced with a non-reversible placeholder, names, contact details and
+// the linked Google account are cleared, and all tokens and QR codes for the user
+// are revoked. Clearing the Google account lets it sign up again.
+func (m UserModal) SoftDelete(id uuid.UUID) error {
+    ctx, cancel := m.queryContext()
+    defer cancel()
+
+    tx, err := m.DB.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    hash := sha256.Sum256([]byte(id.String()))
+    placeholderEmail := fmt.Sprintf("deleted-%x@deleted.invalid", hash[:12])
+
+    query := `UPDATE users
+            SET email = $1, user_name = 'deleted user', first_name = NULL, last_name = NULL, mobile_number = NULL, avatar_url = NULL, google_id = NULL,
+                disability_permit_number = NULL, has_disability_permit = false, mobile_verified = false, sms_notifications = false,
+                activated = false, deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP, version = version + 1
+            WHERE id = $2 AND deleted_at IS NULL`
+
+    result, err := tx.ExecContext(ctx, query, placeholderEmail, id)
+    if err != nil {
+        return err
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+
+    if rowsAffected == 0 {
+        return ErrRecordNotFound
+    }
+
+    _, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE user_id = $1`, id)
+    if err != nil {
+        return err
+    }
+
+    _, err = tx.ExecContext(ctx, `UPDATE qr_codes SET is_active = false, updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE user_id = $1 AND is_active = true`, id)
+    if err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// Users are reminded 30 minutes ahead unless they choose otherwise; the default
+// lives on the reminder_lead_minutes column.
+func ValidateReminderLeadMinutes(v *validator.Validator, minutes int) {
+	v.Check(validator.PermittedValue(minutes, 15, 30, 60, 120), "lead_minutes", "must be one of 15, 30, 60 or 120")
+}
+
+func (m UserModal) GetReminderLeadMinutes(id uuid.UUID) (int, error) {
+	query := `SELECT reminder_lead_minutes FROM users WHERE id = $1 AND deleted_at IS NULL`
+
+	var minutes int
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&minutes)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return minutes, nil
+}
+
+func (m UserModal) SetReminderLeadMinutes(id uuid.UUID, minutes int) error {
+	query := `UPDATE users
+            SET reminder_lead_minutes = $1, updated_at = CURRENT_TIMESTAMP
+            WHERE id = $2 AND deleted_at IS NULL`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, minutes, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetShowFullName reports whether the user has chosen to be named in full on
+// their reviews rather than by first name and last initial.
+func (m UserModal) GetShowFullName(id uuid.UUID) (bool, error) {
+	query := `SELECT show_full_name FROM users WHERE id = $1 AND deleted_at IS NULL`
+
+	var show bool
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&show)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, ErrRecordNotFound
+		default:
+			return false, err
+		}
+	}
+
+	return show, nil
+}
+
+func (m UserModal) SetShowFullName(id uuid.UUID, show bool) error {
+	query := `UPDATE users
+            SET show_full_name = $1, updated_at = CURRENT_TIMESTAMP
+            WHERE id = $2 AND deleted_at IS NULL`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, show, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// CanUseSpotType reports whether the user may park in spots of the given type.
+// Handicapped spots are kept for users with a verified disability permit.
+func (u *User) CanUseSpotType(spotType string) bool {
+	return spotType != SpotTypeHandicapped || u.HasDisabilityPermit
+}
+
+// CheckSpotEligibility returns ErrNotEligibleForSpot when the user may not park
+// in spots of the given type.
+func (u *User) CheckSpotEligibility(spotType string) error {
+	if !u.CanUseSpotType(spotType) {
+		return ErrNotEligibleForSpot
+	}
+	return nil
+}
+
+// EligibleSpotTypes drops the spot types the user may not park in, keeping the
+// order of the rest.
+func (u *User) EligibleSpotTypes(spotTypes []string) []string {
+	eligible := make([]string, 0, len(spotTypes))
+	for _, spotType := range spotTypes {
+		if u.CanUseSpotType(spotType) {
+			eligible = append(eligible, spotType)
+		}
+	}
+	return eligible
+}
+
+// NormalizePermitNumber makes permit numbers case-insensitive.
+func NormalizePermitNumber(number string) string {
+	return strings.ToUpper(strings.TrimSpace(number))
+}
+
+func ValidateDisabilityPermitNumber(v *validator.Validator, number string) {
+	v.Check(number != "", "permit_number", "must be provided")
+	v.Check(len(number) <= 50, "permit_number", "must not be more than 50 characters long")
+}
+
+// SubmitDisabilityPermit records the user's disability permit number. The
+// number has to be verified by an admin before handicapped spots open up, so
+// submitting a new one clears any earlier verification.
+func (m UserModal) SubmitDisabilityPermit(id uuid.UUID, number string) error {
+	query := `UPDATE users
+            SET disability_permit_number = $1, has_disability_permit = false, updated_at = CURRENT_TIMESTAMP, version = version + 1
+            WHERE id = $2 AND deleted_at IS NULL`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, number, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// SetDisabilityPermitVerified records an admin's decision on the user's permit.
+// The permit number the admin reviewed is passed in, so a permit replaced in
+// the meantime returns ErrEditConflict rather than being verified unseen.
+func (m UserModal) SetDisabilityPermitVerified(id uuid.UUID, number string, verified bool) error {
+	query := `UPDATE users
+            SET has_disability_permit = $1, updated_at = CURRENT_TIMESTAMP, version = version + 1
+            WHERE id = $2 AND disability_permit_number = $3 AND deleted_at IS NULL`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, verified, id, number)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
 func ValidateProfile(v *validator.Validator, user *User) {
     v.Check(user.FirstName != nil && *user.FirstName != "", "first_name", "must be provided")
     v.Check(user.LastName != nil && *user.LastName != "", "last_name", "must be provided")
@@ -0,0 +1,440 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestSoftDeleteLocksUserOut(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+
+	token, err := m.Tokens.New(user.ID, time.Hour, ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Users.SoftDelete(user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Users.GetByEmail(user.Email); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("GetByEmail after delete: got %v; want ErrRecordNotFound", err)
+	}
+	if _, err := m.Users.GetForToken(ScopeAuthentication, token.Plaintext); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("GetForToken after delete: got %v; want ErrRecordNotFound", err)
+	}
+	if _, err := m.Users.Get(user.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Get after delete: got %v; want ErrRecordNotFound", err)
+	}
+
+	if err := m.Users.SoftDelete(user.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("second delete: got %v; want ErrRecordNotFound", err)
+	}
+}
+
+func TestSoftDeleteScrubsPersonalData(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+
+	_, err := m.Users.DB.Exec(`UPDATE users SET first_name = 'Ada', last_name = 'Lovelace', mobile_number = '+94771234567' WHERE id = $1`, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Users.SoftDelete(user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		email, userName             string
+		firstName, lastName, mobile sql.NullString
+		activated                   bool
+		deletedAt                   sql.NullTime
+	)
+	err = m.Users.DB.QueryRow(`SELECT email, user_name, first_name, last_name, mobile_number, activated, deleted_at FROM users WHERE id = $1`, user.ID).
+		Scan(&email, &userName, &firstName, &lastName, &mobile, &activated, &deletedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if email == user.Email || !strings.HasSuffix(email, "@deleted.invalid") {
+		t.Errorf("email: got %q; want a placeholder", email)
+	}
+	if userName != "deleted user" {
+		t.Errorf("user_name: got %q; want %q", userName, "deleted user")
+	}
+	if firstName.Valid || lastName.Valid || mobile.Valid {
+		t.Errorf("name and mobile number should be cleared; got %v %v %v", firstName, lastName, mobile)
+	}
+	if activated {
+		t.Error("deleted user is still activated")
+	}
+	if !deletedAt.Valid {
+		t.Error("deleted_at is not set")
+	}
+}
+
+func TestValidateReminderLeadMinutes(t *testing.T) {
+	for _, minutes := range []int{15, 30, 60, 120} {
+		v := validator.New()
+		if ValidateReminderLeadMinutes(v, minutes); !v.Valid() {
+			t.Errorf("%d minutes rejected: %v", minutes, v.Errors)
+		}
+	}
+
+	for _, minutes := range []int{0, -15, 45, 1440} {
+		v := validator.New()
+		if ValidateReminderLeadMinutes(v, minutes); v.Valid() {
+			t.Errorf("%d minutes accepted", minutes)
+		}
+	}
+}
+
+func TestSpotEligibility(t *testing.T) {
+	spotTypes := []string{SpotTypeHandicapped, SpotTypeElectric, SpotTypeRegular}
+
+	tests := []struct {
+		name         string
+		user         *User
+		wantEligible []string
+	}{
+		{"no permit", &User{}, []string{SpotTypeElectric, SpotTypeRegular}},
+		{"verified permit", &User{HasDisabilityPermit: true}, spotTypes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, spotType := range []string{SpotTypeRegular, SpotTypeElectric} {
+				if err := tt.user.CheckSpotEligibility(spotType); err != nil {
+					t.Errorf("%s spot: %v", spotType, err)
+				}
+			}
+
+			err := tt.user.CheckSpotEligibility(SpotTypeHandicapped)
+			if tt.user.HasDisabilityPermit && err != nil {
+				t.Errorf("handicapped spot: %v", err)
+			}
+			if !tt.user.HasDisabilityPermit && !errors.Is(err, ErrNotEligibleForSpot) {
+				t.Errorf("handicapped spot: err = %v, want %v", err, ErrNotEligibleForSpot)
+			}
+
+			got := tt.user.EligibleSpotTypes(spotTypes)
+			if strings.Join(got, ",") != strings.Join(tt.wantEligible, ",") {
+				t.Errorf("EligibleSpotTypes = %v, want %v", got, tt.wantEligible)
+			}
+		})
+	}
+}
+
+func TestValidateDisabilityPermitNumber(t *testing.T) {
+	if got := NormalizePermitNumber("  dp-1234 "); got != "DP-1234" {
+		t.Errorf("NormalizePermitNumber = %q, want %q", got, "DP-1234")
+	}
+
+	for _, number := range []string{"", strings.Repeat("A", 51)} {
+		v := validator.New()
+		if ValidateDisabilityPermitNumber(v, number); v.Valid() {
+			t.Errorf("permit number %q accepted", number)
+		}
+	}
+
+	v := validator.New()
+	if ValidateDisabilityPermitNumber(v, strings.Repeat("A", 50)); !v.Valid() {
+		t.Errorf("50 character permit number rejected: %v", v.Errors)
+	}
+}
+
+func TestDisabilityPermitVerification(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+
+	if err := m.Users.SubmitDisabilityPermit(user.ID, "DP-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// An admin who checked a number that has since been replaced can't verify it
+	if err := m.Users.SubmitDisabilityPermit(user.ID, "DP-2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Users.SetDisabilityPermitVerified(user.ID, "DP-1", true); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("verifying a replaced permit: err = %v, want %v", err, ErrEditConflict)
+	}
+
+	if err := m.Users.SetDisabilityPermitVerified(user.ID, "DP-2", true); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := m.Users.Get(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.HasDisabilityPermit || stored.DisabilityPermitNumber == nil || *stored.DisabilityPermitNumber != "DP-2" {
+		t.Errorf("after verification: permit %v, verified %t", stored.DisabilityPermitNumber, stored.HasDisabilityPermit)
+	}
+
+	// A new permit number has to be verified again
+	if err := m.Users.SubmitDisabilityPermit(user.ID, "DP-3"); err != nil {
+		t.Fatal(err)
+	}
+	stored, err = m.Users.Get(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.HasDisabilityPermit {
+		t.Error("resubmitted permit is still verified")
+	}
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	oldCost := PasswordCost
+	t.Cleanup(func() { PasswordCost = oldCost })
+
+	PasswordCost = bcrypt.MinCost
+
+	var p password
+	if err := p.Set("pa55word"); err != nil {
+		t.Fatal(err)
+	}
+	if p.NeedsRehash() {
+		t.Error("hash made at the current cost needs a rehash")
+	}
+
+	PasswordCost = bcrypt.MinCost + 1
+	if !p.NeedsRehash() {
+		t.Error("hash made at a lower cost doesn't need a rehash")
+	}
+
+	var unset password
+	if unset.NeedsRehash() {
+		t.Error("a user without a password needs a rehash")
+	}
+}
+
+func TestRehashPassword(t *testing.T) {
+	m := newTestModels(t)
+	user := insertTestUser(t, m)
+
+	oldCost := PasswordCost
+	t.Cleanup(func() { PasswordCost = oldCost })
+	PasswordCost = bcrypt.MinCost + 1
+
+	storedCost := func() int {
+		t.Helper()
+
+		var hash []byte
+		if err := m.Users.DB.QueryRow(`SELECT password_hash FROM users WHERE id = $1`, user.ID).Scan(&hash); err != nil {
+			t.Fatal(err)
+		}
+		cost, err := bcrypt.Cost(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cost
+	}
+
+	if err := m.Users.RehashPassword(user, "pa55word"); err != nil {
+		t.Fatal(err)
+	}
+	if cost := storedCost(); cost != PasswordCost {
+		t.Errorf("stored cost = %d; want %d", cost, PasswordCost)
+	}
+
+	stored, err := m.Users.Get(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := stored.Password.Matches("pa55word"); err != nil || !ok {
+		t.Errorf("rehashed password doesn't match: %v", err)
+	}
+
+	// A stale copy of the user mustn't overwrite a password changed since
+	stale := *user
+	stale.Password.hash = []byte("not the stored hash")
+	PasswordCost = bcrypt.MinCost + 2
+	if err := m.Users.RehashPassword(&stale, "pa55word"); err != nil {
+		t.Fatal(err)
+	}
+	if cost := storedCost(); cost != bcrypt.MinCost+1 {
+		t.Errorf("stale rehash changed the stored hash to cost %d", cost)
+	}
+}
+
+func TestFindOrCreateFromGoogleCreatesUser(t *testing.T) {
+	m := newTestModels(t)
+
+	googleUser := &GoogleUser{
+		ID:            "google-" + uuid.NewString(),
+		Email:         "google-" + uuid.NewString() + "@example.com",
+		VerifiedEmail: true,
+		Name:          "Google User",
+	}
+
+	user, created, err := m.Users.FindOrCreateFromGoogle(googleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		m.Users.DB.Exec(`DELETE FROM users WHERE id = $1`, user.ID)
+	})
+
+	if !created || user.AuthType != AuthTypeGoogle || !user.Activated || user.GoogleID == nil || *user.GoogleID != googleUser.ID {
+		t.Errorf("created %t, user %+v; want a new activated google user", created, user)
+	}
+
+	// Signing in again finds the same user, even if the Google email changed
+	googleUser.Email = "renamed-" + uuid.NewString() + "@example.com"
+	again, created, err := m.Users.FindOrCreateFromGoogle(googleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created || again.ID != user.ID {
+		t.Errorf("second sign in: created %t, user %s; want existing user %s", created, again.ID, user.ID)
+	}
+}
+
+func TestDeletedGoogleUserCanSignUpAgain(t *testing.T) {
+	m := newTestModels(t)
+
+	googleUser := &GoogleUser{
+		ID:            "google-" + uuid.NewString(),
+		Email:         "google-" + uuid.NewString() + "@example.com",
+		VerifiedEmail: true,
+		Name:          "Google User",
+	}
+
+	deleted, _, err := m.Users.FindOrCreateFromGoogle(googleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		m.Users.DB.Exec(`DELETE FROM users WHERE id = $1`, deleted.ID)
+	})
+
+	if err := m.Users.SoftDelete(deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var googleID sql.NullString
+	err = m.Users.DB.QueryRow(`SELECT google_id FROM users WHERE id = $1`, deleted.ID).Scan(&googleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if googleID.Valid {
+		t.Errorf("google_id: got %q; want it cleared", googleID.String)
+	}
+
+	// The same Google account signs up as a new user
+	user, created, err := m.Users.FindOrCreateFromGoogle(googleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		m.Users.DB.Exec(`DELETE FROM users WHERE id = $1`, user.ID)
+	})
+
+	if !created || user.ID == deleted.ID {
+		t.Errorf("created %t, user %s; want a new user, not deleted user %s", created, user.ID, deleted.ID)
+	}
+}
+func TestFindOrCreateFromGoogleLinksExistingAccount(t *testing.T) {
+	m := newTestModels(t)
+
+	user := insertTestUser(t, m)
+	_, err := m.Users.DB.Exec(`UPDATE users SET activated = false WHERE id = $1`, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	googleUser := &GoogleUser{ID: "google-" + uuid.NewString(), Email: user.Email, Name: "Test User"}
+
+	// Google hasn't verified the address, so it may not belong to the same person
+	_, _, err = m.Users.FindOrCreateFromGoogle(googleUser)
+	if !errors.Is(err, ErrGoogleLinkRefused) {
+		t.Errorf("unverified email: got %v; want ErrGoogleLinkRefused", err)
+	}
+
+	googleUser.VerifiedEmail = true
+	linked, created, err := m.Users.FindOrCreateFromGoogle(googleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created || linked.ID != user.ID {
+		t.Fatalf("created %t, user %s; want existing user %s", created, linked.ID, user.ID)
+	}
+	if linked.AuthType != AuthTypeBoth || !linked.Activated || linked.GoogleID == nil || *linked.GoogleID != googleUser.ID {
+		t.Errorf("linked user %+v; want %s, activated, google id %s", linked, AuthTypeBoth, googleUser.ID)
+	}
+
+	var googleID sql.NullString
+	err = m.Users.DB.QueryRow(`SELECT google_id FROM users WHERE id = $1`, user.ID).Scan(&googleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if googleID.String != googleUser.ID {
+		t.Errorf("stored google_id = %q; want %q", googleID.String, googleUser.ID)
+	}
+
+	// The password still works
+	stored, err := m.Users.GetByEmail(user.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match, err := stored.Password.Matches("pa55word"); err != nil || !match {
+		t.Errorf("password after linking: match %t, err %v", match, err)
+	}
+
+	// A different Google account with the same email can't take it over
+	other := &GoogleUser{ID: "google-" + uuid.NewString(), Email: user.Email, VerifiedEmail: true}
+	_, _, err = m.Users.FindOrCreateFromGoogle(other)
+	if !errors.Is(err, ErrGoogleLinkRefused) {
+		t.Errorf("second Google account: got %v; want ErrGoogleLinkRefused", err)
+	}
+}
+
+func TestFindOrCreateFromGoogleNeedsAccountID(t *testing.T) {
+	var m UserModal
+
+	_, _, err := m.FindOrCreateFromGoogle(&GoogleUser{Email: "someone@example.com", VerifiedEmail: true})
+	if !errors.Is(err, ErrMissingGoogleID) {
+		t.Errorf("got %v; want ErrMissingGoogleID", err)
+	}
+}
+
+func TestFindOrCreateFromGoogleMatchesOnGoogleID(t *testing.T) {
+	m := newTestModels(t)
+
+	user := insertTestUser(t, m)
+	other := insertTestUser(t, m)
+
+	googleUser := &GoogleUser{ID: "google-" + uuid.NewString(), Email: user.Email, VerifiedEmail: true}
+	if _, _, err := m.Users.FindOrCreateFromGoogle(googleUser); err != nil {
+		t.Fatal(err)
+	}
+
+	// The Google account now reports another user's address, e.g. after the
+	// old one was given up and reused. It still signs in as the linked user.
+	googleUser.Email = other.Email
+	found, created, err := m.Users.FindOrCreateFromGoogle(googleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created || found.ID != user.ID {
+		t.Errorf("created %t, user %s; want linked user %s, not %s", created, found.ID, user.ID, other.ID)
+	}
+
+	var googleID sql.NullString
+	err = m.Users.DB.QueryRow(`SELECT google_id FROM users WHERE id = $1`, other.ID).Scan(&googleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if googleID.Valid {
+		t.Errorf("other user was linked to %q", googleID.String)
+	}
+}
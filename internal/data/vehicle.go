@@ -1,7 +1,6 @@
 package data
 
 import (
-	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -15,18 +14,29 @@ var (
 	ErrDuplicateLicensePlate = errors.New("duplicate license plate")
 )
 
+const (
+	VehicleTypeCar        = "car"
+	VehicleTypeMotorcycle = "motorcycle"
+	VehicleTypeTruck      = "truck"
+	VehicleTypeSUV        = "suv"
+	VehicleTypeVan        = "van"
+)
+
+var VehicleTypes = []string{VehicleTypeCar, VehicleTypeMotorcycle, VehicleTypeTruck, VehicleTypeSUV, VehicleTypeVan}
+
 type Vehicle struct {
-	ID           uuid.UUID `json:"id" db:"id"`
-	UserID       uuid.UUID `json:"user_id" db:"user_id"`
-	LicensePlate string    `json:"license_plate" db:"license_plate"`
-	Make         string    `json:"make" db:"make"`
-	Model        string    `json:"model" db:"model"`
-	Color        string    `json:"color" db:"color"`
-	VehicleType  string    `json:"vehicle_type" db:"vehicle_type"` // car, motorcycle, truck, etc.
-	IsDefault    bool      `json:"is_default" db:"is_default"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
-	Version      int       `json:"version" db:"version"`
+	ID                uuid.UUID `json:"id" db:"id"`
+	UserID            uuid.UUID `json:"user_id" db:"user_id"`
+	LicensePlate      string    `json:"license_plate" db:"license_plate"`
+	Make              string    `json:"make" db:"make"`
+	Model             string    `json:"model" db:"model"`
+	Color             string    `json:"color" db:"color"`
+	VehicleType       string    `json:"vehicle_type" db:"vehicle_type"` // car, motorcycle, truck, etc.
+	PreferredSpotType *string   `json:"preferred_spot_type" db:"preferred_spot_type"`
+	IsDefault         bool      `json:"is_default" db:"is_default"`
+	CreatedAt         time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at" db:"updated_at"`
+	Version           int       `json:"version" db:"version"`
 }
 
 func ValidateVehicle(v *validator.Validator, vehicle *Vehicle) {
@@ -42,17 +52,31 @@ func ValidateVehicle(v *validator.Validator, vehicle *Vehicle) {
 	v.Check(vehicle.Color != "", "color", "must be provided")
 	v.Check(len(vehicle.Color) <= 30, "color", "must not be more than 30 characters long")
 
-	v.Check(validator.PermittedValue(vehicle.VehicleType, "car", "motorcycle", "truck", "suv", "van"), "vehicle_type", "must be a valid vehicle type")
+	v.Check(validator.PermittedValue(vehicle.VehicleType, VehicleTypes...), "vehicle_type", "must be a valid vehicle type")
+
+	if vehicle.PreferredSpotType != nil {
+		v.Check(validator.PermittedValue(*vehicle.PreferredSpotType, SpotTypes...), "preferred_spot_type", "must be a valid spot type")
+	}
+}
+
+// SpotTypePreference lists the spot types to try, in order, when a spot is
+// assigned automatically: the vehicle's preferred type, then regular.
+func (vehicle *Vehicle) SpotTypePreference() []string {
+	if vehicle.PreferredSpotType == nil || *vehicle.PreferredSpotType == SpotTypeRegular {
+		return []string{SpotTypeRegular}
+	}
+	return []string{*vehicle.PreferredSpotType, SpotTypeRegular}
 }
 
 type VehicleModel struct {
 	DB *sql.DB
+	queryScope
 }
 
 func (m VehicleModel) Insert(vehicle *Vehicle) error {
 	query := `
-		INSERT INTO vehicles (user_id, license_plate, make, model, color, vehicle_type, is_default)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO vehicles (user_id, license_plate, make, model, color, vehicle_type, preferred_spot_type, is_default)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id, created_at, updated_at, version`
 
 	args := []any{
@@ -62,10 +86,11 @@ func (m VehicleModel) Insert(vehicle *Vehicle) error {
 		vehicle.Model,
 		vehicle.Color,
 		vehicle.VehicleType,
+		vehicle.PreferredSpotType,
 		vehicle.IsDefault,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
@@ -96,13 +121,13 @@ func (m VehicleModel) Insert(vehicle *Vehicle) error {
 
 func (m VehicleModel) Get(id uuid.UUID) (*Vehicle, error) {
 	query := `
-		SELECT id, user_id, license_plate, make, model, color, vehicle_type, is_default, created_at, updated_at, version
+		SELECT id, user_id, license_plate, make, model, color, vehicle_type, preferred_spot_type, is_default, created_at, updated_at, version
 		FROM vehicles
 		WHERE id = $1`
 
 	var vehicle Vehicle
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
@@ -113,6 +138,7 @@ func (m VehicleModel) Get(id uuid.UUID) (*Vehicle, error) {
 		&vehicle.Model,
 		&vehicle.Color,
 		&vehicle.VehicleType,
+		&vehicle.PreferredSpotType,
 		&vehicle.IsDefault,
 		&vehicle.CreatedAt,
 		&vehicle.UpdatedAt,
@@ -133,7 +159,7 @@ func (m VehicleModel) Get(id uuid.UUID) (*Vehicle, error) {
 
 func (m VehicleModel) GetAllForUser(userID uuid.UUID, filters Filters) ([]*Vehicle, Metadata, error) {
 	query := `
-		SELECT count(*) OVER(), id, user_id, license_plate, make, model, color, vehicle_type, is_default, created_at, updated_at, version
+		SELECT count(*) OVER(), id, user_id, license_plate, make, model, color, vehicle_type, preferred_spot_type, is_default, created_at, updated_at, version
 		FROM vehicles
 		WHERE user_id = $1
 		ORDER BY %s %s, id ASC
@@ -141,7 +167,7 @@ func (m VehicleModel) GetAllForUser(userID uuid.UUID, filters Filters) ([]*Vehic
 
 	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	args := []any{userID, filters.limit(), filters.offset()}
@@ -167,6 +193,7 @@ func (m VehicleModel) GetAllForUser(userID uuid.UUID, filters Filters) ([]*Vehic
 			&vehicle.Model,
 			&vehicle.Color,
 			&vehicle.VehicleType,
+			&vehicle.PreferredSpotType,
 			&vehicle.IsDefault,
 			&vehicle.CreatedAt,
 			&vehicle.UpdatedAt,
@@ -190,13 +217,13 @@ func (m VehicleModel) GetAllForUser(userID uuid.UUID, filters Filters) ([]*Vehic
 
 func (m VehicleModel) GetByLicensePlate(licensePlate string) (*Vehicle, error) {
 	query := `
-		SELECT id, user_id, license_plate, make, model, color, vehicle_type, is_default, created_at, updated_at, version
+		SELECT id, user_id, license_plate, make, model, color, vehicle_type, preferred_spot_type, is_default, created_at, updated_at, version
 		FROM vehicles
 		WHERE license_plate = $1`
 
 	var vehicle Vehicle
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, licensePlate).Scan(
@@ -207,6 +234,7 @@ func (m VehicleModel) GetByLicensePlate(licensePlate string) (*Vehicle, error) {
 		&vehicle.Model,
 		&vehicle.Color,
 		&vehicle.VehicleType,
+		&vehicle.PreferredSpotType,
 		&vehicle.IsDefault,
 		&vehicle.CreatedAt,
 		&vehicle.UpdatedAt,
@@ -228,8 +256,8 @@ func (m VehicleModel) GetByLicensePlate(licensePlate string) (*Vehicle, error) {
 func (m VehicleModel) Update(vehicle *Vehicle) error {
 	query := `
 		UPDATE vehicles
-		SET license_plate = $1, make = $2, model = $3, color = $4, vehicle_type = $5, is_default = $6, updated_at = CURRENT_TIMESTAMP, version = version + 1
-		WHERE id = $7 AND version = $8
+		SET license_plate = $1, make = $2, model = $3, color = $4, vehicle_type = $5, preferred_spot_type = $6, is_default = $7, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $8 AND version = $9
 		RETURNING updated_at, version`
 
 	args := []any{
@@ -238,12 +266,13 @@ func (m VehicleModel) Update(vehicle *Vehicle) error {
 		vehicle.Model,
 		vehicle.Color,
 		vehicle.VehicleType,
+		vehicle.PreferredSpotType,
 		vehicle.IsDefault,
 		vehicle.ID,
 		vehicle.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&vehicle.UpdatedAt, &vehicle.Version)
@@ -272,7 +301,7 @@ func (m VehicleModel) Update(vehicle *Vehicle) error {
 func (m VehicleModel) Delete(id uuid.UUID) error {
 	query := `DELETE FROM vehicles WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	result, err := m.DB.ExecContext(ctx, query, id)
@@ -296,7 +325,7 @@ func (m VehicleModel) SetAsDefault(userID, vehicleID uuid.UUID) error {
 	// First, unset all defaults for the user
 	query1 := `UPDATE vehicles SET is_default = false WHERE user_id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query1, userID)
@@ -327,7 +356,7 @@ func (m VehicleModel) SetAsDefault(userID, vehicleID uuid.UUID) error {
 func (m VehicleModel) UnsetDefaultForUser(userID, exceptVehicleID uuid.UUID) error {
 	query := `UPDATE vehicles SET is_default = false WHERE user_id = $1 AND id != $2`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext()
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, userID, exceptVehicleID)
@@ -0,0 +1,59 @@
+package data
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+func TestSpotTypePreference(t *testing.T) {
+	ptr := func(s string) *string { return &s }
+
+	tests := []struct {
+		preferred *string
+		want      []string
+	}{
+		{nil, []string{SpotTypeRegular}},
+		{ptr(SpotTypeRegular), []string{SpotTypeRegular}},
+		{ptr(SpotTypeElectric), []string{SpotTypeElectric, SpotTypeRegular}},
+		{ptr(SpotTypeHandicapped), []string{SpotTypeHandicapped, SpotTypeRegular}},
+	}
+
+	for _, tt := range tests {
+		vehicle := &Vehicle{PreferredSpotType: tt.preferred}
+		if got := vehicle.SpotTypePreference(); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("preferred %v: got %v; want %v", tt.preferred, got, tt.want)
+		}
+	}
+}
+
+func TestEligibleSpotTypes(t *testing.T) {
+	preference := []string{SpotTypeHandicapped, SpotTypeRegular}
+
+	if got := (&User{}).EligibleSpotTypes(preference); fmt.Sprint(got) != fmt.Sprint([]string{SpotTypeRegular}) {
+		t.Errorf("without a permit: got %v; want only regular", got)
+	}
+	if got := (&User{HasDisabilityPermit: true}).EligibleSpotTypes(preference); fmt.Sprint(got) != fmt.Sprint(preference) {
+		t.Errorf("with a permit: got %v; want %v", got, preference)
+	}
+}
+
+func TestValidateVehiclePreferredSpotType(t *testing.T) {
+	vehicle := &Vehicle{LicensePlate: "CAB-1234", Make: "Nissan", Model: "Leaf", Color: "blue", VehicleType: "car"}
+
+	for _, spotType := range SpotTypes {
+		vehicle.PreferredSpotType = &spotType
+		v := validator.New()
+		if ValidateVehicle(v, vehicle); !v.Valid() {
+			t.Errorf("%q rejected: %v", spotType, v.Errors)
+		}
+	}
+
+	invalid := "valet"
+	vehicle.PreferredSpotType = &invalid
+	v := validator.New()
+	if ValidateVehicle(v, vehicle); v.Errors["preferred_spot_type"] == "" {
+		t.Errorf("%q accepted", invalid)
+	}
+}
@@ -0,0 +1,187 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// ViolationResolution records how a lot owner dealt with a violated session.
+type ViolationResolution struct {
+	ResolvedBy *uuid.UUID `json:"resolved_by"`
+	Note       string     `json:"note"`
+	Completed  bool       `json:"completed"`
+	Fee        float64    `json:"fee"`
+	ResolvedAt time.Time  `json:"resolved_at"`
+}
+
+// Violation is a session that was marked as a violation, with its resolution
+// once it has one.
+type Violation struct {
+	SessionDetail
+	Resolution *ViolationResolution `json:"resolution"`
+}
+
+func ValidateViolationResolution(v *validator.Validator, resolution *ViolationResolution) {
+	v.Check(resolution.Note != "", "note", "must be provided")
+	v.Check(len(resolution.Note) <= 500, "note", "must not be more than 500 characters long")
+
+	v.Check(resolution.Fee >= 0, "fee", "must not be negative")
+	v.Check(resolution.Fee <= 10000, "fee", "must not exceed 10,000")
+	ValidateMoney(v, "fee", "", resolution.Fee)
+	if !resolution.Completed {
+		v.Check(resolution.Fee == 0, "fee", "can only be charged when completing the session")
+	}
+}
+
+// GetViolationsByLot returns the lot's violated sessions, open ones first. A
+// resolved violation stays listed even after its session was completed. With
+// resolved set, only resolved or only open violations are returned.
+func (m ParkingSessionModel) GetViolationsByLot(lotID uuid.UUID, resolved *bool, filters Filters) ([]*Violation, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), ps.id, ps.reservation_id, ps.user_id, ps.vehicle_id, ps.parking_spot_id, ps.check_in_time, ps.check_out_time, ps.status, ps.total_duration, ps.total_amount, ps.expected_end, ps.prepaid_amount, ps.created_at, ps.updated_at, ps.version,
+		       spot.spot_number, lot.id, lot.name, lot.address,
+		       vr.parking_session_id IS NOT NULL, vr.resolved_by, COALESCE(vr.note, ''), COALESCE(vr.completed, false), COALESCE(vr.fee, 0), COALESCE(vr.resolved_at, ps.updated_at)
+		FROM parking_sessions ps
+		INNER JOIN parking_spots spot ON ps.parking_spot_id = spot.id
+		INNER JOIN parking_lots lot ON spot.parking_lot_id = lot.id
+		LEFT JOIN violation_resolutions vr ON vr.parking_session_id = ps.id
+		WHERE spot.parking_lot_id = $1
+		AND (ps.status = $2 OR vr.parking_session_id IS NOT NULL)
+		AND ($3::boolean IS NULL OR (vr.parking_session_id IS NOT NULL) = $3)
+		ORDER BY vr.parking_session_id IS NULL DESC, ps.%s %s, ps.id ASC
+		LIMIT $4 OFFSET $5`
+
+	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	args := []any{lotID, SessionStatusViolated, resolved, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	violations := []*Violation{}
+
+	for rows.Next() {
+		var violation Violation
+		var isResolved bool
+		var resolution ViolationResolution
+
+		err := rows.Scan(
+			&totalRecords,
+			&violation.ID,
+			&violation.ReservationID,
+			&violation.UserID,
+			&violation.VehicleID,
+			&violation.ParkingSpotID,
+			&violation.CheckInTime,
+			&violation.CheckOutTime,
+			&violation.Status,
+			&violation.TotalDuration,
+			&violation.TotalAmount,
+			&violation.ExpectedEnd,
+			&violation.PrepaidAmount,
+			&violation.CreatedAt,
+			&violation.UpdatedAt,
+			&violation.Version,
+			&violation.SpotNumber,
+			&violation.ParkingLotID,
+			&violation.LotName,
+			&violation.LotAddress,
+			&isResolved,
+			&resolution.ResolvedBy,
+			&resolution.Note,
+			&resolution.Completed,
+			&resolution.Fee,
+			&resolution.ResolvedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		if isResolved {
+			violation.Resolution = &resolution
+		}
+
+		violations = append(violations, &violation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return violations, metadata, nil
+}
+
+// ResolveViolation records the resolution of a violated session. When the
+// resolution completes the session, it moves to completed, is checked out if
+// it wasn't already, and the fee is added to its total. A session that is no
+// longer an open violation returns ErrEditConflict.
+func (m ParkingSessionModel) ResolveViolation(session *ParkingSession, resolution *ViolationResolution) error {
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO violation_resolutions (parking_session_id, resolved_by, note, completed, fee)
+		SELECT id, $2, $3, $4, $5
+		FROM parking_sessions
+		WHERE id = $1 AND status = $6 AND version = $7
+		ON CONFLICT (parking_session_id) DO NOTHING
+		RETURNING resolved_at`
+
+	args := []any{session.ID, resolution.ResolvedBy, resolution.Note, resolution.Completed, resolution.Fee, SessionStatusViolated, session.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&resolution.ResolvedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if resolution.Completed {
+		query = `
+			UPDATE parking_sessions
+			SET status = $1,
+			    check_out_time = COALESCE(check_out_time, CURRENT_TIMESTAMP),
+			    total_duration = COALESCE(total_duration, (EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - check_in_time) / 60)::int),
+			    total_amount = COALESCE(total_amount, 0) + $2,
+			    updated_at = CURRENT_TIMESTAMP, version = version + 1
+			WHERE id = $3
+			RETURNING check_out_time, status, total_duration, total_amount, updated_at, version`
+
+		err = tx.QueryRowContext(ctx, query, SessionStatusCompleted, resolution.Fee, session.ID).Scan(
+			&session.CheckOutTime,
+			&session.Status,
+			&session.TotalDuration,
+			&session.TotalAmount,
+			&session.UpdatedAt,
+			&session.Version,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,119 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+func TestValidateViolationResolution(t *testing.T) {
+	tests := []struct {
+		name       string
+		resolution ViolationResolution
+		field      string
+	}{
+		{"valid", ViolationResolution{Note: "Towed", Completed: true, Fee: 25}, ""},
+		{"missing note", ViolationResolution{Completed: true}, "note"},
+		{"negative fee", ViolationResolution{Note: "x", Completed: true, Fee: -1}, "fee"},
+		{"fee without completing", ViolationResolution{Note: "x", Fee: 10}, "fee"},
+		{"unrounded fee", ViolationResolution{Note: "x", Completed: true, Fee: 10.005}, "fee"},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateViolationResolution(v, &tt.resolution)
+
+		switch {
+		case tt.field == "" && !v.Valid():
+			t.Errorf("%s: got errors %v", tt.name, v.Errors)
+		case tt.field != "" && v.Errors[tt.field] == "":
+			t.Errorf("%s: got errors %v; want one for %q", tt.name, v.Errors, tt.field)
+		}
+	}
+}
+
+func TestListAndResolveViolations(t *testing.T) {
+	m := newTestModels(t)
+	owner := insertTestUser(t, m)
+	driver := insertTestUser(t, m)
+	lot, spots := insertTestLot(t, m, owner.ID, 3)
+
+	now := time.Now()
+	open := insertTestSession(t, m, driver.ID, spots[0], now.Add(-time.Hour))
+	toResolve := insertTestSession(t, m, driver.ID, spots[1], now.Add(-2*time.Hour))
+	insertTestSession(t, m, driver.ID, spots[2], now.Add(-3*time.Hour))
+
+	for _, session := range []*ParkingSession{open, toResolve} {
+		if _, err := m.ParkingSessions.MarkAsViolation(session.ID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(resolved *bool) []*Violation {
+		t.Helper()
+
+		violations, _, err := m.ParkingSessions.GetViolationsByLot(lot.ID, resolved, Filters{
+			Page:         1,
+			PageSize:     20,
+			Sort:         "check_in_time",
+			SortSafelist: []string{"check_in_time"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return violations
+	}
+
+	violations := list(nil)
+	if len(violations) != 2 {
+		t.Fatalf("got %d violations; want 2", len(violations))
+	}
+	for _, violation := range violations {
+		if violation.Resolution != nil {
+			t.Errorf("violation %s: got resolution %+v before resolving", violation.ID, *violation.Resolution)
+		}
+		if violation.LotName != lot.Name {
+			t.Errorf("violation %s: got lot name %q; want %q", violation.ID, violation.LotName, lot.Name)
+		}
+	}
+
+	session, err := m.ParkingSessions.Get(toResolve.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolution := &ViolationResolution{ResolvedBy: &owner.ID, Note: "Paid at the gate", Completed: true, Fee: 25}
+	if err := m.ParkingSessions.ResolveViolation(session, resolution); err != nil {
+		t.Fatal(err)
+	}
+	if session.Status != SessionStatusCompleted || session.CheckOutTime == nil || session.TotalAmount == nil || *session.TotalAmount != 25 {
+		t.Errorf("got status %s, check-out %v, total %v; want completed, checked out, 25", session.Status, session.CheckOutTime, session.TotalAmount)
+	}
+
+	// A resolution is recorded once.
+	stale := *session
+	if err := m.ParkingSessions.ResolveViolation(&stale, &ViolationResolution{ResolvedBy: &owner.ID, Note: "Again"}); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("resolving twice: got %v; want ErrEditConflict", err)
+	}
+
+	yes, no := true, false
+
+	resolved := list(&yes)
+	if len(resolved) != 1 || resolved[0].ID != toResolve.ID {
+		t.Fatalf("resolved: got %d violations; want only %s", len(resolved), toResolve.ID)
+	}
+	got := resolved[0].Resolution
+	if got == nil || got.ResolvedBy == nil || *got.ResolvedBy != owner.ID || got.Note != "Paid at the gate" || !got.Completed || got.Fee != 25 || got.ResolvedAt.IsZero() {
+		t.Errorf("got resolution %+v; want the owner's, completed with a 25 fee", got)
+	}
+
+	if unresolved := list(&no); len(unresolved) != 1 || unresolved[0].ID != open.ID {
+		t.Errorf("open: got %d violations; want only %s", len(unresolved), open.ID)
+	}
+
+	// Open violations are listed before resolved ones.
+	if all := list(nil); len(all) != 2 || all[0].ID != open.ID {
+		t.Errorf("got %d violations; want 2 with the open one first", len(all))
+	}
+}
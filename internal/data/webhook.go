@@ -0,0 +1,480 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+// Events owners can subscribe a webhook to.
+const (
+	WebhookEventReservationCreated   = "reservation.created"
+	WebhookEventReservationCancelled = "reservation.cancelled"
+	WebhookEventSessionCheckedIn     = "session.checked_in"
+	WebhookEventSessionCheckedOut    = "session.checked_out"
+	WebhookEventPaymentCompleted     = "payment.completed"
+)
+
+// WebhookEventTest is sent by the test endpoint. It can't be subscribed to.
+const WebhookEventTest = "webhook.test"
+
+var WebhookEvents = []string{
+	WebhookEventReservationCreated,
+	WebhookEventReservationCancelled,
+	WebhookEventSessionCheckedIn,
+	WebhookEventSessionCheckedOut,
+	WebhookEventPaymentCompleted,
+}
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Webhook is an owner's subscription to events at their lots. Without a
+// ParkingLotID it covers every lot the owner has.
+type Webhook struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	OwnerID      uuid.UUID  `json:"owner_id" db:"owner_id"`
+	ParkingLotID *uuid.UUID `json:"parking_lot_id" db:"parking_lot_id"`
+	URL          string     `json:"url" db:"url"`
+	Secret       string     `json:"-" db:"secret"`
+	EventTypes   []string   `json:"event_types" db:"event_types"`
+	IsActive     bool       `json:"is_active" db:"is_active"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	Version      int        `json:"version" db:"version"`
+}
+
+// AllowInsecureWebhooks lets webhook URLs use plain http. It is set once at
+// startup, and only in development.
+var AllowInsecureWebhooks = false
+
+func ValidateWebhook(v *validator.Validator, webhook *Webhook) {
+	v.Check(webhook.URL != "", "url", "must be provided")
+	v.Check(len(webhook.URL) <= 2000, "url", "must not be more than 2000 characters long")
+	if webhook.URL != "" {
+		u, err := url.Parse(webhook.URL)
+		switch {
+		case err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http"):
+			v.AddError("url", "must be an absolute https URL")
+		case u.Scheme == "http" && !AllowInsecureWebhooks:
+			v.AddError("url", "must use https")
+		}
+	}
+
+	v.Check(len(webhook.EventTypes) > 0, "event_types", "must contain at least one event")
+	v.Check(validator.Unique(webhook.EventTypes), "event_types", "must not contain duplicate events")
+	for _, event := range webhook.EventTypes {
+		v.Check(validator.PermittedValue(event, WebhookEvents...), "event_types", "must only contain reservation.created, reservation.cancelled, session.checked_in, session.checked_out or payment.completed")
+	}
+}
+
+// WebhookDelivery is one event sent, or being sent, to one webhook. URL and
+// Secret are filled in when deliveries are claimed for sending.
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id" db:"id"`
+	WebhookID      uuid.UUID       `json:"webhook_id" db:"webhook_id"`
+	EventType      string          `json:"event_type" db:"event_type"`
+	Payload        json.RawMessage `json:"payload" db:"payload"`
+	Status         string          `json:"status" db:"status"`
+	Attempts       int             `json:"attempts" db:"attempts"`
+	ResponseStatus *int            `json:"response_status" db:"response_status"`
+	LastError      *string         `json:"last_error" db:"last_error"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at" db:"next_attempt_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at" db:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+	Version        int             `json:"version" db:"version"`
+	URL            string          `json:"-"`
+	Secret         string          `json:"-"`
+}
+
+// NewWebhookDelivery builds the delivery of an event to webhook. The payload
+// carries the delivery ID so subscribers can drop duplicates caused by retries.
+func NewWebhookDelivery(webhook *Webhook, event string, data any, now time.Time) (*WebhookDelivery, error) {
+	delivery := &WebhookDelivery{
+		ID:            uuid.New(),
+		WebhookID:     webhook.ID,
+		EventType:     event,
+		Status:        WebhookDeliveryPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		URL:           webhook.URL,
+		Secret:        webhook.Secret,
+	}
+
+	payload, err := json.Marshal(map[string]any{
+		"id":         delivery.ID,
+		"event":      event,
+		"created_at": now.UTC().Format(time.RFC3339),
+		"data":       data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	delivery.Payload = payload
+
+	return delivery, nil
+}
+
+// Succeed records a delivery the subscriber accepted.
+func (d *WebhookDelivery) Succeed(responseStatus int, now time.Time) {
+	d.Attempts++
+	d.Status = WebhookDeliveryDelivered
+	d.ResponseStatus = &responseStatus
+	d.LastError = nil
+	d.DeliveredAt = &now
+}
+
+// Fail records a failed attempt at now. A zero responseStatus means no response
+// was received. After maxAttempts the delivery is given up on.
+func (d *WebhookDelivery) Fail(err error, responseStatus int, maxAttempts int, now time.Time) {
+	d.Attempts++
+
+	message := err.Error()
+	d.LastError = &message
+
+	d.ResponseStatus = nil
+	if responseStatus != 0 {
+		d.ResponseStatus = &responseStatus
+	}
+
+	if d.Attempts >= maxAttempts {
+		d.Status = WebhookDeliveryFailed
+		return
+	}
+
+	d.Status = WebhookDeliveryPending
+	d.NextAttemptAt = now.Add(RetryBackoff(d.Attempts))
+}
+
+type WebhookModel struct {
+	DB *sql.DB
+	queryScope
+}
+
+func (m WebhookModel) Insert(webhook *Webhook) error {
+	query := `
+		INSERT INTO webhooks (owner_id, parking_lot_id, url, secret, event_types)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, is_active, created_at, version`
+
+	args := []any{webhook.OwnerID, webhook.ParkingLotID, webhook.URL, webhook.Secret, pq.Array(webhook.EventTypes)}
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.ID, &webhook.IsActive, &webhook.CreatedAt, &webhook.Version)
+}
+
+func (m WebhookModel) Get(id uuid.UUID) (*Webhook, error) {
+	query := `
+		SELECT id, owner_id, parking_lot_id, url, secret, event_types, is_active, created_at, version
+		FROM webhooks
+		WHERE id = $1`
+
+	var webhook Webhook
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&webhook.ID,
+		&webhook.OwnerID,
+		&webhook.ParkingLotID,
+		&webhook.URL,
+		&webhook.Secret,
+		pq.Array(&webhook.EventTypes),
+		&webhook.IsActive,
+		&webhook.CreatedAt,
+		&webhook.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &webhook, nil
+}
+
+func (m WebhookModel) GetAllForOwner(ownerID uuid.UUID) ([]*Webhook, error) {
+	query := `
+		SELECT id, owner_id, parking_lot_id, url, secret, event_types, is_active, created_at, version
+		FROM webhooks
+		WHERE owner_id = $1
+		ORDER BY created_at DESC, id ASC`
+
+	return m.list(query, ownerID)
+}
+
+// GetSubscribed returns the active webhooks of the lot's owner that listen for
+// event at the lot.
+func (m WebhookModel) GetSubscribed(lotID uuid.UUID, event string) ([]*Webhook, error) {
+	query := `
+		SELECT w.id, w.owner_id, w.parking_lot_id, w.url, w.secret, w.event_types, w.is_active, w.created_at, w.version
+		FROM webhooks w
+		INNER JOIN parking_lots pl ON pl.owner_id = w.owner_id
+		WHERE pl.id = $1 AND w.is_active AND $2 = ANY(w.event_types)
+		AND (w.parking_lot_id IS NULL OR w.parking_lot_id = pl.id)`
+
+	return m.list(query, lotID, event)
+}
+
+func (m WebhookModel) list(query string, args ...any) ([]*Webhook, error) {
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+
+	for rows.Next() {
+		var webhook Webhook
+
+		err := rows.Scan(
+			&webhook.ID,
+			&webhook.OwnerID,
+			&webhook.ParkingLotID,
+			&webhook.URL,
+			&webhook.Secret,
+			pq.Array(&webhook.EventTypes),
+			&webhook.IsActive,
+			&webhook.CreatedAt,
+			&webhook.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		webhooks = append(webhooks, &webhook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (m WebhookModel) Delete(id uuid.UUID) error {
+	query := `DELETE FROM webhooks WHERE id = $1`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m WebhookModel) InsertDelivery(delivery *WebhookDelivery) error {
+	query := `
+		INSERT INTO webhook_deliveries (id, webhook_id, event_type, payload, status, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING version`
+
+	args := []any{
+		delivery.ID,
+		delivery.WebhookID,
+		delivery.EventType,
+		[]byte(delivery.Payload),
+		delivery.Status,
+		delivery.NextAttemptAt,
+		delivery.CreatedAt,
+	}
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&delivery.Version)
+}
+
+// ClaimDueDeliveries picks up to limit pending deliveries whose next attempt is
+// due and pushes their next attempt out by lease, so concurrent workers don't
+// send the same delivery twice.
+func (m WebhookModel) ClaimDueDeliveries(limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	query := `
+		WITH claimed AS (
+			UPDATE webhook_deliveries
+			SET next_attempt_at = NOW() + make_interval(secs => $2)
+			WHERE id IN (
+				SELECT id FROM webhook_deliveries
+				WHERE status = 'pending' AND next_attempt_at <= NOW()
+				ORDER BY next_attempt_at
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *
+		)
+		SELECT c.id, c.webhook_id, c.event_type, c.payload, c.status, c.attempts, c.response_status, c.last_error,
+			c.next_attempt_at, c.delivered_at, c.created_at, c.version, w.url, w.secret
+		FROM claimed c
+		INNER JOIN webhooks w ON w.id = c.webhook_id`
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+
+	for rows.Next() {
+		var delivery WebhookDelivery
+		var payload []byte
+
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.WebhookID,
+			&delivery.EventType,
+			&payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.ResponseStatus,
+			&delivery.LastError,
+			&delivery.NextAttemptAt,
+			&delivery.DeliveredAt,
+			&delivery.CreatedAt,
+			&delivery.Version,
+			&delivery.URL,
+			&delivery.Secret,
+		)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = payload
+
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// SaveDeliveryAttempt stores the outcome recorded with Succeed or Fail.
+func (m WebhookModel) SaveDeliveryAttempt(delivery *WebhookDelivery) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, response_status = $3, last_error = $4, next_attempt_at = $5, delivered_at = $6, version = version + 1
+		WHERE id = $7 AND version = $8
+		RETURNING version`
+
+	args := []any{
+		delivery.Status,
+		delivery.Attempts,
+		delivery.ResponseStatus,
+		delivery.LastError,
+		delivery.NextAttemptAt,
+		delivery.DeliveredAt,
+		delivery.ID,
+		delivery.Version,
+	}
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&delivery.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetDeliveries is the delivery log of a webhook.
+func (m WebhookModel) GetDeliveries(webhookID uuid.UUID, status string, filters Filters) ([]*WebhookDelivery, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, webhook_id, event_type, payload, status, attempts, response_status, last_error,
+			next_attempt_at, delivered_at, created_at, version
+		FROM webhook_deliveries
+		WHERE webhook_id = $1 AND (status = $2 OR $2 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $3 OFFSET $4`
+
+	query = fmt.Sprintf(query, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := m.queryContext()
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, webhookID, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	deliveries := []*WebhookDelivery{}
+
+	for rows.Next() {
+		var delivery WebhookDelivery
+		var payload []byte
+
+		err := rows.Scan(
+			&totalRecords,
+			&delivery.ID,
+			&delivery.WebhookID,
+			&delivery.EventType,
+			&payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.ResponseStatus,
+			&delivery.LastError,
+			&delivery.NextAttemptAt,
+			&delivery.DeliveredAt,
+			&delivery.CreatedAt,
+			&delivery.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		delivery.Payload = payload
+
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return deliveries, metadata, nil
+}
@@ -0,0 +1,93 @@
+// Package geocode turns coordinates into human readable addresses.
+package geocode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoAddress is returned when a provider has no address for the coordinates.
+var ErrNoAddress = errors.New("no address found for coordinates")
+
+// Geocoder looks up the address at a point.
+type Geocoder interface {
+	ReverseGeocode(lat, lng float64) (address string, err error)
+}
+
+// Mock answers every lookup with a fixed address. It is meant for development
+// and tests, where calling a real provider isn't wanted.
+type Mock struct {
+	Address string
+	Err     error
+	Calls   int
+}
+
+func (m *Mock) ReverseGeocode(lat, lng float64) (string, error) {
+	m.Calls++
+	if m.Err != nil {
+		return "", m.Err
+	}
+	return m.Address, nil
+}
+
+// Nominatim uses an OpenStreetMap Nominatim server. Its usage policy requires
+// an identifying User-Agent.
+type Nominatim struct {
+	baseURL   string
+	userAgent string
+	client    *http.Client
+}
+
+func NewNominatim(baseURL, userAgent string) *Nominatim {
+	return &Nominatim{
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		userAgent: userAgent,
+		client:    &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (n *Nominatim) ReverseGeocode(lat, lng float64) (string, error) {
+	params := url.Values{}
+	params.Set("format", "jsonv2")
+	params.Set("lat", strconv.FormatFloat(lat, 'f', -1, 64))
+	params.Set("lon", strconv.FormatFloat(lng, 'f', -1, 64))
+
+	req, err := http.NewRequest(http.MethodGet, n.baseURL+"/reverse?"+params.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", n.userAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("nominatim reverse geocode: %s", resp.Status)
+	}
+
+	var result struct {
+		DisplayName string `json:"display_name"`
+		Error       string `json:"error"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return "", err
+	}
+
+	if result.Error != "" || result.DisplayName == "" {
+		return "", ErrNoAddress
+	}
+
+	return result.DisplayName, nil
+}
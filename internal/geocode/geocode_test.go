@@ -0,0 +1,53 @@
+package geocode
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNominatimReverseGeocode(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/reverse" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("User-Agent"); got != "test-agent" {
+			t.Errorf("got User-Agent %q; want test-agent", got)
+		}
+
+		q := r.URL.Query()
+		switch {
+		case q.Get("format") != "jsonv2":
+			t.Errorf("got format %q; want jsonv2", q.Get("format"))
+		case q.Get("lat") == "500":
+			w.WriteHeader(http.StatusInternalServerError)
+		case q.Get("lat") == "0":
+			w.Write([]byte(`{"error": "Unable to geocode"}`))
+		case q.Get("lat") == "6.9271" && q.Get("lon") == "79.8612":
+			w.Write([]byte(`{"display_name": "Galle Road, Colombo"}`))
+		default:
+			t.Errorf("unexpected query %q", r.URL.RawQuery)
+		}
+	}))
+	defer ts.Close()
+
+	n := NewNominatim(ts.URL+"/", "test-agent")
+
+	address, err := n.ReverseGeocode(6.9271, 79.8612)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address != "Galle Road, Colombo" {
+		t.Errorf("got address %q; want %q", address, "Galle Road, Colombo")
+	}
+
+	if _, err := n.ReverseGeocode(0, 0); !errors.Is(err, ErrNoAddress) {
+		t.Errorf("no address: got %v; want ErrNoAddress", err)
+	}
+
+	if _, err := n.ReverseGeocode(500, 0); err == nil {
+		t.Error("server error: got no error")
+	}
+}
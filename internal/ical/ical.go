@@ -0,0 +1,111 @@
+// Package ical writes iCalendar (RFC 5545) feeds that calendar apps can
+// subscribe to.
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"time"
+)
+
+const timeFormat = "20060102T150405Z"
+
+// maxLineLength is the longest a content line may be, in octets, before it
+// has to be folded.
+const maxLineLength = 75
+
+// Event statuses
+const (
+	StatusTentative = "TENTATIVE"
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+// Event is a VEVENT. UID must stay the same across feed refreshes so calendar
+// apps update the event instead of adding a copy.
+type Event struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Location    string
+	Description string
+	Status      string
+	Updated     time.Time
+}
+
+// Calendar is a VCALENDAR holding events.
+type Calendar struct {
+	ProdID string
+	Name   string
+	Events []Event
+}
+
+// Bytes renders the calendar. Times are written in UTC.
+func (c Calendar) Bytes() []byte {
+	var buf bytes.Buffer
+
+	writeLine(&buf, "BEGIN:VCALENDAR")
+	writeLine(&buf, "VERSION:2.0")
+	writeLine(&buf, "PRODID:"+c.ProdID)
+	writeLine(&buf, "CALSCALE:GREGORIAN")
+	writeLine(&buf, "METHOD:PUBLISH")
+	if c.Name != "" {
+		writeLine(&buf, "X-WR-CALNAME:"+escape(c.Name))
+	}
+
+	for _, event := range c.Events {
+		writeLine(&buf, "BEGIN:VEVENT")
+		writeLine(&buf, "UID:"+event.UID)
+		writeLine(&buf, "DTSTAMP:"+event.Updated.UTC().Format(timeFormat))
+		writeLine(&buf, "DTSTART:"+event.Start.UTC().Format(timeFormat))
+		writeLine(&buf, "DTEND:"+event.End.UTC().Format(timeFormat))
+		writeLine(&buf, "SUMMARY:"+escape(event.Summary))
+		if event.Location != "" {
+			writeLine(&buf, "LOCATION:"+escape(event.Location))
+		}
+		if event.Description != "" {
+			writeLine(&buf, "DESCRIPTION:"+escape(event.Description))
+		}
+		if event.Status != "" {
+			writeLine(&buf, "STATUS:"+event.Status)
+		}
+		writeLine(&buf, "END:VEVENT")
+	}
+
+	writeLine(&buf, "END:VCALENDAR")
+
+	return buf.Bytes()
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// escape escapes text values.
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// writeLine writes a CRLF terminated content line, folding it onto
+// continuation lines that start with a space when it is too long. Lines are
+// only split between UTF-8 characters.
+func writeLine(buf *bytes.Buffer, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isCharStart(line[cut]) {
+			cut--
+		}
+		buf.WriteString(line[:cut])
+		buf.WriteString("\r\n ")
+		line = line[cut:]
+
+		// Continuation lines lose an octet to the leading space
+		limit = maxLineLength - 1
+	}
+	buf.WriteString(line)
+	buf.WriteString("\r\n")
+}
+
+func isCharStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,116 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// unfold joins folded content lines back together.
+func unfold(s string) string {
+	return strings.ReplaceAll(s, "\r\n ", "")
+}
+
+func TestCalendarBytes(t *testing.T) {
+	colombo := time.FixedZone("Asia/Colombo", 5*3600+1800)
+
+	calendar := Calendar{
+		ProdID: "-//SpotLinkIO//Test//EN",
+		Name:   "Mine, all mine",
+		Events: []Event{{
+			UID:         "abc@spotlinkio",
+			Start:       time.Date(2026, 3, 1, 9, 30, 0, 0, colombo),
+			End:         time.Date(2026, 3, 1, 11, 0, 0, 0, colombo),
+			Summary:     "Parking at Lot; A, spot 1",
+			Location:    `1 Main St\Back`,
+			Description: "line one\nline two",
+			Status:      StatusConfirmed,
+			Updated:     time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+		}},
+	}
+
+	got := string(calendar.Bytes())
+
+	if !strings.HasSuffix(got, "\r\n") || strings.Contains(strings.ReplaceAll(got, "\r\n", ""), "\n") {
+		t.Errorf("lines aren't all CRLF terminated: %q", got)
+	}
+
+	want := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//SpotLinkIO//Test//EN",
+		`X-WR-CALNAME:Mine\, all mine`,
+		"BEGIN:VEVENT",
+		"UID:abc@spotlinkio",
+		"DTSTAMP:20260201T000000Z",
+		"DTSTART:20260301T040000Z",
+		"DTEND:20260301T053000Z",
+		`SUMMARY:Parking at Lot\; A\, spot 1`,
+		`LOCATION:1 Main St\\Back`,
+		`DESCRIPTION:line one\nline two`,
+		"STATUS:CONFIRMED",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}
+
+	lines := strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n")
+	for _, line := range want {
+		found := false
+		for _, l := range lines {
+			found = found || l == line
+		}
+		if !found {
+			t.Errorf("missing line %q in:\n%s", line, got)
+		}
+	}
+	if lines[0] != "BEGIN:VCALENDAR" || lines[len(lines)-1] != "END:VCALENDAR" {
+		t.Errorf("calendar isn't wrapped in VCALENDAR:\n%s", got)
+	}
+}
+
+func TestCalendarOmitsEmptyFields(t *testing.T) {
+	calendar := Calendar{
+		ProdID: "-//SpotLinkIO//Test//EN",
+		Events: []Event{{UID: "abc@spotlinkio", Summary: "Parking"}},
+	}
+
+	got := string(calendar.Bytes())
+	for _, prefix := range []string{"X-WR-CALNAME:", "LOCATION:", "DESCRIPTION:", "STATUS:"} {
+		if strings.Contains(got, prefix) {
+			t.Errorf("empty field written as %q:\n%s", prefix, got)
+		}
+	}
+}
+
+func TestWriteLineFolds(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"short", "Parking"},
+		{"exactly the limit", strings.Repeat("a", maxLineLength-len("SUMMARY:"))},
+		{"long ascii", strings.Repeat("abcdefghij", 30)},
+		{"long multibyte", strings.Repeat("පාක් කිරීම ", 20)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calendar := Calendar{Events: []Event{{UID: "abc@spotlinkio", Summary: tt.value}}}
+			got := string(calendar.Bytes())
+
+			for _, line := range strings.Split(got, "\r\n") {
+				if len(line) > maxLineLength {
+					t.Errorf("line is %d octets, longer than %d: %q", len(line), maxLineLength, line)
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("line splits a character: %q", line)
+				}
+			}
+
+			if !strings.Contains(unfold(got), "\r\nSUMMARY:"+tt.value+"\r\n") {
+				t.Errorf("unfolded summary doesn't match %q:\n%s", tt.value, got)
+			}
+		})
+	}
+}
@@ -50,7 +50,6 @@ func (l *Logger) PrintInfo(message string, properties map[string]string) {
 
 func (l *Logger) PrintError(err error, properties map[string]string) {
 	l.print(LevelError, err.Error(), properties)
-	os.Exit(1)
 }
 
 func (l *Logger) PrintFatal(err error, properties map[string]string) {
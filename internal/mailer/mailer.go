@@ -3,53 +3,135 @@ package mailer
 import (
 	"bytes"
 	"embed"
+	"errors"
 	"github.com/go-mail/mail/v2"
 	"html/template"
+	"sort"
 	"time"
 )
 
+//go:embed "templates"
 var templateFS embed.FS
 
-type Mailer struct {
-	dialer *mail.Dialer
-	sender string
+var ErrUnknownTemplate = errors.New("unknown email template")
+
+// Template describes an email template and the data it expects.
+type Template struct {
+	Name       string         `json:"name"`
+	File       string         `json:"file"`
+	SampleData map[string]any `json:"sample_data"`
 }
 
-func New(host string, port int, username, password, sender string) Mailer {
-	dialer := mail.NewDialer(host, port, username, password)
-	dialer.Timeout = 5 * time.Second
+// templates maps the names passed to Send to their files, along with sample
+// data used for previews.
+var templates = map[string]Template{
+	"user_welcome": {
+		Name: "user_welcome",
+		File: "user_welcome.tmpl",
+		SampleData: map[string]any{
+			"activationToken": "SAMPLEACTIVATIONTOKEN",
+			"userName":        "Jane Doe",
+			"frontendURL":     "https://app.spotlinkio.com",
+			"expiresIn":       "3 days",
+		},
+	},
+	"password_reset": {
+		Name: "password_reset",
+		File: "token_password_reset.tmpl",
+		SampleData: map[string]any{
+			"passwordResetToken": "SAMPLERESETTOKEN",
+			"frontendURL":        "https://app.spotlinkio.com",
+			"expiresIn":          "45 minutes",
+		},
+	},
+	"account_deletion": {
+		Name: "account_deletion",
+		File: "token_account_deletion.tmpl",
+		SampleData: map[string]any{
+			"accountDeletionToken": "SAMPLEDELETIONTOKEN",
+			"frontendURL":          "https://app.spotlinkio.com",
+			"expiresIn":            "30 minutes",
+		},
+	},
+}
 
-	return Mailer{
-		dialer: dialer,
-		sender: sender,
+// Templates lists the available templates sorted by name.
+func Templates() []Template {
+	list := make([]Template, 0, len(templates))
+	for _, t := range templates {
+		list = append(list, t)
 	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
 }
 
-func (m Mailer) Send(recipient, templateType string, data any) error {
-	var tempFile string
-	if templateType == "user_welcome" {
-		tempFile = "/home/andrew/dev/SpotLinkIO/backend/internal/mailer/templates/user_welcome.tmpl"
-	} else if templateType == "password_reset" {
-		tempFile = "/home/andrew/dev/SpotLinkIO/backend/internal/mailer/templates/token_password_reset.tmpl"
+// LookupTemplate returns the template registered under name.
+func LookupTemplate(name string) (Template, bool) {
+	t, ok := templates[name]
+	return t, ok
+}
+
+// Rendered is an email produced from a template, ready to send.
+type Rendered struct {
+	Subject   string `json:"subject"`
+	PlainBody string `json:"plain_body"`
+	HTMLBody  string `json:"html_body"`
+}
+
+// Render executes the named template with data without sending anything.
+func Render(name string, data any) (*Rendered, error) {
+	t, ok := templates[name]
+	if !ok {
+		return nil, ErrUnknownTemplate
 	}
-	tmpl, err := template.ParseFiles(tempFile)
+
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+t.File)
 	if err != nil {
-		return err
+		return nil, err
 	}
+
 	subject := new(bytes.Buffer)
 	err = tmpl.ExecuteTemplate(subject, "subject", data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	plainBody := new(bytes.Buffer)
 	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	htmlBody := new(bytes.Buffer)
 	err = tmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Rendered{
+		Subject:   subject.String(),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+	}, nil
+}
+
+type Mailer struct {
+	dialer *mail.Dialer
+	sender string
+}
+
+func New(host string, port int, username, password, sender string) Mailer {
+	dialer := mail.NewDialer(host, port, username, password)
+	dialer.Timeout = 5 * time.Second
+
+	return Mailer{
+		dialer: dialer,
+		sender: sender,
+	}
+}
+
+func (m Mailer) Send(recipient, templateType string, data any) error {
+	email, err := Render(templateType, data)
 	if err != nil {
 		return err
 	}
@@ -57,9 +139,9 @@ func (m Mailer) Send(recipient, templateType string, data any) error {
 	msg := mail.NewMessage()
 	msg.SetHeader("To", recipient)
 	msg.SetHeader("From", m.sender)
-	msg.SetHeader("Subject", subject.String())
-	msg.SetBody("text/plain", plainBody.String())
-	msg.AddAlternative("text/html", htmlBody.String())
+	msg.SetHeader("Subject", email.Subject)
+	msg.SetBody("text/plain", email.PlainBody)
+	msg.AddAlternative("text/html", email.HTMLBody)
 
 	for i := 1; i <= 3; i++ {
 		err = m.dialer.DialAndSend(msg)
@@ -0,0 +1,92 @@
+package mailer
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRenderWelcome(t *testing.T) {
+	tmpl, ok := LookupTemplate("user_welcome")
+	if !ok {
+		t.Fatal("user_welcome not registered")
+	}
+
+	email, err := Render(tmpl.Name, tmpl.SampleData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if email.Subject != "Welcome to SpotLinkIO!" {
+		t.Errorf("got subject %q", email.Subject)
+	}
+
+	link := "https://app.spotlinkio.com/auth/activate?token=SAMPLEACTIVATIONTOKEN"
+	for _, want := range []string{"Hi Jane Doe", link, "expire in 3 days"} {
+		if !strings.Contains(email.PlainBody, want) {
+			t.Errorf("plain body is missing %q", want)
+		}
+	}
+	for _, want := range []string{"Jane Doe", "SAMPLEACTIVATIONTOKEN"} {
+		if !strings.Contains(email.HTMLBody, want) {
+			t.Errorf("HTML body is missing %q", want)
+		}
+	}
+}
+
+func TestRenderEscapesHTML(t *testing.T) {
+	tmpl, _ := LookupTemplate("user_welcome")
+
+	data := map[string]any{}
+	for key, value := range tmpl.SampleData {
+		data[key] = value
+	}
+	data["userName"] = "<script>alert(1)</script>"
+
+	email, err := Render(tmpl.Name, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(email.HTMLBody, "<script>alert(1)</script>") {
+		t.Error("HTML body contains the unescaped user name")
+	}
+}
+
+func TestSampleDataFillsEveryTemplate(t *testing.T) {
+	templates := Templates()
+	if len(templates) == 0 {
+		t.Fatal("no templates")
+	}
+
+	field := regexp.MustCompile(`{{\s*\.(\w+)`)
+
+	for i, tmpl := range templates {
+		if i > 0 && templates[i-1].Name >= tmpl.Name {
+			t.Errorf("templates not sorted: %q before %q", templates[i-1].Name, tmpl.Name)
+		}
+
+		source, err := templateFS.ReadFile("templates/" + tmpl.File)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, match := range field.FindAllStringSubmatch(string(source), -1) {
+			if _, ok := tmpl.SampleData[match[1]]; !ok {
+				t.Errorf("%s: no sample data for %s", tmpl.Name, match[1])
+			}
+		}
+
+		if _, err := Render(tmpl.Name, tmpl.SampleData); err != nil {
+			t.Errorf("%s: %v", tmpl.Name, err)
+		}
+	}
+}
+
+func TestRenderUnknownTemplate(t *testing.T) {
+	if _, err := Render("nope", nil); !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("got %v; want ErrUnknownTemplate", err)
+	}
+	if _, ok := LookupTemplate("nope"); ok {
+		t.Error("LookupTemplate found an unknown template")
+	}
+}
@@ -0,0 +1,111 @@
+package qrcode
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/png"
+	"testing"
+
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/validator"
+)
+
+func TestRenderImagePNG(t *testing.T) {
+	low, err := renderImage("https://spotlinkio.com/verify/ABC123", ImageOptions{Size: 512, ErrorCorrection: "low", Format: FormatPNG})
+	if err != nil {
+		t.Fatal(err)
+	}
+	high, err := renderImage("https://spotlinkio.com/verify/ABC123", ImageOptions{Size: 512, ErrorCorrection: "high", Format: FormatPNG})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(high))
+	if err != nil {
+		t.Fatalf("not a PNG: %v", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 512 || bounds.Dy() != 512 {
+		t.Errorf("got %dx%d; want 512x512", bounds.Dx(), bounds.Dy())
+	}
+
+	if bytes.Equal(low, high) {
+		t.Error("error correction level made no difference to the image")
+	}
+}
+
+func TestRenderImageSVG(t *testing.T) {
+	image, err := renderImage("https://spotlinkio.com/verify/ABC123", ImageOptions{Size: 300, ErrorCorrection: "medium", Format: FormatSVG})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var svg struct {
+		XMLName xml.Name `xml:"svg"`
+		Width   string   `xml:"width,attr"`
+		Height  string   `xml:"height,attr"`
+		Path    struct {
+			D string `xml:"d,attr"`
+		} `xml:"path"`
+	}
+	if err := xml.Unmarshal(image, &svg); err != nil {
+		t.Fatalf("not valid SVG: %v", err)
+	}
+	if svg.Width != "300" || svg.Height != "300" {
+		t.Errorf("got %sx%s; want 300x300", svg.Width, svg.Height)
+	}
+	if svg.Path.D == "" {
+		t.Error("SVG has no modules drawn")
+	}
+}
+
+func TestRenderImageRejectsUnknownErrorCorrection(t *testing.T) {
+	_, err := renderImage("content", ImageOptions{Size: 256, ErrorCorrection: "extreme", Format: FormatPNG})
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestValidateImageOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    ImageOptions
+		wantKey string
+	}{
+		{"defaults", DefaultImageOptions(), ""},
+		{"512px high correction", ImageOptions{Size: 512, ErrorCorrection: "high", Format: FormatPNG}, ""},
+		{"svg", ImageOptions{Size: 256, ErrorCorrection: "medium", Format: FormatSVG}, ""},
+		{"too small", ImageOptions{Size: MinImageSize - 1, ErrorCorrection: "medium", Format: FormatPNG}, "size"},
+		{"too large", ImageOptions{Size: MaxImageSize + 1, ErrorCorrection: "medium", Format: FormatPNG}, "size"},
+		{"unknown correction", ImageOptions{Size: 256, ErrorCorrection: "max", Format: FormatPNG}, "error_correction"},
+		{"unknown format", ImageOptions{Size: 256, ErrorCorrection: "medium", Format: "gif"}, "format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateImageOptions(v, tt.opts)
+
+			if tt.wantKey == "" {
+				if !v.Valid() {
+					t.Errorf("unexpected errors: %v", v.Errors)
+				}
+				return
+			}
+			if _, ok := v.Errors[tt.wantKey]; !ok {
+				t.Errorf("got errors %v; want one for %q", v.Errors, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestContentType(t *testing.T) {
+	for name, want := range map[string]string{
+		"qr_ABC.png":     "image/png",
+		"qr_ABC.svg":     "image/svg+xml",
+		"qr_ABC":         "image/png",
+		"dir/qr_ABC.svg": "image/svg+xml",
+	} {
+		if got := ContentType(name); got != want {
+			t.Errorf("ContentType(%q) = %q; want %q", name, got, want)
+		}
+	}
+}
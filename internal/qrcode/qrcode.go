@@ -1,61 +1,122 @@
 package qrcode
 
 import (
+    "crypto/hmac"
     "crypto/rand"
+    "crypto/sha256"
     "encoding/base64"
     "encoding/json"
+    "errors"
     "fmt"
-    "os"
-    "path/filepath"
+    "net/url"
     "time"
 
     "github.com/google/uuid"
     "github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
-    "github.com/skip2/go-qrcode"
 )
 
+// ErrInvalidPass is returned when a scanned code is not a reservation pass or
+// its signature does not match.
+var ErrInvalidPass = errors.New("invalid reservation pass")
+
+// ErrInvalidSpotCode is returned when a scanned code is not a spot code or its
+// signature does not match.
+var ErrInvalidSpotCode = errors.New("invalid spot code")
+
+var (
+    ErrQRExpired     = errors.New("QR code has expired")
+    ErrQRTampered    = errors.New("QR code data does not match its record")
+    ErrCorruptQRData = errors.New("QR code data is corrupt")
+)
+
+// DefaultVerifyURL is the verification page QR codes link to when the service
+// is given none.
+const DefaultVerifyURL = "https://spotlinkio.com/verify"
+
 type Service struct {
-    models     data.Models
-    storageDir string
+    models       data.Models
+    storage      Storage
+    signingKey   []byte
+    expiryLeeway time.Duration // how long after expiring a code is still accepted
+    verifyURL    string        // page the QR image links to, without the code
 }
 
-func NewService(models data.Models, storageDir string) *Service {
-    // Ensure storage directory exists
-    os.MkdirAll(storageDir, 0755)
-    
+func NewService(models data.Models, storage Storage, signingKey []byte, expiryLeeway time.Duration, verifyURL string) *Service {
+    if verifyURL == "" {
+        verifyURL = DefaultVerifyURL
+    }
+
     return &Service{
-        models:     models,
-        storageDir: storageDir,
+        models:       models,
+        storage:      storage,
+        signingKey:   signingKey,
+        expiryLeeway: expiryLeeway,
+        verifyURL:    verifyURL,
+    }
+}
+
+func (s *Service) GenerateQRCode(userID, vehicleID uuid.UUID, expiryHours int, purpose string, opts ImageOptions) (*QRCodeResponse, error) {
+    qrCodeRecord, qrData, err := s.createQRCode(userID, vehicleID, expiryHours, purpose)
+    if err != nil {
+        return nil, err
     }
+
+    return s.writeImage(qrCodeRecord, qrData, opts)
 }
 
-func (s *Service) GenerateQRCode(userID, vehicleID uuid.UUID, expiryHours int, purpose string) (*QRCodeResponse, error) {
+// GenerateDataURL creates a QR code like GenerateQRCode but returns the image
+// inline as a base64 data URL instead of writing it to storage.
+func (s *Service) GenerateDataURL(userID, vehicleID uuid.UUID, expiryHours int, purpose string, opts ImageOptions) (*QRCodeResponse, error) {
+    qrCodeRecord, qrData, err := s.createQRCode(userID, vehicleID, expiryHours, purpose)
+    if err != nil {
+        return nil, err
+    }
+
+    verificationURL := s.verificationURL(qrCodeRecord.Code)
+
+    image, err := renderImage(verificationURL, opts)
+    if err != nil {
+        return nil, fmt.Errorf("failed to generate QR image: %w", err)
+    }
+
+    return &QRCodeResponse{
+        QRCode:    qrCodeRecord,
+        QRData:    qrData,
+        DataURL:   fmt.Sprintf("data:%s;base64,%s", mimeType(opts.Format), base64.StdEncoding.EncodeToString(image)),
+        VerifyURL: verificationURL,
+    }, nil
+}
+
+// createQRCode builds and stores a user QR code, replacing the user's
+// previous ones.
+func (s *Service) createQRCode(userID, vehicleID uuid.UUID, expiryHours int, purpose string) (*data.QRCode, data.QRCodeData, error) {
     // Get user data
     user, err := s.models.Users.Get(userID)
     if err != nil {
-        return nil, fmt.Errorf("failed to get user: %w", err)
+        return nil, data.QRCodeData{}, fmt.Errorf("failed to get user: %w", err)
     }
 
     // Get vehicle data
     vehicle, err := s.models.Vehicles.Get(vehicleID)
     if err != nil {
-        return nil, fmt.Errorf("failed to get vehicle: %w", err)
+        return nil, data.QRCodeData{}, fmt.Errorf("failed to get vehicle: %w", err)
     }
 
     // Verify vehicle belongs to user
     if vehicle.UserID != userID {
-        return nil, fmt.Errorf("vehicle does not belong to user")
+        return nil, data.QRCodeData{}, fmt.Errorf("vehicle does not belong to user")
     }
 
     // Generate unique code
     code, err := s.generateUniqueCode()
     if err != nil {
-        return nil, fmt.Errorf("failed to generate code: %w", err)
+        return nil, data.QRCodeData{}, fmt.Errorf("failed to generate code: %w", err)
     }
 
     // Create QR data
     expiresAt := time.Now().Add(time.Duration(expiryHours) * time.Hour)
     qrData := data.QRCodeData{
+        Version:     data.QRDataVersion,
         UserProfile: data.UserProfile{
             ID:           user.ID,
             UserName:     user.UserName,
@@ -83,13 +144,13 @@ func (s *Service) GenerateQRCode(userID, vehicleID uuid.UUID, expiryHours int, p
     // Marshal to JSON
     dataJSON, err := json.Marshal(qrData)
     if err != nil {
-        return nil, fmt.Errorf("failed to marshal QR data: %w", err)
+        return nil, data.QRCodeData{}, fmt.Errorf("failed to marshal QR data: %w", err)
     }
 
     // Create QR code record
     qrCodeRecord := &data.QRCode{
-        UserID:    userID,
-        VehicleID: vehicleID,
+        UserID:    &userID,
+        VehicleID: &vehicleID,
         Code:      code,
         Data:      string(dataJSON),
         ExpiresAt: expiresAt,
@@ -99,51 +160,348 @@ func (s *Service) GenerateQRCode(userID, vehicleID uuid.UUID, expiryHours int, p
     // Deactivate previous QR codes for this user (optional - based on business logic)
     err = s.models.QRCodes.DeactivateAllForUser(userID)
     if err != nil {
-        return nil, fmt.Errorf("failed to deactivate previous QR codes: %w", err)
+        return nil, data.QRCodeData{}, fmt.Errorf("failed to deactivate previous QR codes: %w", err)
     }
 
     // Save to database
+    err = s.models.QRCodes.Insert(qrCodeRecord)
+    if err != nil {
+        return nil, data.QRCodeData{}, fmt.Errorf("failed to save QR code: %w", err)
+    }
+
+    return qrCodeRecord, qrData, nil
+}
+
+// GenerateReservationPass issues a QR pass for a confirmed reservation. Unlike
+// the user QR code it admits only that reservation, carries a signed token so
+// the payload cannot be altered, and expires when the reservation ends. Any
+// earlier pass for the same reservation is revoked.
+func (s *Service) GenerateReservationPass(reservation *data.Reservation) (*QRCodeResponse, error) {
+    user, err := s.models.Users.Get(reservation.UserID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get user: %w", err)
+    }
+
+    vehicle, err := s.models.Vehicles.Get(reservation.VehicleID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get vehicle: %w", err)
+    }
+
+    code, err := s.generateUniqueCode()
+    if err != nil {
+        return nil, fmt.Errorf("failed to generate code: %w", err)
+    }
+
+    qrData := data.QRCodeData{
+        Version:     data.QRDataVersion,
+        UserProfile: data.UserProfile{
+            ID:           user.ID,
+            UserName:     user.UserName,
+            FirstName:    user.FirstName,
+            LastName:     user.LastName,
+            MobileNumber: user.MobileNumber,
+            Email:        user.Email,
+        },
+        Vehicle: data.VehicleData{
+            ID:           vehicle.ID,
+            LicensePlate: vehicle.LicensePlate,
+            Make:         vehicle.Make,
+            Model:        vehicle.Model,
+            Color:        vehicle.Color,
+            VehicleType:  vehicle.VehicleType,
+        },
+        QRInfo: data.QRCodeInfo{
+            Code:          code,
+            GeneratedAt:   time.Now(),
+            ExpiresAt:     reservation.EndTime,
+            Purpose:       data.QRPurposeReservation,
+            ReservationID: &reservation.ID,
+            Token:         s.signPass(code, reservation.ID, reservation.EndTime),
+        },
+    }
+
+    dataJSON, err := json.Marshal(qrData)
+    if err != nil {
+        return nil, fmt.Errorf("failed to marshal QR data: %w", err)
+    }
+
+    qrCodeRecord := &data.QRCode{
+        UserID:        &reservation.UserID,
+        VehicleID:     &reservation.VehicleID,
+        ReservationID: &reservation.ID,
+        Code:          code,
+        Data:          string(dataJSON),
+        ExpiresAt:     reservation.EndTime,
+        IsActive:      true,
+    }
+
+    err = s.models.QRCodes.DeactivateForReservation(reservation.ID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to deactivate previous passes: %w", err)
+    }
+
     err = s.models.QRCodes.Insert(qrCodeRecord)
     if err != nil {
         return nil, fmt.Errorf("failed to save QR code: %w", err)
     }
 
-    // Generate QR code image
-    imageFilename := fmt.Sprintf("qr_%s.png", code)
-    imagePath := filepath.Join(s.storageDir, imageFilename)
+    return s.writeImage(qrCodeRecord, qrData, DefaultImageOptions())
+}
+
+// VerifyReservationPass looks up an active reservation pass and checks its
+// signature. It returns the ID of the reservation the pass admits.
+func (s *Service) VerifyReservationPass(code string) (uuid.UUID, error) {
+    qrData, err := s.VerifyQRCode(code)
+    if err != nil {
+        return uuid.Nil, err
+    }
 
-    // Create QR verification URL (this would be your frontend URL)
-    verificationURL := fmt.Sprintf("https://spotlinkio.com/verify?code=%s", code)
+    info := qrData.QRInfo
+    if info.Purpose != data.QRPurposeReservation || info.ReservationID == nil {
+        return uuid.Nil, ErrInvalidPass
+    }
+
+    expected := s.signPass(info.Code, *info.ReservationID, info.ExpiresAt)
+    if !hmac.Equal([]byte(expected), []byte(info.Token)) {
+        return uuid.Nil, ErrInvalidPass
+    }
+
+    return *info.ReservationID, nil
+}
+
+// SpotCode returns the code for a spot's signage, issuing one the first time.
+// Drivers scan it to park in that spot. Later calls return the same code, so
+// signs already printed keep working; the code is signed like a reservation
+// pass and lasts data.SpotCodeValidity.
+func (s *Service) SpotCode(spot *data.ParkingSpot, opts ImageOptions) (*QRCodeResponse, error) {
+    qrCodeRecord, err := s.models.QRCodes.GetActiveForSpot(spot.ID)
+    switch {
+    case err == nil:
+        qrData, err := parseQRData(qrCodeRecord.Data)
+        if err != nil {
+            return nil, err
+        }
+
+        return s.writeImage(qrCodeRecord, *qrData, opts)
+    case !errors.Is(err, data.ErrRecordNotFound):
+        return nil, err
+    }
+
+    code, err := s.generateUniqueCode()
+    if err != nil {
+        return nil, fmt.Errorf("failed to generate code: %w", err)
+    }
+
+    now := time.Now()
+    expiresAt := now.Add(data.SpotCodeValidity)
+
+    qrData := data.QRCodeData{
+        Version: data.QRDataVersion,
+        QRInfo:  data.QRCodeInfo{
+            Code:          code,
+            GeneratedAt:   now,
+            ExpiresAt:     expiresAt,
+            Purpose:       data.QRPurposeSpot,
+            ParkingLotID:  &spot.ParkingLotID,
+            ParkingSpotID: &spot.ID,
+            Token:         s.signPass(code, spot.ID, expiresAt),
+        },
+    }
+
+    dataJSON, err := json.Marshal(qrData)
+    if err != nil {
+        return nil, fmt.Errorf("failed to marshal QR data: %w", err)
+    }
+
+    qrCodeRecord = &data.QRCode{
+        ParkingSpotID: &spot.ID,
+        Code:          code,
+        Data:          string(dataJSON),
+        ExpiresAt:     expiresAt,
+        IsActive:      true,
+    }
+
+    err = s.models.QRCodes.Insert(qrCodeRecord)
+    if err != nil {
+        return nil, fmt.Errorf("failed to save QR code: %w", err)
+    }
+
+    return s.writeImage(qrCodeRecord, qrData, opts)
+}
+
+// VerifySpotCode looks up an active spot code and checks its signature. It
+// returns the IDs of the lot and spot the code was issued for.
+func (s *Service) VerifySpotCode(code string) (uuid.UUID, uuid.UUID, error) {
+    qrData, err := s.VerifyQRCode(code)
+    if err != nil {
+        return uuid.Nil, uuid.Nil, err
+    }
+
+    info := qrData.QRInfo
+    if info.Purpose != data.QRPurposeSpot || info.ParkingLotID == nil || info.ParkingSpotID == nil {
+        return uuid.Nil, uuid.Nil, ErrInvalidSpotCode
+    }
+
+    expected := s.signPass(info.Code, *info.ParkingSpotID, info.ExpiresAt)
+    if !hmac.Equal([]byte(expected), []byte(info.Token)) {
+        return uuid.Nil, uuid.Nil, ErrInvalidSpotCode
+    }
+
+    return *info.ParkingLotID, *info.ParkingSpotID, nil
+}
+
+func (s *Service) signPass(code string, reservationID uuid.UUID, expiresAt time.Time) string {
+    mac := hmac.New(sha256.New, s.signingKey)
+    fmt.Fprintf(mac, "%s|%s|%d", code, reservationID, expiresAt.Unix())
+    return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// writeImage renders the image for a stored QR code and writes it to storage.
+func (s *Service) writeImage(qrCodeRecord *data.QRCode, qrData data.QRCodeData, opts ImageOptions) (*QRCodeResponse, error) {
+    code := qrCodeRecord.Code
+
+    verificationURL := s.verificationURL(code)
 
-    err = qrcode.WriteFile(verificationURL, qrcode.Medium, 256, imagePath)
+    // Generate QR code image
+    image, err := renderImage(verificationURL, opts)
     if err != nil {
         return nil, fmt.Errorf("failed to generate QR image: %w", err)
     }
 
+    imageURL, err := s.storage.Put(imageFilename(code, opts.Format), image)
+    if err != nil {
+        return nil, fmt.Errorf("failed to store QR image: %w", err)
+    }
+
     return &QRCodeResponse{
         QRCode:      qrCodeRecord,
         QRData:      qrData,
-        ImagePath:   imagePath,
-        ImageURL:    fmt.Sprintf("/v1/qr-images/%s", imageFilename),
+        ImageURL:    imageURL,
         VerifyURL:   verificationURL,
     }, nil
 }
 
+// Scanner roles decide how much of a QR code's embedded data a scan reveals.
+const (
+    ScannerAnonymous = "anonymous" // not signed in
+    ScannerUser      = "user"      // any signed-in user
+    ScannerOperator  = "operator"  // admins, and staff of the code's lot working a gate
+)
+
+// ScopeQRData returns only the part of a verified code's data the scanner is
+// allowed to see. Operators get everything. Everyone else gets the vehicle and
+// the driver's username and first name, without contact details or pass
+// signatures; signed-in users scanning an emergency code also get the driver's
+// mobile number so they can reach them.
+func ScopeQRData(qrData *data.QRCodeData, scannerRole string) *data.QRCodeData {
+    if scannerRole == ScannerOperator {
+        return qrData
+    }
+
+    profile := qrData.UserProfile
+
+    scoped := *qrData
+    scoped.UserProfile = data.UserProfile{
+        ID:        profile.ID,
+        UserName:  profile.UserName,
+        FirstName: profile.FirstName,
+    }
+    if qrData.QRInfo.Purpose == "emergency" && scannerRole == ScannerUser {
+        scoped.UserProfile.MobileNumber = profile.MobileNumber
+    }
+    scoped.QRInfo.Token = ""
+
+    return &scoped
+}
+
+// VerifyQRCode looks up a scanned code and returns its embedded data. Every
+// scan goes through here, so this is where expiry and revocation are enforced:
+// expired codes return ErrQRExpired and revoked or unknown ones
+// ErrRecordNotFound. A code whose embedded expiry disagrees with its record has
+// been altered and returns ErrQRTampered, and one whose record can't be read
+// returns ErrCorruptQRData.
 func (s *Service) VerifyQRCode(code string) (*data.QRCodeData, error) {
     qrCode, err := s.models.QRCodes.GetByCode(code)
     if err != nil {
         return nil, err
     }
 
+    qrData, err := parseQRData(qrCode.Data)
+    if err != nil {
+        return nil, err
+    }
+
+    if !sameExpiry(qrData.QRInfo.ExpiresAt, qrCode.ExpiresAt) {
+        return nil, ErrQRTampered
+    }
+
+    if time.Now().After(qrData.QRInfo.ExpiresAt.Add(s.expiryLeeway)) {
+        return nil, ErrQRExpired
+    }
+
+    if !qrCode.IsActive {
+        return nil, data.ErrRecordNotFound
+    }
+
+    return qrData, nil
+}
+
+// parseQRData reads the JSON stored with a QR code and checks it has what its
+// purpose needs: every code has a code, purpose and expiry, and all but spot
+// codes name a user and vehicle. Anything else, including a version newer than
+// this build understands, returns ErrCorruptQRData.
+func parseQRData(raw string) (*data.QRCodeData, error) {
     var qrData data.QRCodeData
-    err = json.Unmarshal([]byte(qrCode.Data), &qrData)
+    err := json.Unmarshal([]byte(raw), &qrData)
     if err != nil {
-        return nil, fmt.Errorf("failed to parse QR data: %w", err)
+        return nil, fmt.Errorf("%w: %v", ErrCorruptQRData, err)
+    }
+
+    // Codes from before the payload was versioned
+    if qrData.Version == 0 {
+        qrData.Version = 1
+    }
+
+    info := qrData.QRInfo
+
+    switch {
+    case qrData.Version > data.QRDataVersion:
+        return nil, fmt.Errorf("%w: unsupported version %d", ErrCorruptQRData, qrData.Version)
+    case info.Code == "" || info.Purpose == "" || info.ExpiresAt.IsZero():
+        return nil, fmt.Errorf("%w: missing code, purpose or expiry", ErrCorruptQRData)
+    case info.Purpose != data.QRPurposeSpot && (qrData.UserProfile.ID == uuid.Nil || qrData.Vehicle.ID == uuid.Nil):
+        return nil, fmt.Errorf("%w: missing user or vehicle", ErrCorruptQRData)
     }
 
     return &qrData, nil
 }
 
+// sameExpiry reports whether an expiry embedded in a code matches the one on
+// its record. qr_codes.expires_at has no time zone, so the record keeps the
+// wall clock time the code was written with, to the microsecond.
+func sameExpiry(embedded, stored time.Time) bool {
+    wall := time.Date(embedded.Year(), embedded.Month(), embedded.Day(), embedded.Hour(), embedded.Minute(), embedded.Second(), embedded.Nanosecond(), time.UTC)
+    stored = time.Date(stored.Year(), stored.Month(), stored.Day(), stored.Hour(), stored.Minute(), stored.Second(), stored.Nanosecond(), time.UTC)
+
+    diff := wall.Sub(stored)
+    return diff > -time.Millisecond && diff < time.Millisecond
+}
+
+// verificationURL is the link encoded in the QR image, the configured
+// verification page with the code added to its query.
+func (s *Service) verificationURL(code string) string {
+    return s.verifyURL + "?code=" + url.QueryEscape(code)
+}
+
+// ImageURL is the API path serving the image of the QR code with this code.
+func ImageURL(code, format string) string {
+    return imagePath(imageFilename(code, format))
+}
+
+func imageFilename(code, format string) string {
+    return fmt.Sprintf("qr_%s.%s", code, format)
+}
+
 func (s *Service) generateUniqueCode() (string, error) {
     bytes := make([]byte, 32)
     _, err := rand.Read(bytes)
@@ -156,7 +514,7 @@ func (s *Service) generateUniqueCode() (string, error) {
 type QRCodeResponse struct {
     QRCode    *data.QRCode     `json:"qr_code"`
     QRData    data.QRCodeData  `json:"qr_data"`
-    ImagePath string           `json:"-"`
-    ImageURL  string           `json:"image_url"`
+    ImageURL  string           `json:"image_url,omitempty"`
+    DataURL   string           `json:"data_url,omitempty"`
     VerifyURL string           `json:"verify_url"`
 }
\ No newline at end of file
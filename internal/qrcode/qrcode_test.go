@@ -0,0 +1,313 @@
+package qrcode
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+)
+
+func TestGenerateDataURL(t *testing.T) {
+	models := newTestModels(t)
+	user, vehicle := insertTestDriver(t, models)
+
+	storage, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewService(models, storage, []byte("test signing key"), 0, "")
+
+	resp, err := service.GenerateDataURL(user.ID, vehicle.ID, 1, "parking", DefaultImageOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const prefix = "data:image/png;base64,"
+	if !strings.HasPrefix(resp.DataURL, prefix) {
+		t.Fatalf("got %.40q; want a PNG data URL", resp.DataURL)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(resp.DataURL, prefix))
+	if err != nil {
+		t.Fatalf("data URL is not valid base64: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("data URL is not a PNG: %v", err)
+	}
+	if size := img.Bounds().Dx(); size != DefaultImageSize {
+		t.Errorf("got a %dpx image; want %dpx", size, DefaultImageSize)
+	}
+
+	if resp.ImageURL != "" {
+		t.Errorf("got image URL %q; want none", resp.ImageURL)
+	}
+	if _, err := storage.Get(imageFilename(resp.QRCode.Code, FormatPNG)); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("image was written to storage: %v", err)
+	}
+
+	// The code is still recorded, so it can be scanned.
+	qrData, err := service.VerifyQRCode(resp.QRCode.Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if qrData.Vehicle.ID != vehicle.ID {
+		t.Errorf("got vehicle %s; want %s", qrData.Vehicle.ID, vehicle.ID)
+	}
+}
+
+func TestScopeQRData(t *testing.T) {
+	first, last, mobile := "Nimal", "Perera", "+94770000000"
+
+	qrData := func(purpose string) *data.QRCodeData {
+		return &data.QRCodeData{
+			UserProfile: data.UserProfile{
+				ID:           uuid.New(),
+				UserName:     "nimal",
+				FirstName:    &first,
+				LastName:     &last,
+				MobileNumber: &mobile,
+				Email:        "nimal@example.com",
+			},
+			Vehicle: data.VehicleData{LicensePlate: "CAB-1234"},
+			QRInfo:  data.QRCodeInfo{Code: "ABC", Purpose: purpose, Token: "signature"},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		purpose     string
+		role        string
+		wantContact bool
+		wantMobile  bool
+	}{
+		{"anonymous", "identification", ScannerAnonymous, false, false},
+		{"anonymous emergency", "emergency", ScannerAnonymous, false, false},
+		{"signed in", "identification", ScannerUser, false, false},
+		{"signed in emergency", "emergency", ScannerUser, false, true},
+		{"operator", "identification", ScannerOperator, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := qrData(tt.purpose)
+			scoped := ScopeQRData(original, tt.role)
+
+			profile := scoped.UserProfile
+			if profile.ID != original.UserProfile.ID || profile.UserName != "nimal" || profile.FirstName == nil || *profile.FirstName != first {
+				t.Errorf("driver's name hidden: %+v", profile)
+			}
+			if scoped.Vehicle.LicensePlate != "CAB-1234" {
+				t.Errorf("vehicle hidden: %+v", scoped.Vehicle)
+			}
+
+			if hasContact := profile.Email != "" || profile.LastName != nil || scoped.QRInfo.Token != ""; hasContact != tt.wantContact {
+				t.Errorf("email %q, last name %v, token %q; want shown %t", profile.Email, profile.LastName, scoped.QRInfo.Token, tt.wantContact)
+			}
+			if hasMobile := profile.MobileNumber != nil; hasMobile != tt.wantMobile {
+				t.Errorf("mobile number shown %t; want %t", hasMobile, tt.wantMobile)
+			}
+
+			if original.UserProfile.Email == "" || original.QRInfo.Token == "" {
+				t.Error("scoping changed the verified data")
+			}
+		})
+	}
+}
+
+func TestVerifyQRCodeChecksExpiryAndRevocation(t *testing.T) {
+	models := newTestModels(t)
+	user, vehicle := insertTestDriver(t, models)
+
+	storage, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewService(models, storage, []byte("test signing key"), 0, "")
+	lenient := NewService(models, storage, []byte("test signing key"), time.Hour, "")
+
+	// A code generated with no validity has already expired
+	expired, err := service.GenerateDataURL(user.ID, vehicle.ID, 0, "parking", DefaultImageOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.VerifyQRCode(expired.QRCode.Code); !errors.Is(err, ErrQRExpired) {
+		t.Errorf("expired code: got %v; want %v", err, ErrQRExpired)
+	}
+	if _, err := lenient.VerifyQRCode(expired.QRCode.Code); err != nil {
+		t.Errorf("expired code within the leeway: %v", err)
+	}
+
+	resp, err := service.GenerateDataURL(user.ID, vehicle.ID, 1, "parking", DefaultImageOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.VerifyQRCode(resp.QRCode.Code); err != nil {
+		t.Fatalf("valid code: %v", err)
+	}
+
+	// Moving the expiry on the record no longer matches what the code carries
+	_, err = models.QRCodes.DB.Exec(`UPDATE qr_codes SET expires_at = expires_at + INTERVAL '1 day' WHERE code = $1`, resp.QRCode.Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.VerifyQRCode(resp.QRCode.Code); !errors.Is(err, ErrQRTampered) {
+		t.Errorf("tampered code: got %v; want %v", err, ErrQRTampered)
+	}
+
+	revoked, err := service.GenerateDataURL(user.ID, vehicle.ID, 1, "parking", DefaultImageOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.QRCodes.Revoke(revoked.QRCode); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.VerifyQRCode(revoked.QRCode.Code); !errors.Is(err, data.ErrRecordNotFound) {
+		t.Errorf("revoked code: got %v; want %v", err, data.ErrRecordNotFound)
+	}
+
+	if _, err := service.VerifyQRCode("NOSUCHCODE"); !errors.Is(err, data.ErrRecordNotFound) {
+		t.Errorf("unknown code: got %v; want %v", err, data.ErrRecordNotFound)
+	}
+}
+
+func TestSameExpiry(t *testing.T) {
+	colombo := time.FixedZone("Asia/Colombo", 5*3600+1800)
+	embedded := time.Date(2026, 3, 1, 9, 30, 0, 123456789, colombo)
+
+	tests := []struct {
+		name   string
+		stored time.Time
+		want   bool
+	}{
+		{"same wall clock", time.Date(2026, 3, 1, 9, 30, 0, 123456000, time.UTC), true},
+		{"a minute later", time.Date(2026, 3, 1, 9, 31, 0, 123456000, time.UTC), false},
+		{"a day earlier", time.Date(2026, 2, 28, 9, 30, 0, 123456000, time.UTC), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameExpiry(embedded, tt.stored); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQRData(t *testing.T) {
+	const (
+		user    = `"user_profile": {"id": "6f1c1c8e-3b0e-4a43-9d0c-0d6f4a1c2b3a"}`
+		vehicle = `"vehicle": {"id": "0b7d1a52-6a8e-4d8e-8f43-7c0a4e1f9b21"}`
+		expiry  = `"expires_at": "2030-01-01T00:00:00Z"`
+	)
+
+	tests := []struct {
+		name        string
+		raw         string
+		wantErr     bool
+		wantVersion int
+	}{
+		{"current", `{"version": 1, ` + user + `, ` + vehicle + `, "qr_info": {"code": "ABC", "purpose": "parking", ` + expiry + `}}`, false, 1},
+		{"before versioning", `{` + user + `, ` + vehicle + `, "qr_info": {"code": "ABC", "purpose": "parking", ` + expiry + `}}`, false, 1},
+		{"spot code without a driver", `{"version": 1, "qr_info": {"code": "ABC", "purpose": "spot", ` + expiry + `}}`, false, 1},
+		{"newer version", `{"version": 2, ` + user + `, ` + vehicle + `, "qr_info": {"code": "ABC", "purpose": "parking", ` + expiry + `}}`, true, 0},
+		{"not JSON", `{"version": 1, `, true, 0},
+		{"wrong types", `{"version": "one"}`, true, 0},
+		{"no code", `{"version": 1, ` + user + `, ` + vehicle + `, "qr_info": {"purpose": "parking", ` + expiry + `}}`, true, 0},
+		{"no purpose", `{"version": 1, ` + user + `, ` + vehicle + `, "qr_info": {"code": "ABC", ` + expiry + `}}`, true, 0},
+		{"no expiry", `{"version": 1, ` + user + `, ` + vehicle + `, "qr_info": {"code": "ABC", "purpose": "parking"}}`, true, 0},
+		{"no user", `{"version": 1, ` + vehicle + `, "qr_info": {"code": "ABC", "purpose": "parking", ` + expiry + `}}`, true, 0},
+		{"no vehicle", `{"version": 1, ` + user + `, "qr_info": {"code": "ABC", "purpose": "parking", ` + expiry + `}}`, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qrData, err := parseQRData(tt.raw)
+			if tt.wantErr {
+				if !errors.Is(err, ErrCorruptQRData) {
+					t.Errorf("got %v; want %v", err, ErrCorruptQRData)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if qrData.Version != tt.wantVersion {
+				t.Errorf("got version %d; want %d", qrData.Version, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestVerifyQRCodeRejectsCorruptData(t *testing.T) {
+	models := newTestModels(t)
+	user, vehicle := insertTestDriver(t, models)
+
+	storage, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewService(models, storage, []byte("test signing key"), 0, "")
+
+	resp, err := service.GenerateDataURL(user.ID, vehicle.ID, 1, "parking", DefaultImageOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = models.QRCodes.DB.Exec(`UPDATE qr_codes SET data = '{"version": 1, "qr_info": {}}' WHERE code = $1`, resp.QRCode.Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.VerifyQRCode(resp.QRCode.Code); !errors.Is(err, ErrCorruptQRData) {
+		t.Errorf("got %v; want %v", err, ErrCorruptQRData)
+	}
+}
+
+func TestVerificationURL(t *testing.T) {
+	tests := []struct {
+		verifyURL string
+		want      string
+	}{
+		{"", DefaultVerifyURL + "?code=ABC123"},
+		{"https://staging.example.com/verify", "https://staging.example.com/verify?code=ABC123"},
+		{"http://localhost:5173/passes/check", "http://localhost:5173/passes/check?code=ABC123"},
+	}
+
+	for _, tt := range tests {
+		service := NewService(data.Models{}, nil, nil, 0, tt.verifyURL)
+		if got := service.verificationURL("ABC123"); got != tt.want {
+			t.Errorf("verify URL %q: got %q; want %q", tt.verifyURL, got, tt.want)
+		}
+	}
+
+	service := NewService(data.Models{}, nil, nil, 0, "")
+	if got := service.verificationURL("a+b/c"); got != DefaultVerifyURL+"?code=a%2Bb%2Fc" {
+		t.Errorf("code isn't escaped: %q", got)
+	}
+}
+
+func TestGenerateUsesConfiguredVerifyURL(t *testing.T) {
+	models := newTestModels(t)
+	user, vehicle := insertTestDriver(t, models)
+
+	storage, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewService(models, storage, []byte("test signing key"), 0, "https://staging.example.com/verify")
+
+	resp, err := service.GenerateDataURL(user.ID, vehicle.ID, 1, "parking", DefaultImageOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://staging.example.com/verify?code=" + resp.QRCode.Code; resp.VerifyURL != want {
+		t.Errorf("got verify URL %q; want %q", resp.VerifyURL, want)
+	}
+}
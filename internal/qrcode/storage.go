@@ -0,0 +1,65 @@
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrImageNotFound is returned by a Storage when no image has the given name.
+var ErrImageNotFound = errors.New("qr image not found")
+
+// Storage holds rendered QR code images.
+type Storage interface {
+	// Put stores the image and returns the URL clients should fetch it from.
+	Put(name string, data []byte) (url string, err error)
+	Get(name string) ([]byte, error)
+}
+
+// Redirector is implemented by storage backends whose images can be fetched
+// directly, so the API can redirect instead of proxying the bytes.
+type Redirector interface {
+	RedirectURL(name string) (url string, ok bool)
+}
+
+// LocalStorage keeps images in a directory on the local filesystem. Images are
+// served through the API.
+type LocalStorage struct {
+	dir string
+}
+
+func NewLocalStorage(dir string) (*LocalStorage, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create QR storage directory: %w", err)
+	}
+
+	return &LocalStorage{dir: dir}, nil
+}
+
+func (s *LocalStorage) Put(name string, data []byte) (string, error) {
+	err := os.WriteFile(filepath.Join(s.dir, name), data, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	return imagePath(name), nil
+}
+
+func (s *LocalStorage) Get(name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrImageNotFound
+		}
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// imagePath is the API path that serves the named image.
+func imagePath(name string) string {
+	return fmt.Sprintf("/v1/qr-images/%s", name)
+}
@@ -0,0 +1,165 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLocalStorage(t *testing.T) {
+	storage, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url, err := storage.Put("qr_ABC.png", []byte("image"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "/v1/qr-images/qr_ABC.png" {
+		t.Errorf("got URL %q; want the API path", url)
+	}
+
+	got, err := storage.Get("qr_ABC.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "image" {
+		t.Errorf("got %q; want %q", got, "image")
+	}
+
+	if _, err := storage.Get("qr_missing.png"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("missing image: got %v; want ErrImageNotFound", err)
+	}
+}
+
+// fakeS3 is an in-memory stand-in for an S3 bucket that records the requests
+// made to it.
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	requests []*http.Request
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, r)
+
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.Path] = body
+	case http.MethodGet:
+		body, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(body)
+	default:
+		http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+	}
+}
+
+func TestS3Storage(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	storage, err := NewS3Storage(S3Config{
+		Endpoint:  server.URL + "/",
+		Region:    "eu-west-1",
+		Bucket:    "qr-codes",
+		AccessKey: "AKIDEXAMPLE",
+		SecretKey: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url, err := storage.Put("qr_ABC.svg", []byte("<svg/>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "/v1/qr-images/qr_ABC.svg" {
+		t.Errorf("got URL %q; want the API path when there is no public URL", url)
+	}
+	if _, ok := storage.RedirectURL("qr_ABC.svg"); ok {
+		t.Error("RedirectURL reported ok without a public URL")
+	}
+
+	if !bytes.Equal(fake.objects["/qr-codes/qr_ABC.svg"], []byte("<svg/>")) {
+		t.Errorf("bucket holds %v; want the image under /qr-codes/qr_ABC.svg", fake.objects)
+	}
+
+	put := fake.requests[0]
+	if got := put.Header.Get("Content-Type"); got != "image/svg+xml" {
+		t.Errorf("got Content-Type %q; want image/svg+xml", got)
+	}
+	auth := put.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(auth, "/eu-west-1/s3/aws4_request") {
+		t.Errorf("got Authorization %q; want a SigV4 signature", auth)
+	}
+
+	got, err := storage.Get("qr_ABC.svg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "<svg/>" {
+		t.Errorf("got %q; want %q", got, "<svg/>")
+	}
+
+	if _, err := storage.Get("qr_missing.png"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("missing image: got %v; want ErrImageNotFound", err)
+	}
+}
+
+func TestS3StoragePublicURL(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	storage, err := NewS3Storage(S3Config{
+		Endpoint:  server.URL,
+		Bucket:    "qr-codes",
+		PublicURL: "https://cdn.example.com/qr/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url, err := storage.Put("qr_ABC.png", []byte("image"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "https://cdn.example.com/qr/qr_ABC.png" {
+		t.Errorf("got URL %q; want the public URL", url)
+	}
+}
+
+func TestS3StorageReportsErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	storage, err := NewS3Storage(S3Config{Endpoint: server.URL, Bucket: "qr-codes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := storage.Put("qr_ABC.png", []byte("image")); err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("got %v; want the bucket's error", err)
+	}
+
+	if _, err := NewS3Storage(S3Config{Bucket: "qr-codes"}); err == nil {
+		t.Error("expected an error without an endpoint")
+	}
+}
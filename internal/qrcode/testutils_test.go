@@ -0,0 +1,77 @@
+package qrcode
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+	"github.com/mayura-andrew/SpotLinkIO-backend/internal/data"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestModels connects to the database named by TEST_DB_DSN, which must
+// already have the current schema. Tests that need a database are skipped
+// when it isn't set.
+func newTestModels(t *testing.T) data.Models {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	data.PasswordCost = bcrypt.MinCost
+
+	return data.NewModels(db)
+}
+
+// insertTestDriver creates an activated user with a vehicle. Both are removed
+// when the test ends.
+func insertTestDriver(t *testing.T, m data.Models) (*data.User, *data.Vehicle) {
+	t.Helper()
+
+	user := &data.User{
+		UserName:  "test user",
+		Email:     "test-" + uuid.NewString() + "@example.com",
+		Role:      "normal",
+		AuthType:  data.AuthTypeNormal,
+		Activated: true,
+	}
+	if err := user.Password.Set("pa55word"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Users.Insert(user); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		m.Users.DB.Exec(`DELETE FROM users WHERE id = $1`, user.ID)
+	})
+
+	vehicle := &data.Vehicle{
+		UserID:       user.ID,
+		LicensePlate: "T" + strings.ToUpper(uuid.NewString()[:7]),
+		Make:         "Toyota",
+		Model:        "Corolla",
+		Color:        "white",
+		VehicleType:  "car",
+		IsDefault:    true,
+	}
+	if err := m.Vehicles.Insert(vehicle); err != nil {
+		t.Fatal(err)
+	}
+
+	return user, vehicle
+}
@@ -0,0 +1,145 @@
+// Package sms sends text messages through a pluggable provider and normalizes
+// phone numbers to the E.164 format providers expect.
+package sms
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidNumber is returned for numbers that can't be turned into E.164.
+var ErrInvalidNumber = errors.New("invalid phone number")
+
+var e164RX = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// NormalizeE164 turns a phone number as users type it into E.164 form, such as
+// +94771234567. Spaces, dashes, dots and brackets are dropped, a leading 00 is
+// read as +, and a national number starting with 0 gets defaultCountryCode in
+// place of the 0. Without a default country code, national numbers are
+// rejected.
+func NormalizeE164(number, defaultCountryCode string) (string, error) {
+	number = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, number)
+
+	switch {
+	case strings.HasPrefix(number, "+"):
+	case strings.HasPrefix(number, "00"):
+		number = "+" + number[2:]
+	case strings.HasPrefix(number, "0") && defaultCountryCode != "":
+		number = "+" + strings.TrimPrefix(defaultCountryCode, "+") + number[1:]
+	default:
+		return "", ErrInvalidNumber
+	}
+
+	if !e164RX.MatchString(number) {
+		return "", ErrInvalidNumber
+	}
+
+	return number, nil
+}
+
+// Sender delivers a text message to an E.164 number.
+type Sender interface {
+	Send(to, body string) error
+}
+
+// Message is a text message recorded by Mock.
+type Message struct {
+	To   string
+	Body string
+}
+
+// Mock records messages instead of sending them. It is meant for development
+// and tests, where texting real numbers isn't wanted.
+type Mock struct {
+	Err error
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (m *Mock) Send(to, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Err != nil {
+		return m.Err
+	}
+	m.messages = append(m.messages, Message{To: to, Body: body})
+	return nil
+}
+
+// Messages returns the messages sent so far.
+func (m *Mock) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.messages...)
+}
+
+// Twilio sends messages through the Twilio REST API, or any provider with the
+// same Messages endpoint.
+type Twilio struct {
+	baseURL    string
+	accountSID string
+	authToken  string
+	from       string
+	client     *http.Client
+}
+
+func NewTwilio(baseURL, accountSID, authToken, from string) *Twilio {
+	return &Twilio{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		accountSID: accountSID,
+		authToken:  authToken,
+		from:       from,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (t *Twilio) Send(to, body string) error {
+	form := url.Values{}
+	form.Set("To", to)
+	form.Set("From", t.from)
+	form.Set("Body", body)
+
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", t.baseURL, url.PathEscape(t.accountSID))
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(t.accountSID, t.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var result struct {
+			Message string `json:"message"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&result) == nil && result.Message != "" {
+			return fmt.Errorf("twilio send: %s: %s", resp.Status, result.Message)
+		}
+		return fmt.Errorf("twilio send: %s", resp.Status)
+	}
+
+	return nil
+}
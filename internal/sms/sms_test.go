@@ -0,0 +1,108 @@
+package sms
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNormalizeE164(t *testing.T) {
+	tests := []struct {
+		number      string
+		countryCode string
+		want        string
+		wantErr     bool
+	}{
+		{"+94771234567", "", "+94771234567", false},
+		{"+94 (77) 123-4567", "", "+94771234567", false},
+		{"0094.77.123.4567", "", "+94771234567", false},
+		{"0771234567", "94", "+94771234567", false},
+		{"0771234567", "+94", "+94771234567", false},
+		{"0771234567", "", "", true},
+		{"771234567", "94", "", true},
+		{"+0771234567", "", "", true},
+		{"+94", "", "", true},
+		{"+9477123456789012", "", "", true},
+		{"+9477-CALL-NOW", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.number, func(t *testing.T) {
+			got, err := NormalizeE164(tt.number, tt.countryCode)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidNumber) {
+					t.Errorf("got %q, %v; want %v", got, err, ErrInvalidNumber)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMock(t *testing.T) {
+	mock := &Mock{}
+	if err := mock.Send("+94771234567", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.Err = errors.New("provider down")
+	if err := mock.Send("+94771234567", "again"); err == nil {
+		t.Error("got no error from a failing mock")
+	}
+
+	messages := mock.Messages()
+	if len(messages) != 1 || messages[0] != (Message{To: "+94771234567", Body: "hello"}) {
+		t.Errorf("got %+v", messages)
+	}
+}
+
+func TestTwilioSend(t *testing.T) {
+	var gotPath, gotUser, gotPassword string
+	var gotForm map[string]string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotUser, gotPassword, _ = r.BasicAuth()
+		r.ParseForm()
+		gotForm = map[string]string{"To": r.PostForm.Get("To"), "From": r.PostForm.Get("From"), "Body": r.PostForm.Get("Body")}
+
+		if gotForm["To"] == "+15005550001" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"message": "The 'To' number is not a valid phone number."}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid": "SM123"}`))
+	}))
+	defer ts.Close()
+
+	sender := NewTwilio(ts.URL+"/", "AC123", "secret", "+15005550006")
+
+	if err := sender.Send("+94771234567", "Your reservation is confirmed."); err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/2010-04-01/Accounts/AC123/Messages.json" {
+		t.Errorf("path = %q", gotPath)
+	}
+	if gotUser != "AC123" || gotPassword != "secret" {
+		t.Errorf("basic auth = %q, %q", gotUser, gotPassword)
+	}
+	want := map[string]string{"To": "+94771234567", "From": "+15005550006", "Body": "Your reservation is confirmed."}
+	for key, value := range want {
+		if gotForm[key] != value {
+			t.Errorf("%s = %q; want %q", key, gotForm[key], value)
+		}
+	}
+
+	err := sender.Send("+15005550001", "hello")
+	if err == nil {
+		t.Fatal("got no error for a rejected message")
+	}
+	if want := "twilio send: 400 Bad Request: The 'To' number is not a valid phone number."; err.Error() != want {
+		t.Errorf("error = %q; want %q", err, want)
+	}
+}
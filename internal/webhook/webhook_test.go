@@ -0,0 +1,161 @@
+package webhook
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(secret, "whsec_") {
+		t.Errorf("secret %q lacks the whsec_ prefix", secret)
+	}
+
+	body := []byte(`{"event":"reservation.created"}`)
+	now := time.Unix(1700000000, 0)
+	header := Sign(secret, now, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		header    string
+		body      []byte
+		tolerance time.Duration
+		now       time.Time
+		want      error
+	}{
+		{"valid", secret, header, body, 5 * time.Minute, now, nil},
+		{"within tolerance", secret, header, body, 5 * time.Minute, now.Add(4 * time.Minute), nil},
+		{"tampered body", secret, header, []byte(`{"event":"reservation.cancelled"}`), 5 * time.Minute, now, ErrInvalidSignature},
+		{"wrong secret", "whsec_other", header, body, 5 * time.Minute, now, ErrInvalidSignature},
+		{"expired", secret, header, body, 5 * time.Minute, now.Add(6 * time.Minute), ErrSignatureExpired},
+		{"from the future", secret, header, body, 5 * time.Minute, now.Add(-6 * time.Minute), ErrSignatureExpired},
+		{"no tolerance", secret, header, body, 0, now.Add(24 * time.Hour), nil},
+		{"rotated secret", secret, Sign("whsec_old", now, body) + "," + strings.Split(header, ",")[1], body, 5 * time.Minute, now, nil},
+		{"no signature", secret, "t=1700000000", body, 5 * time.Minute, now, ErrInvalidSignature},
+		{"no timestamp", secret, strings.Split(header, ",")[1], body, 5 * time.Minute, now, ErrInvalidSignature},
+		{"bad timestamp", secret, "t=soon," + strings.Split(header, ",")[1], body, 5 * time.Minute, now, ErrInvalidSignature},
+		{"empty", secret, "", body, 5 * time.Minute, now, ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, tt.tolerance, tt.now)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"100.64.0.1", false},
+		{"198.18.0.1", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:93.184.216.34", true},
+	}
+
+	for _, tt := range tests {
+		got := IsPublicAddr(netip.MustParseAddr(tt.addr))
+		if got != tt.want {
+			t.Errorf("IsPublicAddr(%s) = %t, want %t", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	secret := "whsec_test"
+	body := []byte(`{"id":"1","event":"reservation.created"}`)
+
+	var got *http.Request
+	var gotBody []byte
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	client := NewClient(5*time.Second, true)
+
+	code, err := client.Deliver(srv.URL, secret, "reservation.created", "delivery-1", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", code, http.StatusNoContent)
+	}
+	if got.Method != http.MethodPost {
+		t.Errorf("method = %s, want POST", got.Method)
+	}
+	if got.Header.Get(EventHeader) != "reservation.created" {
+		t.Errorf("event header = %q", got.Header.Get(EventHeader))
+	}
+	if got.Header.Get(DeliveryHeader) != "delivery-1" {
+		t.Errorf("delivery header = %q", got.Header.Get(DeliveryHeader))
+	}
+	if string(gotBody) != string(body) {
+		t.Errorf("body = %s, want %s", gotBody, body)
+	}
+	err = Verify(secret, got.Header.Get(SignatureHeader), gotBody, 5*time.Minute, time.Now())
+	if err != nil {
+		t.Errorf("signature doesn't verify: %v", err)
+	}
+
+	// A non-2xx answer is an error that still reports the status
+	status = http.StatusInternalServerError
+	code, err = client.Deliver(srv.URL, secret, "reservation.created", "delivery-2", body)
+	if err == nil {
+		t.Error("500 response was not an error")
+	}
+	if code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", code, http.StatusInternalServerError)
+	}
+}
+
+func TestDeliverRefusesPrivateAddress(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	client := NewClient(5*time.Second, false)
+
+	code, err := client.Deliver(srv.URL, "whsec_test", "reservation.created", "delivery-1", []byte(`{}`))
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("err = %v, want %v", err, ErrPrivateAddress)
+	}
+	if code != 0 {
+		t.Errorf("status = %d, want 0", code)
+	}
+	if called {
+		t.Error("loopback endpoint was reached")
+	}
+}
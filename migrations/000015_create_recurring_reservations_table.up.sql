@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS recurring_reservations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    vehicle_id UUID NOT NULL REFERENCES vehicles ON DELETE CASCADE,
+    parking_lot_id UUID NOT NULL REFERENCES parking_lots ON DELETE CASCADE,
+    days_of_week INTEGER[] NOT NULL,
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    starts_on DATE NOT NULL,
+    ends_on DATE,
+    monthly_amount DECIMAL(10, 2) NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    last_materialized_on DATE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS idx_recurring_reservations_user_id ON recurring_reservations(user_id);
+CREATE INDEX IF NOT EXISTS idx_recurring_reservations_active ON recurring_reservations(is_active);
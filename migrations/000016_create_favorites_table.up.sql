@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS favorites (
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    parking_lot_id UUID NOT NULL REFERENCES parking_lots ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, parking_lot_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_favorites_parking_lot_id ON favorites(parking_lot_id);
@@ -0,0 +1,2 @@
+ALTER TABLE reservations DROP COLUMN IF EXISTS reminder_sent_at;
+ALTER TABLE users DROP COLUMN IF EXISTS reminder_lead_minutes;
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS reminder_lead_minutes INTEGER NOT NULL DEFAULT 30;
+ALTER TABLE reservations ADD COLUMN IF NOT EXISTS reminder_sent_at TIMESTAMP(0) WITH TIME ZONE;
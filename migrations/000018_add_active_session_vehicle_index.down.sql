@@ -0,0 +1 @@
+DROP INDEX IF EXISTS parking_sessions_active_vehicle_idx;
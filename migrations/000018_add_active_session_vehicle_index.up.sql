@@ -0,0 +1 @@
+CREATE UNIQUE INDEX IF NOT EXISTS parking_sessions_active_vehicle_idx ON parking_sessions(vehicle_id) WHERE status = 'active';
@@ -0,0 +1,2 @@
+ALTER TABLE parking_lots ADD COLUMN IF NOT EXISTS is_refundable BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS refunded_amount DECIMAL(10, 2) NOT NULL DEFAULT 0;
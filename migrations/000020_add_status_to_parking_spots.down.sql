@@ -0,0 +1,4 @@
+ALTER TABLE reservations DROP COLUMN IF EXISTS maintenance_notified_at;
+ALTER TABLE parking_spots DROP COLUMN IF EXISTS maintenance_since;
+ALTER TABLE parking_spots DROP COLUMN IF EXISTS maintenance_reason;
+ALTER TABLE parking_spots DROP COLUMN IF EXISTS status;
@@ -0,0 +1,6 @@
+ALTER TABLE parking_spots ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE parking_spots ADD COLUMN IF NOT EXISTS maintenance_reason TEXT;
+ALTER TABLE parking_spots ADD COLUMN IF NOT EXISTS maintenance_since TIMESTAMP(0) WITH TIME ZONE;
+ALTER TABLE reservations ADD COLUMN IF NOT EXISTS maintenance_notified_at TIMESTAMP(0) WITH TIME ZONE;
+
+UPDATE parking_spots SET status = 'decommissioned' WHERE is_active = false;
@@ -0,0 +1,2 @@
+ALTER TABLE reviews DROP COLUMN IF EXISTS hidden_reason;
+ALTER TABLE reviews DROP COLUMN IF EXISTS is_hidden;
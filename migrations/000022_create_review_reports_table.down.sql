@@ -0,0 +1,2 @@
+ALTER TABLE reviews DROP COLUMN IF EXISTS is_flagged;
+DROP TABLE IF EXISTS review_reports;
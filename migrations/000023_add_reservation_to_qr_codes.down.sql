@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_qr_codes_reservation_id;
+
+ALTER TABLE qr_codes DROP COLUMN IF EXISTS reservation_id;
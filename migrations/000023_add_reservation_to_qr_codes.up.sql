@@ -0,0 +1,3 @@
+ALTER TABLE qr_codes ADD COLUMN IF NOT EXISTS reservation_id UUID REFERENCES reservations(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_qr_codes_reservation_id ON qr_codes(reservation_id);
@@ -0,0 +1,2 @@
+ALTER TABLE parking_sessions DROP COLUMN IF EXISTS prepaid_amount;
+ALTER TABLE parking_sessions DROP COLUMN IF EXISTS expected_end;
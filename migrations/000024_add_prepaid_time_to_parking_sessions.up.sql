@@ -0,0 +1,2 @@
+ALTER TABLE parking_sessions ADD COLUMN IF NOT EXISTS expected_end TIMESTAMP(0) WITH TIME ZONE;
+ALTER TABLE parking_sessions ADD COLUMN IF NOT EXISTS prepaid_amount DECIMAL(10, 2) NOT NULL DEFAULT 0;
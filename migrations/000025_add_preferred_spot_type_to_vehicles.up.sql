@@ -0,0 +1 @@
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS preferred_spot_type TEXT;
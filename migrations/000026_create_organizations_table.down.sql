@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS organization_invitations;
+DROP INDEX IF EXISTS idx_users_org_id;
+ALTER TABLE users DROP COLUMN IF EXISTS org_role;
+ALTER TABLE users DROP COLUMN IF EXISTS org_id;
+DROP TABLE IF EXISTS organizations;
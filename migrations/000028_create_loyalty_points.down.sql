@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS loyalty_transactions;
+ALTER TABLE users DROP COLUMN IF EXISTS loyalty_points;
@@ -0,0 +1 @@
+ALTER TABLE parking_lots ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'UTC';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS notifications_dedup_key_idx;
+
+ALTER TABLE notifications DROP COLUMN IF EXISTS dedup_key;
@@ -0,0 +1,3 @@
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS dedup_key TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS notifications_dedup_key_idx ON notifications (dedup_key) WHERE dedup_key IS NOT NULL;
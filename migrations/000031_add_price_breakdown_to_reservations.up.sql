@@ -0,0 +1 @@
+ALTER TABLE reservations ADD COLUMN IF NOT EXISTS price_breakdown JSONB;
@@ -0,0 +1 @@
+ALTER TABLE parking_lots ADD COLUMN IF NOT EXISTS tax_rate NUMERIC(5, 4) CHECK (tax_rate BETWEEN 0 AND 1);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS violation_resolutions (
+    parking_session_id UUID PRIMARY KEY REFERENCES parking_sessions ON DELETE CASCADE,
+    resolved_by UUID REFERENCES users ON DELETE SET NULL,
+    note TEXT NOT NULL,
+    completed BOOLEAN NOT NULL DEFAULT FALSE,
+    fee DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    resolved_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
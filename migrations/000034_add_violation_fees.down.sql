@@ -0,0 +1,14 @@
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM payments WHERE reservation_id IS NULL) THEN
+        RAISE EXCEPTION 'cannot roll back: payments without a reservation exist, archive or remove them first';
+    END IF;
+END
+$$;
+
+DROP INDEX IF EXISTS payments_violation_session_idx;
+
+ALTER TABLE payments DROP COLUMN IF EXISTS violation_session_id;
+ALTER TABLE payments ALTER COLUMN reservation_id SET NOT NULL;
+
+ALTER TABLE parking_lots DROP COLUMN IF EXISTS violation_fee;
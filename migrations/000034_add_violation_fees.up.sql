@@ -0,0 +1,6 @@
+ALTER TABLE parking_lots ADD COLUMN IF NOT EXISTS violation_fee DECIMAL(10, 2) CHECK (violation_fee >= 0);
+
+ALTER TABLE payments ALTER COLUMN reservation_id DROP NOT NULL;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS violation_session_id UUID REFERENCES parking_sessions ON DELETE SET NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS payments_violation_session_idx ON payments (violation_session_id) WHERE violation_session_id IS NOT NULL;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS payment_gateway_events (
+    provider VARCHAR(50) NOT NULL,
+    event_id TEXT NOT NULL,
+    payment_id UUID NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL,
+    received_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (provider, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_gateway_events_payment_id ON payment_gateway_events(payment_id);
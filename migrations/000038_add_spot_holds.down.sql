@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS parking_spots_reserved_until_idx;
+
+ALTER TABLE parking_spots DROP COLUMN IF EXISTS held_by;
+ALTER TABLE parking_spots DROP COLUMN IF EXISTS reserved_until;
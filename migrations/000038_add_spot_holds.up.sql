@@ -0,0 +1,4 @@
+ALTER TABLE parking_spots ADD COLUMN IF NOT EXISTS reserved_until TIMESTAMP(0) WITH TIME ZONE;
+ALTER TABLE parking_spots ADD COLUMN IF NOT EXISTS held_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS parking_spots_reserved_until_idx ON parking_spots (reserved_until) WHERE reserved_until IS NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE parking_lots DROP COLUMN IF EXISTS max_advance_days;
+ALTER TABLE parking_lots DROP COLUMN IF EXISTS max_reservation_days;
@@ -0,0 +1,2 @@
+ALTER TABLE parking_lots ADD COLUMN IF NOT EXISTS max_reservation_days INTEGER CHECK (max_reservation_days > 0);
+ALTER TABLE parking_lots ADD COLUMN IF NOT EXISTS max_advance_days INTEGER CHECK (max_advance_days > 0);
@@ -0,0 +1 @@
+ALTER TABLE parking_lots DROP COLUMN IF EXISTS vehicle_type_multipliers;
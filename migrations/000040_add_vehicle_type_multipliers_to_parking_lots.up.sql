@@ -0,0 +1 @@
+ALTER TABLE parking_lots ADD COLUMN IF NOT EXISTS vehicle_type_multipliers JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS has_disability_permit;
+ALTER TABLE users DROP COLUMN IF EXISTS disability_permit_number;
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disability_permit_number TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS has_disability_permit BOOLEAN NOT NULL DEFAULT false;
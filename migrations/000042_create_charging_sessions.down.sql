@@ -0,0 +1 @@
+DROP TABLE IF EXISTS charging_sessions;
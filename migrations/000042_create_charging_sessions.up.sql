@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS charging_sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    parking_session_id UUID NOT NULL REFERENCES parking_sessions(id) ON DELETE CASCADE,
+    start_kwh DECIMAL(12, 3) NOT NULL CHECK (start_kwh >= 0),
+    end_kwh DECIMAL(12, 3) CHECK (end_kwh >= start_kwh),
+    energy_rate DECIMAL(10, 4) NOT NULL CHECK (energy_rate >= 0),
+    energy_amount DECIMAL(10, 2) CHECK (energy_amount >= 0),
+    payment_id UUID REFERENCES payments(id) ON DELETE SET NULL,
+    started_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    ended_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS idx_charging_sessions_parking_session_id ON charging_sessions(parking_session_id, started_at);
+
+CREATE UNIQUE INDEX IF NOT EXISTS charging_sessions_active_idx ON charging_sessions (parking_session_id) WHERE ended_at IS NULL;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS reservation_transfers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    reservation_id UUID NOT NULL REFERENCES reservations(id) ON DELETE CASCADE,
+    from_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    to_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    from_vehicle_id UUID REFERENCES vehicles(id) ON DELETE SET NULL,
+    to_vehicle_id UUID REFERENCES vehicles(id) ON DELETE SET NULL,
+    transferred_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_reservation_transfers_reservation_id ON reservation_transfers(reservation_id, transferred_at);
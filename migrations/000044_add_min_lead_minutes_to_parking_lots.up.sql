@@ -0,0 +1 @@
+ALTER TABLE parking_lots ADD COLUMN IF NOT EXISTS min_lead_minutes INTEGER NOT NULL DEFAULT 0 CHECK (min_lead_minutes >= 0);
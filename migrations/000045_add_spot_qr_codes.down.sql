@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_qr_codes_parking_spot_id;
+
+DELETE FROM qr_codes WHERE parking_spot_id IS NOT NULL;
+ALTER TABLE qr_codes DROP COLUMN IF EXISTS parking_spot_id;
+ALTER TABLE qr_codes ALTER COLUMN vehicle_id SET NOT NULL;
+ALTER TABLE qr_codes ALTER COLUMN user_id SET NOT NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE qr_codes ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE qr_codes ALTER COLUMN vehicle_id DROP NOT NULL;
+ALTER TABLE qr_codes ADD COLUMN IF NOT EXISTS parking_spot_id UUID REFERENCES parking_spots(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_qr_codes_parking_spot_id ON qr_codes(parking_spot_id);
@@ -0,0 +1,4 @@
+ALTER TABLE notifications DROP COLUMN IF EXISTS version;
+ALTER TABLE notifications DROP COLUMN IF EXISTS updated_at;
+
+ALTER TABLE qr_codes DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,6 @@
+ALTER TABLE qr_codes ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+UPDATE qr_codes SET updated_at = created_at;
+
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW();
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+UPDATE notifications SET updated_at = created_at;
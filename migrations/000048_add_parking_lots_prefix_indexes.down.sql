@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS parking_lots_address_prefix_idx;
+DROP INDEX IF EXISTS parking_lots_name_prefix_idx;
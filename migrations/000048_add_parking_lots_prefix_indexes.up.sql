@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS parking_lots_name_prefix_idx ON parking_lots(lower(name) text_pattern_ops) WHERE is_active = true;
+CREATE INDEX IF NOT EXISTS parking_lots_address_prefix_idx ON parking_lots(lower(address) text_pattern_ops) WHERE is_active = true;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS parking_lot_images (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    parking_lot_id UUID NOT NULL REFERENCES parking_lots(id) ON DELETE CASCADE,
+    image_key TEXT NOT NULL,
+    display_order INTEGER NOT NULL DEFAULT 0,
+    is_primary BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS idx_parking_lot_images_parking_lot_id ON parking_lot_images(parking_lot_id, display_order);
+
+CREATE UNIQUE INDEX IF NOT EXISTS parking_lot_images_primary_idx ON parking_lot_images (parking_lot_id) WHERE is_primary;
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS sms_notifications;
+ALTER TABLE users DROP COLUMN IF EXISTS mobile_verified;
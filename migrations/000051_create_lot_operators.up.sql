@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS lot_operators (
+    parking_lot_id UUID NOT NULL REFERENCES parking_lots(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (parking_lot_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_lot_operators_user_id ON lot_operators(user_id);
@@ -0,0 +1 @@
+ALTER TABLE parking_lots ADD COLUMN IF NOT EXISTS overbooking_percent INTEGER NOT NULL DEFAULT 0 CHECK (overbooking_percent >= 0 AND overbooking_percent <= 50);
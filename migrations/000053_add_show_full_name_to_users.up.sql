@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS show_full_name BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS users_google_id_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS google_id;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS payments_recurring_month_idx;
+
+ALTER TABLE payments DROP COLUMN IF EXISTS billing_month;
+ALTER TABLE payments DROP COLUMN IF EXISTS recurring_reservation_id;
@@ -0,0 +1,4 @@
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS recurring_reservation_id UUID REFERENCES recurring_reservations ON DELETE SET NULL;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS billing_month DATE;
+
+CREATE UNIQUE INDEX IF NOT EXISTS payments_recurring_month_idx ON payments (recurring_reservation_id, billing_month) WHERE recurring_reservation_id IS NOT NULL;